@@ -0,0 +1,221 @@
+/*add the user agent column for registry*/
+ALTER TABLE registry ADD COLUMN user_agent varchar(256);
+
+/*add the column for replicating the referrers of images*/
+ALTER TABLE replication_policy ADD COLUMN replicate_referrers boolean DEFAULT false;
+
+/*add the column for limiting the concurrent operations against the registry*/
+ALTER TABLE registry ADD COLUMN max_connections int DEFAULT 0;
+
+/*add the table for the health check records of registries*/
+create table registry_health_check (
+ id SERIAL NOT NULL,
+ registry_id int NOT NULL,
+ status varchar(32),
+ latency int NOT NULL DEFAULT 0,
+ creation_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ FOREIGN KEY (registry_id) REFERENCES registry(id) ON DELETE CASCADE
+);
+CREATE INDEX health_check_registry ON registry_health_check (registry_id, creation_time);
+
+/*add the columns for pausing the replication when the destination registry is read-only*/
+ALTER TABLE replication_policy ADD COLUMN pause_on_read_only boolean DEFAULT false;
+ALTER TABLE replication_execution ADD COLUMN paused int NOT NULL DEFAULT 0;
+
+/*add the column for ordering the repositories by the shared blobs when replicating*/
+ALTER TABLE replication_policy ADD COLUMN order_by_shared_blobs boolean DEFAULT false;
+
+/*add the column for limiting the projects replicated by the registry*/
+ALTER TABLE registry ADD COLUMN allowed_projects text;
+
+/*add the column for compressing the uncompressed layers when replicating*/
+ALTER TABLE replication_policy ADD COLUMN compress_layers boolean DEFAULT false;
+
+/*add the column for counting the retries of the replication task*/
+ALTER TABLE replication_task ADD COLUMN retries int DEFAULT 0;
+
+/*add the column for the blackout windows of the registry*/
+ALTER TABLE registry ADD COLUMN blackout_windows text;
+
+/*add the column for the source repository of the replication task, it's filled by the "src_resource" for the existing tasks*/
+ALTER TABLE replication_task ADD COLUMN repository varchar(256);
+UPDATE replication_task SET repository=split_part(src_resource, ':', 1);
+CREATE INDEX task_repository ON replication_task (repository);
+
+/*add the column for the path transform of the registry*/
+ALTER TABLE registry ADD COLUMN path_transform text;
+
+/*add the column for the reason of the failure of the replication task*/
+ALTER TABLE replication_task ADD COLUMN status_text text;
+
+/*add the column for ordering the repositories by the size when replicating*/
+ALTER TABLE replication_policy ADD COLUMN order_by_size varchar(8);
+
+/*add the table for the dead letters of the replication tasks which fail permanently*/
+create table replication_deadletter (
+ id SERIAL NOT NULL,
+ task_id int NOT NULL,
+ execution_id int NOT NULL,
+ policy_id int NOT NULL,
+ repository varchar(256),
+ src_resource varchar(256),
+ dst_resource varchar(256),
+ job_id varchar(64),
+ reason text,
+ retries int DEFAULT 0,
+ creation_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ UNIQUE (task_id),
+ FOREIGN KEY (task_id) REFERENCES replication_task(id) ON DELETE CASCADE
+);
+CREATE INDEX deadletter_policy ON replication_deadletter (policy_id);
+
+/*add the column for the days the finished replication jobs of the registry are kept*/
+ALTER TABLE registry ADD COLUMN job_retention_days int DEFAULT 0;
+
+/*add the column for mounting the blobs from the source repository when replicating*/
+ALTER TABLE replication_policy ADD COLUMN mount_blobs boolean DEFAULT false;
+
+/*add the table for the labels of registries*/
+create table registry_label (
+ id SERIAL NOT NULL,
+ registry_id int NOT NULL,
+ label varchar(128) NOT NULL,
+ PRIMARY KEY (id),
+ UNIQUE (registry_id, label),
+ FOREIGN KEY (registry_id) REFERENCES registry(id) ON DELETE CASCADE
+);
+CREATE INDEX registry_label_label ON registry_label (label);
+
+/*add the column for the annotations of replication executions*/
+ALTER TABLE replication_execution ADD COLUMN annotations jsonb NOT NULL DEFAULT '{}';
+/*the executions are filtered by the containment of the annotations*/
+CREATE INDEX execution_annotations ON replication_execution USING gin (annotations jsonb_path_ops);
+
+/*add the column for draining the registry before the maintenance*/
+ALTER TABLE registry ADD COLUMN draining boolean DEFAULT false;
+
+/*add the columns for gating the replication on the scan result of the images*/
+ALTER TABLE replication_policy ADD COLUMN max_severity varchar(16);
+ALTER TABLE replication_policy ADD COLUMN allow_unscanned boolean DEFAULT false;
+
+/*add the column for the dry run of the replication executions*/
+ALTER TABLE replication_execution ADD COLUMN dry_run boolean DEFAULT false;
+
+/*add the columns to disable the replication policies failing consecutively*/
+ALTER TABLE replication_policy ADD COLUMN failure_threshold int DEFAULT 0;
+ALTER TABLE replication_policy ADD COLUMN consecutive_failures int DEFAULT 0;
+/*add the column marking the finished executions recorded in the consecutive failures of their policies,
+the executions finished before the upgrade aren't recorded*/
+ALTER TABLE replication_execution ADD COLUMN policy_recorded boolean DEFAULT false;
+UPDATE replication_execution SET policy_recorded = true WHERE status IN ('Succeed', 'Failed', 'Stopped');
+
+/*add the columns for the speed of the replication tasks*/
+ALTER TABLE replication_task ADD COLUMN bytes_transferred bigint DEFAULT 0;
+ALTER TABLE replication_task ADD COLUMN average_speed double precision DEFAULT 0;
+ALTER TABLE replication_task ADD COLUMN peak_speed double precision DEFAULT 0;
+
+/*add the column for the manifest type preferred by the registry*/
+ALTER TABLE registry ADD COLUMN preferred_manifest_type varchar(16);
+
+/*add the column for the count of the referrers transferred by the replication tasks*/
+ALTER TABLE replication_task ADD COLUMN referrers int DEFAULT 0;
+
+/*add the column for replicating only the signed images*/
+ALTER TABLE replication_policy ADD COLUMN signed_only boolean DEFAULT false;
+
+/*add the column for the custom headers sent to the registry*/
+ALTER TABLE registry ADD COLUMN headers text;
+
+/*add the column for the failover URLs of the registry*/
+ALTER TABLE registry ADD COLUMN failover_urls text;
+
+/*add the column for the allowed and denied media types of the layers replicated to the registry*/
+ALTER TABLE registry ADD COLUMN layer_media_types text;
+
+/*add the column for the count of the connections warmed up before replicating to the registry*/
+ALTER TABLE registry ADD COLUMN warmup_connections int DEFAULT 0;
+
+/*add the column for whether the structured log of every blob replicated is logged*/
+ALTER TABLE replication_policy ADD COLUMN blob_accounting boolean DEFAULT false;
+
+/*add the columns for the progress of the running replication tasks*/
+ALTER TABLE replication_task ADD COLUMN total_bytes bigint DEFAULT 0;
+ALTER TABLE replication_task ADD COLUMN eta bigint DEFAULT 0;
+
+/*add the column for the execution retrying the failed repositories of its parent*/
+ALTER TABLE replication_execution ADD COLUMN parent_id int DEFAULT 0;
+
+/*add the column for the time zone which the blackout windows of the registry are interpreted in*/
+ALTER TABLE registry ADD COLUMN timezone varchar(64);
+
+/*add the column for the encrypted SSH tunnel through which the registry is connected to*/
+ALTER TABLE registry ADD COLUMN ssh_tunnel text;
+
+/*add the column for the destination registry which the task replicates to*/
+ALTER TABLE replication_task ADD COLUMN dst_registry_id int DEFAULT 0;
+
+/*add the table for the repository patterns excluded from all the replications*/
+create table replication_exclusion (
+ id SERIAL NOT NULL,
+ pattern varchar(256) NOT NULL,
+ description text,
+ creation_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ UNIQUE (pattern)
+);
+
+/*add the columns for the max count of the repositories replicated by one execution of the policy*/
+ALTER TABLE replication_policy ADD COLUMN max_repos int DEFAULT 0;
+ALTER TABLE replication_policy ADD COLUMN max_repos_mode varchar(16);
+
+/*add the column for the transform of the tags of the images pushed to the destination registry*/
+ALTER TABLE replication_policy ADD COLUMN tag_transform text;
+
+/*add the sequence numbers of the executions of every policy, the existing executions are numbered by their IDs*/
+ALTER TABLE replication_execution ADD COLUMN sequence int DEFAULT 0;
+UPDATE replication_execution AS e SET sequence = s.sequence FROM (
+ SELECT id, row_number() OVER (PARTITION BY policy_id ORDER BY id) AS sequence FROM replication_execution
+) AS s WHERE e.id = s.id;
+create table replication_execution_sequence (
+ policy_id int NOT NULL,
+ sequence int NOT NULL,
+ PRIMARY KEY (policy_id)
+);
+INSERT INTO replication_execution_sequence (policy_id, sequence)
+ SELECT policy_id, max(sequence) FROM replication_execution GROUP BY policy_id;
+CREATE UNIQUE INDEX replication_execution_policy_sequence ON replication_execution (policy_id, sequence) WHERE sequence > 0;
+
+/*add the column for the default registry pre-selected when creating the policies, at most one registry is the default*/
+ALTER TABLE registry ADD COLUMN is_default boolean DEFAULT false;
+CREATE UNIQUE INDEX registry_default ON registry (is_default) WHERE is_default;
+
+/*add the key of the content replicated by the job of the task, the identical tasks are coalesced into the pending job by it*/
+ALTER TABLE replication_task ADD COLUMN inflight_key varchar(64);
+CREATE INDEX task_inflight_key ON replication_task (inflight_key);
+
+/*add the columns for the tasks deferred as the registry is draining, they're submitted when the draining ends*/
+ALTER TABLE replication_task ADD COLUMN deferred_registry_id int DEFAULT 0;
+ALTER TABLE replication_task ADD COLUMN deferred_item text;
+
+/*add the column for the media types of the manifests pushed by the replication tasks*/
+ALTER TABLE replication_task ADD COLUMN media_types varchar(255);
+
+/*add the columns for the endpoints of the registries used by the replication tasks, they're one of the failover URLs if the primary ones are unhealthy*/
+ALTER TABLE replication_task ADD COLUMN src_endpoint varchar(256);
+ALTER TABLE replication_task ADD COLUMN dst_endpoint varchar(256);
+
+/*add the table for the circuit breakers of the health checks of registries, they're shared by all the core instances*/
+create table registry_circuit_breaker (
+ registry_id int NOT NULL,
+ failures int NOT NULL DEFAULT 0,
+ opened_at timestamp,
+ PRIMARY KEY (registry_id),
+ FOREIGN KEY (registry_id) REFERENCES registry(id) ON DELETE CASCADE
+);
+
+/*add the update time of the task, the events of the execution are streamed by the tasks updated recently*/
+ALTER TABLE replication_task ADD COLUMN update_time timestamp default CURRENT_TIMESTAMP;
+CREATE TRIGGER replication_task_update_time_at_modtime BEFORE UPDATE ON replication_task FOR EACH ROW EXECUTE PROCEDURE update_update_time_at_column();
+CREATE INDEX task_execution_update_time ON replication_task (execution_id, update_time);
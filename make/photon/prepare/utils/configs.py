@@ -261,4 +261,13 @@ def parse_yaml_config(config_file_path):
     # UAA configs
     config_dict['uaa'] = configs.get('uaa') or {}
 
+    # Replication configs
+    replication_configs = configs.get('replication') or {}
+    config_dict['replication_secret_keys'] = replication_configs.get('secret_keys') or ''
+    config_dict['replication_secret_key_version'] = replication_configs.get('secret_key_version') or ''
+    config_dict['registry_max_manifest_size'] = replication_configs.get('max_manifest_size') or ''
+
+    # The max size of the request bodies accepted by core
+    config_dict['max_request_body_size'] = configs.get('max_request_body_size') or ''
+
     return config_dict
\ No newline at end of file
@@ -33,6 +33,13 @@ const (
 	maxPageSize     int64 = 500
 )
 
+var (
+	// MaxRequestBodySize is the max size in bytes of the request body that DecodeJSONReq reads
+	MaxRequestBodySize int64 = 1 << 20
+	// ErrRequestBodyTooLarge is returned when the size of the request body exceeds the limit
+	ErrRequestBodyTooLarge = errors.New("request body too large")
+)
+
 // BaseAPI wraps common methods for controllers to host API
 type BaseAPI struct {
 	beego.Controller
@@ -61,26 +68,52 @@ func (b *BaseAPI) RenderError(code int, text string) {
 
 // RenderFormattedError renders errors with well formatted style
 func (b *BaseAPI) RenderFormattedError(errorCode int, errorMsg string) {
-	error := commonhttp.Error{
+	b.SendHTTPError(&commonhttp.Error{
 		Code:    errorCode,
 		Message: errorMsg,
-	}
-	formattedErrMsg := error.String()
+	})
+}
+
+// SendHTTPError sends the error to the client with all its fields, e.g. the hint
+func (b *BaseAPI) SendHTTPError(e *commonhttp.Error) {
+	formattedErrMsg := e.String()
 	log.Errorf("%s %s failed with error: %s", b.Ctx.Request.Method, b.Ctx.Request.URL.String(), formattedErrMsg)
-	b.RenderError(error.Code, formattedErrMsg)
+	b.RenderError(e.Code, formattedErrMsg)
 }
 
-// DecodeJSONReq decodes a json request
+// DecodeJSONReq decodes a json request, the size of the request body is limited by MaxRequestBodySize
 func (b *BaseAPI) DecodeJSONReq(v interface{}) error {
-	err := json.Unmarshal(b.Ctx.Input.CopyBody(1<<32), v)
+	return b.DecodeJSONReqWithLimit(v, MaxRequestBodySize)
+}
+
+// DecodeJSONReqWithLimit decodes a json request whose body is no larger than limit bytes,
+// ErrRequestBodyTooLarge is returned if the limit is exceeded
+func (b *BaseAPI) DecodeJSONReqWithLimit(v interface{}, limit int64) error {
+	// read one more byte than the limit to detect the oversized body
+	data := b.Ctx.Input.CopyBody(limit + 1)
+	if int64(len(data)) > limit {
+		log.Errorf("the size of the request body exceeds the limit %d bytes", limit)
+		return ErrRequestBodyTooLarge
+	}
+	err := json.Unmarshal(data, v)
 	if err != nil {
 		log.Errorf("Error while decoding the json request, error: %v, %v",
-			err, string(b.Ctx.Input.CopyBody(1 << 32)[:]))
+			err, string(data))
 		return errors.New("Invalid json request")
 	}
 	return nil
 }
 
+// SendDecodeJSONReqError sends the error returned by DecodeJSONReq to the client,
+// 413 for the oversized body and 400 for the others
+func (b *BaseAPI) SendDecodeJSONReqError(err error) {
+	if err == ErrRequestBodyTooLarge {
+		b.SendRequestEntityTooLargeError(err)
+		return
+	}
+	b.SendBadRequestError(err)
+}
+
 // Validate validates v if it implements interface validation.ValidFormer
 func (b *BaseAPI) Validate(v interface{}) (bool, error) {
 	validator := validation.Validation{}
@@ -240,6 +273,16 @@ func (b *BaseAPI) SendPreconditionFailedError(err error) {
 	b.RenderFormattedError(http.StatusPreconditionFailed, err.Error())
 }
 
+// SendRequestEntityTooLargeError sends request entity too large error to the client.
+func (b *BaseAPI) SendRequestEntityTooLargeError(err error) {
+	b.RenderFormattedError(http.StatusRequestEntityTooLarge, err.Error())
+}
+
+// SendUnprocessableEntityError sends unprocessable entity error to the client.
+func (b *BaseAPI) SendUnprocessableEntityError(err error) {
+	b.RenderFormattedError(http.StatusUnprocessableEntity, err.Error())
+}
+
 // SendStatusServiceUnavailableError sends service unavailable error to the client.
 func (b *BaseAPI) SendStatusServiceUnavailableError(err error) {
 	b.RenderFormattedError(http.StatusServiceUnavailable, err.Error())
@@ -12,3 +12,53 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBaseAPI(body string) (*BaseAPI, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/api/registries", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	ctx := context.NewContext()
+	ctx.Reset(rec, req)
+	b := &BaseAPI{}
+	b.Init(ctx, "", "", nil)
+	return b, rec
+}
+
+func TestDecodeJSONReq(t *testing.T) {
+	b, _ := newBaseAPI(`{"name":"test"}`)
+	v := struct {
+		Name string `json:"name"`
+	}{}
+	require.Nil(t, b.DecodeJSONReq(&v))
+	assert.Equal(t, "test", v.Name)
+
+	b, _ = newBaseAPI(`{"name":`)
+	assert.NotNil(t, b.DecodeJSONReq(&v))
+}
+
+func TestDecodeJSONReqWithLimit(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", 64) + `"}`
+	v := struct {
+		Name string `json:"name"`
+	}{}
+
+	b, _ := newBaseAPI(body)
+	assert.Nil(t, b.DecodeJSONReqWithLimit(&v, int64(len(body))))
+
+	b, rec := newBaseAPI(body)
+	err := b.DecodeJSONReqWithLimit(&v, int64(len(body)-1))
+	assert.Equal(t, ErrRequestBodyTooLarge, err)
+	b.SendDecodeJSONReqError(err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
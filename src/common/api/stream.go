@@ -0,0 +1,99 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// StreamErrorTrailer is the trailer carrying the error that occurs after the response is started
+const StreamErrorTrailer = "X-Harbor-Stream-Error"
+
+// JSONArrayStream writes the elements of a JSON array to the response as they're produced rather
+// than buffering the whole array. The status code and headers are sent with the first element, so
+// the error occurring before that can still be responded as usual
+type JSONArrayStream struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+// NewJSONArrayStream returns an instance of JSONArrayStream writing to the response writer
+func NewJSONArrayStream(w http.ResponseWriter) *JSONArrayStream {
+	return &JSONArrayStream{
+		w: w,
+	}
+}
+
+// Started returns whether the response is started
+func (s *JSONArrayStream) Started() bool {
+	return s.started
+}
+
+// Write writes one element of the array, call "Flush" to push the written elements to the client
+func (s *JSONArrayStream) Write(element interface{}) error {
+	data, err := json.Marshal(element)
+	if err != nil {
+		return err
+	}
+	delimiter := ","
+	if !s.started {
+		s.start()
+		delimiter = "["
+	}
+	if _, err = s.w.Write([]byte(delimiter)); err != nil {
+		return err
+	}
+	_, err = s.w.Write(data)
+	return err
+}
+
+// Flush pushes the written elements to the client
+func (s *JSONArrayStream) Flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close terminates the array, an empty array is written if no element is written
+func (s *JSONArrayStream) Close() error {
+	end := "]"
+	if !s.started {
+		s.start()
+		end = "[]"
+	}
+	if _, err := s.w.Write([]byte(end)); err != nil {
+		return err
+	}
+	s.Flush()
+	return nil
+}
+
+// Abort reports the error occurring in the middle of the stream in the trailer. The array is left
+// unterminated, so the clients can't take the partial array as the complete one
+func (s *JSONArrayStream) Abort(err error) {
+	s.w.Header().Set(StreamErrorTrailer, err.Error())
+	s.Flush()
+}
+
+func (s *JSONArrayStream) start() {
+	header := s.w.Header()
+	header.Set("Content-Type", "application/json")
+	// disable the response buffering of the nginx proxy
+	header.Set("X-Accel-Buffering", "no")
+	header.Set("Trailer", StreamErrorTrailer)
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+}
@@ -0,0 +1,78 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONArrayStream(t *testing.T) {
+	// the elements are written as one array
+	rec := httptest.NewRecorder()
+	stream := NewJSONArrayStream(rec)
+	assert.False(t, stream.Started())
+	for _, element := range []string{"a", "b", "c"} {
+		require.Nil(t, stream.Write(element))
+	}
+	stream.Flush()
+	assert.True(t, stream.Started())
+	require.Nil(t, stream.Close())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	elements := []string{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &elements))
+	assert.Equal(t, []string{"a", "b", "c"}, elements)
+
+	// no element
+	rec = httptest.NewRecorder()
+	stream = NewJSONArrayStream(rec)
+	require.Nil(t, stream.Close())
+	assert.Equal(t, "[]", rec.Body.String())
+
+	// the element can't be encoded
+	rec = httptest.NewRecorder()
+	stream = NewJSONArrayStream(rec)
+	assert.NotNil(t, stream.Write(make(chan int)))
+	assert.False(t, stream.Started())
+}
+
+func TestJSONArrayStreamAbort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := NewJSONArrayStream(w)
+		stream.Write("a")
+		stream.Flush()
+		stream.Abort(errors.New("failed to fetch the next page"))
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	// the partial array is left unterminated and the error is carried by the trailer
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `["a"`, string(body))
+	assert.NotNil(t, json.Unmarshal(body, &[]string{}))
+	assert.Equal(t, "failed to fetch the next page", resp.Trailer.Get(StreamErrorTrailer))
+}
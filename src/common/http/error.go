@@ -17,12 +17,104 @@ package http
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+)
+
+// the error codes defined in the docker registry API spec
+const (
+	ErrorCodeUnauthorized    = "UNAUTHORIZED"
+	ErrorCodeDenied          = "DENIED"
+	ErrorCodeUnsupported     = "UNSUPPORTED"
+	ErrorCodeManifestInvalid = "MANIFEST_INVALID"
+	ErrorCodeTooManyRequests = "TOOMANYREQUESTS"
+	ErrorCodeUnavailable     = "UNAVAILABLE"
+	ErrorCodeNameUnknown     = "NAME_UNKNOWN"
+	ErrorCodeManifestUnknown = "MANIFEST_UNKNOWN"
+	ErrorCodeBlobUnknown     = "BLOB_UNKNOWN"
+	// the blob referenced by the manifest doesn't exist
+	ErrorCodeManifestBlobUnknown = "MANIFEST_BLOB_UNKNOWN"
 )
 
 // Error wrap HTTP status code and message as an error
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// ErrorCode is the code of the first error in the error body returned by the registry
+	ErrorCode string `json:"error_code,omitempty"`
+	// Hint is the remediation hint for the error
+	Hint string `json:"hint,omitempty"`
+}
+
+// ParseRegistryError builds the Error with the status code and the body of the
+// response returned by the registry, the error code is parsed from the body if
+// it is in the format defined in the docker registry API spec
+func ParseRegistryError(code int, body []byte) *Error {
+	e := &Error{
+		Code:    code,
+		Message: string(body),
+	}
+	errs := struct {
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}{}
+	if err := json.Unmarshal(body, &errs); err == nil && len(errs.Errors) > 0 {
+		e.ErrorCode = errs.Errors[0].Code
+	}
+	return e
+}
+
+// IsAuthError returns whether the error is caused by the invalid credential or insufficient permission
+func (e *Error) IsAuthError() bool {
+	// Harbor returns 403 with the code "DENIED" in read-only mode
+	if e.IsReadOnly() {
+		return false
+	}
+	if e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden {
+		return true
+	}
+	return e.ErrorCode == ErrorCodeUnauthorized || e.ErrorCode == ErrorCodeDenied
+}
+
+// IsReadOnly returns whether the error is caused by the registry which is read-only temporarily,
+// e.g. during the maintenance. The docker distribution returns 405 in read-only mode and Harbor
+// returns 403 or 503 with the message about the read-only mode
+func (e *Error) IsReadOnly() bool {
+	if e.Code == http.StatusMethodNotAllowed {
+		return true
+	}
+	if e.Code != http.StatusForbidden && e.Code != http.StatusServiceUnavailable {
+		return false
+	}
+	msg := strings.ToLower(e.Message)
+	return strings.Contains(msg, "read only") || strings.Contains(msg, "read-only") ||
+		strings.Contains(msg, "readonly")
+}
+
+// IsNotFound returns whether the error is caused by the non-existing resource
+func (e *Error) IsNotFound() bool {
+	if e.Code == http.StatusNotFound {
+		return true
+	}
+	return e.ErrorCode == ErrorCodeNameUnknown ||
+		e.ErrorCode == ErrorCodeManifestUnknown ||
+		e.ErrorCode == ErrorCodeBlobUnknown
+}
+
+// IsRetryable returns whether the request may succeed when it is retried later, e.g.
+// the server is overloaded or temporarily unavailable
+func (e *Error) IsRetryable() bool {
+	switch e.Code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return e.ErrorCode == ErrorCodeTooManyRequests || e.ErrorCode == ErrorCodeUnavailable
 }
 
 // Error ...
@@ -1,8 +1,10 @@
 package http
 
 import (
-	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Test case for error wrapping function.
@@ -15,3 +17,67 @@ func TestWrapError(t *testing.T) {
 	assert.Equal(t, err.String(), "{\"code\":1,\"message\":\"test\"}")
 
 }
+
+func TestParseRegistryError(t *testing.T) {
+	// the body in the format defined in the registry API spec
+	body := []byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown","detail":{"Tag":"latest"}}]}`)
+	err := ParseRegistryError(http.StatusNotFound, body)
+	assert.Equal(t, http.StatusNotFound, err.Code)
+	assert.Equal(t, string(body), err.Message)
+	assert.Equal(t, ErrorCodeManifestUnknown, err.ErrorCode)
+
+	// other bodies
+	err = ParseRegistryError(http.StatusBadGateway, []byte("<html>bad gateway</html>"))
+	assert.Equal(t, http.StatusBadGateway, err.Code)
+	assert.Equal(t, "", err.ErrorCode)
+	err = ParseRegistryError(http.StatusBadRequest, nil)
+	assert.Equal(t, "", err.ErrorCode)
+}
+
+func TestErrorClassification(t *testing.T) {
+	cases := []struct {
+		err       *Error
+		auth      bool
+		notFound  bool
+		retryable bool
+	}{
+		{&Error{Code: http.StatusUnauthorized, ErrorCode: ErrorCodeUnauthorized}, true, false, false},
+		{&Error{Code: http.StatusForbidden}, true, false, false},
+		{&Error{Code: http.StatusBadRequest, ErrorCode: ErrorCodeDenied}, true, false, false},
+		{&Error{Code: http.StatusNotFound, ErrorCode: ErrorCodeNameUnknown}, false, true, false},
+		{&Error{Code: http.StatusBadRequest, ErrorCode: ErrorCodeBlobUnknown}, false, true, false},
+		{&Error{Code: http.StatusTooManyRequests, ErrorCode: ErrorCodeTooManyRequests}, false, false, true},
+		{&Error{Code: http.StatusInternalServerError}, false, false, true},
+		{&Error{Code: http.StatusBadGateway}, false, false, true},
+		{&Error{Code: http.StatusServiceUnavailable, ErrorCode: ErrorCodeUnavailable}, false, false, true},
+		{&Error{Code: http.StatusGatewayTimeout}, false, false, true},
+		{&Error{Code: http.StatusBadRequest}, false, false, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.auth, c.err.IsAuthError(), c.err.Error())
+		assert.Equal(t, c.notFound, c.err.IsNotFound(), c.err.Error())
+		assert.Equal(t, c.retryable, c.err.IsRetryable(), c.err.Error())
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	harborReadOnly := ParseRegistryError(http.StatusForbidden,
+		[]byte(`{"errors":[{"code":"DENIED","message":"The system is in read only mode. Any modification is prohibited."}]}`))
+	assert.True(t, harborReadOnly.IsReadOnly())
+	// the read-only error isn't an auth error
+	assert.False(t, harborReadOnly.IsAuthError())
+
+	distributionReadOnly := ParseRegistryError(http.StatusMethodNotAllowed,
+		[]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+	assert.True(t, distributionReadOnly.IsReadOnly())
+
+	unavailable := &Error{Code: http.StatusServiceUnavailable, Message: "The system is in read only mode. Any modification is prohibited."}
+	assert.True(t, unavailable.IsReadOnly())
+
+	denied := ParseRegistryError(http.StatusForbidden,
+		[]byte(`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`))
+	assert.False(t, denied.IsReadOnly())
+	assert.True(t, denied.IsAuthError())
+
+	assert.False(t, (&Error{Code: http.StatusUnauthorized, Message: "read only"}).IsReadOnly())
+}
@@ -11,15 +11,24 @@ import (
 	commonhttp "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/http/modifier/auth"
 	"github.com/goharbor/harbor/src/common/job/models"
+	"github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/job"
+	"github.com/goharbor/harbor/src/replication/model"
 )
 
 // Client wraps interface to access jobservice.
 type Client interface {
 	SubmitJob(*models.JobData) (string, error)
 	GetJobLog(uuid string) ([]byte, error)
+	GetJob(uuid string) (*job.Stats, error)
 	PostAction(uuid, action string) error
 	GetExecutions(uuid string) ([]job.Stats, error)
+	GetConfig() (*config.Settings, error)
+	ReloadConfig() (*config.Settings, error)
+	SetMaintenance(enabled bool) (*job.Maintenance, error)
+	GetMaintenance() (*job.Maintenance, error)
+	WarmUp(registry *model.Registry) (*model.WarmupStatus, error)
+	GetWarmups() ([]*model.WarmupStatus, error)
 	// TODO Redirect joblog when we see there's memory issue.
 }
 
@@ -106,6 +115,35 @@ func (d *DefaultClient) GetJobLog(uuid string) ([]byte, error) {
 	return data, nil
 }
 
+// GetJob call jobservice API to get the stats of a job, including the parameters it's launched with
+func (d *DefaultClient) GetJob(uuid string) (*job.Stats, error) {
+	url := d.endpoint + "/api/v1/jobs/" + uuid
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &commonhttp.Error{
+			Code:    resp.StatusCode,
+			Message: string(data),
+		}
+	}
+	stats := &job.Stats{}
+	if err = json.Unmarshal(data, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 // GetExecutions ...
 func (d *DefaultClient) GetExecutions(periodicJobID string) ([]job.Stats, error) {
 	url := fmt.Sprintf("%s/api/v1/jobs/%s/executions?page_number=1&page_size=100", d.endpoint, periodicJobID)
@@ -136,6 +174,142 @@ func (d *DefaultClient) GetExecutions(periodicJobID string) ([]job.Stats, error)
 	return exes, nil
 }
 
+// GetConfig returns the non-secret configurations in effect of jobservice
+func (d *DefaultClient) GetConfig() (*config.Settings, error) {
+	return d.config(http.MethodGet, d.endpoint+"/api/v1/config")
+}
+
+// ReloadConfig reloads the hot-reloadable configurations of jobservice and returns
+// the non-secret configurations in effect after reloading
+func (d *DefaultClient) ReloadConfig() (*config.Settings, error) {
+	return d.config(http.MethodPost, d.endpoint+"/api/v1/config/reload")
+}
+
+func (d *DefaultClient) config(method, url string) (*config.Settings, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &commonhttp.Error{
+			Code:    resp.StatusCode,
+			Message: string(data),
+		}
+	}
+	settings := &config.Settings{}
+	if err = json.Unmarshal(data, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode of jobservice, the new jobs
+// are rejected when the maintenance mode is enabled
+func (d *DefaultClient) SetMaintenance(enabled bool) (*job.Maintenance, error) {
+	b, err := json.Marshal(&job.Maintenance{Enabled: enabled})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.endpoint+"/api/v1/jobs/maintenance", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return d.maintenance(req)
+}
+
+// GetMaintenance returns whether the maintenance mode of jobservice is enabled
+func (d *DefaultClient) GetMaintenance() (*job.Maintenance, error) {
+	req, err := http.NewRequest(http.MethodGet, d.endpoint+"/api/v1/jobs/maintenance", nil)
+	if err != nil {
+		return nil, err
+	}
+	return d.maintenance(req)
+}
+
+func (d *DefaultClient) maintenance(req *http.Request) (*job.Maintenance, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &commonhttp.Error{
+			Code:    resp.StatusCode,
+			Message: string(data),
+		}
+	}
+	maintenance := &job.Maintenance{}
+	if err = json.Unmarshal(data, maintenance); err != nil {
+		return nil, err
+	}
+	return maintenance, nil
+}
+
+// WarmUp warms up the connections to the registry in jobservice, the count of the connections
+// is set by the "WarmupConnections" of the registry
+func (d *DefaultClient) WarmUp(registry *model.Registry) (*model.WarmupStatus, error) {
+	b, err := json.Marshal(registry)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.endpoint+"/api/v1/warmups", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	status := &model.WarmupStatus{}
+	if err = d.do(req, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetWarmups returns the statuses of the latest warmups of the connections to the registries in jobservice
+func (d *DefaultClient) GetWarmups() ([]*model.WarmupStatus, error) {
+	req, err := http.NewRequest(http.MethodGet, d.endpoint+"/api/v1/warmups", nil)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []*model.WarmupStatus{}
+	if err = d.do(req, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func (d *DefaultClient) do(req *http.Request, v interface{}) error {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &commonhttp.Error{
+			Code:    resp.StatusCode,
+			Message: string(data),
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
 // PostAction call jobservice's API to operate action for job specified by uuid
 func (d *DefaultClient) PostAction(uuid, action string) error {
 	url := d.endpoint + "/api/v1/jobs/" + uuid
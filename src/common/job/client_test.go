@@ -3,6 +3,7 @@ package job
 import (
 	"github.com/goharbor/harbor/src/common/job/models"
 	"github.com/goharbor/harbor/src/common/job/test"
+	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
@@ -47,6 +48,14 @@ func TestGetJobLog(t *testing.T) {
 	assert.Contains(text, "The content in this file is for mocking the get log api.")
 }
 
+func TestGetJob(t *testing.T) {
+	assert := assert.New(t)
+	stats, err := testClient.GetJob(ID)
+	assert.Nil(err)
+	assert.Equal(ID, stats.Info.JobID)
+	assert.Equal("{}", stats.Info.Parameters["src_resource"])
+}
+
 func TestGetExecutions(t *testing.T) {
 	assert := assert.New(t)
 	exes, err := testClient.GetExecutions(ID)
@@ -55,6 +64,52 @@ func TestGetExecutions(t *testing.T) {
 	assert.Equal(ID+"@123123", stat.Info.JobID)
 }
 
+func TestGetConfig(t *testing.T) {
+	assert := assert.New(t)
+	settings, err := testClient.GetConfig()
+	assert.Nil(err)
+	assert.Equal("http", settings.Protocol)
+	assert.Equal(uint(10), settings.WorkerPool.Workers)
+}
+
+func TestReloadConfig(t *testing.T) {
+	assert := assert.New(t)
+	settings, err := testClient.ReloadConfig()
+	assert.Nil(err)
+	assert.Equal(5, settings.RegistryMaxConnections)
+}
+
+func TestSetMaintenance(t *testing.T) {
+	assert := assert.New(t)
+	maintenance, err := testClient.SetMaintenance(true)
+	assert.Nil(err)
+	assert.True(maintenance.Enabled)
+	maintenance, err = testClient.GetMaintenance()
+	assert.Nil(err)
+	assert.True(maintenance.Enabled)
+	maintenance, err = testClient.SetMaintenance(false)
+	assert.Nil(err)
+	assert.False(maintenance.Enabled)
+	maintenance, err = testClient.GetMaintenance()
+	assert.Nil(err)
+	assert.False(maintenance.Enabled)
+}
+
+func TestWarmUp(t *testing.T) {
+	assert := assert.New(t)
+	status, err := testClient.WarmUp(&model.Registry{
+		ID:                1,
+		URL:               "https://registry.harbor.com",
+		WarmupConnections: 2,
+	})
+	assert.Nil(err)
+	assert.Equal(int64(1), status.RegistryID)
+	assert.Equal(2, status.Established)
+	statuses, err := testClient.GetWarmups()
+	assert.Nil(err)
+	assert.Equal([]*model.WarmupStatus{status}, statuses)
+}
+
 func TestPostAction(t *testing.T) {
 	assert := assert.New(t)
 	err := testClient.PostAction(ID, "fff")
@@ -12,8 +12,10 @@ import (
 	"time"
 
 	"github.com/goharbor/harbor/src/common/job/models"
+	"github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	job_models "github.com/goharbor/harbor/src/jobservice/job"
+	"github.com/goharbor/harbor/src/replication/model"
 )
 
 const (
@@ -70,8 +72,109 @@ func NewJobServiceServer() *httptest.Server {
 			rw.WriteHeader(http.StatusOK)
 			return
 		})
+	maintenance := &job.Maintenance{}
+	mux.HandleFunc("/api/v1/jobs/maintenance",
+		func(rw http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodGet:
+			case http.MethodPost:
+				m := &job.Maintenance{}
+				if err := json.NewDecoder(req.Body).Decode(m); err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				maintenance.Enabled = m.Enabled
+			default:
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			b, _ := json.Marshal(maintenance)
+			if _, err := rw.Write(b); err != nil {
+				panic(err)
+			}
+		})
+	warmups := []*model.WarmupStatus{}
+	mux.HandleFunc("/api/v1/warmups",
+		func(rw http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodGet:
+				b, _ := json.Marshal(warmups)
+				if _, err := rw.Write(b); err != nil {
+					panic(err)
+				}
+			case http.MethodPost:
+				r := &model.Registry{}
+				if err := json.NewDecoder(req.Body).Decode(r); err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				status := &model.WarmupStatus{
+					RegistryID:  r.ID,
+					Endpoint:    r.URL,
+					Requested:   r.WarmupConnections,
+					Established: r.WarmupConnections,
+				}
+				warmups = append(warmups, status)
+				b, _ := json.Marshal(status)
+				if _, err := rw.Write(b); err != nil {
+					panic(err)
+				}
+			default:
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+	mux.HandleFunc("/api/v1/config/reload",
+		func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost {
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			b, _ := json.Marshal(&config.Settings{
+				Protocol:               "http",
+				Port:                   8080,
+				RegistryMaxConnections: 5,
+			})
+			if _, err := rw.Write(b); err != nil {
+				panic(err)
+			}
+		})
+	mux.HandleFunc("/api/v1/config",
+		func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet {
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			b, _ := json.Marshal(&config.Settings{
+				Protocol: "http",
+				Port:     8080,
+				WorkerPool: &config.WorkerPoolSettings{
+					Backend: "redis",
+					Workers: 10,
+				},
+			})
+			if _, err := rw.Write(b); err != nil {
+				panic(err)
+			}
+		})
 	mux.HandleFunc(fmt.Sprintf("%s/%s", jobsPrefix, jobUUID),
 		func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				b, _ := json.Marshal(&job.Stats{
+					Info: &job.StatsInfo{
+						JobID:   jobUUID,
+						Status:  "Error",
+						JobName: "REPLICATION",
+						Parameters: job.Parameters{
+							"src_resource": "{}",
+							"dst_resource": "{}",
+						},
+					},
+				})
+				if _, err := rw.Write(b); err != nil {
+					panic(err)
+				}
+				return
+			}
 			if req.Method != http.MethodPost {
 				rw.WriteHeader(http.StatusMethodNotAllowed)
 				return
@@ -36,10 +36,53 @@ func Encrypt(content string, salt string) string {
 const (
 	// EncryptHeaderV1 ...
 	EncryptHeaderV1 = "<enc-v1>"
+	// the header of the str encrypted with the versioned key, e.g. "<enc-v1:2>"
+	encryptHeaderV1WithKeyVersion = "<enc-v1:"
 )
 
 // ReversibleEncrypt encrypts the str with aes/base64
 func ReversibleEncrypt(str, key string) (string, error) {
+	encrypted, err := encryptAES(str, key)
+	if err != nil {
+		return "", err
+	}
+	return EncryptHeaderV1 + encrypted, nil
+}
+
+// ReversibleEncryptWithKeyVersion encrypts the str with aes/base64 as ReversibleEncrypt does, and
+// records the version of the key in the header, so the key can be selected by the version when decrypting
+func ReversibleEncryptWithKeyVersion(str, key, version string) (string, error) {
+	if len(version) == 0 || strings.Contains(version, ">") {
+		return "", fmt.Errorf("invalid key version: %q", version)
+	}
+	encrypted, err := encryptAES(str, key)
+	if err != nil {
+		return "", err
+	}
+	return encryptHeaderV1WithKeyVersion + version + ">" + encrypted, nil
+}
+
+// KeyVersion returns the version of the key which the str is encrypted with, empty string is
+// returned if the str isn't encrypted with a versioned key
+func KeyVersion(str string) string {
+	version, _ := splitKeyVersion(str)
+	return version
+}
+
+// split the str encrypted with the versioned key into the version and the encrypted content
+func splitKeyVersion(str string) (string, string) {
+	if !strings.HasPrefix(str, encryptHeaderV1WithKeyVersion) {
+		return "", str
+	}
+	s := str[len(encryptHeaderV1WithKeyVersion):]
+	i := strings.Index(s, ">")
+	if i <= 0 {
+		return "", str
+	}
+	return s[:i], s[i+1:]
+}
+
+func encryptAES(str, key string) (string, error) {
 	keyBytes := []byte(key)
 	var block cipher.Block
 	var err error
@@ -55,16 +98,19 @@ func ReversibleEncrypt(str, key string) (string, error) {
 
 	cfb := cipher.NewCFBEncrypter(block, iv)
 	cfb.XORKeyStream(cipherText[aes.BlockSize:], []byte(str))
-	encrypted := EncryptHeaderV1 + base64.StdEncoding.EncodeToString(cipherText)
-	return encrypted, nil
+	return base64.StdEncoding.EncodeToString(cipherText), nil
 }
 
-// ReversibleDecrypt decrypts the str with aes/base64 or base 64 depending on "header"
+// ReversibleDecrypt decrypts the str with aes/base64 or base 64 depending on "header". The key
+// must be the one of the version returned by KeyVersion if the str is encrypted with a versioned key
 func ReversibleDecrypt(str, key string) (string, error) {
 	if strings.HasPrefix(str, EncryptHeaderV1) {
 		str = str[len(EncryptHeaderV1):]
 		return decryptAES(str, key)
 	}
+	if version, encrypted := splitKeyVersion(str); len(version) > 0 {
+		return decryptAES(encrypted, key)
+	}
 	// fallback to base64
 	return decodeB64(str)
 }
@@ -26,11 +26,12 @@ var (
 	catalog         = regexp.MustCompile("/v2/_catalog")
 	tag             = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/tags/list")
 	manifest        = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/manifests/(" + reference.TagRegexp.String() + "|" + reference.DigestRegexp.String() + ")")
+	referrers       = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/referrers/" + reference.DigestRegexp.String())
 	blob            = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/blobs/" + reference.DigestRegexp.String())
 	blobUpload      = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/blobs/uploads")
 	blobUploadChunk = regexp.MustCompile("/v2/(" + reference.NameRegexp.String() + ")/blobs/uploads/[a-zA-Z0-9-_.=]+")
 
-	repoRegExps = []*regexp.Regexp{tag, manifest, blob, blobUploadChunk, blobUpload}
+	repoRegExps = []*regexp.Regexp{tag, manifest, referrers, blob, blobUploadChunk, blobUpload}
 )
 
 // parse the repository name from path, if the path doesn't match any
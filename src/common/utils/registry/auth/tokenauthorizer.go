@@ -49,6 +49,19 @@ func (u *UserAgentModifier) Modify(req *http.Request) error {
 	return nil
 }
 
+// HeaderModifier adds the custom headers to the request
+type HeaderModifier struct {
+	Headers map[string]string
+}
+
+// Modify adds the custom headers to the request
+func (h *HeaderModifier) Modify(req *http.Request) error {
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+	return nil
+}
+
 // tokenAuthorizer implements registry.Modifier interface. It parses scopses
 // from the request, generates authentication token and modifies the requset
 // by adding the token
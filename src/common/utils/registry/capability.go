@@ -0,0 +1,175 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	commonhttp "github.com/goharbor/harbor/src/common/http"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// the digest of the empty content, it's used to probe the APIs which require a digest
+const emptyDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// the OCI image manifest used to probe whether the registry accepts the OCI image manifests, the
+// blobs it refers to don't exist in the probe repository, so it's never stored by the registry
+const ociProbeManifest = `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageManifest + `",` +
+	`"config":{"mediaType":"` + v1.MediaTypeImageConfig + `","size":0,"digest":"` + emptyDigest + `"},` +
+	`"layers":[{"mediaType":"` + v1.MediaTypeImageLayerGzip + `","size":0,"digest":"` + emptyDigest + `"}]}`
+
+// The probes below check whether the registry supports an API, the returned error means the
+// support cannot be determined, e.g. the credential has no permission to access the API
+
+// SupportCatalog returns whether the registry supports the catalog API
+func (r *Registry) SupportCatalog() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, r.Endpoint.String()+"/v2/_catalog?n=1", nil)
+	if err != nil {
+		return false, err
+	}
+	return probe(r.client, req, http.StatusOK)
+}
+
+// SupportReferrers returns whether the registry supports the referrers API. The referrers
+// of the empty digest are listed, the registries supporting the API return an empty list
+// or the error about the unknown repository/manifest
+func (r *Repository) SupportReferrers() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, buildReferrersURL(r.Endpoint.String(), r.Name, emptyDigest), nil)
+	if err != nil {
+		return false, err
+	}
+	return probe(r.client, req, http.StatusOK)
+}
+
+// SupportDeletion returns whether the registry supports deleting the manifests. The manifest
+// of the empty digest which doesn't exist is deleted, the registries disabling the deletion
+// return 405
+func (r *Repository) SupportDeletion() (bool, error) {
+	req, err := http.NewRequest(http.MethodDelete, buildManifestURL(r.Endpoint.String(), r.Name, emptyDigest), nil)
+	if err != nil {
+		return false, err
+	}
+	return probe(r.client, req, http.StatusAccepted)
+}
+
+// SupportChunkedUpload returns whether the registry supports uploading the blobs in chunks.
+// An upload session is initiated and an empty chunk is uploaded, the session is canceled
+// after the probe
+func (r *Repository) SupportChunkedUpload() (bool, error) {
+	location, _, err := r.initiateBlobUpload(r.Name)
+	if err != nil {
+		if e, ok := err.(*commonhttp.Error); ok && isUnsupported(e) {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(location) == 0 {
+		return false, nil
+	}
+	relative, err := isRelativeURL(location)
+	if err != nil {
+		return false, err
+	}
+	if relative {
+		location = r.Endpoint.String() + location
+	}
+	defer func() {
+		// cancel the upload session
+		req, err := http.NewRequest(http.MethodDelete, location, nil)
+		if err != nil {
+			return
+		}
+		if resp, err := r.client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodPatch, location, strings.NewReader(""))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/octet-stream")
+	return probe(r.client, req, http.StatusAccepted)
+}
+
+// SupportOCIManifest returns whether the registry accepts the OCI image manifests. The OCI manifest
+// referring to the blobs which don't exist is pushed, the registries supporting OCI reject it because
+// of the unknown blobs and the others reject it because of the media type
+func (r *Repository) SupportOCIManifest() (bool, error) {
+	req, err := http.NewRequest(http.MethodPut, buildManifestURL(r.Endpoint.String(), r.Name, "oci-probe"),
+		strings.NewReader(ociProbeManifest))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), v1.MediaTypeImageManifest)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, parseError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return true, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	e := commonhttp.ParseRegistryError(resp.StatusCode, b)
+	switch {
+	case e.Code == http.StatusUnsupportedMediaType, e.ErrorCode == commonhttp.ErrorCodeManifestInvalid, isUnsupported(e):
+		return false, nil
+	case e.ErrorCode == commonhttp.ErrorCodeManifestBlobUnknown, e.ErrorCode == commonhttp.ErrorCodeBlobUnknown:
+		return true, nil
+	}
+	return false, e
+}
+
+// probe sends the request and checks the response: the API is supported if the response
+// has the expected status code or the error about the unknown resources, and it's unsupported
+// if the response has the status code 404 without the error code, 405 or the error code "UNSUPPORTED"
+func probe(client *http.Client, req *http.Request, expected int) (bool, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, parseError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == expected {
+		return true, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	e := commonhttp.ParseRegistryError(resp.StatusCode, b)
+	if isUnsupported(e) {
+		return false, nil
+	}
+	if e.IsNotFound() {
+		return true, nil
+	}
+	return false, e
+}
+
+func isUnsupported(e *commonhttp.Error) bool {
+	if e.Code == http.StatusMethodNotAllowed || e.ErrorCode == commonhttp.ErrorCodeUnsupported {
+		return true
+	}
+	// the route isn't registered by the registry
+	return e.Code == http.StatusNotFound && len(e.ErrorCode) == 0
+}
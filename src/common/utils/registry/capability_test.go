@@ -0,0 +1,161 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportCatalog(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		supported bool
+		isErr     bool
+	}{
+		{http.StatusOK, `{"repositories":[]}`, true, false},
+		{http.StatusNotFound, "404 page not found", false, false},
+		{http.StatusMethodNotAllowed, "", false, false},
+		{http.StatusUnauthorized, `{"errors":[{"code":"UNSUPPORTED"}]}`, false, false},
+		{http.StatusUnauthorized, `{"errors":[{"code":"UNAUTHORIZED"}]}`, false, true},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v2/_catalog", r.URL.Path)
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		client, err := newRegistryClient(server.URL)
+		require.Nil(t, err)
+		supported, err := client.SupportCatalog()
+		assert.Equal(t, c.supported, supported)
+		assert.Equal(t, c.isErr, err != nil)
+		server.Close()
+	}
+}
+
+func TestSupportReferrers(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		supported bool
+	}{
+		{http.StatusOK, `{"schemaVersion":2,"manifests":[]}`, true},
+		{http.StatusNotFound, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, true},
+		{http.StatusNotFound, "404 page not found", false},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, fmt.Sprintf("/v2/%s/referrers/%s", repository, emptyDigest), r.URL.Path)
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		client, err := newRepository(server.URL)
+		require.Nil(t, err)
+		supported, err := client.SupportReferrers()
+		require.Nil(t, err)
+		assert.Equal(t, c.supported, supported)
+		server.Close()
+	}
+}
+
+func TestSupportDeletion(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		supported bool
+	}{
+		{http.StatusAccepted, "", true},
+		{http.StatusNotFound, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, true},
+		{http.StatusMethodNotAllowed, `{"errors":[{"code":"UNSUPPORTED"}]}`, false},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodDelete, r.Method)
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		client, err := newRepository(server.URL)
+		require.Nil(t, err)
+		supported, err := client.SupportDeletion()
+		require.Nil(t, err)
+		assert.Equal(t, c.supported, supported)
+		server.Close()
+	}
+}
+
+func TestSupportChunkedUpload(t *testing.T) {
+	for _, patchStatus := range []int{http.StatusAccepted, http.StatusMethodNotAllowed} {
+		canceled := false
+		location := fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				w.Header().Set("Location", location)
+				w.WriteHeader(http.StatusAccepted)
+			case http.MethodPatch:
+				assert.Equal(t, location, r.URL.Path)
+				w.WriteHeader(patchStatus)
+			case http.MethodDelete:
+				assert.Equal(t, location, r.URL.Path)
+				canceled = true
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		client, err := newRepository(server.URL)
+		require.Nil(t, err)
+		supported, err := client.SupportChunkedUpload()
+		require.Nil(t, err)
+		assert.Equal(t, patchStatus == http.StatusAccepted, supported)
+		// the upload session is canceled after the probe
+		assert.True(t, canceled)
+		server.Close()
+	}
+}
+
+func TestSupportOCIManifest(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		supported bool
+		isErr     bool
+	}{
+		{http.StatusBadRequest, `{"errors":[{"code":"MANIFEST_BLOB_UNKNOWN"}]}`, true, false},
+		{http.StatusBadRequest, `{"errors":[{"code":"MANIFEST_INVALID"}]}`, false, false},
+		{http.StatusUnsupportedMediaType, "", false, false},
+		{http.StatusUnauthorized, `{"errors":[{"code":"UNAUTHORIZED"}]}`, false, true},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPut, r.Method)
+			assert.Equal(t, v1.MediaTypeImageManifest, r.Header.Get("Content-Type"))
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		client, err := newRepository(server.URL)
+		require.Nil(t, err)
+		supported, err := client.SupportOCIManifest()
+		assert.Equal(t, c.supported, supported)
+		assert.Equal(t, c.isErr, err != nil)
+		server.Close()
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	commonhttp "github.com/goharbor/harbor/src/common/http"
+	"github.com/goharbor/harbor/src/common/utils/log"
+)
+
+const (
+	// the size of the catalog page
+	catalogPageSize = 1000
+	// the times of fetching the failed page of the catalog again
+	catalogRetries = 3
+)
+
+// the interval before fetching the failed page of the catalog again, it's a variable for testing
+var catalogRetryInterval = 2 * time.Second
+
+// CatalogHandler handles the repositories of each page of the catalog as they're fetched
+type CatalogHandler func(repositories []string) error
+
+// CatalogWithCheckpoint enumerates the catalog page by page and passes the repositories of each
+// page to the handler once the page is fetched, so the partial results can be consumed before the
+// enumeration completes. The last repository handled is checkpointed as the "last" cursor, the failed
+// page is fetched again from the checkpoint for several times rather than restarting the whole
+// enumeration. The error returned by the handler aborts the enumeration without retrying
+func (r *Registry) CatalogWithCheckpoint(handler CatalogHandler) error {
+	return r.CatalogWithContext(context.Background(), handler)
+}
+
+// CatalogWithContext is the same with "CatalogWithCheckpoint", the enumeration is aborted when the
+// context is canceled. The next page isn't fetched until the handler returns, so only one page is
+// held in memory and the slow handler holds back the enumeration
+func (r *Registry) CatalogWithContext(ctx context.Context, handler CatalogHandler) error {
+	checkpoint := ""
+	failures := 0
+	for {
+		last, err := r.catalogFrom(ctx, checkpoint, handler)
+		if err == nil {
+			return nil
+		}
+		if e, ok := err.(*handlerError); ok {
+			return e.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// only the consecutive failures of the same page are counted
+		if last != checkpoint {
+			checkpoint = last
+			failures = 0
+		}
+		failures++
+		if failures > catalogRetries {
+			return err
+		}
+		log.Warningf("failed to enumerate the catalog of registry %s after %q: %v, resume it from the checkpoint",
+			r.Endpoint.String(), checkpoint, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(catalogRetryInterval):
+		}
+	}
+}
+
+// the error returned by the catalog handler
+type handlerError struct {
+	err error
+}
+
+func (h *handlerError) Error() string {
+	return h.err.Error()
+}
+
+// enumerate the catalog after the repository "last", the last repository handled is returned
+func (r *Registry) catalogFrom(ctx context.Context, last string, handler CatalogHandler) (string, error) {
+	values := url.Values{}
+	values.Set("n", strconv.Itoa(catalogPageSize))
+	if len(last) > 0 {
+		values.Set("last", last)
+	}
+	suffix := "/v2/_catalog?" + values.Encode()
+	for len(suffix) > 0 {
+		repositories, next, err := r.catalogPage(ctx, r.Endpoint.String()+suffix)
+		if err != nil {
+			return last, err
+		}
+		if len(repositories) > 0 {
+			if err = handler(repositories); err != nil {
+				return last, &handlerError{err: err}
+			}
+			last = repositories[len(repositories)-1]
+		}
+		suffix = next
+	}
+	return last, nil
+}
+
+// fetch one page of the catalog, the suffix of the URL of the next page is returned if exists
+func (r *Registry) catalogPage(ctx context.Context, endpoint string) ([]string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req = req.WithContext(ctx)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", parseError(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", commonhttp.ParseRegistryError(resp.StatusCode, b)
+	}
+
+	catalogResp := struct {
+		Repositories []string `json:"repositories"`
+	}{}
+	if err := json.Unmarshal(b, &catalogResp); err != nil {
+		return nil, "", err
+	}
+	// Link: </v2/_catalog?last=library%2Fhello-world-25&n=100>; rel="next"
+	next := ""
+	link := resp.Header.Get("Link")
+	if strings.HasSuffix(link, `rel="next"`) && strings.Index(link, "<") >= 0 && strings.Index(link, ">") >= 0 {
+		next = link[strings.Index(link, "<")+1 : strings.Index(link, ">")]
+	}
+	return catalogResp.Repositories, next, nil
+}
@@ -0,0 +1,64 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ClockSkewWithContext measures the clock skew between the registry and the local host by the header
+// "Date" of the response of the "/v2/" API. The skew is positive if the clock of the registry is ahead
+func (r *Registry) ClockSkewWithContext(ctx context.Context) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, buildPingURL(r.Endpoint.String()), nil)
+	if err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, parseError(err)
+	}
+	received := time.Now()
+	resp.Body.Close()
+	return ClockSkew(resp.Header, sent, received)
+}
+
+// ClockSkew calculates the clock skew by the header "Date" of the response which is sent and received
+// at the specified local time. The date has the resolution of one second and the registry generates it
+// at some point during the round trip, so the skew within the uncertainty is reported as zero
+func ClockSkew(header http.Header, sent, received time.Time) (time.Duration, error) {
+	value := header.Get("Date")
+	if len(value) == 0 {
+		return 0, errors.New("no header Date in the response")
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, err
+	}
+	rtt := received.Sub(sent)
+	// the date is truncated to the second, use the middle of the second and the round trip
+	skew := date.Add(500 * time.Millisecond).Sub(sent.Add(rtt / 2))
+	uncertainty := rtt/2 + 500*time.Millisecond
+	switch {
+	case skew > uncertainty:
+		return skew - uncertainty, nil
+	case skew < -uncertainty:
+		return skew + uncertainty, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,67 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Date(2019, 7, 1, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		date    string
+		skew    time.Duration
+		invalid bool
+	}{
+		{date: "", invalid: true},
+		{date: "invalid", invalid: true},
+		{date: now.Format(http.TimeFormat), skew: 0},
+		{date: now.Add(10 * time.Minute).Format(http.TimeFormat), skew: 10*time.Minute - time.Second},
+		{date: now.Add(-10 * time.Minute).Format(http.TimeFormat), skew: -10*time.Minute + time.Second},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if len(c.date) > 0 {
+			header.Set("Date", c.date)
+		}
+		skew, err := ClockSkew(header, now, now.Add(time.Second))
+		if c.invalid {
+			assert.NotNil(t, err)
+			continue
+		}
+		require.Nil(t, err)
+		assert.Equal(t, c.skew, skew)
+	}
+}
+
+func TestClockSkewWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client, err := newRegistryClient(server.URL)
+	require.Nil(t, err)
+	skew, err := client.ClockSkewWithContext(context.Background())
+	require.Nil(t, err)
+	assert.True(t, skew < -59*time.Minute && skew > -61*time.Minute)
+}
@@ -15,10 +15,242 @@
 package registry
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/goharbor/harbor/src/common/utils/log"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+func init() {
+	// the OCI image manifest isn't supported by the vendored distribution, register it here
+	unmarshalFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+		m := &OCIManifest{}
+		if err := m.UnmarshalJSON(b); err != nil {
+			return nil, distribution.Descriptor{}, err
+		}
+		return m, distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    godigest.FromBytes(b),
+			Size:      int64(len(b)),
+		}, nil
+	}
+	if err := distribution.RegisterManifestSchema(v1.MediaTypeImageManifest, unmarshalFunc); err != nil {
+		log.Errorf("failed to register the OCI image manifest schema: %v", err)
+	}
+}
+
+// DefaultMaxManifestSize is the default max size in bytes of the manifests pulled, it's the
+// same with the limit of the manifests pushed to the distribution registry
+const DefaultMaxManifestSize int64 = 4 << 20
+
+var maxManifestSize = DefaultMaxManifestSize
+
+// SetMaxManifestSize sets the max size in bytes of the manifests pulled, the default value is used
+// if it's less than or equal to 0. It guards the memory as the manifests are read entirely to be parsed
+func SetMaxManifestSize(size int64) {
+	if size <= 0 {
+		size = DefaultMaxManifestSize
+	}
+	atomic.StoreInt64(&maxManifestSize, size)
+}
+
+// MaxManifestSize returns the max size in bytes of the manifests pulled
+func MaxManifestSize() int64 {
+	return atomic.LoadInt64(&maxManifestSize)
+}
+
+// ManifestTooLargeError is returned when the size of the manifest pulled exceeds the limit
+type ManifestTooLargeError struct {
+	Repository string
+	Reference  string
+	Limit      int64
+}
+
+func (m *ManifestTooLargeError) Error() string {
+	return fmt.Sprintf("the size of the manifest %s:%s exceeds the limit %d bytes", m.Repository, m.Reference, m.Limit)
+}
+
+// read the manifest from the response, it's aborted once the size exceeds the limit, so the
+// oversized manifest is never buffered entirely. The Content-Length is checked first if it's present
+func readManifest(resp *http.Response, repository, reference string) ([]byte, error) {
+	limit := MaxManifestSize()
+	if resp.ContentLength > limit {
+		return nil, &ManifestTooLargeError{Repository: repository, Reference: reference, Limit: limit}
+	}
+	// read one more byte than the limit to detect the oversized manifest
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, &ManifestTooLargeError{Repository: repository, Reference: reference, Limit: limit}
+	}
+	return b, nil
+}
+
 // UnMarshal converts []byte to be distribution.Manifest
 func UnMarshal(mediaType string, data []byte) (distribution.Manifest, distribution.Descriptor, error) {
 	return distribution.UnmarshalManifest(mediaType, data)
 }
+
+// OCIManifest is the OCI image manifest which implements the distribution.Manifest interface
+type OCIManifest struct {
+	v1.Manifest
+	// the raw content of the manifest
+	canonical []byte
+}
+
+// UnmarshalJSON populates the manifest with the JSON data and keeps the raw content
+func (m *OCIManifest) UnmarshalJSON(b []byte) error {
+	mfst := struct {
+		v1.Manifest
+		MediaType string `json:"mediaType"`
+	}{}
+	if err := json.Unmarshal(b, &mfst); err != nil {
+		return err
+	}
+	// the media type is optional in the OCI image manifest
+	if len(mfst.MediaType) > 0 && mfst.MediaType != v1.MediaTypeImageManifest {
+		return fmt.Errorf("mediaType in manifest should be '%s' not '%s'",
+			v1.MediaTypeImageManifest, mfst.MediaType)
+	}
+	m.Manifest = mfst.Manifest
+	m.canonical = make([]byte, len(b))
+	copy(m.canonical, b)
+	return nil
+}
+
+// References returns the descriptors of the config and the layers
+func (m *OCIManifest) References() []distribution.Descriptor {
+	references := []distribution.Descriptor{toDescriptor(m.Config)}
+	for _, layer := range m.Layers {
+		references = append(references, toDescriptor(layer))
+	}
+	return references
+}
+
+// Payload returns the media type and the raw content of the manifest
+func (m *OCIManifest) Payload() (string, []byte, error) {
+	return v1.MediaTypeImageManifest, m.canonical, nil
+}
+
+func toDescriptor(desc v1.Descriptor) distribution.Descriptor {
+	return distribution.Descriptor{
+		MediaType:   desc.MediaType,
+		Size:        desc.Size,
+		Digest:      desc.Digest,
+		URLs:        desc.URLs,
+		Annotations: desc.Annotations,
+	}
+}
+
+// the mapping between the media types of OCI and docker schema2
+var ociToSchema2MediaTypes = map[string]string{
+	v1.MediaTypeImageConfig:                    schema2.MediaTypeImageConfig,
+	v1.MediaTypeImageLayer:                     schema2.MediaTypeUncompressedLayer,
+	v1.MediaTypeImageLayerGzip:                 schema2.MediaTypeLayer,
+	v1.MediaTypeImageLayerNonDistributableGzip: schema2.MediaTypeForeignLayer,
+}
+
+// ConvertToSchema2 converts the OCI image manifest to the docker schema2 manifest
+// for the registries which don't support OCI. The digest of the converted manifest
+// differs from the original one and the annotations are dropped
+func ConvertToSchema2(m *OCIManifest) (distribution.Manifest, error) {
+	convert := func(desc v1.Descriptor) (distribution.Descriptor, error) {
+		mediaType, exist := ociToSchema2MediaTypes[desc.MediaType]
+		if !exist {
+			return distribution.Descriptor{}, fmt.Errorf("the media type %s cannot be converted to docker schema2", desc.MediaType)
+		}
+		return distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      desc.Size,
+			Digest:    desc.Digest,
+			URLs:      desc.URLs,
+		}, nil
+	}
+
+	config, err := convert(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	layers := []distribution.Descriptor{}
+	for _, layer := range m.Layers {
+		l, err := convert(layer)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    layers,
+	})
+}
+
+// the mapping between the media types of docker schema2 and OCI
+var schema2ToOCIMediaTypes = map[string]string{
+	schema2.MediaTypeImageConfig:       v1.MediaTypeImageConfig,
+	schema2.MediaTypeUncompressedLayer: v1.MediaTypeImageLayer,
+	schema2.MediaTypeLayer:             v1.MediaTypeImageLayerGzip,
+	schema2.MediaTypeForeignLayer:      v1.MediaTypeImageLayerNonDistributableGzip,
+}
+
+// ConvertToOCI converts the docker schema2 manifest to the OCI image manifest for the
+// registries which prefer OCI. The digest of the converted manifest differs from the original one
+func ConvertToOCI(m *schema2.DeserializedManifest) (*OCIManifest, error) {
+	convert := func(desc distribution.Descriptor) (v1.Descriptor, error) {
+		mediaType, exist := schema2ToOCIMediaTypes[desc.MediaType]
+		if !exist {
+			return v1.Descriptor{}, fmt.Errorf("the media type %s cannot be converted to OCI", desc.MediaType)
+		}
+		return v1.Descriptor{
+			MediaType: mediaType,
+			Size:      desc.Size,
+			Digest:    desc.Digest,
+			URLs:      desc.URLs,
+		}, nil
+	}
+
+	config, err := convert(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	layers := []v1.Descriptor{}
+	for _, layer := range m.Layers {
+		l, err := convert(layer)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	mfst := struct {
+		v1.Manifest
+		MediaType string `json:"mediaType"`
+	}{
+		Manifest: v1.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			Config:    config,
+			Layers:    layers,
+		},
+		MediaType: v1.MediaTypeImageManifest,
+	}
+	b, err := json.Marshal(mfst)
+	if err != nil {
+		return nil, err
+	}
+	converted := &OCIManifest{}
+	if err = converted.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
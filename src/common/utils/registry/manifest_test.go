@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/docker/distribution/manifest/schema2"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func TestUnMarshal(t *testing.T) {
@@ -58,3 +60,139 @@ func TestUnMarshal(t *testing.T) {
 		t.Errorf("unexpected digest: %s != %s", refs[1].Digest.String(), digest)
 	}
 }
+
+func TestOCIManifest(t *testing.T) {
+	b := []byte(`{
+   "schemaVersion":2,
+   "mediaType":"application/vnd.oci.image.manifest.v1+json",
+   "config":{
+      "mediaType":"application/vnd.oci.image.config.v1+json",
+      "size":1473,
+      "digest":"sha256:c54a2cc56cbb2f04003c1cd4507e118af7c0d340fe7e2720f70976c4b75237dc"
+   },
+   "layers":[
+      {
+         "mediaType":"application/vnd.oci.image.layer.v1.tar+gzip",
+         "size":974,
+         "digest":"sha256:c04b14da8d1441880ed3fe6106fb2cc6fa1c9661846ac0266b8a5ec8edf37b7c"
+      }
+   ]
+}`)
+
+	manifest, desc, err := UnMarshal(v1.MediaTypeImageManifest, b)
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if desc.Digest != godigest.FromBytes(b) {
+		t.Errorf("unexpected digest: %s != %s", desc.Digest, godigest.FromBytes(b))
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		t.Fatalf("failed to get the payload: %v", err)
+	}
+	if mediaType != v1.MediaTypeImageManifest || string(payload) != string(b) {
+		t.Errorf("unexpected payload: %s, %s", mediaType, string(payload))
+	}
+	refs := manifest.References()
+	if len(refs) != 2 {
+		t.Fatalf("unexpected length of reference: %d != %d", len(refs), 2)
+	}
+	if refs[1].MediaType != v1.MediaTypeImageLayerGzip {
+		t.Errorf("unexpected media type: %s != %s", refs[1].MediaType, v1.MediaTypeImageLayerGzip)
+	}
+
+	// convert to docker schema2
+	converted, err := ConvertToSchema2(manifest.(*OCIManifest))
+	if err != nil {
+		t.Fatalf("failed to convert manifest: %v", err)
+	}
+	mediaType, payload, err = converted.Payload()
+	if err != nil {
+		t.Fatalf("failed to get the payload: %v", err)
+	}
+	if mediaType != schema2.MediaTypeManifest {
+		t.Errorf("unexpected media type: %s != %s", mediaType, schema2.MediaTypeManifest)
+	}
+	// the converted manifest can be parsed as docker schema2
+	if _, _, err = UnMarshal(schema2.MediaTypeManifest, payload); err != nil {
+		t.Fatalf("failed to parse the converted manifest: %v", err)
+	}
+	refs = converted.References()
+	if len(refs) != 2 {
+		t.Fatalf("unexpected length of reference: %d != %d", len(refs), 2)
+	}
+	if refs[0].MediaType != schema2.MediaTypeImageConfig || refs[1].MediaType != schema2.MediaTypeLayer {
+		t.Errorf("unexpected media types: %s, %s", refs[0].MediaType, refs[1].MediaType)
+	}
+
+	// the media type which cannot be converted
+	manifest.(*OCIManifest).Layers[0].MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+	if _, err = ConvertToSchema2(manifest.(*OCIManifest)); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+
+	// invalid media type
+	if _, _, err = UnMarshal(v1.MediaTypeImageManifest, []byte(`{"mediaType":"application/json"}`)); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestConvertToOCI(t *testing.T) {
+	b := []byte(`{
+   "schemaVersion":2,
+   "mediaType":"application/vnd.docker.distribution.manifest.v2+json",
+   "config":{
+      "mediaType":"application/vnd.docker.container.image.v1+json",
+      "size":1473,
+      "digest":"sha256:c54a2cc56cbb2f04003c1cd4507e118af7c0d340fe7e2720f70976c4b75237dc"
+   },
+   "layers":[
+      {
+         "mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip",
+         "size":974,
+         "digest":"sha256:c04b14da8d1441880ed3fe6106fb2cc6fa1c9661846ac0266b8a5ec8edf37b7c"
+      }
+   ]
+}`)
+
+	manifest, _, err := UnMarshal(schema2.MediaTypeManifest, b)
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	converted, err := ConvertToOCI(manifest.(*schema2.DeserializedManifest))
+	if err != nil {
+		t.Fatalf("failed to convert manifest: %v", err)
+	}
+	mediaType, payload, err := converted.Payload()
+	if err != nil {
+		t.Fatalf("failed to get the payload: %v", err)
+	}
+	if mediaType != v1.MediaTypeImageManifest {
+		t.Errorf("unexpected media type: %s != %s", mediaType, v1.MediaTypeImageManifest)
+	}
+	// the converted manifest can be parsed as OCI
+	if _, _, err = UnMarshal(v1.MediaTypeImageManifest, payload); err != nil {
+		t.Fatalf("failed to parse the converted manifest: %v", err)
+	}
+	refs := converted.References()
+	if len(refs) != 2 {
+		t.Fatalf("unexpected length of reference: %d != %d", len(refs), 2)
+	}
+	if refs[0].MediaType != v1.MediaTypeImageConfig || refs[1].MediaType != v1.MediaTypeImageLayerGzip {
+		t.Errorf("unexpected media types: %s, %s", refs[0].MediaType, refs[1].MediaType)
+	}
+	if refs[1].Digest.String() != "sha256:c04b14da8d1441880ed3fe6106fb2cc6fa1c9661846ac0266b8a5ec8edf37b7c" {
+		t.Errorf("unexpected digest: %s", refs[1].Digest.String())
+	}
+
+	// convert back to docker schema2
+	if _, err = ConvertToSchema2(converted); err != nil {
+		t.Errorf("failed to convert manifest back: %v", err)
+	}
+
+	// the media type which cannot be converted
+	manifest.(*schema2.DeserializedManifest).Layers[0].MediaType = "application/vnd.unknown.layer"
+	if _, err = ConvertToOCI(manifest.(*schema2.DeserializedManifest)); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
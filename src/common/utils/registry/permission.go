@@ -0,0 +1,79 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	commonhttp "github.com/goharbor/harbor/src/common/http"
+)
+
+// CanPushWithContext returns whether the credential has the permission to push to the repository.
+// An upload session is initiated, which requests the token of the push scope if the registry uses the
+// token authentication, and the session is canceled after the check. The credential which can only pull
+// gets 401 or 403 from the registry or its token service, the check is aborted when the context is canceled
+func (r *Repository) CanPushWithContext(ctx context.Context) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, buildInitiateBlobUploadURL(r.Endpoint.String(), r.Name), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Length"), "0")
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		err = parseError(err)
+		if e, ok := err.(*commonhttp.Error); ok && e.IsAuthError() {
+			return false, nil
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		r.cancelUpload(ctx, resp.Header.Get(http.CanonicalHeaderKey("Location")))
+		return true, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	e := commonhttp.ParseRegistryError(resp.StatusCode, b)
+	if e.IsAuthError() {
+		return false, nil
+	}
+	return false, e
+}
+
+// cancel the upload session, the failure is ignored as the session expires on the registry anyway
+func (r *Repository) cancelUpload(ctx context.Context, location string) {
+	if len(location) == 0 {
+		return
+	}
+	relative, err := isRelativeURL(location)
+	if err != nil {
+		return
+	}
+	if relative {
+		location = r.Endpoint.String() + location
+	}
+	req, err := http.NewRequest(http.MethodDelete, location, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := r.client.Do(req.WithContext(ctx)); err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanPushWithContext(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		canPush  bool
+		isErr    bool
+		canceled bool
+	}{
+		{http.StatusAccepted, "", true, false, true},
+		{http.StatusUnauthorized, `{"errors":[{"code":"UNAUTHORIZED"}]}`, false, false, false},
+		{http.StatusForbidden, `{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`, false, false, false},
+		// Harbor is in read-only mode
+		{http.StatusForbidden, `{"errors":[{"code":"DENIED","message":"The system is in read only mode. Any modification is prohibited."}]}`, false, true, false},
+		{http.StatusInternalServerError, "", false, true, false},
+	}
+	for _, c := range cases {
+		canceled := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uploadPath := fmt.Sprintf("/v2/%s/blobs/uploads/", repository)
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == uploadPath:
+				w.Header().Set("Location", uploadPath+"uuid")
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			case r.Method == http.MethodDelete && r.URL.Path == uploadPath+"uuid":
+				canceled = true
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		client, err := newRepository(server.URL)
+		require.Nil(t, err)
+		canPush, err := client.CanPushWithContext(context.Background())
+		assert.Equal(t, c.canPush, canPush)
+		assert.Equal(t, c.isErr, err != nil)
+		assert.Equal(t, c.canceled, canceled)
+		server.Close()
+	}
+}
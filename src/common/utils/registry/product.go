@@ -0,0 +1,117 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// the products of the registries
+const (
+	ProductHarbor       = "harbor"
+	ProductDockerHub    = "docker-hub"
+	ProductArtifactory  = "artifactory"
+	ProductNexus        = "nexus"
+	ProductDistribution = "docker-distribution"
+	ProductUnknown      = "unknown"
+)
+
+// Product describes the product of the registry
+type Product struct {
+	Name string `json:"name"`
+	// the value of the header "Docker-Distribution-Api-Version", e.g. "registry/2.0"
+	APIVersion string `json:"api_version,omitempty"`
+	// the value of the header "Server"
+	Server string `json:"server,omitempty"`
+	// whether the registry is a Harbor instance
+	Harbor bool `json:"harbor"`
+	// the version of Harbor, it's only set when the registry is a Harbor instance
+	HarborVersion string `json:"harbor_version,omitempty"`
+}
+
+// ParseProduct recognizes the product of the registry by the headers of the response of the "/v2/" API
+func ParseProduct(header http.Header) *Product {
+	p := &Product{
+		Name:       ProductUnknown,
+		APIVersion: header.Get("Docker-Distribution-Api-Version"),
+		Server:     header.Get("Server"),
+	}
+	server := strings.ToLower(p.Server)
+	switch {
+	case len(header.Get("X-Artifactory-Id")) > 0 || strings.HasPrefix(server, "artifactory"):
+		p.Name = ProductArtifactory
+	case strings.HasPrefix(server, "nexus"):
+		p.Name = ProductNexus
+	case strings.Contains(header.Get("Www-Authenticate"), "auth.docker.io"):
+		p.Name = ProductDockerHub
+	case len(p.APIVersion) > 0:
+		p.Name = ProductDistribution
+	}
+	return p
+}
+
+// ProductWithContext probes the product of the registry. The product is recognized by the headers of
+// the "/v2/" API, and as Harbor cannot be recognized by the headers, its system info API is probed as well
+func (r *Registry) ProductWithContext(ctx context.Context) (*Product, error) {
+	req, err := http.NewRequest(http.MethodGet, buildPingURL(r.Endpoint.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, parseError(err)
+	}
+	resp.Body.Close()
+	product := ParseProduct(resp.Header)
+
+	if version, ok := r.harborVersion(ctx); ok {
+		product.Name = ProductHarbor
+		product.Harbor = true
+		product.HarborVersion = version
+	}
+	return product, nil
+}
+
+// returns the version of Harbor reported by the system info API, the returned bool is false if
+// the registry isn't a Harbor instance
+func (r *Registry) harborVersion(ctx context.Context) (string, bool) {
+	req, err := http.NewRequest(http.MethodGet, r.Endpoint.String()+"/api/systeminfo", nil)
+	if err != nil {
+		return "", false
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false
+	}
+	info := &struct {
+		HarborVersion *string `json:"harbor_version"`
+	}{}
+	if err = json.Unmarshal(data, info); err != nil || info.HarborVersion == nil {
+		return "", false
+	}
+	return *info.HarborVersion, true
+}
@@ -0,0 +1,126 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProduct(t *testing.T) {
+	cases := []struct {
+		header  map[string]string
+		product *Product
+	}{
+		{
+			header: map[string]string{
+				"Docker-Distribution-Api-Version": "registry/2.0",
+			},
+			product: &Product{Name: ProductDistribution, APIVersion: "registry/2.0"},
+		},
+		{
+			header: map[string]string{
+				"Docker-Distribution-Api-Version": "registry/2.0",
+				"Www-Authenticate":                `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+			},
+			product: &Product{Name: ProductDockerHub, APIVersion: "registry/2.0"},
+		},
+		{
+			header: map[string]string{
+				"Docker-Distribution-Api-Version": "registry/2.0",
+				"X-Artifactory-Id":                "a1b2c3",
+			},
+			product: &Product{Name: ProductArtifactory, APIVersion: "registry/2.0"},
+		},
+		{
+			header: map[string]string{
+				"Server": "Artifactory/6.10.0",
+			},
+			product: &Product{Name: ProductArtifactory, Server: "Artifactory/6.10.0"},
+		},
+		{
+			header: map[string]string{
+				"Docker-Distribution-Api-Version": "registry/2.0",
+				"Server":                          "Nexus/3.19.1-01 (OSS)",
+			},
+			product: &Product{Name: ProductNexus, APIVersion: "registry/2.0", Server: "Nexus/3.19.1-01 (OSS)"},
+		},
+		{
+			header: map[string]string{
+				"Server": "nginx",
+			},
+			product: &Product{Name: ProductUnknown, Server: "nginx"},
+		},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		for k, v := range c.header {
+			header.Set(k, v)
+		}
+		assert.Equal(t, c.product, ParseProduct(header))
+	}
+}
+
+func TestProductWithContext(t *testing.T) {
+	cases := []struct {
+		systemInfo string
+		product    *Product
+	}{
+		{
+			systemInfo: `{"harbor_version":"v1.9.0-2d1f3c3e"}`,
+			product: &Product{
+				Name:          ProductHarbor,
+				APIVersion:    "registry/2.0",
+				Harbor:        true,
+				HarborVersion: "v1.9.0-2d1f3c3e",
+			},
+		},
+		{
+			systemInfo: "",
+			product: &Product{
+				Name:       ProductDistribution,
+				APIVersion: "registry/2.0",
+			},
+		},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/":
+				w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+				w.WriteHeader(http.StatusOK)
+			case "/api/systeminfo":
+				if len(c.systemInfo) == 0 {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(c.systemInfo))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		client, err := newRegistryClient(server.URL)
+		require.Nil(t, err)
+		product, err := client.ProductWithContext(context.Background())
+		require.Nil(t, err)
+		assert.Equal(t, c.product, product)
+		server.Close()
+	}
+}
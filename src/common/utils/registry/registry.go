@@ -15,14 +15,14 @@
 package registry
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
-	"strings"
-
-	// "time"
+	"sync"
+	"time"
 
 	commonhttp "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils"
@@ -34,27 +34,92 @@ type Registry struct {
 	client   *http.Client
 }
 
-var defaultHTTPTransport, secureHTTPTransport, insecureHTTPTransport *http.Transport
+// the default timeouts of the transports, they're the same with the ones of http.DefaultTransport
+const (
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// MaxIdleConnsPerHost is the max count of the idle connections kept by the transports for every
+// registry, it's also the max count of the connections which can be warmed up
+const MaxIdleConnsPerHost = 20
+
+var (
+	defaultHTTPTransport, secureHTTPTransport, insecureHTTPTransport *http.Transport
+	// protect the transports which are replaced when the settings are changed
+	transportLock sync.RWMutex
+	// the settings which the transports are built with, they're protected by the transport lock
+	dialTimeout         = DefaultDialTimeout
+	tlsHandshakeTimeout = DefaultTLSHandshakeTimeout
+	resolver            *net.Resolver
+	nameserverAddress   string
+	staticHosts         map[string]string
+)
 
 func init() {
-	defaultHTTPTransport = &http.Transport{}
+	buildTransports()
+}
 
-	secureHTTPTransport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: false,
-		},
+// SetTransportTimeouts sets the timeouts of connecting and TLS handshake for the transports returned
+// by GetHTTPTransport, the default values are used if they are less than or equal to 0. The timeouts
+// are separated from the one of the whole request, so the registries with high latency can be tuned.
+// It can be called at runtime: the transports are replaced, so only the clients created afterwards
+// use the new timeouts and the requests in flight aren't interrupted
+func SetTransportTimeouts(dial, tlsHandshake time.Duration) {
+	if dial <= 0 {
+		dial = DefaultDialTimeout
+	}
+	if tlsHandshake <= 0 {
+		tlsHandshake = DefaultTLSHandshakeTimeout
 	}
-	insecureHTTPTransport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	transportLock.Lock()
+	dialTimeout, tlsHandshakeTimeout = dial, tlsHandshake
+	olds := buildTransports()
+	transportLock.Unlock()
+	closeIdleConnections(olds)
+}
+
+// build the transports with the current settings and return the old ones, the caller must hold the transport lock
+func buildTransports() []*http.Transport {
+	newTransport := func(proxy func(*http.Request) (*url.URL, error), tlsConfig *tls.Config) *http.Transport {
+		dialer := &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+			Resolver:  resolver,
+		}
+		return &http.Transport{
+			Proxy:               proxy,
+			TLSClientConfig:     tlsConfig,
+			DialContext:         dialContext(dialer, staticHosts),
+			TLSHandshakeTimeout: tlsHandshakeTimeout,
+			MaxIdleConnsPerHost: MaxIdleConnsPerHost,
+		}
+	}
+
+	olds := []*http.Transport{defaultHTTPTransport, secureHTTPTransport, insecureHTTPTransport}
+	defaultHTTPTransport = newTransport(nil, nil)
+	secureHTTPTransport = newTransport(http.ProxyFromEnvironment, &tls.Config{
+		InsecureSkipVerify: false,
+	})
+	insecureHTTPTransport = newTransport(http.ProxyFromEnvironment, &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	return olds
+}
+
+// the connections in use are closed by the clients holding the old transports
+func closeIdleConnections(transports []*http.Transport) {
+	for _, transport := range transports {
+		if transport != nil {
+			transport.CloseIdleConnections()
+		}
 	}
 }
 
 // GetHTTPTransport returns HttpTransport based on insecure configuration
 func GetHTTPTransport(insecure ...bool) *http.Transport {
+	transportLock.RLock()
+	defer transportLock.RUnlock()
 	if len(insecure) == 0 {
 		return defaultHTTPTransport
 	}
@@ -79,63 +144,29 @@ func NewRegistry(endpoint string, client *http.Client) (*Registry, error) {
 	return registry, nil
 }
 
-// Catalog ...
+// Catalog lists all the repositories of the registry, the failed page is fetched again from the checkpoint.
+// The repositories fetched before the failure are returned along with the error
 func (r *Registry) Catalog() ([]string, error) {
 	repos := []string{}
-	suffix := "/v2/_catalog?n=1000"
-	var url string
-
-	for len(suffix) > 0 {
-		url = r.Endpoint.String() + suffix
-
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return repos, err
-		}
-		resp, err := r.client.Do(req)
-		if err != nil {
-			return nil, parseError(err)
-		}
-
-		defer resp.Body.Close()
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return repos, err
-		}
-
-		if resp.StatusCode == http.StatusOK {
-			catalogResp := struct {
-				Repositories []string `json:"repositories"`
-			}{}
-
-			if err := json.Unmarshal(b, &catalogResp); err != nil {
-				return repos, err
-			}
-
-			repos = append(repos, catalogResp.Repositories...)
-			// Link: </v2/_catalog?last=library%2Fhello-world-25&n=100>; rel="next"
-			link := resp.Header.Get("Link")
-			if strings.HasSuffix(link, `rel="next"`) && strings.Index(link, "<") >= 0 && strings.Index(link, ">") >= 0 {
-				suffix = link[strings.Index(link, "<")+1 : strings.Index(link, ">")]
-			} else {
-				suffix = ""
-			}
-		} else {
-			return repos, &commonhttp.Error{
-				Code:    resp.StatusCode,
-				Message: string(b),
-			}
-		}
-	}
-	return repos, nil
+	err := r.CatalogWithCheckpoint(func(repositories []string) error {
+		repos = append(repos, repositories...)
+		return nil
+	})
+	return repos, err
 }
 
 // Ping ...
 func (r *Registry) Ping() error {
+	return r.PingWithContext(context.Background())
+}
+
+// PingWithContext is the same with "Ping", the request is aborted when the context is canceled
+func (r *Registry) PingWithContext(ctx context.Context) error {
 	req, err := http.NewRequest(http.MethodHead, buildPingURL(r.Endpoint.String()), nil)
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -152,16 +183,18 @@ func (r *Registry) Ping() error {
 		return err
 	}
 
-	return &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	return commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 // PingSimple checks whether the registry is available. It checks the connectivity and certificate (if TLS enabled)
 // only, regardless of credential.
 func (r *Registry) PingSimple() error {
-	err := r.Ping()
+	return r.PingSimpleWithContext(context.Background())
+}
+
+// PingSimpleWithContext is the same with "PingSimple", the request is aborted when the context is canceled
+func (r *Registry) PingSimpleWithContext(ctx context.Context) error {
+	err := r.PingWithContext(ctx)
 	if err == nil {
 		return nil
 	}
@@ -169,8 +202,7 @@ func (r *Registry) PingSimple() error {
 	if !ok {
 		return err
 	}
-	if httpErr.Code == http.StatusUnauthorized ||
-		httpErr.Code == http.StatusForbidden {
+	if httpErr.IsAuthError() {
 		return nil
 	}
 	return httpErr
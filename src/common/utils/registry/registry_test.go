@@ -15,14 +15,22 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"runtime"
 	"strconv"
 	"testing"
+	"time"
 
+	commonhttp "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPing(t *testing.T) {
@@ -44,6 +52,84 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestPingWithContext(t *testing.T) {
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// block until the request is aborted by the client
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer server.Close()
+
+	client, err := newRegistryClient(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for registry: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	if err = client.PingSimpleWithContext(ctx); err == nil {
+		t.Errorf("expected error when the context is canceled")
+	}
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the outbound request isn't aborted after the context is canceled")
+	}
+}
+
+func TestPingError(t *testing.T) {
+	cases := []struct {
+		code      int
+		simpleErr bool
+		authErr   bool
+		retryable bool
+	}{
+		{http.StatusUnauthorized, false, true, false},
+		{http.StatusForbidden, false, true, false},
+		{http.StatusNotFound, true, false, false},
+		{http.StatusServiceUnavailable, true, false, true},
+	}
+	for _, c := range cases {
+		server := test.NewServer(
+			&test.RequestHandlerMapping{
+				Method:  http.MethodHead,
+				Pattern: "/v2/",
+				Handler: test.Handler(&test.Response{
+					StatusCode: c.code,
+				}),
+			})
+
+		client, err := newRegistryClient(server.URL)
+		if err != nil {
+			t.Fatalf("failed to create client for registry: %v", err)
+		}
+
+		err = client.Ping()
+		e, ok := err.(*commonhttp.Error)
+		if !ok {
+			t.Errorf("unexpected error type for status code %d: %v", c.code, err)
+		} else {
+			if e.IsAuthError() != c.authErr {
+				t.Errorf("unexpected auth error for status code %d: %t != %t", c.code, e.IsAuthError(), c.authErr)
+			}
+			if e.IsRetryable() != c.retryable {
+				t.Errorf("unexpected retryable for status code %d: %t != %t", c.code, e.IsRetryable(), c.retryable)
+			}
+		}
+
+		// the auth errors are ignored by PingSimple
+		if err = client.PingSimple(); (err != nil) != c.simpleErr {
+			t.Errorf("unexpected error of PingSimple for status code %d: %v", c.code, err)
+		}
+		server.Close()
+	}
+}
+
 func TestCatalog(t *testing.T) {
 	repositories := make([]string, 0, 1001)
 	for i := 0; i < 1001; i++ {
@@ -137,6 +223,197 @@ func TestCatalog(t *testing.T) {
 	}
 }
 
+// newPaginatedCatalogServer returns the registry whose catalog has 2 repositories per page, the pages
+// after the repositories in "failures" fail for the specified times. The "last" cursors requested are recorded
+func newPaginatedCatalogServer(failures map[string]int, lasts *[]string) *httptest.Server {
+	repositories := []string{"a", "b", "c", "d", "e"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last := r.URL.Query().Get("last")
+		*lasts = append(*lasts, last)
+		if failures[last] > 0 {
+			failures[last]--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		begin := 0
+		for i, repository := range repositories {
+			if repository == last {
+				begin = i + 1
+			}
+		}
+		end := begin + 2
+		if end < len(repositories) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?last=%s&n=2>; rel="next"`, repositories[end-1]))
+		} else {
+			end = len(repositories)
+		}
+		b, _ := json.Marshal(map[string][]string{"repositories": repositories[begin:end]})
+		w.Write(b)
+	}))
+}
+
+func TestCatalogWithCheckpoint(t *testing.T) {
+	catalogRetryInterval = 0
+	defer func() {
+		catalogRetryInterval = 2 * time.Second
+	}()
+
+	// the failed page is fetched again from the checkpoint rather than the beginning
+	lasts := []string{}
+	server := newPaginatedCatalogServer(map[string]int{"b": 2}, &lasts)
+	defer server.Close()
+	client, err := newRegistryClient(server.URL)
+	require.Nil(t, err)
+	pages := [][]string{}
+	err = client.CatalogWithCheckpoint(func(repositories []string) error {
+		pages = append(pages, repositories)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, pages)
+	assert.Equal(t, []string{"", "b", "b", "b", "d"}, lasts)
+
+	// the page keeps failing, the repositories fetched before the failure are returned
+	lasts = []string{}
+	server2 := newPaginatedCatalogServer(map[string]int{"d": catalogRetries + 1}, &lasts)
+	defer server2.Close()
+	client, err = newRegistryClient(server2.URL)
+	require.Nil(t, err)
+	repos, err := client.Catalog()
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, repos)
+	assert.Equal(t, []string{"", "b", "d", "d", "d", "d"}, lasts)
+
+	// the error of the handler aborts the enumeration
+	lasts = []string{}
+	server3 := newPaginatedCatalogServer(nil, &lasts)
+	defer server3.Close()
+	client, err = newRegistryClient(server3.URL)
+	require.Nil(t, err)
+	err = client.CatalogWithCheckpoint(func(repositories []string) error {
+		return errors.New("error")
+	})
+	assert.Equal(t, "error", err.Error())
+	assert.Equal(t, []string{""}, lasts)
+}
+
+// the catalog server generating the repositories on the fly, so the huge catalog doesn't occupy
+// the memory of the test itself
+func newHugeCatalogServer(total int, served *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		begin := 0
+		if last := r.URL.Query().Get("last"); len(last) > 0 {
+			fmt.Sscanf(last, "library/repository-%d", &begin)
+			begin++
+		}
+		end := begin + n
+		if end < total {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?last=%s&n=%d>; rel="next"`,
+				url.QueryEscape(fmt.Sprintf("library/repository-%08d", end-1)), n))
+		} else {
+			end = total
+		}
+		repositories := make([]string, 0, end-begin)
+		for i := begin; i < end; i++ {
+			repositories = append(repositories, fmt.Sprintf("library/repository-%08d", i))
+		}
+		*served++
+		b, _ := json.Marshal(map[string][]string{"repositories": repositories})
+		w.Write(b)
+	}))
+}
+
+func TestCatalogWithContext(t *testing.T) {
+	total := 500 * catalogPageSize
+	served := 0
+	server := newHugeCatalogServer(total, &served)
+	defer server.Close()
+	client, err := newRegistryClient(server.URL)
+	require.Nil(t, err)
+
+	// only one page is held at a time and the next page isn't fetched until the handler returns
+	var before, current runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	var peak uint64
+	count, pages := 0, 0
+	err = client.CatalogWithContext(context.Background(), func(repositories []string) error {
+		pages++
+		require.True(t, len(repositories) <= catalogPageSize)
+		require.Equal(t, pages, served)
+		count += len(repositories)
+		if pages%50 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&current)
+			if current.HeapAlloc > peak {
+				peak = current.HeapAlloc
+			}
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(t, total, count)
+	assert.Equal(t, 500, pages)
+	// buffering the whole catalog takes about 20MB
+	assert.True(t, peak < before.HeapAlloc+4<<20, "the heap grows from %d to %d", before.HeapAlloc, peak)
+
+	// the enumeration is aborted once the context is canceled
+	served = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	pages = 0
+	err = client.CatalogWithContext(ctx, func(repositories []string) error {
+		pages++
+		if pages == 3 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, 3, served)
+}
+
 func newRegistryClient(url string) (*Registry, error) {
 	return NewRegistry(url, &http.Client{})
 }
+
+func TestSetTransportTimeouts(t *testing.T) {
+	defer SetTransportTimeouts(0, 0)
+
+	SetTransportTimeouts(5*time.Second, time.Minute)
+	for _, insecure := range [][]bool{{}, {true}, {false}} {
+		transport := GetHTTPTransport(insecure...)
+		if transport.DialContext == nil {
+			t.Errorf("the dial function of transport isn't set")
+		}
+		if transport.TLSHandshakeTimeout != time.Minute {
+			t.Errorf("unexpected TLS handshake timeout: %v != %v", transport.TLSHandshakeTimeout, time.Minute)
+		}
+	}
+
+	// the default values are used
+	SetTransportTimeouts(0, -1)
+	if transport := GetHTTPTransport(true); transport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Errorf("unexpected TLS handshake timeout: %v != %v", transport.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	}
+}
+
+func TestSetTransportTimeoutsAtRuntime(t *testing.T) {
+	defer SetTransportTimeouts(0, 0)
+
+	SetTransportTimeouts(0, 0)
+	// the transport held by the running client
+	old := GetHTTPTransport(true)
+
+	SetTransportTimeouts(0, time.Minute)
+	if transport := GetHTTPTransport(true); transport == old || transport.TLSHandshakeTimeout != time.Minute {
+		t.Errorf("the new timeout doesn't take effect on the transport got afterwards")
+	}
+	if old.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Errorf("the transport got before is changed: %v != %v", old.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	}
+	if transport := GetHTTPTransport(true); !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("the insecure transport verifies the certificate")
+	}
+}
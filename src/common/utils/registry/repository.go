@@ -16,6 +16,7 @@ package registry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -32,6 +33,7 @@ import (
 
 	commonhttp "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // Repository holds information of a repository entity
@@ -109,11 +111,43 @@ func (r *Repository) ListTag() ([]string, error) {
 		return tags, nil
 	}
 
-	return tags, &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
+	return tags, commonhttp.ParseRegistryError(resp.StatusCode, b)
+
+}
+
+// ListReferrers lists the descriptors of manifests which refer to the manifest specified
+// by the digest via the referrers API. If the registry doesn't support the referrers API,
+// an empty list will be returned
+func (r *Repository) ListReferrers(digest string) ([]v1.Descriptor, error) {
+	referrers := []v1.Descriptor{}
+	req, err := http.NewRequest("GET", buildReferrersURL(r.Endpoint.String(), r.Name, digest), nil)
+	if err != nil {
+		return referrers, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return referrers, parseError(err)
 	}
 
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return referrers, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		index := &v1.Index{}
+		if err := json.Unmarshal(b, index); err != nil {
+			return referrers, err
+		}
+		return index.Manifests, nil
+	} else if resp.StatusCode == http.StatusNotFound {
+		return referrers, nil
+	}
+
+	return referrers, commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 // ManifestExist ...
@@ -125,6 +159,7 @@ func (r *Repository) ManifestExist(reference string) (digest string, exist bool,
 
 	req.Header.Add(http.CanonicalHeaderKey("Accept"), schema1.MediaTypeManifest)
 	req.Header.Add(http.CanonicalHeaderKey("Accept"), schema2.MediaTypeManifest)
+	req.Header.Add(http.CanonicalHeaderKey("Accept"), v1.MediaTypeImageManifest)
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -149,10 +184,7 @@ func (r *Repository) ManifestExist(reference string) (digest string, exist bool,
 		return
 	}
 
-	err = &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	err = commonhttp.ParseRegistryError(resp.StatusCode, b)
 	return
 }
 
@@ -174,22 +206,20 @@ func (r *Repository) PullManifest(reference string, acceptMediaTypes []string) (
 	}
 
 	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
-
 	if resp.StatusCode == http.StatusOK {
+		if payload, err = readManifest(resp, r.Name, reference); err != nil {
+			return
+		}
 		digest = resp.Header.Get(http.CanonicalHeaderKey("Docker-Content-Digest"))
 		mediaType = resp.Header.Get(http.CanonicalHeaderKey("Content-Type"))
-		payload = b
 		return
 	}
 
-	err = &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
 	}
+	err = commonhttp.ParseRegistryError(resp.StatusCode, b)
 
 	return
 }
@@ -221,10 +251,7 @@ func (r *Repository) PushManifest(reference, mediaType string, payload []byte) (
 		return
 	}
 
-	err = &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	err = commonhttp.ParseRegistryError(resp.StatusCode, b)
 
 	return
 }
@@ -252,10 +279,7 @@ func (r *Repository) DeleteManifest(digest string) error {
 		return err
 	}
 
-	return &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	return commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 // MountBlob ...
@@ -280,6 +304,35 @@ func (r *Repository) MountBlob(digest, from string) error {
 	return nil
 }
 
+// TryMountBlob tries to mount the blob from the repository "from" and returns whether it's mounted.
+// The registry responds 201 if the blob is mounted, and it starts a normal upload session with 202
+// if the blob cannot be mounted, e.g. it doesn't exist in "from", the session is canceled then
+func (r *Repository) TryMountBlob(digest, from string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, buildMountBlobURL(r.Endpoint.String(), r.Name, digest, from), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Length"), "0")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, parseError(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		r.cancelUpload(context.Background(), resp.Header.Get(http.CanonicalHeaderKey("Location")))
+		return false, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	return false, commonhttp.ParseRegistryError(resp.StatusCode, b)
+}
+
 // DeleteTag ...
 func (r *Repository) DeleteTag(tag string) error {
 	digest, exist, err := r.ManifestExist(tag)
@@ -323,10 +376,7 @@ func (r *Repository) BlobExist(digest string) (bool, error) {
 		return false, err
 	}
 
-	return false, &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	return false, commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 // PullBlob : client must close data if it is not nil
@@ -359,10 +409,7 @@ func (r *Repository) PullBlob(digest string) (size int64, data io.ReadCloser, er
 		return
 	}
 
-	err = &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	err = commonhttp.ParseRegistryError(resp.StatusCode, b)
 
 	return
 }
@@ -390,10 +437,7 @@ func (r *Repository) initiateBlobUpload(name string) (location, uploadUUID strin
 		return
 	}
 
-	err = &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	err = commonhttp.ParseRegistryError(resp.StatusCode, b)
 
 	return
 }
@@ -424,10 +468,7 @@ func (r *Repository) monolithicBlobUpload(location, digest string, size int64, d
 		return err
 	}
 
-	return &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	return commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 // PushBlob ...
@@ -462,10 +503,7 @@ func (r *Repository) DeleteBlob(digest string) error {
 		return err
 	}
 
-	return &commonhttp.Error{
-		Code:    resp.StatusCode,
-		Message: string(b),
-	}
+	return commonhttp.ParseRegistryError(resp.StatusCode, b)
 }
 
 func buildPingURL(endpoint string) string {
@@ -480,6 +518,10 @@ func buildManifestURL(endpoint, repoName, reference string) string {
 	return fmt.Sprintf("%s/v2/%s/manifests/%s", endpoint, repoName, reference)
 }
 
+func buildReferrersURL(endpoint, repoName, digest string) string {
+	return fmt.Sprintf("%s/v2/%s/referrers/%s", endpoint, repoName, digest)
+}
+
 func buildBlobURL(endpoint, repoName, reference string) string {
 	return fmt.Sprintf("%s/v2/%s/blobs/%s", endpoint, repoName, reference)
 }
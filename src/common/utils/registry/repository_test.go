@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
@@ -287,6 +288,53 @@ func TestPullManifest(t *testing.T) {
 	}
 }
 
+func TestPullOversizedManifest(t *testing.T) {
+	SetMaxManifestSize(int64(len(manifest)))
+	defer SetMaxManifestSize(0)
+
+	oversized := []byte(string(manifest) + "-with-too-many-layers")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", mediaType)
+		switch r.URL.Path {
+		case fmt.Sprintf("/v2/%s/manifests/%s", repository, tag):
+			w.Write(manifest)
+		case fmt.Sprintf("/v2/%s/manifests/oversized", repository):
+			w.Header().Set("Content-Length", strconv.Itoa(len(oversized)))
+			w.Write(oversized)
+		case fmt.Sprintf("/v2/%s/manifests/chunked", repository):
+			// no Content-Length is sent for the flushed response
+			w.Write(oversized[:1])
+			w.(http.Flusher).Flush()
+			w.Write(oversized[1:])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	require.Nil(t, err)
+
+	// the manifest whose size equals the limit
+	_, _, payload, err := client.PullManifest(tag, []string{mediaType})
+	require.Nil(t, err)
+	assert.Equal(t, manifest, payload)
+
+	for _, reference := range []string{"oversized", "chunked"} {
+		_, _, payload, err = client.PullManifest(reference, []string{mediaType})
+		require.NotNil(t, err)
+		e, ok := err.(*ManifestTooLargeError)
+		require.True(t, ok)
+		assert.Equal(t, reference, e.Reference)
+		assert.Equal(t, int64(len(manifest)), e.Limit)
+		assert.Nil(t, payload)
+	}
+
+	// reset to the default size
+	SetMaxManifestSize(0)
+	assert.Equal(t, DefaultMaxManifestSize, MaxManifestSize())
+}
+
 func TestPushManifest(t *testing.T) {
 	handler := test.Handler(&test.Response{
 		StatusCode: http.StatusCreated,
@@ -320,6 +368,35 @@ func TestPushManifest(t *testing.T) {
 	}
 }
 
+func TestPushManifestToReadOnlyRegistry(t *testing.T) {
+	handler := test.Handler(&test.Response{
+		StatusCode: http.StatusForbidden,
+		Body:       []byte(`{"errors":[{"code":"DENIED","message":"The system is in read only mode. Any modification is prohibited."}]}`),
+	})
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Method:  "PUT",
+			Pattern: fmt.Sprintf("/v2/%s/manifests/%s", repository, tag),
+			Handler: handler,
+		})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	_, err = client.PushManifest(tag, mediaType, manifest)
+	e, ok := err.(*commonhttp.Error)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !e.IsReadOnly() || e.IsAuthError() {
+		t.Errorf("the error should be classified as read-only rather than auth error: %v", e)
+	}
+}
+
 func TestDeleteTag(t *testing.T) {
 	manifestExistHandler := test.Handler(&test.Response{
 		Headers: map[string]string{
@@ -390,6 +467,38 @@ func TestListTag(t *testing.T) {
 	}
 }
 
+func TestListReferrers(t *testing.T) {
+	referrer := "sha256:eec76eedea59f7bf39a2713bfd995c82cfaa97724ee5b7f5aba253e07423d0ae"
+	handler := test.Handler(&test.Response{
+		Headers: map[string]string{
+			"Content-Type": "application/vnd.oci.image.index.v1+json",
+		},
+		Body: []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":100,"artifactType":"application/vnd.dev.cosign.artifact.sig.v1+json"}]}`, referrer)),
+	})
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Method:  "GET",
+			Pattern: fmt.Sprintf("/v2/%s/referrers/%s", repository, digest),
+			Handler: handler,
+		})
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	require.Nil(t, err)
+
+	referrers, err := client.ListReferrers(digest)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(referrers))
+	assert.Equal(t, referrer, referrers[0].Digest.String())
+	assert.Equal(t, "application/vnd.oci.image.manifest.v1+json", referrers[0].MediaType)
+
+	// the referrers API isn't supported
+	referrers, err = client.ListReferrers("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(referrers))
+}
+
 func TestParseError(t *testing.T) {
 	err := &url.Error{
 		Err: &commonhttp.Error{},
@@ -456,3 +565,39 @@ func TestMountBlob(t *testing.T) {
 		t.Fatalf("failed to mount blob: %v", err)
 	}
 }
+
+func TestTryMountBlob(t *testing.T) {
+	canceled := false
+	location := fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			require.Equal(t, digest, r.URL.Query().Get("mount"))
+			if r.URL.Query().Get("from") == "library/base" {
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			// the blob cannot be mounted, a normal upload session is started
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodDelete:
+			assert.Equal(t, location, r.URL.Path)
+			canceled = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newRepository(server.URL)
+	require.Nil(t, err)
+	mounted, err := client.TryMountBlob(digest, "library/base")
+	require.Nil(t, err)
+	assert.True(t, mounted)
+	assert.False(t, canceled)
+
+	// fall back to the normal upload, the session is canceled
+	mounted, err = client.TryMountBlob(digest, "library/other")
+	require.Nil(t, err)
+	assert.False(t, mounted)
+	assert.True(t, canceled)
+}
@@ -0,0 +1,97 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SetResolver sets the DNS server and the static mappings from the hostnames to the IP addresses which are used
+// to resolve the hostnames of the registries by the transports returned by GetHTTPTransport, e.g. in the split-horizon
+// DNS or the test environments. The static mappings take precedence over the DNS server, and the system resolver is used
+// if the DNS server is empty. The port 53 is used if the DNS server has no port. The hostnames of the registries
+// accessed through the proxy are resolved by the proxy. Like SetTransportTimeouts, only the clients created
+// afterwards are affected, and the settings are kept unchanged if they're invalid
+func SetResolver(nameserver string, hosts map[string]string) error {
+	r, address, err := newResolver(nameserver)
+	if err != nil {
+		return err
+	}
+	mappings := map[string]string{}
+	for host, ip := range hosts {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %s of the host %s", ip, host)
+		}
+		mappings[strings.ToLower(host)] = ip
+	}
+
+	transportLock.Lock()
+	resolver, nameserverAddress, staticHosts = r, address, mappings
+	olds := buildTransports()
+	transportLock.Unlock()
+	closeIdleConnections(olds)
+	return nil
+}
+
+// ResolutionKey returns the key of how the hostname is resolved by the transports returned by GetHTTPTransport,
+// i.e. the DNS server and the IP address mapped statically. The key changes if the resolution of the hostname
+// is changed by SetResolver, e.g. for the caches of the connections to the host
+func ResolutionKey(host string) string {
+	transportLock.RLock()
+	defer transportLock.RUnlock()
+	return nameserverAddress + "|" + staticHosts[strings.ToLower(host)]
+}
+
+// returns the resolver which sends the queries to the DNS server and the address of the DNS server,
+// nil is returned to use the system resolver if the DNS server is empty
+func newResolver(nameserver string) (*net.Resolver, string, error) {
+	if len(nameserver) == 0 {
+		return nil, "", nil
+	}
+	address := nameserver
+	host, _, err := net.SplitHostPort(nameserver)
+	if err != nil {
+		host = nameserver
+		address = net.JoinHostPort(nameserver, "53")
+	}
+	if net.ParseIP(host) == nil {
+		return nil, "", fmt.Errorf("invalid DNS server %s, it must be an IP address with an optional port", nameserver)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := &net.Dialer{}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}, address, nil
+}
+
+// returns the function which dials the address with the hostname replaced by the IP address mapped statically
+func dialContext(dialer *net.Dialer, hosts map[string]string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if len(hosts) == 0 {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if ip, exist := hosts[strings.ToLower(host)]; exist {
+				address = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
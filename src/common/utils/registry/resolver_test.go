@@ -0,0 +1,160 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// starts the DNS server which answers the A queries of the hostname with the IP address, the
+// other queries are answered with no record. The address of the server is returned
+func startDNSServer(t *testing.T, hostname string, ip net.IP) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 12 {
+				continue
+			}
+			// parse the name and type of the question
+			labels := []string{}
+			i := 12
+			for i < n && buf[i] != 0 {
+				labels = append(labels, string(buf[i+1:i+1+int(buf[i])]))
+				i += int(buf[i]) + 1
+			}
+			end := i + 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(buf[i+1 : i+3])
+			name := strings.Join(labels, ".")
+
+			resp := make([]byte, 12, 64)
+			copy(resp, buf[:2])
+			// response, recursion desired and available
+			binary.BigEndian.PutUint16(resp[2:], 0x8180)
+			binary.BigEndian.PutUint16(resp[4:], 1)
+			resp = append(resp, buf[12:end]...)
+			if qtype == 1 && strings.EqualFold(name, hostname) {
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				// the name pointing to the question, type A, class IN, TTL 60s and the IP address
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, ip.To4()...)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+// sends the request to the "/v2/" API of the server by the hostname through the shared transport
+func pingByHostname(t *testing.T, server *httptest.Server, hostname string) (*http.Response, error) {
+	u, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	_, port, err := net.SplitHostPort(u.Host)
+	require.Nil(t, err)
+	client := &http.Client{Transport: GetHTTPTransport()}
+	resp, err := client.Get("http://" + net.JoinHostPort(hostname, port) + "/v2/")
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestSetResolverWithStaticHosts(t *testing.T) {
+	defer SetResolver("", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	require.Nil(t, SetResolver("", map[string]string{"Registry.Harbor.Test": "127.0.0.1"}))
+	resp, err := pingByHostname(t, server, "registry.harbor.test")
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the hosts aren't mapped after the resolver is reset
+	require.Nil(t, SetResolver("", nil))
+	_, err = pingByHostname(t, server, "registry.harbor.test")
+	assert.NotNil(t, err)
+}
+
+func TestSetResolverWithNameserver(t *testing.T) {
+	defer SetResolver("", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	nameserver, stop := startDNSServer(t, "registry.harbor.test", net.ParseIP("127.0.0.1"))
+	defer stop()
+
+	require.Nil(t, SetResolver(nameserver, nil))
+	resp, err := pingByHostname(t, server, "registry.harbor.test")
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the hostname unknown by the DNS server
+	_, err = pingByHostname(t, server, "unknown.harbor.test")
+	assert.NotNil(t, err)
+
+	// the static hosts are used together with the DNS server
+	require.Nil(t, SetResolver(nameserver, map[string]string{"unknown.harbor.test": "127.0.0.1"}))
+	resp, err = pingByHostname(t, server, "unknown.harbor.test")
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestResolutionKey(t *testing.T) {
+	defer SetResolver("", nil)
+	require.Nil(t, SetResolver("", nil))
+	key := ResolutionKey("registry.harbor.test")
+
+	// changed by the static host mapping of the host
+	require.Nil(t, SetResolver("", map[string]string{"Registry.Harbor.Test": "127.0.0.1"}))
+	mapped := ResolutionKey("registry.harbor.test")
+	assert.NotEqual(t, key, mapped)
+	assert.Equal(t, key, ResolutionKey("another.harbor.test"))
+
+	// changed by the DNS server
+	require.Nil(t, SetResolver("10.0.0.2", map[string]string{"registry.harbor.test": "127.0.0.1"}))
+	assert.NotEqual(t, mapped, ResolutionKey("registry.harbor.test"))
+	assert.NotEqual(t, key, ResolutionKey("another.harbor.test"))
+}
+
+func TestSetResolverWithInvalidSettings(t *testing.T) {
+	defer SetResolver("", nil)
+	require.Nil(t, SetResolver("10.0.0.2", map[string]string{"registry.harbor.test": "127.0.0.1"}))
+	transport := GetHTTPTransport()
+
+	assert.NotNil(t, SetResolver("dns.harbor.test", nil))
+	assert.NotNil(t, SetResolver("", map[string]string{"registry.harbor.test": "invalid"}))
+	// the settings are kept unchanged
+	assert.Equal(t, transport, GetHTTPTransport())
+}
@@ -0,0 +1,267 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// the default port of the SSH server on the jump host
+const defaultSSHPort = "22"
+
+// SSHTunnel is the SSH tunnel through the jump host, the connections to the registry which is only
+// reachable from the jump host, e.g. the one in the isolated network, are dialed through it
+type SSHTunnel struct {
+	// the address of the jump host, the port 22 is used if it's omitted
+	Host string `json:"host"`
+	// the user logging in to the jump host
+	User string `json:"user"`
+	// the PEM encoded private key authenticating the user
+	PrivateKey string `json:"private_key"`
+	// the public key of the jump host in the authorized_keys format, e.g. "ssh-ed25519 AAAA...",
+	// it's required as the jump host presenting any other key is rejected
+	HostKey string `json:"host_key"`
+}
+
+// Validate validates the settings of the tunnel, the keys are parsed as well
+func (s *SSHTunnel) Validate() error {
+	if len(s.Host) == 0 {
+		return errors.New("the host of the SSH tunnel cannot be empty")
+	}
+	if len(s.User) == 0 {
+		return errors.New("the user of the SSH tunnel cannot be empty")
+	}
+	if len(s.HostKey) == 0 {
+		return errors.New("the host key of the SSH tunnel cannot be empty")
+	}
+	_, err := s.clientConfig()
+	return err
+}
+
+// the address of the jump host with the port
+func (s *SSHTunnel) address() string {
+	if _, _, err := net.SplitHostPort(s.Host); err == nil {
+		return s.Host
+	}
+	return net.JoinHostPort(s.Host, defaultSSHPort)
+}
+
+func (s *SSHTunnel) clientConfig() (*ssh.ClientConfig, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(s.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key of the SSH tunnel: %v", err)
+	}
+	// the tunnel without the host key is never dialed, otherwise the jump host isn't authenticated
+	if len(s.HostKey) == 0 {
+		return nil, errors.New("the host key of the SSH tunnel cannot be empty")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key of the SSH tunnel: %v", err)
+	}
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}, nil
+}
+
+// the key identifying the tunnel, the private key is hashed rather than embedded in the key
+func (s *SSHTunnel) key() string {
+	return fmt.Sprintf("%s|%s|%x|%s", s.address(), s.User, sha256.Sum256([]byte(s.PrivateKey)), s.HostKey)
+}
+
+var (
+	// the transports dialing through the tunnels, keyed by the tunnel and the insecure flag. They're
+	// cached so the idle connections are reused by the clients of the same registry
+	tunnelTransports = map[string]*http.Transport{}
+	// the dialers of the tunnels keyed by the tunnel, the SSH connection to the jump host is shared
+	// by the secure and insecure transports of the same tunnel
+	tunnelDialers = map[string]*tunnelDialer{}
+	tunnelLock    sync.Mutex
+)
+
+// GetTunnelTransport returns the transport which dials the connections through the SSH tunnel, the
+// hostnames of the registries are resolved by the jump host and the proxy isn't used. The SSH connection
+// to the jump host is established when the first connection is dialed and shared by all the connections
+func GetTunnelTransport(tunnel *SSHTunnel, insecure bool) (*http.Transport, error) {
+	key := tunnel.key()
+	transportKey := fmt.Sprintf("%s|%v", key, insecure)
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	if transport, exist := tunnelTransports[transportKey]; exist {
+		return transport, nil
+	}
+	dialer, exist := tunnelDialers[key]
+	if !exist {
+		config, err := tunnel.clientConfig()
+		if err != nil {
+			return nil, err
+		}
+		dialer = &tunnelDialer{
+			address: tunnel.address(),
+			config:  config,
+		}
+		tunnelDialers[key] = dialer
+	}
+	transportLock.RLock()
+	handshakeTimeout := tlsHandshakeTimeout
+	transportLock.RUnlock()
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecure,
+		},
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: handshakeTimeout,
+		MaxIdleConnsPerHost: MaxIdleConnsPerHost,
+	}
+	tunnelTransports[transportKey] = transport
+	return transport, nil
+}
+
+// ReleaseTunnel removes the cached transports and dialer of the tunnel, closes their idle connections
+// and the SSH connection to the jump host. It's called when the tunnel is changed or removed, nothing is
+// released if the current tunnel is the same with the previous one
+func ReleaseTunnel(previous, current *SSHTunnel) {
+	if previous == nil {
+		return
+	}
+	key := previous.key()
+	if current != nil && current.key() == key {
+		return
+	}
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	for _, insecure := range []bool{true, false} {
+		transportKey := fmt.Sprintf("%s|%v", key, insecure)
+		if transport, exist := tunnelTransports[transportKey]; exist {
+			transport.CloseIdleConnections()
+			delete(tunnelTransports, transportKey)
+		}
+	}
+	if dialer, exist := tunnelDialers[key]; exist {
+		dialer.lock.Lock()
+		if dialer.client != nil {
+			dialer.client.Close()
+			dialer.client = nil
+		}
+		dialer.lock.Unlock()
+		delete(tunnelDialers, key)
+	}
+}
+
+// CheckTunnelWithContext establishes the SSH tunnel and dials the address through it, so the
+// failure of the tunnel is told from the one of the registry
+func CheckTunnelWithContext(ctx context.Context, tunnel *SSHTunnel, address string) error {
+	transport, err := GetTunnelTransport(tunnel, false)
+	if err != nil {
+		return err
+	}
+	conn, err := transport.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type tunnelDialer struct {
+	address string
+	config  *ssh.ClientConfig
+	lock    sync.Mutex
+	client  *ssh.Client
+}
+
+// DialContext dials the address from the jump host. The SSH connection to the jump host is
+// established at the first time and established again if it's broken
+func (t *tunnelDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, address)
+	if err == nil {
+		return conn, nil
+	}
+	// the jump host rejects to connect to the address, the SSH connection is fine
+	if _, rejected := err.(*ssh.OpenChannelError); rejected {
+		return nil, fmt.Errorf("failed to connect to %s from the jump host %s: %v", address, t.address, err)
+	}
+	// the SSH connection may be broken, e.g. closed by the jump host as it's idle
+	log.Debugf("failed to dial %s through the SSH tunnel %s, reconnect to the jump host: %v", address, t.address, err)
+	t.disconnect(client)
+	if client, err = t.connect(ctx); err != nil {
+		return nil, err
+	}
+	return client.Dial(network, address)
+}
+
+// connect returns the SSH connection to the jump host, it's established if it doesn't exist
+func (t *tunnelDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	transportLock.RLock()
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+		Resolver:  resolver,
+	}
+	handshakeTimeout := tlsHandshakeTimeout
+	hosts := staticHosts
+	transportLock.RUnlock()
+	conn, err := dialContext(dialer, hosts)(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the jump host %s: %v", t.address, err)
+	}
+	// the SSH handshake doesn't support the context, bound it by the deadline
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.address, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to establish the SSH tunnel through the jump host %s: %v", t.address, err)
+	}
+	conn.SetDeadline(time.Time{})
+	t.client = ssh.NewClient(c, chans, reqs)
+	log.Debugf("the SSH tunnel through the jump host %s is established", t.address)
+	return t.client, nil
+}
+
+// disconnect closes the SSH connection if it's still the current one
+func (t *tunnelDialer) disconnect(client *ssh.Client) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// generate the ECDSA key, the PEM encoded private key and the signer are returned
+func generateSSHKey(t *testing.T) (string, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), signer
+}
+
+// the mock jump host which forwards the "direct-tcpip" channels, the hostnames are resolved by the
+// mapping of it to verify that they're resolved by the jump host
+type mockJumpHost struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	hosts    map[string]string
+	lock     sync.Mutex
+	conns    []net.Conn
+}
+
+func newMockJumpHost(t *testing.T, user string, authorized ssh.PublicKey, hosts map[string]string) *mockJumpHost {
+	_, hostKey := generateSSHKey(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	m := &mockJumpHost{
+		listener: listener,
+		hostKey:  hostKey,
+		hosts:    hosts,
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == user && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			m.lock.Lock()
+			m.conns = append(m.conns, conn)
+			m.lock.Unlock()
+			go m.serve(conn, config)
+		}
+	}()
+	return m
+}
+
+func (m *mockJumpHost) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		msg := struct {
+			RAddr string
+			RPort uint32
+			LAddr string
+			LPort uint32
+		}{}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		host := msg.RAddr
+		if ip, exist := m.hosts[host]; exist {
+			host = ip
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(msg.RPort)))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+// break the SSH connections established
+func (m *mockJumpHost) disconnectAll() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+}
+
+func (m *mockJumpHost) Close() {
+	m.listener.Close()
+	m.disconnectAll()
+}
+
+func (m *mockJumpHost) publicHostKey() string {
+	return string(ssh.MarshalAuthorizedKey(m.hostKey.PublicKey()))
+}
+
+func TestSSHTunnelValidate(t *testing.T) {
+	privateKey, _ := generateSSHKey(t)
+	_, hostKey := generateSSHKey(t)
+	cases := []struct {
+		tunnel *SSHTunnel
+		valid  bool
+	}{
+		{&SSHTunnel{User: "harbor", PrivateKey: privateKey}, false},
+		{&SSHTunnel{Host: "jump.example.com", PrivateKey: privateKey}, false},
+		{&SSHTunnel{Host: "jump.example.com", User: "harbor", PrivateKey: "invalid"}, false},
+		{&SSHTunnel{Host: "jump.example.com", User: "harbor", PrivateKey: privateKey, HostKey: "invalid"}, false},
+		// the host key is required
+		{&SSHTunnel{Host: "jump.example.com", User: "harbor", PrivateKey: privateKey}, false},
+		{&SSHTunnel{Host: "jump.example.com:2222", User: "harbor", PrivateKey: privateKey,
+			HostKey: string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))}, true},
+	}
+	for i, c := range cases {
+		err := c.tunnel.Validate()
+		assert.Equal(t, c.valid, err == nil, "case %d: %v", i, err)
+	}
+
+	assert.Equal(t, "jump.example.com:22", (&SSHTunnel{Host: "jump.example.com"}).address())
+	assert.Equal(t, "[::1]:22", (&SSHTunnel{Host: "::1"}).address())
+	assert.Equal(t, "jump.example.com:2222", (&SSHTunnel{Host: "jump.example.com:2222"}).address())
+}
+
+func TestGetTunnelTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.Nil(t, err)
+	// the hostname of the registry is only resolvable by the jump host
+	endpoint := "http://registry.isolated:" + port
+
+	privateKey, signer := generateSSHKey(t)
+	jumpHost := newMockJumpHost(t, "harbor", signer.PublicKey(), map[string]string{"registry.isolated": "127.0.0.1"})
+	defer jumpHost.Close()
+	tunnel := &SSHTunnel{
+		Host:       jumpHost.listener.Addr().String(),
+		User:       "harbor",
+		PrivateKey: privateKey,
+		HostKey:    jumpHost.publicHostKey(),
+	}
+
+	transport, err := GetTunnelTransport(tunnel, false)
+	require.Nil(t, err)
+	// the transport is shared by the clients of the same tunnel
+	transport2, err := GetTunnelTransport(tunnel, false)
+	require.Nil(t, err)
+	assert.True(t, transport == transport2)
+
+	reg, err := NewRegistry(endpoint, &http.Client{Transport: transport})
+	require.Nil(t, err)
+	require.Nil(t, reg.Ping())
+
+	// the SSH connection is established again once it's broken
+	transport.CloseIdleConnections()
+	jumpHost.disconnectAll()
+	require.Nil(t, reg.Ping())
+
+	// the tunnel is checked
+	ctx := context.Background()
+	assert.Nil(t, CheckTunnelWithContext(ctx, tunnel, "registry.isolated:"+port))
+	// the jump host cannot connect to the address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	closed := listener.Addr().String()
+	listener.Close()
+	err = CheckTunnelWithContext(ctx, tunnel, closed)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "from the jump host")
+
+	// the host key doesn't match
+	_, otherKey := generateSSHKey(t)
+	mismatched := *tunnel
+	mismatched.HostKey = string(ssh.MarshalAuthorizedKey(otherKey.PublicKey()))
+	err = CheckTunnelWithContext(ctx, &mismatched, "registry.isolated:"+port)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to establish the SSH tunnel")
+
+	// the key isn't authorized by the jump host
+	unauthorized := *tunnel
+	unauthorized.PrivateKey, _ = generateSSHKey(t)
+	err = CheckTunnelWithContext(ctx, &unauthorized, "registry.isolated:"+port)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to establish the SSH tunnel")
+
+	// the jump host isn't reachable
+	unreachable := *tunnel
+	unreachable.Host = closed
+	err = CheckTunnelWithContext(ctx, &unreachable, "registry.isolated:"+port)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to the jump host")
+
+	// nothing is released if the tunnel isn't changed
+	ReleaseTunnel(tunnel, tunnel)
+	transport2, err = GetTunnelTransport(tunnel, false)
+	require.Nil(t, err)
+	assert.True(t, transport == transport2)
+	// the transport and the SSH connection of the changed tunnel are released
+	ReleaseTunnel(tunnel, &mismatched)
+	tunnelLock.Lock()
+	_, exist := tunnelDialers[tunnel.key()]
+	tunnelLock.Unlock()
+	assert.False(t, exist)
+	transport2, err = GetTunnelTransport(tunnel, false)
+	require.Nil(t, err)
+	assert.False(t, transport == transport2)
+	// the removed tunnel is released
+	ReleaseTunnel(tunnel, nil)
+	tunnelLock.Lock()
+	_, exist = tunnelTransports[tunnel.key()+"|false"]
+	tunnelLock.Unlock()
+	assert.False(t, exist)
+	ReleaseTunnel(nil, tunnel)
+}
@@ -0,0 +1,67 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// WarmUp establishes the connections to the registry through the transport before they're needed,
+// so the first requests of the replication don't suffer the latency of connecting and TLS handshake.
+// The requests to the "/v2/" API are sent concurrently and all the responses are held until every
+// request is finished, which makes every request use a distinct connection. The connections are
+// then kept alive in the idle pool of the transport and reused by the subsequent requests. The
+// count of the connections established is returned, the error is returned if none is established
+func WarmUp(ctx context.Context, transport http.RoundTripper, endpoint string, count int) (int, error) {
+	client := &http.Client{Transport: transport}
+	url := buildPingURL(endpoint)
+	responses := make([]*http.Response, count)
+	errs := make([]error, count)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			responses[i], errs[i] = client.Do(req.WithContext(ctx))
+		}(i)
+	}
+	wg.Wait()
+
+	established := 0
+	var err error
+	for i, resp := range responses {
+		if resp == nil {
+			err = parseError(errs[i])
+			continue
+		}
+		// the connection is put back to the idle pool only when the body is read to the end
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		established++
+	}
+	if established == 0 && err != nil {
+		return 0, err
+	}
+	return established, nil
+}
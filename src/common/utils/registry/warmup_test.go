@@ -0,0 +1,83 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUp(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	transport := &http.Transport{MaxIdleConnsPerHost: MaxIdleConnsPerHost}
+	defer transport.CloseIdleConnections()
+	established, err := WarmUp(context.Background(), transport, server.URL, 5)
+	require.Nil(t, err)
+	assert.Equal(t, 5, established)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&connections))
+
+	// the warmed connections are reused by the subsequent concurrent requests
+	client := &http.Client{Transport: transport}
+	responses := make([]*http.Response, 5)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get(server.URL + "/v2/")
+			if err == nil {
+				responses[i] = resp
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, resp := range responses {
+		require.NotNil(t, resp)
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(&connections))
+}
+
+func TestWarmUpUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	established, err := WarmUp(context.Background(), &http.Transport{}, url, 3)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, established)
+}
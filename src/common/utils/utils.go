@@ -38,7 +38,7 @@ func ParseEndpoint(endpoint string) (*url.URL, error) {
 	}
 	i := strings.Index(endpoint, "://")
 	if i >= 0 {
-		scheme := endpoint[:i]
+		scheme := strings.ToLower(endpoint[:i])
 		if scheme != "http" && scheme != "https" {
 			return nil, fmt.Errorf("invalid scheme: %s", scheme)
 		}
@@ -46,7 +46,44 @@ func ParseEndpoint(endpoint string) (*url.URL, error) {
 		endpoint = "http://" + endpoint
 	}
 
-	return url.ParseRequestURI(endpoint)
+	u, err := url.ParseRequestURI(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("empty host in URL: %s", endpoint)
+	}
+	// the registries may listen on non-standard ports, e.g. 5000
+	if port := u.Port(); len(port) > 0 {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", port)
+		}
+	}
+	return u, nil
+}
+
+// CanonicalizeEndpoint returns the canonical form of the endpoint, so the equivalent endpoints
+// are the same string: the scheme and host are lower-cased, the default port of the scheme is
+// dropped and the trailing slashes are stripped. The user info, query and fragment are dropped
+func CanonicalizeEndpoint(endpoint string) (string, error) {
+	u, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return "", err
+	}
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		// IPv6 address
+		host = "[" + host + "]"
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if len(port) > 0 {
+		host = host + ":" + port
+	}
+	return u.Scheme + "://" + host + strings.TrimRight(u.Path, "/"), nil
 }
 
 // ParseRepository splits a repository into two parts: project and rest
@@ -15,7 +15,11 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"errors"
 	"github.com/ghodss/yaml"
@@ -74,6 +78,40 @@ func (b *BaseController) WriteJSONData(object interface{}) {
 	b.ServeJSON()
 }
 
+// WriteJSONDataWithETag writes the JSON data to the client with the ETag computed from the data.
+// The 304 Not Modified is returned instead if the ETag matches the "If-None-Match" header, so the
+// polling clients needn't download the unchanged data again
+func (b *BaseController) WriteJSONDataWithETag(object interface{}) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		b.SendInternalServerError(err)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+
+	w := b.Ctx.ResponseWriter
+	w.Header().Set("ETag", etag)
+	if etagMatches(b.Ctx.Request.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// returns whether the ETag matches one of the ETags in the "If-None-Match" header,
+// the weak comparison is used as the header is only used by the GET requests
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // WriteYamlData writes the yaml data to the client.
 func (b *BaseController) WriteYamlData(object interface{}) {
 	yData, err := yaml.Marshal(object)
@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 
 	"github.com/astaxie/beego"
 	"github.com/dghubble/sling"
@@ -40,6 +41,7 @@ import (
 	"github.com/goharbor/harbor/src/core/config"
 	"github.com/goharbor/harbor/src/core/filter"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/registry"
 	"github.com/goharbor/harbor/tests/apitests/apilib"
 )
 
@@ -125,7 +127,21 @@ func init() {
 	beego.Router("/api/repositories/top", &RepositoryAPI{}, "get:GetTopRepos")
 	beego.Router("/api/registries", &RegistryAPI{}, "get:List;post:Post")
 	beego.Router("/api/registries/ping", &RegistryAPI{}, "post:Ping")
-	beego.Router("/api/registries/:id([0-9]+)", &RegistryAPI{}, "get:Get;put:Put;delete:Delete")
+	beego.Router("/api/registries/ping/batch", &RegistryAPI{}, "post:PingBatch")
+	beego.Router("/api/registries/export", &RegistryAPI{}, "get:Export")
+	beego.Router("/api/registries/import", &RegistryAPI{}, "post:Import")
+	beego.Router("/api/registries/permitted", &PermittedRegistryAPI{}, "get:List")
+	beego.Router("/api/registries/default", &PermittedRegistryAPI{}, "get:GetDefault")
+	beego.Router("/api/registries/:id([0-9]+)", &RegistryAPI{}, "get:Get;put:Put;patch:Patch;delete:Delete")
+	beego.Router("/api/registries/:id([0-9]+)/reset-breaker", &RegistryAPI{}, "post:ResetBreaker")
+	beego.Router("/api/registries/:id([0-9]+)/warmup", &RegistryAPI{}, "post:WarmUp;get:GetWarmup")
+	beego.Router("/api/registries/:id([0-9]+)/capabilities", &RegistryAPI{}, "get:GetCapabilities")
+	beego.Router("/api/registries/:id([0-9]+)/repositories", &RegistryAPI{}, "get:ListRepositories")
+	beego.Router("/api/registries/:id/repositories/*/tags/:tag", &RegistryAPI{}, "delete:DeleteTag")
+	beego.Router("/api/jobs/config", &JobConfigAPI{}, "get:Get")
+	beego.Router("/api/jobs/config/reload", &JobConfigAPI{}, "post:Reload")
+	beego.Router("/api/jobs/maintenance", &JobMaintenanceAPI{}, "get:Get;post:Post")
+	beego.Router("/api/jobs/replication/:id([0-9]+)/log", &ReplicationOperationAPI{}, "get:GetJobLog")
 	beego.Router("/api/systeminfo", &SystemInfoAPI{}, "get:GetGeneralInfo")
 	beego.Router("/api/systeminfo/volumes", &SystemInfoAPI{}, "get:GetVolumeInfo")
 	beego.Router("/api/systeminfo/getcert", &SystemInfoAPI{}, "get:GetCert")
@@ -150,11 +166,23 @@ func init() {
 
 	beego.Router("/api/replication/adapters", &ReplicationAdapterAPI{}, "get:List")
 	beego.Router("/api/replication/executions", &ReplicationOperationAPI{}, "get:ListExecutions;post:CreateExecution")
+	beego.Router("/api/replication/executions/actions", &ReplicationOperationAPI{}, "post:ExecuteAction")
+	beego.Router("/api/replication/executions/single", &ReplicationOperationAPI{}, "post:CreateSingleExecution")
 	beego.Router("/api/replication/executions/:id([0-9]+)", &ReplicationOperationAPI{}, "get:GetExecution;put:StopExecution")
+	beego.Router("/api/replication/executions/:id([0-9]+)/events", &ReplicationOperationAPI{}, "get:StreamExecutionEvents")
+	beego.Router("/api/replication/executions/:id([0-9]+)/retry", &ReplicationOperationAPI{}, "post:RetryExecution")
 	beego.Router("/api/replication/executions/:id([0-9]+)/tasks", &ReplicationOperationAPI{}, "get:ListTasks")
 	beego.Router("/api/replication/executions/:id([0-9]+)/tasks/:tid([0-9]+)/log", &ReplicationOperationAPI{}, "get:GetTaskLog")
+	beego.Router("/api/replication/tasks", &ReplicationOperationAPI{}, "get:ListAllTasks")
+	beego.Router("/api/replication/tasks/report.csv", &ReplicationOperationAPI{}, "get:ExportTasksReport")
+	beego.Router("/api/replication/deadletters", &ReplicationOperationAPI{}, "get:ListDeadLetters")
+	beego.Router("/api/replication/deadletters/:id([0-9]+)/requeue", &ReplicationOperationAPI{}, "post:RequeueDeadLetter")
+	beego.Router("/api/replication/schedule", &ReplicationOperationAPI{}, "get:ListSchedule")
+	beego.Router("/api/replication/exclusions", &ReplicationExclusionAPI{}, "get:List;post:Create")
+	beego.Router("/api/replication/exclusions/:id([0-9]+)", &ReplicationExclusionAPI{}, "delete:Delete")
 
 	beego.Router("/api/replication/policies", &ReplicationPolicyAPI{}, "get:List;post:Create")
+	beego.Router("/api/replication/policies/preview", &ReplicationPolicyAPI{}, "post:Preview")
 	beego.Router("/api/replication/policies/:id([0-9]+)", &ReplicationPolicyAPI{}, "get:Get;put:Update;delete:Delete")
 
 	// Charts are controlled under projects
@@ -194,10 +222,15 @@ func init() {
 }
 
 func request(_sling *sling.Sling, acceptHeader string, authInfo ...usrInfo) (int, []byte, error) {
+	code, _, body, err := requestWithHeader(_sling, acceptHeader, authInfo...)
+	return code, body, err
+}
+
+func requestWithHeader(_sling *sling.Sling, acceptHeader string, authInfo ...usrInfo) (int, http.Header, []byte, error) {
 	_sling = _sling.Set("Accept", acceptHeader)
 	req, err := _sling.Request()
 	if err != nil {
-		return 400, nil, err
+		return 400, nil, nil, err
 	}
 	if len(authInfo) > 0 {
 		req.SetBasicAuth(authInfo[0].Name, authInfo[0].Passwd)
@@ -205,7 +238,7 @@ func request(_sling *sling.Sling, acceptHeader string, authInfo ...usrInfo) (int
 	w := httptest.NewRecorder()
 	beego.BeeApp.Handlers.ServeHTTP(w, req)
 	body, err := ioutil.ReadAll(w.Body)
-	return w.Code, body, err
+	return w.Code, w.Header(), body, err
 }
 
 // Search for projects and repositories
@@ -1176,14 +1209,24 @@ func (a testapi) RegistryCreate(authInfo usrInfo, registry *model.Registry) (int
 	return code, err
 }
 
+// RegistryCreateWithWarnings creates the registry and returns the warnings in the response
+func (a testapi) RegistryCreateWithWarnings(authInfo usrInfo, registry *model.Registry) ([]string, int, error) {
+	_sling := sling.New().Base(a.basePath).Post("/api/registries").BodyJSON(registry)
+	code, header, _, err := requestWithHeader(_sling, jsonAcceptHeader, authInfo)
+	return header["Warning"], code, err
+}
+
 type pingReq struct {
-	ID             *int64  `json:"id"`
-	Type           *string `json:"type"`
-	URL            *string `json:"url"`
-	CredentialType *string `json:"credential_type"`
-	AccessKey      *string `json:"access_key"`
-	AccessSecret   *string `json:"access_secret"`
-	Insecure       *bool   `json:"insecure"`
+	ID              *int64   `json:"id"`
+	Type            *string  `json:"type"`
+	URL             *string  `json:"url"`
+	CredentialType  *string  `json:"credential_type"`
+	AccessKey       *string  `json:"access_key"`
+	AccessSecret    *string  `json:"access_secret"`
+	Insecure        *bool    `json:"insecure"`
+	PushRepository  *string  `json:"push_repository"`
+	FailOnClockSkew *bool    `json:"fail_on_clock_skew"`
+	FailoverURLs    []string `json:"failover_urls"`
 }
 
 func (a testapi) RegistryPing(authInfo usrInfo, registry *pingReq) (int, error) {
@@ -1192,6 +1235,139 @@ func (a testapi) RegistryPing(authInfo usrInfo, registry *pingReq) (int, error)
 	return code, err
 }
 
+func (a testapi) RegistryPingWithResult(authInfo usrInfo, req *pingReq, fresh bool) (*registry.PingResult, int, error) {
+	path := "/api/registries/ping"
+	if fresh {
+		path += "?fresh=true"
+	}
+	_sling := sling.New().Base(a.basePath).Post(path).BodyJSON(req)
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	result := &registry.PingResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, code, err
+	}
+	return result, code, nil
+}
+
+func (a testapi) RegistryPingBatch(authInfo usrInfo, registries []*pingReq) ([]*registry.PingResult, int, error) {
+	_sling := sling.New().Base(a.basePath).Post("/api/registries/ping/batch").BodyJSON(registries)
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	results := []*registry.PingResult{}
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, code, err
+	}
+	return results, code, nil
+}
+
+func (a testapi) RegistryResetBreaker(authInfo usrInfo, registryID int64) (int, error) {
+	_sling := sling.New().Base(a.basePath).Post(fmt.Sprintf("/api/registries/%d/reset-breaker", registryID))
+	code, _, err := request(_sling, jsonAcceptHeader, authInfo)
+	return code, err
+}
+
+func (a testapi) RegistryWarmUp(authInfo usrInfo, registryID int64, req interface{}) (*model.WarmupStatus, int, error) {
+	_sling := sling.New().Base(a.basePath).Post(fmt.Sprintf("/api/registries/%d/warmup", registryID))
+	if req != nil {
+		_sling = _sling.BodyJSON(req)
+	}
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	status := &model.WarmupStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, code, err
+	}
+	return status, code, nil
+}
+
+func (a testapi) RegistryGetWarmup(authInfo usrInfo, registryID int64) (*model.WarmupStatus, int, error) {
+	_sling := sling.New().Base(a.basePath).Get(fmt.Sprintf("/api/registries/%d/warmup", registryID))
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	status := &model.WarmupStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, code, err
+	}
+	return status, code, nil
+}
+
+func (a testapi) RegistryGetCapabilities(authInfo usrInfo, registryID int64) (map[string]string, int, error) {
+	_sling := sling.New().Base(a.basePath).Get(fmt.Sprintf("/api/registries/%d/capabilities", registryID))
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+	capabilities := map[string]string{}
+	if err := json.Unmarshal(body, &capabilities); err != nil {
+		return nil, code, err
+	}
+	return capabilities, code, nil
+}
+
+func (a testapi) RegistryListRepositories(authInfo usrInfo, registryID int64) ([]string, int, error) {
+	_sling := sling.New().Base(a.basePath).Get(fmt.Sprintf("/api/registries/%d/repositories", registryID))
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+	repositories := []string{}
+	if err := json.Unmarshal(body, &repositories); err != nil {
+		return nil, code, err
+	}
+	return repositories, code, nil
+}
+
+func (a testapi) RegistryDeleteTag(authInfo usrInfo, registryID int64, repository, tag string, force ...bool) (int, error) {
+	path := fmt.Sprintf("/api/registries/%d/repositories/%s/tags/%s", registryID, repository, tag)
+	if len(force) > 0 && force[0] {
+		path += "?force=true"
+	}
+	_sling := sling.New().Base(a.basePath).Delete(path)
+	code, _, err := request(_sling, jsonAcceptHeader, authInfo)
+	return code, err
+}
+
+func (a testapi) RegistryExport(authInfo usrInfo) (*registry.ExportDocument, int, error) {
+	_sling := sling.New().Base(a.basePath).Get("/api/registries/export")
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	doc := &registry.ExportDocument{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return nil, code, err
+	}
+	return doc, code, nil
+}
+
+func (a testapi) RegistryImport(authInfo usrInfo, doc *registry.ExportDocument, overwrite bool) (*registry.ImportResult, int, error) {
+	_sling := sling.New().Base(a.basePath).Post(fmt.Sprintf("/api/registries/import?overwrite=%t", overwrite)).BodyJSON(doc)
+	code, body, err := request(_sling, jsonAcceptHeader, authInfo)
+	if err != nil || code != http.StatusOK {
+		return nil, code, err
+	}
+
+	result := &registry.ImportResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, code, err
+	}
+	return result, code, nil
+}
+
 func (a testapi) RegistryDelete(authInfo usrInfo, registryID int64) (int, error) {
 	_sling := sling.New().Base(a.basePath).Delete(fmt.Sprintf("/api/registries/%d", registryID))
 	code, _, err := request(_sling, jsonAcceptHeader, authInfo)
@@ -1202,6 +1378,20 @@ func (a testapi) RegistryDelete(authInfo usrInfo, registryID int64) (int, error)
 	return code, nil
 }
 
+func (a testapi) RegistryPatch(authInfo usrInfo, registryID int64, contentType, patch string) (int, error) {
+	_sling := sling.New().Base(a.basePath).Patch(fmt.Sprintf("/api/registries/%d", registryID)).
+		Set("Content-Type", contentType).Body(strings.NewReader(patch))
+	code, _, err := request(_sling, jsonAcceptHeader, authInfo)
+	return code, err
+}
+
+// RegistryUpdateWithWarnings updates the registry and returns the warnings in the response
+func (a testapi) RegistryUpdateWithWarnings(authInfo usrInfo, registryID int64, req *apimodels.RegistryUpdateRequest) ([]string, int, error) {
+	_sling := sling.New().Base(a.basePath).Put(fmt.Sprintf("/api/registries/%d", registryID)).BodyJSON(req)
+	code, header, _, err := requestWithHeader(_sling, jsonAcceptHeader, authInfo)
+	return header["Warning"], code, err
+}
+
 func (a testapi) RegistryUpdate(authInfo usrInfo, registryID int64, req *apimodels.RegistryUpdateRequest) (int, error) {
 	_sling := sling.New().Base(a.basePath).Put(fmt.Sprintf("/api/registries/%d", registryID)).BodyJSON(req)
 	code, _, err := request(_sling, jsonAcceptHeader, authInfo)
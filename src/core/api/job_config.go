@@ -0,0 +1,61 @@
+// Copyright 2018 Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goharbor/harbor/src/core/utils"
+)
+
+// JobConfigAPI handles request to /api/jobs/config and /api/jobs/config/reload
+type JobConfigAPI struct {
+	BaseController
+}
+
+// Prepare validates that the user is system admin
+func (j *JobConfigAPI) Prepare() {
+	j.BaseController.Prepare()
+	if !j.SecurityCtx.IsAuthenticated() {
+		j.SendUnAuthorizedError(errors.New("UnAuthorized"))
+		return
+	}
+	if !j.SecurityCtx.IsSysAdmin() {
+		j.SendForbiddenError(errors.New(j.SecurityCtx.GetUsername()))
+		return
+	}
+}
+
+// Get returns the non-secret configurations in effect of jobservice
+func (j *JobConfigAPI) Get() {
+	settings, err := utils.GetJobServiceClient().GetConfig()
+	if err != nil {
+		j.ParseAndHandleError(fmt.Sprintf("failed to get the configurations of jobservice: %v", err), err)
+		return
+	}
+	j.WriteJSONData(settings)
+}
+
+// Reload reloads the hot-reloadable configurations of jobservice, the configurations
+// in effect after reloading are returned
+func (j *JobConfigAPI) Reload() {
+	settings, err := utils.GetJobServiceClient().ReloadConfig()
+	if err != nil {
+		j.ParseAndHandleError(fmt.Sprintf("failed to reload the configurations of jobservice: %v", err), err)
+		return
+	}
+	j.WriteJSONData(settings)
+}
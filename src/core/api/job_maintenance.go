@@ -0,0 +1,67 @@
+// Copyright 2018 Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goharbor/harbor/src/core/utils"
+	"github.com/goharbor/harbor/src/jobservice/job"
+)
+
+// JobMaintenanceAPI handles request to /api/jobs/maintenance
+type JobMaintenanceAPI struct {
+	BaseController
+}
+
+// Prepare validates that the user is system admin
+func (j *JobMaintenanceAPI) Prepare() {
+	j.BaseController.Prepare()
+	if !j.SecurityCtx.IsAuthenticated() {
+		j.SendUnAuthorizedError(errors.New("UnAuthorized"))
+		return
+	}
+	if !j.SecurityCtx.IsSysAdmin() {
+		j.SendForbiddenError(errors.New(j.SecurityCtx.GetUsername()))
+		return
+	}
+}
+
+// Get returns whether the maintenance mode of jobservice is enabled
+func (j *JobMaintenanceAPI) Get() {
+	maintenance, err := utils.GetJobServiceClient().GetMaintenance()
+	if err != nil {
+		j.ParseAndHandleError(fmt.Sprintf("failed to get the maintenance mode of jobservice: %v", err), err)
+		return
+	}
+	j.WriteJSONData(maintenance)
+}
+
+// Post enables or disables the maintenance mode of jobservice, the new jobs are rejected
+// by jobservice when it's enabled while the running jobs and the status queries aren't affected
+func (j *JobMaintenanceAPI) Post() {
+	maintenance := &job.Maintenance{}
+	if err := j.DecodeJSONReq(maintenance); err != nil {
+		j.SendBadRequestError(err)
+		return
+	}
+	maintenance, err := utils.GetJobServiceClient().SetMaintenance(maintenance.Enabled)
+	if err != nil {
+		j.ParseAndHandleError(fmt.Sprintf("failed to set the maintenance mode of jobservice: %v", err), err)
+		return
+	}
+	j.WriteJSONData(maintenance)
+}
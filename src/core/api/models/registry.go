@@ -1,5 +1,14 @@
 package models
 
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
 // RegistryUpdateRequest is request used to update a registry.
 type RegistryUpdateRequest struct {
 	Name           *string `json:"name"`
@@ -9,4 +18,63 @@ type RegistryUpdateRequest struct {
 	AccessKey      *string `json:"access_key"`
 	AccessSecret   *string `json:"access_secret"`
 	Insecure       *bool   `json:"insecure"`
+	UserAgent      *string `json:"user_agent"`
+	MaxConnections *int    `json:"max_connections"`
+	// the days the finished replication jobs to the registry are kept, zero means forever
+	JobRetentionDays *int `json:"job_retention_days"`
+	// the draining registry isn't assigned new replication jobs
+	Draining *bool `json:"draining"`
+	// the default registry is pre-selected when creating the policies, the previous default is cleared
+	Default *bool `json:"default"`
+	// the IDs or names of the projects, empty means all the projects are allowed
+	AllowedProjects *[]string `json:"allowed_projects"`
+	// the time ranges in which the replication jobs to the registry are deferred
+	BlackoutWindows *[]*model.BlackoutWindow `json:"blackout_windows"`
+	// transforms the names of the repositories replicated to the registry
+	PathTransform *model.PathTransform `json:"path_transform"`
+	// the structured tags of the registry, e.g. "region:eu"
+	Labels *[]string `json:"labels"`
+	// the manifest type which the images are converted to when replicated, "docker" or "oci"
+	PreferredManifestType *string `json:"preferred_manifest_type"`
+	// the custom headers added to every request sent to the registry
+	Headers *map[string]string `json:"headers"`
+	// the URLs of the equivalent endpoints which are failed over to in order
+	FailoverURLs *[]string `json:"failover_urls"`
+	// the allowed and denied media types of the layers replicated to the registry
+	LayerMediaTypes *model.LayerMediaTypes `json:"layer_media_types"`
+	// the count of the connections warmed up before replicating to the registry
+	WarmupConnections *int `json:"warmup_connections"`
+	// the IANA time zone name which the blackout windows are interpreted in
+	Timezone *string `json:"timezone"`
+	// the SSH tunnel through the jump host, the current private key is kept if it's empty
+	SSHTunnel *registry_pkg.SSHTunnel `json:"ssh_tunnel"`
+}
+
+// RegistryPatch is the JSON merge patch(RFC 7396) used to update a registry. The fields
+// omitted are nil in the embedded request and the ones set to null are listed in "Nulls"
+type RegistryPatch struct {
+	RegistryUpdateRequest
+	// the names of the fields set to null
+	Nulls []string
+}
+
+// UnmarshalJSON populates the patch with the JSON data, the unknown fields are rejected
+func (r *RegistryPatch) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&r.RegistryUpdateRequest); err != nil {
+		return err
+	}
+	r.Nulls = []string{}
+	for name, value := range fields {
+		if string(bytes.TrimSpace(value)) == "null" {
+			r.Nulls = append(r.Nulls, name)
+		}
+	}
+	sort.Strings(r.Nulls)
+	return nil
 }
@@ -0,0 +1,50 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalRegistryPatch(t *testing.T) {
+	// omitted fields
+	patch := &RegistryPatch{}
+	require.Nil(t, json.Unmarshal([]byte(`{"description": "foo"}`), patch))
+	require.NotNil(t, patch.Description)
+	assert.Equal(t, "foo", *patch.Description)
+	assert.Nil(t, patch.UserAgent)
+	assert.Equal(t, 0, len(patch.Nulls))
+
+	// null fields
+	patch = &RegistryPatch{}
+	require.Nil(t, json.Unmarshal([]byte(`{"user_agent": null, "allowed_projects": null, "insecure": true}`), patch))
+	assert.Nil(t, patch.UserAgent)
+	assert.Nil(t, patch.AllowedProjects)
+	require.NotNil(t, patch.Insecure)
+	assert.True(t, *patch.Insecure)
+	assert.Equal(t, []string{"allowed_projects", "user_agent"}, patch.Nulls)
+
+	// unknown fields
+	patch = &RegistryPatch{}
+	assert.NotNil(t, json.Unmarshal([]byte(`{"unknown": null}`), patch))
+
+	// not an object
+	patch = &RegistryPatch{}
+	assert.NotNil(t, json.Unmarshal([]byte(`["description"]`), patch))
+}
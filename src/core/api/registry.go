@@ -1,16 +1,21 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	common_api "github.com/goharbor/harbor/src/common/api"
 	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils"
 	"github.com/goharbor/harbor/src/common/utils/log"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/core/api/models"
+	utils_core "github.com/goharbor/harbor/src/core/utils"
 	"github.com/goharbor/harbor/src/replication"
 	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/event"
@@ -19,6 +24,21 @@ import (
 	"github.com/goharbor/harbor/src/replication/registry"
 )
 
+// passphraseHeader is the header carrying the passphrase used to encrypt/decrypt the
+// credentials when exporting/importing registries
+const passphraseHeader = "X-Passphrase"
+
+// maxBatchPingSize is the max count of registries pinged in one batch
+const maxBatchPingSize = 100
+
+// maxBatchRequestBodySize is the max size in bytes of the body of the requests carrying a batch of
+// registries, i.e. the batch ping and the import. It's larger than the default limit of the request
+// body as the registries may carry the certificates, the larger one of them is used
+const maxBatchRequestBodySize int64 = 10 << 20
+
+// mergePatchMediaType is the content type of the JSON merge patch request
+const mergePatchMediaType = "application/merge-patch+json"
+
 // RegistryAPI handles requests to /api/registries/{}. It manages registries integrated to Harbor.
 type RegistryAPI struct {
 	BaseController
@@ -43,45 +63,72 @@ func (t *RegistryAPI) Prepare() {
 	t.policyCtl = replication.PolicyCtl
 }
 
-// Ping checks health status of a registry
-func (t *RegistryAPI) Ping() {
-	req := struct {
-		ID             *int64  `json:"id"`
-		Type           *string `json:"type"`
-		URL            *string `json:"url"`
-		CredentialType *string `json:"credential_type"`
-		AccessKey      *string `json:"access_key"`
-		AccessSecret   *string `json:"access_secret"`
-		Insecure       *bool   `json:"insecure"`
-	}{}
-	t.DecodeJSONReq(&req)
+// pingRequest specifies the registry to ping. The registry can be specified by the ID or URL, if the ID
+// is provided, the registry is loaded by the ID and the other provided properties override the loaded ones
+type pingRequest struct {
+	ID             *int64  `json:"id"`
+	Type           *string `json:"type"`
+	URL            *string `json:"url"`
+	CredentialType *string `json:"credential_type"`
+	AccessKey      *string `json:"access_key"`
+	AccessSecret   *string `json:"access_secret"`
+	Insecure       *bool   `json:"insecure"`
+	UserAgent      *string `json:"user_agent"`
+	// the custom headers added to every request sent to the registry
+	Headers *map[string]string `json:"headers"`
+	// the URLs of the equivalent endpoints which are failed over to in order
+	FailoverURLs *[]string `json:"failover_urls"`
+	// the repository which the credential is validated to have the permission to push to
+	PushRepository *string `json:"push_repository"`
+	// whether the ping fails when the clock skew between the registry and Harbor exceeds the max one,
+	// only the warning is returned by default
+	FailOnClockSkew *bool `json:"fail_on_clock_skew"`
+	// the SSH tunnel through the jump host, the private key of the registry is used if it's empty
+	SSHTunnel *registry_pkg.SSHTunnel `json:"ssh_tunnel"`
+}
 
+// registryToPing builds the registry specified by the ping request, the returned error
+// carries the HTTP status code
+func (t *RegistryAPI) registryToPing(req *pingRequest) (*model.Registry, *common_http.Error) {
 	reg := &model.Registry{}
 	var err error
 	if req.ID != nil {
+		if *req.ID <= 0 {
+			return nil, &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("invalid registry ID %d", *req.ID),
+			}
+		}
 		reg, err = t.manager.Get(*req.ID)
 		if err != nil {
-			t.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", *req.ID, err))
-			return
+			return nil, &common_http.Error{
+				Code:    http.StatusInternalServerError,
+				Message: fmt.Sprintf("failed to get registry %d: %v", *req.ID, err),
+			}
 		}
 
 		if reg == nil {
-			t.SendNotFoundError(fmt.Errorf("registry %d not found", *req.ID))
-			return
+			return nil, &common_http.Error{
+				Code:    http.StatusNotFound,
+				Message: fmt.Sprintf("registry %d not found", *req.ID),
+			}
 		}
 	}
 	if req.Type != nil {
 		reg.Type = model.RegistryType(*req.Type)
 	}
 	if req.URL != nil {
-		url, err := utils.ParseEndpoint(*req.URL)
+		url, err := utils.CanonicalizeEndpoint(*req.URL)
 		if err != nil {
-			t.SendBadRequestError(err)
-			return
+			return nil, &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
 		}
 
 		// Prevent SSRF security issue #3755
-		reg.URL = url.Scheme + "://" + url.Host + url.Path
+		reg.URL = url
+		plaintextWarning(reg.URL)
 	}
 	if req.CredentialType != nil {
 		if reg.Credential == nil {
@@ -104,30 +151,339 @@ func (t *RegistryAPI) Ping() {
 	if req.Insecure != nil {
 		reg.Insecure = *req.Insecure
 	}
+	if req.UserAgent != nil {
+		reg.UserAgent = *req.UserAgent
+	}
+	if req.Headers != nil {
+		if err := model.ValidateHeaders(*req.Headers); err != nil {
+			return nil, &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+		reg.Headers = *req.Headers
+	}
 	if len(reg.Type) == 0 || len(reg.URL) == 0 {
-		t.SendBadRequestError(errors.New("type or url cannot be empty"))
-		return
+		return nil, &common_http.Error{
+			Code:    http.StatusBadRequest,
+			Message: "type or url cannot be empty",
+		}
 	}
+	if req.FailoverURLs != nil {
+		// Prevent SSRF security issue #3755
+		urls, err := model.NormalizeFailoverURLs(reg.URL, *req.FailoverURLs)
+		if err != nil {
+			return nil, &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+		reg.FailoverURLs = urls
+	}
+	if req.SSHTunnel != nil {
+		reg.SSHTunnel = mergeSSHTunnel(reg.SSHTunnel, req.SSHTunnel)
+		if err := reg.SSHTunnel.Validate(); err != nil {
+			return nil, &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+	}
+	return reg, nil
+}
 
-	status, err := registry.CheckHealthStatus(reg)
+// mergeSSHTunnel returns the SSH tunnel of the request, the current private key is kept
+// if the one of the request is empty as it's hidden when the registry is retrieved
+func mergeSSHTunnel(current, requested *registry_pkg.SSHTunnel) *registry_pkg.SSHTunnel {
+	tunnel := *requested
+	if len(tunnel.PrivateKey) == 0 && current != nil {
+		tunnel.PrivateKey = current.PrivateKey
+	}
+	return &tunnel
+}
+
+// Ping checks health status of a registry. The registry can be specified by the ID or URL, if the ID
+// is provided, the registry is loaded by the ID and the other provided properties override the loaded ones.
+// The outcome of pinging the registry specified only by the ID is cached for a short time and returned for
+// the rapid repeated pings, the query parameter "fresh=true" bypasses the cache
+func (t *RegistryAPI) Ping() {
+	req := &pingRequest{}
+	if err := t.DecodeJSONReq(req); err != nil {
+		t.SendDecodeJSONReqError(err)
+		return
+	}
+	fresh, err := t.GetBool("fresh", false)
 	if err != nil {
-		e, ok := err.(*common_http.Error)
-		if ok && e.Code == http.StatusUnauthorized {
-			t.SendBadRequestError(errors.New("invalid credential"))
+		t.SendBadRequestError(fmt.Errorf("invalid fresh %s", t.GetString("fresh")))
+		return
+	}
+
+	if req.PushRepository != nil && !utils.ValidateRepo(*req.PushRepository) {
+		t.SendBadRequestError(fmt.Errorf("invalid repository %s to validate the push permission", *req.PushRepository))
+		return
+	}
+
+	cacheable := req.onlyID()
+	var generation uint64
+	if cacheable {
+		var outcome *registry.PingOutcome
+		outcome, generation = registry.Pings.Get(*req.ID)
+		if outcome != nil && !fresh {
+			log.Debugf("the cached outcome of pinging registry %d is returned", *req.ID)
+			t.writePingOutcome(outcome)
 			return
 		}
-		t.SendInternalServerError(fmt.Errorf("failed to check health of registry %s: %v", reg.URL, err))
+	}
+
+	reg, e := t.registryToPing(req)
+	if e != nil {
+		if e.Code == http.StatusInternalServerError {
+			t.SendInternalServerError(errors.New(e.Message))
+			return
+		}
+		t.SendHTTPError(e)
 		return
 	}
 
+	// the ping is aborted if the client disconnects
+	ctx := t.Ctx.Request.Context()
+	outcome, err := t.ping(ctx, reg, req)
+	if ctx.Err() != nil {
+		log.Debugf("the client disconnected, the ping of registry %s is canceled", reg.URL)
+		return
+	}
+	if err != nil {
+		t.SendInternalServerError(err)
+		return
+	}
+	if cacheable {
+		registry.Pings.Put(*req.ID, outcome, generation)
+	}
+	t.writePingOutcome(outcome)
+}
+
+// onlyID returns whether the registry to ping is specified only by the ID, the outcome of pinging
+// it can be shared as it depends on nothing else in the request
+func (p *pingRequest) onlyID() bool {
+	return p.ID != nil && p.Type == nil && p.URL == nil && p.CredentialType == nil && p.AccessKey == nil &&
+		p.AccessSecret == nil && p.Insecure == nil && p.UserAgent == nil && p.Headers == nil &&
+		p.FailoverURLs == nil && p.PushRepository == nil && p.FailOnClockSkew == nil && p.SSHTunnel == nil
+}
+
+// writePingOutcome writes the outcome of the ping
+func (t *RegistryAPI) writePingOutcome(outcome *registry.PingOutcome) {
+	if outcome.Error != nil {
+		t.SendHTTPError(outcome.Error)
+		return
+	}
+	t.WriteJSONData(outcome.Result)
+}
+
+// ping checks the health status of the registry, the outcome carries either the result or the error
+// telling why the registry is unhealthy. The returned error means the ping itself fails, the outcome
+// is meaningless if the context is canceled
+func (t *RegistryAPI) ping(ctx context.Context, reg *model.Registry, req *pingRequest) (*registry.PingOutcome, error) {
+	// the failure of the SSH tunnel is told from the one of the registry
+	if err := registry.CheckTunnelWithContext(ctx, reg); err != nil {
+		return &registry.PingOutcome{
+			Error: &common_http.Error{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("failed to connect to registry %s through the SSH tunnel: %v", reg.URL, err),
+				Hint:    registry.HintSSHTunnel,
+			},
+		}, nil
+	}
+	start := time.Now()
+	// the first healthy endpoint is pinged if the registry has failover URLs
+	url := reg.URL
+	reg = adapter.SelectEndpointWithContext(ctx, reg)
+	status, err := registry.CheckHealthStatusWithContext(ctx, reg)
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && status != model.Unhealthy {
+		return nil, fmt.Errorf("failed to check health of registry %s: %v", reg.URL, err)
+	}
+
 	if status != model.Healthy {
-		t.SendBadRequestError(errors.New(""))
+		// the hint helps the user to fix the common failures
+		e := &common_http.Error{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("registry %s is unhealthy", reg.URL),
+			Hint:    registry.Hint(err),
+		}
+		if err != nil {
+			e.Message = fmt.Sprintf("failed to ping registry %s: %v", reg.URL, err)
+			if phase := registry.TimeoutPhase(err); len(phase) > 0 {
+				e.Message = fmt.Sprintf("failed to ping registry %s, timed out in the %s phase: %v", reg.URL, phase, err)
+			}
+			if httpErr, ok := err.(*common_http.Error); ok && httpErr.IsAuthError() {
+				e.Message = fmt.Sprintf("invalid credential, %s", registry.CredentialPrecedence(reg))
+			}
+		}
+		return &registry.PingOutcome{Error: e}, nil
+	}
+
+	// the credential which can pull but not push passes the ping, validate it against
+	// the repository to catch the misconfiguration before the replication fails
+	if req.PushRepository != nil {
+		canPush, err := registry.CheckPushPermissionWithContext(ctx, reg, *req.PushRepository)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the push permission to %s of registry %s: %v",
+				*req.PushRepository, reg.URL, err)
+		}
+		if !canPush {
+			return &registry.PingOutcome{
+				Error: &common_http.Error{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("the credential has no permission to push to %s of registry %s", *req.PushRepository, reg.URL),
+					Hint:    "grant the push permission of the repository to the account, or use the credential of another account which has it",
+				},
+			}, nil
+		}
+	}
+
+	result := &registry.PingResult{
+		ID:       reg.ID,
+		URL:      url,
+		Endpoint: reg.URL,
+		Status:   string(status),
+		Latency:  int64(latency / time.Millisecond),
+	}
+
+	// the large clock skew breaks the validity of the tokens issued by the registry
+	skew, err := registry.MeasureClockSkewWithContext(ctx, reg)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		log.Warningf("failed to measure the clock skew of registry %s: %v", reg.URL, err)
+	} else {
+		seconds := int64(skew / time.Second)
+		result.ClockSkew = &seconds
+		if registry.ClockSkewExceeded(skew) {
+			msg := fmt.Sprintf("the clock of registry %s is skewed by %v, which exceeds %v", reg.URL, skew, registry.MaxClockSkew)
+			if req.FailOnClockSkew != nil && *req.FailOnClockSkew {
+				return &registry.PingOutcome{
+					Error: &common_http.Error{
+						Code:    http.StatusBadRequest,
+						Message: msg,
+						Hint:    registry.HintClockSkew,
+					},
+				}, nil
+			}
+			log.Warning(msg)
+			result.Warning = msg
+		}
+	}
+
+	// the product helps to recommend the options specific to it, e.g. the ones of Harbor
+	product, err := registry.ProbeProductWithContext(ctx, reg)
+	if err != nil {
+		log.Warningf("failed to probe the product of registry %s: %v", reg.URL, err)
+	} else {
+		result.Product = product
+	}
+	return &registry.PingOutcome{Result: result}, nil
+}
+
+// PingBatch checks the health status of multiple registries concurrently, every item of the request
+// is handled as the request of "Ping" and the results are returned in the same order with the items
+func (t *RegistryAPI) PingBatch() {
+	reqs := []*pingRequest{}
+	if err := t.DecodeJSONReqWithLimit(&reqs, batchRequestBodyLimit()); err != nil {
+		t.SendDecodeJSONReqError(err)
 		return
 	}
-	return
+	if len(reqs) == 0 || len(reqs) > maxBatchPingSize {
+		t.SendBadRequestError(fmt.Errorf("the count of registries should be between 1 and %d", maxBatchPingSize))
+		return
+	}
+
+	results := make([]*registry.PingResult, len(reqs))
+	registries := []*model.Registry{}
+	indexes := []int{}
+	for i, req := range reqs {
+		if req == nil {
+			req = &pingRequest{}
+		}
+		reg, e := t.registryToPing(req)
+		if e != nil {
+			result := &registry.PingResult{
+				Status: model.Unknown,
+				Error:  e.Message,
+			}
+			if req.ID != nil {
+				result.ID = *req.ID
+			}
+			if req.URL != nil {
+				result.URL = *req.URL
+			}
+			results[i] = result
+			continue
+		}
+		registries = append(registries, reg)
+		indexes = append(indexes, i)
+	}
+
+	for i, result := range registry.PingAll(registries, registry.BatchPingConcurrency, registry.BatchPingTimeout) {
+		results[indexes[i]] = result
+	}
+
+	t.WriteJSONData(results)
+}
+
+// plaintextWarning logs and returns a warning if the registry is accessed over plain HTTP,
+// this is allowed as the insecure registries may not support HTTPS
+func plaintextWarning(url string) string {
+	if !strings.HasPrefix(url, "http://") {
+		return ""
+	}
+	warning := fmt.Sprintf("the registry %s is accessed over plaintext HTTP", url)
+	log.Warning(warning)
+	return warning
+}
+
+// warnPlaintext returns the warning about the plaintext HTTP to the user in the "Warning"
+// header(RFC 7234) of the response as the registry is created or updated anyway
+func (t *RegistryAPI) warnPlaintext(url string) {
+	if warning := plaintextWarning(url); len(warning) > 0 {
+		t.Ctx.ResponseWriter.Header().Add("Warning", fmt.Sprintf("299 - %q", warning))
+	}
+}
+
+// resolveAllowedProjects trims the allowed projects of the registry and converts the IDs to
+// the names of the local projects, the errors are sent if the projects cannot be resolved
+func (t *RegistryAPI) resolveAllowedProjects(r *model.Registry) bool {
+	projects := []string{}
+	for _, p := range r.AllowedProjects {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+		if id, err := strconv.ParseInt(p, 10, 64); err == nil {
+			project, err := t.ProjectMgr.Get(id)
+			if err != nil {
+				t.SendInternalServerError(fmt.Errorf("failed to get project %d: %v", id, err))
+				return false
+			}
+			if project == nil {
+				t.SendBadRequestError(fmt.Errorf("the allowed project %d not found", id))
+				return false
+			}
+			p = project.Name
+		}
+		projects = append(projects, p)
+	}
+	r.AllowedProjects = projects
+	return true
 }
 
-// Get gets a registry by id.
+// Get gets a registry by id, the conditional GET with the header "If-None-Match" is supported.
 func (t *RegistryAPI) Get() {
 	id, err := t.GetIDFromURL()
 	if err != nil {
@@ -147,11 +503,27 @@ func (t *RegistryAPI) Get() {
 		return
 	}
 
-	// Hide access secret
-	hideAccessSecret(r.Credential)
+	t.WriteJSONDataWithETag(sanitizeRegistry(r))
+}
 
-	t.Data["json"] = r
-	t.ServeJSON()
+// the placeholder of the secrets masked in the responses, the current secrets are kept
+// when the placeholder is sent back in the update
+const maskedSecret = "*****"
+
+// sanitizeRegistry returns the copy of the registry without the secrets, it's used for every response
+// carrying the registry. The secret of the credential is masked, the private key of the SSH tunnel is
+// cleared and the values of the custom headers, which are often the tokens, are masked
+func sanitizeRegistry(r *model.Registry) *model.Registry {
+	if r == nil {
+		return nil
+	}
+	sanitized := registry.CopyRegistry(r)
+	hideAccessSecret(sanitized.Credential)
+	sanitized.SSHTunnel = hidePrivateKey(sanitized.SSHTunnel)
+	for name := range sanitized.Headers {
+		sanitized.Headers[name] = maskedSecret
+	}
+	return sanitized
 }
 
 func hideAccessSecret(credential *model.Credential) {
@@ -161,15 +533,49 @@ func hideAccessSecret(credential *model.Credential) {
 	if len(credential.AccessSecret) == 0 {
 		return
 	}
-	credential.AccessSecret = "*****"
+	credential.AccessSecret = maskedSecret
+}
+
+// mergeHeaders returns the requested headers, the current values are kept for the headers whose
+// values are masked, so the registry retrieved can be updated as it is
+func mergeHeaders(current, requested map[string]string) map[string]string {
+	headers := map[string]string{}
+	for name, value := range requested {
+		if current, exist := current[name]; exist && value == maskedSecret {
+			value = current
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// hidePrivateKey returns the copy of the tunnel without the private key, the tunnel of the registry
+// isn't modified. The private key is cleared rather than masked, so the current one is kept when the
+// registry retrieved is updated as it is
+func hidePrivateKey(tunnel *registry_pkg.SSHTunnel) *registry_pkg.SSHTunnel {
+	if tunnel == nil {
+		return nil
+	}
+	t := *tunnel
+	t.PrivateKey = ""
+	return &t
 }
 
-// List lists all registries that match a given registry name.
+// List lists all registries that match a given registry name and the labels specified by the repeated
+// "label" parameters, the registries should have all the labels unless "label_match" is "any". The ETag
+// is computed from all the registries listed so it changes when any of them is changed, added or deleted.
 func (t *RegistryAPI) List() {
 	name := t.GetString("name")
+	labelMatch := t.GetString("label_match")
+	if len(labelMatch) > 0 && labelMatch != model.LabelMatchAll && labelMatch != model.LabelMatchAny {
+		t.SendBadRequestError(fmt.Errorf("invalid label match mode %s", labelMatch))
+		return
+	}
 
 	_, registries, err := t.manager.List(&model.RegistryQuery{
-		Name: name,
+		Name:       name,
+		Labels:     t.GetStrings("label"),
+		LabelMatch: labelMatch,
 	})
 	if err != nil {
 		log.Errorf("failed to list registries %s: %v", name, err)
@@ -177,14 +583,11 @@ func (t *RegistryAPI) List() {
 		return
 	}
 
-	// Hide passwords
-	for _, r := range registries {
-		hideAccessSecret(r.Credential)
+	for i, r := range registries {
+		registries[i] = sanitizeRegistry(r)
 	}
 
-	t.Data["json"] = registries
-	t.ServeJSON()
-	return
+	t.WriteJSONDataWithETag(registries)
 }
 
 // Post creates a registry
@@ -192,7 +595,7 @@ func (t *RegistryAPI) Post() {
 	r := &model.Registry{}
 	isValid, err := t.DecodeJSONReqAndValidate(r)
 	if !isValid {
-		t.SendBadRequestError(err)
+		t.SendDecodeJSONReqError(err)
 		return
 	}
 
@@ -207,9 +610,25 @@ func (t *RegistryAPI) Post() {
 		t.SendConflictError(fmt.Errorf("name '%s' is already used", r.Name))
 		return
 	}
-	i := strings.Index(r.URL, "://")
-	if i == -1 {
-		r.URL = fmt.Sprintf("http://%s", r.URL)
+	if !t.checkDuplicate(r) {
+		return
+	}
+	if r.MaxConnections < 0 {
+		t.SendBadRequestError(fmt.Errorf("invalid max connections %d", r.MaxConnections))
+		return
+	}
+	if r.JobRetentionDays < 0 {
+		t.SendBadRequestError(fmt.Errorf("invalid job retention days %d", r.JobRetentionDays))
+		return
+	}
+	for _, url := range r.Endpoints() {
+		if registry.IsLocal(url) {
+			t.SendBadRequestError(fmt.Errorf("the registry %s points to the local Harbor", url))
+			return
+		}
+	}
+	if !t.resolveAllowedProjects(r) {
+		return
 	}
 
 	status, err := registry.CheckHealthStatus(r)
@@ -229,36 +648,155 @@ func (t *RegistryAPI) Post() {
 		return
 	}
 
+	t.warnPlaintext(r.URL)
 	t.Redirect(http.StatusCreated, strconv.FormatInt(id, 10))
 }
 
+// checkDuplicate sends the conflict error if the registry duplicates another one, see "registry.CheckDuplicate"
+func (t *RegistryAPI) checkDuplicate(r *model.Registry) bool {
+	_, registries, err := t.manager.List()
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to list registries: %v", err))
+		return false
+	}
+	if err = registry.CheckDuplicate(r, registries); err != nil {
+		t.SendConflictError(err)
+		return false
+	}
+	return true
+}
+
+func accessKey(r *model.Registry) string {
+	if r.Credential == nil {
+		return ""
+	}
+	return r.Credential.AccessKey
+}
+
 // Put updates a registry
 func (t *RegistryAPI) Put() {
+	r, ok := t.registryToUpdate()
+	if !ok {
+		return
+	}
+
+	req := models.RegistryUpdateRequest{}
+	if err := t.DecodeJSONReq(&req); err != nil {
+		t.SendDecodeJSONReqError(err)
+		return
+	}
+	t.update(r, &req)
+}
+
+// Patch updates a registry with the JSON merge patch(RFC 7396), the fields omitted in
+// the patch are left untouched and the ones set to null are cleared
+func (t *RegistryAPI) Patch() {
+	mediaType := strings.TrimSpace(strings.Split(t.Ctx.Request.Header.Get("Content-Type"), ";")[0])
+	if mediaType != mergePatchMediaType {
+		t.RenderError(http.StatusUnsupportedMediaType, fmt.Sprintf("the content type must be %s", mergePatchMediaType))
+		return
+	}
+
+	r, ok := t.registryToUpdate()
+	if !ok {
+		return
+	}
+
+	patch := &models.RegistryPatch{}
+	if err := t.DecodeJSONReq(patch); err != nil {
+		t.SendDecodeJSONReqError(err)
+		return
+	}
+	for _, field := range patch.Nulls {
+		switch field {
+		case "description":
+			r.Description = ""
+		// nothing to clear for the anonymous registry which has no credential
+		case "credential_type":
+			if r.Credential != nil {
+				r.Credential.Type = ""
+			}
+		case "access_key":
+			if r.Credential != nil {
+				r.Credential.AccessKey = ""
+			}
+		case "access_secret":
+			if r.Credential != nil {
+				r.Credential.AccessSecret = ""
+			}
+		case "insecure":
+			r.Insecure = false
+		case "user_agent":
+			r.UserAgent = ""
+		case "max_connections":
+			r.MaxConnections = 0
+		case "job_retention_days":
+			r.JobRetentionDays = 0
+		case "draining":
+			r.Draining = false
+		case "default":
+			r.Default = false
+		case "allowed_projects":
+			r.AllowedProjects = nil
+		case "blackout_windows":
+			r.BlackoutWindows = nil
+		case "path_transform":
+			r.PathTransform = nil
+		case "labels":
+			r.Labels = []string{}
+		case "preferred_manifest_type":
+			r.PreferredManifestType = ""
+		case "headers":
+			r.Headers = nil
+		case "failover_urls":
+			r.FailoverURLs = nil
+		case "layer_media_types":
+			r.LayerMediaTypes = nil
+		case "warmup_connections":
+			r.WarmupConnections = 0
+		case "timezone":
+			r.Timezone = ""
+		case "ssh_tunnel":
+			r.SSHTunnel = nil
+		default:
+			t.SendBadRequestError(fmt.Errorf("the field %s cannot be null", field))
+			return
+		}
+	}
+	t.update(r, &patch.RegistryUpdateRequest)
+}
+
+// registryToUpdate returns the registry specified by the ID in the URL, the
+// error is sent to the client and false is returned if it cannot be found
+func (t *RegistryAPI) registryToUpdate() (*model.Registry, bool) {
 	id, err := t.GetIDFromURL()
 	if err != nil {
 		t.SendBadRequestError(err)
-		return
+		return nil, false
 	}
 
 	r, err := t.manager.Get(id)
 	if err != nil {
 		log.Errorf("Get registry by id %d error: %v", id, err)
 		t.SendInternalServerError(err)
-		return
+		return nil, false
 	}
 
 	if r == nil {
 		t.SendNotFoundError(fmt.Errorf("Registry %d not found", id))
-		return
-	}
-
-	req := models.RegistryUpdateRequest{}
-	if err := t.DecodeJSONReq(&req); err != nil {
-		t.SendBadRequestError(err)
-		return
+		return nil, false
 	}
+	return r, true
+}
 
+// update applies the update request to the registry and saves it after validating
+func (t *RegistryAPI) update(r *model.Registry, req *models.RegistryUpdateRequest) {
 	originalName := r.Name
+	wasDraining := r.Draining
+	originalTimezone := r.Timezone
+	// the registry only becomes a duplicate when its endpoints or access key are changed
+	originalEndpoints := strings.Join(r.Endpoints(), " ")
+	originalAccessKey := accessKey(r)
 
 	if req.Name != nil {
 		r.Name = *req.Name
@@ -269,6 +807,10 @@ func (t *RegistryAPI) Put() {
 	if req.URL != nil {
 		r.URL = *req.URL
 	}
+	// the anonymous registry has no credential
+	if r.Credential == nil && (req.CredentialType != nil || req.AccessKey != nil || req.AccessSecret != nil) {
+		r.Credential = &model.Credential{}
+	}
 	if req.CredentialType != nil {
 		r.Credential.Type = (model.CredentialType)(*req.CredentialType)
 	}
@@ -281,8 +823,77 @@ func (t *RegistryAPI) Put() {
 	if req.Insecure != nil {
 		r.Insecure = *req.Insecure
 	}
+	if req.UserAgent != nil {
+		r.UserAgent = *req.UserAgent
+	}
+	if req.MaxConnections != nil {
+		if *req.MaxConnections < 0 {
+			t.SendBadRequestError(fmt.Errorf("invalid max connections %d", *req.MaxConnections))
+			return
+		}
+		r.MaxConnections = *req.MaxConnections
+	}
+	if req.JobRetentionDays != nil {
+		if *req.JobRetentionDays < 0 {
+			t.SendBadRequestError(fmt.Errorf("invalid job retention days %d", *req.JobRetentionDays))
+			return
+		}
+		r.JobRetentionDays = *req.JobRetentionDays
+	}
+	if req.Draining != nil {
+		r.Draining = *req.Draining
+	}
+	if req.Default != nil {
+		r.Default = *req.Default
+	}
+	if req.AllowedProjects != nil {
+		r.AllowedProjects = *req.AllowedProjects
+		if !t.resolveAllowedProjects(r) {
+			return
+		}
+	}
+	if req.BlackoutWindows != nil {
+		r.BlackoutWindows = *req.BlackoutWindows
+	}
+	if req.PathTransform != nil {
+		r.PathTransform = req.PathTransform
+	}
+	if req.Labels != nil {
+		r.Labels = *req.Labels
+	}
+	if req.PreferredManifestType != nil {
+		r.PreferredManifestType = *req.PreferredManifestType
+	}
+	if req.Headers != nil {
+		r.Headers = mergeHeaders(r.Headers, *req.Headers)
+	}
+	if req.FailoverURLs != nil {
+		r.FailoverURLs = *req.FailoverURLs
+	}
+	if req.LayerMediaTypes != nil {
+		r.LayerMediaTypes = req.LayerMediaTypes
+	}
+	if req.WarmupConnections != nil {
+		r.WarmupConnections = *req.WarmupConnections
+	}
+	if req.Timezone != nil {
+		r.Timezone = *req.Timezone
+	}
+	if req.SSHTunnel != nil {
+		r.SSHTunnel = mergeSSHTunnel(r.SSHTunnel, req.SSHTunnel)
+	}
 
-	t.Validate(r)
+	isValid, err := t.Validate(r)
+	if !isValid {
+		t.SendBadRequestError(err)
+		return
+	}
+	for _, url := range r.Endpoints() {
+		if registry.IsLocal(url) {
+			t.SendBadRequestError(fmt.Errorf("the registry %s points to the local Harbor", url))
+			return
+		}
+	}
 
 	if r.Name != originalName {
 		reg, err := t.manager.GetByName(r.Name)
@@ -297,6 +908,10 @@ func (t *RegistryAPI) Put() {
 			return
 		}
 	}
+	if (strings.Join(r.Endpoints(), " ") != originalEndpoints || accessKey(r) != originalAccessKey) &&
+		!t.checkDuplicate(r) {
+		return
+	}
 
 	status, err := registry.CheckHealthStatus(r)
 	if err != nil {
@@ -308,11 +923,29 @@ func (t *RegistryAPI) Put() {
 		return
 	}
 
-	if err := t.manager.Update(r); err != nil {
-		log.Errorf("Update registry %d error: %v", id, err)
+	err = t.manager.Update(r)
+	// the registry may be updated partially even if the update fails
+	registry.Pings.Invalidate(r.ID)
+	if err != nil {
+		log.Errorf("Update registry %d error: %v", r.ID, err)
 		t.SendInternalServerError(err)
 		return
 	}
+	t.warnPlaintext(r.URL)
+
+	if r.Timezone != originalTimezone {
+		t.reschedule(r.ID)
+	}
+
+	// submit the replication jobs deferred while the registry was draining
+	if wasDraining && !r.Draining {
+		n, err := replication.OperationCtl.ResumeDeferredTasks(r.ID)
+		if err != nil {
+			log.Errorf("Resume the deferred replication tasks of registry %d error: %v", r.ID, err)
+			return
+		}
+		log.Debugf("%d deferred replication tasks of registry %d resumed", n, r.ID)
+	}
 }
 
 // Delete deletes a registry
@@ -323,7 +956,7 @@ func (t *RegistryAPI) Delete() {
 		return
 	}
 
-	registry, err := t.manager.Get(id)
+	reg, err := t.manager.Get(id)
 	if err != nil {
 		msg := fmt.Sprintf("Get registry %d error: %v", id, err)
 		log.Error(msg)
@@ -331,7 +964,7 @@ func (t *RegistryAPI) Delete() {
 		return
 	}
 
-	if registry == nil {
+	if reg == nil {
 		t.SendNotFoundError(fmt.Errorf("Registry %d not found", id))
 		return
 	}
@@ -376,6 +1009,197 @@ func (t *RegistryAPI) Delete() {
 		t.SendPreconditionFailedError(errors.New(msg))
 		return
 	}
+	registry.Breaker.Reset(id)
+	registry.Pings.Invalidate(id)
+}
+
+// Export exports all the registries as a portable document, the credentials are omitted
+// unless the passphrase is provided in the header, which is used to encrypt them
+func (t *RegistryAPI) Export() {
+	doc, err := registry.Export(t.manager, t.Ctx.Request.Header.Get(passphraseHeader))
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to export registries: %v", err))
+		return
+	}
+	t.WriteJSONData(doc)
+}
+
+// returns the limit of the body of the requests carrying a batch of registries, it's never
+// less than the limit of the other requests which can be raised by MAX_REQUEST_BODY_SIZE
+func batchRequestBodyLimit() int64 {
+	if common_api.MaxRequestBodySize > maxBatchRequestBodySize {
+		return common_api.MaxRequestBodySize
+	}
+	return maxBatchRequestBodySize
+}
+
+// Import creates the registries in the document exported by "Export", the existing ones
+// with the same name are skipped unless the "overwrite" is set to true
+func (t *RegistryAPI) Import() {
+	doc := &registry.ExportDocument{}
+	if err := t.DecodeJSONReqWithLimit(doc, batchRequestBodyLimit()); err != nil {
+		t.SendDecodeJSONReqError(err)
+		return
+	}
+	if err := doc.Valid(); err != nil {
+		t.SendBadRequestError(err)
+		return
+	}
+	overwrite, err := t.GetBool("overwrite", false)
+	if err != nil {
+		t.SendBadRequestError(fmt.Errorf("invalid overwrite %s", t.GetString("overwrite")))
+		return
+	}
+
+	result, err := registry.Import(t.manager, doc, t.Ctx.Request.Header.Get(passphraseHeader), overwrite)
+	if overwrite {
+		registry.Pings.Clear()
+	}
+	if err != nil {
+		if err == registry.ErrPassphraseRequired || err == registry.ErrInvalidPassphrase {
+			t.SendBadRequestError(err)
+			return
+		}
+		if _, ok := err.(*registry.DuplicateError); ok {
+			t.SendConflictError(err)
+			return
+		}
+		t.SendInternalServerError(fmt.Errorf("failed to import registries: %v", err))
+		return
+	}
+	// the time zones of the registries overwritten may be changed
+	for _, name := range result.Overwritten {
+		r, err := t.manager.GetByName(name)
+		if err != nil || r == nil {
+			log.Errorf("Get registry %s error: %v", name, err)
+			continue
+		}
+		t.reschedule(r.ID)
+	}
+	t.WriteJSONData(result)
+}
+
+// reschedule the policies of the registry as their crons are interpreted in its time zone
+func (t *RegistryAPI) reschedule(id int64) {
+	rescheduler, ok := t.policyCtl.(policy.Rescheduler)
+	if !ok {
+		return
+	}
+	if err := rescheduler.Reschedule(id); err != nil {
+		log.Errorf("Reschedule the policies of registry %d error: %v", id, err)
+	}
+}
+
+// ResetBreaker closes the circuit breaker of the registry and clears the failure counter
+func (t *RegistryAPI) ResetBreaker() {
+	id, err := t.GetIDFromURL()
+	if err != nil {
+		t.SendBadRequestError(err)
+		return
+	}
+
+	reg, err := t.manager.Get(id)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", id, err))
+		return
+	}
+	if reg == nil {
+		t.SendNotFoundError(fmt.Errorf("registry %d not found", id))
+		return
+	}
+
+	registry.Breaker.Reset(id)
+}
+
+// warmupRequest is the request to warm up the connections to the registry
+type warmupRequest struct {
+	// the count of the connections to warm up, the one set for the registry or the default
+	// one is used if it isn't specified
+	Connections *int `json:"connections"`
+}
+
+// WarmUp warms up the connections to the registry in jobservice and returns the status of the
+// warmup, the status can be got by GetWarmup afterwards
+func (t *RegistryAPI) WarmUp() {
+	id, err := t.GetIDFromURL()
+	if err != nil {
+		t.SendBadRequestError(err)
+		return
+	}
+	req := &warmupRequest{}
+	// the body is optional
+	if t.Ctx.Request.ContentLength != 0 {
+		if err := t.DecodeJSONReq(req); err != nil {
+			t.SendDecodeJSONReqError(err)
+			return
+		}
+	}
+
+	reg, err := t.manager.Get(id)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", id, err))
+		return
+	}
+	if reg == nil {
+		t.SendNotFoundError(fmt.Errorf("registry %d not found", id))
+		return
+	}
+
+	connections := model.DefaultWarmupConnections
+	if reg.WarmupConnections > 0 {
+		connections = reg.WarmupConnections
+	}
+	if req.Connections != nil {
+		connections = *req.Connections
+		if err := model.ValidateWarmupConnections(connections); err != nil {
+			t.SendBadRequestError(err)
+			return
+		}
+		if connections == 0 {
+			t.SendBadRequestError(errors.New("at least one connection should be warmed up"))
+			return
+		}
+	}
+	reg.WarmupConnections = connections
+
+	status, err := utils_core.GetJobServiceClient().WarmUp(reg)
+	if err != nil {
+		t.ParseAndHandleError(fmt.Sprintf("failed to warm up the connections to registry %d", id), err)
+		return
+	}
+	t.WriteJSONData(status)
+}
+
+// GetWarmup returns the status of the latest warmup of the connections to the registry in jobservice
+func (t *RegistryAPI) GetWarmup() {
+	id, err := t.GetIDFromURL()
+	if err != nil {
+		t.SendBadRequestError(err)
+		return
+	}
+
+	reg, err := t.manager.Get(id)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", id, err))
+		return
+	}
+	if reg == nil {
+		t.SendNotFoundError(fmt.Errorf("registry %d not found", id))
+		return
+	}
+
+	statuses, err := utils_core.GetJobServiceClient().GetWarmups()
+	if err != nil {
+		t.ParseAndHandleError(fmt.Sprintf("failed to get the warmup status of registry %d", id), err)
+		return
+	}
+	for _, status := range statuses {
+		if status.RegistryID == id {
+			t.WriteJSONData(status)
+			return
+		}
+	}
+	t.SendNotFoundError(fmt.Errorf("registry %d isn't warmed up", id))
 }
 
 // GetInfo returns the base info and capability declarations of the registry
@@ -423,6 +1247,199 @@ func (t *RegistryAPI) GetInfo() {
 	t.WriteJSONData(process(info))
 }
 
+// loadAdapter loads the registry specified by the ID in the path and creates the adapter
+// for it, the errors are sent to the client and false is returned if the loading fails
+func (t *RegistryAPI) loadAdapter() (*model.Registry, adapter.Adapter, bool) {
+	id, err := t.GetIDFromURL()
+	if err != nil {
+		t.SendBadRequestError(err)
+		return nil, nil, false
+	}
+	registry, err := t.manager.Get(id)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", id, err))
+		return nil, nil, false
+	}
+	if registry == nil {
+		t.SendNotFoundError(fmt.Errorf("registry %d not found", id))
+		return nil, nil, false
+	}
+
+	factory, err := adapter.GetFactory(registry.Type)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to get the adapter factory for registry type %s: %v", registry.Type, err))
+		return nil, nil, false
+	}
+	adp, err := factory(registry)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to create the adapter for registry %d: %v", registry.ID, err))
+		return nil, nil, false
+	}
+	return registry, adp, true
+}
+
+// GetCapabilities probes the registry for the features supported by its /v2/ API, e.g. the
+// catalog API, the referrers API, the chunked upload and the deletion. The repository level
+// capabilities are probed inside the namespace specified by the query parameter "namespace"
+func (t *RegistryAPI) GetCapabilities() {
+	registry, adp, ok := t.loadAdapter()
+	if !ok {
+		return
+	}
+	prober, ok := adp.(adapter.CapabilityProber)
+	if !ok {
+		t.SendBadRequestError(fmt.Errorf("probing the capabilities isn't supported by the registry type %s", registry.Type))
+		return
+	}
+	capabilities, err := prober.Capabilities(t.GetString("namespace"))
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to probe the capabilities of registry %d: %v", registry.ID, err))
+		return
+	}
+	t.WriteJSONData(capabilities)
+}
+
+// ListRepositories lists the repositories of the registry. The huge catalog is streamed as a JSON
+// array page by page as it's fetched from the registry rather than buffered, and the next page isn't
+// fetched until the current one is written to the client. The error occurring after the array is
+// started is reported in the trailer with the array left unterminated
+func (t *RegistryAPI) ListRepositories() {
+	registry, adp, ok := t.loadAdapter()
+	if !ok {
+		return
+	}
+	lister, ok := adp.(adapter.CatalogLister)
+	if !ok {
+		t.SendBadRequestError(fmt.Errorf("listing the repositories isn't supported by the registry type %s", registry.Type))
+		return
+	}
+
+	ctx := t.Ctx.Request.Context()
+	stream := common_api.NewJSONArrayStream(t.Ctx.ResponseWriter)
+	err := lister.CatalogWithContext(ctx, func(repositories []string) error {
+		for _, repository := range repositories {
+			if err := stream.Write(repository); err != nil {
+				return err
+			}
+		}
+		stream.Flush()
+		return nil
+	})
+	if err == nil {
+		if err = stream.Close(); err != nil {
+			log.Debugf("failed to terminate the repositories of registry %d: %v", registry.ID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		log.Debugf("the client disconnected, stop listing the repositories of registry %d: %v", registry.ID, err)
+		return
+	}
+	if !stream.Started() {
+		t.SendInternalServerError(fmt.Errorf("failed to list the repositories of registry %d: %v", registry.ID, err))
+		return
+	}
+	log.Errorf("failed to list the repositories of registry %d in the middle: %v", registry.ID, err)
+	stream.Abort(err)
+}
+
+// DeleteTag deletes the tag of the repository on the registry, the tag is resolved to the
+// digest and the manifest is deleted. As the other tags referring to the same manifest would be
+// deleted as well, the deletion is refused unless the query parameter "force=true" is specified
+// if there are such tags or they cannot be checked
+func (t *RegistryAPI) DeleteTag() {
+	registry, adp, ok := t.loadAdapter()
+	if !ok {
+		return
+	}
+	repository := t.GetString(":splat")
+	tag := t.GetString(":tag")
+	force, err := t.GetBool("force", false)
+	if err != nil {
+		t.SendBadRequestError(fmt.Errorf("invalid force %s", t.GetString("force")))
+		return
+	}
+	imageRegistry, ok := adp.(adapter.ImageRegistry)
+	if !ok {
+		t.SendBadRequestError(fmt.Errorf("deleting the tags isn't supported by the registry type %s", registry.Type))
+		return
+	}
+
+	exist, digest, err := imageRegistry.ManifestExist(repository, tag)
+	if err != nil {
+		t.SendInternalServerError(fmt.Errorf("failed to check the existence of %s:%s on registry %d: %v", repository, tag, registry.ID, err))
+		return
+	}
+	if !exist {
+		t.SendNotFoundError(fmt.Errorf("tag %s of repository %s not found on registry %d", tag, repository, registry.ID))
+		return
+	}
+	if !force {
+		lister, ok := adp.(adapter.TagLister)
+		if !ok || len(digest) == 0 {
+			t.SendPreconditionFailedError(fmt.Errorf("whether other tags refer to the manifest of %s:%s cannot be checked on registry %d, "+
+				"set force=true to delete the manifest with all its tags", repository, tag, registry.ID))
+			return
+		}
+		tags, err := sharingTags(imageRegistry, lister, repository, tag, digest)
+		if err != nil {
+			t.SendInternalServerError(fmt.Errorf("failed to check the tags referring to %s of repository %s on registry %d: %v",
+				digest, repository, registry.ID, err))
+			return
+		}
+		if len(tags) > 0 {
+			t.SendConflictError(fmt.Errorf("the manifest of %s:%s is referred by the tags %v as well, set force=true to delete them all",
+				repository, tag, tags))
+			return
+		}
+	}
+	// some registries don't return the digest, let the adapter resolve the tag in this case
+	reference := digest
+	if len(reference) == 0 {
+		reference = tag
+	}
+	if err = imageRegistry.DeleteManifest(repository, reference); err != nil {
+		if e, ok := err.(*common_http.Error); ok {
+			switch {
+			case e.Code == http.StatusMethodNotAllowed || e.ErrorCode == common_http.ErrorCodeUnsupported:
+				t.SendHTTPError(&common_http.Error{
+					Code:    http.StatusMethodNotAllowed,
+					Message: fmt.Sprintf("registry %d doesn't allow deleting the manifests", registry.ID),
+				})
+				return
+			case e.IsNotFound():
+				t.SendNotFoundError(fmt.Errorf("tag %s of repository %s not found on registry %d", tag, repository, registry.ID))
+				return
+			}
+		}
+		t.SendInternalServerError(fmt.Errorf("failed to delete %s:%s on registry %d: %v", repository, tag, registry.ID, err))
+		return
+	}
+	log.Infof("the tag %s of repository %s on registry %d is deleted by %s", tag, repository, registry.ID, t.SecurityCtx.GetUsername())
+}
+
+// sharingTags returns the tags of the repository other than the specified one which refer to the digest
+func sharingTags(imageRegistry adapter.ImageRegistry, lister adapter.TagLister, repository, tag, digest string) ([]string, error) {
+	tags, err := lister.ListTag(repository)
+	if err != nil {
+		return nil, err
+	}
+	sharing := []string{}
+	for _, t := range tags {
+		if t == tag {
+			continue
+		}
+		exist, d, err := imageRegistry.ManifestExist(repository, t)
+		if err != nil {
+			return nil, err
+		}
+		if exist && d == digest {
+			sharing = append(sharing, t)
+		}
+	}
+	return sharing, nil
+}
+
 // GetNamespace get the namespace of a registry
 // TODO remove
 func (t *RegistryAPI) GetNamespace() {
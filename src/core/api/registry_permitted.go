@@ -0,0 +1,148 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goharbor/harbor/src/common/models"
+	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/registry"
+)
+
+// PermittedRegistryAPI handles requests to /api/registries/permitted and /api/registries/default. It lists
+// the registries the user is permitted to use in the replication policies, it's open to the users who aren't system admin.
+type PermittedRegistryAPI struct {
+	BaseController
+	manager registry.Manager
+}
+
+// permittedRegistry is the registry returned to the users who aren't system admin, it only carries
+// the fields needed to select the registry in the replication policies
+type permittedRegistry struct {
+	ID   int64              `json:"id"`
+	Name string             `json:"name"`
+	Type model.RegistryType `json:"type"`
+	URL  string             `json:"url"`
+}
+
+func toPermittedRegistry(r *model.Registry) *permittedRegistry {
+	return &permittedRegistry{
+		ID:   r.ID,
+		Name: r.Name,
+		Type: r.Type,
+		URL:  r.URL,
+	}
+}
+
+// Prepare validates the user
+func (p *PermittedRegistryAPI) Prepare() {
+	p.BaseController.Prepare()
+	if !p.SecurityCtx.IsAuthenticated() {
+		p.SendUnAuthorizedError(errors.New("UnAuthorized"))
+		return
+	}
+	p.manager = replication.RegistryMgr
+}
+
+// List lists the registries the user is permitted to use. The system admin is permitted to use all
+// the registries and gets them with the secrets hidden. The other users are permitted to use the
+// registries which allow all the projects or any of the projects they're members of, and only get
+// the ID, name, type and URL of the registries
+func (p *PermittedRegistryAPI) List() {
+	_, registries, err := p.manager.List()
+	if err != nil {
+		p.SendInternalServerError(fmt.Errorf("failed to list registries: %v", err))
+		return
+	}
+
+	if p.SecurityCtx.IsSysAdmin() {
+		for i, r := range registries {
+			registries[i] = sanitizeRegistry(r)
+		}
+		p.WriteJSONData(registries)
+		return
+	}
+
+	projects, err := p.SecurityCtx.GetMyProjects()
+	if err != nil {
+		p.SendInternalServerError(fmt.Errorf("failed to list the projects of %s: %v", p.SecurityCtx.GetUsername(), err))
+		return
+	}
+	permitted := []*permittedRegistry{}
+	for _, r := range permittedRegistries(registries, projects) {
+		permitted = append(permitted, toPermittedRegistry(r))
+	}
+	p.WriteJSONData(permitted)
+}
+
+// GetDefault returns the default registry which is pre-selected when creating the policies, it's returned
+// in the same way as the permitted registries. The not found error is returned if no registry is the
+// default or the user isn't permitted to use it
+func (p *PermittedRegistryAPI) GetDefault() {
+	r, err := p.manager.GetDefault()
+	if err != nil {
+		p.SendInternalServerError(fmt.Errorf("failed to get the default registry: %v", err))
+		return
+	}
+	if r == nil {
+		p.SendNotFoundError(errors.New("no default registry"))
+		return
+	}
+
+	if p.SecurityCtx.IsSysAdmin() {
+		p.WriteJSONData(sanitizeRegistry(r))
+		return
+	}
+
+	projects, err := p.SecurityCtx.GetMyProjects()
+	if err != nil {
+		p.SendInternalServerError(fmt.Errorf("failed to list the projects of %s: %v", p.SecurityCtx.GetUsername(), err))
+		return
+	}
+	if len(permittedRegistries([]*model.Registry{r}, projects)) == 0 {
+		p.SendNotFoundError(errors.New("no default registry"))
+		return
+	}
+	p.WriteJSONData(toPermittedRegistry(r))
+}
+
+// permittedRegistries returns the registries which allow all the projects or any of the projects,
+// none is returned if there is no project as the user isn't a member of any project
+func permittedRegistries(registries []*model.Registry, projects []*models.Project) []*model.Registry {
+	permitted := []*model.Registry{}
+	if len(projects) == 0 {
+		return permitted
+	}
+	names := map[string]struct{}{}
+	for _, project := range projects {
+		names[project.Name] = struct{}{}
+	}
+	for _, r := range registries {
+		if len(r.AllowedProjects) == 0 {
+			permitted = append(permitted, r)
+			continue
+		}
+		for _, project := range r.AllowedProjects {
+			if _, exist := names[project]; exist {
+				permitted = append(permitted, r)
+				break
+			}
+		}
+	}
+	return permitted
+}
@@ -0,0 +1,228 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/goharbor/harbor/src/common/models"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type permittedRegistryManager struct {
+	fakedRegistryManager
+}
+
+func (p *permittedRegistryManager) List(...*model.RegistryQuery) (int64, []*model.Registry, error) {
+	return 2, []*model.Registry{
+		{
+			ID:   1,
+			Name: "unrestricted",
+			Credential: &model.Credential{
+				Type:         model.CredentialTypeBasic,
+				AccessKey:    "admin",
+				AccessSecret: "password",
+			},
+			Headers: map[string]string{"X-Api-Key": "token"},
+			SSHTunnel: &registry_pkg.SSHTunnel{
+				Host:       "jump.example.com",
+				User:       "harbor",
+				PrivateKey: "key",
+			},
+		},
+		{
+			ID:              2,
+			Name:            "restricted",
+			AllowedProjects: []string{"permitted_registry_test_project"},
+		},
+	}, nil
+}
+
+func TestPermittedRegistries(t *testing.T) {
+	registries := []*model.Registry{
+		{ID: 1},
+		{ID: 2, AllowedProjects: []string{"library"}},
+		{ID: 3, AllowedProjects: []string{"project1", "project2"}},
+	}
+	ids := func(registries []*model.Registry) []int64 {
+		result := []int64{}
+		for _, r := range registries {
+			result = append(result, r.ID)
+		}
+		return result
+	}
+
+	// the user isn't a member of any project
+	assert.Equal(t, []int64{}, ids(permittedRegistries(registries, nil)))
+	// the member of the project "library"
+	assert.Equal(t, []int64{1, 2}, ids(permittedRegistries(registries, []*models.Project{{Name: "library"}})))
+	// the member of the projects "library" and "project2"
+	assert.Equal(t, []int64{1, 2, 3}, ids(permittedRegistries(registries, []*models.Project{
+		{Name: "library"},
+		{Name: "project2"},
+	})))
+}
+
+func TestListPermittedRegistries(t *testing.T) {
+	original := replication.RegistryMgr
+	defer func() { replication.RegistryMgr = original }()
+	replication.RegistryMgr = &permittedRegistryManager{}
+
+	// 401
+	runCodeCheckingCases(t, &codeCheckingCase{
+		request: &testingRequest{
+			method: http.MethodGet,
+			url:    "/api/registries/permitted",
+		},
+		code: http.StatusUnauthorized,
+	})
+
+	// the system admin gets all the registries without the secrets
+	registries := []*model.Registry{}
+	err := handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/registries/permitted",
+		credential: sysAdmin,
+	}, &registries)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(registries))
+	assert.Equal(t, "admin", registries[0].Credential.AccessKey)
+	assert.Equal(t, "*****", registries[0].Credential.AccessSecret)
+
+	// the user isn't a member of any project
+	registries = []*model.Registry{}
+	err = handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/registries/permitted",
+		credential: nonSysAdmin,
+	}, &registries)
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(registries))
+
+	// the user is a member of "library" but not the project allowed by the restricted registry,
+	// only the ID, name, type and URL of the registry are returned
+	permitted := []map[string]interface{}{}
+	err = handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/registries/permitted",
+		credential: projAdmin,
+	}, &permitted)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(permitted))
+	assert.Equal(t, "unrestricted", permitted[0]["name"])
+	keys := []string{}
+	for key := range permitted[0] {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{"id", "name", "type", "url"}, keys)
+}
+
+func TestGetDefaultRegistry(t *testing.T) {
+	original := replication.RegistryMgr
+	defer func() { replication.RegistryMgr = original }()
+	mgr := &fakedRegistryManager{
+		registries: map[int64]*model.Registry{},
+	}
+	replication.RegistryMgr = mgr
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/registries/default",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 404, no default registry
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/registries/default",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// the system admin gets the default registry without the secret
+	mgr.registries[1] = &model.Registry{ID: 1, Name: "not-default"}
+	mgr.registries[2] = &model.Registry{
+		ID:      2,
+		Name:    "default",
+		Default: true,
+		Credential: &model.Credential{
+			Type:         model.CredentialTypeBasic,
+			AccessKey:    "admin",
+			AccessSecret: "password",
+		},
+	}
+	registry := &model.Registry{}
+	err := handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/registries/default",
+		credential: sysAdmin,
+	}, registry)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), registry.ID)
+	assert.True(t, registry.Default)
+	assert.Equal(t, "admin", registry.Credential.AccessKey)
+	assert.Equal(t, "*****", registry.Credential.AccessSecret)
+
+	// the registry managed isn't modified
+	assert.Equal(t, "password", mgr.registries[2].Credential.AccessSecret)
+
+	// the other users only get the ID, name, type and URL of the registry
+	permitted := map[string]interface{}{}
+	err = handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/registries/default",
+		credential: projAdmin,
+	}, &permitted)
+	require.Nil(t, err)
+	assert.Equal(t, float64(2), permitted["id"])
+	assert.Equal(t, "default", permitted["name"])
+	assert.Nil(t, permitted["credential"])
+
+	cases = []*codeCheckingCase{
+		// the user isn't a member of any project
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/registries/default",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// the default registry isn't found by the user who isn't permitted to use it
+	mgr.registries[2].AllowedProjects = []string{"permitted_registry_test_project"}
+	runCodeCheckingCases(t, &codeCheckingCase{
+		request: &testingRequest{
+			method:     http.MethodGet,
+			url:        "/api/registries/default",
+			credential: projAdmin,
+		},
+		code: http.StatusNotFound,
+	})
+}
@@ -1,14 +1,26 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	common_api "github.com/goharbor/harbor/src/common/api"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/core/api/models"
 	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/adapter"
+	rep_config "github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/registry"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -94,6 +106,100 @@ func (suite *RegistrySuite) TestList() {
 	assert.Equal(0, len(registries))
 }
 
+func (suite *RegistrySuite) TestListByLabels() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+
+	id := suite.defaultRegistry.ID
+	require.Nil(dao.SetRegistryLabels(id, []string{"region:eu", "team:payments"}))
+	defer dao.SetRegistryLabels(id, nil)
+
+	cases := []struct {
+		query   string
+		matched bool
+	}{
+		{"label=region:eu&label=team:payments", true},
+		{"label=region:eu&label=team:search", false},
+		{"label=region:eu&label=team:search&label_match=any", true},
+		{"label=region:us&label=team:search&label_match=any", false},
+	}
+	for _, c := range cases {
+		registries := []*model.Registry{}
+		err := handleAndParse(&testingRequest{
+			method:     http.MethodGet,
+			url:        "/api/registries?" + c.query,
+			credential: admin,
+		}, &registries)
+		require.Nil(err)
+		if c.matched {
+			require.Equal(1, len(registries), c.query)
+			assert.Equal([]string{"region:eu", "team:payments"}, registries[0].Labels)
+		} else {
+			assert.Equal(0, len(registries), c.query)
+		}
+	}
+
+	// invalid match mode
+	runCodeCheckingCases(suite.T(), &codeCheckingCase{
+		request: &testingRequest{
+			method:     http.MethodGet,
+			url:        "/api/registries?label=region:eu&label_match=some",
+			credential: admin,
+		},
+		code: http.StatusBadRequest,
+	})
+}
+
+func (suite *RegistrySuite) TestConditionalGet() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+
+	for _, url := range []string{
+		fmt.Sprintf("/api/registries/%d", suite.defaultRegistry.ID),
+		"/api/registries",
+	} {
+		resp, err := handle(&testingRequest{
+			method:     http.MethodGet,
+			url:        url,
+			credential: admin,
+		})
+		require.Nil(err)
+		require.Equal(http.StatusOK, resp.Code)
+		etag := resp.Header().Get("ETag")
+		require.NotEmpty(etag)
+
+		// not modified
+		resp, err = handle(&testingRequest{
+			method:     http.MethodGet,
+			url:        url,
+			header:     http.Header{"If-None-Match": []string{etag}},
+			credential: admin,
+		})
+		require.Nil(err)
+		assert.Equal(http.StatusNotModified, resp.Code)
+		assert.Equal(etag, resp.Header().Get("ETag"))
+		assert.Empty(resp.Body.String())
+
+		// the ETag changes after the registry is updated
+		description := "etag-" + etag
+		code, err := suite.testAPI.RegistryUpdate(*admin, suite.defaultRegistry.ID, &models.RegistryUpdateRequest{
+			Description: &description,
+		})
+		require.Nil(err)
+		require.Equal(http.StatusOK, code)
+		resp, err = handle(&testingRequest{
+			method:     http.MethodGet,
+			url:        url,
+			header:     http.Header{"If-None-Match": []string{etag}},
+			credential: admin,
+		})
+		require.Nil(err)
+		assert.Equal(http.StatusOK, resp.Code)
+		assert.NotEqual(etag, resp.Header().Get("ETag"))
+		assert.Contains(resp.Body.String(), description)
+	}
+}
+
 func (suite *RegistrySuite) TestPost() {
 	assert := assert.New(suite.T())
 
@@ -106,6 +212,47 @@ func (suite *RegistrySuite) TestPost() {
 	code, err = suite.testAPI.RegistryCreate(*testUser, testRegistry2)
 	assert.Nil(err)
 	assert.Equal(http.StatusForbidden, code)
+
+	// Should fail when the request body is too large
+	oversized := *testRegistry2
+	oversized.Description = strings.Repeat("a", int(common_api.MaxRequestBodySize))
+	code, err = suite.testAPI.RegistryCreate(*admin, &oversized)
+	assert.Nil(err)
+	assert.Equal(http.StatusRequestEntityTooLarge, code)
+
+	// Should fail when the port is invalid
+	invalid := *testRegistry2
+	invalid.URL = "http://registry:65536"
+	code, err = suite.testAPI.RegistryCreate(*admin, &invalid)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Should fail when the scheme is unsupported
+	invalid.URL = "ftp://registry:5000"
+	code, err = suite.testAPI.RegistryCreate(*admin, &invalid)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Should fail when the registry points to the local Harbor
+	invalid.URL = rep_config.Config.CoreURL
+	code, err = suite.testAPI.RegistryCreate(*admin, &invalid)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Should conflict when the equivalent URL and the same access key are used
+	duplicated := *testRegistry
+	duplicated.Name = "duplicated"
+	duplicated.URL = strings.ToUpper(testRegistry.URL) + ":443/"
+	code, err = suite.testAPI.RegistryCreate(*admin, &duplicated)
+	assert.Nil(err)
+	assert.Equal(http.StatusConflict, code)
+
+	// Should conflict when one of the failover URLs is the URL of the existing registry
+	duplicated.URL = "https://registry.failover.example.com"
+	duplicated.FailoverURLs = []string{testRegistry.URL}
+	code, err = suite.testAPI.RegistryCreate(*admin, &duplicated)
+	assert.Nil(err)
+	assert.Equal(http.StatusConflict, code)
 }
 
 func (suite *RegistrySuite) TestPing() {
@@ -122,17 +269,552 @@ func (suite *RegistrySuite) TestPing() {
 		ID: &id,
 	})
 	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	id = 0
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		ID: &id,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	id = 10000
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		ID: &id,
+	})
+	assert.Nil(err)
 	assert.Equal(http.StatusNotFound, code)
 
+	// the ID takes precedence, the registry is loaded by the ID and the provided URL overrides the loaded one
+	url := "https://127.0.0.1:1"
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		ID:  &suite.defaultRegistry.ID,
+		URL: &url,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
 	code, err = suite.testAPI.RegistryPing(*admin, nil)
 	assert.Nil(err)
 	assert.Equal(http.StatusBadRequest, code)
 
+	// invalid repository to validate the push permission
+	pushRepository := "Library/Hello-World"
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		ID:             &suite.defaultRegistry.ID,
+		PushRepository: &pushRepository,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// the plaintext registry on the non-standard port is accepted, it's unhealthy as nothing listens on it
+	typ := string(model.RegistryTypeDockerRegistry)
+	url = "http://127.0.0.1:5000"
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		Type: &typ,
+		URL:  &url,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	url = "http://127.0.0.1:65536"
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		Type: &typ,
+		URL:  &url,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
 	code, err = suite.testAPI.RegistryPing(*testUser, &pingReq{
 		ID: &suite.defaultRegistry.ID,
 	})
 	assert.Nil(err)
 	assert.Equal(http.StatusForbidden, code)
+
+	// the registry whose clock is skewed passes the ping with the warning unless failing is requested
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	url = server.URL
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		Type: &typ,
+		URL:  &url,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+
+	failOnClockSkew := true
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		Type:            &typ,
+		URL:             &url,
+		FailOnClockSkew: &failOnClockSkew,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// the primary endpoint is down, the ping fails over to the healthy one
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+	url = "http://127.0.0.1:1"
+	code, err = suite.testAPI.RegistryPing(*admin, &pingReq{
+		Type:         &typ,
+		URL:          &url,
+		FailoverURLs: []string{secondary.URL},
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+}
+
+func (suite *RegistrySuite) TestPingCache() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	reg := &model.Registry{
+		Name: "ping-cache",
+		URL:  server.URL,
+		Type: model.RegistryTypeDockerRegistry,
+	}
+	code, err := suite.testAPI.RegistryCreate(*admin, reg)
+	require.Nil(err)
+	require.Equal(http.StatusCreated, code)
+	tmp, err := dao.GetRegistryByName(reg.Name)
+	require.Nil(err)
+	require.NotNil(tmp)
+	defer suite.testAPI.RegistryDelete(*admin, tmp.ID)
+
+	result, code, err := suite.testAPI.RegistryPingWithResult(*admin, &pingReq{ID: &tmp.ID}, false)
+	require.Nil(err)
+	require.Equal(http.StatusOK, code)
+	assert.False(result.Cached)
+	pinged := atomic.LoadInt32(&hits)
+
+	// the second immediate ping returns the cached result without pinging the registry
+	result, code, err = suite.testAPI.RegistryPingWithResult(*admin, &pingReq{ID: &tmp.ID}, false)
+	require.Nil(err)
+	require.Equal(http.StatusOK, code)
+	assert.True(result.Cached)
+	assert.Equal(pinged, atomic.LoadInt32(&hits))
+
+	// the cache is bypassed
+	result, code, err = suite.testAPI.RegistryPingWithResult(*admin, &pingReq{ID: &tmp.ID}, true)
+	require.Nil(err)
+	require.Equal(http.StatusOK, code)
+	assert.False(result.Cached)
+	assert.True(atomic.LoadInt32(&hits) > pinged)
+
+	// the ping with the properties overriding the registry isn't cached
+	url := server.URL
+	result, code, err = suite.testAPI.RegistryPingWithResult(*admin, &pingReq{ID: &tmp.ID, URL: &url}, false)
+	require.Nil(err)
+	require.Equal(http.StatusOK, code)
+	assert.False(result.Cached)
+}
+
+func (suite *RegistrySuite) TestPingBatch() {
+	assert := assert.New(suite.T())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	typ := string(model.RegistryTypeDockerRegistry)
+	reachable := server.URL
+	unreachable := "http://127.0.0.1:1"
+	invalid := "ftp://127.0.0.1"
+	var notFound int64 = 10000
+	reqs := []*pingReq{
+		{Type: &typ, URL: &reachable},
+		{Type: &typ, URL: &unreachable},
+		{Type: &typ, URL: &invalid},
+		{ID: &notFound},
+	}
+
+	// Ping as user, should fail
+	_, code, err := suite.testAPI.RegistryPingBatch(*testUser, reqs)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Ping nothing, should fail
+	_, code, err = suite.testAPI.RegistryPingBatch(*admin, []*pingReq{})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Ping as admin, should succeed
+	results, code, err := suite.testAPI.RegistryPingBatch(*admin, reqs)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	if assert.Equal(4, len(results)) {
+		assert.Equal(reachable, results[0].URL)
+		assert.Equal(model.Healthy, results[0].Status)
+		assert.Empty(results[0].Error)
+
+		assert.Equal(unreachable, results[1].URL)
+		assert.Equal(model.Unhealthy, results[1].Status)
+		assert.NotEmpty(results[1].Error)
+		assert.Equal(registry.HintConnectionRefused, results[1].Hint)
+
+		assert.Equal(invalid, results[2].URL)
+		assert.Equal(model.Unknown, results[2].Status)
+		assert.NotEmpty(results[2].Error)
+
+		assert.Equal(notFound, results[3].ID)
+		assert.Equal(model.Unknown, results[3].Status)
+		assert.NotEmpty(results[3].Error)
+	}
+}
+
+func (suite *RegistrySuite) TestResetBreaker() {
+	assert := assert.New(suite.T())
+
+	id := suite.defaultRegistry.ID
+	for i := 0; i < registry.DefaultBreakerThreshold; i++ {
+		registry.Breaker.Fail(id)
+	}
+	assert.True(registry.Breaker.IsOpen(id))
+
+	// Reset as user, should fail
+	code, err := suite.testAPI.RegistryResetBreaker(*testUser, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+	assert.True(registry.Breaker.IsOpen(id))
+
+	// Reset a non-existed registry
+	code, err = suite.testAPI.RegistryResetBreaker(*admin, 10000)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// Reset as admin, should succeed
+	code, err = suite.testAPI.RegistryResetBreaker(*admin, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.False(registry.Breaker.IsOpen(id))
+	assert.Equal(0, registry.Breaker.Failures(id))
+}
+
+func (suite *RegistrySuite) TestWarmUp() {
+	assert := assert.New(suite.T())
+
+	id := suite.defaultRegistry.ID
+
+	// Warm up as user, should fail
+	_, code, err := suite.testAPI.RegistryWarmUp(*testUser, id, nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Warm up a non-existed registry
+	_, code, err = suite.testAPI.RegistryWarmUp(*admin, 10000, nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// Invalid count of connections
+	_, code, err = suite.testAPI.RegistryWarmUp(*admin, id, map[string]int{"connections": 0})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// The default count of connections is used if it isn't specified
+	status, code, err := suite.testAPI.RegistryWarmUp(*admin, id, nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(id, status.RegistryID)
+	assert.Equal(model.DefaultWarmupConnections, status.Requested)
+
+	status, code, err = suite.testAPI.RegistryWarmUp(*admin, id, map[string]int{"connections": 2})
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(2, status.Requested)
+
+	// Get the status of the warmup
+	_, code, err = suite.testAPI.RegistryGetWarmup(*testUser, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	_, code, err = suite.testAPI.RegistryGetWarmup(*admin, 10000)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	status, code, err = suite.testAPI.RegistryGetWarmup(*admin, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(id, status.RegistryID)
+}
+
+func (suite *RegistrySuite) TestPlaintextWarning() {
+	assert := assert.New(suite.T())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// the user is warned when creating the plaintext registry
+	reg := &model.Registry{
+		Name: "plaintext",
+		URL:  server.URL,
+		Type: model.RegistryTypeDockerRegistry,
+	}
+	warnings, code, err := suite.testAPI.RegistryCreateWithWarnings(*admin, reg)
+	assert.Nil(err)
+	assert.Equal(http.StatusCreated, code)
+	if assert.Equal(1, len(warnings)) {
+		assert.Contains(warnings[0], "plaintext HTTP")
+	}
+	tmp, err := dao.GetRegistryByName(reg.Name)
+	assert.Nil(err)
+	assert.NotNil(tmp)
+	defer suite.testAPI.RegistryDelete(*admin, tmp.ID)
+
+	// the user is warned when updating the plaintext registry
+	description := "plaintext"
+	warnings, code, err = suite.testAPI.RegistryUpdateWithWarnings(*admin, tmp.ID, &models.RegistryUpdateRequest{
+		Description: &description,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	if assert.Equal(1, len(warnings)) {
+		assert.Contains(warnings[0], server.URL)
+	}
+}
+
+func (suite *RegistrySuite) TestGetCapabilities() {
+	assert := assert.New(suite.T())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/_catalog" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	reg := &model.Registry{
+		Name: "capabilities",
+		URL:  server.URL,
+		Type: model.RegistryTypeDockerRegistry,
+	}
+	code, err := suite.testAPI.RegistryCreate(*admin, reg)
+	assert.Nil(err)
+	assert.Equal(http.StatusCreated, code)
+	tmp, err := dao.GetRegistryByName(reg.Name)
+	assert.Nil(err)
+	assert.NotNil(tmp)
+	defer suite.testAPI.RegistryDelete(*admin, tmp.ID)
+
+	// Get as user, should fail
+	_, code, err = suite.testAPI.RegistryGetCapabilities(*testUser, tmp.ID)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Get a non-existed registry
+	_, code, err = suite.testAPI.RegistryGetCapabilities(*admin, 10000)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// Get as admin, should succeed
+	capabilities, code, err := suite.testAPI.RegistryGetCapabilities(*admin, tmp.ID)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(adapter.CapabilitySupported, capabilities[adapter.CapabilityCatalog])
+	assert.Equal(adapter.CapabilityUnsupported, capabilities[adapter.CapabilityReferrers])
+}
+
+func (suite *RegistrySuite) TestListRepositories() {
+	assert := assert.New(suite.T())
+
+	// the catalog is served in the pages of two repositories
+	repositories := []string{"library/a", "library/b", "library/c", "library/d", "library/e"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			http.NotFound(w, r)
+			return
+		}
+		begin := 0
+		if last := r.URL.Query().Get("last"); len(last) > 0 {
+			for i, repository := range repositories {
+				if repository == last {
+					begin = i + 1
+				}
+			}
+		}
+		end := begin + 2
+		if end < len(repositories) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?last=%s&n=2>; rel="next"`, repositories[end-1]))
+		} else {
+			end = len(repositories)
+		}
+		b, _ := json.Marshal(map[string][]string{"repositories": repositories[begin:end]})
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	reg := &model.Registry{
+		Name: "repositories",
+		URL:  server.URL,
+		Type: model.RegistryTypeDockerRegistry,
+	}
+	code, err := suite.testAPI.RegistryCreate(*admin, reg)
+	assert.Nil(err)
+	assert.Equal(http.StatusCreated, code)
+	tmp, err := dao.GetRegistryByName(reg.Name)
+	assert.Nil(err)
+	assert.NotNil(tmp)
+	defer suite.testAPI.RegistryDelete(*admin, tmp.ID)
+
+	// List as user, should fail
+	_, code, err = suite.testAPI.RegistryListRepositories(*testUser, tmp.ID)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// List a non-existed registry
+	_, code, err = suite.testAPI.RegistryListRepositories(*admin, 10000)
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// List as admin, all the pages are streamed as one array
+	repos, code, err := suite.testAPI.RegistryListRepositories(*admin, tmp.ID)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(repositories, repos)
+}
+
+func (suite *RegistrySuite) TestDeleteTag() {
+	assert := assert.New(suite.T())
+
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	// the tag "v1" refers to the same manifest as "latest" in the repository "library/shared"
+	newServer := func(deletable bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodHead && (r.URL.Path == "/v2/library/hello-world/manifests/latest" ||
+				r.URL.Path == "/v2/library/shared/manifests/latest" || r.URL.Path == "/v2/library/shared/manifests/v1"):
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/library/shared/manifests/v2":
+				w.Header().Set("Docker-Content-Digest", "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+				w.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/library/hello-world/tags/list":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name":"library/hello-world","tags":["latest"]}`))
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/library/shared/tags/list":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name":"library/shared","tags":["latest","v1","v2"]}`))
+			case r.Method == http.MethodDelete && r.URL.Path == "/v2/library/shared/manifests/"+digest:
+				w.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodDelete && r.URL.Path == "/v2/library/hello-world/manifests/"+digest:
+				if deletable {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	createRegistry := func(name, url string) int64 {
+		code, err := suite.testAPI.RegistryCreate(*admin, &model.Registry{
+			Name: name,
+			URL:  url,
+			Type: model.RegistryTypeDockerRegistry,
+		})
+		assert.Nil(err)
+		assert.Equal(http.StatusCreated, code)
+		reg, err := dao.GetRegistryByName(name)
+		assert.Nil(err)
+		assert.NotNil(reg)
+		return reg.ID
+	}
+
+	server := newServer(true)
+	defer server.Close()
+	id := createRegistry("deletable", server.URL)
+	defer suite.testAPI.RegistryDelete(*admin, id)
+
+	// Delete as user, should fail
+	code, err := suite.testAPI.RegistryDeleteTag(*testUser, id, "library/hello-world", "latest")
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Delete on a non-existed registry
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, 10000, "library/hello-world", "latest")
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// Delete a non-existed tag
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, id, "library/hello-world", "non-existed")
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, code)
+
+	// Delete as admin, should succeed
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, id, "library/hello-world", "latest")
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+
+	// Delete the tag sharing the manifest with another tag, should be refused without force
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, id, "library/shared", "latest")
+	assert.Nil(err)
+	assert.Equal(http.StatusConflict, code)
+
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, id, "library/shared", "latest", true)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+
+	// Delete on the registry which doesn't allow deleting
+	undeletable := newServer(false)
+	defer undeletable.Close()
+	id = createRegistry("undeletable", undeletable.URL)
+	defer suite.testAPI.RegistryDelete(*admin, id)
+	code, err = suite.testAPI.RegistryDeleteTag(*admin, id, "library/hello-world", "latest")
+	assert.Nil(err)
+	assert.Equal(http.StatusMethodNotAllowed, code)
+}
+
+func (suite *RegistrySuite) TestExportAndImport() {
+	assert := assert.New(suite.T())
+
+	// Export as user, should fail
+	_, code, err := suite.testAPI.RegistryExport(*testUser)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Export as admin, should succeed
+	doc, code, err := suite.testAPI.RegistryExport(*admin)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	if assert.NotNil(doc) && assert.Equal(1, len(doc.Registries)) {
+		assert.Equal(testRegistry.Name, doc.Registries[0].Name)
+	}
+
+	// Import as user, should fail
+	_, code, err = suite.testAPI.RegistryImport(*testUser, doc, false)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Import an invalid document
+	_, code, err = suite.testAPI.RegistryImport(*admin, &registry.ExportDocument{Version: "0.1"}, false)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Import as admin, the existing registry should be skipped
+	result, code, err := suite.testAPI.RegistryImport(*admin, doc, false)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	if assert.NotNil(result) {
+		assert.Equal([]string{testRegistry.Name}, result.Skipped)
+	}
 }
 
 func (suite *RegistrySuite) TestRegistryPut() {
@@ -151,16 +833,209 @@ func (suite *RegistrySuite) TestRegistryPut() {
 	assert.Equal(http.StatusOK, code)
 	assert.Equal("foobar", updated.Description)
 
+	// Update with an invalid port, should fail
+	url := "http://registry:0"
+	code, err = suite.testAPI.RegistryUpdate(*admin, suite.defaultRegistry.ID, &models.RegistryUpdateRequest{
+		URL: &url,
+	})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
 	// Update as user, should fail
 	code, err = suite.testAPI.RegistryUpdate(*testUser, suite.defaultRegistry.ID, updateReq)
 	assert.NotNil(err)
 	assert.Equal(http.StatusForbidden, code)
 }
 
+func (suite *RegistrySuite) TestRegistryPatch() {
+	assert := assert.New(suite.T())
+	id := suite.defaultRegistry.ID
+
+	code, err := suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType,
+		`{"description": "foo", "user_agent": "agent", "max_connections": 2}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+
+	// the omitted fields are untouched and the ones set to null are cleared
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType,
+		`{"user_agent": null, "max_connections": 3}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	updated, code, err := suite.testAPI.RegistryGet(*admin, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("foo", updated.Description)
+	assert.Equal("", updated.UserAgent)
+	assert.Equal(3, updated.MaxConnections)
+
+	// the job retention days cannot be negative
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"job_retention_days": -1}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// the required field cannot be null
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"url": null}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// unknown field
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"unknown": "foo"}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// unsupported content type
+	code, err = suite.testAPI.RegistryPatch(*admin, id, "application/json", `{"description": "bar"}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusUnsupportedMediaType, code)
+
+	// patch as user, should fail
+	code, err = suite.testAPI.RegistryPatch(*testUser, id, mergePatchMediaType, `{"description": "bar"}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, code)
+}
+
+// anonymousRegistryManager returns the registries without credential and records the updates
+type anonymousRegistryManager struct {
+	registry.Manager
+	updated *model.Registry
+}
+
+func (a *anonymousRegistryManager) Get(id int64) (*model.Registry, error) {
+	r, err := a.Manager.Get(id)
+	if r != nil {
+		r.Credential = nil
+	}
+	return r, err
+}
+
+func (a *anonymousRegistryManager) Update(r *model.Registry, props ...string) error {
+	a.updated = r
+	return nil
+}
+
+func (suite *RegistrySuite) TestRegistryPatchAnonymous() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+	id := suite.defaultRegistry.ID
+	registryMgr := replication.RegistryMgr
+	defer func() {
+		replication.RegistryMgr = registryMgr
+	}()
+	mgr := &anonymousRegistryManager{Manager: registryMgr}
+	replication.RegistryMgr = mgr
+
+	// clearing the credential of the anonymous registry is a no-op
+	code, err := suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType,
+		`{"credential_type": null, "access_key": null, "access_secret": null}`)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	require.NotNil(mgr.updated)
+	assert.Nil(mgr.updated.Credential)
+
+	// the credential is added to the anonymous registry
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType,
+		`{"credential_type": "basic", "access_key": "admin", "access_secret": "Harbor12345"}`)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	require.NotNil(mgr.updated.Credential)
+	assert.Equal(model.CredentialType(model.CredentialTypeBasic), mgr.updated.Credential.Type)
+	assert.Equal("admin", mgr.updated.Credential.AccessKey)
+	assert.Equal("Harbor12345", mgr.updated.Credential.AccessSecret)
+}
+
+func (suite *RegistrySuite) TestRegistryDraining() {
+	assert := assert.New(suite.T())
+	id := suite.defaultRegistry.ID
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	ctl := &fakedOperationController{}
+	replication.OperationCtl = ctl
+
+	code, err := suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"draining": true}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	updated, code, err := suite.testAPI.RegistryGet(*admin, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.True(updated.Draining)
+	assert.Equal(int64(0), ctl.resumed)
+
+	// the deferred tasks are resumed when the draining ends
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"draining": null}`)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	updated, code, err = suite.testAPI.RegistryGet(*admin, id)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.False(updated.Draining)
+	assert.Equal(id, ctl.resumed)
+}
+
+func (suite *RegistrySuite) TestRegistryDefault() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+	id := suite.defaultRegistry.ID
+
+	code, err := suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"default": true}`)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	updated, code, err := suite.testAPI.RegistryGet(*admin, id)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.True(updated.Default)
+
+	// the new default registry clears the previous one
+	another, err := replication.RegistryMgr.Add(&model.Registry{
+		Name:    "default-test",
+		URL:     "https://default-test.harbor.io",
+		Type:    "harbor",
+		Default: true,
+	})
+	require.Nil(err)
+	defer replication.RegistryMgr.Remove(another)
+	updated, code, err = suite.testAPI.RegistryGet(*admin, id)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	assert.False(updated.Default)
+	r, err := replication.RegistryMgr.GetDefault()
+	require.Nil(err)
+	require.NotNil(r)
+	assert.Equal(another, r.ID)
+
+	// toggling the default on clears the previous one and toggling it off leaves no default
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"default": true}`)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	r, err = replication.RegistryMgr.GetDefault()
+	require.Nil(err)
+	require.NotNil(r)
+	assert.Equal(id, r.ID)
+	code, err = suite.testAPI.RegistryPatch(*admin, id, mergePatchMediaType, `{"default": null}`)
+	require.Nil(err)
+	assert.Equal(http.StatusOK, code)
+	r, err = replication.RegistryMgr.GetDefault()
+	require.Nil(err)
+	assert.Nil(r)
+}
+
 func (suite *RegistrySuite) TestDelete() {
 	assert := assert.New(suite.T())
 
-	code, err := suite.testAPI.RegistryCreate(*admin, testRegistry2)
+	// the registry with the same URL as the default one is rejected as the duplicate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/_catalog" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	reg := *testRegistry2
+	reg.URL = server.URL
+	reg.Type = model.RegistryTypeDockerRegistry
+	code, err := suite.testAPI.RegistryCreate(*admin, &reg)
 	assert.Nil(err)
 	assert.Equal(http.StatusCreated, code)
 
@@ -182,3 +1057,88 @@ func (suite *RegistrySuite) TestDelete() {
 func TestRegistrySuite(t *testing.T) {
 	suite.Run(t, new(RegistrySuite))
 }
+
+func TestMergeSSHTunnel(t *testing.T) {
+	current := &registry_pkg.SSHTunnel{
+		Host:       "jump.example.com",
+		User:       "harbor",
+		PrivateKey: "key",
+	}
+	// the current private key is kept if the requested one is empty
+	tunnel := mergeSSHTunnel(current, &registry_pkg.SSHTunnel{Host: "jump2.example.com", User: "harbor"})
+	assert.Equal(t, "jump2.example.com", tunnel.Host)
+	assert.Equal(t, "key", tunnel.PrivateKey)
+	tunnel = mergeSSHTunnel(current, &registry_pkg.SSHTunnel{Host: "jump.example.com", User: "harbor", PrivateKey: "key2"})
+	assert.Equal(t, "key2", tunnel.PrivateKey)
+	tunnel = mergeSSHTunnel(nil, &registry_pkg.SSHTunnel{Host: "jump.example.com", User: "harbor"})
+	assert.Empty(t, tunnel.PrivateKey)
+
+	// the private key is hidden in the copy
+	hidden := hidePrivateKey(current)
+	assert.Empty(t, hidden.PrivateKey)
+	assert.Equal(t, "jump.example.com", hidden.Host)
+	assert.Equal(t, "key", current.PrivateKey)
+	assert.Nil(t, hidePrivateKey(nil))
+}
+
+func TestSanitizeRegistry(t *testing.T) {
+	r := &model.Registry{
+		ID: 1,
+		Credential: &model.Credential{
+			Type:         model.CredentialTypeBasic,
+			AccessKey:    "admin",
+			AccessSecret: "password",
+		},
+		Headers: map[string]string{"X-Api-Key": "token"},
+		SSHTunnel: &registry_pkg.SSHTunnel{
+			Host:       "jump.example.com",
+			User:       "harbor",
+			PrivateKey: "key",
+		},
+	}
+
+	// the secret of the credential is masked
+	sanitized := sanitizeRegistry(r)
+	assert.Equal(t, "admin", sanitized.Credential.AccessKey)
+	assert.Equal(t, maskedSecret, sanitized.Credential.AccessSecret)
+	assert.Equal(t, map[string]string{"X-Api-Key": maskedSecret}, sanitized.Headers)
+	assert.Empty(t, sanitized.SSHTunnel.PrivateKey)
+	assert.Equal(t, "jump.example.com", sanitized.SSHTunnel.Host)
+
+	// the registry isn't modified
+	assert.Equal(t, "password", r.Credential.AccessSecret)
+	assert.Equal(t, "token", r.Headers["X-Api-Key"])
+	assert.Equal(t, "key", r.SSHTunnel.PrivateKey)
+
+	assert.Nil(t, sanitizeRegistry(nil))
+}
+
+func TestMergeHeaders(t *testing.T) {
+	current := map[string]string{"X-Api-Key": "token", "X-Removed": "value"}
+	headers := mergeHeaders(current, map[string]string{
+		"X-Api-Key": maskedSecret,
+		"X-New":     "new",
+		"X-Masked":  maskedSecret,
+	})
+	// the masked value is kept for the current header only
+	assert.Equal(t, map[string]string{
+		"X-Api-Key": "token",
+		"X-New":     "new",
+		"X-Masked":  maskedSecret,
+	}, headers)
+	assert.Empty(t, mergeHeaders(current, map[string]string{}))
+}
+
+func TestBatchRequestBodyLimit(t *testing.T) {
+	size := common_api.MaxRequestBodySize
+	defer func() {
+		common_api.MaxRequestBodySize = size
+	}()
+
+	common_api.MaxRequestBodySize = 1 << 20
+	assert.Equal(t, maxBatchRequestBodySize, batchRequestBodyLimit())
+
+	// raised by MAX_REQUEST_BODY_SIZE
+	common_api.MaxRequestBodySize = maxBatchRequestBodySize + 1
+	assert.Equal(t, maxBatchRequestBodySize+1, batchRequestBodyLimit())
+}
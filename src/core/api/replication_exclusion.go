@@ -0,0 +1,121 @@
+// Copyright 2018 Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/util"
+)
+
+// the max length of the pattern of the exclusion
+const maxExclusionPatternLength = 256
+
+// ReplicationExclusionAPI handles the requests of the repositories excluded from replication globally
+type ReplicationExclusionAPI struct {
+	BaseController
+}
+
+// Prepare ...
+func (r *ReplicationExclusionAPI) Prepare() {
+	r.BaseController.Prepare()
+	if !r.SecurityCtx.IsSysAdmin() {
+		if !r.SecurityCtx.IsAuthenticated() {
+			r.SendUnAuthorizedError(errors.New("UnAuthorized"))
+			return
+		}
+		r.SendForbiddenError(errors.New(r.SecurityCtx.GetUsername()))
+		return
+	}
+}
+
+// List the exclusions
+func (r *ReplicationExclusionAPI) List() {
+	exclusions, err := replication.ExclusionMgr.List()
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list the exclusions: %v", err))
+		return
+	}
+	r.WriteJSONData(exclusions)
+}
+
+// Create an exclusion, the repositories matching its pattern are skipped by all the policies
+func (r *ReplicationExclusionAPI) Create() {
+	exclusion := &models.Exclusion{}
+	if err := r.DecodeJSONReq(exclusion); err != nil {
+		r.SendBadRequestError(err)
+		return
+	}
+	exclusion.Pattern = strings.TrimSpace(exclusion.Pattern)
+	// the empty pattern matches all the repositories
+	if len(exclusion.Pattern) == 0 {
+		r.SendBadRequestError(errors.New("empty pattern"))
+		return
+	}
+	if len(exclusion.Pattern) > maxExclusionPatternLength {
+		r.SendBadRequestError(fmt.Errorf("the length of the pattern exceeds %d", maxExclusionPatternLength))
+		return
+	}
+	// the pattern is checked lazily when matching, match it with itself to reach all its parts
+	if _, err := util.Match(exclusion.Pattern, exclusion.Pattern); err != nil {
+		r.SendBadRequestError(fmt.Errorf("invalid pattern %s: %v", exclusion.Pattern, err))
+		return
+	}
+	exclusions, err := replication.ExclusionMgr.List()
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list the exclusions: %v", err))
+		return
+	}
+	for _, e := range exclusions {
+		if e.Pattern == exclusion.Pattern {
+			r.SendConflictError(fmt.Errorf("the pattern %s is already excluded", exclusion.Pattern))
+			return
+		}
+	}
+	id, err := replication.ExclusionMgr.Create(exclusion)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to create the exclusion: %v", err))
+		return
+	}
+	r.Redirect(http.StatusCreated, strconv.FormatInt(id, 10))
+}
+
+// Delete the exclusion
+func (r *ReplicationExclusionAPI) Delete() {
+	id, err := r.GetInt64FromPath(":id")
+	if err != nil || id <= 0 {
+		r.SendBadRequestError(errors.New("invalid exclusion ID"))
+		return
+	}
+	exclusion, err := replication.ExclusionMgr.Get(id)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get the exclusion %d: %v", id, err))
+		return
+	}
+	if exclusion == nil {
+		r.SendNotFoundError(fmt.Errorf("exclusion %d not found", id))
+		return
+	}
+	if err = replication.ExclusionMgr.Remove(id); err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to delete the exclusion %d: %v", id, err))
+		return
+	}
+}
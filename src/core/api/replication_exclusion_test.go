@@ -0,0 +1,218 @@
+// Copyright 2018 Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+)
+
+type fakedExclusionManager struct{}
+
+func (f *fakedExclusionManager) Create(*models.Exclusion) (int64, error) {
+	return 2, nil
+}
+func (f *fakedExclusionManager) List() ([]*models.Exclusion, error) {
+	return []*models.Exclusion{
+		{
+			ID:      1,
+			Pattern: "secrets/**",
+		},
+	}, nil
+}
+func (f *fakedExclusionManager) Get(id int64) (*models.Exclusion, error) {
+	if id == 1 {
+		return &models.Exclusion{
+			ID:      1,
+			Pattern: "secrets/**",
+		}, nil
+	}
+	return nil, nil
+}
+func (f *fakedExclusionManager) Remove(int64) error {
+	return nil
+}
+func (f *fakedExclusionManager) Audit(string) error {
+	return nil
+}
+
+func TestListExclusions(t *testing.T) {
+	exclusionMgr := replication.ExclusionMgr
+	defer func() {
+		replication.ExclusionMgr = exclusionMgr
+	}()
+	replication.ExclusionMgr = &fakedExclusionManager{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/exclusions",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/exclusions",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/exclusions",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestCreateExclusion(t *testing.T) {
+	exclusionMgr := replication.ExclusionMgr
+	defer func() {
+		replication.ExclusionMgr = exclusionMgr
+	}()
+	replication.ExclusionMgr = &fakedExclusionManager{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/exclusions",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/exclusions",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400, empty pattern
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/exclusions",
+				bodyJSON: &models.Exclusion{
+					Pattern: " ",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, invalid pattern
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/exclusions",
+				bodyJSON: &models.Exclusion{
+					Pattern: "library/[a-",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 409
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/exclusions",
+				bodyJSON: &models.Exclusion{
+					Pattern: "secrets/**",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusConflict,
+		},
+		// 201
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/exclusions",
+				bodyJSON: &models.Exclusion{
+					Pattern:     "internal/*",
+					Description: "the internal images",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusCreated,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestDeleteExclusion(t *testing.T) {
+	exclusionMgr := replication.ExclusionMgr
+	defer func() {
+		replication.ExclusionMgr = exclusionMgr
+	}()
+	replication.ExclusionMgr = &fakedExclusionManager{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodDelete,
+				url:    "/api/replication/exclusions/1",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodDelete,
+				url:        "/api/replication/exclusions/1",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404
+		{
+			request: &testingRequest{
+				method:     http.MethodDelete,
+				url:        "/api/replication/exclusions/2",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodDelete,
+				url:        "/api/replication/exclusions/1",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
@@ -15,18 +15,55 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/astaxie/beego/context"
 	common_http "github.com/goharbor/harbor/src/common/http"
+	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/replication"
+	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/event"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
+	"github.com/goharbor/harbor/src/replication/policy/scheduler"
+	"github.com/goharbor/harbor/src/replication/transfer"
 )
 
+// the action to retry the failed replication tasks
+const replicationActionRetryFailed = "retry_failed"
+
+// replicationActionRequest is the request of the bulk actions against the replication tasks
+type replicationActionRequest struct {
+	Action   string     `json:"action"`
+	PolicyID int64      `json:"policy_id"`
+	Since    *time.Time `json:"since"`
+	Until    *time.Time `json:"until"`
+}
+
+// singleReplicationRequest is the request of replicating one tag of the repository on the local Harbor
+type singleReplicationRequest struct {
+	TargetID   int64  `json:"target_id"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+}
+
+// executionRetryResult is the result of retrying the failed repositories of the execution
+type executionRetryResult struct {
+	// the ID of the child execution started
+	ExecutionID int64 `json:"execution_id"`
+	ParentID    int64 `json:"parent_id"`
+	// the repositories retried by the child execution
+	Repositories []string `json:"repositories"`
+}
+
 // ReplicationOperationAPI handles the replication operation requests
 type ReplicationOperationAPI struct {
 	BaseController
@@ -92,6 +129,12 @@ func (r *ReplicationOperationAPI) ListExecutions() {
 		}
 		query.PolicyID = policyID
 	}
+	annotations, err := parseAnnotationFilters(r.GetStrings("annotation"))
+	if err != nil {
+		r.SendBadRequestError(err)
+		return
+	}
+	query.Annotations = annotations
 	page, size, err := r.GetPaginationParams()
 	if err != nil {
 		r.SendBadRequestError(err)
@@ -99,6 +142,13 @@ func (r *ReplicationOperationAPI) ListExecutions() {
 	}
 	query.Page = page
 	query.Size = size
+	if sort := r.GetString("sort"); len(sort) > 0 {
+		if _, err = models.ParseSort(sort, models.ExecutionSortableFields); err != nil {
+			r.SendBadRequestError(err)
+			return
+		}
+		query.Sort = sort
+	}
 
 	total, executions, err := replication.OperationCtl.ListExecutions(query)
 	if err != nil {
@@ -113,6 +163,10 @@ func (r *ReplicationOperationAPI) ListExecutions() {
 func (r *ReplicationOperationAPI) CreateExecution() {
 	execution := &models.Execution{}
 	if err := r.DecodeJSONReq(execution); err != nil {
+		r.SendDecodeJSONReqError(err)
+		return
+	}
+	if err := validateAnnotations(execution.Annotations); err != nil {
 		r.SendBadRequestError(err)
 		return
 	}
@@ -135,8 +189,10 @@ func (r *ReplicationOperationAPI) CreateExecution() {
 		return
 	}
 
+	// the dry run only applies to this execution
+	policy.DryRun = execution.DryRun
 	trigger := r.GetString("trigger", string(model.TriggerTypeManual))
-	executionID, err := replication.OperationCtl.StartReplication(policy, nil, model.TriggerType(trigger))
+	executionID, err := replication.OperationCtl.StartReplication(policy, nil, model.TriggerType(trigger), execution.Annotations)
 	if err != nil {
 		r.SendInternalServerError(fmt.Errorf("failed to start replication for policy %d: %v", execution.PolicyID, err))
 		return
@@ -144,6 +200,203 @@ func (r *ReplicationOperationAPI) CreateExecution() {
 	r.Redirect(http.StatusCreated, strconv.FormatInt(executionID, 10))
 }
 
+// CreateSingleExecution replicates exactly one tag of the repository on the local Harbor to the
+// registry specified by "target_id" on demand, e.g. for promoting an image. No policy is involved
+func (r *ReplicationOperationAPI) CreateSingleExecution() {
+	req := &singleReplicationRequest{}
+	if err := r.DecodeJSONReq(req); err != nil {
+		r.SendDecodeJSONReqError(err)
+		return
+	}
+	if len(req.Repository) == 0 || len(req.Tag) == 0 {
+		r.SendBadRequestError(errors.New("the repository and tag are required"))
+		return
+	}
+
+	target, err := replication.RegistryMgr.Get(req.TargetID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get registry %d: %v", req.TargetID, err))
+		return
+	}
+	if target == nil {
+		r.SendNotFoundError(fmt.Errorf("registry %d not found", req.TargetID))
+		return
+	}
+
+	local := event.GetLocalRegistry()
+	policy := &model.Policy{
+		Name:         fmt.Sprintf("%s:%s", req.Repository, req.Tag),
+		SrcRegistry:  local,
+		DestRegistry: target,
+		Override:     true,
+		Enabled:      true,
+	}
+	resource := &model.Resource{
+		Type:     model.ResourceTypeImage,
+		Registry: local,
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: req.Repository,
+			},
+			Vtags: []string{req.Tag},
+		},
+	}
+	// the flow would skip the repository denied by the exclusions or the allowed projects silently,
+	// the draining and blackout of the target are handled by the scheduler as the policies' ones
+	reason, err := flow.CheckResource(policy, resource)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to check the repository %s: %v", req.Repository, err))
+		return
+	}
+	if len(reason) > 0 {
+		r.SendForbiddenError(errors.New(reason))
+		return
+	}
+
+	exist, err := imageExists(local, req.Repository, req.Tag)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to check the existence of %s:%s: %v", req.Repository, req.Tag, err))
+		return
+	}
+	if !exist {
+		r.SendNotFoundError(fmt.Errorf("tag %s of repository %s not found", req.Tag, req.Repository))
+		return
+	}
+
+	executionID, err := replication.OperationCtl.StartReplication(policy, resource, model.TriggerTypeManual, nil)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to start the replication of %s:%s: %v", req.Repository, req.Tag, err))
+		return
+	}
+	// the location of the execution rather than the one under the request URI
+	r.Ctx.Redirect(http.StatusCreated, executionLocation(executionID))
+}
+
+// executionLocation returns the location of the execution
+func executionLocation(id int64) string {
+	return "/api/replication/executions/" + strconv.FormatInt(id, 10)
+}
+
+// ListSchedule returns the next runs of all the enabled scheduled policies, sorted soonest first.
+// The runs can be filtered by "target" which matches either the source or destination registry
+func (r *ReplicationOperationAPI) ListSchedule() {
+	var targetID int64
+	if len(r.GetString("target")) > 0 {
+		id, err := r.GetInt64("target")
+		if err != nil || id <= 0 {
+			r.SendBadRequestError(fmt.Errorf("invalid target %s", r.GetString("target")))
+			return
+		}
+		targetID = id
+	}
+
+	_, policies, err := replication.PolicyCtl.List()
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list policies: %v", err))
+		return
+	}
+	runs := []*scheduler.ScheduledRun{}
+	for _, run := range scheduler.UpcomingRuns(policies, time.Now(), replication.RegistryMgr.Get) {
+		if targetID > 0 && run.SrcRegistryID != targetID && run.DestRegistryID != targetID {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	r.WriteJSONData(runs)
+}
+
+// imageExists returns whether the tag of the repository exists on the registry
+func imageExists(registry *model.Registry, repository, tag string) (bool, error) {
+	factory, err := adapter.GetFactory(registry.Type)
+	if err != nil {
+		return false, err
+	}
+	adp, err := factory(registry)
+	if err != nil {
+		return false, err
+	}
+	imageRegistry, ok := adp.(adapter.ImageRegistry)
+	if !ok {
+		return false, fmt.Errorf("the registry type %s doesn't support images", registry.Type)
+	}
+	exist, _, err := imageRegistry.ManifestExist(repository, tag)
+	return exist, err
+}
+
+// the keys of the annotations can't be empty or contain ":" which separates the key and the value
+// when filtering the executions by the annotations
+func validateAnnotations(annotations map[string]string) error {
+	for key := range annotations {
+		if len(key) == 0 {
+			return errors.New("empty annotation key")
+		}
+		if strings.Contains(key, ":") {
+			return fmt.Errorf("invalid annotation key %s: contains \":\"", key)
+		}
+	}
+	return nil
+}
+
+// parse the annotation filters in the format of "key:value", the value can be empty
+func parseAnnotationFilters(filters []string) (map[string]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	annotations := map[string]string{}
+	for _, filter := range filters {
+		strs := strings.SplitN(filter, ":", 2)
+		if len(strs) != 2 || len(strs[0]) == 0 {
+			return nil, fmt.Errorf("invalid annotation %s: should be in the format of key:value", filter)
+		}
+		annotations[strs[0]] = strs[1]
+	}
+	return annotations, nil
+}
+
+// ExecuteAction performs the bulk action against the replication tasks, only
+// "retry_failed" which re-submits the failed tasks is supported currently
+func (r *ReplicationOperationAPI) ExecuteAction() {
+	req := &replicationActionRequest{}
+	if err := r.DecodeJSONReq(req); err != nil {
+		r.SendDecodeJSONReqError(err)
+		return
+	}
+	if req.Action != replicationActionRetryFailed {
+		r.SendBadRequestError(fmt.Errorf("unsupported action %s", req.Action))
+		return
+	}
+	if req.PolicyID < 0 {
+		r.SendBadRequestError(fmt.Errorf("invalid policy_id %d", req.PolicyID))
+		return
+	}
+	if req.Since != nil && req.Until != nil && req.Since.After(*req.Until) {
+		r.SendBadRequestError(errors.New("the since must be earlier than the until"))
+		return
+	}
+	if req.PolicyID > 0 {
+		policy, err := replication.PolicyCtl.Get(req.PolicyID)
+		if err != nil {
+			r.SendInternalServerError(fmt.Errorf("failed to get policy %d: %v", req.PolicyID, err))
+			return
+		}
+		if policy == nil {
+			r.SendNotFoundError(fmt.Errorf("policy %d not found", req.PolicyID))
+			return
+		}
+	}
+
+	count, err := replication.OperationCtl.RetryFailedTasks(req.PolicyID, req.Since, req.Until)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to retry the failed tasks: %v", err))
+		return
+	}
+	r.WriteJSONData(struct {
+		Count int `json:"count"`
+	}{
+		Count: count,
+	})
+}
+
 // GetExecution gets one execution of the replication
 func (r *ReplicationOperationAPI) GetExecution() {
 	executionID, err := r.GetInt64FromPath(":id")
@@ -161,9 +414,151 @@ func (r *ReplicationOperationAPI) GetExecution() {
 		r.SendNotFoundError(fmt.Errorf("execution %d not found", executionID))
 		return
 	}
+	if err = populateExecutionFailures(execution); err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get the failures of execution %d: %v", executionID, err))
+		return
+	}
+	// grouping the results by the targets lists all the tasks of the execution, which may be huge,
+	// so it's only done when asked for
+	withTargets, err := r.GetBool("with_targets", false)
+	if err != nil {
+		r.SendBadRequestError(fmt.Errorf("invalid with_targets %s", r.GetString("with_targets")))
+		return
+	}
+	if withTargets {
+		if err = populateExecutionTargets(execution); err != nil {
+			r.SendInternalServerError(fmt.Errorf("failed to get the results of the targets of execution %d: %v", executionID, err))
+			return
+		}
+	}
 	r.WriteJSONData(execution)
 }
 
+// RetryExecution starts a child execution which only replicates the repositories failed in the
+// execution, so the repositories succeeded aren't transferred again
+func (r *ReplicationOperationAPI) RetryExecution() {
+	executionID, err := r.GetInt64FromPath(":id")
+	if err != nil || executionID <= 0 {
+		r.SendBadRequestError(errors.New("invalid execution ID"))
+		return
+	}
+	execution, err := replication.OperationCtl.GetExecution(executionID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get execution %d: %v", executionID, err))
+		return
+	}
+	if execution == nil {
+		r.SendNotFoundError(fmt.Errorf("execution %d not found", executionID))
+		return
+	}
+	// the tasks of the running execution may still fail
+	if execution.Status == models.ExecutionStatusInProgress {
+		r.SendConflictError(fmt.Errorf("execution %d is in progress", executionID))
+		return
+	}
+
+	policy, err := replication.PolicyCtl.Get(execution.PolicyID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get policy %d: %v", execution.PolicyID, err))
+		return
+	}
+	if policy == nil {
+		r.SendNotFoundError(fmt.Errorf("policy %d not found", execution.PolicyID))
+		return
+	}
+	if !policy.Enabled {
+		r.SendBadRequestError(fmt.Errorf("the policy %d is disabled", execution.PolicyID))
+		return
+	}
+	if err = event.PopulateRegistries(replication.RegistryMgr, policy); err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to populate registries for policy %d: %v", execution.PolicyID, err))
+		return
+	}
+
+	id, repositories, err := replication.OperationCtl.RetryFailedRepositories(policy, executionID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to retry the failed repositories of execution %d: %v", executionID, err))
+		return
+	}
+	if id == 0 {
+		r.SendBadRequestError(fmt.Errorf("no repository failed in execution %d", executionID))
+		return
+	}
+	r.Ctx.Output.Header("Location", executionLocation(id))
+	r.Ctx.Output.SetStatus(http.StatusCreated)
+	r.WriteJSONData(&executionRetryResult{
+		ExecutionID:  id,
+		ParentID:     executionID,
+		Repositories: repositories,
+	})
+}
+
+// populate the failed tasks of the finished execution, so that which repositories failed and
+// why can be known without listing all the tasks
+func populateExecutionFailures(execution *models.Execution) error {
+	if execution.Status != models.ExecutionStatusFailed &&
+		execution.Status != models.ExecutionStatusPartialSucceed {
+		return nil
+	}
+	tasks, err := listExecutionTasks(execution.ID, models.TaskStatusFailed)
+	if err != nil {
+		return err
+	}
+	execution.Failures = []*models.TaskFailure{}
+	for _, task := range tasks {
+		execution.Failures = append(execution.Failures, &models.TaskFailure{
+			TaskID:      task.ID,
+			Repository:  task.Repository,
+			SrcResource: task.SrcResource,
+			DstResource: task.DstResource,
+			Reason:      task.StatusText,
+		})
+	}
+	return nil
+}
+
+// populate the results of the tasks of the execution grouped by their destination registries,
+// so it's easy to see which destination registry lags behind. The tasks created before the
+// destination registry is recorded are grouped to the destination registry of the policy
+func populateExecutionTargets(execution *models.Execution) error {
+	tasks, err := listExecutionTasks(execution.ID)
+	if err != nil {
+		return err
+	}
+	var policy *model.Policy
+	for _, task := range tasks {
+		if task.DstRegistryID != 0 {
+			continue
+		}
+		if policy == nil {
+			if policy, err = replication.PolicyCtl.Get(execution.PolicyID); err != nil {
+				return err
+			}
+			if policy == nil || policy.DestRegistry == nil {
+				break
+			}
+		}
+		task.DstRegistryID = policy.DestRegistry.ID
+	}
+	execution.Targets = map[string]*models.TargetResult{}
+	for id, target := range models.GroupTasksByTarget(tasks) {
+		name := event.GetLocalRegistry().Name
+		if id != 0 {
+			registry, err := replication.RegistryMgr.Get(id)
+			if err != nil {
+				return err
+			}
+			// the registry may be deleted after the execution
+			name = strconv.FormatInt(id, 10)
+			if registry != nil {
+				name = registry.Name
+			}
+		}
+		execution.Targets[name] = target
+	}
+	return nil
+}
+
 // StopExecution stops one execution of the replication
 func (r *ReplicationOperationAPI) StopExecution() {
 	executionID, err := r.GetInt64FromPath(":id")
@@ -221,6 +616,13 @@ func (r *ReplicationOperationAPI) ListTasks() {
 	}
 	query.Page = page
 	query.Size = size
+	if sort := r.GetString("sort"); len(sort) > 0 {
+		if _, err = models.ParseSort(sort, models.TaskSortableFields); err != nil {
+			r.SendBadRequestError(err)
+			return
+		}
+		query.Sort = sort
+	}
 	total, tasks, err := replication.OperationCtl.ListTasks(query)
 	if err != nil {
 		r.SendInternalServerError(fmt.Errorf("failed to list tasks: %v", err))
@@ -230,13 +632,286 @@ func (r *ReplicationOperationAPI) ListTasks() {
 	r.WriteJSONData(tasks)
 }
 
-// GetTaskLog ...
+// ListAllTasks lists the tasks of all executions, it's used to find the tasks by
+// the repository, e.g. all the tasks which replicated a specific repository
+func (r *ReplicationOperationAPI) ListAllTasks() {
+	query := &models.TaskQuery{
+		ResourceType:    r.GetString("resource_type"),
+		Repository:      r.GetString("repository"),
+		RepositoryMatch: r.GetString("match"),
+	}
+	switch query.RepositoryMatch {
+	case "", models.RepositoryMatchExact, models.RepositoryMatchPrefix:
+	default:
+		r.SendBadRequestError(fmt.Errorf("invalid match %s, it must be %s or %s",
+			query.RepositoryMatch, models.RepositoryMatchExact, models.RepositoryMatchPrefix))
+		return
+	}
+	if status := r.GetString("status"); len(status) > 0 {
+		query.Statuses = []string{status}
+	}
+	if len(r.GetString("policy_id")) > 0 {
+		policyID, err := r.GetInt64("policy_id")
+		if err != nil || policyID <= 0 {
+			r.SendBadRequestError(fmt.Errorf("invalid policy_id %s", r.GetString("policy_id")))
+			return
+		}
+		query.PolicyID = policyID
+	}
+	page, size, err := r.GetPaginationParams()
+	if err != nil {
+		r.SendBadRequestError(err)
+		return
+	}
+	query.Page = page
+	query.Size = size
+	if sort := r.GetString("sort"); len(sort) > 0 {
+		if _, err = models.ParseSort(sort, models.TaskSortableFields); err != nil {
+			r.SendBadRequestError(err)
+			return
+		}
+		query.Sort = sort
+	}
+	total, tasks, err := replication.OperationCtl.ListTasks(query)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list tasks: %v", err))
+		return
+	}
+	r.SetPaginationHeader(total, query.Page, query.Size)
+	r.WriteJSONData(tasks)
+}
+
+// the page size used when listing the tasks for the replication report
+const replicationReportPageSize = 100
+
+// the columns of the replication report
+var replicationReportHeader = []string{
+	"task_id", "execution_id", "policy_id", "target", "repository", "src_resource", "dst_resource",
+	"operation", "status", "start_time", "end_time", "duration_seconds", "bytes_transferred", "total_bytes", "retries",
+}
+
+// ExportTasksReport streams the replication tasks matching the filters as CSV, the tasks are
+// listed page by page so that the large result sets aren't loaded into memory at once. The pages
+// are listed by the ID of the last task rather than the offset, so the tasks being inserted while
+// exporting don't make the others skipped or repeated
+func (r *ReplicationOperationAPI) ExportTasksReport() {
+	query := &models.TaskQuery{
+		Pagination: models.Pagination{
+			Size: replicationReportPageSize,
+		},
+		Sorting: models.Sorting{
+			Sort: "id",
+		},
+	}
+	if status := r.GetString("status"); len(status) > 0 {
+		query.Statuses = []string{status}
+	}
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"policy_id", &query.PolicyID},
+		{"target_id", &query.DestRegistryID},
+	} {
+		if len(r.GetString(param.name)) == 0 {
+			continue
+		}
+		id, err := r.GetInt64(param.name)
+		if err != nil || id <= 0 {
+			r.SendBadRequestError(fmt.Errorf("invalid %s %s", param.name, r.GetString(param.name)))
+			return
+		}
+		*param.value = id
+	}
+	for _, param := range []struct {
+		name  string
+		value **time.Time
+	}{
+		{"since", &query.StartTimeFrom},
+		{"until", &query.StartTimeTo},
+	} {
+		value := r.GetString(param.name)
+		if len(value) == 0 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			r.SendBadRequestError(fmt.Errorf("invalid %s %s, it must be in RFC 3339 format", param.name, value))
+			return
+		}
+		*param.value = &t
+	}
+	if query.StartTimeFrom != nil && query.StartTimeTo != nil && !query.StartTimeFrom.Before(*query.StartTimeTo) {
+		r.SendBadRequestError(errors.New("the since must be earlier than the until"))
+		return
+	}
+
+	// list the first page before writing the response, so the error can still be reported by the status code
+	_, tasks, err := replication.OperationCtl.ListTasks(query)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list tasks: %v", err))
+		return
+	}
+
+	w := r.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="replication_report.csv"`)
+	w.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(w)
+	if err = writer.Write(replicationReportHeader); err != nil {
+		log.Errorf("failed to write the header of the replication report: %v", err)
+		return
+	}
+	targets := newReplicationTargetResolver()
+	for {
+		for _, task := range tasks {
+			if err = writer.Write(replicationReportRow(task, targets)); err != nil {
+				log.Errorf("failed to write the replication report: %v", err)
+				return
+			}
+		}
+		writer.Flush()
+		w.Flush()
+		if len(tasks) < replicationReportPageSize {
+			return
+		}
+		query.IDFrom = tasks[len(tasks)-1].ID
+		if _, tasks, err = replication.OperationCtl.ListTasks(query); err != nil {
+			// the response has been partially written, the error can only be logged
+			log.Errorf("failed to list tasks for the replication report: %v", err)
+			return
+		}
+	}
+}
+
+func replicationReportRow(task *models.Task, targets *replicationTargetResolver) []string {
+	policyID, target := targets.resolve(task)
+	startTime, endTime, duration := "", "", ""
+	if task.StartTime != nil {
+		startTime = task.StartTime.UTC().Format(time.RFC3339)
+	}
+	if task.EndTime != nil {
+		endTime = task.EndTime.UTC().Format(time.RFC3339)
+		if task.StartTime != nil {
+			duration = strconv.FormatInt(int64(task.EndTime.Sub(*task.StartTime)/time.Second), 10)
+		}
+	}
+	return []string{
+		strconv.FormatInt(task.ID, 10),
+		strconv.FormatInt(task.ExecutionID, 10),
+		strconv.FormatInt(policyID, 10),
+		target,
+		task.Repository,
+		task.SrcResource,
+		task.DstResource,
+		task.Operation,
+		task.Status,
+		startTime,
+		endTime,
+		duration,
+		strconv.FormatInt(task.BytesTransferred, 10),
+		strconv.FormatInt(task.TotalBytes, 10),
+		strconv.Itoa(task.Retries),
+	}
+}
+
+// replicationTargetResolver resolves the policy and the name of the destination registry
+// of the tasks, the results are cached as the tasks of one execution are listed together
+type replicationTargetResolver struct {
+	executions map[int64]int64
+	policies   map[int64]int64
+	targets    map[int64]string
+}
+
+func newReplicationTargetResolver() *replicationTargetResolver {
+	return &replicationTargetResolver{
+		executions: map[int64]int64{},
+		policies:   map[int64]int64{},
+		targets:    map[int64]string{},
+	}
+}
+
+// returns the ID of the policy and the name of the destination registry of the task,
+// the values which cannot be resolved(e.g. the policy has been deleted) are left empty
+func (t *replicationTargetResolver) resolve(task *models.Task) (int64, string) {
+	policyID, exist := t.executions[task.ExecutionID]
+	if !exist {
+		execution, err := replication.OperationCtl.GetExecution(task.ExecutionID)
+		if err != nil {
+			log.Warningf("failed to get the execution %d: %v", task.ExecutionID, err)
+		} else if execution != nil {
+			policyID = execution.PolicyID
+		}
+		t.executions[task.ExecutionID] = policyID
+	}
+	registryID := task.DstRegistryID
+	// the tasks created before recording the destination registry fall back to the one of the policy
+	if registryID == 0 {
+		if policyID == 0 {
+			return 0, ""
+		}
+		registryID, exist = t.policies[policyID]
+		if !exist {
+			registryID = replicationPolicyTarget(policyID)
+			t.policies[policyID] = registryID
+		}
+		if registryID < 0 {
+			return policyID, ""
+		}
+	}
+	target, exist := t.targets[registryID]
+	if !exist {
+		target = replicationTargetName(registryID)
+		t.targets[registryID] = target
+	}
+	return policyID, target
+}
+
+// returns the ID of the destination registry of the policy, 0 for the local Harbor and -1
+// if the policy cannot be got
+func replicationPolicyTarget(policyID int64) int64 {
+	policy, err := replication.PolicyCtl.Get(policyID)
+	if err != nil {
+		log.Warningf("failed to get the policy %d: %v", policyID, err)
+		return -1
+	}
+	if policy == nil {
+		return -1
+	}
+	if policy.DestRegistry == nil {
+		return 0
+	}
+	return policy.DestRegistry.ID
+}
+
+func replicationTargetName(registryID int64) string {
+	// the destination of the pull mode policy is the local Harbor, which doesn't have a registry record
+	if registryID == 0 {
+		return "local"
+	}
+	registry, err := replication.RegistryMgr.Get(registryID)
+	if err != nil {
+		log.Warningf("failed to get the registry %d: %v", registryID, err)
+		return ""
+	}
+	if registry == nil {
+		return ""
+	}
+	return registry.Name
+}
+
+// GetTaskLog returns the log of the task as the plain text, the structured logs of the steps
+// parsed from it are returned as JSON if the query parameter "format" is "json"
 func (r *ReplicationOperationAPI) GetTaskLog() {
 	executionID, err := r.GetInt64FromPath(":id")
 	if err != nil || executionID <= 0 {
 		r.SendBadRequestError(errors.New("invalid execution ID"))
 		return
 	}
+	format, ok := r.logFormat()
+	if !ok {
+		return
+	}
 
 	execution, err := replication.OperationCtl.GetExecution(executionID)
 	if err != nil {
@@ -253,6 +928,37 @@ func (r *ReplicationOperationAPI) GetTaskLog() {
 		r.SendBadRequestError(errors.New("invalid task ID"))
 		return
 	}
+	r.writeTaskLog(taskID, format)
+}
+
+// GetJobLog gets the log of the replication job, it's the alias of "GetTaskLog" without the
+// execution as the job in the path is the task
+func (r *ReplicationOperationAPI) GetJobLog() {
+	taskID, err := r.GetInt64FromPath(":id")
+	if err != nil || taskID <= 0 {
+		r.SendBadRequestError(errors.New("invalid job ID"))
+		return
+	}
+	format, ok := r.logFormat()
+	if !ok {
+		return
+	}
+	r.writeTaskLog(taskID, format)
+}
+
+// returns the format of the log in the query, the bad request error is sent if it's invalid
+func (r *ReplicationOperationAPI) logFormat() (string, bool) {
+	format := r.GetString("format")
+	if len(format) > 0 && format != "text" && format != "json" {
+		r.SendBadRequestError(fmt.Errorf("invalid format %s, valid values: text, json", format))
+		return "", false
+	}
+	return format, true
+}
+
+// writes the log of the task in the format, "json" for the structured logs of the steps and
+// the plain text otherwise
+func (r *ReplicationOperationAPI) writeTaskLog(taskID int64, format string) {
 	task, err := replication.OperationCtl.GetTask(taskID)
 	if err != nil {
 		r.SendInternalServerError(fmt.Errorf("failed to get task %d: %v", taskID, err))
@@ -274,6 +980,15 @@ func (r *ReplicationOperationAPI) GetTaskLog() {
 		r.SendInternalServerError(fmt.Errorf("failed to get log of task %d: %v", taskID, err))
 		return
 	}
+	if format == "json" {
+		steps, err := transfer.ParseStepLogs(logBytes)
+		if err != nil {
+			r.SendInternalServerError(fmt.Errorf("failed to parse the structured log of task %d: %v", taskID, err))
+			return
+		}
+		r.WriteJSONData(steps)
+		return
+	}
 	r.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Length"), strconv.Itoa(len(logBytes)))
 	r.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "text/plain")
 	_, err = r.Ctx.ResponseWriter.Write(logBytes)
@@ -282,3 +997,234 @@ func (r *ReplicationOperationAPI) GetTaskLog() {
 		return
 	}
 }
+
+// ListDeadLetters lists the dead letters of the replication tasks which fail permanently
+func (r *ReplicationOperationAPI) ListDeadLetters() {
+	query := &models.DeadLetterQuery{
+		Repository: r.GetString("repository"),
+	}
+	if len(r.GetString("policy_id")) > 0 {
+		policyID, err := r.GetInt64("policy_id")
+		if err != nil || policyID <= 0 {
+			r.SendBadRequestError(fmt.Errorf("invalid policy_id %s", r.GetString("policy_id")))
+			return
+		}
+		query.PolicyID = policyID
+	}
+	page, size, err := r.GetPaginationParams()
+	if err != nil {
+		r.SendBadRequestError(err)
+		return
+	}
+	query.Page = page
+	query.Size = size
+	total, letters, err := replication.OperationCtl.ListDeadLetters(query)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to list dead letters: %v", err))
+		return
+	}
+	r.SetPaginationHeader(total, query.Page, query.Size)
+	r.WriteJSONData(letters)
+}
+
+// RequeueDeadLetter re-submits the failed task of the dead letter
+func (r *ReplicationOperationAPI) RequeueDeadLetter() {
+	id, err := r.GetInt64FromPath(":id")
+	if err != nil || id <= 0 {
+		r.SendBadRequestError(errors.New("invalid dead letter ID"))
+		return
+	}
+	letter, err := replication.OperationCtl.GetDeadLetter(id)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get dead letter %d: %v", id, err))
+		return
+	}
+	if letter == nil {
+		r.SendNotFoundError(fmt.Errorf("dead letter %d not found", id))
+		return
+	}
+	task, err := replication.OperationCtl.GetTask(letter.TaskID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get task %d: %v", letter.TaskID, err))
+		return
+	}
+	if task == nil {
+		r.SendNotFoundError(fmt.Errorf("task %d of dead letter %d not found", letter.TaskID, id))
+		return
+	}
+	if task.Status != models.TaskStatusFailed {
+		r.SendConflictError(fmt.Errorf("the task %d is %s, only the failed task can be requeued", task.ID, task.Status))
+		return
+	}
+	if len(task.JobID) == 0 {
+		r.SendBadRequestError(fmt.Errorf("the task %d has no job to requeue", task.ID))
+		return
+	}
+	if err = replication.OperationCtl.RequeueDeadLetter(id); err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to requeue dead letter %d: %v", id, err))
+		return
+	}
+}
+
+// the interval to check the progress of the execution when streaming its events
+var executionEventsInterval = 2 * time.Second
+
+// the max count of the execution event streams served at the same time
+const maxExecutionEventStreams = 100
+
+var executionEventStreams = make(chan struct{}, maxExecutionEventStreams)
+
+// StreamExecutionEvents streams the progress of the execution as Server-Sent Events until the
+// execution finishes or the client disconnects. The "execution" event carries the execution with
+// its status and counts of tasks, and the "task" event carries the task whose status changes
+func (r *ReplicationOperationAPI) StreamExecutionEvents() {
+	executionID, err := r.GetInt64FromPath(":id")
+	if err != nil || executionID <= 0 {
+		r.SendBadRequestError(errors.New("invalid execution ID"))
+		return
+	}
+	execution, err := replication.OperationCtl.GetExecution(executionID)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to get execution %d: %v", executionID, err))
+		return
+	}
+	if execution == nil {
+		r.SendNotFoundError(fmt.Errorf("execution %d not found", executionID))
+		return
+	}
+	select {
+	case executionEventStreams <- struct{}{}:
+		defer func() { <-executionEventStreams }()
+	default:
+		r.SendStatusServiceUnavailableError(errors.New("too many streams of the execution events, retry later"))
+		return
+	}
+
+	w := r.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disable the response buffering of the nginx proxy
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Ctx.Request.Context()
+	ticker := time.NewTicker(executionEventsInterval)
+	defer ticker.Stop()
+	executionStatus := ""
+	taskStatuses := map[int64]string{}
+	// all the tasks are listed at the first time, then only the ones updated since the latest
+	// update listed. The tasks updated in the interval before it are listed again in case their
+	// updates are committed late, they're skipped if their statuses don't change
+	var latestUpdate time.Time
+	for {
+		changed := false
+		if execution.Status != executionStatus {
+			// the final event tells the partial success from the failure with the failed tasks
+			if models.ExecutionFinished(execution.Status) {
+				if err = populateExecutionFailures(execution); err != nil {
+					log.Errorf("failed to get the failures of execution %d: %v", executionID, err)
+				}
+			}
+			if err = writeEvent(w, "execution", execution); err != nil {
+				log.Debugf("failed to write the event of execution %d, stop streaming: %v", executionID, err)
+				return
+			}
+			executionStatus = execution.Status
+			changed = true
+		}
+		query := &models.TaskQuery{
+			ExecutionID: executionID,
+		}
+		if !latestUpdate.IsZero() {
+			updateTimeFrom := latestUpdate.Add(-executionEventsInterval)
+			query.UpdateTimeFrom = &updateTimeFrom
+		}
+		tasks, err := listTasks(query)
+		if err != nil {
+			log.Errorf("failed to list the tasks of execution %d: %v", executionID, err)
+			return
+		}
+		for _, task := range tasks {
+			if task.UpdateTime.After(latestUpdate) {
+				latestUpdate = task.UpdateTime
+			}
+			if taskStatuses[task.ID] == task.Status {
+				continue
+			}
+			if err = writeEvent(w, "task", task); err != nil {
+				log.Debugf("failed to write the event of execution %d, stop streaming: %v", executionID, err)
+				return
+			}
+			taskStatuses[task.ID] = task.Status
+			changed = true
+		}
+		if models.ExecutionFinished(execution.Status) {
+			return
+		}
+		// keep the connection alive through the proxies
+		if !changed {
+			if _, err = w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		}
+		w.Flush()
+
+		select {
+		case <-ctx.Done():
+			log.Debugf("the client disconnected, stop streaming the events of execution %d", executionID)
+			return
+		case <-ticker.C:
+		}
+
+		execution, err = replication.OperationCtl.GetExecution(executionID)
+		if err != nil {
+			log.Errorf("failed to get execution %d: %v", executionID, err)
+			return
+		}
+		if execution == nil {
+			log.Debugf("the execution %d is deleted, stop streaming", executionID)
+			return
+		}
+	}
+}
+
+// write the Server-Sent Event whose data is the object in JSON format
+func writeEvent(w *context.Response, event string, object interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// list all the tasks of the execution in the statuses if specified page by page
+func listExecutionTasks(executionID int64, statuses ...string) ([]*models.Task, error) {
+	return listTasks(&models.TaskQuery{
+		ExecutionID: executionID,
+		Statuses:    statuses,
+	})
+}
+
+// list all the tasks matching the query page by page, the pages are listed by the ID of
+// the last task of the previous page
+func listTasks(query *models.TaskQuery) ([]*models.Task, error) {
+	query.Size = 100
+	query.Sort = "id"
+	var tasks []*models.Task
+	for {
+		_, ts, err := replication.OperationCtl.ListTasks(query)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, ts...)
+		if len(ts) < 100 {
+			return tasks, nil
+		}
+		query.IDFrom = ts[len(ts)-1].ID
+	}
+}
@@ -15,24 +15,49 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/goharbor/harbor/src/replication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	rep_config "github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
+	"github.com/goharbor/harbor/src/replication/policy/scheduler"
+	"github.com/goharbor/harbor/src/replication/transfer"
 )
 
-type fakedOperationController struct{}
+type fakedOperationController struct {
+	policy      *model.Policy
+	resource    *model.Resource
+	annotations map[string]string
+	query       *models.ExecutionQuery
+	resumed     int64
+}
 
-func (f *fakedOperationController) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType) (int64, error) {
+func (f *fakedOperationController) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType, annotations map[string]string) (int64, error) {
+	f.policy = policy
+	f.resource = resource
+	f.annotations = annotations
 	return 1, nil
 }
 func (f *fakedOperationController) StopReplication(int64) error {
 	return nil
 }
-func (f *fakedOperationController) ListExecutions(...*models.ExecutionQuery) (int64, []*models.Execution, error) {
+func (f *fakedOperationController) ListExecutions(query ...*models.ExecutionQuery) (int64, []*models.Execution, error) {
+	if len(query) > 0 {
+		f.query = query[0]
+	}
 	return 1, []*models.Execution{
 		{
 			ID:       1,
@@ -49,6 +74,9 @@ func (f *fakedOperationController) GetExecution(id int64) (*models.Execution, er
 	}
 	return nil, nil
 }
+func (f *fakedOperationController) MarkExecutionRecorded(int64) (bool, error) {
+	return false, nil
+}
 func (f *fakedOperationController) ListTasks(...*models.TaskQuery) (int64, []*models.Task, error) {
 	return 1, []*models.Task{
 		{
@@ -66,12 +94,65 @@ func (f *fakedOperationController) GetTask(id int64) (*models.Task, error) {
 	}
 	return nil, nil
 }
-func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, statusCondition ...string) error {
+func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskStatusText(id int64, text string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskSpeed(id int64, bytes int64, average, peak float64) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskProgress(id int64, bytes, total, eta int64) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskReferrers(id int64, count int) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskEndpoints(id int64, src, dst string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskMediaTypes(id int64, mediaTypes string) error {
 	return nil
 }
 func (f *fakedOperationController) GetTaskLog(int64) ([]byte, error) {
 	return []byte("success"), nil
 }
+func (f *fakedOperationController) RetryFailedTasks(policyID int64, since, until *time.Time) (int, error) {
+	return 2, nil
+}
+func (f *fakedOperationController) RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) GetDeadLetter(int64) (*models.DeadLetter, error) {
+	return nil, nil
+}
+func (f *fakedOperationController) RequeueDeadLetter(int64) error {
+	return nil
+}
+func (f *fakedOperationController) PreviewReplication(policy *model.Policy) ([]*flow.PreviewItem, []string, error) {
+	items := []*flow.PreviewItem{}
+	for _, name := range []string{"library/hello-world", "library/busybox", "library/alpine"} {
+		items = append(items, &flow.PreviewItem{
+			Type:           model.ResourceTypeImage,
+			Repository:     name,
+			Tags:           []string{"latest"},
+			DestRepository: name,
+		})
+	}
+	items[0].Warnings = []string{"the tag latest exists on the destination repository library/hello-world with the different content"}
+	return items, nil, nil
+}
+func (f *fakedOperationController) ResumeDeferredTasks(registryID int64) (int, error) {
+	f.resumed = registryID
+	return 0, nil
+}
+func (f *fakedOperationController) DeferTask(int64) error {
+	return nil
+}
 
 type fakedPolicyManager struct{}
 
@@ -116,6 +197,12 @@ func (f *fakedPolicyManager) Update(*model.Policy) error {
 func (f *fakedPolicyManager) Remove(int64) error {
 	return nil
 }
+func (f *fakedPolicyManager) IncreaseFailures(int64) (int, bool, error) {
+	return 0, false, nil
+}
+func (f *fakedPolicyManager) ResetFailures(int64) error {
+	return nil
+}
 
 func TestListExecutions(t *testing.T) {
 	operationCtl := replication.OperationCtl
@@ -228,19 +315,204 @@ func TestCreateExecution(t *testing.T) {
 	runCodeCheckingCases(t, cases...)
 }
 
-func TestGetExecution(t *testing.T) {
+func TestCreateSingleExecution(t *testing.T) {
 	operationCtl := replication.OperationCtl
+	registryMgr := replication.RegistryMgr
+	coreURL := rep_config.Config.CoreURL
 	defer func() {
 		replication.OperationCtl = operationCtl
+		replication.RegistryMgr = registryMgr
+		rep_config.Config.CoreURL = coreURL
 	}()
-	replication.OperationCtl = &fakedOperationController{}
+	ctl := &fakedOperationController{}
+	replication.OperationCtl = ctl
+	replication.RegistryMgr = &fakedRegistryManager{}
+	// the repositories under "secrets" are excluded
+	flow.SetExclusionManager(&fakedExclusionManager{})
+	defer flow.SetExclusionManager(nil)
+	// the local registry only has library/hello-world:latest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/library/hello-world/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	rep_config.Config.CoreURL = server.URL
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/single",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400, no tag
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+				bodyJSON: &singleReplicationRequest{
+					TargetID:   1,
+					Repository: "library/hello-world",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 404, the target not found
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+				bodyJSON: &singleReplicationRequest{
+					TargetID:   2,
+					Repository: "library/hello-world",
+					Tag:        "latest",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 404, the tag not found
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+				bodyJSON: &singleReplicationRequest{
+					TargetID:   1,
+					Repository: "library/hello-world",
+					Tag:        "non-existed",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 403, the repository is excluded
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+				bodyJSON: &singleReplicationRequest{
+					TargetID:   1,
+					Repository: "secrets/app",
+					Tag:        "latest",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 403, the project isn't allowed by the target
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/single",
+				bodyJSON: &singleReplicationRequest{
+					TargetID:   3,
+					Repository: "other/hello-world",
+					Tag:        "latest",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+	assert.Nil(t, ctl.resource)
+
+	// 201
+	resp, err := handle(&testingRequest{
+		method: http.MethodPost,
+		url:    "/api/replication/executions/single",
+		bodyJSON: &singleReplicationRequest{
+			TargetID:   1,
+			Repository: "library/hello-world",
+			Tag:        "latest",
+		},
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "/api/replication/executions/1", resp.Header().Get("Location"))
+	// only the tag is replicated to the target
+	require.NotNil(t, ctl.resource)
+	assert.Equal(t, "library/hello-world", ctl.resource.Metadata.Repository.Name)
+	assert.Equal(t, []string{"latest"}, ctl.resource.Metadata.Vtags)
+	require.NotNil(t, ctl.policy)
+	assert.Equal(t, model.RegistryType("faked_registry"), ctl.policy.DestRegistry.Type)
+	assert.Empty(t, ctl.policy.Filters)
+}
+
+// the policy manager returning several scheduled policies
+type scheduledPolicyManager struct {
+	fakedPolicyManager
+}
+
+func (s *scheduledPolicyManager) List(...*model.PolicyQuery) (int64, []*model.Policy, error) {
+	scheduled := func(id, src, dest int64, cron string, enabled bool) *model.Policy {
+		return &model.Policy{
+			ID:           id,
+			Name:         fmt.Sprintf("policy%d", id),
+			Enabled:      enabled,
+			SrcRegistry:  &model.Registry{ID: src},
+			DestRegistry: &model.Registry{ID: dest},
+			Trigger: &model.Trigger{
+				Type:     model.TriggerTypeScheduled,
+				Settings: &model.TriggerSettings{Cron: cron},
+			},
+		}
+	}
+	policies := []*model.Policy{
+		scheduled(1, 0, 1, "@yearly", true),
+		scheduled(2, 0, 2, "* * * * * *", true),
+		scheduled(3, 2, 0, "0 0 * * * *", true),
+		scheduled(4, 0, 1, "* * * * * *", false),
+		{
+			ID:           5,
+			Enabled:      true,
+			DestRegistry: &model.Registry{ID: 1},
+			Trigger:      &model.Trigger{Type: model.TriggerTypeManual},
+		},
+	}
+	return int64(len(policies)), policies, nil
+}
+
+func TestListSchedule(t *testing.T) {
+	policyMgr := replication.PolicyCtl
+	registryMgr := replication.RegistryMgr
+	defer func() {
+		replication.PolicyCtl = policyMgr
+		replication.RegistryMgr = registryMgr
+	}()
+	replication.PolicyCtl = &scheduledPolicyManager{}
+	replication.RegistryMgr = &fakedRegistryManager{
+		registries: map[int64]*model.Registry{
+			2: {ID: 2, Timezone: "Asia/Shanghai"},
+		},
+	}
 
 	cases := []*codeCheckingCase{
 		// 401
 		{
 			request: &testingRequest{
 				method: http.MethodGet,
-				url:    "/api/replication/executions/1",
+				url:    "/api/replication/schedule",
 			},
 			code: http.StatusUnauthorized,
 		},
@@ -248,63 +520,226 @@ func TestGetExecution(t *testing.T) {
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/1",
+				url:        "/api/replication/schedule",
 				credential: nonSysAdmin,
 			},
 			code: http.StatusForbidden,
 		},
-		// 404
+		// 400, invalid target
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/2",
+				url:        "/api/replication/schedule?target=abc",
 				credential: sysAdmin,
 			},
-			code: http.StatusNotFound,
+			code: http.StatusBadRequest,
 		},
-		// 200
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// all the enabled scheduled policies, sorted soonest first
+	runs := []*scheduler.ScheduledRun{}
+	err := handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/schedule",
+		credential: sysAdmin,
+	}, &runs)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(runs))
+	assert.Equal(t, int64(2), runs[0].PolicyID)
+	assert.Equal(t, "policy2", runs[0].PolicyName)
+	assert.Equal(t, "* * * * * *", runs[0].Cron)
+	// the cron is interpreted in the time zone of the remote registry
+	assert.Equal(t, "Asia/Shanghai", runs[0].Timezone)
+	assert.Equal(t, "", runs[2].Timezone)
+	assert.Equal(t, int64(3), runs[1].PolicyID)
+	assert.Equal(t, int64(1), runs[2].PolicyID)
+	assert.True(t, runs[0].NextRunTime.After(time.Now().Add(-time.Second)))
+	assert.False(t, runs[1].NextRunTime.Before(runs[0].NextRunTime))
+	assert.False(t, runs[2].NextRunTime.Before(runs[1].NextRunTime))
+
+	// the target matches either the source or destination registry
+	runs = []*scheduler.ScheduledRun{}
+	err = handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/schedule?target=2",
+		credential: sysAdmin,
+	}, &runs)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(runs))
+	assert.Equal(t, int64(2), runs[0].PolicyID)
+	assert.Equal(t, int64(3), runs[1].PolicyID)
+
+	runs = nil
+	err = handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/schedule?target=100",
+		credential: sysAdmin,
+	}, &runs)
+	require.Nil(t, err)
+	assert.NotNil(t, runs)
+	assert.Equal(t, 0, len(runs))
+}
+
+func TestExecutionAnnotations(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	policyMgr := replication.PolicyCtl
+	registryMgr := replication.RegistryMgr
+	defer func() {
+		replication.OperationCtl = operationCtl
+		replication.PolicyCtl = policyMgr
+		replication.RegistryMgr = registryMgr
+	}()
+	ctl := &fakedOperationController{}
+	replication.OperationCtl = ctl
+	replication.PolicyCtl = &fakedPolicyManager{}
+	replication.RegistryMgr = &fakedRegistryManager{}
+
+	annotations := map[string]string{
+		"ticket": "OPS-1",
+		"env":    "prod",
+	}
+	resp, err := handle(&testingRequest{
+		method: http.MethodPost,
+		url:    "/api/replication/executions",
+		bodyJSON: &models.Execution{
+			PolicyID:    1,
+			Annotations: annotations,
+		},
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, annotations, ctl.annotations)
+
+	resp, err = handle(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/executions?annotation=env:prod&annotation=url:http://example.com",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	require.NotNil(t, ctl.query)
+	assert.Equal(t, map[string]string{
+		"env": "prod",
+		"url": "http://example.com",
+	}, ctl.query.Annotations)
+
+	cases := []*codeCheckingCase{
+		// 400, the key contains ":"
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions",
+				bodyJSON: &models.Execution{
+					PolicyID:    1,
+					Annotations: map[string]string{"a:b": "c"},
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, empty key
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions",
+				bodyJSON: &models.Execution{
+					PolicyID:    1,
+					Annotations: map[string]string{"": "c"},
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, invalid filter
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/1",
+				url:        "/api/replication/executions?annotation=env",
 				credential: sysAdmin,
 			},
-			code: http.StatusOK,
+			code: http.StatusBadRequest,
+		},
+		// 400, empty key in the filter
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions?annotation=:prod",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
 		},
 	}
 
 	runCodeCheckingCases(t, cases...)
 }
-func TestStopExecution(t *testing.T) {
+
+func TestExecuteAction(t *testing.T) {
 	operationCtl := replication.OperationCtl
+	policyMgr := replication.PolicyCtl
 	defer func() {
 		replication.OperationCtl = operationCtl
+		replication.PolicyCtl = policyMgr
 	}()
 	replication.OperationCtl = &fakedOperationController{}
+	replication.PolicyCtl = &fakedPolicyManager{}
 
+	now := time.Now()
+	before := now.Add(-1 * time.Hour)
 	cases := []*codeCheckingCase{
 		// 401
 		{
 			request: &testingRequest{
-				method: http.MethodPut,
-				url:    "/api/replication/executions/1",
+				method: http.MethodPost,
+				url:    "/api/replication/executions/actions",
 			},
 			code: http.StatusUnauthorized,
 		},
 		// 403
 		{
 			request: &testingRequest{
-				method:     http.MethodPut,
-				url:        "/api/replication/executions/1",
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/actions",
 				credential: nonSysAdmin,
 			},
 			code: http.StatusForbidden,
 		},
-		// 404
+		// 400, unsupported action
 		{
 			request: &testingRequest{
-				method:     http.MethodPut,
-				url:        "/api/replication/executions/2",
+				method: http.MethodPost,
+				url:    "/api/replication/executions/actions",
+				bodyJSON: &replicationActionRequest{
+					Action: "stop",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, the since is later than the until
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/actions",
+				bodyJSON: &replicationActionRequest{
+					Action: replicationActionRetryFailed,
+					Since:  &now,
+					Until:  &before,
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 404, the policy doesn't exist
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/actions",
+				bodyJSON: &replicationActionRequest{
+					Action:   replicationActionRetryFailed,
+					PolicyID: 3,
+				},
 				credential: sysAdmin,
 			},
 			code: http.StatusNotFound,
@@ -312,8 +747,14 @@ func TestStopExecution(t *testing.T) {
 		// 200
 		{
 			request: &testingRequest{
-				method:     http.MethodPut,
-				url:        "/api/replication/executions/1",
+				method: http.MethodPost,
+				url:    "/api/replication/executions/actions",
+				bodyJSON: &replicationActionRequest{
+					Action:   replicationActionRetryFailed,
+					PolicyID: 1,
+					Since:    &before,
+					Until:    &now,
+				},
 				credential: sysAdmin,
 			},
 			code: http.StatusOK,
@@ -323,7 +764,7 @@ func TestStopExecution(t *testing.T) {
 	runCodeCheckingCases(t, cases...)
 }
 
-func TestListTasks(t *testing.T) {
+func TestGetExecution(t *testing.T) {
 	operationCtl := replication.OperationCtl
 	defer func() {
 		replication.OperationCtl = operationCtl
@@ -335,7 +776,7 @@ func TestListTasks(t *testing.T) {
 		{
 			request: &testingRequest{
 				method: http.MethodGet,
-				url:    "/api/replication/executions/1/tasks",
+				url:    "/api/replication/executions/1",
 			},
 			code: http.StatusUnauthorized,
 		},
@@ -343,7 +784,7 @@ func TestListTasks(t *testing.T) {
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/1/tasks",
+				url:        "/api/replication/executions/1",
 				credential: nonSysAdmin,
 			},
 			code: http.StatusForbidden,
@@ -352,7 +793,7 @@ func TestListTasks(t *testing.T) {
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/2/tasks",
+				url:        "/api/replication/executions/2",
 				credential: sysAdmin,
 			},
 			code: http.StatusNotFound,
@@ -361,7 +802,7 @@ func TestListTasks(t *testing.T) {
 		{
 			request: &testingRequest{
 				method:     http.MethodGet,
-				url:        "/api/replication/executions/1/tasks",
+				url:        "/api/replication/executions/1",
 				credential: sysAdmin,
 			},
 			code: http.StatusOK,
@@ -370,8 +811,7 @@ func TestListTasks(t *testing.T) {
 
 	runCodeCheckingCases(t, cases...)
 }
-
-func TestGetTaskLog(t *testing.T) {
+func TestStopExecution(t *testing.T) {
 	operationCtl := replication.OperationCtl
 	defer func() {
 		replication.OperationCtl = operationCtl
@@ -382,48 +822,878 @@ func TestGetTaskLog(t *testing.T) {
 		// 401
 		{
 			request: &testingRequest{
-				method: http.MethodGet,
-				url:    "/api/replication/executions/1/tasks/1/log",
+				method: http.MethodPut,
+				url:    "/api/replication/executions/1",
 			},
 			code: http.StatusUnauthorized,
 		},
 		// 403
 		{
 			request: &testingRequest{
-				method:     http.MethodGet,
-				url:        "/api/replication/executions/1/tasks/1/log",
+				method:     http.MethodPut,
+				url:        "/api/replication/executions/1",
 				credential: nonSysAdmin,
 			},
 			code: http.StatusForbidden,
 		},
-		// 404, execution not found
+		// 404
 		{
 			request: &testingRequest{
-				method:     http.MethodGet,
-				url:        "/api/replication/executions/2/tasks/1/log",
+				method:     http.MethodPut,
+				url:        "/api/replication/executions/2",
 				credential: sysAdmin,
 			},
 			code: http.StatusNotFound,
 		},
-		// 404, task not found
+		// 200
 		{
 			request: &testingRequest{
-				method:     http.MethodGet,
-				url:        "/api/replication/executions/1/tasks/2/log",
+				method:     http.MethodPut,
+				url:        "/api/replication/executions/1",
 				credential: sysAdmin,
 			},
-			code: http.StatusNotFound,
+			code: http.StatusOK,
 		},
-		// 200
-		{
-			request: &testingRequest{
-				method:     http.MethodGet,
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestListTasks(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	replication.OperationCtl = &fakedOperationController{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/executions/1/tasks",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/1/tasks",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/2/tasks",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/1/tasks",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestListAllTasks(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	replication.OperationCtl = &fakedOperationController{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/tasks",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400, invalid match
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks?repository=library/hello-world&match=suffix",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, invalid policy ID
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks?repository=library/hello-world&policy_id=0",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks?repository=library/hello&match=prefix&status=Failed&policy_id=1",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestGetTaskLog(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	replication.OperationCtl = &fakedOperationController{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/executions/1/tasks/1/log",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/1/tasks/1/log",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404, execution not found
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/2/tasks/1/log",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 404, task not found
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/1/tasks/2/log",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 400, invalid format
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/executions/1/tasks/1/log",
+				queryStruct: struct {
+					Format string `url:"format"`
+				}{
+					Format: "xml",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
 				url:        "/api/replication/executions/1/tasks/1/log",
 				credential: sysAdmin,
 			},
 			code: http.StatusOK,
 		},
+		// 403, the alias under the jobs
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/jobs/replication/1/log",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404, task not found
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/jobs/replication/2/log",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 400, invalid format
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/jobs/replication/1/log",
+				queryStruct: struct {
+					Format string `url:"format"`
+				}{
+					Format: "xml",
+				},
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/jobs/replication/1/log",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
 	}
 
 	runCodeCheckingCases(t, cases...)
 }
+
+// fakedStepLogOperationController returns the log which contains the structured logs of the steps
+type fakedStepLogOperationController struct {
+	fakedOperationController
+}
+
+func (f *fakedStepLogOperationController) GetTaskLog(int64) ([]byte, error) {
+	return []byte(`2019-07-01T08:00:00Z [INFO] [/replication/transfer/image/transfer.go:196]: copying library/hello-world:[latest](source registry)...
+2019-07-01T08:00:01Z [INFO] [/replication/transfer/step.go:72]: [step] {"phase":"copy","repository":"library/hello-world","tag":"latest","result":"failed","duration":1200,"error":"manifest unknown"}
+2019-07-01T08:00:01Z [ERROR] [/replication/transfer/image/transfer.go:200]: manifest unknown`), nil
+}
+
+func TestGetTaskLogInJSON(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	replication.OperationCtl = &fakedStepLogOperationController{}
+
+	request := &testingRequest{
+		method: http.MethodGet,
+		url:    "/api/replication/executions/1/tasks/1/log",
+		queryStruct: struct {
+			Format string `url:"format"`
+		}{
+			Format: "json",
+		},
+		credential: sysAdmin,
+	}
+	steps := []*transfer.StepLog{}
+	require.Nil(t, handleAndParse(request, &steps))
+	require.Equal(t, 1, len(steps))
+	assert.Equal(t, &transfer.StepLog{
+		Phase:      transfer.StepPhaseCopy,
+		Repository: "library/hello-world",
+		Tag:        "latest",
+		Result:     transfer.StepResultFailed,
+		Duration:   1200,
+		Error:      "manifest unknown",
+	}, steps[0])
+
+	// the plain text log is kept by default
+	resp, err := handle(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/executions/1/tasks/1/log",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/plain", resp.Header().Get("Content-Type"))
+	assert.NotNil(t, json.Unmarshal(resp.Body.Bytes(), &steps))
+}
+
+// fakedProgressingOperationController returns the execution which succeeds
+// at the third check and the task which succeeds at the second check
+type fakedProgressingOperationController struct {
+	fakedOperationController
+	checks  int
+	queries []models.TaskQuery
+}
+
+func (f *fakedProgressingOperationController) GetExecution(id int64) (*models.Execution, error) {
+	if id != 1 {
+		return nil, nil
+	}
+	f.checks++
+	status := models.ExecutionStatusInProgress
+	if f.checks >= 3 {
+		status = models.ExecutionStatusSucceed
+	}
+	return &models.Execution{
+		ID:       1,
+		PolicyID: 1,
+		Status:   status,
+	}, nil
+}
+func (f *fakedProgressingOperationController) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
+	f.queries = append(f.queries, *query[0])
+	status := models.TaskStatusInProgress
+	updateTime := time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC)
+	if f.checks >= 2 {
+		status = models.TaskStatusSucceed
+		updateTime = updateTime.Add(time.Minute)
+	}
+	return 1, []*models.Task{
+		{
+			ID:          1,
+			ExecutionID: 1,
+			Status:      status,
+			Repository:  "library/hello-world",
+			UpdateTime:  updateTime,
+		},
+	}, nil
+}
+
+func TestStreamExecutionEvents(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	interval := executionEventsInterval
+	defer func() {
+		replication.OperationCtl = operationCtl
+		executionEventsInterval = interval
+	}()
+	ctl := &fakedProgressingOperationController{}
+	replication.OperationCtl = ctl
+	executionEventsInterval = 10 * time.Millisecond
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/executions/1/events",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/1/events",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/executions/2/events",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// the stream is closed once the execution succeeds
+	resp, err := handle(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/executions/1/events",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+	events := []string{}
+	for _, line := range strings.Split(resp.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	// execution(InProgress), task(InProgress), task(Succeed), execution(Succeed)
+	assert.Equal(t, []string{"execution", "task", "task", "execution"}, events)
+	assert.Contains(t, resp.Body.String(), `"status":"Succeed"`)
+
+	// only the tasks updated recently are listed after the first time
+	require.True(t, len(ctl.queries) > 1)
+	assert.Nil(t, ctl.queries[0].UpdateTimeFrom)
+	for _, query := range ctl.queries[1:] {
+		assert.NotNil(t, query.UpdateTimeFrom)
+	}
+
+	// the count of the streams is limited
+	for i := 0; i < maxExecutionEventStreams; i++ {
+		executionEventStreams <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxExecutionEventStreams; i++ {
+			<-executionEventStreams
+		}
+	}()
+	runCodeCheckingCases(t, &codeCheckingCase{
+		request: &testingRequest{
+			method:     http.MethodGet,
+			url:        "/api/replication/executions/1/events",
+			credential: sysAdmin,
+		},
+		code: http.StatusServiceUnavailable,
+	})
+}
+
+// fakedReportOperationController returns the finished task for the replication report
+type fakedReportOperationController struct {
+	fakedOperationController
+}
+
+func (f *fakedReportOperationController) ListTasks(...*models.TaskQuery) (int64, []*models.Task, error) {
+	start := time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	return 1, []*models.Task{
+		{
+			ID:               1,
+			ExecutionID:      1,
+			Repository:       "library/hello-world",
+			SrcResource:      "library/hello-world:[latest]",
+			DstResource:      "library/hello-world:[latest]",
+			Operation:        "copy",
+			Status:           models.TaskStatusSucceed,
+			StartTime:        &start,
+			EndTime:          &end,
+			BytesTransferred: 1024,
+			TotalBytes:       2048,
+		},
+	}, nil
+}
+
+func TestExportTasksReport(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	policyMgr := replication.PolicyCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+		replication.PolicyCtl = policyMgr
+	}()
+	replication.OperationCtl = &fakedReportOperationController{}
+	replication.PolicyCtl = &fakedPolicyManager{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/tasks/report.csv",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks/report.csv",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400, invalid target ID
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks/report.csv?target_id=abc",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, invalid time
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks/report.csv?since=yesterday",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, the since is later than the until
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/tasks/report.csv?since=2019-08-02T00:00:00Z&until=2019-08-01T00:00:00Z",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	resp, err := handle(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/tasks/report.csv?policy_id=1&status=Succeed&since=2019-08-01T00:00:00Z",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, []string{
+		"task_id", "execution_id", "policy_id", "target", "repository", "src_resource", "dst_resource",
+		"operation", "status", "start_time", "end_time", "duration_seconds", "bytes_transferred", "total_bytes", "retries",
+	}, records[0])
+	assert.Equal(t, []string{
+		"1", "1", "1", "local", "library/hello-world", "library/hello-world:[latest]", "library/hello-world:[latest]",
+		"copy", "Succeed", "2019-08-01T10:00:00Z", "2019-08-01T10:01:30Z", "90", "1024", "2048", "0",
+	}, records[1])
+}
+
+// fakedPagedReportOperationController returns the tasks after the ID specified by the query
+type fakedPagedReportOperationController struct {
+	fakedOperationController
+	total   int64
+	queries []models.TaskQuery
+}
+
+func (f *fakedPagedReportOperationController) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
+	q := query[0]
+	f.queries = append(f.queries, *q)
+	tasks := []*models.Task{}
+	for id := q.IDFrom + 1; id <= f.total && int64(len(tasks)) < q.Size; id++ {
+		tasks = append(tasks, &models.Task{
+			ID:            id,
+			ExecutionID:   1,
+			Status:        models.TaskStatusSucceed,
+			DstRegistryID: 1,
+		})
+	}
+	return f.total, tasks, nil
+}
+
+func TestExportTasksReportByKeyset(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	ctl := &fakedPagedReportOperationController{total: replicationReportPageSize + 10}
+	replication.OperationCtl = ctl
+
+	resp, err := handle(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/tasks/report.csv?target_id=1",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, replicationReportPageSize+11, len(records))
+	for i, record := range records[1:] {
+		assert.Equal(t, strconv.Itoa(i+1), record[0])
+	}
+
+	// the pages are listed by the ID of the last task rather than the offset
+	require.Equal(t, 2, len(ctl.queries))
+	for _, query := range ctl.queries {
+		assert.Equal(t, int64(0), query.Page)
+		assert.Equal(t, "id", query.Sort)
+		assert.Equal(t, int64(1), query.DestRegistryID)
+	}
+	assert.Equal(t, int64(0), ctl.queries[0].IDFrom)
+	assert.Equal(t, int64(replicationReportPageSize), ctl.queries[1].IDFrom)
+}
+
+// fakedPartialOperationController returns the partially succeed execution and its failed task
+type fakedPartialOperationController struct {
+	fakedOperationController
+}
+
+func (f *fakedPartialOperationController) GetExecution(id int64) (*models.Execution, error) {
+	return &models.Execution{
+		ID:       id,
+		PolicyID: 1,
+		Status:   models.ExecutionStatusPartialSucceed,
+		Total:    2,
+		Succeed:  1,
+		Failed:   1,
+	}, nil
+}
+
+func (f *fakedPartialOperationController) ListTasks(...*models.TaskQuery) (int64, []*models.Task, error) {
+	return 1, []*models.Task{
+		{
+			ID:          2,
+			ExecutionID: 1,
+			Repository:  "library/busybox",
+			SrcResource: "library/busybox:[latest]",
+			DstResource: "library/busybox:[latest]",
+			Status:      models.TaskStatusFailed,
+			StatusText:  "manifest unknown",
+		},
+	}, nil
+}
+
+func TestGetPartialSucceedExecution(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	policyMgr := replication.PolicyCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+		replication.PolicyCtl = policyMgr
+	}()
+	replication.OperationCtl = &fakedPartialOperationController{}
+	replication.PolicyCtl = &fakedPolicyManager{}
+
+	execution := &models.Execution{}
+	err := handleAndParse(&testingRequest{
+		method:     http.MethodGet,
+		url:        "/api/replication/executions/1",
+		credential: sysAdmin,
+	}, execution)
+	require.Nil(t, err)
+	assert.Equal(t, models.ExecutionStatusPartialSucceed, execution.Status)
+	require.Equal(t, 1, len(execution.Failures))
+	assert.Equal(t, &models.TaskFailure{
+		TaskID:      2,
+		Repository:  "library/busybox",
+		SrcResource: "library/busybox:[latest]",
+		DstResource: "library/busybox:[latest]",
+		Reason:      "manifest unknown",
+	}, execution.Failures[0])
+}
+
+// fakedRetryOperationController returns the partially succeeded execution 1 whose repository
+// library/busybox failed, the in-progress execution 3 and the succeeded execution 4
+type fakedRetryOperationController struct {
+	fakedOperationController
+	policy *model.Policy
+	parent int64
+}
+
+func (f *fakedRetryOperationController) GetExecution(id int64) (*models.Execution, error) {
+	statuses := map[int64]string{
+		1: models.ExecutionStatusPartialSucceed,
+		3: models.ExecutionStatusInProgress,
+		4: models.ExecutionStatusSucceed,
+	}
+	status, exist := statuses[id]
+	if !exist {
+		return nil, nil
+	}
+	return &models.Execution{
+		ID:       id,
+		PolicyID: 1,
+		Status:   status,
+	}, nil
+}
+func (f *fakedRetryOperationController) RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error) {
+	if executionID != 1 {
+		return 0, nil, nil
+	}
+	f.policy = policy
+	f.parent = executionID
+	return 5, []string{"library/busybox"}, nil
+}
+
+func TestRetryExecution(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	policyMgr := replication.PolicyCtl
+	registryMgr := replication.RegistryMgr
+	defer func() {
+		replication.OperationCtl = operationCtl
+		replication.PolicyCtl = policyMgr
+		replication.RegistryMgr = registryMgr
+	}()
+	ctl := &fakedRetryOperationController{}
+	replication.OperationCtl = ctl
+	replication.PolicyCtl = &fakedPolicyManager{}
+	replication.RegistryMgr = &fakedRegistryManager{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/executions/1/retry",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/1/retry",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 404
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/2/retry",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 409, the execution is in progress
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/3/retry",
+				credential: sysAdmin,
+			},
+			code: http.StatusConflict,
+		},
+		// 400, no repository failed
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/executions/4/retry",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// 201
+	resp, err := handle(&testingRequest{
+		method:     http.MethodPost,
+		url:        "/api/replication/executions/1/retry",
+		credential: sysAdmin,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "/api/replication/executions/5", resp.Header().Get("Location"))
+	result := &executionRetryResult{}
+	require.Nil(t, json.Unmarshal(resp.Body.Bytes(), result))
+	assert.Equal(t, &executionRetryResult{
+		ExecutionID:  5,
+		ParentID:     1,
+		Repositories: []string{"library/busybox"},
+	}, result)
+	assert.Equal(t, int64(1), ctl.parent)
+	require.NotNil(t, ctl.policy)
+	assert.Equal(t, int64(1), ctl.policy.ID)
+}
+
+// fakedDeadLetterOperationController returns the dead letters of the failed task 1 and the succeed task 2
+type fakedDeadLetterOperationController struct {
+	fakedOperationController
+}
+
+func (f *fakedDeadLetterOperationController) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 1, []*models.DeadLetter{
+		{
+			ID:     1,
+			TaskID: 1,
+		},
+	}, nil
+}
+func (f *fakedDeadLetterOperationController) GetDeadLetter(id int64) (*models.DeadLetter, error) {
+	if id == 1 || id == 2 {
+		return &models.DeadLetter{
+			ID:     id,
+			TaskID: id,
+		}, nil
+	}
+	return nil, nil
+}
+func (f *fakedDeadLetterOperationController) GetTask(id int64) (*models.Task, error) {
+	task := &models.Task{
+		ID:          id,
+		ExecutionID: 1,
+		JobID:       "job",
+		Status:      models.TaskStatusFailed,
+	}
+	if id == 2 {
+		task.Status = models.TaskStatusSucceed
+	}
+	return task, nil
+}
+
+func TestDeadLetters(t *testing.T) {
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.OperationCtl = operationCtl
+	}()
+	replication.OperationCtl = &fakedDeadLetterOperationController{}
+
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodGet,
+				url:    "/api/replication/deadletters",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/deadletters",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400, invalid policy ID
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/deadletters?policy_id=abc",
+				credential: sysAdmin,
+			},
+			code: http.StatusBadRequest,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodGet,
+				url:        "/api/replication/deadletters?policy_id=1",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+		// 404, the dead letter doesn't exist
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/deadletters/3/requeue",
+				credential: sysAdmin,
+			},
+			code: http.StatusNotFound,
+		},
+		// 409, the task isn't failed
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/deadletters/2/requeue",
+				credential: sysAdmin,
+			},
+			code: http.StatusConflict,
+		},
+		// 200
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/deadletters/1/requeue",
+				credential: sysAdmin,
+			},
+			code: http.StatusOK,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+}
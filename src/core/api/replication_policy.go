@@ -15,21 +15,37 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	common_http "github.com/goharbor/harbor/src/common/http"
 	common_model "github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/replication"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/event"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
 	"github.com/goharbor/harbor/src/replication/registry"
 )
 
 // TODO rename the file to "replication.go"
 
+const (
+	// the query parameter specifying whether the credential of the destination registry is validated
+	// to have the permission to push to the destination namespace when saving the push policy
+	validatePushParam = "validate_push"
+	// the repository under the destination namespace which the push permission is validated against,
+	// the upload session initiated for the validation is canceled so nothing is pushed to it
+	pushCheckRepository = "harbor-push-check"
+	// the timeout of validating the push permission
+	pushCheckTimeout = 30 * time.Second
+)
+
 // ReplicationPolicyAPI handles the replication policy requests
 type ReplicationPolicyAPI struct {
 	BaseController
@@ -84,7 +100,7 @@ func (r *ReplicationPolicyAPI) Create() {
 	policy := &model.Policy{}
 	isValid, err := r.DecodeJSONReqAndValidate(policy)
 	if !isValid {
-		r.SendBadRequestError(err)
+		r.SendDecodeJSONReqError(err)
 		return
 	}
 
@@ -96,6 +112,7 @@ func (r *ReplicationPolicyAPI) Create() {
 	}
 
 	policy.Creator = r.SecurityCtx.GetUsername()
+	policy.ConsecutiveFailures = 0
 	id, err := replication.PolicyCtl.Create(policy)
 	if err != nil {
 		r.SendInternalServerError(fmt.Errorf("failed to create the policy: %v", err))
@@ -104,6 +121,77 @@ func (r *ReplicationPolicyAPI) Create() {
 	r.Redirect(http.StatusCreated, strconv.FormatInt(id, 10))
 }
 
+// replicationPolicyPreview is the result of previewing the replication of a policy
+type replicationPolicyPreview struct {
+	Total int64               `json:"total"`
+	Items []*flow.PreviewItem `json:"items"`
+	// the reasons why the repositories are skipped because of the allowed projects
+	Skipped []string `json:"skipped,omitempty"`
+	// the errors and warnings of all the matched resources, not only the ones of the page, so
+	// the problems are visible without going through all the pages
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Preview returns the resources which the policy in the request would replicate if it ran now,
+// nothing is transferred and the policy isn't saved. The matched resources are paginated
+func (r *ReplicationPolicyAPI) Preview() {
+	page, size, err := r.GetPaginationParams()
+	if err != nil {
+		r.SendBadRequestError(err)
+		return
+	}
+	policy := &model.Policy{}
+	isValid, err := r.DecodeJSONReqAndValidate(policy)
+	if !isValid {
+		r.SendDecodeJSONReqError(err)
+		return
+	}
+	if !r.validateRegistry(policy) {
+		return
+	}
+	if err = event.PopulateRegistries(replication.RegistryMgr, policy); err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to populate the registries of the policy: %v", err))
+		return
+	}
+	items, skipped, err := replication.OperationCtl.PreviewReplication(policy)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to preview the replication: %v", err))
+		return
+	}
+
+	total := int64(len(items))
+	start, end := (page-1)*size, page*size
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	r.SetPaginationHeader(total, page, size)
+	preview := &replicationPolicyPreview{
+		Total:   total,
+		Items:   items[start:end],
+		Skipped: skipped,
+	}
+	errs, warnings := map[string]bool{}, map[string]bool{}
+	for _, item := range items {
+		for _, e := range item.Errors {
+			if !errs[e] {
+				errs[e] = true
+				preview.Errors = append(preview.Errors, e)
+			}
+		}
+		for _, w := range item.Warnings {
+			if !warnings[w] {
+				warnings[w] = true
+				preview.Warnings = append(preview.Warnings, w)
+			}
+		}
+	}
+	r.WriteJSONData(preview)
+}
+
 // make sure the policy name doesn't exist
 func (r *ReplicationPolicyAPI) validateName(policy *model.Policy) bool {
 	p, err := replication.PolicyCtl.GetByName(policy.Name)
@@ -126,18 +214,90 @@ func (r *ReplicationPolicyAPI) validateRegistry(policy *model.Policy) bool {
 	} else {
 		registryID = policy.DestRegistry.ID
 	}
-	registry, err := replication.RegistryMgr.Get(registryID)
+	reg, err := replication.RegistryMgr.Get(registryID)
 	if err != nil {
 		r.SendConflictError(fmt.Errorf("failed to get registry %d: %v", registryID, err))
 		return false
 	}
-	if registry == nil {
+	if reg == nil {
 		r.SendBadRequestError(fmt.Errorf("registry %d not found", registryID))
 		return false
 	}
+	// the registry added before the check of the local Harbor was introduced may point to the local Harbor
+	if registry.IsLocal(reg.URL) {
+		r.SendBadRequestError(fmt.Errorf("the registry %s points to the local Harbor, the replication would loop", reg.Name))
+		return false
+	}
+	if project := filteredProject(policy); len(project) > 0 && !reg.AllowsProject(project) {
+		r.SendBadRequestError(fmt.Errorf("the project %s isn't in the allowed projects %v of the registry %s",
+			project, reg.AllowedProjects, reg.Name))
+		return false
+	}
+	return r.validatePushPermission(policy, reg)
+}
+
+// make sure the credential of the destination registry can push to the destination namespace by requesting
+// the push scope of it. It's only validated for the push policies when it's requested, as the namespace may
+// not exist until it's created by the replication
+func (r *ReplicationPolicyAPI) validatePushPermission(policy *model.Policy, reg *model.Registry) bool {
+	validate, err := r.GetBool(validatePushParam, false)
+	if err != nil {
+		r.SendBadRequestError(fmt.Errorf("invalid %s: %v", validatePushParam, err))
+		return false
+	}
+	if !validate || (policy.SrcRegistry != nil && policy.SrcRegistry.ID > 0) {
+		return true
+	}
+	namespace := policy.DestNamespace
+	if len(namespace) == 0 {
+		namespace = filteredProject(policy)
+	}
+	if len(namespace) == 0 {
+		r.SendBadRequestError(errors.New("the destination namespace cannot be determined to validate the push permission, " +
+			"specify the destination namespace or the project in the name filter"))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Ctx.Request.Context(), pushCheckTimeout)
+	defer cancel()
+	canPush, err := registry.CheckPushPermissionWithContext(ctx, reg, namespace+"/"+pushCheckRepository)
+	if err != nil {
+		r.SendInternalServerError(fmt.Errorf("failed to check the push permission to the namespace %s of registry %s: %v",
+			namespace, reg.Name, err))
+		return false
+	}
+	if !canPush {
+		r.SendHTTPError(&common_http.Error{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("the credential of registry %s has no push scope on the namespace %s", reg.Name, namespace),
+			Hint:    "grant the push permission of the namespace to the account, or make sure the namespace exists on the registry",
+		})
+		return false
+	}
 	return true
 }
 
+// filteredProject returns the project specified by the name filter of the policy, empty
+// string is returned if it cannot be determined, e.g. the project part contains wildcards,
+// in which case the repositories are checked when replicating
+func filteredProject(policy *model.Policy) string {
+	for _, filter := range policy.Filters {
+		if filter.Type != model.FilterTypeName {
+			continue
+		}
+		value, ok := filter.Value.(string)
+		if !ok {
+			return ""
+		}
+		strs := strings.SplitN(value, "/", 2)
+		if len(strs) != 2 || strings.ContainsAny(strs[0], "*?[{") {
+			return ""
+		}
+		return strs[0]
+	}
+	return ""
+}
+
 // Get the specified replication policy
 func (r *ReplicationPolicyAPI) Get() {
 	id, err := r.GetInt64FromPath(":id")
@@ -184,7 +344,7 @@ func (r *ReplicationPolicyAPI) Update() {
 	policy := &model.Policy{}
 	isValid, err := r.DecodeJSONReqAndValidate(policy)
 	if !isValid {
-		r.SendBadRequestError(err)
+		r.SendDecodeJSONReqError(err)
 		return
 	}
 
@@ -198,6 +358,11 @@ func (r *ReplicationPolicyAPI) Update() {
 	}
 
 	policy.ID = id
+	// the consecutive failures are only reset when the policy is enabled again
+	policy.ConsecutiveFailures = originalPolicy.ConsecutiveFailures
+	if !originalPolicy.Enabled && policy.Enabled {
+		policy.ConsecutiveFailures = 0
+	}
 	if err := replication.PolicyCtl.Update(policy); err != nil {
 		r.SendInternalServerError(fmt.Errorf("failed to update the policy %d: %v", id, err))
 		return
@@ -276,22 +441,19 @@ func isTaskRunning(task *models.Task) bool {
 	switch task.Status {
 	case models.TaskStatusSucceed,
 		models.TaskStatusStopped,
-		models.TaskStatusFailed:
+		models.TaskStatusFailed,
+		models.TaskStatusPaused:
 		return false
 	}
 	return true
 }
 
-// ignore the credential for the registries
+// populate the registries of the policy without the secrets
 func populateRegistries(registryMgr registry.Manager, policy *model.Policy) error {
 	if err := event.PopulateRegistries(registryMgr, policy); err != nil {
 		return err
 	}
-	if policy.SrcRegistry != nil {
-		hideAccessSecret(policy.SrcRegistry.Credential)
-	}
-	if policy.DestRegistry != nil {
-		hideAccessSecret(policy.DestRegistry.Credential)
-	}
+	policy.SrcRegistry = sanitizeRegistry(policy.SrcRegistry)
+	policy.DestRegistry = sanitizeRegistry(policy.DestRegistry)
 	return nil
 }
@@ -15,16 +15,24 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/goharbor/harbor/src/replication"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO rename the file to "replication.go"
 
-type fakedRegistryManager struct{}
+type fakedRegistryManager struct {
+	// the registries returned besides the built-in ones
+	registries map[int64]*model.Registry
+}
 
 func (f *fakedRegistryManager) Add(*model.Registry) (int64, error) {
 	return 0, nil
@@ -33,19 +41,40 @@ func (f *fakedRegistryManager) List(...*model.RegistryQuery) (int64, []*model.Re
 	return 0, nil, nil
 }
 func (f *fakedRegistryManager) Get(id int64) (*model.Registry, error) {
+	if r, exist := f.registries[id]; exist {
+		return r, nil
+	}
 	if id == 1 {
 		return &model.Registry{
 			Type: "faked_registry",
 		}, nil
 	}
+	if id == 3 {
+		return &model.Registry{
+			Name:            "restricted",
+			Type:            "faked_registry",
+			AllowedProjects: []string{"library"},
+		}, nil
+	}
 	return nil, nil
 }
 func (f *fakedRegistryManager) GetByName(string) (*model.Registry, error) {
 	return nil, nil
 }
+func (f *fakedRegistryManager) GetDefault() (*model.Registry, error) {
+	for _, r := range f.registries {
+		if r.Default {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
 func (f *fakedRegistryManager) Update(*model.Registry, ...string) error {
 	return nil
 }
+func (f *fakedRegistryManager) Import([]*model.Registry) error {
+	return nil
+}
 func (f *fakedRegistryManager) Remove(int64) error {
 	return nil
 }
@@ -174,6 +203,27 @@ func TestReplicationPolicyAPICreate(t *testing.T) {
 			},
 			code: http.StatusBadRequest,
 		},
+		// 400, project isn't allowed by the registry
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies",
+				credential: sysAdmin,
+				bodyJSON: &model.Policy{
+					Name: "policy01",
+					DestRegistry: &model.Registry{
+						ID: 3,
+					},
+					Filters: []*model.Filter{
+						{
+							Type:  model.FilterTypeName,
+							Value: "secret/**",
+						},
+					},
+				},
+			},
+			code: http.StatusBadRequest,
+		},
 		// 201
 		{
 			request: &testingRequest{
@@ -194,6 +244,142 @@ func TestReplicationPolicyAPICreate(t *testing.T) {
 	runCodeCheckingCases(t, cases...)
 }
 
+func TestReplicationPolicyAPIValidatePush(t *testing.T) {
+	// the credential can push to the namespace "writable" but only pull from the others
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/writable/harbor-push-check/blobs/uploads/":
+			w.Header().Set("Location", r.URL.Path+"uuid")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	policyMgr := replication.PolicyCtl
+	registryMgr := replication.RegistryMgr
+	defer func() {
+		replication.PolicyCtl = policyMgr
+		replication.RegistryMgr = registryMgr
+	}()
+	replication.PolicyCtl = &fakedPolicyManager{}
+	replication.RegistryMgr = &fakedRegistryManager{
+		registries: map[int64]*model.Registry{
+			4: {
+				Name: "push-check",
+				Type: model.RegistryTypeDockerRegistry,
+				URL:  server.URL,
+			},
+		},
+	}
+	policy := func(namespace string) *model.Policy {
+		return &model.Policy{
+			Name: "policy01",
+			DestRegistry: &model.Registry{
+				ID: 4,
+			},
+			DestNamespace: namespace,
+		}
+	}
+	cases := []*codeCheckingCase{
+		// 400, invalid parameter
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies?validate_push=maybe",
+				credential: sysAdmin,
+				bodyJSON:   policy("writable"),
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, the destination namespace cannot be determined
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies?validate_push=true",
+				credential: sysAdmin,
+				bodyJSON:   policy(""),
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, the credential can only pull from the namespace
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies?validate_push=true",
+				credential: sysAdmin,
+				bodyJSON:   policy("readonly"),
+			},
+			code: http.StatusBadRequest,
+		},
+		// 201, the push permission isn't validated if it's not requested
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies",
+				credential: sysAdmin,
+				bodyJSON:   policy("readonly"),
+			},
+			code: http.StatusCreated,
+		},
+		// 201, the credential can push to the namespace
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies?validate_push=true",
+				credential: sysAdmin,
+				bodyJSON:   policy("writable"),
+			},
+			code: http.StatusCreated,
+		},
+		// 200, the namespace is determined by the name filter
+		{
+			request: &testingRequest{
+				method:     http.MethodPut,
+				url:        "/api/replication/policies/1?validate_push=true",
+				credential: sysAdmin,
+				bodyJSON: &model.Policy{
+					Name: "policy01",
+					DestRegistry: &model.Registry{
+						ID: 4,
+					},
+					Filters: []*model.Filter{
+						{
+							Type:  model.FilterTypeName,
+							Value: "writable/**",
+						},
+					},
+				},
+			},
+			code: http.StatusOK,
+		},
+	}
+
+	runCodeCheckingCases(t, cases...)
+}
+
+func TestFilteredProject(t *testing.T) {
+	cases := []struct {
+		filters []*model.Filter
+		project string
+	}{
+		{nil, ""},
+		{[]*model.Filter{{Type: model.FilterTypeTag, Value: "library/*"}}, ""},
+		{[]*model.Filter{{Type: model.FilterTypeName, Value: "library/**"}}, "library"},
+		{[]*model.Filter{{Type: model.FilterTypeName, Value: "lib*/hello-world"}}, ""},
+		{[]*model.Filter{{Type: model.FilterTypeName, Value: "hello-world"}}, ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.project, filteredProject(&model.Policy{Filters: c.filters}))
+	}
+}
+
 func TestReplicationPolicyAPIGet(t *testing.T) {
 	policyMgr := replication.PolicyCtl
 	registryMgr := replication.RegistryMgr
@@ -391,3 +577,120 @@ func TestReplicationPolicyAPIDelete(t *testing.T) {
 
 	runCodeCheckingCases(t, cases...)
 }
+
+func TestReplicationPolicyAPIPreview(t *testing.T) {
+	registryMgr := replication.RegistryMgr
+	operationCtl := replication.OperationCtl
+	defer func() {
+		replication.RegistryMgr = registryMgr
+		replication.OperationCtl = operationCtl
+	}()
+	replication.RegistryMgr = &fakedRegistryManager{}
+	replication.OperationCtl = &fakedOperationController{}
+	cases := []*codeCheckingCase{
+		// 401
+		{
+			request: &testingRequest{
+				method: http.MethodPost,
+				url:    "/api/replication/policies/preview",
+			},
+			code: http.StatusUnauthorized,
+		},
+		// 403
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies/preview",
+				credential: nonSysAdmin,
+			},
+			code: http.StatusForbidden,
+		},
+		// 400 empty registry
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies/preview",
+				credential: sysAdmin,
+				bodyJSON: &model.Policy{
+					Name: "policy01",
+				},
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, registry not found
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies/preview",
+				credential: sysAdmin,
+				bodyJSON: &model.Policy{
+					Name: "policy01",
+					SrcRegistry: &model.Registry{
+						ID: 2,
+					},
+				},
+			},
+			code: http.StatusBadRequest,
+		},
+		// 400, invalid page
+		{
+			request: &testingRequest{
+				method:     http.MethodPost,
+				url:        "/api/replication/policies/preview?page=0",
+				credential: sysAdmin,
+				bodyJSON: &model.Policy{
+					Name: "policy01",
+					SrcRegistry: &model.Registry{
+						ID: 1,
+					},
+				},
+			},
+			code: http.StatusBadRequest,
+		},
+	}
+	runCodeCheckingCases(t, cases...)
+
+	// the second page
+	resp, err := handle(&testingRequest{
+		method:     http.MethodPost,
+		url:        "/api/replication/policies/preview?page=2&page_size=2",
+		credential: sysAdmin,
+		bodyJSON: &model.Policy{
+			Name: "policy01",
+			SrcRegistry: &model.Registry{
+				ID: 1,
+			},
+		},
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "3", resp.Header().Get("X-Total-Count"))
+	preview := &replicationPolicyPreview{}
+	require.Nil(t, json.Unmarshal(resp.Body.Bytes(), preview))
+	assert.Equal(t, int64(3), preview.Total)
+	require.Equal(t, 1, len(preview.Items))
+	assert.Equal(t, "library/alpine", preview.Items[0].Repository)
+	// the warnings of the items on the other pages are surfaced as well
+	assert.Empty(t, preview.Items[0].Warnings)
+	assert.Empty(t, preview.Errors)
+	require.Equal(t, 1, len(preview.Warnings))
+	assert.Equal(t, "the tag latest exists on the destination repository library/hello-world with the different content", preview.Warnings[0])
+
+	// the page beyond the matched resources
+	resp, err = handle(&testingRequest{
+		method:     http.MethodPost,
+		url:        "/api/replication/policies/preview?page=3&page_size=2",
+		credential: sysAdmin,
+		bodyJSON: &model.Policy{
+			Name: "policy01",
+			SrcRegistry: &model.Registry{
+				ID: 1,
+			},
+		},
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.Code)
+	preview = &replicationPolicyPreview{}
+	require.Nil(t, json.Unmarshal(resp.Body.Bytes(), preview))
+	assert.Equal(t, 0, len(preview.Items))
+}
@@ -527,6 +527,10 @@ func (ra *RepositoryAPI) Retag() {
 		Repo:    repo,
 		Tag:     request.Tag,
 	}); err != nil {
+		if e, ok := err.(*registry.ManifestTooLargeError); ok {
+			ra.SendUnprocessableEntityError(e)
+			return
+		}
 		ra.SendInternalServerError(fmt.Errorf("%v", err))
 	}
 }
@@ -783,6 +787,11 @@ func (ra *RepositoryAPI) GetManifests() {
 
 	manifest, err := getManifest(rc, tag, version)
 	if err != nil {
+		// the manifest exceeding the size limit cannot be handled, retrying doesn't help
+		if e, ok := err.(*registry.ManifestTooLargeError); ok {
+			ra.SendUnprocessableEntityError(e)
+			return
+		}
 		ra.ParseAndHandleError(fmt.Sprintf("error occurred while getting manifest of %s:%s", repoName, tag), err)
 		return
 	}
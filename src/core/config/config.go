@@ -26,7 +26,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/goharbor/harbor/src/common"
 	comcfg "github.com/goharbor/harbor/src/common/config"
@@ -472,6 +474,115 @@ func GetClairHealthCheckServerURL() string {
 	return url
 }
 
+// GetRegistryHealthCheckInterval returns the interval of the health check
+// for the replication registries, 0 is returned if it isn't set or invalid
+func GetRegistryHealthCheckInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("REGISTRY_HEALTH_CHECK_INTERVAL"))
+	if err != nil {
+		return 0
+	}
+	return interval
+}
+
+// GetRegistryHealthCheckConcurrency returns the max count of the registries
+// checked concurrently, 0 is returned if it isn't set or invalid
+func GetRegistryHealthCheckConcurrency() int {
+	concurrency, err := strconv.Atoi(os.Getenv("REGISTRY_HEALTH_CHECK_CONCURRENCY"))
+	if err != nil {
+		return 0
+	}
+	return concurrency
+}
+
+// GetRegistryDialTimeout returns the timeout of connecting to the replication
+// registries, 0 is returned if it isn't set or invalid
+func GetRegistryDialTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("REGISTRY_DIAL_TIMEOUT"))
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// GetRegistryTLSHandshakeTimeout returns the timeout of the TLS handshake with the
+// replication registries, 0 is returned if it isn't set or invalid
+func GetRegistryTLSHandshakeTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT"))
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// GetRegistryNameserver returns the DNS server resolving the hostnames of the replication
+// registries, the system resolver is used if it isn't set
+func GetRegistryNameserver() string {
+	return os.Getenv("REGISTRY_NAMESERVER")
+}
+
+// GetRegistryHosts returns the static mappings from the hostnames of the replication registries to the
+// IP addresses, it's read from the environment variable in the format "host1=ip1,host2=ip2" and the
+// invalid entries are ignored
+func GetRegistryHosts() map[string]string {
+	hosts := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv("REGISTRY_HOSTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			continue
+		}
+		hosts[entry[:i]] = entry[i+1:]
+	}
+	return hosts
+}
+
+// GetRegistryMaxManifestSize returns the max size in bytes of the manifests pulled from the
+// replication registries, 0 is returned if it isn't set or invalid
+func GetRegistryMaxManifestSize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("REGISTRY_MAX_MANIFEST_SIZE"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// GetRegistryDefaultCredential returns the access key and secret used to access the
+// replication registries which have no credential configured
+func GetRegistryDefaultCredential() (string, string) {
+	return os.Getenv("REGISTRY_DEFAULT_ACCESS_KEY"), os.Getenv("REGISTRY_DEFAULT_ACCESS_SECRET")
+}
+
+// GetReplicationSecretKeys returns the keyring used to encrypt the secrets of the replication registries,
+// it's read from the environment variable in the format "version1:key1,version2:key2". The error is
+// returned for the invalid or duplicated entries. The secrets without key version are encrypted with
+// the secret key of Harbor
+func GetReplicationSecretKeys() (map[string]string, error) {
+	keys := map[string]string{}
+	value := strings.TrimSpace(os.Getenv("REPLICATION_SECRET_KEYS"))
+	if len(value) == 0 {
+		return keys, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		i := strings.Index(entry, ":")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("invalid entry %q in REPLICATION_SECRET_KEYS, the format is \"version:key\"", entry)
+		}
+		version := entry[:i]
+		if _, exist := keys[version]; exist {
+			return nil, fmt.Errorf("duplicated key version %s in REPLICATION_SECRET_KEYS", version)
+		}
+		keys[version] = entry[i+1:]
+	}
+	return keys, nil
+}
+
+// GetReplicationSecretKeyVersion returns the version of the key in the keyring used to encrypt the new
+// secrets of the replication registries, the secret key of Harbor is used if it isn't set
+func GetReplicationSecretKeyVersion() string {
+	return os.Getenv("REPLICATION_SECRET_KEY_VERSION")
+}
+
 // HTTPAuthProxySetting returns the setting of HTTP Auth proxy.  the settings are only meaningful when the auth_mode is
 // set to http_auth
 func HTTPAuthProxySetting() (*models.HTTPAuthProxy, error) {
@@ -19,6 +19,7 @@ import (
 	"path"
 	"runtime"
 	"testing"
+	"time"
 
 	"fmt"
 	"github.com/goharbor/harbor/src/common"
@@ -26,6 +27,7 @@ import (
 	"github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/common/utils/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // test functions under package core/config
@@ -263,3 +265,111 @@ func TestOIDCSetting(t *testing.T) {
 	assert.Equal(t, "https://harbor.test/c/oidc/callback", v.RedirectURL)
 	assert.ElementsMatch(t, []string{"openid", "profile"}, v.Scope)
 }
+
+func TestRegistryHealthCheckSettings(t *testing.T) {
+	defer os.Unsetenv("REGISTRY_HEALTH_CHECK_INTERVAL")
+	defer os.Unsetenv("REGISTRY_HEALTH_CHECK_CONCURRENCY")
+
+	os.Unsetenv("REGISTRY_HEALTH_CHECK_INTERVAL")
+	os.Unsetenv("REGISTRY_HEALTH_CHECK_CONCURRENCY")
+	assert.Equal(t, time.Duration(0), GetRegistryHealthCheckInterval())
+	assert.Equal(t, 0, GetRegistryHealthCheckConcurrency())
+
+	os.Setenv("REGISTRY_HEALTH_CHECK_INTERVAL", "10m")
+	os.Setenv("REGISTRY_HEALTH_CHECK_CONCURRENCY", "3")
+	assert.Equal(t, 10*time.Minute, GetRegistryHealthCheckInterval())
+	assert.Equal(t, 3, GetRegistryHealthCheckConcurrency())
+
+	os.Setenv("REGISTRY_HEALTH_CHECK_INTERVAL", "invalid")
+	os.Setenv("REGISTRY_HEALTH_CHECK_CONCURRENCY", "invalid")
+	assert.Equal(t, time.Duration(0), GetRegistryHealthCheckInterval())
+	assert.Equal(t, 0, GetRegistryHealthCheckConcurrency())
+}
+
+func TestRegistryTimeoutSettings(t *testing.T) {
+	defer os.Unsetenv("REGISTRY_DIAL_TIMEOUT")
+	defer os.Unsetenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT")
+
+	os.Unsetenv("REGISTRY_DIAL_TIMEOUT")
+	os.Unsetenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT")
+	assert.Equal(t, time.Duration(0), GetRegistryDialTimeout())
+	assert.Equal(t, time.Duration(0), GetRegistryTLSHandshakeTimeout())
+
+	os.Setenv("REGISTRY_DIAL_TIMEOUT", "5s")
+	os.Setenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT", "1m")
+	assert.Equal(t, 5*time.Second, GetRegistryDialTimeout())
+	assert.Equal(t, time.Minute, GetRegistryTLSHandshakeTimeout())
+
+	os.Setenv("REGISTRY_DIAL_TIMEOUT", "invalid")
+	os.Setenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT", "invalid")
+	assert.Equal(t, time.Duration(0), GetRegistryDialTimeout())
+	assert.Equal(t, time.Duration(0), GetRegistryTLSHandshakeTimeout())
+}
+
+func TestGetRegistryMaxManifestSize(t *testing.T) {
+	defer os.Unsetenv("REGISTRY_MAX_MANIFEST_SIZE")
+
+	os.Unsetenv("REGISTRY_MAX_MANIFEST_SIZE")
+	assert.Equal(t, int64(0), GetRegistryMaxManifestSize())
+
+	os.Setenv("REGISTRY_MAX_MANIFEST_SIZE", "1048576")
+	assert.Equal(t, int64(1048576), GetRegistryMaxManifestSize())
+
+	os.Setenv("REGISTRY_MAX_MANIFEST_SIZE", "invalid")
+	assert.Equal(t, int64(0), GetRegistryMaxManifestSize())
+}
+
+func TestRegistryResolverSettings(t *testing.T) {
+	defer os.Unsetenv("REGISTRY_NAMESERVER")
+	defer os.Unsetenv("REGISTRY_HOSTS")
+
+	os.Unsetenv("REGISTRY_NAMESERVER")
+	os.Unsetenv("REGISTRY_HOSTS")
+	assert.Equal(t, "", GetRegistryNameserver())
+	assert.Equal(t, map[string]string{}, GetRegistryHosts())
+
+	os.Setenv("REGISTRY_NAMESERVER", "10.0.0.2:53")
+	os.Setenv("REGISTRY_HOSTS", "registry.harbor.test=10.0.0.10, invalid,=10.0.0.11,dr.harbor.test=")
+	assert.Equal(t, "10.0.0.2:53", GetRegistryNameserver())
+	assert.Equal(t, map[string]string{"registry.harbor.test": "10.0.0.10"}, GetRegistryHosts())
+}
+
+func TestGetRegistryDefaultCredential(t *testing.T) {
+	defer os.Unsetenv("REGISTRY_DEFAULT_ACCESS_KEY")
+	defer os.Unsetenv("REGISTRY_DEFAULT_ACCESS_SECRET")
+
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_KEY", "robot")
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_SECRET", "password")
+	key, secret := GetRegistryDefaultCredential()
+	assert.Equal(t, "robot", key)
+	assert.Equal(t, "password", secret)
+}
+
+func TestGetReplicationSecretKeys(t *testing.T) {
+	defer os.Unsetenv("REPLICATION_SECRET_KEYS")
+	defer os.Unsetenv("REPLICATION_SECRET_KEY_VERSION")
+
+	os.Unsetenv("REPLICATION_SECRET_KEYS")
+	os.Unsetenv("REPLICATION_SECRET_KEY_VERSION")
+	keys, err := GetReplicationSecretKeys()
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Equal(t, "", GetReplicationSecretKeyVersion())
+
+	os.Setenv("REPLICATION_SECRET_KEYS", "1:1234567890123456, 2:abcdefghijklmnop")
+	os.Setenv("REPLICATION_SECRET_KEY_VERSION", "2")
+	keys, err = GetReplicationSecretKeys()
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"1": "1234567890123456",
+		"2": "abcdefghijklmnop",
+	}, keys)
+	assert.Equal(t, "2", GetReplicationSecretKeyVersion())
+
+	// the invalid and duplicated entries
+	for _, value := range []string{"invalid", ":key", "3:", "1:1234567890123456,1:abcdefghijklmnop"} {
+		os.Setenv("REPLICATION_SECRET_KEYS", value)
+		_, err = GetReplicationSecretKeys()
+		assert.NotNil(t, err, value)
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/astaxie/beego"
 	_ "github.com/astaxie/beego/session/redis"
+	common_api "github.com/goharbor/harbor/src/common/api"
 	"github.com/goharbor/harbor/src/common/dao"
 	"github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/common/utils"
@@ -88,6 +89,9 @@ func main() {
 		beego.BConfig.WebConfig.Session.SessionProviderConfig = redisURL
 	}
 	beego.AddTemplateExt("htm")
+	if size, err := strconv.ParseInt(os.Getenv("MAX_REQUEST_BODY_SIZE"), 10, 64); err == nil && size > 0 {
+		common_api.MaxRequestBodySize = size
+	}
 
 	log.Info("initializing configurations...")
 	if err := config.Init(); err != nil {
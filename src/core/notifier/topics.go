@@ -8,4 +8,7 @@ import (
 const (
 	// ScanAllPolicyTopic is for notifying the change of scanning all policy.
 	ScanAllPolicyTopic = common.ScanAllPolicy
+	// ReplicationPolicyDisabledTopic is for notifying that the replication policy is disabled
+	// as its executions fail consecutively.
+	ReplicationPolicyDisabledTopic = "OnReplicationPolicyDisabled"
 )
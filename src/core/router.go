@@ -90,6 +90,10 @@ func initRouters() {
 	beego.Router("/api/repositories/*/signatures", &api.RepositoryAPI{}, "get:GetSignatures")
 	beego.Router("/api/repositories/top", &api.RepositoryAPI{}, "get:GetTopRepos")
 	beego.Router("/api/jobs/scan/:id([0-9]+)/log", &api.ScanJobAPI{}, "get:GetLog")
+	beego.Router("/api/jobs/config", &api.JobConfigAPI{}, "get:Get")
+	beego.Router("/api/jobs/config/reload", &api.JobConfigAPI{}, "post:Reload")
+	beego.Router("/api/jobs/maintenance", &api.JobMaintenanceAPI{}, "get:Get;post:Post")
+	beego.Router("/api/jobs/replication/:id([0-9]+)/log", &api.ReplicationOperationAPI{}, "get:GetJobLog")
 
 	beego.Router("/api/system/gc", &api.GCAPI{}, "get:List")
 	beego.Router("/api/system/gc/:id", &api.GCAPI{}, "get:GetGC")
@@ -101,11 +105,23 @@ func initRouters() {
 
 	beego.Router("/api/replication/adapters", &api.ReplicationAdapterAPI{}, "get:List")
 	beego.Router("/api/replication/executions", &api.ReplicationOperationAPI{}, "get:ListExecutions;post:CreateExecution")
+	beego.Router("/api/replication/executions/actions", &api.ReplicationOperationAPI{}, "post:ExecuteAction")
+	beego.Router("/api/replication/executions/single", &api.ReplicationOperationAPI{}, "post:CreateSingleExecution")
 	beego.Router("/api/replication/executions/:id([0-9]+)", &api.ReplicationOperationAPI{}, "get:GetExecution;put:StopExecution")
+	beego.Router("/api/replication/executions/:id([0-9]+)/events", &api.ReplicationOperationAPI{}, "get:StreamExecutionEvents")
+	beego.Router("/api/replication/executions/:id([0-9]+)/retry", &api.ReplicationOperationAPI{}, "post:RetryExecution")
 	beego.Router("/api/replication/executions/:id([0-9]+)/tasks", &api.ReplicationOperationAPI{}, "get:ListTasks")
 	beego.Router("/api/replication/executions/:id([0-9]+)/tasks/:tid([0-9]+)/log", &api.ReplicationOperationAPI{}, "get:GetTaskLog")
+	beego.Router("/api/replication/tasks", &api.ReplicationOperationAPI{}, "get:ListAllTasks")
+	beego.Router("/api/replication/tasks/report.csv", &api.ReplicationOperationAPI{}, "get:ExportTasksReport")
+	beego.Router("/api/replication/deadletters", &api.ReplicationOperationAPI{}, "get:ListDeadLetters")
+	beego.Router("/api/replication/deadletters/:id([0-9]+)/requeue", &api.ReplicationOperationAPI{}, "post:RequeueDeadLetter")
+	beego.Router("/api/replication/schedule", &api.ReplicationOperationAPI{}, "get:ListSchedule")
+	beego.Router("/api/replication/exclusions", &api.ReplicationExclusionAPI{}, "get:List;post:Create")
+	beego.Router("/api/replication/exclusions/:id([0-9]+)", &api.ReplicationExclusionAPI{}, "delete:Delete")
 
 	beego.Router("/api/replication/policies", &api.ReplicationPolicyAPI{}, "get:List;post:Create")
+	beego.Router("/api/replication/policies/preview", &api.ReplicationPolicyAPI{}, "post:Preview")
 	beego.Router("/api/replication/policies/:id([0-9]+)", &api.ReplicationPolicyAPI{}, "get:Get;put:Update;delete:Delete")
 
 	beego.Router("/api/internal/configurations", &api.ConfigAPI{}, "get:GetInternalConfig;put:Put")
@@ -132,8 +148,19 @@ func initRouters() {
 	beego.Router("/service/token", &token.Handler{})
 
 	beego.Router("/api/registries", &api.RegistryAPI{}, "get:List;post:Post")
-	beego.Router("/api/registries/:id([0-9]+)", &api.RegistryAPI{}, "get:Get;put:Put;delete:Delete")
+	beego.Router("/api/registries/:id([0-9]+)", &api.RegistryAPI{}, "get:Get;put:Put;patch:Patch;delete:Delete")
 	beego.Router("/api/registries/ping", &api.RegistryAPI{}, "post:Ping")
+	beego.Router("/api/registries/ping/batch", &api.RegistryAPI{}, "post:PingBatch")
+	beego.Router("/api/registries/export", &api.RegistryAPI{}, "get:Export")
+	beego.Router("/api/registries/import", &api.RegistryAPI{}, "post:Import")
+	beego.Router("/api/registries/permitted", &api.PermittedRegistryAPI{}, "get:List")
+	beego.Router("/api/registries/default", &api.PermittedRegistryAPI{}, "get:GetDefault")
+	beego.Router("/api/registries/:id([0-9]+)/reset-breaker", &api.RegistryAPI{}, "post:ResetBreaker")
+	beego.Router("/api/registries/:id([0-9]+)/warmup", &api.RegistryAPI{}, "post:WarmUp;get:GetWarmup")
+	beego.Router("/api/registries/:id([0-9]+)/capabilities", &api.RegistryAPI{}, "get:GetCapabilities")
+	beego.Router("/api/registries/:id([0-9]+)/repositories", &api.RegistryAPI{}, "get:ListRepositories")
+	// the regex of ":id" can't be used together with the "*" in the path, the ID is validated by the handler
+	beego.Router("/api/registries/:id/repositories/*/tags/:tag", &api.RegistryAPI{}, "delete:DeleteTag")
 	// we use "0" as the ID of the local Harbor registry, so don't add "([0-9]+)" in the path
 	beego.Router("/api/registries/:id/info", &api.RegistryAPI{}, "get:GetInfo")
 	beego.Router("/api/registries/:id/namespace", &api.RegistryAPI{}, "get:GetNamespace")
@@ -42,8 +42,12 @@ var statusMap = map[string]string{
 type Handler struct {
 	api.BaseController
 	id        int64
+	jobID     string
 	status    string
 	rawStatus string
+	checkIn   string
+	// the job fails and won't be retried any more
+	dead bool
 }
 
 // Prepare ...
@@ -63,7 +67,10 @@ func (h *Handler) Prepare() {
 		h.Abort("200")
 		return
 	}
+	h.jobID = data.JobID
 	h.rawStatus = data.Status
+	h.checkIn = data.CheckIn
+	h.dead = data.Metadata != nil && data.Metadata.DieAt > 0
 	status, ok := statusMap[data.Status]
 	if !ok {
 		log.Debugf("drop the job status update event: job id-%d, status-%s", id, status)
@@ -96,7 +103,12 @@ func (h *Handler) HandleReplicationScheduleJob() {
 // HandleReplicationTask handles the webhook of replication task
 func (h *Handler) HandleReplicationTask() {
 	log.Debugf("received replication task status update event: task-%d, status-%s", h.id, h.status)
-	if err := hook.UpdateTask(replication.OperationCtl, h.id, h.rawStatus); err != nil {
+	if err := hook.UpdateTask(replication.OperationCtl, replication.PolicyCtl, h.id, &hook.JobStatus{
+		JobID:   h.jobID,
+		Status:  h.rawStatus,
+		CheckIn: h.checkIn,
+		Dead:    h.dead,
+	}); err != nil {
 		log.Errorf("Failed to update replication task status, id: %d, status: %s", h.id, h.status)
 		h.SendInternalServerError(err)
 		return
@@ -192,7 +192,7 @@ func checkEvent(event *models.Event) bool {
 	}
 	// if it is pull action, check the user-agent
 	userAgent := strings.ToLower(strings.TrimSpace(event.Request.UserAgent))
-	if userAgent == "harbor-registry-client" || userAgent == strings.ToLower(adapter.UserAgentReplication) {
+	if userAgent == "harbor-registry-client" || strings.HasPrefix(userAgent, strings.ToLower(adapter.UserAgentReplication)) {
 		return false
 	}
 	return true
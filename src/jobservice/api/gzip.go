@@ -0,0 +1,128 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/goharbor/harbor/src/jobservice/logger"
+)
+
+// gzipThreshold is the minimum size in bytes of the response body to be compressed
+const gzipThreshold = 1024
+
+// gzipHandler compresses the response with gzip if the client accepts it and
+// the size of the response body exceeds the threshold
+func gzipHandler(next http.Handler, threshold int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !acceptsGzip(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			threshold:      threshold,
+			code:           http.StatusOK,
+		}
+		defer gw.close()
+
+		next.ServeHTTP(gw, req)
+	})
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(encoding, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the response body until it exceeds the threshold,
+// then the buffered data and the subsequent writes are compressed
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	threshold   int
+	code        int
+	wroteHeader bool
+	buf         bytes.Buffer
+	gw          *gzip.Writer
+}
+
+// WriteHeader delays writing the status code until the encoding is decided
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.code = code
+}
+
+// Write buffers or compresses the data
+func (g *gzipResponseWriter) Write(data []byte) (int, error) {
+	g.wroteHeader = true
+	if g.gw != nil {
+		return g.gw.Write(data)
+	}
+
+	n, err := g.buf.Write(data)
+	if err != nil || g.buf.Len() <= g.threshold {
+		return n, err
+	}
+
+	// the threshold is exceeded, start compressing
+	g.setContentType()
+	g.Header().Set("Content-Encoding", "gzip")
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.code)
+	g.gw = gzip.NewWriter(g.ResponseWriter)
+	if _, err := g.gw.Write(g.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	g.buf.Reset()
+	return n, nil
+}
+
+// setContentType detects the content type with the uncompressed data
+// if it isn't set by the handler
+func (g *gzipResponseWriter) setContentType() {
+	if len(g.Header().Get("Content-Type")) == 0 {
+		g.Header().Set("Content-Type", http.DetectContentType(g.buf.Bytes()))
+	}
+}
+
+// close flushes the compressed data or writes the buffered data directly
+func (g *gzipResponseWriter) close() {
+	if g.gw != nil {
+		if err := g.gw.Close(); err != nil {
+			logger.Errorf("close gzip writer error: %s", err)
+		}
+		return
+	}
+
+	if g.buf.Len() == 0 {
+		g.ResponseWriter.WriteHeader(g.code)
+		return
+	}
+	g.setContentType()
+	g.ResponseWriter.WriteHeader(g.code)
+	writeDate(g.ResponseWriter, g.buf.Bytes())
+}
@@ -0,0 +1,79 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipHandler(t *testing.T) {
+	large := map[string]string{"data": strings.Repeat("a", 2*gzipThreshold)}
+	small := map[string]string{"data": "a"}
+	handler := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data := small
+		if req.URL.Query().Get("large") == "true" {
+			data = large
+		}
+		bytes, _ := json.Marshal(data)
+		w.Header().Set(http.CanonicalHeaderKey("content-type"), "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeDate(w, bytes)
+	}), gzipThreshold)
+
+	// large response with gzip accepted, should be compressed
+	req := httptest.NewRequest(http.MethodGet, "/?large=true", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=1.0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	reader, err := gzip.NewReader(rec.Body)
+	require.Nil(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	result := map[string]string{}
+	require.Nil(t, json.Unmarshal(decompressed, &result))
+	assert.Equal(t, large, result)
+
+	// small response with gzip accepted, should not be compressed
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"data":"a"}`, rec.Body.String())
+
+	// large response without gzip accepted, should not be compressed
+	req = httptest.NewRequest(http.MethodGet, "/?large=true", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	result = map[string]string{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, large, result)
+}
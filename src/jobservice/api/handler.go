@@ -26,10 +26,14 @@ import (
 	"fmt"
 	"github.com/goharbor/harbor/src/jobservice/common/query"
 	"github.com/goharbor/harbor/src/jobservice/common/utils"
+	"github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/core"
 	"github.com/goharbor/harbor/src/jobservice/errs"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/jobservice/logger"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/transfer"
+	"github.com/goharbor/harbor/src/replication/transfer/image"
 	"github.com/pkg/errors"
 	"strconv"
 )
@@ -37,6 +41,10 @@ import (
 const (
 	totalHeaderKey = "Total-Count"
 	nextCursorKey  = "Next-Cursor"
+	retryAfterKey  = "Retry-After"
+
+	// the seconds after which the clients retry to launch the jobs rejected in the maintenance mode
+	maintenanceRetryAfter = 60
 )
 
 // Handler defines approaches to handle the http requests.
@@ -61,6 +69,27 @@ type Handler interface {
 
 	// HandleGetJobsReq is used to handle the request of getting jobs
 	HandleGetJobsReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleGetConfigReq is used to handle the request of getting the non-secret configurations in effect
+	HandleGetConfigReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleReloadConfigReq is used to handle the request of reloading the hot-reloadable configurations
+	HandleReloadConfigReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleGetConnectionsReq is used to handle the request of getting the concurrent connections to the registries
+	HandleGetConnectionsReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleWarmUpReq is used to handle the request of warming up the connections to the registry
+	HandleWarmUpReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleGetWarmupsReq is used to handle the request of getting the statuses of the latest warmups of the registries
+	HandleGetWarmupsReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleMaintenanceReq is used to handle the request of enabling or disabling the maintenance mode
+	HandleMaintenanceReq(w http.ResponseWriter, req *http.Request)
+
+	// HandleGetMaintenanceReq is used to handle the request of getting the maintenance mode
+	HandleGetMaintenanceReq(w http.ResponseWriter, req *http.Request)
 }
 
 // DefaultHandler is the default request handler which implements the Handler interface.
@@ -77,6 +106,18 @@ func NewDefaultHandler(ctl core.Interface) *DefaultHandler {
 
 // HandleLaunchJobReq is implementation of method defined in interface 'Handler'
 func (dh *DefaultHandler) HandleLaunchJobReq(w http.ResponseWriter, req *http.Request) {
+	// reject the new jobs in the maintenance mode, the clients are told when to retry
+	inMaintenance, err := dh.controller.InMaintenance()
+	if err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.GetMaintenanceError(err))
+		return
+	}
+	if inMaintenance {
+		w.Header().Set(retryAfterKey, strconv.Itoa(maintenanceRetryAfter))
+		dh.handleError(w, req, http.StatusServiceUnavailable, errs.MaintenanceModeError())
+		return
+	}
+
 	data, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		dh.handleError(w, req, http.StatusInternalServerError, errs.ReadRequestBodyError(err))
@@ -189,6 +230,96 @@ func (dh *DefaultHandler) HandleCheckStatusReq(w http.ResponseWriter, req *http.
 	dh.handleJSONData(w, req, http.StatusOK, stats)
 }
 
+// HandleGetConfigReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleGetConfigReq(w http.ResponseWriter, req *http.Request) {
+	dh.handleJSONData(w, req, http.StatusOK, config.DefaultConfig.Settings())
+}
+
+// HandleReloadConfigReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleReloadConfigReq(w http.ResponseWriter, req *http.Request) {
+	if err := config.DefaultConfig.Reload(); err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.ReloadConfigError(err))
+		return
+	}
+
+	dh.handleJSONData(w, req, http.StatusOK, config.DefaultConfig.Settings())
+}
+
+// HandleGetConnectionsReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleGetConnectionsReq(w http.ResponseWriter, req *http.Request) {
+	dh.handleJSONData(w, req, http.StatusOK, transfer.Limiter.Connections())
+}
+
+// HandleWarmUpReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleWarmUpReq(w http.ResponseWriter, req *http.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.ReadRequestBodyError(err))
+		return
+	}
+
+	reg := &model.Registry{}
+	if err = json.Unmarshal(data, reg); err != nil {
+		dh.handleError(w, req, http.StatusBadRequest, errs.BadRequestError(err))
+		return
+	}
+	if reg.WarmupConnections <= 0 {
+		dh.handleError(w, req, http.StatusBadRequest, errs.BadRequestError("the count of the connections warmed up must be positive"))
+		return
+	}
+
+	status, err := image.WarmUp(reg)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if err == image.ErrWarmupUnsupported {
+			code = http.StatusBadRequest
+		}
+		dh.handleError(w, req, code, errs.WarmUpError(err))
+		return
+	}
+
+	dh.handleJSONData(w, req, http.StatusOK, status)
+}
+
+// HandleGetWarmupsReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleGetWarmupsReq(w http.ResponseWriter, req *http.Request) {
+	dh.handleJSONData(w, req, http.StatusOK, image.WarmupStatuses())
+}
+
+// HandleMaintenanceReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleMaintenanceReq(w http.ResponseWriter, req *http.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.ReadRequestBodyError(err))
+		return
+	}
+
+	maintenance := &job.Maintenance{}
+	if err = json.Unmarshal(data, maintenance); err != nil {
+		dh.handleError(w, req, http.StatusBadRequest, errs.BadRequestError(err))
+		return
+	}
+
+	if err = dh.controller.SetMaintenance(maintenance.Enabled); err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.SetMaintenanceError(err))
+		return
+	}
+	logger.Infof("The maintenance mode of job service is set to %t", maintenance.Enabled)
+
+	dh.handleJSONData(w, req, http.StatusOK, maintenance)
+}
+
+// HandleGetMaintenanceReq is implementation of method defined in interface 'Handler'
+func (dh *DefaultHandler) HandleGetMaintenanceReq(w http.ResponseWriter, req *http.Request) {
+	enabled, err := dh.controller.InMaintenance()
+	if err != nil {
+		dh.handleError(w, req, http.StatusInternalServerError, errs.GetMaintenanceError(err))
+		return
+	}
+
+	dh.handleJSONData(w, req, http.StatusOK, &job.Maintenance{Enabled: enabled})
+}
+
 // HandleJobLogReq is implementation of method defined in interface 'Handler'
 func (dh *DefaultHandler) HandleJobLogReq(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
@@ -287,8 +418,7 @@ func (dh *DefaultHandler) handleError(w http.ResponseWriter, req *http.Request,
 	// Log all errors
 	logger.Errorf("Serve http request '%s %s' error: %d %s", req.Method, req.URL.String(), code, err.Error())
 
-	w.WriteHeader(code)
-	writeDate(w, []byte(err.Error()))
+	writeProblem(w, req, code, err)
 }
 
 func (dh *DefaultHandler) log(req *http.Request, code int, text string) {
@@ -348,6 +478,22 @@ func extractQuery(req *http.Request) *query.Parameter {
 	return q
 }
 
+// write the error as the problem details defined by RFC 7807
+func writeProblem(w http.ResponseWriter, req *http.Request, code int, err error) {
+	data, e := json.Marshal(errs.NewProblem(code, err, req.URL.Path))
+	if e != nil {
+		// should not happen
+		logger.Errorf("Failed to marshal the problem details: %s", e)
+		w.WriteHeader(code)
+		writeDate(w, []byte(err.Error()))
+		return
+	}
+
+	w.Header().Set(http.CanonicalHeaderKey("content-type"), errs.ProblemContentType)
+	w.WriteHeader(code)
+	writeDate(w, data)
+}
+
 func writeDate(w http.ResponseWriter, bytes []byte) {
 	if _, err := w.Write(bytes); err != nil {
 		logger.Errorf("writer write error: %s", err)
@@ -19,9 +19,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/goharbor/harbor/src/jobservice/common/query"
+	"github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/errs"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/jobservice/worker"
+	_ "github.com/goharbor/harbor/src/replication/adapter/native"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/transfer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -29,6 +33,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -142,6 +147,33 @@ func (suite *APIHandlerTestSuite) TestGetJobFailed() {
 	assert.Equal(suite.T(), 404, code, "expected 404 not found but got %d when getting job", code)
 }
 
+// TestProblemDetails ...
+func (suite *APIHandlerTestSuite) TestProblemDetails() {
+	fc := &fakeController{}
+	fc.On("GetJob", "fake_job_ID").Return(nil, errs.NoObjectFoundError("fake_job_ID"))
+	suite.controller = fc
+
+	// not found
+	url := fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/fake_job_ID")
+	problem, contentType, code := suite.getProblem(url, true)
+	require.Equal(suite.T(), 404, code, "expected 404 not found but got %d when getting job", code)
+	assert.Equal(suite.T(), errs.ProblemContentType, contentType)
+	assert.Equal(suite.T(), fmt.Sprintf("urn:harbor:jobservice:error:%d", errs.NoObjectFoundErrorCode), problem.Type)
+	assert.Equal(suite.T(), "object is not found", problem.Title)
+	assert.Equal(suite.T(), 404, problem.Status)
+	assert.Equal(suite.T(), "fake_job_ID", problem.Detail)
+	assert.Equal(suite.T(), "/api/v1/jobs/fake_job_ID", problem.Instance)
+	assert.Equal(suite.T(), uint16(errs.NoObjectFoundErrorCode), problem.Code)
+
+	// unauthorized
+	problem, contentType, code = suite.getProblem(url, false)
+	require.Equal(suite.T(), 401, code, "expected 401 unauthorized but got %d when getting job", code)
+	assert.Equal(suite.T(), errs.ProblemContentType, contentType)
+	assert.Equal(suite.T(), "unauthorized", problem.Title)
+	assert.Equal(suite.T(), 401, problem.Status)
+	assert.Equal(suite.T(), uint16(errs.UnAuthorizedErrorCode), problem.Code)
+}
+
 // TestGetJobSucceed ...
 func (suite *APIHandlerTestSuite) TestGetJobSucceed() {
 	fc := &fakeController{}
@@ -219,6 +251,171 @@ func (suite *APIHandlerTestSuite) TestCheckStatus() {
 	assert.Equal(suite.T(), "my-worker-pool-ID", poolStats.Pools[0].WorkerPoolID, "expected pool ID 'my-worker-pool-ID' but got %s", poolStats.Pools[0].WorkerPoolID)
 }
 
+// TestGetConfig ...
+func (suite *APIHandlerTestSuite) TestGetConfig() {
+	cfg := config.DefaultConfig
+	defer func() {
+		config.DefaultConfig = cfg
+	}()
+	config.DefaultConfig = &config.Configuration{
+		Protocol: "http",
+		Port:     8080,
+		PoolConfig: &config.PoolConfig{
+			WorkerCount: 10,
+			Backend:     "redis",
+			RedisPoolCfg: &config.RedisPoolConfig{
+				RedisURL:  "redis://:redis_password@redis:6379/2",
+				Namespace: "harbor_job_service",
+			},
+		},
+	}
+
+	bytes, code := suite.getReq(fmt.Sprintf("%s/%s", suite.APIAddr, "config"))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when getting config but got %d", code)
+
+	settings := &config.Settings{}
+	err := json.Unmarshal(bytes, settings)
+	require.Nil(suite.T(), err, "no error should be occurred when unmarshal config")
+	require.NotNil(suite.T(), settings.WorkerPool)
+	assert.Equal(suite.T(), uint(10), settings.WorkerPool.Workers)
+	assert.Equal(suite.T(), "redis://redis:6379/2", settings.WorkerPool.RedisAddress)
+	assert.NotContains(suite.T(), string(bytes), "redis_password", "the password of redis should not be exposed")
+	assert.NotContains(suite.T(), string(bytes), fakeSecret, "the secret should not be exposed")
+}
+
+// TestGetConnections ...
+func (suite *APIHandlerTestSuite) TestGetConnections() {
+	require.True(suite.T(), transfer.Limiter.Acquire("https://harbor.example.com", 3, nil))
+	defer transfer.Limiter.Release("https://harbor.example.com")
+
+	bytes, code := suite.getReq(fmt.Sprintf("%s/%s", suite.APIAddr, "connections"))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when getting connections but got %d", code)
+
+	statuses := []*transfer.ConnectionStatus{}
+	require.Nil(suite.T(), json.Unmarshal(bytes, &statuses))
+	assert.Contains(suite.T(), statuses, &transfer.ConnectionStatus{
+		Key:    "https://harbor.example.com",
+		Active: 1,
+		Limit:  3,
+	})
+}
+
+// TestWarmUp ...
+func (suite *APIHandlerTestSuite) TestWarmUp() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// no connections to warm up
+	reg := &model.Registry{
+		ID:   1,
+		Type: model.RegistryTypeDockerRegistry,
+		URL:  server.URL,
+	}
+	data, err := json.Marshal(reg)
+	require.Nil(suite.T(), err)
+	_, code := suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "warmups"), data)
+	assert.Equal(suite.T(), 400, code, "expected 400 when warming up no connections but got %d", code)
+
+	reg.WarmupConnections = 2
+	data, err = json.Marshal(reg)
+	require.Nil(suite.T(), err)
+	bytes, code := suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "warmups"), data)
+	require.Equal(suite.T(), 200, code, "expected 200 ok when warming up connections but got %d", code)
+	status := &model.WarmupStatus{}
+	require.Nil(suite.T(), json.Unmarshal(bytes, status))
+	assert.Equal(suite.T(), int64(1), status.RegistryID)
+	assert.Equal(suite.T(), server.URL, status.Endpoint)
+	assert.Equal(suite.T(), 2, status.Established)
+
+	bytes, code = suite.getReq(fmt.Sprintf("%s/%s", suite.APIAddr, "warmups"))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when getting warmups but got %d", code)
+	statuses := []*model.WarmupStatus{}
+	require.Nil(suite.T(), json.Unmarshal(bytes, &statuses))
+	require.Equal(suite.T(), 1, len(statuses))
+	assert.Equal(suite.T(), status.Established, statuses[0].Established)
+}
+
+// TestReloadConfig ...
+func (suite *APIHandlerTestSuite) TestReloadConfig() {
+	data, err := ioutil.ReadFile("../config_test.yml")
+	require.Nil(suite.T(), err)
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(suite.T(), err)
+	defer os.Remove(f.Name())
+	require.Nil(suite.T(), ioutil.WriteFile(f.Name(), data, 0600))
+
+	cfg := config.DefaultConfig
+	defer func() {
+		config.DefaultConfig = cfg
+	}()
+	config.DefaultConfig = &config.Configuration{}
+	require.Nil(suite.T(), config.DefaultConfig.Load(f.Name(), false))
+
+	data = append(data, []byte("\nregistry:\n  max_connections: 3\n")...)
+	require.Nil(suite.T(), ioutil.WriteFile(f.Name(), data, 0600))
+	bytes, code := suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "config/reload"), nil)
+	require.Equal(suite.T(), 200, code, "expected 200 ok when reloading config but got %d", code)
+
+	settings := &config.Settings{}
+	err = json.Unmarshal(bytes, settings)
+	require.Nil(suite.T(), err, "no error should be occurred when unmarshal config")
+	assert.Equal(suite.T(), 3, settings.RegistryMaxConnections)
+
+	// the invalid configurations aren't applied
+	require.Nil(suite.T(), ioutil.WriteFile(f.Name(), []byte("protocol: ftp"), 0600))
+	_, code = suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "config/reload"), nil)
+	assert.Equal(suite.T(), 500, code, "expected 500 when reloading invalid config but got %d", code)
+	assert.Equal(suite.T(), 3, config.GetRegistryMaxConnections())
+}
+
+// TestMaintenance ...
+func (suite *APIHandlerTestSuite) TestMaintenance() {
+	req := createJobReq()
+	data, _ := json.Marshal(req)
+
+	fc := &fakeController{}
+	fc.On("LaunchJob", req).Return(createJobStats("sample", "Generic", ""), nil)
+	fc.On("GetJob", "fake_job_ID").Return(createJobStats("sample", "Generic", ""), nil)
+	suite.controller = fc
+
+	bytes, code := suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/maintenance"), []byte(`{"enabled":true}`))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when enabling maintenance mode but got %d", code)
+	assert.JSONEq(suite.T(), `{"enabled":true}`, string(bytes))
+	assert.True(suite.T(), fc.maintenance)
+
+	bytes, code = suite.getReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/maintenance"))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when getting maintenance mode but got %d", code)
+	assert.JSONEq(suite.T(), `{"enabled":true}`, string(bytes))
+
+	// the new jobs are rejected
+	launchReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", suite.APIAddr, "jobs"), strings.NewReader(string(data)))
+	require.Nil(suite.T(), err)
+	launchReq.Header.Set(authHeader, fmt.Sprintf("%s %s", secretPrefix, fakeSecret))
+	res, err := suite.client.Do(launchReq)
+	require.Nil(suite.T(), err)
+	_ = res.Body.Close()
+	assert.Equal(suite.T(), 503, res.StatusCode, "expected 503 when launching job in maintenance mode but got %d", res.StatusCode)
+	assert.Equal(suite.T(), "60", res.Header.Get("Retry-After"))
+	fc.AssertNotCalled(suite.T(), "LaunchJob", req)
+
+	// the status queries still work
+	_, code = suite.getReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/fake_job_ID"))
+	assert.Equal(suite.T(), 200, code, "expected 200 ok when getting job in maintenance mode but got %d", code)
+
+	// the invalid request doesn't change the maintenance mode
+	_, code = suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/maintenance"), []byte("enabled"))
+	assert.Equal(suite.T(), 400, code, "expected 400 bad request but got %d", code)
+	assert.True(suite.T(), fc.maintenance)
+
+	// the new jobs are accepted after the maintenance mode is disabled
+	_, code = suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs/maintenance"), []byte(`{"enabled":false}`))
+	require.Equal(suite.T(), 200, code, "expected 200 ok when disabling maintenance mode but got %d", code)
+	_, code = suite.postReq(fmt.Sprintf("%s/%s", suite.APIAddr, "jobs"), data)
+	assert.Equal(suite.T(), 202, code, "expected 202 created but got %d when launching job", code)
+}
+
 // TestGetJobLogInvalidID ...
 func (suite *APIHandlerTestSuite) TestGetJobLogInvalidID() {
 	fc := &fakeController{}
@@ -378,6 +575,27 @@ func (suite *APIHandlerTestSuite) getReq(url string) ([]byte, int) {
 	return data, res.StatusCode
 }
 
+// getProblem gets the problem details responded
+func (suite *APIHandlerTestSuite) getProblem(url string, authorized bool) (*errs.Problem, string, int) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.Nil(suite.T(), err)
+	if authorized {
+		req.Header.Set(authHeader, fmt.Sprintf("%s %s", secretPrefix, fakeSecret))
+	}
+
+	res, err := suite.client.Do(req)
+	require.Nil(suite.T(), err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	problem := &errs.Problem{}
+	err = json.NewDecoder(res.Body).Decode(problem)
+	require.Nil(suite.T(), err)
+
+	return problem, res.Header.Get("Content-Type"), res.StatusCode
+}
+
 func (suite *APIHandlerTestSuite) LaunchJob(req *job.Request) (*job.Stats, error) {
 	return suite.controller.LaunchJob(req)
 }
@@ -410,8 +628,18 @@ func (suite *APIHandlerTestSuite) GetJobs(query *query.Parameter) ([]*job.Stats,
 	return suite.controller.GetJobs(query)
 }
 
+func (suite *APIHandlerTestSuite) SetMaintenance(enabled bool) error {
+	return suite.controller.SetMaintenance(enabled)
+}
+
+func (suite *APIHandlerTestSuite) InMaintenance() (bool, error) {
+	return suite.controller.InMaintenance()
+}
+
 type fakeController struct {
 	mock.Mock
+	// the maintenance mode is kept in memory rather than in redis
+	maintenance bool
 }
 
 func (fc *fakeController) LaunchJob(req *job.Request) (*job.Stats, error) {
@@ -478,6 +706,15 @@ func (fc *fakeController) GetJobs(query *query.Parameter) ([]*job.Stats, int64,
 	return args.Get(0).([]*job.Stats), args.Get(1).(int64), nil
 }
 
+func (fc *fakeController) SetMaintenance(enabled bool) error {
+	fc.maintenance = enabled
+	return nil
+}
+
+func (fc *fakeController) InMaintenance() (bool, error) {
+	return fc.maintenance, nil
+}
+
 func createJobStats(name, kind, cron string) *job.Stats {
 	now := time.Now()
 	params := make(job.Parameters)
@@ -73,14 +73,13 @@ func (br *BaseRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				authErr = errors.Errorf("unauthorized: %s", err)
 			}
 			logger.Errorf("Serve http request '%s %s' failed with error: %s", req.Method, req.URL.String(), authErr.Error())
-			w.WriteHeader(http.StatusUnauthorized)
-			writeDate(w, []byte(authErr.Error()))
+			writeProblem(w, req, http.StatusUnauthorized, authErr)
 			return
 		}
 	}
 
-	// Directly pass requests to the server mux.
-	br.router.ServeHTTP(w, req)
+	// Pass requests to the server mux, compress the large responses if the client accepts gzip.
+	gzipHandler(br.router, gzipThreshold).ServeHTTP(w, req)
 }
 
 // registerRoutes adds routes to the server mux.
@@ -89,9 +88,17 @@ func (br *BaseRouter) registerRoutes() {
 
 	subRouter.HandleFunc("/jobs", br.handler.HandleLaunchJobReq).Methods(http.MethodPost)
 	subRouter.HandleFunc("/jobs", br.handler.HandleGetJobsReq).Methods(http.MethodGet)
+	// register before the job action route, otherwise "maintenance" is taken as a job ID
+	subRouter.HandleFunc("/jobs/maintenance", br.handler.HandleMaintenanceReq).Methods(http.MethodPost)
+	subRouter.HandleFunc("/jobs/maintenance", br.handler.HandleGetMaintenanceReq).Methods(http.MethodGet)
 	subRouter.HandleFunc("/jobs/{job_id}", br.handler.HandleGetJobReq).Methods(http.MethodGet)
 	subRouter.HandleFunc("/jobs/{job_id}", br.handler.HandleJobActionReq).Methods(http.MethodPost)
 	subRouter.HandleFunc("/jobs/{job_id}/log", br.handler.HandleJobLogReq).Methods(http.MethodGet)
 	subRouter.HandleFunc("/stats", br.handler.HandleCheckStatusReq).Methods(http.MethodGet)
+	subRouter.HandleFunc("/config", br.handler.HandleGetConfigReq).Methods(http.MethodGet)
+	subRouter.HandleFunc("/config/reload", br.handler.HandleReloadConfigReq).Methods(http.MethodPost)
+	subRouter.HandleFunc("/connections", br.handler.HandleGetConnectionsReq).Methods(http.MethodGet)
+	subRouter.HandleFunc("/warmups", br.handler.HandleWarmUpReq).Methods(http.MethodPost)
+	subRouter.HandleFunc("/warmups", br.handler.HandleGetWarmupsReq).Methods(http.MethodGet)
 	subRouter.HandleFunc("/jobs/{job_id}/executions", br.handler.HandlePeriodicExecutions).Methods(http.MethodGet)
 }
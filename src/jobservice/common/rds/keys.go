@@ -82,6 +82,11 @@ func KeyHookEventRetryQueue(namespace string) string {
 	return fmt.Sprintf("%s%s", KeyNamespacePrefix(namespace), "hook_events")
 }
 
+// KeyMaintenance returns the key of the maintenance mode flag
+func KeyMaintenance(namespace string) string {
+	return fmt.Sprintf("%s%s", KeyNamespacePrefix(namespace), "maintenance")
+}
+
 // KeyStatusUpdateRetryQueue returns the key of status change retrying queue
 func KeyStatusUpdateRetryQueue(namespace string) string {
 	return fmt.Sprintf("%s%s", KeyNamespacePrefix(namespace), "status_change_events")
@@ -22,6 +22,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/goharbor/harbor/src/jobservice/common/utils"
 	"gopkg.in/yaml.v2"
@@ -37,6 +39,12 @@ const (
 	jobServiceRedisURL          = "JOB_SERVICE_POOL_REDIS_URL"
 	jobServiceRedisNamespace    = "JOB_SERVICE_POOL_REDIS_NAMESPACE"
 	jobServiceAuthSecret        = "JOBSERVICE_SECRET"
+	registryDialTimeout         = "REGISTRY_DIAL_TIMEOUT"
+	registryTLSHandshakeTimeout = "REGISTRY_TLS_HANDSHAKE_TIMEOUT"
+	registryDefaultAccessKey    = "REGISTRY_DEFAULT_ACCESS_KEY"
+	registryDefaultAccessSecret = "REGISTRY_DEFAULT_ACCESS_SECRET"
+	registryNameserver          = "REGISTRY_NAMESERVER"
+	registryHosts               = "REGISTRY_HOSTS"
 
 	// JobServiceProtocolHTTPS points to the 'https' protocol
 	JobServiceProtocolHTTPS = "https"
@@ -75,6 +83,34 @@ type Configuration struct {
 
 	// Logger configurations
 	LoggerConfigs []*LoggerConfig `yaml:"loggers,omitempty"`
+
+	// Configurations of accessing the registries, they're hot-reloadable
+	RegistryConfig *RegistryConfig `yaml:"registry,omitempty"`
+
+	// The path of the yaml file loaded from and whether the env variables are detected,
+	// they're kept for reloading
+	path      string
+	detectEnv bool
+	// Protect the hot-reloadable configurations
+	lock sync.RWMutex
+}
+
+// RegistryConfig keeps the configurations of accessing the registries
+type RegistryConfig struct {
+	// The timeouts in the format of duration, e.g. "30s"
+	DialTimeout         string `yaml:"dial_timeout"`
+	TLSHandshakeTimeout string `yaml:"tls_handshake_timeout"`
+	// The max count of concurrent connections to a registry which has no limitation configured
+	MaxConnections int `yaml:"max_connections"`
+	// Whether the max count of concurrent connections to the registries is tuned adaptively
+	// by the latencies and errors, the max count configured is the ceiling
+	AdaptiveConnections bool `yaml:"adaptive_connections"`
+	// The max size in bytes of the manifests pulled from the registries
+	MaxManifestSize int64 `yaml:"max_manifest_size"`
+	// The DNS server resolving the hostnames of the registries, e.g. "10.0.0.2:53", and the
+	// static mappings from the hostnames to the IP addresses which take precedence over it
+	Nameserver string            `yaml:"nameserver"`
+	Hosts      map[string]string `yaml:"hosts"`
 }
 
 // HTTPSConfig keeps additional configurations when using https protocol
@@ -122,6 +158,8 @@ type LoggerConfig struct {
 // yamlFilePath	string: The path config yaml file
 // readEnv       bool  : Whether detect the environment variables or not
 func (c *Configuration) Load(yamlFilePath string, detectEnv bool) error {
+	c.path = yamlFilePath
+	c.detectEnv = detectEnv
 	if !utils.IsEmptyStr(yamlFilePath) {
 		// Try to load from file first
 		data, err := ioutil.ReadFile(yamlFilePath)
@@ -168,6 +206,124 @@ func GetUIAuthSecret() string {
 	return utils.ReadEnv(uiAuthSecret)
 }
 
+// Reload re-reads the yaml file and the env variables loaded from, and applies the hot-reloadable
+// configurations(the registry section) only, the others take effect after restarting.
+// The handlers registered by OnReload are called after the configurations are applied
+func (c *Configuration) Reload() error {
+	cfg := &Configuration{}
+	if err := cfg.Load(c.path, c.detectEnv); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.RegistryConfig = cfg.RegistryConfig
+	c.lock.Unlock()
+
+	for _, handler := range reloadHandlers {
+		handler()
+	}
+	return nil
+}
+
+// the handlers called after reloading the configurations
+var reloadHandlers []func()
+
+// OnReload registers the handler which is called after reloading the configurations
+// to apply the changes, it isn't safe to call it concurrently with Reload
+func OnReload(handler func()) {
+	reloadHandlers = append(reloadHandlers, handler)
+}
+
+// registry returns a copy of the registry configurations
+func (c *Configuration) registry() RegistryConfig {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.RegistryConfig == nil {
+		return RegistryConfig{}
+	}
+	return *c.RegistryConfig
+}
+
+// GetRegistryDialTimeout gets the timeout of connecting to the registries from the env or
+// the configuration file, 0 is returned if it isn't set or invalid
+func GetRegistryDialTimeout() time.Duration {
+	return parseTimeout(utils.ReadEnv(registryDialTimeout), DefaultConfig.registry().DialTimeout)
+}
+
+// GetRegistryTLSHandshakeTimeout gets the timeout of the TLS handshake with the registries
+// from the env or the configuration file, 0 is returned if it isn't set or invalid
+func GetRegistryTLSHandshakeTimeout() time.Duration {
+	return parseTimeout(utils.ReadEnv(registryTLSHandshakeTimeout), DefaultConfig.registry().TLSHandshakeTimeout)
+}
+
+// GetRegistryMaxConnections gets the max count of concurrent connections to a registry which has
+// no limitation configured from the configuration file, 0 means no limitation
+func GetRegistryMaxConnections() int {
+	return DefaultConfig.registry().MaxConnections
+}
+
+// GetRegistryAdaptiveConnections gets whether the max count of concurrent connections to the
+// registries is tuned adaptively from the configuration file
+func GetRegistryAdaptiveConnections() bool {
+	return DefaultConfig.registry().AdaptiveConnections
+}
+
+// GetRegistryMaxManifestSize gets the max size in bytes of the manifests pulled from the registries
+// from the configuration file, 0 is returned if it isn't set and the default size is used
+func GetRegistryMaxManifestSize() int64 {
+	return DefaultConfig.registry().MaxManifestSize
+}
+
+// GetRegistryNameserver gets the DNS server resolving the hostnames of the registries from the
+// env or the configuration file, the system resolver is used if it's empty
+func GetRegistryNameserver() string {
+	if nameserver := utils.ReadEnv(registryNameserver); !utils.IsEmptyStr(nameserver) {
+		return nameserver
+	}
+	return DefaultConfig.registry().Nameserver
+}
+
+// GetRegistryHosts gets the static mappings from the hostnames of the registries to the IP addresses from
+// the env in the format "host1=ip1,host2=ip2" or the configuration file, the invalid entries of the env are ignored
+func GetRegistryHosts() map[string]string {
+	env := utils.ReadEnv(registryHosts)
+	if utils.IsEmptyStr(env) {
+		return DefaultConfig.registry().Hosts
+	}
+	hosts := map[string]string{}
+	for _, entry := range strings.Split(env, ",") {
+		entry = strings.TrimSpace(entry)
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			continue
+		}
+		hosts[entry[:i]] = entry[i+1:]
+	}
+	return hosts
+}
+
+// parseTimeout returns the timeout set by env first, and then the one set by the configuration file
+func parseTimeout(env, file string) time.Duration {
+	if !utils.IsEmptyStr(env) {
+		timeout, err := time.ParseDuration(env)
+		if err != nil {
+			return 0
+		}
+		return timeout
+	}
+	timeout, err := time.ParseDuration(file)
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// GetRegistryDefaultCredential gets the access key and secret used to access the registries
+// which have no credential configured from the env
+func GetRegistryDefaultCredential() (string, string) {
+	return utils.ReadEnv(registryDefaultAccessKey), utils.ReadEnv(registryDefaultAccessSecret)
+}
+
 // Load env variables
 func (c *Configuration) loadEnvs() {
 	prot := utils.ReadEnv(jobServiceProtocol)
@@ -14,11 +14,17 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // ConfigurationTestSuite tests the configuration loading
@@ -123,6 +129,152 @@ func (suite *ConfigurationTestSuite) TestDefaultConfig() {
 	)
 }
 
+// TestRegistryTimeouts ...
+func (suite *ConfigurationTestSuite) TestRegistryTimeouts() {
+	defer func() {
+		os.Unsetenv("REGISTRY_DIAL_TIMEOUT")
+		os.Unsetenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT")
+	}()
+
+	assert.Equal(suite.T(), time.Duration(0), GetRegistryDialTimeout())
+	assert.Equal(suite.T(), time.Duration(0), GetRegistryTLSHandshakeTimeout())
+
+	os.Setenv("REGISTRY_DIAL_TIMEOUT", "5s")
+	os.Setenv("REGISTRY_TLS_HANDSHAKE_TIMEOUT", "invalid")
+	assert.Equal(suite.T(), 5*time.Second, GetRegistryDialTimeout())
+	assert.Equal(suite.T(), time.Duration(0), GetRegistryTLSHandshakeTimeout())
+}
+
+// TestRegistryDefaultCredential ...
+func (suite *ConfigurationTestSuite) TestRegistryDefaultCredential() {
+	defer func() {
+		os.Unsetenv("REGISTRY_DEFAULT_ACCESS_KEY")
+		os.Unsetenv("REGISTRY_DEFAULT_ACCESS_SECRET")
+	}()
+
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_KEY", "robot")
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_SECRET", "password")
+	key, secret := GetRegistryDefaultCredential()
+	assert.Equal(suite.T(), "robot", key)
+	assert.Equal(suite.T(), "password", secret)
+}
+
+// TestSettings ...
+func (suite *ConfigurationTestSuite) TestSettings() {
+	defer func() {
+		os.Unsetenv("REGISTRY_DEFAULT_ACCESS_KEY")
+		os.Unsetenv("REGISTRY_DEFAULT_ACCESS_SECRET")
+	}()
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_KEY", "robot")
+	os.Setenv("REGISTRY_DEFAULT_ACCESS_SECRET", "default_secret")
+
+	cfg := &Configuration{
+		Protocol: "https",
+		Port:     9443,
+		HTTPSConfig: &HTTPSConfig{
+			Cert: "/etc/cert/server.crt",
+			Key:  "/etc/cert/server.key",
+		},
+		PoolConfig: &PoolConfig{
+			WorkerCount: 10,
+			Backend:     "redis",
+			RedisPoolCfg: &RedisPoolConfig{
+				RedisURL:  "redis://:redis_password@redis:6379/2",
+				Namespace: "harbor_job_service",
+			},
+		},
+		LoggerConfigs: []*LoggerConfig{
+			{
+				Name:  "DB",
+				Level: "INFO",
+				Settings: map[string]interface{}{
+					"password": "db_password",
+				},
+				Sweeper: &LogSweeperConfig{Duration: 14},
+			},
+		},
+	}
+	settings := cfg.Settings()
+	assert.Equal(suite.T(), "https", settings.Protocol)
+	assert.Equal(suite.T(), uint(9443), settings.Port)
+	require.NotNil(suite.T(), settings.WorkerPool)
+	assert.Equal(suite.T(), uint(10), settings.WorkerPool.Workers)
+	assert.Equal(suite.T(), "redis://redis:6379/2", settings.WorkerPool.RedisAddress)
+	require.Equal(suite.T(), 1, len(settings.Loggers))
+	assert.Equal(suite.T(), 14, settings.Loggers[0].SweeperDuration)
+	assert.Equal(suite.T(), "30s", settings.RegistryDialTimeout)
+	assert.Equal(suite.T(), "10s", settings.RegistryTLSHandshakeTimeout)
+	assert.Equal(suite.T(), registry.DefaultMaxManifestSize, settings.RegistryMaxManifestSize)
+	assert.True(suite.T(), settings.RegistryDefaultCredential)
+
+	data, err := json.Marshal(settings)
+	require.Nil(suite.T(), err)
+	for _, secret := range []string{"redis_password", "db_password", "default_secret", "robot", "server.key"} {
+		assert.NotContains(suite.T(), string(data), secret)
+	}
+}
+
+// TestReload ...
+func (suite *ConfigurationTestSuite) TestReload() {
+	data, err := ioutil.ReadFile("../config_test.yml")
+	require.Nil(suite.T(), err)
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(suite.T(), err)
+	defer os.Remove(f.Name())
+	write := func(workers int, registry string) {
+		content := strings.Replace(string(data), "workers: 10", fmt.Sprintf("workers: %d", workers), 1) + registry
+		require.Nil(suite.T(), ioutil.WriteFile(f.Name(), []byte(content), 0600))
+	}
+
+	write(10, "\nregistry:\n  dial_timeout: \"5s\"\n  max_connections: 2\n")
+	cfg := &Configuration{}
+	require.Nil(suite.T(), cfg.Load(f.Name(), false))
+	defaultConfig := DefaultConfig
+	DefaultConfig = cfg
+	defer func() {
+		DefaultConfig = defaultConfig
+		reloadHandlers = nil
+	}()
+	assert.Equal(suite.T(), 5*time.Second, GetRegistryDialTimeout())
+	assert.Equal(suite.T(), 2, GetRegistryMaxConnections())
+	assert.False(suite.T(), GetRegistryAdaptiveConnections())
+	assert.Equal(suite.T(), int64(0), GetRegistryMaxManifestSize())
+
+	reloaded := 0
+	OnReload(func() { reloaded++ })
+
+	// only the registry section is applied
+	write(20, "\nregistry:\n  dial_timeout: \"1m\"\n  tls_handshake_timeout: \"20s\"\n  max_connections: 5\n  adaptive_connections: true\n  max_manifest_size: 1048576\n"+
+		"  nameserver: \"10.0.0.2\"\n  hosts:\n    registry.harbor.test: \"10.0.0.10\"\n")
+	require.Nil(suite.T(), cfg.Reload())
+	assert.Equal(suite.T(), 1, reloaded)
+	assert.Equal(suite.T(), time.Minute, GetRegistryDialTimeout())
+	assert.Equal(suite.T(), 20*time.Second, GetRegistryTLSHandshakeTimeout())
+	assert.Equal(suite.T(), 5, GetRegistryMaxConnections())
+	assert.True(suite.T(), GetRegistryAdaptiveConnections())
+	assert.Equal(suite.T(), int64(1048576), GetRegistryMaxManifestSize())
+	assert.Equal(suite.T(), "10.0.0.2", GetRegistryNameserver())
+	assert.Equal(suite.T(), map[string]string{"registry.harbor.test": "10.0.0.10"}, GetRegistryHosts())
+	assert.Equal(suite.T(), uint(10), cfg.PoolConfig.WorkerCount)
+
+	// the env overrides the configuration file
+	os.Setenv("REGISTRY_DIAL_TIMEOUT", "3s")
+	defer os.Unsetenv("REGISTRY_DIAL_TIMEOUT")
+	assert.Equal(suite.T(), 3*time.Second, GetRegistryDialTimeout())
+	os.Setenv("REGISTRY_NAMESERVER", "10.0.0.3:5353")
+	defer os.Unsetenv("REGISTRY_NAMESERVER")
+	assert.Equal(suite.T(), "10.0.0.3:5353", GetRegistryNameserver())
+	os.Setenv("REGISTRY_HOSTS", "registry.harbor.test=10.0.0.20,invalid")
+	defer os.Unsetenv("REGISTRY_HOSTS")
+	assert.Equal(suite.T(), map[string]string{"registry.harbor.test": "10.0.0.20"}, GetRegistryHosts())
+
+	// the configurations in effect are kept if the reloading fails
+	require.Nil(suite.T(), ioutil.WriteFile(f.Name(), []byte("protocol: ftp"), 0600))
+	assert.NotNil(suite.T(), cfg.Reload())
+	assert.Equal(suite.T(), 1, reloaded)
+	assert.Equal(suite.T(), 5, GetRegistryMaxConnections())
+}
+
 func setENV() error {
 	err := os.Setenv("JOB_SERVICE_PROTOCOL", "https")
 	err = os.Setenv("JOB_SERVICE_PORT", "8989")
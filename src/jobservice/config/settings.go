@@ -0,0 +1,127 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/registry"
+)
+
+// Settings are the non-secret configuration items in effect, they're exposed for the introspection.
+// The secrets(e.g. the auth secrets, the password of redis and the default credential of the
+// registries) are never included
+type Settings struct {
+	Protocol                    string              `json:"protocol"`
+	Port                        uint                `json:"port"`
+	WorkerPool                  *WorkerPoolSettings `json:"worker_pool,omitempty"`
+	JobLoggers                  []*LoggerSettings   `json:"job_loggers"`
+	Loggers                     []*LoggerSettings   `json:"loggers"`
+	RegistryDialTimeout         string              `json:"registry_dial_timeout"`
+	RegistryTLSHandshakeTimeout string              `json:"registry_tls_handshake_timeout"`
+	RegistryMaxConnections      int                 `json:"registry_max_connections"`
+	RegistryAdaptiveConnections bool                `json:"registry_adaptive_connections"`
+	RegistryMaxManifestSize     int64               `json:"registry_max_manifest_size"`
+	// whether the default credential of the registries is configured
+	RegistryDefaultCredential bool `json:"registry_default_credential"`
+	// the DNS server and the static host mappings resolving the hostnames of the registries
+	RegistryNameserver string            `json:"registry_nameserver,omitempty"`
+	RegistryHosts      map[string]string `json:"registry_hosts,omitempty"`
+}
+
+// WorkerPoolSettings are the settings of the worker pool
+type WorkerPoolSettings struct {
+	Backend string `json:"backend"`
+	Workers uint   `json:"workers"`
+	// the address of redis without the credential
+	RedisAddress   string `json:"redis_address,omitempty"`
+	RedisNamespace string `json:"redis_namespace,omitempty"`
+}
+
+// LoggerSettings are the settings of the logger, the customized settings are excluded
+// as they may contain the credentials, e.g. the ones of the database logger
+type LoggerSettings struct {
+	Name            string `json:"name"`
+	Level           string `json:"level"`
+	SweeperDuration int    `json:"sweeper_duration,omitempty"`
+}
+
+// Settings returns the non-secret configuration items in effect, the unset timeouts are
+// resolved to the default values
+func (c *Configuration) Settings() *Settings {
+	settings := &Settings{
+		Protocol:                    c.Protocol,
+		Port:                        c.Port,
+		JobLoggers:                  loggerSettings(c.JobLoggerConfigs),
+		Loggers:                     loggerSettings(c.LoggerConfigs),
+		RegistryDialTimeout:         resolveTimeout(GetRegistryDialTimeout(), registry.DefaultDialTimeout),
+		RegistryTLSHandshakeTimeout: resolveTimeout(GetRegistryTLSHandshakeTimeout(), registry.DefaultTLSHandshakeTimeout),
+		RegistryMaxConnections:      GetRegistryMaxConnections(),
+		RegistryAdaptiveConnections: GetRegistryAdaptiveConnections(),
+		RegistryMaxManifestSize:     resolveMaxManifestSize(GetRegistryMaxManifestSize()),
+		RegistryNameserver:          GetRegistryNameserver(),
+		RegistryHosts:               GetRegistryHosts(),
+	}
+	key, secret := GetRegistryDefaultCredential()
+	settings.RegistryDefaultCredential = len(key) > 0 || len(secret) > 0
+
+	if c.PoolConfig != nil {
+		settings.WorkerPool = &WorkerPoolSettings{
+			Backend: c.PoolConfig.Backend,
+			Workers: c.PoolConfig.WorkerCount,
+		}
+		if c.PoolConfig.RedisPoolCfg != nil {
+			settings.WorkerPool.RedisNamespace = c.PoolConfig.RedisPoolCfg.Namespace
+			if u, err := url.Parse(c.PoolConfig.RedisPoolCfg.RedisURL); err == nil {
+				u.User = nil
+				settings.WorkerPool.RedisAddress = u.String()
+			}
+		}
+	}
+	return settings
+}
+
+func loggerSettings(configs []*LoggerConfig) []*LoggerSettings {
+	settings := []*LoggerSettings{}
+	for _, cfg := range configs {
+		if cfg == nil {
+			continue
+		}
+		s := &LoggerSettings{
+			Name:  cfg.Name,
+			Level: cfg.Level,
+		}
+		if cfg.Sweeper != nil {
+			s.SweeperDuration = cfg.Sweeper.Duration
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+func resolveTimeout(timeout, defaultTimeout time.Duration) string {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return timeout.String()
+}
+
+func resolveMaxManifestSize(size int64) int64 {
+	if size <= 0 {
+		return registry.DefaultMaxManifestSize
+	}
+	return size
+}
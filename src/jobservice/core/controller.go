@@ -25,8 +25,8 @@ import (
 	"github.com/goharbor/harbor/src/jobservice/common/utils"
 	"github.com/goharbor/harbor/src/jobservice/errs"
 	"github.com/goharbor/harbor/src/jobservice/job"
+	"github.com/goharbor/harbor/src/jobservice/period"
 	"github.com/goharbor/harbor/src/jobservice/worker"
-	"github.com/robfig/cron"
 )
 
 // basicController implement the core interface and provides related job handle methods.
@@ -143,7 +143,24 @@ func (bc *basicController) GetJobLogData(jobID string) ([]byte, error) {
 
 // CheckStatus is implementation of same method in core interface.
 func (bc *basicController) CheckStatus() (*worker.Stats, error) {
-	return bc.backendWorker.Stats()
+	stats, err := bc.backendWorker.Stats()
+	if err != nil {
+		return nil, err
+	}
+	if stats.Maintenance, err = bc.manager.InMaintenance(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// SetMaintenance is implementation of same method in core interface.
+func (bc *basicController) SetMaintenance(enabled bool) error {
+	return bc.manager.SetMaintenance(enabled)
+}
+
+// InMaintenance is implementation of same method in core interface.
+func (bc *basicController) InMaintenance() (bool, error) {
+	return bc.manager.InMaintenance()
 }
 
 // GetPeriodicExecutions gets the periodic executions for the specified periodic job
@@ -207,7 +224,7 @@ func validJobReq(req *job.Request) error {
 			return fmt.Errorf("'cron_spec' must be specified for the %s job", job.KindPeriodic)
 		}
 
-		if _, err := cron.Parse(req.Job.Metadata.Cron); err != nil {
+		if _, _, err := period.ParseCron(req.Job.Metadata.Cron); err != nil {
 			return fmt.Errorf("'cron_spec' is not correctly set: %s: %s", req.Job.Metadata.Cron, err)
 		}
 	}
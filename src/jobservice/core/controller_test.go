@@ -65,6 +65,7 @@ func (suite *ControllerTestSuite) SetupTest() {
 	fakeMgr := &fakeManager{}
 	fakeMgr.On("SaveJob", suite.res).Return(nil)
 	fakeMgr.On("GetJob", suite.jobID).Return(suite.res, nil)
+	fakeMgr.On("InMaintenance").Return(false, nil)
 
 	suite.manager = fakeMgr
 
@@ -140,6 +141,23 @@ func (suite *ControllerTestSuite) TestCheckStatus() {
 	require.Nil(suite.T(), err, "check worker status: nil error expected but got %s", err)
 	assert.Equal(suite.T(), 1, len(st.Pools), "expected 1 pool status but got 0")
 	assert.Equal(suite.T(), "running", st.Pools[0].Status, "expected running pool but got %s", st.Pools[0].Status)
+	assert.False(suite.T(), st.Maintenance, "expected maintenance mode disabled")
+}
+
+// TestMaintenance ...
+func (suite *ControllerTestSuite) TestMaintenance() {
+	fakeMgr := &fakeManager{}
+	fakeMgr.On("SetMaintenance", true).Return(nil)
+	fakeMgr.On("InMaintenance").Return(true, nil)
+	suite.manager = fakeMgr
+
+	err := suite.ctl.SetMaintenance(true)
+	require.NoError(suite.T(), err)
+	fakeMgr.AssertCalled(suite.T(), "SetMaintenance", true)
+
+	enabled, err := suite.ctl.InMaintenance()
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), enabled)
 }
 
 // TestInvalidChecks ...
@@ -286,6 +304,14 @@ func (suite *ControllerTestSuite) SaveJob(j *job.Stats) error {
 	return suite.manager.SaveJob(j)
 }
 
+func (suite *ControllerTestSuite) SetMaintenance(enabled bool) error {
+	return suite.manager.SetMaintenance(enabled)
+}
+
+func (suite *ControllerTestSuite) InMaintenance() (bool, error) {
+	return suite.manager.InMaintenance()
+}
+
 // fake worker
 type fakeWorker struct {
 	mock.Mock
@@ -401,3 +427,13 @@ func (fm *fakeManager) SaveJob(j *job.Stats) error {
 	args := fm.Called(j)
 	return args.Error(0)
 }
+
+func (fm *fakeManager) SetMaintenance(enabled bool) error {
+	args := fm.Called(enabled)
+	return args.Error(0)
+}
+
+func (fm *fakeManager) InMaintenance() (bool, error) {
+	args := fm.Called()
+	return args.Bool(0), args.Error(1)
+}
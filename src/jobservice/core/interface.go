@@ -75,4 +75,11 @@ type Interface interface {
 	// For other cases, query the jobs with cursor, not standard pagination. The int64 is next cursor.
 	// The total number is also returned.
 	GetJobs(query *query.Parameter) ([]*job.Stats, int64, error)
+
+	// SetMaintenance enables or disables the maintenance mode, the new jobs are rejected
+	// when it's enabled while the running ones continue.
+	SetMaintenance(enabled bool) error
+
+	// InMaintenance checks whether the maintenance mode is enabled.
+	InMaintenance() (bool, error)
 }
@@ -56,6 +56,16 @@ const (
 	GetPeriodicExecutionErrorCode
 	// StatusMismatchErrorCode is code for the error of mismatching status
 	StatusMismatchErrorCode
+	// ReloadConfigErrorCode is code for the error of reloading the configurations
+	ReloadConfigErrorCode
+	// MaintenanceModeErrorCode is code for the error of rejecting the new jobs in the maintenance mode
+	MaintenanceModeErrorCode
+	// SetMaintenanceErrorCode is code for the error of setting the maintenance mode
+	SetMaintenanceErrorCode
+	// GetMaintenanceErrorCode is code for the error of getting the maintenance mode
+	GetMaintenanceErrorCode
+	// WarmUpErrorCode is code for the error of warming up the connections to the registry
+	WarmUpErrorCode
 )
 
 // baseError ...
@@ -74,6 +84,11 @@ func (be baseError) Error() string {
 	return "{}"
 }
 
+// base returns the base error, it's inherited by the errors embedding the base error
+func (be baseError) base() baseError {
+	return be
+}
+
 // New customized errors
 func New(code uint16, err string, description string) error {
 	return baseError{
@@ -205,6 +220,31 @@ type statusMismatchError struct {
 	baseError
 }
 
+// ReloadConfigError is error for the case of reloading the configurations failed
+func ReloadConfigError(err error) error {
+	return New(ReloadConfigErrorCode, "failed to reload the configurations", err.Error())
+}
+
+// MaintenanceModeError is error for the case of rejecting the new jobs as the maintenance mode is enabled
+func MaintenanceModeError() error {
+	return New(MaintenanceModeErrorCode, "job service is in maintenance mode", "no new jobs are accepted until the maintenance mode is disabled")
+}
+
+// SetMaintenanceError is error for the case of setting the maintenance mode failed
+func SetMaintenanceError(err error) error {
+	return New(SetMaintenanceErrorCode, "failed to set the maintenance mode", err.Error())
+}
+
+// GetMaintenanceError is error for the case of getting the maintenance mode failed
+func GetMaintenanceError(err error) error {
+	return New(GetMaintenanceErrorCode, "failed to get the maintenance mode", err.Error())
+}
+
+// WarmUpError is error for the case of warming up the connections to the registry failed
+func WarmUpError(err error) error {
+	return New(WarmUpErrorCode, "failed to warm up the connections to the registry", err.Error())
+}
+
 // StatusMismatchError returns the error of job status mismatching
 func StatusMismatchError(current, target string) error {
 	return statusMismatchError{
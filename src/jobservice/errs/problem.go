@@ -0,0 +1,67 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errs
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	// ProblemContentType is the media type of the problem details defined by RFC 7807
+	ProblemContentType = "application/problem+json"
+	// problemTypePrefix is the prefix of the URI identifying the type of the problem,
+	// it's followed by the code of the error
+	problemTypePrefix = "urn:harbor:jobservice:error:"
+	// problemTypeBlank is the type of the problem which has no semantics beyond the status code
+	problemTypeBlank = "about:blank"
+)
+
+// Problem is the problem details returned by the API when an error occurs, see RFC 7807
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is the extension member which keeps the code of the error
+	Code uint16 `json:"code,omitempty"`
+}
+
+// NewProblem builds the problem details of the error responded with the status code.
+// The instance is the URI reference identifying the occurrence of the problem, e.g. the request path
+func NewProblem(status int, err error, instance string) *Problem {
+	p := &Problem{
+		Type:     problemTypeBlank,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: instance,
+	}
+	if err == nil {
+		return p
+	}
+	if e, ok := err.(interface {
+		base() baseError
+	}); ok {
+		be := e.base()
+		p.Type = fmt.Sprintf("%s%d", problemTypePrefix, be.Code)
+		p.Title = be.Err
+		p.Detail = be.Description
+		p.Code = be.Code
+		return p
+	}
+	p.Detail = err.Error()
+	return p
+}
@@ -0,0 +1,47 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProblem(t *testing.T) {
+	// the errors defined in this package
+	p := NewProblem(http.StatusBadRequest, BadRequestError("invalid job name"), "/api/v1/jobs")
+	assert.Equal(t, fmt.Sprintf("%s%d", problemTypePrefix, BadRequestErrorCode), p.Type)
+	assert.Equal(t, "bad request", p.Title)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "invalid job name", p.Detail)
+	assert.Equal(t, "/api/v1/jobs", p.Instance)
+	assert.Equal(t, uint16(BadRequestErrorCode), p.Code)
+
+	p = NewProblem(http.StatusInternalServerError, LaunchJobError(errors.New("redis is down")), "")
+	assert.Equal(t, fmt.Sprintf("%s%d", problemTypePrefix, LaunchJobErrorCode), p.Type)
+	assert.Equal(t, "launch job failed with error", p.Title)
+	assert.Equal(t, "redis is down", p.Detail)
+
+	// the other errors
+	p = NewProblem(http.StatusInternalServerError, errors.New("unexpected error"), "/api/v1/stats")
+	assert.Equal(t, problemTypeBlank, p.Type)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), p.Title)
+	assert.Equal(t, "unexpected error", p.Detail)
+	assert.Equal(t, uint16(0), p.Code)
+}
@@ -17,7 +17,12 @@ package replication
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	common_http "github.com/goharbor/harbor/src/common/http"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/transfer"
@@ -36,17 +41,25 @@ import (
 	_ "github.com/goharbor/harbor/src/replication/adapter/huawei"
 )
 
+// the interval of checking in the progress of the transfer
+const progressInterval = 10 * time.Second
+
 // Replication implements the job interface
-type Replication struct{}
+type Replication struct {
+	// nonRetryable is set when the job fails with an error that retrying cannot fix
+	nonRetryable bool
+}
 
 // MaxFails returns that how many times this job can fail
 func (r *Replication) MaxFails() uint {
 	return 3
 }
 
-// ShouldRetry always returns true which means the job is needed to be restarted when fails
+// ShouldRetry returns true which means the job is needed to be restarted when fails,
+// unless the failure is caused by an error that cannot be fixed by retrying, e.g. the
+// invalid credential
 func (r *Replication) ShouldRetry() bool {
-	return true
+	return !r.nonRetryable
 }
 
 // Validate does nothing
@@ -65,6 +78,30 @@ func (r *Replication) Run(ctx job.Context, params job.Parameters) error {
 		return err
 	}
 
+	// the resources are filtered when scheduling, check them again as the allowed
+	// projects of the registries may be changed after that
+	if err = checkAllowedProjects(src, dst); err != nil {
+		logger.Error(err)
+		r.nonRetryable = true
+		checkInFailure(ctx, err)
+		return err
+	}
+
+	// the job is deferred to the end of the blackout of the destination registry when it's submitted,
+	// check it again as the job may still run in the blackout, e.g. it's retried or waits in the queue
+	if dst.Registry != nil {
+		if end, inBlackout := dst.Registry.BlackoutEnd(time.Now()); inBlackout {
+			logger.Infof("the destination registry %s is in blackout until %s, the transfer is deferred",
+				dst.Registry.Name, end.Format(time.RFC3339))
+			if err = ctx.Checkin(transfer.CheckInBlackoutPrefix + end.Format(time.RFC3339)); err != nil {
+				// retry the job rather than succeeding without the transfer
+				logger.Errorf("failed to check in the blackout: %v", err)
+				return err
+			}
+			return nil
+		}
+	}
+
 	factory, err := transfer.GetFactory(src.Type)
 	if err != nil {
 		logger.Errorf("failed to get transfer factory: %v", err)
@@ -84,7 +121,193 @@ func (r *Replication) Run(ctx job.Context, params job.Parameters) error {
 		return err
 	}
 
-	return trans.Transfer(src, dst)
+	// limit the concurrent operations against the destination registry
+	if dst.Registry != nil {
+		if !transfer.Limiter.Acquire(dst.Registry.URL, transfer.MaxConnections(dst.Registry.MaxConnections), stopFunc) {
+			logger.Info("the job is stopped when waiting for the connection to the destination registry")
+			return nil
+		}
+		defer transfer.Limiter.Release(dst.Registry.URL)
+	}
+
+	start := time.Now()
+	stopProgress := checkInProgress(ctx, trans, progressInterval)
+	err = trans.Transfer(src, dst)
+	stopProgress()
+	checkInSpeed(ctx, trans)
+	checkInReferrers(ctx, trans)
+	checkInMediaTypes(ctx, trans)
+	checkInEndpoints(ctx, trans)
+	// the failures which aren't caused by the load of the destination registry don't back off the limitation
+	if dst.Registry != nil && (err == nil || isRetryable(err)) {
+		transfer.Limiter.Report(dst.Registry.URL, time.Since(start), err)
+	}
+	if err != nil {
+		r.nonRetryable = !isRetryable(err)
+		// pause the job rather than failing it, it'll be resumed by the next scheduled execution
+		if dst.PauseOnReadOnly && isReadOnly(err) {
+			logger.Warningf("the destination registry is read-only, pause the replication: %v", err)
+			r.nonRetryable = true
+			if e := ctx.Checkin(transfer.CheckInReadOnly); e != nil {
+				logger.Errorf("failed to check in the read-only status: %v", e)
+			}
+			return err
+		}
+		checkInFailure(ctx, err)
+	}
+	return err
+}
+
+// check in the speed of the data transferred, so that it can be shown with the task
+func checkInSpeed(ctx job.Context, trans transfer.Transfer) {
+	reporter, ok := trans.(transfer.SpeedReporter)
+	if !ok {
+		return
+	}
+	speed := reporter.Speed()
+	if speed == nil {
+		return
+	}
+	ctx.GetLogger().Infof("%d bytes transferred, average speed: %.2f MB/s, peak speed: %.2f MB/s",
+		speed.Bytes, speed.Average, speed.Peak)
+	data, err := json.Marshal(speed)
+	if err != nil {
+		ctx.GetLogger().Errorf("failed to marshal the speed: %v", err)
+		return
+	}
+	if e := ctx.Checkin(transfer.CheckInSpeedPrefix + string(data)); e != nil {
+		ctx.GetLogger().Errorf("failed to check in the speed: %v", e)
+	}
+}
+
+// check in the progress of the transfer periodically until the returned function is called, so that
+// the bytes transferred and the ETA can be shown with the running task
+func checkInProgress(ctx job.Context, trans transfer.Transfer, interval time.Duration) func() {
+	reporter, ok := trans.(transfer.ProgressReporter)
+	if !ok {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			progress := reporter.Progress()
+			if progress == nil {
+				continue
+			}
+			data, err := json.Marshal(progress)
+			if err != nil {
+				ctx.GetLogger().Errorf("failed to marshal the progress: %v", err)
+				continue
+			}
+			if e := ctx.Checkin(transfer.CheckInProgressPrefix + string(data)); e != nil {
+				ctx.GetLogger().Errorf("failed to check in the progress: %v", e)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// check in the count of the referrers transferred, so that it can be shown with the task
+func checkInReferrers(ctx job.Context, trans transfer.Transfer) {
+	reporter, ok := trans.(transfer.ReferrerReporter)
+	if !ok {
+		return
+	}
+	count := reporter.Referrers()
+	if count == 0 {
+		return
+	}
+	if e := ctx.Checkin(transfer.CheckInReferrersPrefix + strconv.Itoa(count)); e != nil {
+		ctx.GetLogger().Errorf("failed to check in the count of the referrers: %v", e)
+	}
+}
+
+// check in the endpoints of the registries used by the transfer, so that the endpoint failed
+// over to can be shown with the task
+func checkInEndpoints(ctx job.Context, trans transfer.Transfer) {
+	reporter, ok := trans.(transfer.EndpointReporter)
+	if !ok {
+		return
+	}
+	src, dst := reporter.Endpoints()
+	if len(src) == 0 || len(dst) == 0 {
+		return
+	}
+	if e := ctx.Checkin(transfer.CheckInEndpointsPrefix + src + " " + dst); e != nil {
+		ctx.GetLogger().Errorf("failed to check in the endpoints: %v", e)
+	}
+}
+
+// check in the media types of the manifests on the destination registry, so that the
+// media types converted can be shown with the task
+func checkInMediaTypes(ctx job.Context, trans transfer.Transfer) {
+	reporter, ok := trans.(transfer.MediaTypeReporter)
+	if !ok {
+		return
+	}
+	mediaTypes := reporter.MediaTypes()
+	if len(mediaTypes) == 0 {
+		return
+	}
+	if e := ctx.Checkin(transfer.CheckInMediaTypesPrefix + strings.Join(mediaTypes, ",")); e != nil {
+		ctx.GetLogger().Errorf("failed to check in the media types: %v", e)
+	}
+}
+
+// check in the reason of the failure, so that it can be shown with the failed task
+func checkInFailure(ctx job.Context, err error) {
+	if e := ctx.Checkin(transfer.CheckInFailurePrefix + err.Error()); e != nil {
+		ctx.GetLogger().Errorf("failed to check in the reason of the failure: %v", e)
+	}
+}
+
+// checkAllowedProjects returns an error if the project of the repository isn't allowed
+// by the source or destination registry
+func checkAllowedProjects(src, dst *model.Resource) error {
+	if src.Metadata == nil || src.Metadata.Repository == nil {
+		return nil
+	}
+	repository := src.Metadata.Repository.Name
+	for _, registry := range []*model.Registry{src.Registry, dst.Registry} {
+		if registry != nil && !registry.AllowsRepository(repository) {
+			return fmt.Errorf("refuse to replicate the repository %s as its project isn't in the allowed projects %v of the registry %s",
+				repository, registry.AllowedProjects, registry.Name)
+		}
+	}
+	return nil
+}
+
+// isReadOnly returns whether the error is caused by the read-only registry
+func isReadOnly(err error) bool {
+	if e, ok := err.(*common_http.Error); ok {
+		return e.IsReadOnly()
+	}
+	return false
+}
+
+// isRetryable returns whether the error may be fixed by retrying. The errors
+// returned by the registries are classified, the oversized manifests and the
+// insufficient storage aren't retryable and the others are retryable
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case *common_http.Error:
+		return e.IsRetryable()
+	case *registry_pkg.ManifestTooLargeError, *transfer.InsufficientStorageError:
+		return false
+	}
+	return true
 }
 
 func parseParams(params map[string]interface{}) (*model.Resource, *model.Resource, error) {
@@ -15,9 +15,17 @@
 package replication
 
 import (
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	common_http "github.com/goharbor/harbor/src/common/http"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/jobservice/job/impl"
+	"github.com/goharbor/harbor/src/jobservice/logger"
+	"github.com/goharbor/harbor/src/jobservice/logger/backend"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/transfer"
 	"github.com/stretchr/testify/assert"
@@ -98,3 +106,272 @@ func TestRun(t *testing.T) {
 	require.Nil(t, rep.Run(&impl.Context{}, params))
 	assert.True(t, transferred)
 }
+
+func TestRunWithConnectionLimit(t *testing.T) {
+	params := map[string]interface{}{
+		"src_resource": `{"type":"res"}`,
+		"dst_resource": `{"registry":{"url":"https://small.example.com","max_connections":1}}`,
+	}
+	rep := &Replication{}
+	require.Nil(t, rep.Run(&impl.Context{}, params))
+	// the slot is released after the job completes
+	assert.Equal(t, 0, transfer.Limiter.Active("https://small.example.com"))
+}
+
+func TestRunWithDisallowedProject(t *testing.T) {
+	transferred = false
+	params := map[string]interface{}{
+		"src_resource": `{"type":"res","metadata":{"repository":{"name":"secret/hello-world"}}}`,
+		"dst_resource": `{"registry":{"name":"target","allowed_projects":["library"]}}`,
+	}
+	rep := &Replication{}
+	err := rep.Run(&fakedContext{}, params)
+	require.NotNil(t, err)
+	assert.Equal(t, "refuse to replicate the repository secret/hello-world as its project isn't in the allowed projects [library] of the registry target", err.Error())
+	assert.False(t, transferred)
+	assert.False(t, rep.ShouldRetry())
+
+	// the repositories of the allowed projects are replicated
+	params["src_resource"] = `{"type":"res","metadata":{"repository":{"name":"library/hello-world"}}}`
+	rep = &Replication{}
+	require.Nil(t, rep.Run(&fakedContext{}, params))
+	assert.True(t, transferred)
+}
+
+func TestRunInBlackout(t *testing.T) {
+	transferred = false
+	// the windows adjoining each other cover the whole day
+	params := map[string]interface{}{
+		"src_resource": `{"type":"res"}`,
+		"dst_resource": `{"registry":{"name":"target","blackout_windows":[{"start":"00:00","end":"12:00"},{"start":"12:00","end":"00:00"}]}}`,
+	}
+	ctx := &fakedContext{}
+	rep := &Replication{}
+	require.Nil(t, rep.Run(ctx, params))
+	assert.False(t, transferred)
+	require.Equal(t, 1, len(ctx.checkIns))
+	require.True(t, strings.HasPrefix(ctx.checkIns[0], transfer.CheckInBlackoutPrefix))
+	_, err := time.Parse(time.RFC3339, strings.TrimPrefix(ctx.checkIns[0], transfer.CheckInBlackoutPrefix))
+	assert.Nil(t, err)
+}
+
+var fakedFailedTransferFactory = func(transfer.Logger, transfer.StopFunc) (transfer.Transfer, error) {
+	return &fakedFailedTransfer{}, nil
+}
+
+type fakedFailedTransfer struct{}
+
+func (f *fakedFailedTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return &common_http.Error{
+		Code: http.StatusUnauthorized,
+	}
+}
+
+func TestRunWithNonRetryableError(t *testing.T) {
+	err := transfer.RegisterFactory("failed", fakedFailedTransferFactory)
+	require.Nil(t, err)
+	params := map[string]interface{}{
+		"src_resource": `{"type":"failed"}`,
+		"dst_resource": `{}`,
+	}
+	ctx := &fakedContext{}
+	rep := &Replication{}
+	require.NotNil(t, rep.Run(ctx, params))
+	assert.False(t, rep.ShouldRetry())
+	// the reason of the failure is checked in
+	require.Equal(t, 1, len(ctx.checkIns))
+	assert.True(t, strings.HasPrefix(ctx.checkIns[0], transfer.CheckInFailurePrefix))
+}
+
+// fakedContext records the check in messages
+type fakedContext struct {
+	impl.Context
+	checkIns []string
+}
+
+func (f *fakedContext) Checkin(status string) error {
+	f.checkIns = append(f.checkIns, status)
+	return nil
+}
+
+func (f *fakedContext) GetLogger() logger.Interface {
+	return backend.NewStdOutputLogger("DEBUG", backend.StdErr, 4)
+}
+
+var fakedReadOnlyTransferFactory = func(transfer.Logger, transfer.StopFunc) (transfer.Transfer, error) {
+	return &fakedReadOnlyTransfer{}, nil
+}
+
+type fakedReadOnlyTransfer struct{}
+
+func (f *fakedReadOnlyTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return common_http.ParseRegistryError(http.StatusForbidden,
+		[]byte(`{"errors":[{"code":"DENIED","message":"The system is in read only mode. Any modification is prohibited."}]}`))
+}
+
+func TestRunWithReadOnlyDestination(t *testing.T) {
+	err := transfer.RegisterFactory("readonly", fakedReadOnlyTransferFactory)
+	require.Nil(t, err)
+
+	// pause
+	params := map[string]interface{}{
+		"src_resource": `{"type":"readonly"}`,
+		"dst_resource": `{"pause_on_read_only":true}`,
+	}
+	ctx := &fakedContext{}
+	rep := &Replication{}
+	require.NotNil(t, rep.Run(ctx, params))
+	assert.False(t, rep.ShouldRetry())
+	assert.Equal(t, []string{transfer.CheckInReadOnly}, ctx.checkIns)
+
+	// fail
+	params["dst_resource"] = `{"pause_on_read_only":false}`
+	ctx = &fakedContext{}
+	rep = &Replication{}
+	require.NotNil(t, rep.Run(ctx, params))
+	assert.False(t, rep.ShouldRetry())
+	require.Equal(t, 1, len(ctx.checkIns))
+	assert.True(t, strings.HasPrefix(ctx.checkIns[0], transfer.CheckInFailurePrefix))
+
+	// the auth error doesn't pause the job
+	err = transfer.RegisterFactory("denied", func(transfer.Logger, transfer.StopFunc) (transfer.Transfer, error) {
+		return &fakedFailedTransfer{}, nil
+	})
+	require.Nil(t, err)
+	params = map[string]interface{}{
+		"src_resource": `{"type":"denied"}`,
+		"dst_resource": `{"pause_on_read_only":true}`,
+	}
+	ctx = &fakedContext{}
+	rep = &Replication{}
+	require.NotNil(t, rep.Run(ctx, params))
+	require.Equal(t, 1, len(ctx.checkIns))
+	assert.NotEqual(t, transfer.CheckInReadOnly, ctx.checkIns[0])
+}
+
+// fakedReferrerTransfer reports the count of the referrers transferred
+type fakedReferrerTransfer struct {
+	referrers int
+}
+
+func (f *fakedReferrerTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return nil
+}
+
+func (f *fakedReferrerTransfer) Referrers() int {
+	return f.referrers
+}
+
+func TestCheckInReferrers(t *testing.T) {
+	ctx := &fakedContext{}
+	checkInReferrers(ctx, &fakedReferrerTransfer{referrers: 2})
+	assert.Equal(t, []string{transfer.CheckInReferrersPrefix + "2"}, ctx.checkIns)
+
+	// nothing is checked in if no referrer is transferred
+	ctx = &fakedContext{}
+	checkInReferrers(ctx, &fakedReferrerTransfer{})
+	assert.Empty(t, ctx.checkIns)
+}
+
+// fakedMediaTypeTransfer reports the media types of the manifests on the destination registry
+type fakedMediaTypeTransfer struct {
+	mediaTypes []string
+}
+
+func (f *fakedMediaTypeTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return nil
+}
+
+func (f *fakedMediaTypeTransfer) MediaTypes() []string {
+	return f.mediaTypes
+}
+
+func TestCheckInMediaTypes(t *testing.T) {
+	ctx := &fakedContext{}
+	checkInMediaTypes(ctx, &fakedMediaTypeTransfer{
+		mediaTypes: []string{"application/vnd.oci.image.manifest.v1+json", "application/vnd.docker.distribution.manifest.v2+json"},
+	})
+	assert.Equal(t, []string{transfer.CheckInMediaTypesPrefix +
+		"application/vnd.oci.image.manifest.v1+json,application/vnd.docker.distribution.manifest.v2+json"}, ctx.checkIns)
+
+	// nothing is checked in if no manifest is on the destination registry
+	ctx = &fakedContext{}
+	checkInMediaTypes(ctx, &fakedMediaTypeTransfer{})
+	assert.Empty(t, ctx.checkIns)
+}
+
+// fakedEndpointTransfer reports the endpoints of the registries used by the transfer
+type fakedEndpointTransfer struct {
+	src string
+	dst string
+}
+
+func (f *fakedEndpointTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return nil
+}
+
+func (f *fakedEndpointTransfer) Endpoints() (string, string) {
+	return f.src, f.dst
+}
+
+func TestCheckInEndpoints(t *testing.T) {
+	ctx := &fakedContext{}
+	checkInEndpoints(ctx, &fakedEndpointTransfer{
+		src: "https://src.example.com",
+		dst: "https://secondary.example.com",
+	})
+	assert.Equal(t, []string{transfer.CheckInEndpointsPrefix +
+		"https://src.example.com https://secondary.example.com"}, ctx.checkIns)
+
+	// nothing is checked in if the transfer isn't initialized
+	ctx = &fakedContext{}
+	checkInEndpoints(ctx, &fakedEndpointTransfer{})
+	assert.Empty(t, ctx.checkIns)
+}
+
+// fakedProgressTransfer reports the progress of the transfer
+type fakedProgressTransfer struct {
+	progress *transfer.Progress
+}
+
+func (f *fakedProgressTransfer) Transfer(src *model.Resource, dst *model.Resource) error {
+	return nil
+}
+
+func (f *fakedProgressTransfer) Progress() *transfer.Progress {
+	return f.progress
+}
+
+func TestCheckInProgress(t *testing.T) {
+	eta := int64(30)
+	ctx := &fakedContext{}
+	stop := checkInProgress(ctx, &fakedProgressTransfer{
+		progress: &transfer.Progress{Bytes: 10, Total: 40, ETA: &eta},
+	}, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	require.NotEmpty(t, ctx.checkIns)
+	assert.Equal(t, transfer.CheckInProgressPrefix+`{"bytes":10,"total":40,"eta":30}`, ctx.checkIns[0])
+
+	// nothing is checked in if nothing is expected to be transferred
+	ctx = &fakedContext{}
+	stop = checkInProgress(ctx, &fakedProgressTransfer{}, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	assert.Empty(t, ctx.checkIns)
+}
+
+func TestIsReadOnly(t *testing.T) {
+	assert.False(t, isReadOnly(errors.New("read only")))
+	assert.True(t, isReadOnly(&common_http.Error{Code: http.StatusMethodNotAllowed}))
+	assert.False(t, isReadOnly(&common_http.Error{Code: http.StatusForbidden}))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(errors.New("connection refused")))
+	assert.True(t, isRetryable(&common_http.Error{Code: http.StatusServiceUnavailable}))
+	assert.False(t, isRetryable(&common_http.Error{Code: http.StatusUnauthorized}))
+	assert.False(t, isRetryable(&registry_pkg.ManifestTooLargeError{Repository: "library/hello-world", Reference: "latest"}))
+	assert.False(t, isRetryable(&transfer.InsufficientStorageError{Repository: "library/hello-world", Required: 2, Available: 1}))
+	assert.False(t, isRetryable(&common_http.Error{Code: http.StatusNotFound}))
+}
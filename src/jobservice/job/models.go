@@ -74,6 +74,12 @@ type ActionRequest struct {
 	Action string `json:"action"`
 }
 
+// Maintenance defines the maintenance mode of job service, the new jobs are
+// rejected when it's enabled while the running ones continue.
+type Maintenance struct {
+	Enabled bool `json:"enabled"`
+}
+
 // StatusChange is designed for reporting the status change via hook.
 type StatusChange struct {
 	JobID    string     `json:"job_id"`
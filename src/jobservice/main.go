@@ -29,6 +29,9 @@ import (
 	"github.com/goharbor/harbor/src/jobservice/job/impl"
 	"github.com/goharbor/harbor/src/jobservice/logger"
 	"github.com/goharbor/harbor/src/jobservice/runtime"
+	"github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/transfer"
+	reputil "github.com/goharbor/harbor/src/replication/util"
 )
 
 func main() {
@@ -47,6 +50,22 @@ func main() {
 		panic(fmt.Sprintf("load configurations error: %s\n", err))
 	}
 
+	// Set the timeouts and the resolver of the transports used to access the registries and the default limitation
+	// of the connections to the registries, they're applied again when the configurations are reloaded
+	applyRegistryConfig := func() {
+		reputil.SetTransportTimeouts(config.GetRegistryDialTimeout(), config.GetRegistryTLSHandshakeTimeout())
+		if err := reputil.SetResolver(config.GetRegistryNameserver(), config.GetRegistryHosts()); err != nil {
+			logger.Errorf("failed to set the resolver of the registries, the previous one is kept: %v", err)
+		}
+		transfer.SetDefaultMaxConnections(config.GetRegistryMaxConnections())
+		transfer.SetAdaptiveConnections(config.GetRegistryAdaptiveConnections())
+		reputil.SetMaxManifestSize(config.GetRegistryMaxManifestSize())
+	}
+	applyRegistryConfig()
+	config.OnReload(applyRegistryConfig)
+	// Set the credential used to access the registries which have no credential configured
+	adapter.SetDefaultCredential(config.GetRegistryDefaultCredential())
+
 	// Append node ID
 	vCtx := context.WithValue(context.Background(), utils.NodeID, utils.GenerateNodeID())
 	// Create the root context
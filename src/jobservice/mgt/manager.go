@@ -29,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Manager defies the related operations to handle the management of job stats.
@@ -86,6 +87,23 @@ type Manager interface {
 	// Returns:
 	//   Non nil error if any issues meet
 	SaveJob(job *job.Stats) error
+
+	// Enable or disable the maintenance mode, the flag is kept in redis so that it's
+	// shared by all the jobservice instances and survives the restart
+	//
+	// Arguments:
+	//   enabled bool: whether the maintenance mode is enabled
+	//
+	// Returns:
+	//   Non nil error if any issues meet
+	SetMaintenance(enabled bool) error
+
+	// Check whether the maintenance mode is enabled
+	//
+	// Returns:
+	//   true if the maintenance mode is enabled
+	//   Non nil error if any issues meet
+	InMaintenance() (bool, error)
 }
 
 // basicManager is the default implementation of @manager,
@@ -347,3 +365,29 @@ func queryExecutions(conn redis.Conn, dataKey string, q *query.Parameter) ([]str
 
 	return results, total, nil
 }
+
+// SetMaintenance is implementation of Manager.SetMaintenance
+func (bm *basicManager) SetMaintenance(enabled bool) error {
+	conn := bm.pool.Get()
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	key := rds.KeyMaintenance(bm.namespace)
+	if enabled {
+		_, err := conn.Do("SET", key, time.Now().Unix())
+		return err
+	}
+	_, err := conn.Do("DEL", key)
+	return err
+}
+
+// InMaintenance is implementation of Manager.InMaintenance
+func (bm *basicManager) InMaintenance() (bool, error) {
+	conn := bm.pool.Get()
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return redis.Bool(conn.Do("EXISTS", rds.KeyMaintenance(bm.namespace)))
+}
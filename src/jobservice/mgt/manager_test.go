@@ -182,3 +182,24 @@ func (suite *BasicManagerTestSuite) TestSaveJob() {
 	err := suite.manager.SaveJob(newJob)
 	require.NoError(suite.T(), err)
 }
+
+// TestMaintenance tests setting and getting the maintenance mode
+func (suite *BasicManagerTestSuite) TestMaintenance() {
+	enabled, err := suite.manager.InMaintenance()
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), enabled)
+
+	err = suite.manager.SetMaintenance(true)
+	require.NoError(suite.T(), err)
+	// the flag is shared by the managers of the same namespace, e.g. the ones of other instances
+	another := NewManager(context.TODO(), suite.namespace, suite.pool)
+	enabled, err = another.InMaintenance()
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), enabled)
+
+	err = suite.manager.SetMaintenance(false)
+	require.NoError(suite.T(), err)
+	enabled, err = another.InMaintenance()
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), enabled)
+}
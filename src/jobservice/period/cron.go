@@ -0,0 +1,60 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package period
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// CronTimezonePrefix is the prefix of the time zone of the cron spec, e.g. "CRON_TZ=Europe/Berlin 0 0 1 * * *"
+// fires at 01:00 in Berlin. It's the same with the one supported by the later versions of the cron library
+const CronTimezonePrefix = "CRON_TZ="
+
+// ParseCron parses the cron spec which may be prefixed with the time zone and returns the schedule
+// and the location the schedule fires in. The location is nil if the time zone isn't specified, then
+// the schedule fires in the location of the time passed to it
+func ParseCron(spec string) (cron.Schedule, *time.Location, error) {
+	var location *time.Location
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, CronTimezonePrefix) {
+		i := strings.Index(spec, " ")
+		if i == -1 {
+			return nil, nil, fmt.Errorf("missing the cron spec after the time zone: %s", spec)
+		}
+		loc, err := time.LoadLocation(strings.TrimPrefix(spec[:i], CronTimezonePrefix))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid time zone of the cron spec %s: %v", spec, err)
+		}
+		location = loc
+		spec = strings.TrimSpace(spec[i:])
+	}
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schedule, location, nil
+}
+
+// WithTimezone prefixes the cron spec with the time zone, the spec is returned as it is if the time zone is empty
+func WithTimezone(spec, timezone string) string {
+	if len(timezone) == 0 {
+		return spec
+	}
+	return fmt.Sprintf("%s%s %s", CronTimezonePrefix, timezone, spec)
+}
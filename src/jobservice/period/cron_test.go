@@ -0,0 +1,53 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package period
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	// without the time zone
+	_, location, err := ParseCron("0 0 1 * * *")
+	require.Nil(t, err)
+	assert.Nil(t, location)
+
+	// with the time zone, the schedule fires at 01:00 in Berlin, i.e. 00:00 UTC in winter
+	schedule, location, err := ParseCron(WithTimezone("0 0 1 * * *", "Europe/Berlin"))
+	require.Nil(t, err)
+	assert.Equal(t, "Europe/Berlin", location.String())
+	from := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	next := schedule.Next(from.In(location))
+	assert.Equal(t, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC), next.UTC())
+
+	// invalid time zone
+	_, _, err = ParseCron("CRON_TZ=Mars/Olympus 0 0 1 * * *")
+	assert.NotNil(t, err)
+
+	// missing the cron spec
+	_, _, err = ParseCron("CRON_TZ=Europe/Berlin")
+	assert.NotNil(t, err)
+
+	// invalid cron spec
+	_, _, err = ParseCron(WithTimezone("invalid", "Europe/Berlin"))
+	assert.NotNil(t, err)
+
+	// the spec is kept if the time zone is empty
+	assert.Equal(t, "0 0 1 * * *", WithTimezone("0 0 1 * * *", ""))
+}
@@ -27,7 +27,6 @@ import (
 	"github.com/goharbor/harbor/src/jobservice/lcm"
 	"github.com/goharbor/harbor/src/jobservice/logger"
 	"github.com/gomodule/redigo/redis"
-	"github.com/robfig/cron"
 )
 
 const (
@@ -168,7 +167,7 @@ func (e *enqueuer) scheduleNextJobs(p *Policy, conn redis.Conn) {
 	nowTime := time.Unix(time.Now().Unix(), 0)
 	horizon := nowTime.Add(enqueuerHorizon)
 
-	schedule, err := cron.Parse(p.CronSpec)
+	schedule, location, err := ParseCron(p.CronSpec)
 	if err != nil {
 		// The cron spec should be already checked at upper layers.
 		// Just in cases, if error occurred, ignore it
@@ -189,6 +188,10 @@ func (e *enqueuer) scheduleNextJobs(p *Policy, conn redis.Conn) {
 		// Add extra argument for job running
 		// Notes: Only for system using
 		wJobParams[PeriodicExecutionMark] = true
+		// the cron fires in the time zone of the spec if it's specified
+		if location != nil {
+			nowTime = nowTime.In(location)
+		}
 		for t := schedule.Next(nowTime); t.Before(horizon); t = schedule.Next(t) {
 			epoch := t.Unix()
 
@@ -26,7 +26,6 @@ import (
 	"github.com/goharbor/harbor/src/jobservice/common/utils"
 	"github.com/goharbor/harbor/src/jobservice/logger"
 	"github.com/gomodule/redigo/redis"
-	"github.com/robfig/cron"
 	"strings"
 )
 
@@ -74,7 +73,7 @@ func (p *Policy) Validate() error {
 		}
 	}
 
-	if _, err := cron.Parse(p.CronSpec); err != nil {
+	if _, _, err := ParseCron(p.CronSpec); err != nil {
 		return err
 	}
 
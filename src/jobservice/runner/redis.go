@@ -161,6 +161,13 @@ func (rj *RedisJob) Run(j *work.Job) (err error) {
 	err = runningJob.Run(execContext, j.Args)
 	// Handle retry
 	rj.retry(runningJob, j)
+	// Mark the job dead if it won't be retried any more, the die time is reported
+	// with the hook event of the failure
+	if err != nil && isDead(runningJob, j) {
+		if er := markDead(tracker); er != nil {
+			logger.Errorf("Mark job %s:%s dead error: %s", j.Name, j.ID, er)
+		}
+	}
 	// Handle periodic job execution
 	if isPeriodicJobExecution(j) {
 		if er := tracker.PeriodicExecutionDone(); er != nil {
@@ -181,6 +188,23 @@ func (rj *RedisJob) retry(j job.Interface, wj *work.Job) {
 	}
 }
 
+// isDead checks whether the failed job is moved to the dead queue rather than being retried,
+// the fails of the job are increased after the run
+func isDead(j job.Interface, wj *work.Job) bool {
+	maxFails := int64(j.MaxFails())
+	if maxFails == 0 {
+		// the default max fails of the worker pool
+		maxFails = 4
+	}
+	return wj.Fails+1 >= maxFails
+}
+
+func markDead(tracker job.Tracker) error {
+	now := time.Now().Unix()
+	tracker.Job().Info.DieAt = now
+	return tracker.Update("die_at", now)
+}
+
 func isPeriodicJobExecution(j *work.Job) bool {
 	if isPeriodic, ok := j.Args["_job_kind_periodic_"]; ok {
 		if isPeriodicV, yes := isPeriodic.(bool); yes && isPeriodicV {
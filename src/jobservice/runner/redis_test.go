@@ -227,3 +227,26 @@ func (j *fakePanicJob) Validate(params job.Parameters) error {
 func (j *fakePanicJob) Run(ctx job.Context, params job.Parameters) error {
 	panic("for testing")
 }
+
+type fakeRetryJob struct {
+	fakeParentJob
+}
+
+func (j *fakeRetryJob) MaxFails() uint {
+	return 3
+}
+
+func (j *fakeRetryJob) ShouldRetry() bool {
+	return true
+}
+
+func TestIsDead(t *testing.T) {
+	retryJob := &fakeRetryJob{}
+	assert.False(t, isDead(retryJob, &work.Job{Fails: 0}))
+	assert.False(t, isDead(retryJob, &work.Job{Fails: 1}))
+	assert.True(t, isDead(retryJob, &work.Job{Fails: 2}))
+
+	// the fails are set big enough by "retry" if the job shouldn't be retried
+	assert.True(t, isDead(&fakeParentJob{}, &work.Job{Fails: 0}))
+	assert.True(t, isDead(retryJob, &work.Job{Fails: 10000000000}))
+}
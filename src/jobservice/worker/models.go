@@ -17,6 +17,8 @@ package worker
 // Stats represents the healthy and status of all the running worker pools.
 type Stats struct {
 	Pools []*StatsData `json:"worker_pools"`
+	// Maintenance is true if the maintenance mode is enabled and the new jobs are rejected
+	Maintenance bool `json:"maintenance"`
 }
 
 // StatsData represents the healthy and status of the worker worker.
@@ -15,9 +15,12 @@
 package adapter
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/replication/model"
 )
 
@@ -37,6 +40,36 @@ type Adapter interface {
 	HealthCheck() (model.HealthStatus, error)
 }
 
+// ContextHealthChecker defines the capability to check the health status of registry
+// with a context, the check is aborted when the context is canceled
+type ContextHealthChecker interface {
+	HealthCheckWithContext(ctx context.Context) (model.HealthStatus, error)
+}
+
+// ProductProber defines the capability to probe the product of the registry, e.g. whether
+// it's another Harbor instance. It's implemented by the default image registry
+type ProductProber interface {
+	ProductWithContext(ctx context.Context) (*registry_pkg.Product, error)
+}
+
+// ClockSkewMeasurer defines the capability to measure the clock skew between the registry and Harbor,
+// the large skew breaks the validity of the tokens issued by the token service of the registry
+type ClockSkewMeasurer interface {
+	ClockSkewWithContext(ctx context.Context) (time.Duration, error)
+}
+
+// PushPermissionChecker defines the capability to check whether the credential of the registry
+// has the permission to push to the repository, e.g. the scoped token only allows to pull
+type PushPermissionChecker interface {
+	CanPushWithContext(ctx context.Context, repository string) (bool, error)
+}
+
+// Warmer defines the capability to establish the connections to the registry through the transport
+// of the adapter before they're needed, returns the count of the connections established
+type Warmer interface {
+	WarmUp(ctx context.Context, count int) (int, error)
+}
+
 // RegisterFactory registers one adapter factory to the registry
 func RegisterFactory(t model.RegistryType, factory Factory) error {
 	if len(t) == 0 {
@@ -53,13 +86,56 @@ func RegisterFactory(t model.RegistryType, factory Factory) error {
 	return nil
 }
 
-// GetFactory gets the adapter factory by the specified name
+// GetFactory gets the adapter factory by the specified name, the factory applies
+// the default credential to the registries which have no credential configured and
+// fails over to the first healthy endpoint of the registries which have failover URLs
 func GetFactory(t model.RegistryType) (Factory, error) {
 	factory, exist := registry[t]
 	if !exist {
 		return nil, fmt.Errorf("adapter factory for %s not found", t)
 	}
-	return factory, nil
+	return func(r *model.Registry) (Adapter, error) {
+		return factory(withDefaultCredential(SelectEndpoint(r)))
+	}, nil
+}
+
+// the credential used to access the registries which have no credential configured
+var defaultCredential *model.Credential
+
+// SetDefaultCredential sets the credential used to access the registries which have no
+// credential configured rather than accessing them anonymously. The credential of the
+// registry always takes precedence over the default one. Empty key and secret unset it
+func SetDefaultCredential(accessKey, accessSecret string) {
+	if len(accessKey) == 0 && len(accessSecret) == 0 {
+		defaultCredential = nil
+		return
+	}
+	defaultCredential = &model.Credential{
+		Type:         model.CredentialTypeBasic,
+		AccessKey:    accessKey,
+		AccessSecret: accessSecret,
+	}
+}
+
+// UseDefaultCredential returns whether the default credential is used to access the registry
+func UseDefaultCredential(r *model.Registry) bool {
+	if defaultCredential == nil || r == nil {
+		return false
+	}
+	return r.Credential == nil ||
+		(len(r.Credential.AccessKey) == 0 && len(r.Credential.AccessSecret) == 0)
+}
+
+// withDefaultCredential returns a copy of the registry with the default credential
+// if it's used, otherwise the registry itself is returned
+func withDefaultCredential(r *model.Registry) *model.Registry {
+	if !UseDefaultCredential(r) {
+		return r
+	}
+	reg := *r
+	credential := *defaultCredential
+	reg.Credential = &credential
+	return &reg
 }
 
 // HasFactory checks whether there is given type adapter factory
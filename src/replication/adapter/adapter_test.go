@@ -61,3 +61,51 @@ func TestListRegisteredAdapterTypes(t *testing.T) {
 	require.Equal(t, 1, len(types))
 	assert.Equal(t, model.RegistryType("harbor"), types[0])
 }
+
+func TestDefaultCredential(t *testing.T) {
+	var credential *model.Credential
+	registry = map[model.RegistryType]Factory{}
+	require.Nil(t, RegisterFactory("harbor", func(r *model.Registry) (Adapter, error) {
+		credential = r.Credential
+		return nil, nil
+	}))
+	factory, err := GetFactory("harbor")
+	require.Nil(t, err)
+
+	// no default credential, access anonymously
+	SetDefaultCredential("", "")
+	_, err = factory(&model.Registry{})
+	require.Nil(t, err)
+	assert.Nil(t, credential)
+
+	SetDefaultCredential("robot", "password")
+	defer SetDefaultCredential("", "")
+
+	// the default credential is used
+	reg := &model.Registry{
+		Credential: &model.Credential{},
+	}
+	assert.True(t, UseDefaultCredential(reg))
+	_, err = factory(reg)
+	require.Nil(t, err)
+	require.NotNil(t, credential)
+	assert.Equal(t, "robot", credential.AccessKey)
+	assert.Equal(t, "password", credential.AccessSecret)
+	// the registry isn't modified
+	assert.Empty(t, reg.Credential.AccessKey)
+
+	// the credential of the registry overrides the default one
+	reg = &model.Registry{
+		Credential: &model.Credential{
+			Type:         model.CredentialTypeBasic,
+			AccessKey:    "admin",
+			AccessSecret: "Harbor12345",
+		},
+	}
+	assert.False(t, UseDefaultCredential(reg))
+	_, err = factory(reg)
+	require.Nil(t, err)
+	require.NotNil(t, credential)
+	assert.Equal(t, "admin", credential.AccessKey)
+	assert.Equal(t, "Harbor12345", credential.AccessSecret)
+}
@@ -0,0 +1,137 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+)
+
+// the capabilities of the registry API
+const (
+	CapabilityCatalog       = "catalog"
+	CapabilityReferrers     = "referrers"
+	CapabilityChunkedUpload = "chunked_upload"
+	CapabilityDeletion      = "deletion"
+	CapabilityOCIManifest   = "oci_manifest"
+)
+
+// the status of the capabilities
+const (
+	CapabilitySupported   = "supported"
+	CapabilityUnsupported = "unsupported"
+	// the support cannot be determined, e.g. the credential has no permission to access the API
+	CapabilityUnknown = "unknown"
+)
+
+// the repository used to probe the capabilities which are repository level inside the namespace,
+// it doesn't need to exist and nothing is written into it
+const capabilityProbeRepository = "harbor-capability-probe"
+
+// the namespace to probe the capabilities in if it isn't specified
+const defaultProbeNamespace = "library"
+
+// the probed capabilities are cached per registry and namespace so that they're probed once
+// for the jobs replicating into the same namespace rather than once for every job
+const capabilitiesTTL = 5 * time.Minute
+
+type probedCapabilities struct {
+	capabilities map[string]string
+	probedAt     time.Time
+}
+
+var (
+	capabilitiesCache = map[string]*probedCapabilities{}
+	capabilitiesLock  sync.Mutex
+)
+
+// CapabilityProber defines the capability to probe the features supported by the registry
+type CapabilityProber interface {
+	// Capabilities returns the status of the capabilities, the key is the capability
+	// name and the value is the status. The capabilities which are repository level are
+	// probed inside the namespace, as the credential may only have the permission of the
+	// namespace which the resources are replicated into
+	Capabilities(namespace string) (map[string]string, error)
+}
+
+// Capabilities probes the features supported by the registry via the /v2/ API
+func (d *DefaultImageRegistry) Capabilities(namespace string) (map[string]string, error) {
+	if len(namespace) == 0 {
+		namespace = defaultProbeNamespace
+	}
+	// the status depends on the permission of the credential
+	accessKey := ""
+	if d.registry.Credential != nil {
+		accessKey = d.registry.Credential.AccessKey
+	}
+	key := fmt.Sprintf("%d|%s|%s|%s", d.registry.ID, d.registry.URL, accessKey, namespace)
+	capabilitiesLock.Lock()
+	probed, exist := capabilitiesCache[key]
+	capabilitiesLock.Unlock()
+	if exist && time.Since(probed.probedAt) < capabilitiesTTL {
+		return copyCapabilities(probed.capabilities), nil
+	}
+
+	capabilities, err := d.probeCapabilities(namespace + "/" + capabilityProbeRepository)
+	if err != nil {
+		return nil, err
+	}
+	capabilitiesLock.Lock()
+	capabilitiesCache[key] = &probedCapabilities{
+		capabilities: capabilities,
+		probedAt:     time.Now(),
+	}
+	capabilitiesLock.Unlock()
+	return copyCapabilities(capabilities), nil
+}
+
+func (d *DefaultImageRegistry) probeCapabilities(repository string) (map[string]string, error) {
+	client, err := d.getClient(repository)
+	if err != nil {
+		return nil, err
+	}
+	probes := map[string]func() (bool, error){
+		CapabilityCatalog:       d.SupportCatalog,
+		CapabilityReferrers:     client.SupportReferrers,
+		CapabilityChunkedUpload: client.SupportChunkedUpload,
+		CapabilityDeletion:      client.SupportDeletion,
+		CapabilityOCIManifest:   client.SupportOCIManifest,
+	}
+	capabilities := map[string]string{}
+	for name, probe := range probes {
+		supported, err := probe()
+		switch {
+		case err != nil:
+			log.Debugf("failed to probe the capability %s of registry %s: %v", name, d.registry.URL, err)
+			capabilities[name] = CapabilityUnknown
+		case supported:
+			capabilities[name] = CapabilitySupported
+		default:
+			capabilities[name] = CapabilityUnsupported
+		}
+	}
+	return capabilities, nil
+}
+
+func copyCapabilities(capabilities map[string]string) map[string]string {
+	copied := make(map[string]string, len(capabilities))
+	for name, status := range capabilities {
+		copied[name] = status
+	}
+	return copied
+}
@@ -0,0 +1,153 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	common_http_auth "github.com/goharbor/harbor/src/common/http/modifier/auth"
+	"github.com/goharbor/harbor/src/common/utils/registry/auth"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+var credentialProviders = map[model.CredentialType]CredentialProvider{}
+
+func init() {
+	basic := &basicCredentialProvider{}
+	providers := map[model.CredentialType]CredentialProvider{
+		model.CredentialTypeBasic: basic,
+		// the OAuth token is sent as the password of the basic auth
+		model.CredentialTypeOAuth:  basic,
+		model.CredentialTypeSecret: &secretCredentialProvider{},
+	}
+	for t, provider := range providers {
+		if err := RegisterCredentialProvider(t, provider); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// CredentialProvider provides the credential to access the registry according to the credential type
+type CredentialProvider interface {
+	// Credential returns the credential which authorizes the requests sent to the registry
+	Credential(registry *model.Registry) (auth.Credential, error)
+	// Refresh is called when the registry rejects the credential, e.g. the short-lived token
+	// expires, the credential returned by the next call of "Credential" should be the renewed one
+	Refresh(registry *model.Registry) error
+}
+
+// RegisterCredentialProvider registers the credential provider for the credential type
+func RegisterCredentialProvider(t model.CredentialType, provider CredentialProvider) error {
+	if len(t) == 0 {
+		return errors.New("invalid credential type")
+	}
+	if provider == nil {
+		return errors.New("empty credential provider")
+	}
+	if _, exist := credentialProviders[t]; exist {
+		return fmt.Errorf("credential provider for %s already exists", t)
+	}
+	credentialProviders[t] = provider
+	return nil
+}
+
+// GetCredentialProvider gets the credential provider for the credential type, the basic
+// one is returned if the type is empty
+func GetCredentialProvider(t model.CredentialType) (CredentialProvider, error) {
+	if len(t) == 0 {
+		t = model.CredentialTypeBasic
+	}
+	provider, exist := credentialProviders[t]
+	if !exist {
+		return nil, fmt.Errorf("credential provider for %s not found", t)
+	}
+	return provider, nil
+}
+
+// NewCredential returns the credential to access the registry provided by the provider of its
+// credential type, nil is returned if the registry has no credential
+func NewCredential(registry *model.Registry) (*RefreshableCredential, error) {
+	if registry.Credential == nil {
+		return nil, nil
+	}
+	provider, err := GetCredentialProvider(registry.Credential.Type)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := provider.Credential(registry)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshableCredential{
+		provider:   provider,
+		registry:   registry,
+		credential: credential,
+	}, nil
+}
+
+// RefreshableCredential delegates to the credential provided, which is replaced by the renewed one when refreshing
+type RefreshableCredential struct {
+	sync.RWMutex
+	provider   CredentialProvider
+	registry   *model.Registry
+	credential auth.Credential
+}
+
+// Modify the request by the credential provided
+func (r *RefreshableCredential) Modify(req *http.Request) error {
+	r.RLock()
+	credential := r.credential
+	r.RUnlock()
+	return credential.Modify(req)
+}
+
+// Refresh the credential by the provider
+func (r *RefreshableCredential) Refresh() error {
+	if err := r.provider.Refresh(r.registry); err != nil {
+		return err
+	}
+	credential, err := r.provider.Credential(r.registry)
+	if err != nil {
+		return err
+	}
+	r.Lock()
+	r.credential = credential
+	r.Unlock()
+	return nil
+}
+
+type basicCredentialProvider struct{}
+
+func (b *basicCredentialProvider) Credential(registry *model.Registry) (auth.Credential, error) {
+	return auth.NewBasicAuthCredential(registry.Credential.AccessKey, registry.Credential.AccessSecret), nil
+}
+
+func (b *basicCredentialProvider) Refresh(registry *model.Registry) error {
+	return nil
+}
+
+// the secret is only used by the communication of Harbor internal components
+type secretCredentialProvider struct{}
+
+func (s *secretCredentialProvider) Credential(registry *model.Registry) (auth.Credential, error) {
+	return common_http_auth.NewSecretAuthorizer(registry.Credential.AccessSecret), nil
+}
+
+func (s *secretCredentialProvider) Refresh(registry *model.Registry) error {
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/registry/auth"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCredential struct {
+	key string
+}
+
+func (f *fakeCredential) Modify(req *http.Request) error {
+	req.Header.Set("X-Fake-Key", f.key)
+	return nil
+}
+
+// fakeCredentialProvider provides the key which is renewed when refreshing
+type fakeCredentialProvider struct {
+	refreshed int
+}
+
+func (f *fakeCredentialProvider) Credential(registry *model.Registry) (auth.Credential, error) {
+	return &fakeCredential{
+		key: fmt.Sprintf("%s-%d", registry.Credential.AccessSecret, f.refreshed),
+	}, nil
+}
+
+func (f *fakeCredentialProvider) Refresh(registry *model.Registry) error {
+	f.refreshed++
+	return nil
+}
+
+func TestRegisterCredentialProvider(t *testing.T) {
+	// empty type
+	assert.NotNil(t, RegisterCredentialProvider("", &fakeCredentialProvider{}))
+	// empty provider
+	assert.NotNil(t, RegisterCredentialProvider("fake", nil))
+	// already exists
+	assert.NotNil(t, RegisterCredentialProvider(model.CredentialTypeBasic, &fakeCredentialProvider{}))
+
+	// the basic one is returned for the empty type
+	provider, err := GetCredentialProvider("")
+	require.Nil(t, err)
+	assert.Equal(t, credentialProviders[model.CredentialTypeBasic], provider)
+	// not found
+	_, err = GetCredentialProvider("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestCustomizedCredentialProvider(t *testing.T) {
+	provider := &fakeCredentialProvider{}
+	require.Nil(t, RegisterCredentialProvider("fake", provider))
+	defer delete(credentialProviders, "fake")
+
+	// the token service only accepts the refreshed key
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/service/token":
+			if r.Header.Get("X-Fake-Key") != "secret-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(fmt.Sprintf(`{"token":"token","expires_in":300,"issued_at":"%s"}`,
+				time.Now().UTC().Format(time.RFC3339))))
+		case r.Header.Get("Authorization") == "":
+			w.Header().Set("Www-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/service/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+		Credential: &model.Credential{
+			Type:         "fake",
+			AccessSecret: "secret",
+		},
+	})
+	require.Nil(t, err)
+	// the credential rejected is refreshed
+	status, err := registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Healthy), status)
+	assert.Equal(t, 1, provider.refreshed)
+
+	// no provider for the credential type
+	_, err = NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+		Credential: &model.Credential{
+			Type:         "unknown",
+			AccessSecret: "secret",
+		},
+	})
+	assert.NotNil(t, err)
+}
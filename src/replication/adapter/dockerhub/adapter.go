@@ -39,9 +39,9 @@ func factory(registry *model.Registry) (adp.Adapter, error) {
 	// this is needed for pulling images from public repositories
 	var credential auth.Credential
 	if registry.Credential != nil && len(registry.Credential.AccessSecret) != 0 {
-		credential = auth.NewBasicAuthCredential(
-			registry.Credential.AccessKey,
-			registry.Credential.AccessSecret)
+		if credential, err = adp.NewCredential(registry); err != nil {
+			return nil, err
+		}
 	}
 	authorizer := auth.NewStandardTokenAuthorizer(&http.Client{
 		Transport: util.GetHTTPTransport(registry.Insecure),
@@ -52,6 +52,8 @@ func factory(registry *model.Registry) (adp.Adapter, error) {
 		URL:        registryURL, // specify the URL of Docker Hub registry service
 		Credential: registry.Credential,
 		Insecure:   registry.Insecure,
+		UserAgent:  registry.UserAgent,
+		Headers:    registry.Headers,
 	}, authorizer)
 	if err != nil {
 		return nil, err
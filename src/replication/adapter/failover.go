@@ -0,0 +1,112 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// the selected endpoint is cached per registry so that the endpoints are probed once for a flow or a job
+// rather than every time an adapter is created for the registry
+const endpointSelectionTTL = time.Minute
+
+type selectedEndpoint struct {
+	url        string
+	selectedAt time.Time
+}
+
+var (
+	selectedEndpoints = map[string]*selectedEndpoint{}
+	selectionLock     sync.Mutex
+)
+
+// SelectEndpoint is the same with "SelectEndpointWithContext" but without the context
+func SelectEndpoint(r *model.Registry) *model.Registry {
+	return SelectEndpointWithContext(context.Background(), r)
+}
+
+// SelectEndpointWithContext selects the first healthy endpoint of the registry in the order of the URL
+// and the failover URLs. A copy of the registry whose URL is the selected endpoint and whose failover
+// URLs are cleared is returned, the URL is kept if none of the endpoints is healthy so that the failure
+// of the primary endpoint is reported. The registry itself is returned if it has no failover URLs
+func SelectEndpointWithContext(ctx context.Context, r *model.Registry) *model.Registry {
+	if r == nil || len(r.FailoverURLs) == 0 {
+		return r
+	}
+	key := selectionKey(r)
+	selectionLock.Lock()
+	selected, exist := selectedEndpoints[key]
+	selectionLock.Unlock()
+	if exist && time.Since(selected.selectedAt) < endpointSelectionTTL {
+		return endpointOf(r, selected.url)
+	}
+	for _, url := range r.Endpoints() {
+		reg := endpointOf(r, url)
+		status, err := checkEndpoint(ctx, reg)
+		if status == model.Healthy {
+			if url != r.URL {
+				log.Warningf("the registry %s fails over to the endpoint %s", r.URL, url)
+			}
+			selectionLock.Lock()
+			selectedEndpoints[key] = &selectedEndpoint{
+				url:        url,
+				selectedAt: time.Now(),
+			}
+			selectionLock.Unlock()
+			return reg
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Warningf("the endpoint %s of registry %s is unhealthy: %v", url, r.URL, err)
+	}
+	// the selection isn't cached when none of the endpoints is healthy, so they are probed again next time
+	return endpointOf(r, r.URL)
+}
+
+// the key contains the endpoints so that the cached selection is dropped once the endpoints are changed
+func selectionKey(r *model.Registry) string {
+	return fmt.Sprintf("%d|%s", r.ID, strings.Join(r.Endpoints(), ","))
+}
+
+// returns the copy of the registry whose URL is the endpoint and whose failover URLs are cleared
+func endpointOf(r *model.Registry, url string) *model.Registry {
+	reg := *r
+	reg.URL = url
+	reg.FailoverURLs = nil
+	return &reg
+}
+
+func checkEndpoint(ctx context.Context, r *model.Registry) (model.HealthStatus, error) {
+	factory, exist := registry[r.Type]
+	if !exist {
+		return model.Unknown, fmt.Errorf("adapter factory for %s not found", r.Type)
+	}
+	ad, err := factory(withDefaultCredential(r))
+	if err != nil {
+		return model.Unknown, err
+	}
+	if checker, ok := ad.(ContextHealthChecker); ok {
+		return checker.HealthCheckWithContext(ctx)
+	}
+	return ad.HealthCheck()
+}
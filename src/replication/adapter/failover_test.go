@@ -0,0 +1,100 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the adapter whose health status depends on the URL of the registry
+type fakedEndpointAdapter struct {
+	url     string
+	healthy map[string]bool
+}
+
+func (f *fakedEndpointAdapter) Info() (*model.RegistryInfo, error) {
+	return nil, nil
+}
+
+func (f *fakedEndpointAdapter) PrepareForPush([]*model.Resource) error {
+	return nil
+}
+
+func (f *fakedEndpointAdapter) HealthCheck() (model.HealthStatus, error) {
+	if f.healthy[f.url] {
+		return model.Healthy, nil
+	}
+	return model.Unhealthy, errors.New("connection refused")
+}
+
+func TestSelectEndpoint(t *testing.T) {
+	healthy := map[string]bool{}
+	registry = map[model.RegistryType]Factory{}
+	selectedEndpoints = map[string]*selectedEndpoint{}
+	require.Nil(t, RegisterFactory("harbor", func(r *model.Registry) (Adapter, error) {
+		return &fakedEndpointAdapter{url: r.URL, healthy: healthy}, nil
+	}))
+
+	// no failover URLs
+	reg := &model.Registry{
+		Type: "harbor",
+		URL:  "https://primary.example.com",
+	}
+	assert.Equal(t, reg, SelectEndpoint(reg))
+
+	reg.FailoverURLs = []string{"https://secondary.example.com", "https://tertiary.example.com"}
+
+	// the primary is healthy
+	healthy["https://primary.example.com"] = true
+	healthy["https://secondary.example.com"] = true
+	selected := SelectEndpoint(reg)
+	assert.Equal(t, "https://primary.example.com", selected.URL)
+	assert.Nil(t, selected.FailoverURLs)
+
+	// the selection is cached, the endpoints aren't probed again
+	healthy["https://primary.example.com"] = false
+	selected = SelectEndpoint(reg)
+	assert.Equal(t, "https://primary.example.com", selected.URL)
+
+	// the primary is down, fail over to the secondary
+	selectedEndpoints = map[string]*selectedEndpoint{}
+	selected = SelectEndpoint(reg)
+	assert.Equal(t, "https://secondary.example.com", selected.URL)
+	assert.Nil(t, selected.FailoverURLs)
+	// the registry itself isn't changed
+	assert.Equal(t, "https://primary.example.com", reg.URL)
+	assert.Equal(t, 2, len(reg.FailoverURLs))
+
+	// all the endpoints are down, the primary is kept
+	healthy["https://secondary.example.com"] = false
+	selectedEndpoints = map[string]*selectedEndpoint{}
+	selected = SelectEndpoint(reg)
+	assert.Equal(t, "https://primary.example.com", selected.URL)
+	// the selection isn't cached as none of the endpoints is healthy
+	assert.Equal(t, 0, len(selectedEndpoints))
+
+	// the adapter created by the factory uses the healthy endpoint
+	healthy["https://tertiary.example.com"] = true
+	factory, err := GetFactory("harbor")
+	require.Nil(t, err)
+	ad, err := factory(reg)
+	require.Nil(t, err)
+	assert.Equal(t, "https://tertiary.example.com", ad.(*fakedEndpointAdapter).url)
+}
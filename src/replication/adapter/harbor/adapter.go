@@ -23,7 +23,6 @@ import (
 
 	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/http/modifier"
-	common_http_auth "github.com/goharbor/harbor/src/common/http/modifier/auth"
 	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/common/utils/registry/auth"
 	adp "github.com/goharbor/harbor/src/replication/adapter"
@@ -49,20 +48,24 @@ type adapter struct {
 }
 
 func newAdapter(registry *model.Registry) (*adapter, error) {
-	transport := util.GetHTTPTransport(registry.Insecure)
+	transport, err := util.GetHTTPTransportWithTunnel(registry.SSHTunnel, registry.Insecure)
+	if err != nil {
+		return nil, err
+	}
 	modifiers := []modifier.Modifier{
 		&auth.UserAgentModifier{
-			UserAgent: adp.UserAgentReplication,
+			UserAgent: adp.UserAgent(registry),
 		},
 	}
+	if len(registry.Headers) > 0 {
+		modifiers = append(modifiers, &auth.HeaderModifier{
+			Headers: registry.Headers,
+		})
+	}
 	if registry.Credential != nil {
-		var authorizer modifier.Modifier
-		if registry.Credential.Type == model.CredentialTypeSecret {
-			authorizer = common_http_auth.NewSecretAuthorizer(registry.Credential.AccessSecret)
-		} else {
-			authorizer = auth.NewBasicAuthCredential(
-				registry.Credential.AccessKey,
-				registry.Credential.AccessSecret)
+		authorizer, err := adp.NewCredential(registry)
+		if err != nil {
+			return nil, err
 		}
 		modifiers = append(modifiers, authorizer)
 	}
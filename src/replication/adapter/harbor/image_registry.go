@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/util"
@@ -42,6 +43,21 @@ func (r *repository) Match(filters []*model.Filter) (bool, error) {
 
 type tag struct {
 	Name string `json:"name"`
+	// reported by Harbor since v1.10
+	Immutable bool `json:"immutable"`
+	// reported by Harbor if the tag has been scanned
+	ScanOverview *scanOverview `json:"scan_overview"`
+	// reported by Harbor if the tag is signed by Notary
+	Signature *signature `json:"signature"`
+}
+
+type signature struct {
+	Tag string `json:"tag"`
+}
+
+type scanOverview struct {
+	// zero if the scan hasn't finished
+	Severity models.Severity `json:"severity"`
 }
 
 func (t *tag) Match(filters []*model.Filter) (bool, error) {
@@ -86,8 +102,20 @@ func (a *adapter) FetchImages(filters []*model.Filter) ([]*model.Resource, error
 				continue
 			}
 			vtags := []string{}
+			immutableTags := []string{}
+			severities := map[string]models.Severity{}
+			signedTags := []string{}
 			for _, tag := range tags {
 				vtags = append(vtags, tag.Name)
+				if tag.Immutable {
+					immutableTags = append(immutableTags, tag.Name)
+				}
+				if tag.ScanOverview != nil && tag.ScanOverview.Severity > 0 {
+					severities[tag.Name] = tag.ScanOverview.Severity
+				}
+				if tag.Signature != nil {
+					signedTags = append(signedTags, tag.Name)
+				}
 			}
 			resources = append(resources, &model.Resource{
 				Type:     model.ResourceTypeImage,
@@ -97,7 +125,10 @@ func (a *adapter) FetchImages(filters []*model.Filter) ([]*model.Resource, error
 						Name:     repository.Name,
 						Metadata: project.Metadata,
 					},
-					Vtags: vtags,
+					Vtags:          vtags,
+					ImmutableTags:  immutableTags,
+					ScanSeverities: severities,
+					SignedTags:     signedTags,
 				},
 			})
 		}
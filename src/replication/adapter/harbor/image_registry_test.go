@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/common/utils/test"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/stretchr/testify/assert"
@@ -42,9 +43,13 @@ func TestFetchImages(t *testing.T) {
 			Pattern: "/api/repositories/library/hello-world/tags",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
 				data := `[{
-					"name": "1.0"
+					"name": "1.0",
+					"scan_overview": {"severity": 4}
 				},{
-					"name": "2.0"
+					"name": "2.0",
+					"immutable": true,
+					"scan_overview": {"severity": 0},
+					"signature": {"tag": "2.0", "hashes": {"sha256": "E1lggRW5RZnlZBY4usWu8d36p5u5YFfr9B68jTOs+Kc="}}
 				}]`
 				w.Write([]byte(data))
 			},
@@ -75,6 +80,10 @@ func TestFetchImages(t *testing.T) {
 	assert.Equal(t, 2, len(resources[0].Metadata.Vtags))
 	assert.Equal(t, "1.0", resources[0].Metadata.Vtags[0])
 	assert.Equal(t, "2.0", resources[0].Metadata.Vtags[1])
+	assert.Equal(t, []string{"2.0"}, resources[0].Metadata.ImmutableTags)
+	// the scan of "2.0" hasn't finished
+	assert.Equal(t, map[string]models.Severity{"1.0": models.SevMedium}, resources[0].Metadata.ScanSeverities)
+	assert.Equal(t, []string{"2.0"}, resources[0].Metadata.SignedTags)
 	// not nil filter
 	filters := []*model.Filter{
 		{
@@ -0,0 +1,254 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harbor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the tag immutability rules are supported since Harbor v1.10
+const (
+	immutabilityMajorVersion = 1
+	immutabilityMinorVersion = 10
+)
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+type selector struct {
+	Kind       string `json:"kind"`
+	Decoration string `json:"decoration"`
+	Pattern    string `json:"pattern"`
+}
+
+type immutableTagRule struct {
+	ID             int64                  `json:"id,omitempty"`
+	Disabled       bool                   `json:"disabled"`
+	Action         string                 `json:"action"`
+	Template       string                 `json:"template"`
+	TagSelectors   []*selector            `json:"tag_selectors"`
+	ScopeSelectors map[string][]*selector `json:"scope_selectors"`
+}
+
+// SupportTagImmutability checks the version of the Harbor to determine whether it supports
+// the tag immutability rules
+func (a *adapter) SupportTagImmutability() (bool, error) {
+	sys := &struct {
+		HarborVersion string `json:"harbor_version"`
+	}{}
+	if err := a.client.Get(a.getURL()+"/api/systeminfo", sys); err != nil {
+		return false, err
+	}
+	return supportTagImmutability(sys.HarborVersion), nil
+}
+
+// MakeTagsImmutable makes the tags of the repository immutable by the rule of the project the repository
+// belongs to. The rule added for the repository before is reused and extended with the tags rather than
+// adding a new rule every time, as the count of the rules of a project is limited
+func (a *adapter) MakeTagsImmutable(repository string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	paths := strings.SplitN(repository, "/", 2)
+	if len(paths) != 2 {
+		return fmt.Errorf("invalid repository name %s", repository)
+	}
+	project, err := a.getProject(paths[0])
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return fmt.Errorf("project %s not found", paths[0])
+	}
+	url := fmt.Sprintf("%s/api/projects/%d/immutabletagrules", a.getURL(), project.ID)
+	rules := []*immutableTagRule{}
+	if err = a.client.Get(url, &rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		existing, ok := rule.tagsOf(paths[1])
+		if !ok {
+			continue
+		}
+		merged := mergeTags(existing, tags)
+		// all the tags are immutable already
+		if len(merged) == len(existing) {
+			return nil
+		}
+		rule.TagSelectors[0].Pattern = tagsPattern(merged)
+		return a.client.Put(fmt.Sprintf("%s/%d", url, rule.ID), rule)
+	}
+	return a.client.Post(url, newImmutableTagRule(paths[1], tags))
+}
+
+func newImmutableTagRule(repository string, tags []string) *immutableTagRule {
+	return &immutableTagRule{
+		Action:   "immutable",
+		Template: "immutable_template",
+		TagSelectors: []*selector{
+			{
+				Kind:       "doublestar",
+				Decoration: "matches",
+				Pattern:    tagsPattern(tags),
+			},
+		},
+		ScopeSelectors: map[string][]*selector{
+			"repository": {
+				{
+					Kind:       "doublestar",
+					Decoration: "repoMatches",
+					Pattern:    escapePattern(repository),
+				},
+			},
+		},
+	}
+}
+
+// returns the tags made immutable by the rule if it's the one added by "MakeTagsImmutable" for the
+// repository, i.e. the enabled rule matching the repository and the literal tags only
+func (r *immutableTagRule) tagsOf(repository string) ([]string, bool) {
+	if r.Disabled || r.Action != "immutable" || len(r.TagSelectors) != 1 || len(r.ScopeSelectors) != 1 {
+		return nil, false
+	}
+	scopes := r.ScopeSelectors["repository"]
+	if len(scopes) != 1 || scopes[0].Decoration != "repoMatches" || scopes[0].Pattern != escapePattern(repository) {
+		return nil, false
+	}
+	selector := r.TagSelectors[0]
+	if selector.Kind != "doublestar" || selector.Decoration != "matches" {
+		return nil, false
+	}
+	pattern := selector.Pattern
+	if strings.HasPrefix(pattern, "{") && strings.HasSuffix(pattern, "}") {
+		pattern = pattern[1 : len(pattern)-1]
+	}
+	tags := []string{}
+	for _, tag := range splitPattern(pattern) {
+		unescaped, ok := unescapePattern(tag)
+		if !ok || len(unescaped) == 0 {
+			return nil, false
+		}
+		tags = append(tags, unescaped)
+	}
+	return tags, true
+}
+
+// returns the existing tags followed by the new ones which don't exist
+func mergeTags(existing, tags []string) []string {
+	merged := append([]string{}, existing...)
+	exist := map[string]bool{}
+	for _, tag := range existing {
+		exist[tag] = true
+	}
+	for _, tag := range tags {
+		if !exist[tag] {
+			exist[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// the doublestar pattern matching the tags literally
+func tagsPattern(tags []string) string {
+	escaped := []string{}
+	for _, tag := range tags {
+		escaped = append(escaped, escapePattern(tag))
+	}
+	if len(escaped) == 1 {
+		return escaped[0]
+	}
+	return "{" + strings.Join(escaped, ",") + "}"
+}
+
+// the meta characters of the doublestar pattern
+const patternMetaChars = `\*?[]{},!`
+
+// escapes the meta characters of the doublestar pattern so that the string is matched literally
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(patternMetaChars, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// unescapes the pattern escaped by "escapePattern", false is returned if the pattern contains
+// the meta characters which aren't escaped, i.e. it doesn't match a literal string
+func unescapePattern(pattern string) (string, bool) {
+	var b strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		if escaped {
+			b.WriteRune(c)
+			escaped = false
+			continue
+		}
+		if c == '\\' {
+			escaped = true
+			continue
+		}
+		if strings.ContainsRune(patternMetaChars, c) {
+			return "", false
+		}
+		b.WriteRune(c)
+	}
+	return b.String(), !escaped
+}
+
+// splits the alternatives of the pattern by the commas which aren't escaped
+func splitPattern(pattern string) []string {
+	parts := []string{}
+	start := 0
+	escaped := false
+	for i, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			parts = append(parts, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// the version reported by Harbor is in the format of "v1.10.0-6f8b1f4e",
+// the unrecognized versions(e.g. "dev") are treated as unsupported
+func supportTagImmutability(version string) bool {
+	matches := versionPattern.FindStringSubmatch(version)
+	if len(matches) != 3 {
+		return false
+	}
+	major, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return false
+	}
+	if major != immutabilityMajorVersion {
+		return major > immutabilityMajorVersion
+	}
+	return minor >= immutabilityMinorVersion
+}
@@ -0,0 +1,201 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/goharbor/harbor/src/common/utils/test"
+	adp "github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportTagImmutabilityVersion(t *testing.T) {
+	cases := []struct {
+		version   string
+		supported bool
+	}{
+		{"", false},
+		{"dev", false},
+		{"v1.8.0-8e9e2e3b", false},
+		{"v1.9.1-6f8b1f4e", false},
+		{"v1.10.0-6f8b1f4e", true},
+		{"v1.11.0", true},
+		{"2.0.0", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.supported, supportTagImmutability(c.version), c.version)
+	}
+}
+
+func TestSupportTagImmutability(t *testing.T) {
+	version := "v1.9.0-6f8b1f4e"
+	server := test.NewServer(&test.RequestHandlerMapping{
+		Method:  http.MethodGet,
+		Pattern: "/api/systeminfo",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"harbor_version":"` + version + `"}`))
+		},
+	})
+	defer server.Close()
+	adapter, err := newAdapter(&model.Registry{
+		Type: model.RegistryTypeHarbor,
+		URL:  server.URL,
+	})
+	require.Nil(t, err)
+
+	// the Harbor adapter implements the tag immutability
+	var registry adp.TagImmutabilityRegistry = adapter
+
+	supported, err := registry.SupportTagImmutability()
+	require.Nil(t, err)
+	assert.False(t, supported)
+
+	version = "v1.10.0-6f8b1f4e"
+	supported, err = registry.SupportTagImmutability()
+	require.Nil(t, err)
+	assert.True(t, supported)
+}
+
+func TestMakeTagsImmutable(t *testing.T) {
+	rules := []*immutableTagRule{}
+	posted, updated := 0, 0
+	server := test.NewServer([]*test.RequestHandlerMapping{
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects/1/immutabletagrules",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				data, _ := json.Marshal(rules)
+				w.Write(data)
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[{"project_id": 1, "name": "library"}]`))
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Pattern: "/api/projects/1/immutabletagrules",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				rule := &immutableTagRule{}
+				if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				posted++
+				rule.ID = int64(len(rules) + 1)
+				rules = append(rules, rule)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			Method:  http.MethodPut,
+			Pattern: "/api/projects/1/immutabletagrules/",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				rule := &immutableTagRule{}
+				if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if r.URL.Path != fmt.Sprintf("/api/projects/1/immutabletagrules/%d", rule.ID) ||
+					rule.ID < 1 || rule.ID > int64(len(rules)) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				updated++
+				rules[rule.ID-1] = rule
+			},
+		},
+	}...)
+	defer server.Close()
+	adapter, err := newAdapter(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+
+	// invalid repository name
+	err = adapter.MakeTagsImmutable("hello-world", []string{"1.0"})
+	assert.NotNil(t, err)
+
+	// project doesn't exist
+	err = adapter.MakeTagsImmutable("unknown/hello-world", []string{"1.0"})
+	assert.NotNil(t, err)
+
+	// the rule is added for the repository
+	err = adapter.MakeTagsImmutable("library/hello-world", []string{"1.0", "2.0"})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rules))
+	rule := rules[0]
+	assert.Equal(t, "immutable", rule.Action)
+	require.Equal(t, 1, len(rule.TagSelectors))
+	assert.Equal(t, "{1.0,2.0}", rule.TagSelectors[0].Pattern)
+	require.Equal(t, 1, len(rule.ScopeSelectors["repository"]))
+	assert.Equal(t, "hello-world", rule.ScopeSelectors["repository"][0].Pattern)
+
+	// the tags are immutable already
+	err = adapter.MakeTagsImmutable("library/hello-world", []string{"2.0"})
+	require.Nil(t, err)
+	assert.Equal(t, 1, posted)
+	assert.Equal(t, 0, updated)
+
+	// the rule of the repository is reused
+	err = adapter.MakeTagsImmutable("library/hello-world", []string{"2.0", "3.0"})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rules))
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, "{1.0,2.0,3.0}", rules[0].TagSelectors[0].Pattern)
+
+	// the rule of another repository isn't reused and the meta characters are escaped
+	err = adapter.MakeTagsImmutable("library/hello[world]", []string{"v1,0", "latest*"})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(rules))
+	assert.Equal(t, `{v1\,0,latest\*}`, rules[1].TagSelectors[0].Pattern)
+	assert.Equal(t, `hello\[world\]`, rules[1].ScopeSelectors["repository"][0].Pattern)
+
+	// the escaped tags are parsed back
+	err = adapter.MakeTagsImmutable("library/hello[world]", []string{"latest*", "v2"})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(rules))
+	assert.Equal(t, `{v1\,0,latest\*,v2}`, rules[1].TagSelectors[0].Pattern)
+
+	// the rules not matching the tags literally aren't reused
+	rules[0].TagSelectors[0].Pattern = "**"
+	err = adapter.MakeTagsImmutable("library/hello-world", []string{"4.0"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(rules))
+	assert.Equal(t, "4.0", rules[2].TagSelectors[0].Pattern)
+}
+
+func TestEscapePattern(t *testing.T) {
+	cases := []string{"1.0", "v1,0", `a\b`, "{a,b}", "[0-9]*?", "!latest"}
+	for _, c := range cases {
+		unescaped, ok := unescapePattern(escapePattern(c))
+		assert.True(t, ok, c)
+		assert.Equal(t, c, unescaped)
+	}
+
+	_, ok := unescapePattern("v*")
+	assert.False(t, ok)
+	_, ok = unescapePattern(`v\`)
+	assert.False(t, ok)
+}
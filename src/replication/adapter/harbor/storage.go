@@ -0,0 +1,71 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harbor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+)
+
+type quota struct {
+	Hard map[string]int64 `json:"hard"`
+	Used map[string]int64 `json:"used"`
+}
+
+// AvailableStorage returns the storage available in the quota of the project the repository
+// belongs to. The project summary is supported since Harbor v1.10, -1 is returned for the
+// older versions, the projects which don't exist yet and the projects without storage limit
+func (a *adapter) AvailableStorage(repository string) (int64, error) {
+	paths := strings.SplitN(repository, "/", 2)
+	if len(paths) != 2 {
+		return 0, fmt.Errorf("invalid repository name %s", repository)
+	}
+	project, err := a.getProject(paths[0])
+	if err != nil {
+		return 0, err
+	}
+	if project == nil {
+		return -1, nil
+	}
+	summary := &struct {
+		Quota *quota `json:"quota"`
+	}{}
+	url := fmt.Sprintf("%s/api/projects/%d/summary", a.getURL(), project.ID)
+	if err = a.client.Get(url, summary); err != nil {
+		if e, ok := err.(*common_http.Error); ok && e.Code == http.StatusNotFound {
+			return -1, nil
+		}
+		return 0, err
+	}
+	return availableStorage(summary.Quota), nil
+}
+
+func availableStorage(q *quota) int64 {
+	if q == nil {
+		return -1
+	}
+	hard, exist := q.Hard["storage"]
+	if !exist || hard < 0 {
+		return -1
+	}
+	available := hard - q.Used["storage"]
+	if available < 0 {
+		available = 0
+	}
+	return available
+}
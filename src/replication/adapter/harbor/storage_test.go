@@ -0,0 +1,113 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harbor
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/goharbor/harbor/src/common/utils/test"
+	adp "github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailableStorage(t *testing.T) {
+	server := test.NewServer([]*test.RequestHandlerMapping{
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects/1/summary",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"quota": {"hard": {"count": -1, "storage": 1000}, "used": {"count": 5, "storage": 400}}}`))
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects/2/summary",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"quota": {"hard": {"count": -1, "storage": -1}, "used": {"count": 5, "storage": 400}}}`))
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects/3/summary",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects/4/summary",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Pattern: "/api/projects",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[{"project_id": 1, "name": "library"}, {"project_id": 2, "name": "unlimited"},
+					{"project_id": 3, "name": "legacy"}, {"project_id": 4, "name": "broken"}]`))
+			},
+		},
+	}...)
+	defer server.Close()
+	adapter, err := newAdapter(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+
+	// the Harbor adapter reports the available storage
+	var reporter adp.StorageReporter = adapter
+
+	// invalid repository name
+	_, err = reporter.AvailableStorage("hello-world")
+	assert.NotNil(t, err)
+
+	// the storage in the quota of the project
+	available, err := reporter.AvailableStorage("library/hello-world")
+	require.Nil(t, err)
+	assert.Equal(t, int64(600), available)
+
+	// the storage isn't limited
+	available, err = reporter.AvailableStorage("unlimited/hello-world")
+	require.Nil(t, err)
+	assert.Equal(t, int64(-1), available)
+
+	// the Harbor doesn't support the project summary
+	available, err = reporter.AvailableStorage("legacy/hello-world")
+	require.Nil(t, err)
+	assert.Equal(t, int64(-1), available)
+
+	// the project doesn't exist
+	available, err = reporter.AvailableStorage("unknown/hello-world")
+	require.Nil(t, err)
+	assert.Equal(t, int64(-1), available)
+
+	// the failure of the summary API
+	_, err = reporter.AvailableStorage("broken/hello-world")
+	assert.NotNil(t, err)
+}
+
+func TestAvailableStorageOfQuota(t *testing.T) {
+	assert.Equal(t, int64(-1), availableStorage(nil))
+	assert.Equal(t, int64(-1), availableStorage(&quota{Hard: map[string]int64{"count": 10}}))
+	assert.Equal(t, int64(10), availableStorage(&quota{Hard: map[string]int64{"storage": 10}}))
+	assert.Equal(t, int64(0), availableStorage(&quota{
+		Hard: map[string]int64{"storage": 10},
+		Used: map[string]int64{"storage": 20},
+	}))
+}
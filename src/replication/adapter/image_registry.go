@@ -15,7 +15,9 @@
 package adapter
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -23,13 +25,14 @@ import (
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
+	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/http/modifier"
-	common_http_auth "github.com/goharbor/harbor/src/common/http/modifier/auth"
 	"github.com/goharbor/harbor/src/common/utils/log"
 	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/common/utils/registry/auth"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/util"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // const definition
@@ -37,6 +40,19 @@ const (
 	UserAgentReplication = "harbor-replication-service"
 )
 
+// HarborVersion is the version of Harbor reported in the default User-Agent,
+// it is set by the build flag "-X"
+var HarborVersion = "dev"
+
+// UserAgent returns the User-Agent used to send requests to the registry,
+// the one specified in the registry takes precedence over the default one
+func UserAgent(registry *model.Registry) string {
+	if registry != nil && len(registry.UserAgent) > 0 {
+		return registry.UserAgent
+	}
+	return fmt.Sprintf("%s/%s", UserAgentReplication, HarborVersion)
+}
+
 // ImageRegistry defines the capabilities that an image registry should have
 type ImageRegistry interface {
 	FetchImages(filters []*model.Filter) ([]*model.Resource, error)
@@ -50,6 +66,50 @@ type ImageRegistry interface {
 	PushBlob(repository, digest string, size int64, blob io.Reader) error
 }
 
+// ReferrerRegistry defines the capabilities that an image registry should have to replicate
+// the artifacts referring to images by digest, e.g. signatures and SBOMs
+type ReferrerRegistry interface {
+	// ListReferrers lists the descriptors of the manifests referring to the manifest specified by the digest
+	ListReferrers(repository, digest string) ([]v1.Descriptor, error)
+	// PullRawManifest pulls the manifest without parsing it, it's used for the manifests
+	// whose media types are not supported by "PullManifest", e.g. OCI image manifest
+	PullRawManifest(repository, reference string, accepttedMediaTypes []string) (mediaType string, payload []byte, err error)
+}
+
+// BlobMounter defines the capability to mount the blob from another repository of the same registry
+type BlobMounter interface {
+	// MountBlob mounts the blob from the repository "srcRepo" into "dstRepo", the error is
+	// returned if the blob isn't mounted, e.g. it doesn't exist in "srcRepo"
+	MountBlob(srcRepo, digest, dstRepo string) error
+}
+
+// TagLister defines the capability to list the tags of the repository
+type TagLister interface {
+	ListTag(repository string) ([]string, error)
+}
+
+// TagImmutabilityRegistry defines the capability to protect the tags from being overwritten or deleted
+type TagImmutabilityRegistry interface {
+	// SupportTagImmutability returns whether the registry supports the tag immutability rules
+	SupportTagImmutability() (bool, error)
+	// MakeTagsImmutable adds the rule which makes the tags of the repository immutable
+	MakeTagsImmutable(repository string, tags []string) error
+}
+
+// StorageReporter defines the capability to report the storage available on the registry
+type StorageReporter interface {
+	// AvailableStorage returns the bytes available to store the blobs of the repository,
+	// -1 means the storage is unlimited or the registry doesn't expose the info
+	AvailableStorage(repository string) (int64, error)
+}
+
+// CatalogLister defines the capability to enumerate the catalog of the registry page by page
+type CatalogLister interface {
+	// CatalogWithContext passes the repositories of each page to the handler as they're fetched,
+	// the enumeration is aborted when the context is canceled
+	CatalogWithContext(ctx context.Context, handler registry_pkg.CatalogHandler) error
+}
+
 // DefaultImageRegistry provides a default implementation for interface ImageRegistry
 type DefaultImageRegistry struct {
 	sync.RWMutex
@@ -57,35 +117,53 @@ type DefaultImageRegistry struct {
 	registry *model.Registry
 	client   *http.Client
 	clients  map[string]*registry_pkg.Repository
+	// the credential provided by the credential provider, it's refreshed when the registry rejects it
+	credential *RefreshableCredential
 }
 
 // NewDefaultImageRegistry returns an instance of DefaultImageRegistry
 func NewDefaultImageRegistry(registry *model.Registry) (*DefaultImageRegistry, error) {
 	var authorizer modifier.Modifier
+	var credential *RefreshableCredential
 	if registry.Credential != nil && len(registry.Credential.AccessSecret) != 0 {
-		var cred modifier.Modifier
-		if registry.Credential.Type == model.CredentialTypeSecret {
-			cred = common_http_auth.NewSecretAuthorizer(registry.Credential.AccessSecret)
-		} else {
-			cred = auth.NewBasicAuthCredential(
-				registry.Credential.AccessKey,
-				registry.Credential.AccessSecret)
+		cred, err := NewCredential(registry)
+		if err != nil {
+			return nil, err
+		}
+		credential = cred
+		// the token service is usually reachable only through the tunnel as well
+		transport, err := util.GetHTTPTransportWithTunnel(registry.SSHTunnel, registry.Insecure)
+		if err != nil {
+			return nil, err
 		}
 		authorizer = auth.NewStandardTokenAuthorizer(&http.Client{
-			Transport: util.GetHTTPTransport(registry.Insecure),
+			Transport: transport,
 		}, cred, registry.TokenServiceURL)
 	}
-	return NewDefaultImageRegistryWithCustomizedAuthorizer(registry, authorizer)
+	reg, err := NewDefaultImageRegistryWithCustomizedAuthorizer(registry, authorizer)
+	if err != nil {
+		return nil, err
+	}
+	reg.credential = credential
+	return reg, nil
 }
 
 // NewDefaultImageRegistryWithCustomizedAuthorizer returns an instance of DefaultImageRegistry with the customized authorizer
 func NewDefaultImageRegistryWithCustomizedAuthorizer(registry *model.Registry, authorizer modifier.Modifier) (*DefaultImageRegistry, error) {
-	transport := util.GetHTTPTransport(registry.Insecure)
+	transport, err := util.GetHTTPTransportWithTunnel(registry.SSHTunnel, registry.Insecure)
+	if err != nil {
+		return nil, err
+	}
 	modifiers := []modifier.Modifier{
 		&auth.UserAgentModifier{
-			UserAgent: UserAgentReplication,
+			UserAgent: UserAgent(registry),
 		},
 	}
+	if len(registry.Headers) > 0 {
+		modifiers = append(modifiers, &auth.HeaderModifier{
+			Headers: registry.Headers,
+		})
+	}
 	if authorizer != nil {
 		modifiers = append(modifiers, authorizer)
 	}
@@ -134,20 +212,48 @@ func (d *DefaultImageRegistry) create(repository string) (*registry_pkg.Reposito
 
 // HealthCheck checks health status of a registry
 func (d *DefaultImageRegistry) HealthCheck() (model.HealthStatus, error) {
+	return d.HealthCheckWithContext(context.Background())
+}
+
+// HealthCheckWithContext checks health status of a registry, the check is aborted when the context is canceled
+func (d *DefaultImageRegistry) HealthCheckWithContext(ctx context.Context) (model.HealthStatus, error) {
 	var err error
 	if d.registry.Credential == nil ||
 		(len(d.registry.Credential.AccessKey) == 0 && len(d.registry.Credential.AccessSecret) == 0) {
-		err = d.PingSimple()
+		err = d.PingSimpleWithContext(ctx)
 	} else {
-		err = d.Ping()
+		err = d.PingWithContext(ctx)
+		// refresh the credential rejected by the registry and try again
+		if e, ok := err.(*common_http.Error); ok && e.IsAuthError() && d.credential != nil {
+			if re := d.credential.Refresh(); re != nil {
+				log.Errorf("failed to refresh the credential of registry %s: %v", d.registry.URL, re)
+			} else {
+				err = d.PingWithContext(ctx)
+			}
+		}
 	}
 	if err != nil {
 		log.Errorf("failed to ping registry %s: %v", d.registry.URL, err)
-		return model.Unhealthy, nil
+		return model.Unhealthy, err
 	}
 	return model.Healthy, nil
 }
 
+// WarmUp establishes the connections to the registry through the transport of the adapter, so they're
+// dialed through the SSH tunnel if any and carry the custom headers, e.g. the ones required by the proxy
+func (d *DefaultImageRegistry) WarmUp(ctx context.Context, count int) (int, error) {
+	return registry_pkg.WarmUp(ctx, d.client.Transport, d.registry.URL, count)
+}
+
+// CanPushWithContext checks whether the credential has the permission to push to the repository
+func (d *DefaultImageRegistry) CanPushWithContext(ctx context.Context, repository string) (bool, error) {
+	client, err := d.getClient(repository)
+	if err != nil {
+		return false, err
+	}
+	return client.CanPushWithContext(ctx)
+}
+
 // FetchImages ...
 func (d *DefaultImageRegistry) FetchImages(namespaces []string, filters []*model.Filter) ([]*model.Resource, error) {
 	return nil, errors.New("not implemented")
@@ -183,6 +289,28 @@ func (d *DefaultImageRegistry) PullManifest(repository, reference string, accept
 	return manifest, digest, nil
 }
 
+// PullRawManifest ...
+func (d *DefaultImageRegistry) PullRawManifest(repository, reference string, accepttedMediaTypes []string) (string, []byte, error) {
+	client, err := d.getClient(repository)
+	if err != nil {
+		return "", nil, err
+	}
+	_, mediaType, payload, err := client.PullManifest(reference, accepttedMediaTypes)
+	if err != nil {
+		return "", nil, err
+	}
+	return mediaType, payload, nil
+}
+
+// ListReferrers ...
+func (d *DefaultImageRegistry) ListReferrers(repository, digest string) ([]v1.Descriptor, error) {
+	client, err := d.getClient(repository)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListReferrers(digest)
+}
+
 // PushManifest ...
 func (d *DefaultImageRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
 	client, err := d.getClient(repository)
@@ -245,6 +373,22 @@ func isDigest(str string) bool {
 	return strings.Contains(str, ":")
 }
 
+// MountBlob ...
+func (d *DefaultImageRegistry) MountBlob(srcRepo, digest, dstRepo string) error {
+	client, err := d.getClient(dstRepo)
+	if err != nil {
+		return err
+	}
+	mounted, err := client.TryMountBlob(digest, srcRepo)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		return fmt.Errorf("the blob %s isn't mounted from %s to %s", digest, srcRepo, dstRepo)
+	}
+	return nil
+}
+
 // ListTag ...
 func (d *DefaultImageRegistry) ListTag(repository string) ([]string, error) {
 	client, err := d.getClient(repository)
@@ -15,9 +15,17 @@
 package adapter
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO add UT
@@ -44,3 +52,310 @@ func TestIsDigest(t *testing.T) {
 		assert.Equal(t, c.isDigest, isDigest(c.str))
 	}
 }
+
+func TestUserAgent(t *testing.T) {
+	// default
+	assert.Equal(t, UserAgentReplication+"/"+HarborVersion, UserAgent(&model.Registry{}))
+	assert.Equal(t, UserAgentReplication+"/"+HarborVersion, UserAgent(nil))
+
+	// customized
+	assert.Equal(t, "my-agent", UserAgent(&model.Registry{
+		UserAgent: "my-agent",
+	}))
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// default
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	status, err := registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Healthy), status)
+	assert.Equal(t, UserAgentReplication+"/"+HarborVersion, userAgent)
+
+	// customized
+	registry, err = NewDefaultImageRegistry(&model.Registry{
+		URL:       server.URL,
+		UserAgent: "my-agent",
+	})
+	require.Nil(t, err)
+	_, err = registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, "my-agent", userAgent)
+}
+
+func TestCustomHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+		Headers: map[string]string{
+			"X-Api-Key": "key",
+			"X-Tenant":  "payments",
+		},
+	})
+	require.Nil(t, err)
+	_, err = registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, "key", header.Get("X-Api-Key"))
+	assert.Equal(t, "payments", header.Get("X-Tenant"))
+	assert.Equal(t, UserAgentReplication+"/"+HarborVersion, header.Get("User-Agent"))
+
+	// the headers are sent when replicating as well
+	header = nil
+	_, err = registry.BlobExist("library/hello-world", "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f")
+	require.Nil(t, err)
+	assert.Equal(t, "key", header.Get("X-Api-Key"))
+}
+
+func TestClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	var measurer ClockSkewMeasurer = registry
+	skew, err := measurer.ClockSkewWithContext(context.Background())
+	require.Nil(t, err)
+	assert.True(t, skew > 9*time.Minute && skew <= 10*time.Minute)
+}
+
+func TestHealthCheckWithContext(t *testing.T) {
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	status, err := registry.HealthCheckWithContext(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Unhealthy), status)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Error("the outbound request isn't aborted after the context is canceled")
+	}
+}
+
+func TestSchemeAndPort(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// plaintext http on a random port
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	status, err := registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Healthy), status)
+
+	// https on a random port
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	registry, err = NewDefaultImageRegistry(&model.Registry{
+		URL:      tlsServer.URL,
+		Insecure: true,
+	})
+	require.Nil(t, err)
+	status, err = registry.HealthCheck()
+	require.Nil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Healthy), status)
+
+	// https against the plaintext server, the scheme isn't rewritten
+	registry, err = NewDefaultImageRegistry(&model.Registry{
+		URL:      "https://" + server.Listener.Addr().String(),
+		Insecure: true,
+	})
+	require.Nil(t, err)
+	status, err = registry.HealthCheck()
+	assert.NotNil(t, err)
+	assert.Equal(t, model.HealthStatus(model.Unhealthy), status)
+}
+
+func TestCapabilities(t *testing.T) {
+	// the requests probing the repository level capabilities
+	probed := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			probed += r.URL.Path + "\n"
+		}
+		switch {
+		case r.URL.Path == "/v2/_catalog":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"repositories":[]}`))
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED"}]}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED"}]}`))
+		case r.Method == http.MethodPut:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	capabilities, err := registry.Capabilities("target")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		CapabilityCatalog:       CapabilitySupported,
+		CapabilityReferrers:     CapabilityUnsupported,
+		CapabilityChunkedUpload: CapabilityUnknown,
+		CapabilityDeletion:      CapabilityUnsupported,
+		CapabilityOCIManifest:   CapabilityUnsupported,
+	}, capabilities)
+	// the repository level capabilities are probed inside the namespace
+	assert.Contains(t, probed, "/v2/target/harbor-capability-probe/")
+
+	// the capabilities are cached for the registry and the namespace
+	probed = ""
+	registry, err = NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	cached, err := registry.Capabilities("target")
+	require.Nil(t, err)
+	assert.Equal(t, capabilities, cached)
+	assert.Empty(t, probed)
+
+	// but not for another namespace
+	_, err = registry.Capabilities("")
+	require.Nil(t, err)
+	assert.Contains(t, probed, "/v2/library/harbor-capability-probe/")
+}
+
+func TestMountBlob(t *testing.T) {
+	mounted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			if r.URL.Query().Get("from") == "library/base" {
+				mounted = true
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			// fall back to the normal upload
+			w.Header().Set("Location", "/v2/library/app/blobs/uploads/uuid")
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodHead:
+			if mounted {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry, err := NewDefaultImageRegistry(&model.Registry{
+		URL: server.URL,
+	})
+	require.Nil(t, err)
+	digest := "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+	// the blob doesn't exist in the source repository
+	assert.NotNil(t, registry.MountBlob("library/other", digest, "library/app"))
+	assert.Nil(t, registry.MountBlob("library/base", digest, "library/app"))
+}
+
+// newTokenScopedRegistry returns the registry whose token service only grants the push
+// scope to the user "writer", the other users can only pull
+func newTokenScopedRegistry() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/service/token":
+			username, _, _ := r.BasicAuth()
+			token := "pull-token"
+			if username == "writer" && strings.Contains(r.URL.Query().Get("scope"), "push") {
+				token = "push-token"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(fmt.Sprintf(`{"token":"%s","expires_in":300,"issued_at":"%s"}`,
+				token, time.Now().UTC().Format(time.RFC3339))))
+		case r.Header.Get("Authorization") == "":
+			w.Header().Set("Www-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/service/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/library/hello-world/blobs/uploads/":
+			if r.Header.Get("Authorization") != "Bearer push-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+				return
+			}
+			w.Header().Set("Location", "/v2/library/hello-world/blobs/uploads/uuid")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/library/hello-world/blobs/uploads/uuid":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestCanPushWithContext(t *testing.T) {
+	server := newTokenScopedRegistry()
+	defer server.Close()
+
+	cases := []struct {
+		username string
+		canPush  bool
+	}{
+		{"writer", true},
+		{"reader", false},
+	}
+	for _, c := range cases {
+		registry, err := NewDefaultImageRegistry(&model.Registry{
+			URL: server.URL,
+			Credential: &model.Credential{
+				Type:         model.CredentialTypeBasic,
+				AccessKey:    c.username,
+				AccessSecret: "password",
+			},
+		})
+		require.Nil(t, err)
+		canPush, err := registry.CanPushWithContext(context.Background(), "library/hello-world")
+		require.Nil(t, err)
+		assert.Equal(t, c.canPush, canPush)
+	}
+}
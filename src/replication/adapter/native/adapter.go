@@ -47,6 +47,7 @@ type native struct {
 }
 
 var _ adp.Adapter = native{}
+var _ adp.CatalogLister = native{}
 
 func (native) Info() (info *model.RegistryInfo, err error) {
 	return &model.RegistryInfo{
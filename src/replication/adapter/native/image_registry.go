@@ -68,24 +68,27 @@ func (n native) filterRepositories(pattern string) ([]string, error) {
 	if repositories, ok := util.IsSpecificPath(pattern); ok {
 		return repositories, nil
 	}
-	// search repositories from catalog api
-	repositories, err := n.Catalog()
-	if err != nil {
-		return nil, err
-	}
-	// if the pattern is null, just return the result of catalog API
-	if len(pattern) == 0 {
-		return repositories, nil
-	}
+	// search repositories from catalog api, the repositories are filtered page by page as they're fetched
 	result := []string{}
-	for _, repository := range repositories {
-		match, err := util.Match(pattern, repository)
-		if err != nil {
-			return nil, err
+	err := n.CatalogWithCheckpoint(func(repositories []string) error {
+		// if the pattern is null, just return the result of catalog API
+		if len(pattern) == 0 {
+			result = append(result, repositories...)
+			return nil
 		}
-		if match {
-			result = append(result, repository)
+		for _, repository := range repositories {
+			match, err := util.Match(pattern, repository)
+			if err != nil {
+				return err
+			}
+			if match {
+				result = append(result, repository)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
@@ -21,10 +21,16 @@ var (
 
 // Configuration holds the configuration information for replication
 type Configuration struct {
+	// the external endpoint of Harbor, e.g. https://harbor.example.com
+	ExtEndpoint     string
 	CoreURL         string
 	TokenServiceURL string
 	JobserviceURL   string
 	SecretKey       string
+	// the keyring of the versioned keys used to encrypt the secrets of the registries, the
+	// new secrets are encrypted with the key of SecretKeyVersion or SecretKey if it's empty
+	SecretKeys       map[string]string
+	SecretKeyVersion string
 	// TODO consider to use a specified secret for replication
 	CoreSecret       string
 	JobserviceSecret string
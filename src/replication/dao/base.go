@@ -1,6 +1,12 @@
 package dao
 
-import "github.com/astaxie/beego/orm"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+)
 
 func paginateForQuerySetter(qs orm.QuerySeter, page, size int64) orm.QuerySeter {
 	if size > 0 {
@@ -11,3 +17,44 @@ func paginateForQuerySetter(qs orm.QuerySeter, page, size int64) orm.QuerySeter
 	}
 	return qs
 }
+
+// orderForRawSQL returns the "order by" clause of the raw SQL by the sort string, the keys of the sortable
+// fields must be the column names. The ID is used as the secondary sort key to make the order stable. The
+// default sort is used if the sort string is empty
+func orderForRawSQL(sort, defaultSort string, sortable map[string]string) (string, error) {
+	if len(sort) == 0 {
+		sort = defaultSort
+	}
+	if _, err := models.ParseSort(sort, sortable); err != nil {
+		return "", err
+	}
+	column, direction := strings.TrimLeft(sort, "+-"), "asc"
+	if strings.HasPrefix(sort, "-") {
+		direction = "desc"
+	}
+	if column == "id" {
+		return fmt.Sprintf(`order by id %s `, direction), nil
+	}
+	return fmt.Sprintf(`order by %s %s, id desc `, column, direction), nil
+}
+
+// paginateForRawSQL appends the "limit" and "offset" clauses to the raw SQL if the size is specified
+func paginateForRawSQL(sql string, params []interface{}, page, size int64) (string, []interface{}) {
+	if size > 0 {
+		sql += `limit ? `
+		params = append(params, size)
+		if page > 0 {
+			sql += `offset ? `
+			params = append(params, size*(page-1))
+		}
+	}
+	return sql, params
+}
+
+func paramPlaceholder(n int) string {
+	placeholders := []string{}
+	for i := 0; i < n; i++ {
+		placeholders = append(placeholders, "?")
+	}
+	return strings.Join(placeholders, ",")
+}
@@ -0,0 +1,94 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/goharbor/harbor/src/common/dao"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+)
+
+// AddDeadLetter adds the dead letter of the task, the existing dead letter of the task is
+// refreshed with the latest failure
+func AddDeadLetter(letter *models.DeadLetter) (int64, error) {
+	o := dao.GetOrmer()
+	// the letter is overwritten by the existing one when reading
+	latest := *letter
+	created, id, err := o.ReadOrCreate(letter, "TaskID")
+	if err != nil || created {
+		return id, err
+	}
+	latest.ID = id
+	latest.CreationTime = letter.CreationTime
+	if _, err = o.Update(&latest, "ExecutionID", "PolicyID", "Repository", "SrcResource",
+		"DstResource", "JobID", "Reason", "Retries"); err != nil {
+		return 0, err
+	}
+	*letter = latest
+	return id, nil
+}
+
+// GetDeadLetter ...
+func GetDeadLetter(id int64) (*models.DeadLetter, error) {
+	o := dao.GetOrmer()
+	letter := &models.DeadLetter{
+		ID: id,
+	}
+	if err := o.Read(letter); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return letter, nil
+}
+
+// GetTotalOfDeadLetters returns the total count of dead letters
+func GetTotalOfDeadLetters(query ...*models.DeadLetterQuery) (int64, error) {
+	return deadLetterQueryConditions(query...).Count()
+}
+
+// GetDeadLetters lists the dead letters, the latest ones are returned first
+func GetDeadLetters(query ...*models.DeadLetterQuery) ([]*models.DeadLetter, error) {
+	qs := deadLetterQueryConditions(query...)
+	if len(query) > 0 && query[0] != nil {
+		qs = paginateForQuerySetter(qs, query[0].Page, query[0].Size)
+	}
+	letters := []*models.DeadLetter{}
+	_, err := qs.OrderBy("-creation_time", "-id").All(&letters)
+	return letters, err
+}
+
+func deadLetterQueryConditions(query ...*models.DeadLetterQuery) orm.QuerySeter {
+	qs := dao.GetOrmer().QueryTable(new(models.DeadLetter))
+	if len(query) == 0 || query[0] == nil {
+		return qs
+	}
+	q := query[0]
+	if q.PolicyID > 0 {
+		qs = qs.Filter("PolicyID", q.PolicyID)
+	}
+	if len(q.Repository) > 0 {
+		qs = qs.Filter("Repository", q.Repository)
+	}
+	return qs
+}
+
+// DeleteDeadLetterOfTask deletes the dead letter of the task
+func DeleteDeadLetterOfTask(taskID int64) error {
+	o := dao.GetOrmer()
+	_, err := o.QueryTable(new(models.DeadLetter)).Filter("TaskID", taskID).Delete()
+	return err
+}
@@ -0,0 +1,88 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodOfDeadLetter(t *testing.T) {
+	taskID, err := AddTask(&models.Task{
+		ExecutionID: 112300,
+		Repository:  "library/hello-world",
+		JobID:       "jobID1",
+		Status:      models.TaskStatusFailed,
+	})
+	require.Nil(t, err)
+	defer DeleteAllTasks(112300)
+
+	// test add
+	letter := &models.DeadLetter{
+		TaskID:      taskID,
+		ExecutionID: 112300,
+		PolicyID:    100,
+		Repository:  "library/hello-world",
+		JobID:       "jobID1",
+		Reason:      "manifest unknown",
+	}
+	id, err := AddDeadLetter(letter)
+	require.Nil(t, err)
+	// the task has the dead letter already, it's refreshed with the latest failure
+	id2, err := AddDeadLetter(&models.DeadLetter{
+		TaskID:      taskID,
+		ExecutionID: 112300,
+		PolicyID:    100,
+		Repository:  "library/hello-world",
+		JobID:       "jobID2",
+		Reason:      "unauthorized",
+		Retries:     1,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, id, id2)
+
+	// test get
+	l, err := GetDeadLetter(id)
+	require.Nil(t, err)
+	require.NotNil(t, l)
+	assert.Equal(t, "unauthorized", l.Reason)
+	assert.Equal(t, "jobID2", l.JobID)
+	assert.Equal(t, 1, l.Retries)
+
+	// test list
+	query := &models.DeadLetterQuery{
+		PolicyID:   100,
+		Repository: "library/hello-world",
+	}
+	total, err := GetTotalOfDeadLetters(query)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	letters, err := GetDeadLetters(query)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(letters))
+	assert.Equal(t, taskID, letters[0].TaskID)
+	total, err = GetTotalOfDeadLetters(&models.DeadLetterQuery{PolicyID: 101})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+
+	// test delete
+	require.Nil(t, DeleteDeadLetterOfTask(taskID))
+	l, err = GetDeadLetter(id)
+	require.Nil(t, err)
+	assert.Nil(t, l)
+}
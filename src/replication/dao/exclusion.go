@@ -0,0 +1,53 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/goharbor/harbor/src/common/dao"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+)
+
+// AddExclusion adds the exclusion of the repositories
+func AddExclusion(exclusion *models.Exclusion) (int64, error) {
+	return dao.GetOrmer().Insert(exclusion)
+}
+
+// GetExclusion ...
+func GetExclusion(id int64) (*models.Exclusion, error) {
+	exclusion := &models.Exclusion{
+		ID: id,
+	}
+	if err := dao.GetOrmer().Read(exclusion); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return exclusion, nil
+}
+
+// GetExclusions lists all the exclusions ordered by the patterns
+func GetExclusions() ([]*models.Exclusion, error) {
+	exclusions := []*models.Exclusion{}
+	_, err := dao.GetOrmer().QueryTable(new(models.Exclusion)).OrderBy("pattern").All(&exclusions)
+	return exclusions, err
+}
+
+// DeleteExclusion ...
+func DeleteExclusion(id int64) error {
+	_, err := dao.GetOrmer().Delete(&models.Exclusion{ID: id})
+	return err
+}
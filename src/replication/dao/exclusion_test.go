@@ -0,0 +1,63 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodOfExclusion(t *testing.T) {
+	// test add
+	id, err := AddExclusion(&models.Exclusion{
+		Pattern:     "secrets/**",
+		Description: "the images baked with secrets",
+	})
+	require.Nil(t, err)
+	defer DeleteExclusion(id)
+	id2, err := AddExclusion(&models.Exclusion{
+		Pattern: "internal/*",
+	})
+	require.Nil(t, err)
+	defer DeleteExclusion(id2)
+	// the pattern is duplicated
+	_, err = AddExclusion(&models.Exclusion{
+		Pattern: "secrets/**",
+	})
+	require.NotNil(t, err)
+
+	// test get
+	exclusion, err := GetExclusion(id)
+	require.Nil(t, err)
+	require.NotNil(t, exclusion)
+	assert.Equal(t, "secrets/**", exclusion.Pattern)
+	assert.Equal(t, "the images baked with secrets", exclusion.Description)
+
+	// test list
+	exclusions, err := GetExclusions()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(exclusions))
+	assert.Equal(t, "internal/*", exclusions[0].Pattern)
+	assert.Equal(t, "secrets/**", exclusions[1].Pattern)
+
+	// test delete
+	require.Nil(t, DeleteExclusion(id))
+	exclusion, err = GetExclusion(id)
+	require.Nil(t, err)
+	assert.Nil(t, exclusion)
+}
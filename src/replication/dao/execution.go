@@ -15,7 +15,9 @@
 package dao
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/astaxie/beego/orm"
@@ -24,59 +26,149 @@ import (
 	"github.com/goharbor/harbor/src/replication/dao/models"
 )
 
-// AddExecution ...
+// AddExecution adds the execution with the next sequence number of its policy. The number is allocated
+// and the execution is inserted in one transaction, the row of the policy in the sequence table is locked
+// until the transaction ends, so the concurrent executions of the same policy get the unique and sequential
+// numbers without the gap left by the failed insertion
 func AddExecution(execution *models.Execution) (int64, error) {
-	o := dao.GetOrmer()
 	now := time.Now()
 	execution.StartTime = now
+	// the annotations are stored as the JSON object, the empty one is stored if there is no annotation
+	annotations := execution.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return 0, err
+	}
+	execution.AnnotationsJSON = string(data)
+	if execution.PolicyID <= 0 {
+		return dao.GetOrmer().Insert(execution)
+	}
 
+	o := orm.NewOrm()
+	if err := o.Begin(); err != nil {
+		return 0, err
+	}
+	id, err := addExecutionWithSequence(o, execution)
+	if err != nil {
+		if e := o.Rollback(); e != nil {
+			log.Errorf("failed to rollback the transaction of adding the execution of policy %d: %v", execution.PolicyID, e)
+		}
+		return 0, err
+	}
+	if err = o.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func addExecutionWithSequence(o orm.Ormer, execution *models.Execution) (int64, error) {
+	sql := `insert into replication_execution_sequence (policy_id, sequence) values (?, 1)
+		on conflict (policy_id) do update set sequence = replication_execution_sequence.sequence + 1
+		returning sequence`
+	var sequence int64
+	if err := o.Raw(sql, execution.PolicyID).QueryRow(&sequence); err != nil {
+		return 0, fmt.Errorf("failed to allocate the sequence number of the execution of policy %d: %v", execution.PolicyID, err)
+	}
+	execution.Sequence = sequence
 	return o.Insert(execution)
 }
 
+// DeleteExecutionSequence deletes the sequence of the executions of the policy
+func DeleteExecutionSequence(policyID int64) error {
+	_, err := dao.GetOrmer().Raw(`delete from replication_execution_sequence where policy_id = ?`, policyID).Exec()
+	return err
+}
+
+// decode the annotations of the execution from the JSON stored
+func decodeAnnotations(execution *models.Execution) error {
+	if len(execution.AnnotationsJSON) == 0 || execution.AnnotationsJSON == "{}" {
+		return nil
+	}
+	return json.Unmarshal([]byte(execution.AnnotationsJSON), &execution.Annotations)
+}
+
 // GetTotalOfExecutions returns the total count of replication execution
 func GetTotalOfExecutions(query ...*models.ExecutionQuery) (int64, error) {
-	qs := executionQueryConditions(query...)
-	return qs.Count()
+	condition, params, err := executionQueryConditions(query...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	if err = dao.GetOrmer().Raw(`select count(*) `+condition, params).QueryRow(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
 }
 
 // GetExecutions ...
 func GetExecutions(query ...*models.ExecutionQuery) ([]*models.Execution, error) {
 	executions := []*models.Execution{}
 
-	qs := executionQueryConditions(query...)
+	condition, params, err := executionQueryConditions(query...)
+	if err != nil {
+		return nil, err
+	}
+	sort := ""
 	if len(query) > 0 && query[0] != nil {
-		qs = paginateForQuerySetter(qs, query[0].Page, query[0].Size)
+		sort = query[0].Sort
+	}
+	order, err := orderForRawSQL(sort, "-start_time", models.ExecutionSortableFields)
+	if err != nil {
+		return nil, err
+	}
+	sql := `select * ` + condition + order
+	if len(query) > 0 && query[0] != nil {
+		sql, params = paginateForRawSQL(sql, params, query[0].Page, query[0].Size)
 	}
 
-	qs = qs.OrderBy("-StartTime")
-
-	_, err := qs.All(&executions)
+	_, err = dao.GetOrmer().Raw(sql, params).QueryRows(&executions)
 	if err != nil || len(executions) == 0 {
 		return executions, err
 	}
 	for _, e := range executions {
 		fillExecution(e)
+		if err = decodeAnnotations(e); err != nil {
+			return nil, err
+		}
 	}
-	return executions, err
+	return executions, nil
 }
 
-func executionQueryConditions(query ...*models.ExecutionQuery) orm.QuerySeter {
-	qs := dao.GetOrmer().QueryTable(new(models.Execution))
+// executionQueryConditions returns the "from" and "where" clauses of the raw SQL querying the
+// executions and the parameters
+func executionQueryConditions(query ...*models.ExecutionQuery) (string, []interface{}, error) {
+	sql := `from replication_execution where 1=1 `
+	params := []interface{}{}
 	if len(query) == 0 || query[0] == nil {
-		return qs
+		return sql, params, nil
 	}
 
 	q := query[0]
 	if q.PolicyID != 0 {
-		qs = qs.Filter("PolicyID", q.PolicyID)
+		sql += `and policy_id = ? `
+		params = append(params, q.PolicyID)
 	}
 	if len(q.Trigger) > 0 {
-		qs = qs.Filter("Trigger", q.Trigger)
+		sql += `and "trigger" = ? `
+		params = append(params, q.Trigger)
 	}
 	if len(q.Statuses) > 0 {
-		qs = qs.Filter("Status__in", q.Statuses)
+		sql += fmt.Sprintf(`and status in (%s) `, paramPlaceholder(len(q.Statuses)))
+		params = append(params, q.Statuses)
+	}
+	if len(q.Annotations) > 0 {
+		data, err := json.Marshal(q.Annotations)
+		if err != nil {
+			return "", nil, err
+		}
+		// the containment is served by the GIN index of the annotations
+		sql += `and annotations @> ?::jsonb `
+		params = append(params, string(data))
 	}
-	return qs
+	return sql, params, nil
 }
 
 // GetExecution ...
@@ -91,12 +183,15 @@ func GetExecution(id int64) (*models.Execution, error) {
 		return nil, err
 	}
 	fillExecution(&t)
-	return &t, err
+	if err = decodeAnnotations(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 // fillExecution will fill the statistics data and status by tasks data
 func fillExecution(execution *models.Execution) error {
-	if executionFinished(execution.Status) {
+	if models.ExecutionFinished(execution.Status) {
 		return nil
 	}
 
@@ -132,10 +227,10 @@ func fillExecution(execution *models.Execution) error {
 	resetExecutionStatus(execution)
 
 	// if execution status changed to a final status, store to DB
-	if executionFinished(execution.Status) {
+	if models.ExecutionFinished(execution.Status) {
 		UpdateExecution(execution, models.ExecutionPropsName.Status, models.ExecutionPropsName.InProgress,
 			models.ExecutionPropsName.Succeed, models.ExecutionPropsName.Failed, models.ExecutionPropsName.Stopped,
-			models.ExecutionPropsName.EndTime, models.ExecutionPropsName.Total)
+			models.ExecutionPropsName.Paused, models.ExecutionPropsName.StatusText, models.ExecutionPropsName.EndTime, models.ExecutionPropsName.Total)
 	}
 	return nil
 }
@@ -150,6 +245,8 @@ func getStatus(status string) (string, error) {
 		return models.ExecutionStatusStopped, nil
 	case models.TaskStatusFailed:
 		return models.ExecutionStatusFailed, nil
+	case models.TaskStatusPaused:
+		return models.ExecutionStatusPaused, nil
 	}
 	return "", fmt.Errorf("Not support task status ")
 }
@@ -164,13 +261,18 @@ func updateStatusCount(execution *models.Execution, status string, delta int) er
 		execution.Stopped += delta
 	case models.ExecutionStatusFailed:
 		execution.Failed += delta
+	case models.ExecutionStatusPaused:
+		execution.Paused += delta
 	}
 	return nil
 }
 
 func resetExecutionStatus(execution *models.Execution) error {
 	execution.Status = generateStatus(execution)
-	if executionFinished(execution.Status) {
+	if execution.Status == models.ExecutionStatusPaused && len(execution.StatusText) == 0 {
+		execution.StatusText = "the destination registry is read-only, the paused tasks will be resumed by the next scheduled execution"
+	}
+	if models.ExecutionFinished(execution.Status) {
 		o := dao.GetOrmer()
 		sql := `select max(end_time) from replication_task where execution_id = ?`
 		queryParam := make([]interface{}, 1)
@@ -188,23 +290,27 @@ func resetExecutionStatus(execution *models.Execution) error {
 }
 
 func generateStatus(execution *models.Execution) string {
-	if execution.InProgress > 0 {
-		return models.ExecutionStatusInProgress
-	} else if execution.Failed > 0 {
-		return models.ExecutionStatusFailed
-	} else if execution.Stopped > 0 {
-		return models.ExecutionStatusStopped
-	}
-	return models.ExecutionStatusSucceed
+	return models.GenerateStatus(execution.InProgress, execution.Failed, execution.Succeed,
+		execution.Paused, execution.Stopped)
 }
 
-func executionFinished(status string) bool {
-	if status == models.ExecutionStatusStopped ||
-		status == models.ExecutionStatusSucceed ||
-		status == models.ExecutionStatusFailed {
-		return true
+// MarkExecutionRecorded marks the finished execution as recorded in the consecutive failures of its policy,
+// true is returned only if the execution is marked by this call, so that only one of the concurrent callers
+// records the execution. Nothing is marked if the execution isn't finished
+func MarkExecutionRecorded(id int64) (bool, error) {
+	statuses := []string{models.ExecutionStatusSucceed, models.ExecutionStatusFailed, models.ExecutionStatusPartialSucceed,
+		models.ExecutionStatusStopped, models.ExecutionStatusPaused}
+	result, err := dao.GetOrmer().Raw(fmt.Sprintf(`update replication_execution set policy_recorded = true
+		where id = ? and policy_recorded = false and status in (%s)`, paramPlaceholder(len(statuses))),
+		id, statuses).Exec()
+	if err != nil {
+		return false, err
 	}
-	return false
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
 }
 
 // DeleteExecution ...
@@ -221,6 +327,63 @@ func DeleteAllExecutions(policyID int64) error {
 	return err
 }
 
+// DeleteExpiredExecutions deletes the finished executions, together with their tasks, of the policies
+// replicating from or to the registry which ended before the specified time. The executions without
+// policy, e.g. the single replications, are deleted by the destination registry of their tasks. The
+// paused executions are deleted as well, their tasks are never resumed and the images are replicated
+// by the next executions of the policies instead. The count of deleted executions is returned
+func DeleteExpiredExecutions(registryID int64, before time.Time) (int64, error) {
+	o := dao.GetOrmer()
+	var policyIDs orm.ParamsList
+	cond := orm.NewCondition().Or("SrcRegistryID", registryID).Or("DestRegistryID", registryID)
+	if _, err := o.QueryTable(new(models.RepPolicy)).SetCond(cond).ValuesFlat(&policyIDs, "ID"); err != nil {
+		return 0, err
+	}
+	var executionIDs orm.ParamsList
+	if _, err := o.Raw(`select distinct e.id from replication_execution e
+		join replication_task t on t.execution_id = e.id
+		where e.policy_id = 0 and t.dst_registry_id = ? and e.start_time < ?`,
+		registryID, before).ValuesFlat(&executionIDs); err != nil {
+		return 0, err
+	}
+	if len(policyIDs) == 0 && len(executionIDs) == 0 {
+		return 0, nil
+	}
+
+	// the execution ends after it starts, so only the ones started before the time are candidates
+	cond = orm.NewCondition()
+	if len(policyIDs) > 0 {
+		cond = cond.Or("PolicyID__in", policyIDs)
+	}
+	if len(executionIDs) > 0 {
+		cond = cond.Or("ID__in", executionIDs)
+	}
+	executions := []*models.Execution{}
+	if _, err := o.QueryTable(new(models.Execution)).SetCond(cond).
+		Filter("StartTime__lt", before).All(&executions); err != nil {
+		return 0, err
+	}
+	ids := []int64{}
+	for _, e := range executions {
+		// the status stored may be out of date, refresh it by the tasks
+		if err := fillExecution(e); err != nil {
+			return 0, err
+		}
+		if !models.ExecutionFinished(e.Status) || !e.EndTime.Before(before) {
+			continue
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := o.QueryTable(new(models.Task)).Filter("ExecutionID__in", ids).Delete(); err != nil {
+		return 0, err
+	}
+	return o.QueryTable(new(models.Execution)).Filter("ID__in", ids).Delete()
+}
+
 // UpdateExecution ...
 func UpdateExecution(execution *models.Execution, props ...string) (int64, error) {
 	if execution.ID == 0 {
@@ -258,47 +421,131 @@ func GetTask(id int64) (*models.Task, error) {
 
 // GetTotalOfTasks ...
 func GetTotalOfTasks(query ...*models.TaskQuery) (int64, error) {
-	qs := taskQueryConditions(query...)
-	return qs.Count()
+	condition, params, err := taskQueryConditions(query...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	if err = dao.GetOrmer().Raw(`select count(*) `+condition, params).QueryRow(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
 }
 
 // GetTasks ...
 func GetTasks(query ...*models.TaskQuery) ([]*models.Task, error) {
 	tasks := []*models.Task{}
 
-	qs := taskQueryConditions(query...)
+	condition, params, err := taskQueryConditions(query...)
+	if err != nil {
+		return nil, err
+	}
+	sort := ""
 	if len(query) > 0 && query[0] != nil {
-		qs = paginateForQuerySetter(qs, query[0].Page, query[0].Size)
+		sort = query[0].Sort
+	}
+	order, err := orderForRawSQL(sort, "-start_time", models.TaskSortableFields)
+	if err != nil {
+		return nil, err
+	}
+	sql := `select * ` + condition + order
+	if len(query) > 0 && query[0] != nil {
+		sql, params = paginateForRawSQL(sql, params, query[0].Page, query[0].Size)
 	}
 
-	qs = qs.OrderBy("-StartTime")
-
-	_, err := qs.All(&tasks)
+	_, err = dao.GetOrmer().Raw(sql, params).QueryRows(&tasks)
 	return tasks, err
 }
 
-func taskQueryConditions(query ...*models.TaskQuery) orm.QuerySeter {
-	qs := dao.GetOrmer().QueryTable(new(models.Task))
+// taskQueryConditions returns the "from" and "where" clauses of the raw SQL querying the tasks and
+// the parameters, all the conditions are applied in the same query as the matched tasks may be many
+func taskQueryConditions(query ...*models.TaskQuery) (string, []interface{}, error) {
+	sql := `from replication_task where 1=1 `
+	params := []interface{}{}
 	if len(query) == 0 || query[0] == nil {
-		return qs
+		return sql, params, nil
 	}
 
 	q := query[0]
 	if q.ExecutionID != 0 {
-		qs = qs.Filter("ExecutionID", q.ExecutionID)
+		sql += `and execution_id = ? `
+		params = append(params, q.ExecutionID)
 	}
 	if len(q.JobID) > 0 {
-		qs = qs.Filter("JobID", q.JobID)
+		sql += `and job_id = ? `
+		params = append(params, q.JobID)
 	}
 	if len(q.ResourceType) > 0 {
-		qs = qs.Filter("ResourceType", q.ResourceType)
+		sql += `and resource_type = ? `
+		params = append(params, q.ResourceType)
+	}
+	if len(q.InflightKey) > 0 {
+		sql += `and inflight_key = ? `
+		params = append(params, q.InflightKey)
+	}
+	if q.DeferredRegistryID != 0 {
+		sql += `and deferred_registry_id = ? `
+		params = append(params, q.DeferredRegistryID)
 	}
 	if len(q.Statuses) > 0 {
-		qs = qs.Filter("Status__in", q.Statuses)
+		sql += fmt.Sprintf(`and status in (%s) `, paramPlaceholder(len(q.Statuses)))
+		params = append(params, q.Statuses)
+	}
+	if q.EndTimeFrom != nil {
+		sql += `and end_time >= ? `
+		params = append(params, q.EndTimeFrom)
+	}
+	if q.EndTimeTo != nil {
+		sql += `and end_time <= ? `
+		params = append(params, q.EndTimeTo)
+	}
+	if q.StartTimeFrom != nil {
+		sql += `and start_time >= ? `
+		params = append(params, q.StartTimeFrom)
+	}
+	if q.StartTimeTo != nil {
+		sql += `and start_time <= ? `
+		params = append(params, q.StartTimeTo)
+	}
+	if len(q.Repository) > 0 {
+		switch q.RepositoryMatch {
+		case "", models.RepositoryMatchExact:
+			sql += `and repository = ? `
+			params = append(params, q.Repository)
+		case models.RepositoryMatchPrefix:
+			sql += `and repository like ? escape '\' `
+			params = append(params, escapeLike(q.Repository)+"%")
+		default:
+			return "", nil, fmt.Errorf("invalid repository match mode %s", q.RepositoryMatch)
+		}
+	}
+	if q.PolicyID != 0 {
+		// the task doesn't refer to the policy directly, filter it by the executions of the policy
+		sql += `and execution_id in (select id from replication_execution where policy_id = ?) `
+		params = append(params, q.PolicyID)
 	}
-	return qs
+	if q.DestRegistryID != 0 {
+		sql += `and dst_registry_id = ? `
+		params = append(params, q.DestRegistryID)
+	}
+	if q.IDFrom != 0 {
+		sql += `and id > ? `
+		params = append(params, q.IDFrom)
+	}
+	if q.UpdateTimeFrom != nil {
+		sql += `and update_time >= ? `
+		params = append(params, q.UpdateTimeFrom)
+	}
+	return sql, params, nil
 }
 
+// escapeLike escapes the wildcards and the escape character in the pattern of "like"
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // DeleteTask ...
 func DeleteTask(id int64) error {
 	o := dao.GetOrmer()
@@ -345,7 +592,8 @@ func UpdateTaskStatus(id int64, status string, statusCondition ...string) (int64
 }
 
 func taskFinished(status string) bool {
-	if status == models.TaskStatusFailed || status == models.TaskStatusStopped || status == models.TaskStatusSucceed {
+	if status == models.TaskStatusFailed || status == models.TaskStatusStopped || status == models.TaskStatusSucceed ||
+		status == models.TaskStatusPaused {
 		return true
 	}
 	return false
@@ -1,6 +1,8 @@
 package dao
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -58,6 +60,33 @@ func TestMethodOfExecution(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, int64(2), total)
 
+	// test sort
+	query.Sort = "status"
+	executions, err = GetExecutions(query)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(executions))
+	assert.Equal(t, "Failed", executions[0].Status)
+	assert.Equal(t, "InProgress", executions[1].Status)
+
+	query.Sort = "-status"
+	executions, err = GetExecutions(query)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(executions))
+	assert.Equal(t, "InProgress", executions[0].Status)
+	assert.Equal(t, "Failed", executions[1].Status)
+
+	// the newest one is the first by default
+	query.Sort = ""
+	executions, err = GetExecutions(query)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(executions))
+	assert.Equal(t, "Failed", executions[0].Status)
+
+	query.Sort = "unknown"
+	_, err = GetExecutions(query)
+	assert.NotNil(t, err)
+	query.Sort = ""
+
 	// test get
 	execution, err := GetExecution(id1)
 	require.Nil(t, err)
@@ -287,3 +316,636 @@ func TestExecutionFill2(t *testing.T) {
 	assert.Equal(t, 1, exes[0].Failed)
 	assert.Equal(t, 0, exes[0].Succeed)
 }
+
+func TestGetTasksByEndTime(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-2 * time.Hour)
+	tasks := []*models.Task{
+		{
+			ExecutionID: 112300,
+			JobID:       "jobID1",
+			Status:      models.TaskStatusFailed,
+			EndTime:     &before,
+		},
+		{
+			ExecutionID: 112300,
+			JobID:       "jobID2",
+			Status:      models.TaskStatusFailed,
+			EndTime:     &now,
+		},
+		{
+			ExecutionID: 112300,
+			JobID:       "jobID3",
+			Status:      models.TaskStatusSucceed,
+			EndTime:     &now,
+		},
+	}
+	for _, task := range tasks {
+		_, err := AddTask(task)
+		require.Nil(t, err)
+	}
+	defer DeleteAllTasks(112300)
+
+	since := now.Add(-1 * time.Hour)
+	ts, err := GetTasks(&models.TaskQuery{
+		ExecutionID: 112300,
+		Statuses:    []string{models.TaskStatusFailed},
+		EndTimeFrom: &since,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ts))
+	assert.Equal(t, "jobID2", ts[0].JobID)
+
+	until := now.Add(-1 * time.Hour)
+	ts, err = GetTasks(&models.TaskQuery{
+		ExecutionID: 112300,
+		Statuses:    []string{models.TaskStatusFailed},
+		EndTimeTo:   &until,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ts))
+	assert.Equal(t, "jobID1", ts[0].JobID)
+}
+
+func TestGetTasksByRepository(t *testing.T) {
+	execution1, err := AddExecution(&models.Execution{
+		PolicyID:  112400,
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(execution1)
+	execution2, err := AddExecution(&models.Execution{
+		PolicyID:  112401,
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(execution2)
+
+	tasks := []*models.Task{
+		{
+			ExecutionID: execution1,
+			JobID:       "jobID1",
+			Status:      models.TaskStatusFailed,
+			Repository:  "library/hello-world",
+		},
+		{
+			ExecutionID: execution1,
+			JobID:       "jobID2",
+			Status:      models.TaskStatusSucceed,
+			Repository:  "library/hello-world-2",
+		},
+		{
+			ExecutionID: execution2,
+			JobID:       "jobID3",
+			Status:      models.TaskStatusFailed,
+			Repository:  "library/hello-world",
+		},
+		{
+			ExecutionID: execution2,
+			JobID:       "jobID4",
+			Status:      models.TaskStatusSucceed,
+			Repository:  "library/hello_world",
+		},
+	}
+	for _, task := range tasks {
+		_, err := AddTask(task)
+		require.Nil(t, err)
+	}
+	defer DeleteAllTasks(execution1)
+	defer DeleteAllTasks(execution2)
+
+	// exact match
+	ts, err := GetTasks(&models.TaskQuery{
+		Repository: "library/hello-world",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(ts))
+
+	// prefix match
+	ts, err = GetTasks(&models.TaskQuery{
+		Repository:      "library/hello",
+		RepositoryMatch: models.RepositoryMatchPrefix,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 4, len(ts))
+
+	// prefix match, the underscore isn't a wildcard
+	ts, err = GetTasks(&models.TaskQuery{
+		Repository:      "library/hello_",
+		RepositoryMatch: models.RepositoryMatchPrefix,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ts))
+	assert.Equal(t, "jobID4", ts[0].JobID)
+
+	// prefix match AND policy
+	ts, err = GetTasks(&models.TaskQuery{
+		PolicyID:        112400,
+		Repository:      "library/hello",
+		RepositoryMatch: models.RepositoryMatchPrefix,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(ts))
+
+	// prefix match AND policy AND status
+	ts, err = GetTasks(&models.TaskQuery{
+		PolicyID:        112400,
+		Statuses:        []string{models.TaskStatusFailed},
+		Repository:      "library/hello",
+		RepositoryMatch: models.RepositoryMatchPrefix,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ts))
+	assert.Equal(t, "jobID1", ts[0].JobID)
+
+	// exact match AND policy without executions
+	total, err := GetTotalOfTasks(&models.TaskQuery{
+		PolicyID:   112402,
+		Repository: "library/hello-world",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+
+	// invalid match mode
+	_, err = GetTasks(&models.TaskQuery{
+		Repository:      "library/hello-world",
+		RepositoryMatch: "suffix",
+	})
+	assert.NotNil(t, err)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "library/hello-world", escapeLike("library/hello-world"))
+	assert.Equal(t, `library/hello\_world\%\\`, escapeLike(`library/hello_world%\`))
+}
+
+func TestMarkExecutionRecorded(t *testing.T) {
+	id, err := AddExecution(&models.Execution{
+		Status: models.ExecutionStatusInProgress,
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(id)
+
+	// the running execution isn't marked
+	marked, err := MarkExecutionRecorded(id)
+	require.Nil(t, err)
+	assert.False(t, marked)
+
+	_, err = UpdateExecution(&models.Execution{
+		ID:     id,
+		Status: models.ExecutionStatusFailed,
+	}, models.ExecutionPropsName.Status)
+	require.Nil(t, err)
+
+	// only one of the concurrent callers marks the finished execution
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	count := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			marked, err := MarkExecutionRecorded(id)
+			require.Nil(t, err)
+			if marked {
+				lock.Lock()
+				count++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, count)
+}
+
+func TestOrderForRawSQL(t *testing.T) {
+	order, err := orderForRawSQL("", "-start_time", models.TaskSortableFields)
+	require.Nil(t, err)
+	assert.Equal(t, "order by start_time desc, id desc ", order)
+
+	order, err = orderForRawSQL("+id", "-start_time", models.TaskSortableFields)
+	require.Nil(t, err)
+	assert.Equal(t, "order by id asc ", order)
+
+	_, err = orderForRawSQL("src_resource", "-start_time", models.TaskSortableFields)
+	assert.NotNil(t, err)
+}
+
+func TestGetTasksByInflightKey(t *testing.T) {
+	executionID, err := AddExecution(&models.Execution{
+		PolicyID:  112402,
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(executionID)
+	defer DeleteAllTasks(executionID)
+
+	for i, key := range []string{"key1", "key2", ""} {
+		_, err := AddTask(&models.Task{
+			ExecutionID: executionID,
+			JobID:       fmt.Sprintf("jobID%d", i),
+			Status:      models.TaskStatusPending,
+			InflightKey: key,
+		})
+		require.Nil(t, err)
+	}
+
+	ts, err := GetTasks(&models.TaskQuery{
+		InflightKey: "key1",
+		Statuses:    []string{models.TaskStatusPending},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ts))
+	assert.Equal(t, "jobID0", ts[0].JobID)
+
+	ts, err = GetTasks(&models.TaskQuery{
+		InflightKey: "key1",
+		Statuses:    []string{models.TaskStatusInProgress},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(ts))
+}
+
+func TestGetTasksByStartTime(t *testing.T) {
+	execution, err := AddExecution(&models.Execution{
+		PolicyID:  112500,
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(execution)
+
+	now := time.Now()
+	yesterday := now.Add(-24 * time.Hour)
+	for _, start := range []time.Time{yesterday, now} {
+		start := start
+		_, err := AddTask(&models.Task{
+			ExecutionID: execution,
+			Status:      models.TaskStatusSucceed,
+			StartTime:   &start,
+		})
+		require.Nil(t, err)
+	}
+	defer DeleteAllTasks(execution)
+
+	from := now.Add(-time.Hour)
+	total, err := GetTotalOfTasks(&models.TaskQuery{
+		ExecutionID:   execution,
+		StartTimeFrom: &from,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+
+	total, err = GetTotalOfTasks(&models.TaskQuery{
+		ExecutionID: execution,
+		StartTimeTo: &from,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// no task replicates to the registry
+	total, err = GetTotalOfTasks(&models.TaskQuery{
+		ExecutionID:    execution,
+		DestRegistryID: 112500,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func TestGetTasksByDestRegistryAndIDFrom(t *testing.T) {
+	// the single-tag execution has no policy, its tasks are filtered by their own destination registry
+	execution, err := AddExecution(&models.Execution{
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(execution)
+	defer DeleteAllTasks(execution)
+
+	ids := []int64{}
+	for _, registryID := range []int64{112600, 112600, 112601} {
+		id, err := AddTask(&models.Task{
+			ExecutionID:   execution,
+			Status:        models.TaskStatusSucceed,
+			DstRegistryID: registryID,
+		})
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+
+	tasks, err := GetTasks(&models.TaskQuery{
+		ExecutionID:    execution,
+		DestRegistryID: 112600,
+		Sorting:        models.Sorting{Sort: "id"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tasks))
+	assert.Equal(t, ids[0], tasks[0].ID)
+	assert.Equal(t, ids[1], tasks[1].ID)
+
+	// list the tasks after the first one
+	tasks, err = GetTasks(&models.TaskQuery{
+		ExecutionID: execution,
+		IDFrom:      ids[0],
+		Pagination:  models.Pagination{Size: 1},
+		Sorting:     models.Sorting{Sort: "id"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(tasks))
+	assert.Equal(t, ids[1], tasks[0].ID)
+}
+
+func TestGetTasksByUpdateTime(t *testing.T) {
+	execution, err := AddExecution(&models.Execution{
+		Status:    models.ExecutionStatusInProgress,
+		StartTime: time.Now(),
+	})
+	require.Nil(t, err)
+	defer DeleteExecution(execution)
+	defer DeleteAllTasks(execution)
+
+	id, err := AddTask(&models.Task{
+		ExecutionID: execution,
+		Status:      models.TaskStatusInitialized,
+	})
+	require.Nil(t, err)
+	_, err = UpdateTaskStatus(id, models.TaskStatusInProgress)
+	require.Nil(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	total, err := GetTotalOfTasks(&models.TaskQuery{
+		ExecutionID:    execution,
+		UpdateTimeFrom: &past,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+
+	future := time.Now().Add(time.Hour)
+	total, err = GetTotalOfTasks(&models.TaskQuery{
+		ExecutionID:    execution,
+		UpdateTimeFrom: &future,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func TestGenerateStatus(t *testing.T) {
+	cases := []struct {
+		execution *models.Execution
+		status    string
+	}{
+		{
+			execution: &models.Execution{InProgress: 1, Failed: 1, Succeed: 1},
+			status:    models.ExecutionStatusInProgress,
+		},
+		{
+			execution: &models.Execution{Failed: 2},
+			status:    models.ExecutionStatusFailed,
+		},
+		{
+			execution: &models.Execution{Failed: 2, Succeed: 98},
+			status:    models.ExecutionStatusPartialSucceed,
+		},
+		{
+			execution: &models.Execution{Paused: 1, Succeed: 1},
+			status:    models.ExecutionStatusPaused,
+		},
+		{
+			execution: &models.Execution{Stopped: 1, Succeed: 1},
+			status:    models.ExecutionStatusStopped,
+		},
+		{
+			execution: &models.Execution{Succeed: 1},
+			status:    models.ExecutionStatusSucceed,
+		},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.status, generateStatus(c.execution))
+	}
+}
+
+func TestDeleteExpiredExecutions(t *testing.T) {
+	policyID, err := AddRepPolicy(&models.RepPolicy{
+		Name:           "policy for expired executions",
+		SrcRegistryID:  11470,
+		DestRegistryID: 11471,
+		Trigger:        "{\"type\":\"\",\"trigger_settings\":null}",
+	})
+	require.Nil(t, err)
+	defer DeleteRepPolicy(policyID)
+	defer DeleteAllExecutions(policyID)
+
+	now := time.Now()
+	add := func(status, taskStatus string, start, end time.Time) int64 {
+		execution := &models.Execution{
+			PolicyID: policyID,
+			Status:   status,
+			Trigger:  "Manual",
+		}
+		id, err := AddExecution(execution)
+		require.Nil(t, err)
+		// the start time is set to now when adding the execution
+		execution.StartTime = start
+		execution.EndTime = end
+		_, err = UpdateExecution(execution, models.ExecutionPropsName.StartTime, models.ExecutionPropsName.EndTime)
+		require.Nil(t, err)
+		_, err = AddTask(&models.Task{
+			ExecutionID: id,
+			Status:      taskStatus,
+		})
+		require.Nil(t, err)
+		return id
+	}
+	expired := add(models.ExecutionStatusSucceed, models.TaskStatusSucceed, now.AddDate(0, 0, -10), now.AddDate(0, 0, -9))
+	recent := add(models.ExecutionStatusFailed, models.TaskStatusFailed, now.AddDate(0, 0, -2), now.AddDate(0, 0, -1))
+	// the paused tasks are never resumed, so the paused execution expires as well
+	paused := add(models.ExecutionStatusPaused, models.TaskStatusPaused, now.AddDate(0, 0, -10), now.AddDate(0, 0, -9))
+	defer func() {
+		for _, id := range []int64{expired, recent, paused} {
+			DeleteAllTasks(id)
+		}
+	}()
+
+	// the registry has no policy
+	n, err := DeleteExpiredExecutions(11472, now.AddDate(0, 0, -7))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = DeleteExpiredExecutions(11471, now.AddDate(0, 0, -7))
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	for _, id := range []int64{expired, paused} {
+		e, err := GetExecution(id)
+		require.Nil(t, err)
+		assert.Nil(t, e)
+		total, err := GetTotalOfTasks(&models.TaskQuery{ExecutionID: id})
+		require.Nil(t, err)
+		assert.Equal(t, int64(0), total)
+	}
+	e, err := GetExecution(recent)
+	require.Nil(t, err)
+	assert.NotNil(t, e)
+	total, err := GetTotalOfTasks(&models.TaskQuery{ExecutionID: recent})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// the execution without policy is deleted by the destination registry of its tasks
+	single := &models.Execution{
+		Status:  models.ExecutionStatusSucceed,
+		Trigger: "Manual",
+	}
+	singleID, err := AddExecution(single)
+	require.Nil(t, err)
+	defer DeleteExecution(singleID)
+	single.StartTime = now.AddDate(0, 0, -10)
+	single.EndTime = now.AddDate(0, 0, -9)
+	_, err = UpdateExecution(single, models.ExecutionPropsName.StartTime, models.ExecutionPropsName.EndTime)
+	require.Nil(t, err)
+	_, err = AddTask(&models.Task{
+		ExecutionID:   singleID,
+		Status:        models.TaskStatusSucceed,
+		DstRegistryID: 11473,
+	})
+	require.Nil(t, err)
+	defer DeleteAllTasks(singleID)
+
+	n, err = DeleteExpiredExecutions(11472, now.AddDate(0, 0, -7))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = DeleteExpiredExecutions(11473, now.AddDate(0, 0, -7))
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	e, err = GetExecution(singleID)
+	require.Nil(t, err)
+	assert.Nil(t, e)
+}
+
+func TestExecutionAnnotations(t *testing.T) {
+	policyID := int64(11480)
+	defer DeleteAllExecutions(policyID)
+
+	annotations := []map[string]string{
+		{"ticket": "OPS-1", "env": "prod"},
+		{"ticket": "OPS-2", "env": "prod"},
+		nil,
+	}
+	ids := []int64{}
+	for _, a := range annotations {
+		id, err := AddExecution(&models.Execution{
+			PolicyID:    policyID,
+			Status:      models.ExecutionStatusSucceed,
+			Trigger:     "Manual",
+			Annotations: a,
+		})
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+
+	e, err := GetExecution(ids[0])
+	require.Nil(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, annotations[0], e.Annotations)
+	e, err = GetExecution(ids[2])
+	require.Nil(t, err)
+	require.NotNil(t, e)
+	assert.Nil(t, e.Annotations)
+
+	cases := []struct {
+		annotations map[string]string
+		ids         []int64
+	}{
+		{annotations: map[string]string{"env": "prod"}, ids: []int64{ids[0], ids[1]}},
+		{annotations: map[string]string{"env": "prod", "ticket": "OPS-2"}, ids: []int64{ids[1]}},
+		{annotations: map[string]string{"ticket": "OPS"}, ids: []int64{}},
+		{annotations: map[string]string{"env": "dev"}, ids: []int64{}},
+	}
+	for _, c := range cases {
+		query := &models.ExecutionQuery{
+			PolicyID:    policyID,
+			Annotations: c.annotations,
+		}
+		total, err := GetTotalOfExecutions(query)
+		require.Nil(t, err)
+		assert.Equal(t, int64(len(c.ids)), total)
+		executions, err := GetExecutions(query)
+		require.Nil(t, err)
+		result := []int64{}
+		for _, execution := range executions {
+			result = append(result, execution.ID)
+			assert.Equal(t, c.annotations["env"], execution.Annotations["env"])
+		}
+		assert.ElementsMatch(t, c.ids, result)
+	}
+}
+
+func TestExecutionSequence(t *testing.T) {
+	policyID := int64(11520)
+	defer DeleteExecutionSequence(policyID)
+	defer DeleteAllExecutions(policyID)
+
+	// the executions added concurrently get the unique and sequential numbers
+	count := 20
+	ids := make(chan int64, count)
+	errs := make(chan error, count)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := AddExecution(&models.Execution{
+				PolicyID: policyID,
+				Status:   models.ExecutionStatusInProgress,
+				Trigger:  "Manual",
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+
+	sequences := map[int64]int64{}
+	for id := range ids {
+		e, err := GetExecution(id)
+		require.Nil(t, err)
+		require.NotNil(t, e)
+		sequences[e.Sequence] = id
+	}
+	require.Equal(t, count, len(sequences))
+	for i := int64(1); i <= int64(count); i++ {
+		id, exist := sequences[i]
+		require.True(t, exist, "the sequence number %d is missing", i)
+		// the later numbers are allocated to the later executions
+		if i > 1 {
+			assert.True(t, id > sequences[i-1])
+		}
+	}
+
+	// the executions of the other policy are numbered separately
+	otherPolicyID := int64(11521)
+	defer DeleteExecutionSequence(otherPolicyID)
+	defer DeleteAllExecutions(otherPolicyID)
+	execution := &models.Execution{
+		PolicyID: otherPolicyID,
+		Status:   models.ExecutionStatusInProgress,
+		Trigger:  "Manual",
+	}
+	id, err := AddExecution(execution)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), execution.Sequence)
+	e, err := GetExecution(id)
+	require.Nil(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, int64(1), e.Sequence)
+}
@@ -1,16 +1,24 @@
 package models
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/astaxie/beego/orm"
 )
 
 func init() {
 	orm.RegisterModel(
 		new(Registry),
+		new(RegistryHealthCheck),
+		new(RegistryCircuitBreaker),
+		new(RegistryLabel),
 		new(RepPolicy),
 		new(Execution),
 		new(Task),
-		new(ScheduleJob))
+		new(ScheduleJob),
+		new(DeadLetter),
+		new(Exclusion))
 }
 
 // Pagination ...
@@ -18,3 +26,31 @@ type Pagination struct {
 	Page int64
 	Size int64
 }
+
+// Sorting ...
+type Sorting struct {
+	Sort string // in format [+-]?<FIELD_NAME>, e.g. 'start_time', '-start_time'
+}
+
+// ParseSort parses the sort string in format [+-]?<FIELD_NAME> with the sortable fields
+// which map the field names to the properties of model, and returns the expression
+// that can be used in "OrderBy" of the query setter, e.g. "-StartTime"
+func ParseSort(sort string, sortable map[string]string) (string, error) {
+	desc := false
+	field := sort
+	if strings.HasPrefix(sort, "-") {
+		desc = true
+		field = sort[1:]
+	} else if strings.HasPrefix(sort, "+") {
+		field = sort[1:]
+	}
+
+	prop, exist := sortable[field]
+	if !exist {
+		return "", fmt.Errorf("unsupported sort key %s", sort)
+	}
+	if desc {
+		return "-" + prop, nil
+	}
+	return prop, nil
+}
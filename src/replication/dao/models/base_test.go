@@ -0,0 +1,64 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	cases := []struct {
+		sort     string
+		sortable map[string]string
+		err      bool
+		expected string
+	}{
+		{"id", ExecutionSortableFields, false, "ID"},
+		{"-id", ExecutionSortableFields, false, "-ID"},
+		{"status", ExecutionSortableFields, false, "Status"},
+		{"+status", ExecutionSortableFields, false, "Status"},
+		{"-status", ExecutionSortableFields, false, "-Status"},
+		{"trigger", ExecutionSortableFields, false, "Trigger"},
+		{"start_time", ExecutionSortableFields, false, "StartTime"},
+		{"-start_time", ExecutionSortableFields, false, "-StartTime"},
+		{"end_time", ExecutionSortableFields, false, "EndTime"},
+		{"-end_time", ExecutionSortableFields, false, "-EndTime"},
+		{"id", TaskSortableFields, false, "ID"},
+		{"-status", TaskSortableFields, false, "-Status"},
+		{"resource_type", TaskSortableFields, false, "ResourceType"},
+		{"start_time", TaskSortableFields, false, "StartTime"},
+		{"-end_time", TaskSortableFields, false, "-EndTime"},
+		// unknown keys
+		{"", ExecutionSortableFields, true, ""},
+		{"-", ExecutionSortableFields, true, ""},
+		{"policy_id", ExecutionSortableFields, true, ""},
+		{"resource_type", ExecutionSortableFields, true, ""},
+		{"StartTime", ExecutionSortableFields, true, ""},
+		{"start_time;drop table replication_task", TaskSortableFields, true, ""},
+		{"--start_time", TaskSortableFields, true, ""},
+	}
+	for _, c := range cases {
+		order, err := ParseSort(c.sort, c.sortable)
+		if c.err {
+			assert.NotNil(t, err, c.sort)
+			continue
+		}
+		require.Nil(t, err, c.sort)
+		assert.Equal(t, c.expected, order, c.sort)
+	}
+}
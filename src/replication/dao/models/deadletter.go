@@ -0,0 +1,50 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "time"
+
+// DeadLetterTable is the table name for the dead letters of replication tasks
+const DeadLetterTable = "replication_deadletter"
+
+// DeadLetter records the replication task which fails permanently, i.e. its job fails after
+// all the retries of the jobservice, with the last error of it. The dead letter is removed once
+// the task is requeued
+type DeadLetter struct {
+	ID          int64  `orm:"pk;auto;column(id)" json:"id"`
+	TaskID      int64  `orm:"column(task_id)" json:"task_id"`
+	ExecutionID int64  `orm:"column(execution_id)" json:"execution_id"`
+	PolicyID    int64  `orm:"column(policy_id)" json:"policy_id"`
+	Repository  string `orm:"column(repository)" json:"repository"`
+	SrcResource string `orm:"column(src_resource)" json:"src_resource"`
+	DstResource string `orm:"column(dst_resource)" json:"dst_resource"`
+	JobID       string `orm:"column(job_id)" json:"job_id"`
+	// the last error of the task
+	Reason       string    `orm:"column(reason)" json:"reason"`
+	Retries      int       `orm:"column(retries)" json:"retries"`
+	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+}
+
+// TableName is required by by beego orm to map DeadLetter to table replication_deadletter
+func (d *DeadLetter) TableName() string {
+	return DeadLetterTable
+}
+
+// DeadLetterQuery holds the query conditions for the dead letters
+type DeadLetterQuery struct {
+	PolicyID   int64
+	Repository string
+	Pagination
+}
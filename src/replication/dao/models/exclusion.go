@@ -0,0 +1,35 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "time"
+
+// ExclusionTable is the table name for the repositories excluded from replication globally
+const ExclusionTable = "replication_exclusion"
+
+// Exclusion is the pattern of the repositories which are never replicated whatever the policy is,
+// e.g. the images baked with secrets. The pattern is matched in the same way as the name filter
+// of the policy
+type Exclusion struct {
+	ID           int64     `orm:"pk;auto;column(id)" json:"id"`
+	Pattern      string    `orm:"column(pattern)" json:"pattern"`
+	Description  string    `orm:"column(description)" json:"description"`
+	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+}
+
+// TableName is required by by beego orm to map Exclusion to table replication_exclusion
+func (e *Exclusion) TableName() string {
+	return ExclusionTable
+}
@@ -19,6 +19,10 @@ const (
 	ExecutionStatusSucceed    string = "Succeed"
 	ExecutionStatusStopped    string = "Stopped"
 	ExecutionStatusInProgress string = "InProgress"
+	// The execution is paused as the destination registry is read-only
+	ExecutionStatusPaused string = "Paused"
+	// Some tasks of the execution are failed and the others are succeed
+	ExecutionStatusPartialSucceed string = "PartialSucceed"
 
 	ExecutionTriggerManual   string = "Manual"
 	ExecutionTriggerEvent    string = "Event"
@@ -31,6 +35,8 @@ const (
 	TaskStatusSucceed     string = "Succeed"
 	TaskStatusFailed      string = "Failed"
 	TaskStatusStopped     string = "Stopped"
+	// The task is paused as the destination registry is read-only
+	TaskStatusPaused string = "Paused"
 )
 
 // ExecutionPropsName defines the names of fields of Execution
@@ -44,6 +50,7 @@ var ExecutionPropsName = ExecutionFieldsName{
 	Succeed:    "Succeed",
 	InProgress: "InProgress",
 	Stopped:    "Stopped",
+	Paused:     "Paused",
 	Trigger:    "Trigger",
 	StartTime:  "StartTime",
 	EndTime:    "EndTime",
@@ -60,6 +67,7 @@ type ExecutionFieldsName struct {
 	Succeed    string
 	InProgress string
 	Stopped    string
+	Paused     string
 	Trigger    string
 	StartTime  string
 	EndTime    string
@@ -76,35 +84,91 @@ type Execution struct {
 	Succeed    int               `orm:"column(succeed)" json:"succeed"`
 	InProgress int               `orm:"column(in_progress)" json:"in_progress"`
 	Stopped    int               `orm:"column(stopped)" json:"stopped"`
+	Paused     int               `orm:"column(paused)" json:"paused"`
 	Trigger    model.TriggerType `orm:"column(trigger)" json:"trigger"`
 	StartTime  time.Time         `orm:"column(start_time)" json:"start_time"`
 	EndTime    time.Time         `orm:"column(end_time)" json:"end_time"`
+	// whether the execution only checks the blobs and validates the manifests without pushing anything
+	DryRun bool `orm:"column(dry_run)" json:"dry_run"`
+	// the failed tasks of the execution, it's only populated when getting the single execution
+	Failures []*TaskFailure `orm:"-" json:"failures,omitempty"`
+	// the results of the tasks grouped by the names of their destination registries, it's only
+	// populated when getting the single execution
+	Targets map[string]*TargetResult `orm:"-" json:"targets,omitempty"`
+	// the arbitrary metadata attached to the execution, e.g. the trigger source or the ticket ID
+	Annotations map[string]string `orm:"-" json:"annotations,omitempty"`
+	// the JSON object of the annotations
+	AnnotationsJSON string `orm:"column(annotations)" json:"-"`
+	// the ID of the execution whose failed repositories are retried by this one
+	ParentID int64 `orm:"column(parent_id)" json:"parent_id,omitempty"`
+	// the number of the execution among the ones of the policy starting from 1, e.g. "run #42 of the policy",
+	// it's allocated when the execution is added
+	Sequence int64 `orm:"column(sequence)" json:"sequence"`
+}
+
+// TaskFailure describes the failed task of the execution and why it failed
+type TaskFailure struct {
+	TaskID      int64  `json:"task_id"`
+	Repository  string `json:"repository"`
+	SrcResource string `json:"src_resource"`
+	DstResource string `json:"dst_resource"`
+	Reason      string `json:"reason"`
 }
 
 // TaskPropsName defines the names of fields of Task
 var TaskPropsName = TaskFieldsName{
-	ID:           "ID",
-	ExecutionID:  "ExecutionID",
-	ResourceType: "ResourceType",
-	SrcResource:  "SrcResource",
-	DstResource:  "DstResource",
-	JobID:        "JobID",
-	Status:       "Status",
-	StartTime:    "StartTime",
-	EndTime:      "EndTime",
+	ID:                 "ID",
+	ExecutionID:        "ExecutionID",
+	ResourceType:       "ResourceType",
+	SrcResource:        "SrcResource",
+	DstResource:        "DstResource",
+	JobID:              "JobID",
+	Status:             "Status",
+	StatusText:         "StatusText",
+	StartTime:          "StartTime",
+	EndTime:            "EndTime",
+	Retries:            "Retries",
+	BytesTransferred:   "BytesTransferred",
+	AverageSpeed:       "AverageSpeed",
+	PeakSpeed:          "PeakSpeed",
+	Referrers:          "Referrers",
+	MediaTypes:         "MediaTypes",
+	SrcEndpoint:        "SrcEndpoint",
+	DstEndpoint:        "DstEndpoint",
+	TotalBytes:         "TotalBytes",
+	ETA:                "ETA",
+	InflightKey:        "InflightKey",
+	DeferredRegistryID: "DeferredRegistryID",
+	DeferredItem:       "DeferredItem",
+	UpdateTime:         "UpdateTime",
 }
 
 // TaskFieldsName defines the props of Task
 type TaskFieldsName struct {
-	ID           string
-	ExecutionID  string
-	ResourceType string
-	SrcResource  string
-	DstResource  string
-	JobID        string
-	Status       string
-	StartTime    string
-	EndTime      string
+	ID                 string
+	ExecutionID        string
+	ResourceType       string
+	SrcResource        string
+	DstResource        string
+	JobID              string
+	Status             string
+	StatusText         string
+	StartTime          string
+	EndTime            string
+	Retries            string
+	BytesTransferred   string
+	AverageSpeed       string
+	PeakSpeed          string
+	Referrers          string
+	MediaTypes         string
+	SrcEndpoint        string
+	DstEndpoint        string
+	TotalBytes         string
+	ETA                string
+	InflightKey        string
+	DeferredRegistryID string
+	DeferredItem       string
+	UpdateTime         string
 }
 
 // Task represent the tasks in one execution.
@@ -119,6 +183,132 @@ type Task struct {
 	Status       string     `orm:"column(status)" json:"status"`
 	StartTime    *time.Time `orm:"column(start_time)" json:"start_time"`
 	EndTime      *time.Time `orm:"column(end_time)" json:"end_time,omitempty"`
+	// the count of times the failed task has been retried
+	Retries int `orm:"column(retries)" json:"retries"`
+	// the name of the source repository replicated by the task
+	Repository string `orm:"column(repository)" json:"repository"`
+	// the reason of the failure checked in by the job
+	StatusText string `orm:"column(status_text)" json:"status_text,omitempty"`
+	// the bytes of the blobs pushed by the task and the average and peak speed in MB/s
+	BytesTransferred int64   `orm:"column(bytes_transferred)" json:"bytes_transferred"`
+	AverageSpeed     float64 `orm:"column(average_speed)" json:"average_speed"`
+	PeakSpeed        float64 `orm:"column(peak_speed)" json:"peak_speed"`
+	// the count of the referrers of the images transferred, e.g. signatures, SBOMs and attestations
+	Referrers int `orm:"column(referrers)" json:"referrers"`
+	// the media types of the manifests on the destination registry separated by commas, they
+	// differ from the source ones if the manifests are converted
+	MediaTypes string `orm:"column(media_types)" json:"media_types,omitempty"`
+	// the endpoints of the source and destination registries used by the task, they're one of
+	// the failover URLs of the registries if the primary ones are unhealthy
+	SrcEndpoint string `orm:"column(src_endpoint)" json:"src_endpoint,omitempty"`
+	DstEndpoint string `orm:"column(dst_endpoint)" json:"dst_endpoint,omitempty"`
+	// the bytes of the blobs expected to be pushed by the running task and the estimated
+	// seconds to push the rest of them, 0 means the ETA isn't estimated
+	TotalBytes int64 `orm:"column(total_bytes)" json:"total_bytes"`
+	ETA        int64 `orm:"column(eta)" json:"eta"`
+	// the ID of the destination registry which the task replicates to
+	DstRegistryID int64 `orm:"column(dst_registry_id)" json:"dst_registry_id"`
+	// the hash of the content replicated by the job submitted for the task, the identical
+	// tasks are coalesced into the job by it before the job starts
+	InflightKey string `orm:"column(inflight_key)" json:"-"`
+	// the ID of the draining registry which the task is deferred by and the encrypted item
+	// to schedule when the draining ends, the task is kept initialized while it's deferred
+	DeferredRegistryID int64  `orm:"column(deferred_registry_id)" json:"-"`
+	DeferredItem       string `orm:"column(deferred_item)" json:"-"`
+	// the time when the task is updated last time, it's refreshed by the trigger of the table
+	UpdateTime time.Time `orm:"column(update_time);auto_now" json:"-"`
+}
+
+// TargetResult rolls up the results of the tasks replicating to the same destination registry
+type TargetResult struct {
+	RegistryID   int64               `json:"registry_id"`
+	Status       string              `json:"status"`
+	Total        int                 `json:"total"`
+	Failed       int                 `json:"failed"`
+	Succeed      int                 `json:"succeed"`
+	InProgress   int                 `json:"in_progress"`
+	Stopped      int                 `json:"stopped"`
+	Paused       int                 `json:"paused"`
+	Repositories []*RepositoryResult `json:"repositories"`
+}
+
+// RepositoryResult is the result of the task replicating one repository
+type RepositoryResult struct {
+	TaskID      int64  `json:"task_id"`
+	Repository  string `json:"repository"`
+	SrcResource string `json:"src_resource"`
+	DstResource string `json:"dst_resource"`
+	Status      string `json:"status"`
+	StatusText  string `json:"status_text,omitempty"`
+}
+
+// GroupTasksByTarget groups the tasks by their destination registries, the status of each
+// destination registry is rolled up from its tasks in the same way as the execution
+func GroupTasksByTarget(tasks []*Task) map[int64]*TargetResult {
+	targets := map[int64]*TargetResult{}
+	for _, task := range tasks {
+		target, exist := targets[task.DstRegistryID]
+		if !exist {
+			target = &TargetResult{
+				RegistryID:   task.DstRegistryID,
+				Repositories: []*RepositoryResult{},
+			}
+			targets[task.DstRegistryID] = target
+		}
+		target.Total++
+		switch task.Status {
+		case TaskStatusInitialized, TaskStatusPending, TaskStatusInProgress:
+			target.InProgress++
+		case TaskStatusSucceed:
+			target.Succeed++
+		case TaskStatusFailed:
+			target.Failed++
+		case TaskStatusStopped:
+			target.Stopped++
+		case TaskStatusPaused:
+			target.Paused++
+		}
+		target.Repositories = append(target.Repositories, &RepositoryResult{
+			TaskID:      task.ID,
+			Repository:  task.Repository,
+			SrcResource: task.SrcResource,
+			DstResource: task.DstResource,
+			Status:      task.Status,
+			StatusText:  task.StatusText,
+		})
+	}
+	for _, target := range targets {
+		target.Status = GenerateStatus(target.InProgress, target.Failed, target.Succeed, target.Paused, target.Stopped)
+	}
+	return targets
+}
+
+// GenerateStatus rolls up the status from the counts of the tasks in each status
+func GenerateStatus(inProgress, failed, succeed, paused, stopped int) string {
+	if inProgress > 0 {
+		return ExecutionStatusInProgress
+	} else if failed > 0 {
+		if succeed > 0 {
+			return ExecutionStatusPartialSucceed
+		}
+		return ExecutionStatusFailed
+	} else if paused > 0 {
+		return ExecutionStatusPaused
+	} else if stopped > 0 {
+		return ExecutionStatusStopped
+	}
+	return ExecutionStatusSucceed
+}
+
+// ExecutionFinished returns whether the execution is finished, it doesn't change any more once
+// it's in these statuses
+func ExecutionFinished(status string) bool {
+	switch status {
+	case ExecutionStatusSucceed, ExecutionStatusFailed, ExecutionStatusPartialSucceed,
+		ExecutionStatusStopped, ExecutionStatusPaused:
+		return true
+	}
+	return false
 }
 
 // TableName is required by by beego orm to map Execution to table replication_execution
@@ -131,12 +321,35 @@ func (r *Task) TableName() string {
 	return TaskTable
 }
 
+// ExecutionSortableFields maps the field names that the executions can be sorted by
+// to the properties of Execution
+var ExecutionSortableFields = map[string]string{
+	"id":         ExecutionPropsName.ID,
+	"status":     ExecutionPropsName.Status,
+	"trigger":    ExecutionPropsName.Trigger,
+	"start_time": ExecutionPropsName.StartTime,
+	"end_time":   ExecutionPropsName.EndTime,
+}
+
+// TaskSortableFields maps the field names that the tasks can be sorted by
+// to the properties of Task
+var TaskSortableFields = map[string]string{
+	"id":            TaskPropsName.ID,
+	"status":        TaskPropsName.Status,
+	"resource_type": TaskPropsName.ResourceType,
+	"start_time":    TaskPropsName.StartTime,
+	"end_time":      TaskPropsName.EndTime,
+}
+
 // ExecutionQuery holds the query conditions for replication executions
 type ExecutionQuery struct {
 	PolicyID int64
 	Statuses []string
 	Trigger  string
+	// only the executions having all the annotations are returned if specified
+	Annotations map[string]string
 	Pagination
+	Sorting
 }
 
 // TaskQuery holds the query conditions for replication task
@@ -145,9 +358,39 @@ type TaskQuery struct {
 	JobID        string
 	Statuses     []string
 	ResourceType string
+	// only the tasks which end in the time range are returned if specified
+	EndTimeFrom *time.Time
+	EndTimeTo   *time.Time
+	// only the tasks which start in the time range are returned if specified
+	StartTimeFrom *time.Time
+	StartTimeTo   *time.Time
+	// only the tasks of the executions of the policy are returned if specified
+	PolicyID int64
+	// only the tasks replicating to the registry are returned if specified
+	DestRegistryID int64
+	// only the tasks whose IDs are greater than it are returned if specified, it's used to list the
+	// tasks page by page by the ID of the last task of the previous page rather than the offset
+	IDFrom int64
+	// only the tasks updated at or after the time are returned if specified
+	UpdateTimeFrom *time.Time
+	// only the tasks replicating the repository are returned if specified,
+	// the "RepositoryMatch" decides how to match it: "exact"(default) or "prefix"
+	Repository      string
+	RepositoryMatch string
+	// only the tasks whose jobs replicate the content identified by the key are returned if specified
+	InflightKey string
+	// only the tasks deferred by the draining registry are returned if specified
+	DeferredRegistryID int64
 	Pagination
+	Sorting
 }
 
+// the modes to match the repository of tasks
+const (
+	RepositoryMatchExact  = "exact"
+	RepositoryMatchPrefix = "prefix"
+)
+
 // TaskStat holds statistics of task by status
 type TaskStat struct {
 	Status string `orm:"column(status)"`
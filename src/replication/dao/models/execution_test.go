@@ -0,0 +1,91 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupTasksByTarget(t *testing.T) {
+	// no tasks
+	assert.Equal(t, 0, len(GroupTasksByTarget(nil)))
+
+	// the execution replicates to two targets and one of them fails
+	tasks := []*Task{
+		{ID: 1, Repository: "library/hello-world", DstRegistryID: 1, Status: TaskStatusSucceed},
+		{ID: 2, Repository: "library/busybox", DstRegistryID: 1, Status: TaskStatusSucceed},
+		{ID: 3, Repository: "library/hello-world", DstRegistryID: 2, Status: TaskStatusSucceed},
+		{ID: 4, Repository: "library/busybox", DstRegistryID: 2, Status: TaskStatusFailed,
+			StatusText: "connection refused"},
+	}
+	targets := GroupTasksByTarget(tasks)
+	require.Equal(t, 2, len(targets))
+
+	target := targets[1]
+	require.NotNil(t, target)
+	assert.Equal(t, int64(1), target.RegistryID)
+	assert.Equal(t, ExecutionStatusSucceed, target.Status)
+	assert.Equal(t, 2, target.Total)
+	assert.Equal(t, 2, target.Succeed)
+	assert.Equal(t, 0, target.Failed)
+	require.Equal(t, 2, len(target.Repositories))
+	assert.Equal(t, "library/hello-world", target.Repositories[0].Repository)
+	assert.Equal(t, "library/busybox", target.Repositories[1].Repository)
+
+	target = targets[2]
+	require.NotNil(t, target)
+	assert.Equal(t, int64(2), target.RegistryID)
+	assert.Equal(t, ExecutionStatusPartialSucceed, target.Status)
+	assert.Equal(t, 2, target.Total)
+	assert.Equal(t, 1, target.Succeed)
+	assert.Equal(t, 1, target.Failed)
+	require.Equal(t, 2, len(target.Repositories))
+	assert.Equal(t, int64(4), target.Repositories[1].TaskID)
+	assert.Equal(t, TaskStatusFailed, target.Repositories[1].Status)
+	assert.Equal(t, "connection refused", target.Repositories[1].StatusText)
+
+	// the pending tasks are counted as in progress
+	tasks = []*Task{
+		{ID: 1, DstRegistryID: 1, Status: TaskStatusPending},
+		{ID: 2, DstRegistryID: 1, Status: TaskStatusFailed},
+		{ID: 3, DstRegistryID: 2, Status: TaskStatusFailed},
+	}
+	targets = GroupTasksByTarget(tasks)
+	require.Equal(t, 2, len(targets))
+	assert.Equal(t, ExecutionStatusInProgress, targets[1].Status)
+	assert.Equal(t, 1, targets[1].InProgress)
+	assert.Equal(t, ExecutionStatusFailed, targets[2].Status)
+}
+
+func TestGenerateStatus(t *testing.T) {
+	assert.Equal(t, ExecutionStatusSucceed, GenerateStatus(0, 0, 0, 0, 0))
+	assert.Equal(t, ExecutionStatusSucceed, GenerateStatus(0, 0, 1, 0, 0))
+	assert.Equal(t, ExecutionStatusInProgress, GenerateStatus(1, 1, 1, 1, 1))
+	assert.Equal(t, ExecutionStatusFailed, GenerateStatus(0, 1, 0, 1, 1))
+	assert.Equal(t, ExecutionStatusPartialSucceed, GenerateStatus(0, 1, 1, 0, 0))
+	assert.Equal(t, ExecutionStatusPaused, GenerateStatus(0, 0, 1, 1, 1))
+	assert.Equal(t, ExecutionStatusStopped, GenerateStatus(0, 0, 1, 0, 1))
+}
+
+func TestExecutionFinished(t *testing.T) {
+	assert.False(t, ExecutionFinished(ExecutionStatusInProgress))
+	for _, status := range []string{ExecutionStatusSucceed, ExecutionStatusFailed, ExecutionStatusPartialSucceed,
+		ExecutionStatusStopped, ExecutionStatusPaused} {
+		assert.True(t, ExecutionFinished(status))
+	}
+}
@@ -4,20 +4,35 @@ import "time"
 
 // RepPolicy is the model for a ng replication policy.
 type RepPolicy struct {
-	ID                int64     `orm:"pk;auto;column(id)" json:"id"`
-	Name              string    `orm:"column(name)" json:"name"`
-	Description       string    `orm:"column(description)" json:"description"`
-	Creator           string    `orm:"column(creator)" json:"creator"`
-	SrcRegistryID     int64     `orm:"column(src_registry_id)" json:"src_registry_id"`
-	DestRegistryID    int64     `orm:"column(dest_registry_id)" json:"dest_registry_id"`
-	DestNamespace     string    `orm:"column(dest_namespace)" json:"dest_namespace"`
-	Override          bool      `orm:"column(override)" json:"override"`
-	Enabled           bool      `orm:"column(enabled)" json:"enabled"`
-	Trigger           string    `orm:"column(trigger)" json:"trigger"`
-	Filters           string    `orm:"column(filters)" json:"filters"`
-	ReplicateDeletion bool      `orm:"column(replicate_deletion)" json:"replicate_deletion"`
-	CreationTime      time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime        time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	ID                  int64     `orm:"pk;auto;column(id)" json:"id"`
+	Name                string    `orm:"column(name)" json:"name"`
+	Description         string    `orm:"column(description)" json:"description"`
+	Creator             string    `orm:"column(creator)" json:"creator"`
+	SrcRegistryID       int64     `orm:"column(src_registry_id)" json:"src_registry_id"`
+	DestRegistryID      int64     `orm:"column(dest_registry_id)" json:"dest_registry_id"`
+	DestNamespace       string    `orm:"column(dest_namespace)" json:"dest_namespace"`
+	Override            bool      `orm:"column(override)" json:"override"`
+	Enabled             bool      `orm:"column(enabled)" json:"enabled"`
+	Trigger             string    `orm:"column(trigger)" json:"trigger"`
+	Filters             string    `orm:"column(filters)" json:"filters"`
+	TagTransform        string    `orm:"column(tag_transform)" json:"tag_transform"`
+	ReplicateDeletion   bool      `orm:"column(replicate_deletion)" json:"replicate_deletion"`
+	ReplicateReferrers  bool      `orm:"column(replicate_referrers)" json:"replicate_referrers"`
+	PauseOnReadOnly     bool      `orm:"column(pause_on_read_only)" json:"pause_on_read_only"`
+	OrderBySharedBlobs  bool      `orm:"column(order_by_shared_blobs)" json:"order_by_shared_blobs"`
+	CompressLayers      bool      `orm:"column(compress_layers)" json:"compress_layers"`
+	MountBlobs          bool      `orm:"column(mount_blobs)" json:"mount_blobs"`
+	BlobAccounting      bool      `orm:"column(blob_accounting)" json:"blob_accounting"`
+	OrderBySize         string    `orm:"column(order_by_size)" json:"order_by_size"`
+	MaxSeverity         string    `orm:"column(max_severity)" json:"max_severity"`
+	AllowUnscanned      bool      `orm:"column(allow_unscanned)" json:"allow_unscanned"`
+	SignedOnly          bool      `orm:"column(signed_only)" json:"signed_only"`
+	MaxRepos            int       `orm:"column(max_repos)" json:"max_repos"`
+	MaxReposMode        string    `orm:"column(max_repos_mode)" json:"max_repos_mode"`
+	FailureThreshold    int       `orm:"column(failure_threshold)" json:"failure_threshold"`
+	ConsecutiveFailures int       `orm:"column(consecutive_failures)" json:"consecutive_failures"`
+	CreationTime        time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime          time.Time `orm:"column(update_time);auto_now" json:"update_time"`
 }
 
 // TableName set table name for ORM.
@@ -10,22 +10,54 @@ import (
 const (
 	// RegistryTable is the table name for registry
 	RegistryTable = "registry"
+	// RegistryHealthCheckTable is the table name for the health check records of registry
+	RegistryHealthCheckTable = "registry_health_check"
+	// RegistryCircuitBreakerTable is the table name for the circuit breakers of registry
+	RegistryCircuitBreakerTable = "registry_circuit_breaker"
+	// RegistryLabelTable is the table name for the labels of registry
+	RegistryLabelTable = "registry_label"
 )
 
 // Registry is the model for a registry, which wraps the endpoint URL and credential of a remote registry.
 type Registry struct {
-	ID             int64     `orm:"pk;auto;column(id)" json:"id"`
-	URL            string    `orm:"column(url)" json:"endpoint"`
-	Name           string    `orm:"column(name)" json:"name"`
-	CredentialType string    `orm:"column(credential_type);default(basic)" json:"credential_type"`
-	AccessKey      string    `orm:"column(access_key)" json:"access_key"`
-	AccessSecret   string    `orm:"column(access_secret)" json:"access_secret"`
-	Type           string    `orm:"column(type)" json:"type"`
-	Insecure       bool      `orm:"column(insecure)" json:"insecure"`
-	Description    string    `orm:"column(description)" json:"description"`
-	Health         string    `orm:"column(health)" json:"health"`
-	CreationTime   time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime     time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	ID               int64     `orm:"pk;auto;column(id)" json:"id"`
+	URL              string    `orm:"column(url)" json:"endpoint"`
+	Name             string    `orm:"column(name)" json:"name"`
+	CredentialType   string    `orm:"column(credential_type);default(basic)" json:"credential_type"`
+	AccessKey        string    `orm:"column(access_key)" json:"access_key"`
+	AccessSecret     string    `orm:"column(access_secret)" json:"access_secret"`
+	Type             string    `orm:"column(type)" json:"type"`
+	Insecure         bool      `orm:"column(insecure)" json:"insecure"`
+	Description      string    `orm:"column(description)" json:"description"`
+	UserAgent        string    `orm:"column(user_agent)" json:"user_agent"`
+	MaxConnections   int       `orm:"column(max_connections)" json:"max_connections"`
+	JobRetentionDays int       `orm:"column(job_retention_days)" json:"job_retention_days"`
+	Draining         bool      `orm:"column(draining)" json:"draining"`
+	Health           string    `orm:"column(health)" json:"health"`
+	CreationTime     time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime       time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	// the JSON array of the names of the allowed projects
+	AllowedProjects string `orm:"column(allowed_projects)" json:"allowed_projects"`
+	// the JSON array of the blackout windows
+	BlackoutWindows string `orm:"column(blackout_windows)" json:"blackout_windows"`
+	// the JSON object of the path transform
+	PathTransform string `orm:"column(path_transform)" json:"path_transform"`
+	// the manifest type which the registry prefers, "docker" or "oci"
+	PreferredManifestType string `orm:"column(preferred_manifest_type)" json:"preferred_manifest_type"`
+	// the JSON object of the custom headers
+	Headers string `orm:"column(headers)" json:"headers"`
+	// the JSON array of the failover URLs
+	FailoverURLs string `orm:"column(failover_urls)" json:"failover_urls"`
+	// the JSON object of the allowed and denied media types of the layers
+	LayerMediaTypes string `orm:"column(layer_media_types)" json:"layer_media_types"`
+	// the count of the connections warmed up before replicating to the registry
+	WarmupConnections int `orm:"column(warmup_connections)" json:"warmup_connections"`
+	// the IANA time zone name which the blackout windows are interpreted in
+	Timezone string `orm:"column(timezone)" json:"timezone"`
+	// the encrypted JSON object of the SSH tunnel, it contains the private key
+	SSHTunnel string `orm:"column(ssh_tunnel)" json:"ssh_tunnel"`
+	// whether the registry is the one pre-selected when creating the policies, at most one registry is the default
+	Default bool `orm:"column(is_default)" json:"default"`
 }
 
 // TableName is required by by beego orm to map Registry to table registry
@@ -43,14 +75,54 @@ func (r *Registry) Valid(v *validation.Validation) {
 		v.SetError("name", "max length is 64")
 	}
 
-	url, err := utils.ParseEndpoint(r.URL)
+	url, err := utils.CanonicalizeEndpoint(r.URL)
 	if err != nil {
 		v.SetError("endpoint", err.Error())
 	} else {
 		// Prevent SSRF security issue #3755
-		r.URL = url.Scheme + "://" + url.Host + url.Path
+		r.URL = url
 		if len(r.URL) > 64 {
 			v.SetError("endpoint", "max length is 64")
 		}
 	}
 }
+
+// RegistryHealthCheck records the result of one health check for the registry,
+// the latency is in milliseconds
+type RegistryHealthCheck struct {
+	ID           int64     `orm:"pk;auto;column(id)" json:"id"`
+	RegistryID   int64     `orm:"column(registry_id)" json:"registry_id"`
+	Status       string    `orm:"column(status)" json:"status"`
+	Latency      int64     `orm:"column(latency)" json:"latency"`
+	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+}
+
+// TableName is required by by beego orm to map RegistryHealthCheck to table registry_health_check
+func (r *RegistryHealthCheck) TableName() string {
+	return RegistryHealthCheckTable
+}
+
+// RegistryCircuitBreaker is the state of the circuit breaker for the health check of the registry,
+// the opening time is zero if the breaker is closed
+type RegistryCircuitBreaker struct {
+	RegistryID int64     `orm:"pk;column(registry_id)" json:"registry_id"`
+	Failures   int       `orm:"column(failures)" json:"failures"`
+	OpenedAt   time.Time `orm:"column(opened_at);null" json:"opened_at"`
+}
+
+// TableName is required by by beego orm to map RegistryCircuitBreaker to table registry_circuit_breaker
+func (r *RegistryCircuitBreaker) TableName() string {
+	return RegistryCircuitBreakerTable
+}
+
+// RegistryLabel is one label of the registry
+type RegistryLabel struct {
+	ID         int64  `orm:"pk;auto;column(id)" json:"id"`
+	RegistryID int64  `orm:"column(registry_id)" json:"registry_id"`
+	Label      string `orm:"column(label)" json:"label"`
+}
+
+// TableName is required by by beego orm to map RegistryLabel to table registry_label
+func (r *RegistryLabel) TableName() string {
+	return RegistryLabelTable
+}
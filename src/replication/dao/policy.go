@@ -106,10 +106,40 @@ func UpdateRepPolicy(policy *models.RepPolicy, props ...string) (err error) {
 	return
 }
 
+// IncreaseRepPolicyFailures increases the consecutive failures of the policy in one statement, so the
+// executions finished concurrently are all counted, and disables the policy once the count reaches its
+// failure threshold. Returns the count and whether the policy is disabled by this increase
+func IncreaseRepPolicyFailures(id int64) (int, bool, error) {
+	sql := `update replication_policy p
+		set consecutive_failures = p.consecutive_failures + 1,
+			enabled = p.enabled and not (p.failure_threshold > 0 and p.consecutive_failures + 1 >= p.failure_threshold)
+		from (select id, enabled from replication_policy where id = ? for update) origin
+		where p.id = origin.id
+		returning p.consecutive_failures, origin.enabled and not p.enabled`
+	var failures int
+	var disabled bool
+	if err := common_dao.GetOrmer().Raw(sql, id).QueryRow(&failures, &disabled); err != nil {
+		if err == orm.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return failures, disabled, nil
+}
+
+// ResetRepPolicyFailures resets the consecutive failures of the policy
+func ResetRepPolicyFailures(id int64) error {
+	_, err := common_dao.GetOrmer().Raw(`update replication_policy set consecutive_failures = 0
+		where id = ? and consecutive_failures > 0`, id).Exec()
+	return err
+}
+
 // DeleteRepPolicy will hard delete database item
 func DeleteRepPolicy(id int64) error {
 	o := common_dao.GetOrmer()
 
-	_, err := o.Delete(&models.RepPolicy{ID: id})
-	return err
+	if _, err := o.Delete(&models.RepPolicy{ID: id}); err != nil {
+		return err
+	}
+	return DeleteExecutionSequence(id)
 }
@@ -260,6 +260,47 @@ func TestUpdateRepPolicy(t *testing.T) {
 	}
 }
 
+func TestRepPolicyFailures(t *testing.T) {
+	id, err := AddRepPolicy(&models.RepPolicy{
+		Name:             "test_policy_failures",
+		Enabled:          true,
+		FailureThreshold: 2,
+	})
+	require.Nil(t, err)
+	defer DeleteRepPolicy(id)
+
+	failures, disabled, err := IncreaseRepPolicyFailures(id)
+	require.Nil(t, err)
+	assert.Equal(t, 1, failures)
+	assert.False(t, disabled)
+
+	// the policy is disabled once the count reaches the threshold
+	failures, disabled, err = IncreaseRepPolicyFailures(id)
+	require.Nil(t, err)
+	assert.Equal(t, 2, failures)
+	assert.True(t, disabled)
+
+	// the disabled policy isn't disabled again
+	failures, disabled, err = IncreaseRepPolicyFailures(id)
+	require.Nil(t, err)
+	assert.Equal(t, 3, failures)
+	assert.False(t, disabled)
+	policy, err := GetRepPolicy(id)
+	require.Nil(t, err)
+	assert.False(t, policy.Enabled)
+
+	require.Nil(t, ResetRepPolicyFailures(id))
+	policy, err = GetRepPolicy(id)
+	require.Nil(t, err)
+	assert.Equal(t, 0, policy.ConsecutiveFailures)
+
+	// the policy doesn't exist
+	failures, disabled, err = IncreaseRepPolicyFailures(0)
+	require.Nil(t, err)
+	assert.Equal(t, 0, failures)
+	assert.False(t, disabled)
+}
+
 func TestDeleteRepPolicy(t *testing.T) {
 	tests := []struct {
 		name    string
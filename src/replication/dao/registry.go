@@ -1,8 +1,11 @@
 package dao
 
 import (
+	"time"
+
 	"github.com/astaxie/beego/orm"
 	"github.com/goharbor/harbor/src/common/dao"
+	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 )
 
@@ -14,12 +17,27 @@ type ListRegistryQuery struct {
 	Offset int64
 	// Limit specifies the maximum registries to return
 	Limit int64
+	// Labels specifies the labels which the registries should have
+	Labels []string
+	// MatchAnyLabel specifies whether the registries having any of the labels are returned,
+	// otherwise only the ones having all the labels are returned
+	MatchAnyLabel bool
 }
 
-// AddRegistry add a new registry
+// AddRegistry add a new registry, the previous default registry is cleared in the same
+// transaction if the new one is the default
 func AddRegistry(registry *models.Registry) (int64, error) {
-	o := dao.GetOrmer()
-	return o.Insert(registry)
+	if !registry.Default {
+		o := dao.GetOrmer()
+		return o.Insert(registry)
+	}
+	var id int64
+	err := withDefaultCleared(0, func(o orm.Ormer) error {
+		var err error
+		id, err = o.Insert(registry)
+		return err
+	})
+	return id, err
 }
 
 // GetRegistry gets one registry from database by id.
@@ -64,6 +82,17 @@ func ListRegistries(query ...*ListRegistryQuery) (int64, []*models.Registry, err
 	if len(query) > 0 && len(query[0].Query) > 0 {
 		q = q.Filter("name__contains", query[0].Query)
 	}
+	if len(query) > 0 && len(query[0].Labels) > 0 {
+		ids, err := registryIDsByLabels(query[0].Labels, query[0].MatchAnyLabel)
+		if err != nil {
+			return -1, nil, err
+		}
+		if len(ids) == 0 {
+			// no registry matches, make sure no registry is returned
+			ids = []int64{0}
+		}
+		q = q.Filter("id__in", ids)
+	}
 
 	total, err := q.Count()
 	if err != nil {
@@ -85,17 +114,239 @@ func ListRegistries(query ...*ListRegistryQuery) (int64, []*models.Registry, err
 	return total, registries, nil
 }
 
-// UpdateRegistry updates one registry
-func UpdateRegistry(registry *models.Registry, props ...string) error {
-	o := dao.GetOrmer()
+// returns the IDs of the registries having all the labels, or any of them if "matchAny" is true
+func registryIDsByLabels(labels []string, matchAny bool) ([]int64, error) {
+	rls := []*models.RegistryLabel{}
+	if _, err := dao.GetOrmer().QueryTable(&models.RegistryLabel{}).
+		Filter("label__in", labels).All(&rls); err != nil {
+		return nil, err
+	}
+	wanted := map[string]struct{}{}
+	for _, label := range labels {
+		wanted[label] = struct{}{}
+	}
+	matched := map[int64]map[string]struct{}{}
+	for _, rl := range rls {
+		if matched[rl.RegistryID] == nil {
+			matched[rl.RegistryID] = map[string]struct{}{}
+		}
+		matched[rl.RegistryID][rl.Label] = struct{}{}
+	}
+	ids := []int64{}
+	for id, ls := range matched {
+		if matchAny || len(ls) == len(wanted) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SetRegistryLabels replaces the labels of the registry
+func SetRegistryLabels(registryID int64, labels []string) error {
+	return setRegistryLabels(dao.GetOrmer(), registryID, labels)
+}
 
-	_, err := o.Update(registry, props...)
+func setRegistryLabels(o orm.Ormer, registryID int64, labels []string) error {
+	if _, err := o.QueryTable(&models.RegistryLabel{}).Filter("registry_id", registryID).Delete(); err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	rls := []*models.RegistryLabel{}
+	for _, label := range labels {
+		rls = append(rls, &models.RegistryLabel{
+			RegistryID: registryID,
+			Label:      label,
+		})
+	}
+	_, err := o.InsertMulti(len(rls), rls)
 	return err
 }
 
+// ImportedRegistry is the registry saved by "ImportRegistries" along with its labels
+type ImportedRegistry struct {
+	Registry *models.Registry
+	Labels   []string
+}
+
+// ImportRegistries inserts the registries whose ID is 0 and updates the others along with their
+// labels in one transaction, so none of them is saved if any of them fails
+func ImportRegistries(registries []*ImportedRegistry) error {
+	o := orm.NewOrm()
+	if err := o.Begin(); err != nil {
+		return err
+	}
+	err := func() error {
+		for _, r := range registries {
+			if r.Registry.ID == 0 {
+				id, err := o.Insert(r.Registry)
+				if err != nil {
+					return err
+				}
+				r.Registry.ID = id
+			} else if _, err := o.Update(r.Registry); err != nil {
+				return err
+			}
+			if err := setRegistryLabels(o, r.Registry.ID, r.Labels); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		if e := o.Rollback(); e != nil {
+			log.Errorf("failed to rollback the transaction of importing the registries: %v", e)
+		}
+		return err
+	}
+	return o.Commit()
+}
+
+// GetRegistryLabels returns the labels of the registries, the key is the ID of the registry
+func GetRegistryLabels(registryIDs ...int64) (map[int64][]string, error) {
+	labels := map[int64][]string{}
+	if len(registryIDs) == 0 {
+		return labels, nil
+	}
+	rls := []*models.RegistryLabel{}
+	if _, err := dao.GetOrmer().QueryTable(&models.RegistryLabel{}).
+		Filter("registry_id__in", registryIDs).OrderBy("id").All(&rls); err != nil {
+		return nil, err
+	}
+	for _, rl := range rls {
+		labels[rl.RegistryID] = append(labels[rl.RegistryID], rl.Label)
+	}
+	return labels, nil
+}
+
+// UpdateRegistry updates one registry. If the registry is made the default, the previous default
+// registry is cleared in the same transaction, so there is at most one default registry
+func UpdateRegistry(registry *models.Registry, props ...string) error {
+	if !registry.Default || !updatesDefault(props) {
+		o := dao.GetOrmer()
+		_, err := o.Update(registry, props...)
+		return err
+	}
+	return withDefaultCleared(registry.ID, func(o orm.Ormer) error {
+		_, err := o.Update(registry, props...)
+		return err
+	})
+}
+
+// GetDefaultRegistry returns the default registry, nil is returned if no registry is the default
+func GetDefaultRegistry() (*models.Registry, error) {
+	registries := []*models.Registry{}
+	if _, err := dao.GetOrmer().QueryTable(&models.Registry{}).
+		Filter("is_default", true).All(&registries); err != nil {
+		return nil, err
+	}
+	if len(registries) == 0 {
+		return nil, nil
+	}
+	return registries[0], nil
+}
+
+// returns whether the "Default" is updated by the update of the properties
+func updatesDefault(props []string) bool {
+	if len(props) == 0 {
+		return true
+	}
+	for _, prop := range props {
+		if prop == "Default" {
+			return true
+		}
+	}
+	return false
+}
+
+// clears the default of the registries other than the one specified by "registryID" and calls the
+// function in one transaction. The partial unique index on "is_default" makes the concurrent transaction
+// which sets another registry as the default fail rather than leaving two default registries
+func withDefaultCleared(registryID int64, f func(o orm.Ormer) error) error {
+	o := orm.NewOrm()
+	if err := o.Begin(); err != nil {
+		return err
+	}
+	_, err := o.Raw(`update registry set is_default = false where is_default = true and id <> ?`, registryID).Exec()
+	if err == nil {
+		err = f(o)
+	}
+	if err != nil {
+		if e := o.Rollback(); e != nil {
+			log.Errorf("failed to rollback the transaction of setting the default registry: %v", e)
+		}
+		return err
+	}
+	return o.Commit()
+}
+
 // DeleteRegistry deletes a registry
 func DeleteRegistry(id int64) error {
 	o := dao.GetOrmer()
 	_, err := o.Delete(&models.Registry{ID: id})
 	return err
 }
+
+// AddRegistryHealthCheck records the result of a health check
+func AddRegistryHealthCheck(check *models.RegistryHealthCheck) (int64, error) {
+	o := dao.GetOrmer()
+	return o.Insert(check)
+}
+
+// ListRegistryHealthChecks lists the latest health check records of the registry, the
+// records are sorted by creation time in descending order
+func ListRegistryHealthChecks(registryID int64, limit int64) ([]*models.RegistryHealthCheck, error) {
+	o := dao.GetOrmer()
+	checks := []*models.RegistryHealthCheck{}
+	_, err := o.QueryTable(&models.RegistryHealthCheck{}).
+		Filter("registry_id", registryID).
+		OrderBy("-creation_time", "-id").
+		Limit(limit).
+		All(&checks)
+	return checks, err
+}
+
+// DeleteRegistryHealthChecks deletes the health check records created before the specified time
+func DeleteRegistryHealthChecks(before time.Time) (int64, error) {
+	o := dao.GetOrmer()
+	return o.QueryTable(&models.RegistryHealthCheck{}).
+		Filter("creation_time__lt", before).
+		Delete()
+}
+
+// GetRegistryCircuitBreaker returns the circuit breaker of the registry, nil is returned if
+// no failure of the registry is recorded
+func GetRegistryCircuitBreaker(registryID int64) (*models.RegistryCircuitBreaker, error) {
+	o := dao.GetOrmer()
+	breaker := &models.RegistryCircuitBreaker{RegistryID: registryID}
+	if err := o.Read(breaker); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return breaker, nil
+}
+
+// FailRegistryCircuitBreaker increases the failures of the registry atomically and opens the
+// breaker at the specified time once the failures reach the threshold
+func FailRegistryCircuitBreaker(registryID int64, threshold int, openedAt time.Time) error {
+	o := dao.GetOrmer()
+	_, err := o.Raw(`insert into registry_circuit_breaker (registry_id, failures, opened_at)
+		values (?, 1, case when 1 >= cast(? as int) then cast(? as timestamp) end)
+		on conflict (registry_id) do update set failures = registry_circuit_breaker.failures + 1,
+		opened_at = case when registry_circuit_breaker.failures + 1 >= cast(? as int)
+		then cast(? as timestamp) else registry_circuit_breaker.opened_at end`,
+		registryID, threshold, openedAt, threshold, openedAt).Exec()
+	return err
+}
+
+// ResetRegistryCircuitBreaker clears the failures of the registry and closes the breaker
+func ResetRegistryCircuitBreaker(registryID int64) error {
+	o := dao.GetOrmer()
+	_, err := o.QueryTable(&models.RegistryCircuitBreaker{}).
+		Filter("registry_id", registryID).
+		Delete()
+	return err
+}
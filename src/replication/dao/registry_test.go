@@ -1,10 +1,14 @@
 package dao
 
 import (
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/goharbor/harbor/src/common/dao"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -169,6 +173,243 @@ func (suite *RegistrySuite) TestUpdate() {
 	assert.Equal("key2", r.AccessKey)
 }
 
+func (suite *RegistrySuite) TestHealthCheckRecords() {
+	assert := assert.New(suite.T())
+
+	for _, status := range []string{"unhealthy", "healthy"} {
+		_, err := AddRegistryHealthCheck(&models.RegistryHealthCheck{
+			RegistryID: suite.defaultID,
+			Status:     status,
+			Latency:    10,
+		})
+		assert.Nil(err)
+	}
+
+	// the latest record is returned first
+	checks, err := ListRegistryHealthChecks(suite.defaultID, 1)
+	assert.Nil(err)
+	if assert.Equal(1, len(checks)) {
+		assert.Equal("healthy", checks[0].Status)
+		assert.Equal(int64(10), checks[0].Latency)
+	}
+
+	// delete the expired records
+	_, err = DeleteRegistryHealthChecks(time.Now().Add(time.Hour))
+	assert.Nil(err)
+	checks, err = ListRegistryHealthChecks(suite.defaultID, 10)
+	assert.Nil(err)
+	assert.Equal(0, len(checks))
+}
+
+func (suite *RegistrySuite) TestCircuitBreaker() {
+	assert := assert.New(suite.T())
+	defer ResetRegistryCircuitBreaker(suite.defaultID)
+
+	breaker, err := GetRegistryCircuitBreaker(suite.defaultID)
+	assert.Nil(err)
+	assert.Nil(breaker)
+
+	// the breaker is opened once the failures reach the threshold
+	now := time.Now()
+	assert.Nil(FailRegistryCircuitBreaker(suite.defaultID, 2, now))
+	breaker, err = GetRegistryCircuitBreaker(suite.defaultID)
+	assert.Nil(err)
+	if assert.NotNil(breaker) {
+		assert.Equal(1, breaker.Failures)
+		assert.True(breaker.OpenedAt.IsZero())
+	}
+	assert.Nil(FailRegistryCircuitBreaker(suite.defaultID, 2, now))
+	breaker, err = GetRegistryCircuitBreaker(suite.defaultID)
+	assert.Nil(err)
+	if assert.NotNil(breaker) {
+		assert.Equal(2, breaker.Failures)
+		assert.Equal(now.Unix(), breaker.OpenedAt.Unix())
+	}
+
+	// the failures recorded concurrently are all counted
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(FailRegistryCircuitBreaker(suite.defaultID, 2, now))
+		}()
+	}
+	wg.Wait()
+	breaker, err = GetRegistryCircuitBreaker(suite.defaultID)
+	assert.Nil(err)
+	if assert.NotNil(breaker) {
+		assert.Equal(10, breaker.Failures)
+	}
+
+	assert.Nil(ResetRegistryCircuitBreaker(suite.defaultID))
+	breaker, err = GetRegistryCircuitBreaker(suite.defaultID)
+	assert.Nil(err)
+	assert.Nil(breaker)
+}
+
+func (suite *RegistrySuite) TestListRegistriesByLabels() {
+	assert := assert.New(suite.T())
+
+	idA, err := AddRegistry(&models.Registry{Name: "labelTestA", URL: "a.harbor.io", Type: "harbor"})
+	assert.Nil(err)
+	defer DeleteRegistry(idA)
+	idB, err := AddRegistry(&models.Registry{Name: "labelTestB", URL: "b.harbor.io", Type: "harbor"})
+	assert.Nil(err)
+	defer DeleteRegistry(idB)
+	assert.Nil(SetRegistryLabels(idA, []string{"region:eu", "team:payments"}))
+	assert.Nil(SetRegistryLabels(idB, []string{"region:eu", "team:search"}))
+	assert.Nil(SetRegistryLabels(suite.defaultID, []string{"team:payments"}))
+
+	list := func(matchAny bool, labels ...string) []int64 {
+		_, registries, err := ListRegistries(&ListRegistryQuery{
+			Limit:         -1,
+			Labels:        labels,
+			MatchAnyLabel: matchAny,
+		})
+		assert.Nil(err)
+		ids := []int64{}
+		for _, r := range registries {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	// the registries having all the labels
+	assert.ElementsMatch([]int64{idA}, list(false, "region:eu", "team:payments"))
+	assert.ElementsMatch([]int64{idA, idB}, list(false, "region:eu"))
+	assert.Empty(list(false, "region:eu", "region:us"))
+	// the registries having any of the labels
+	assert.ElementsMatch([]int64{idA, idB, suite.defaultID}, list(true, "region:eu", "team:payments"))
+	assert.ElementsMatch([]int64{idB}, list(true, "team:search", "region:us"))
+	assert.Empty(list(true, "region:us"))
+
+	// replace the labels
+	assert.Nil(SetRegistryLabels(idA, []string{"region:us"}))
+	labels, err := GetRegistryLabels(idA, idB)
+	assert.Nil(err)
+	assert.Equal(map[int64][]string{
+		idA: {"region:us"},
+		idB: {"region:eu", "team:search"},
+	}, labels)
+}
+
+func (suite *RegistrySuite) TestDefaultRegistry() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+
+	defaults := func() []int64 {
+		registries := []*models.Registry{}
+		_, err := dao.GetOrmer().QueryTable(&models.Registry{}).Filter("is_default", true).All(&registries)
+		require.Nil(err)
+		ids := []int64{}
+		for _, r := range registries {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	// no default registry
+	r, err := GetDefaultRegistry()
+	require.Nil(err)
+	assert.Nil(r)
+
+	// the new default registry clears the previous one
+	idA, err := AddRegistry(&models.Registry{Name: "defaultTestA", URL: "a.harbor.io", Type: "harbor", Default: true})
+	require.Nil(err)
+	defer DeleteRegistry(idA)
+	idB, err := AddRegistry(&models.Registry{Name: "defaultTestB", URL: "b.harbor.io", Type: "harbor", Default: true})
+	require.Nil(err)
+	defer DeleteRegistry(idB)
+	assert.Equal([]int64{idB}, defaults())
+	r, err = GetDefaultRegistry()
+	require.Nil(err)
+	require.NotNil(r)
+	assert.Equal(idB, r.ID)
+
+	// toggling the default on clears the previous one
+	r, err = GetRegistry(idA)
+	require.Nil(err)
+	r.Default = true
+	require.Nil(UpdateRegistry(r, "Default"))
+	assert.Equal([]int64{idA}, defaults())
+
+	// the update of other properties doesn't touch the default
+	r, err = GetRegistry(idB)
+	require.Nil(err)
+	r.Default = true
+	r.Description = "updated"
+	require.Nil(UpdateRegistry(r, "Description"))
+	assert.Equal([]int64{idA}, defaults())
+
+	// toggling the default off
+	r, err = GetRegistry(idA)
+	require.Nil(err)
+	r.Default = false
+	require.Nil(UpdateRegistry(r))
+	assert.Empty(defaults())
+	r, err = GetDefaultRegistry()
+	require.Nil(err)
+	assert.Nil(r)
+
+	// at most one default registry exists when the defaults are toggled concurrently
+	ids := []int64{idA, idB, suite.defaultID}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			// the transaction conflicting with the concurrent one fails
+			UpdateRegistry(&models.Registry{ID: id, Default: true}, "Default")
+		}(ids[i%len(ids)])
+	}
+	wg.Wait()
+	assert.Equal(1, len(defaults()))
+
+	r, err = GetRegistry(suite.defaultID)
+	require.Nil(err)
+	r.Default = false
+	require.Nil(UpdateRegistry(r, "Default"))
+}
+
+func (suite *RegistrySuite) TestImportRegistries() {
+	assert := assert.New(suite.T())
+	require := require.New(suite.T())
+
+	// one registry is created and the existing one is overwritten along with the labels
+	r, err := GetRegistry(suite.defaultID)
+	require.Nil(err)
+	r.Description = "imported"
+	created := &ImportedRegistry{
+		Registry: &models.Registry{Name: "importTestA", URL: "a.harbor.io", Type: "harbor"},
+		Labels:   []string{"region:eu"},
+	}
+	require.Nil(ImportRegistries([]*ImportedRegistry{
+		created,
+		{Registry: r, Labels: []string{"team:payments"}},
+	}))
+	require.True(created.Registry.ID > 0)
+	defer DeleteRegistry(created.Registry.ID)
+	r, err = GetRegistry(suite.defaultID)
+	require.Nil(err)
+	assert.Equal("imported", r.Description)
+	labels, err := GetRegistryLabels(created.Registry.ID, suite.defaultID)
+	require.Nil(err)
+	assert.Equal([]string{"region:eu"}, labels[created.Registry.ID])
+	assert.Equal([]string{"team:payments"}, labels[suite.defaultID])
+
+	// nothing is saved if any of the registries fails, the name is duplicated here
+	r.Description = "failed"
+	err = ImportRegistries([]*ImportedRegistry{
+		{Registry: r},
+		{Registry: &models.Registry{Name: "importTestA", URL: "b.harbor.io", Type: "harbor"}},
+	})
+	assert.NotNil(err)
+	r, err = GetRegistry(suite.defaultID)
+	require.Nil(err)
+	assert.Equal("imported", r.Description)
+	require.Nil(SetRegistryLabels(suite.defaultID, nil))
+}
+
 func TestRegistrySuite(t *testing.T) {
 	suite.Run(t, new(RegistrySuite))
 }
@@ -76,7 +76,7 @@ func (h *handler) Handle(event *Event) error {
 		if err := PopulateRegistries(h.registryMgr, policy); err != nil {
 			return err
 		}
-		id, err := h.opCtl.StartReplication(policy, event.Resource, model.TriggerTypeEventBased)
+		id, err := h.opCtl.StartReplication(policy, event.Resource, model.TriggerTypeEventBased, nil)
 		if err != nil {
 			return err
 		}
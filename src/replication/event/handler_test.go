@@ -16,17 +16,19 @@ package event
 
 import (
 	"testing"
+	"time"
 
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type fakedOperationController struct{}
 
-func (f *fakedOperationController) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType) (int64, error) {
+func (f *fakedOperationController) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType, annotations map[string]string) (int64, error) {
 	return 1, nil
 }
 func (f *fakedOperationController) StopReplication(int64) error {
@@ -38,18 +40,63 @@ func (f *fakedOperationController) ListExecutions(...*models.ExecutionQuery) (in
 func (f *fakedOperationController) GetExecution(id int64) (*models.Execution, error) {
 	return nil, nil
 }
+func (f *fakedOperationController) MarkExecutionRecorded(int64) (bool, error) {
+	return false, nil
+}
 func (f *fakedOperationController) ListTasks(...*models.TaskQuery) (int64, []*models.Task, error) {
 	return 0, nil, nil
 }
 func (f *fakedOperationController) GetTask(id int64) (*models.Task, error) {
 	return nil, nil
 }
-func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, statusCondition ...string) error {
+func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskStatusText(id int64, text string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskSpeed(id int64, bytes int64, average, peak float64) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskProgress(id int64, bytes, total, eta int64) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskReferrers(id int64, count int) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskEndpoints(id int64, src, dst string) error {
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskMediaTypes(id int64, mediaTypes string) error {
 	return nil
 }
 func (f *fakedOperationController) GetTaskLog(int64) ([]byte, error) {
 	return nil, nil
 }
+func (f *fakedOperationController) RetryFailedTasks(policyID int64, since, until *time.Time) (int, error) {
+	return 0, nil
+}
+func (f *fakedOperationController) RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) GetDeadLetter(int64) (*models.DeadLetter, error) {
+	return nil, nil
+}
+func (f *fakedOperationController) RequeueDeadLetter(int64) error {
+	return nil
+}
+func (f *fakedOperationController) PreviewReplication(*model.Policy) ([]*flow.PreviewItem, []string, error) {
+	return nil, nil, nil
+}
+func (f *fakedOperationController) ResumeDeferredTasks(int64) (int, error) {
+	return 0, nil
+}
+func (f *fakedOperationController) DeferTask(int64) error {
+	return nil
+}
 
 type fakedPolicyController struct{}
 
@@ -178,6 +225,12 @@ func (f *fakedPolicyController) Update(*model.Policy) error {
 func (f *fakedPolicyController) Remove(int64) error {
 	return nil
 }
+func (f *fakedPolicyController) IncreaseFailures(int64) (int, bool, error) {
+	return 0, false, nil
+}
+func (f *fakedPolicyController) ResetFailures(int64) error {
+	return nil
+}
 
 type fakedRegistryManager struct{}
 
@@ -196,9 +249,15 @@ func (f *fakedRegistryManager) Get(id int64) (*model.Registry, error) {
 func (f *fakedRegistryManager) GetByName(name string) (*model.Registry, error) {
 	return nil, nil
 }
+func (f *fakedRegistryManager) GetDefault() (*model.Registry, error) {
+	return nil, nil
+}
 func (f *fakedRegistryManager) Update(*model.Registry, ...string) error {
 	return nil
 }
+func (f *fakedRegistryManager) Import([]*model.Registry) error {
+	return nil
+}
 func (f *fakedRegistryManager) Remove(int64) error {
 	return nil
 }
@@ -0,0 +1,100 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exclusion
+
+import (
+	"time"
+
+	common_dao "github.com/goharbor/harbor/src/common/dao"
+	common_models "github.com/goharbor/harbor/src/common/models"
+	"github.com/goharbor/harbor/src/replication/dao"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/util"
+)
+
+const (
+	// the user and operation of the audit entry recorded when the repository is excluded
+	auditUser      = "replication"
+	auditOperation = "exclude"
+)
+
+// Manager manages the repositories excluded from replication globally
+type Manager interface {
+	// Create a new exclusion
+	Create(*models.Exclusion) (int64, error)
+	// List all the exclusions
+	List() ([]*models.Exclusion, error)
+	// Get the specified exclusion
+	Get(int64) (*models.Exclusion, error)
+	// Remove the exclusion specified by the ID
+	Remove(int64) error
+	// Audit records the audit entry of the repository skipped as it's excluded
+	Audit(repository string) error
+}
+
+// DefaultManager ..
+type DefaultManager struct {
+}
+
+// NewDefaultManager ...
+func NewDefaultManager() Manager {
+	return &DefaultManager{}
+}
+
+// Create a new exclusion
+func (dm *DefaultManager) Create(exclusion *models.Exclusion) (int64, error) {
+	return dao.AddExclusion(exclusion)
+}
+
+// List all the exclusions
+func (dm *DefaultManager) List() ([]*models.Exclusion, error) {
+	return dao.GetExclusions()
+}
+
+// Get the specified exclusion
+func (dm *DefaultManager) Get(id int64) (*models.Exclusion, error) {
+	return dao.GetExclusion(id)
+}
+
+// Remove the exclusion specified by the ID
+func (dm *DefaultManager) Remove(id int64) error {
+	return dao.DeleteExclusion(id)
+}
+
+// Audit records the audit entry of the repository skipped as it's excluded
+func (dm *DefaultManager) Audit(repository string) error {
+	return common_dao.AddAccessLog(common_models.AccessLog{
+		Username:  auditUser,
+		RepoName:  repository,
+		RepoTag:   "N/A",
+		Operation: auditOperation,
+		OpTime:    time.Now(),
+	})
+}
+
+// Match returns the first exclusion which the repository matches, nil is returned if the
+// repository isn't excluded
+func Match(exclusions []*models.Exclusion, repository string) (*models.Exclusion, error) {
+	for _, exclusion := range exclusions {
+		m, err := util.Match(exclusion.Pattern, repository)
+		if err != nil {
+			return nil, err
+		}
+		if m {
+			return exclusion, nil
+		}
+	}
+	return nil, nil
+}
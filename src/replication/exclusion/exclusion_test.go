@@ -0,0 +1,54 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exclusion
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	exclusions := []*models.Exclusion{
+		{ID: 1, Pattern: "secrets/**"},
+		{ID: 2, Pattern: "library/{internal,private}-*"},
+	}
+
+	// no exclusions
+	e, err := Match(nil, "library/hello-world")
+	require.Nil(t, err)
+	assert.Nil(t, e)
+
+	// not excluded
+	e, err = Match(exclusions, "library/hello-world")
+	require.Nil(t, err)
+	assert.Nil(t, e)
+
+	// excluded
+	e, err = Match(exclusions, "secrets/team/app")
+	require.Nil(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, int64(1), e.ID)
+	e, err = Match(exclusions, "library/private-app")
+	require.Nil(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, int64(2), e.ID)
+
+	// invalid pattern
+	_, err = Match([]*models.Exclusion{{Pattern: "library/[a-"}}, "library/b")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,179 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// the max count of the successive blackout windows checked when calculating the end of a
+// blackout, it avoids the endless loop when the windows cover the whole week
+const maxSuccessiveBlackoutWindows = 64
+
+// BlackoutWindow is the time range of a day in which the registry must not receive the
+// replication traffic, e.g. the business hours. The window whose start is later than the
+// end crosses midnight and ends on the next day
+type BlackoutWindow struct {
+	// Start and End are the time of the day in "HH:MM" format
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Weekdays are the days of the week on which the window starts, 0 is Sunday.
+	// The window applies to all the days if it's empty
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// TimeZone is the IANA time zone name, e.g. "Asia/Shanghai", the time zone of the
+	// registry is used if it's empty, and UTC is used if neither is specified
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Validate the blackout window
+func (b *BlackoutWindow) Validate() error {
+	start, err := parseClock(b.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start %s: %v", b.Start, err)
+	}
+	end, err := parseClock(b.End)
+	if err != nil {
+		return fmt.Errorf("invalid end %s: %v", b.End, err)
+	}
+	if start == end {
+		return fmt.Errorf("the start and end of the blackout window cannot be the same")
+	}
+	for _, day := range b.Weekdays {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", day)
+		}
+	}
+	return ValidateTimezone(b.TimeZone)
+}
+
+// ValidateTimezone validates the name of the time zone against the IANA time zone database,
+// the empty name is valid and means UTC. "Local" is rejected as it depends on the host
+func ValidateTimezone(name string) error {
+	if name == "Local" {
+		return fmt.Errorf("invalid time zone %s: the local time zone of the host isn't allowed", name)
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("invalid time zone %s: %v", name, err)
+	}
+	return nil
+}
+
+// EndOf returns the end of the window if the time is in it. The window
+// starting on the previous day is checked as well if it crosses midnight
+func (b *BlackoutWindow) EndOf(t time.Time) (time.Time, bool) {
+	return b.endOf(t, time.UTC)
+}
+
+// endOf returns the end of the window if the time is in it, the start and end of the window are
+// the wall clock in the time zone of the window, or the default location if it isn't specified.
+// They're resolved on the date rather than added to the midnight, so the window keeps its wall
+// clock across the DST transitions, e.g. "02:00-04:00" lasts only one hour on the day the clock
+// springs forward and three hours on the day it falls back
+func (b *BlackoutWindow) endOf(t time.Time, defaultLocation *time.Location) (time.Time, bool) {
+	start, err := parseClock(b.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(b.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	location := defaultLocation
+	if len(b.TimeZone) > 0 {
+		if location, err = time.LoadLocation(b.TimeZone); err != nil {
+			return time.Time{}, false
+		}
+	}
+	t = t.In(location)
+	for _, offset := range []int{0, -1} {
+		year, month, day := t.AddDate(0, 0, offset).Date()
+		date := time.Date(year, month, day, 0, 0, 0, 0, location)
+		if !b.appliesTo(date.Weekday()) {
+			continue
+		}
+		from := atClock(year, month, day, start, location)
+		to := atClock(year, month, day, end, location)
+		if end < start {
+			to = atClock(year, month, day+1, end, location)
+		}
+		if !t.Before(from) && t.Before(to) {
+			return to, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// atClock returns the time of the wall clock on the date in the location. The clock skipped by the
+// DST transition is normalized to an earlier one by time.Date, it's shifted forward by the gap instead,
+// e.g. 02:30 becomes 03:30 on the day the clock springs forward, so the window never ends earlier
+func atClock(year int, month time.Month, day int, clock time.Duration, location *time.Location) time.Time {
+	hour, min := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+	t := time.Date(year, month, day, hour, min, 0, 0, location)
+	want := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if got.Before(want) {
+		t = t.Add(want.Sub(got))
+	}
+	return t
+}
+
+func (b *BlackoutWindow) appliesTo(day time.Weekday) bool {
+	if len(b.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range b.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parse the time of the day in "HH:MM" format and returns the duration since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// BlackoutEnd returns when the blackout of the registry ends if the time is in any of its blackout
+// windows. The end of the last window is returned if the windows overlap or adjoin each other.
+// The windows without the time zone are interpreted in the time zone of the registry
+func (r *Registry) BlackoutEnd(t time.Time) (time.Time, bool) {
+	// the time zone is validated when the registry is saved, UTC is used just in case
+	location := time.UTC
+	if loc, err := time.LoadLocation(r.Timezone); err == nil {
+		location = loc
+	}
+	end := t
+	inBlackout := false
+	for i := 0; i < maxSuccessiveBlackoutWindows; i++ {
+		extended := false
+		for _, window := range r.BlackoutWindows {
+			if e, ok := window.endOf(end, location); ok && e.After(end) {
+				end = e
+				extended = true
+			}
+		}
+		if !extended {
+			break
+		}
+		inBlackout = true
+	}
+	return end, inBlackout
+}
@@ -0,0 +1,193 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlackoutWindow(t *testing.T) {
+	cases := []struct {
+		window *BlackoutWindow
+		pass   bool
+	}{
+		{&BlackoutWindow{Start: "09:00", End: "17:00"}, true},
+		{&BlackoutWindow{Start: "22:00", End: "06:00", Weekdays: []time.Weekday{time.Friday}, TimeZone: "Asia/Shanghai"}, true},
+		{&BlackoutWindow{Start: "9am", End: "17:00"}, false},
+		{&BlackoutWindow{Start: "09:00", End: "24:00"}, false},
+		{&BlackoutWindow{Start: "09:00", End: "09:00"}, false},
+		{&BlackoutWindow{Start: "09:00", End: "17:00", Weekdays: []time.Weekday{7}}, false},
+		{&BlackoutWindow{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus"}, false},
+		{&BlackoutWindow{Start: "09:00", End: "17:00", TimeZone: "Local"}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.pass, c.window.Validate() == nil, "%+v", c.window)
+	}
+}
+
+func TestEndOfBlackoutWindow(t *testing.T) {
+	// 2019-06-14 is Friday
+	friday := func(hour, min int) time.Time {
+		return time.Date(2019, 6, 14, hour, min, 0, 0, time.UTC)
+	}
+
+	// business hours
+	window := &BlackoutWindow{Start: "09:00", End: "17:00"}
+	end, in := window.EndOf(friday(10, 30))
+	require.True(t, in)
+	assert.Equal(t, friday(17, 0), end.UTC())
+	_, in = window.EndOf(friday(17, 0))
+	assert.False(t, in)
+	_, in = window.EndOf(friday(8, 59))
+	assert.False(t, in)
+
+	// crosses midnight
+	window = &BlackoutWindow{Start: "22:00", End: "02:00"}
+	end, in = window.EndOf(friday(23, 0))
+	require.True(t, in)
+	assert.Equal(t, friday(26, 0), end.UTC())
+	end, in = window.EndOf(friday(1, 0))
+	require.True(t, in)
+	assert.Equal(t, friday(2, 0), end.UTC())
+
+	// weekdays, the window starting on Thursday night covers the early Friday
+	window = &BlackoutWindow{Start: "22:00", End: "02:00", Weekdays: []time.Weekday{time.Thursday}}
+	_, in = window.EndOf(friday(1, 0))
+	assert.True(t, in)
+	_, in = window.EndOf(friday(23, 0))
+	assert.False(t, in)
+
+	// time zone, 09:00-17:00 in Shanghai is 01:00-09:00 in UTC
+	window = &BlackoutWindow{Start: "09:00", End: "17:00", TimeZone: "Asia/Shanghai"}
+	end, in = window.EndOf(friday(2, 0))
+	require.True(t, in)
+	assert.Equal(t, friday(9, 0), end.UTC())
+	_, in = window.EndOf(friday(10, 0))
+	assert.False(t, in)
+}
+
+func TestBlackoutEnd(t *testing.T) {
+	now := time.Date(2019, 6, 14, 10, 0, 0, 0, time.UTC)
+
+	// no blackout windows
+	registry := &Registry{}
+	_, in := registry.BlackoutEnd(now)
+	assert.False(t, in)
+
+	// the adjoining windows
+	registry.BlackoutWindows = []*BlackoutWindow{
+		{Start: "12:00", End: "18:00"},
+		{Start: "09:00", End: "12:00"},
+	}
+	end, in := registry.BlackoutEnd(now)
+	require.True(t, in)
+	assert.Equal(t, time.Date(2019, 6, 14, 18, 0, 0, 0, time.UTC), end.UTC())
+
+	// the windows cover the whole day
+	registry.BlackoutWindows = []*BlackoutWindow{
+		{Start: "00:00", End: "12:00"},
+		{Start: "12:00", End: "00:00"},
+	}
+	_, in = registry.BlackoutEnd(now)
+	assert.True(t, in)
+}
+
+func TestValidateTimezone(t *testing.T) {
+	assert.Nil(t, ValidateTimezone(""))
+	assert.Nil(t, ValidateTimezone("UTC"))
+	assert.Nil(t, ValidateTimezone("America/New_York"))
+	assert.NotNil(t, ValidateTimezone("Local"))
+	assert.NotNil(t, ValidateTimezone("Mars/Olympus"))
+	assert.NotNil(t, ValidateTimezone("EST5EDT,M3.2.0,M11.1.0"))
+}
+
+func TestBlackoutEndInRegistryTimezone(t *testing.T) {
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2019, month, day, hour, min, 0, 0, time.UTC)
+	}
+	registry := &Registry{
+		Timezone: "America/New_York",
+		BlackoutWindows: []*BlackoutWindow{
+			{Start: "01:00", End: "04:00"},
+		},
+	}
+
+	// 01:00-04:00 in New York is 06:00-09:00 in UTC in the winter
+	end, in := registry.BlackoutEnd(utc(time.January, 15, 6, 0))
+	require.True(t, in)
+	assert.Equal(t, utc(time.January, 15, 9, 0), end.UTC())
+	_, in = registry.BlackoutEnd(utc(time.January, 15, 9, 0))
+	assert.False(t, in)
+
+	// and 05:00-08:00 in UTC in the summer
+	end, in = registry.BlackoutEnd(utc(time.July, 15, 5, 30))
+	require.True(t, in)
+	assert.Equal(t, utc(time.July, 15, 8, 0), end.UTC())
+	_, in = registry.BlackoutEnd(utc(time.July, 15, 8, 0))
+	assert.False(t, in)
+
+	// the clock springs forward from 02:00 to 03:00 on 2019-03-10, the window
+	// starts at 01:00 EST(06:00 UTC) and ends at 04:00 EDT(08:00 UTC)
+	end, in = registry.BlackoutEnd(utc(time.March, 10, 6, 30))
+	require.True(t, in)
+	assert.Equal(t, utc(time.March, 10, 8, 0), end.UTC())
+	_, in = registry.BlackoutEnd(utc(time.March, 10, 5, 59))
+	assert.False(t, in)
+	_, in = registry.BlackoutEnd(utc(time.March, 10, 8, 0))
+	assert.False(t, in)
+
+	// the clock falls back from 02:00 to 01:00 on 2019-11-03, the window
+	// starts at 01:00 EDT(05:00 UTC) and ends at 04:00 EST(09:00 UTC)
+	end, in = registry.BlackoutEnd(utc(time.November, 3, 5, 0))
+	require.True(t, in)
+	assert.Equal(t, utc(time.November, 3, 9, 0), end.UTC())
+	end, in = registry.BlackoutEnd(utc(time.November, 3, 8, 30))
+	require.True(t, in)
+	assert.Equal(t, utc(time.November, 3, 9, 0), end.UTC())
+	_, in = registry.BlackoutEnd(utc(time.November, 3, 9, 0))
+	assert.False(t, in)
+
+	// the window crossing midnight ends at the wall clock of the next day across the transition,
+	// 23:00 EST on 2019-03-09 is 04:00 UTC and 02:30 doesn't exist on 2019-03-10, so it's 03:30 EDT
+	registry.BlackoutWindows = []*BlackoutWindow{
+		{Start: "23:00", End: "02:30"},
+	}
+	end, in = registry.BlackoutEnd(utc(time.March, 10, 4, 0))
+	require.True(t, in)
+	assert.Equal(t, utc(time.March, 10, 7, 30), end.UTC())
+
+	// the time zone of the window takes precedence over the one of the registry
+	registry.BlackoutWindows = []*BlackoutWindow{
+		{Start: "01:00", End: "04:00", TimeZone: "UTC"},
+	}
+	end, in = registry.BlackoutEnd(utc(time.March, 10, 1, 0))
+	require.True(t, in)
+	assert.Equal(t, utc(time.March, 10, 4, 0), end.UTC())
+	_, in = registry.BlackoutEnd(utc(time.March, 10, 6, 30))
+	assert.False(t, in)
+
+	// UTC is used if the registry has no time zone
+	registry.Timezone = ""
+	registry.BlackoutWindows = []*BlackoutWindow{
+		{Start: "01:00", End: "04:00"},
+	}
+	end, in = registry.BlackoutEnd(utc(time.March, 10, 1, 0))
+	require.True(t, in)
+	assert.Equal(t, utc(time.March, 10, 4, 0), end.UTC())
+}
@@ -0,0 +1,83 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the actions taken when the image contains the layers whose media types aren't allowed
+const (
+	MediaTypeActionSkip = "skip"
+	MediaTypeActionFail = "fail"
+)
+
+// LayerMediaTypes limits the media types of the layers replicated to the registry, e.g. the
+// registry rejects the foreign layers of the Windows images. The layers whose media types are
+// denied, or aren't allowed if the allowed ones are specified, are disallowed, and the images
+// containing them are skipped or fail according to the action
+type LayerMediaTypes struct {
+	// Allowed are the allowed media types, empty means all the media types are allowed
+	Allowed []string `json:"allowed,omitempty"`
+	// Denied are the denied media types, they're denied even if they're allowed
+	Denied []string `json:"denied,omitempty"`
+	// Action is "skip" or "fail", the default is "skip"
+	Action string `json:"action,omitempty"`
+}
+
+// Validate the layer media types
+func (l *LayerMediaTypes) Validate() error {
+	for _, mediaType := range append(append([]string{}, l.Allowed...), l.Denied...) {
+		if len(strings.TrimSpace(mediaType)) == 0 {
+			return errors.New("the media type cannot be empty")
+		}
+	}
+	if len(l.Action) > 0 && l.Action != MediaTypeActionSkip && l.Action != MediaTypeActionFail {
+		return fmt.Errorf("invalid action %s, valid values: %s, %s", l.Action, MediaTypeActionSkip, MediaTypeActionFail)
+	}
+	return nil
+}
+
+// Disallowed returns the media types which aren't allowed among the specified ones,
+// every disallowed media type is returned only once
+func (l *LayerMediaTypes) Disallowed(mediaTypes ...string) []string {
+	allowed := map[string]bool{}
+	for _, mediaType := range l.Allowed {
+		allowed[mediaType] = true
+	}
+	denied := map[string]bool{}
+	for _, mediaType := range l.Denied {
+		denied[mediaType] = true
+	}
+	disallowed := []string{}
+	seen := map[string]bool{}
+	for _, mediaType := range mediaTypes {
+		if seen[mediaType] {
+			continue
+		}
+		seen[mediaType] = true
+		if denied[mediaType] || (len(allowed) > 0 && !allowed[mediaType]) {
+			disallowed = append(disallowed, mediaType)
+		}
+	}
+	return disallowed
+}
+
+// Fail returns whether the images containing the disallowed layers fail rather than being skipped
+func (l *LayerMediaTypes) Fail() bool {
+	return l.Action == MediaTypeActionFail
+}
@@ -0,0 +1,63 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	mediaTypeLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	mediaTypeForeignLayer = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+	mediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+func TestValidateLayerMediaTypes(t *testing.T) {
+	cases := []struct {
+		mediaTypes *LayerMediaTypes
+		pass       bool
+	}{
+		{&LayerMediaTypes{}, true},
+		{&LayerMediaTypes{Denied: []string{mediaTypeForeignLayer}}, true},
+		{&LayerMediaTypes{Allowed: []string{mediaTypeLayer}, Action: MediaTypeActionFail}, true},
+		{&LayerMediaTypes{Denied: []string{" "}}, false},
+		{&LayerMediaTypes{Action: "ignore"}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.pass, c.mediaTypes.Validate() == nil, "%+v", c.mediaTypes)
+	}
+}
+
+func TestDisallowedMediaTypes(t *testing.T) {
+	// denied
+	mediaTypes := &LayerMediaTypes{Denied: []string{mediaTypeForeignLayer}}
+	assert.Equal(t, []string{}, mediaTypes.Disallowed(mediaTypeLayer, mediaTypeOCILayer))
+	assert.Equal(t, []string{mediaTypeForeignLayer},
+		mediaTypes.Disallowed(mediaTypeForeignLayer, mediaTypeLayer, mediaTypeForeignLayer))
+	assert.False(t, mediaTypes.Fail())
+
+	// allowed
+	mediaTypes = &LayerMediaTypes{Allowed: []string{mediaTypeLayer}, Action: MediaTypeActionFail}
+	assert.Equal(t, []string{}, mediaTypes.Disallowed(mediaTypeLayer))
+	assert.Equal(t, []string{mediaTypeForeignLayer, mediaTypeOCILayer},
+		mediaTypes.Disallowed(mediaTypeLayer, mediaTypeForeignLayer, mediaTypeOCILayer))
+	assert.True(t, mediaTypes.Fail())
+
+	// the denied take precedence over the allowed
+	mediaTypes = &LayerMediaTypes{Allowed: []string{mediaTypeLayer}, Denied: []string{mediaTypeLayer}}
+	assert.Equal(t, []string{mediaTypeLayer}, mediaTypes.Disallowed(mediaTypeLayer))
+}
@@ -0,0 +1,68 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/goharbor/harbor/src/common/utils"
+)
+
+// PathTransform transforms the names of the repositories replicated to the registry, e.g. puts
+// the repositories under the fixed root path required by the registry. The transforms are
+// applied in the order: strip the prefix, replace by the regular expression and add the prefix
+type PathTransform struct {
+	// StripPrefix is removed from the beginning of the repository name if it presents
+	StripPrefix string `json:"strip_prefix,omitempty"`
+	// Pattern is the regular expression whose matches in the repository name are replaced
+	// by the Replacement, which can refer to the submatches by "$1", "${name}", etc.
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// AddPrefix is added to the beginning of the repository name
+	AddPrefix string `json:"add_prefix,omitempty"`
+}
+
+// Validate the path transform
+func (p *PathTransform) Validate() error {
+	if len(p.Pattern) > 0 {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %s: %v", p.Pattern, err)
+		}
+	}
+	if len(p.AddPrefix) > 0 && !utils.ValidateRepo(strings.TrimSuffix(p.AddPrefix, "/")) {
+		return fmt.Errorf("invalid prefix to add %s", p.AddPrefix)
+	}
+	return nil
+}
+
+// Apply the transform to the repository name, the error is returned
+// if the transformed name isn't a valid repository name
+func (p *PathTransform) Apply(repository string) (string, error) {
+	name := strings.TrimPrefix(repository, p.StripPrefix)
+	if len(p.Pattern) > 0 {
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern %s: %v", p.Pattern, err)
+		}
+		name = pattern.ReplaceAllString(name, p.Replacement)
+	}
+	name = p.AddPrefix + name
+	if !utils.ValidateRepo(name) {
+		return "", fmt.Errorf("the repository %s is transformed to an invalid name %s", repository, name)
+	}
+	return name, nil
+}
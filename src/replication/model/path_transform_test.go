@@ -0,0 +1,76 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePathTransform(t *testing.T) {
+	cases := []struct {
+		transform *PathTransform
+		pass      bool
+	}{
+		{&PathTransform{}, true},
+		{&PathTransform{AddPrefix: "root/"}, true},
+		{&PathTransform{AddPrefix: "root/sub/", StripPrefix: "library/"}, true},
+		{&PathTransform{Pattern: "^library/(.*)$", Replacement: "mirror/$1"}, true},
+		{&PathTransform{AddPrefix: "Root/"}, false},
+		{&PathTransform{AddPrefix: "root//"}, false},
+		{&PathTransform{Pattern: "library/(.*"}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.pass, c.transform.Validate() == nil, "%+v", c.transform)
+	}
+}
+
+func TestApplyPathTransform(t *testing.T) {
+	cases := []struct {
+		transform  *PathTransform
+		repository string
+		expected   string
+		pass       bool
+	}{
+		// no transform
+		{&PathTransform{}, "library/hello-world", "library/hello-world", true},
+		// add prefix
+		{&PathTransform{AddPrefix: "root/"}, "library/hello-world", "root/library/hello-world", true},
+		{&PathTransform{AddPrefix: "root/sub-"}, "library/hello-world", "root/sub-library/hello-world", true},
+		// strip prefix
+		{&PathTransform{StripPrefix: "library/"}, "library/hello-world", "hello-world", true},
+		{&PathTransform{StripPrefix: "library/"}, "test/hello-world", "test/hello-world", true},
+		{&PathTransform{StripPrefix: "library/hello-world"}, "library/hello-world", "", false},
+		// strip and add prefix
+		{&PathTransform{StripPrefix: "library/", AddPrefix: "root/"}, "library/hello-world", "root/hello-world", true},
+		// regex replace
+		{&PathTransform{Pattern: "^library/(.*)$", Replacement: "mirror/$1"}, "library/hello-world", "mirror/hello-world", true},
+		{&PathTransform{Pattern: "/", Replacement: "-"}, "library/sub/hello-world", "library-sub-hello-world", true},
+		{&PathTransform{Pattern: "hello", Replacement: "_"}, "library/hello-world", "", false},
+		{&PathTransform{Pattern: "library/(.*"}, "library/hello-world", "", false},
+		// all of them
+		{&PathTransform{StripPrefix: "library/", Pattern: "-world$", Replacement: "", AddPrefix: "root/"}, "library/hello-world", "root/hello", true},
+	}
+	for _, c := range cases {
+		name, err := c.transform.Apply(c.repository)
+		if !c.pass {
+			assert.NotNil(t, err, "%+v %s", c.transform, c.repository)
+			continue
+		}
+		assert.Nil(t, err, "%+v %s", c.transform, c.repository)
+		assert.Equal(t, c.expected, name, "%+v %s", c.transform, c.repository)
+	}
+}
@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/astaxie/beego/validation"
@@ -33,8 +34,27 @@ const (
 	TriggerTypeManual     TriggerType = "manual"
 	TriggerTypeScheduled  TriggerType = "scheduled"
 	TriggerTypeEventBased TriggerType = "event_based"
+
+	OrderBySizeAsc  = "asc"
+	OrderBySizeDesc = "desc"
+
+	// the execution fails if the repositories matched exceed the max repositories of the policy
+	MaxReposModeFail = "fail"
+	// only the first repositories up to the max repositories of the policy are replicated
+	MaxReposModeTruncate = "truncate"
 )
 
+// PolicyDisabledEvent is published when the policy is disabled automatically as its
+// executions fail consecutively
+type PolicyDisabledEvent struct {
+	PolicyID   int64  `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	// the count of the consecutive failures and the last failed execution
+	Failures    int       `json:"failures"`
+	ExecutionID int64     `json:"execution_id"`
+	OccurAt     time.Time `json:"occur_at"`
+}
+
 // Policy defines the structure of a replication policy
 type Policy struct {
 	ID          int64  `json:"id"`
@@ -50,6 +70,9 @@ type Policy struct {
 	// or keep namespaces same with the source ones (under this case,
 	// the DestNamespace should be set to empty)
 	DestNamespace string `json:"dest_namespace"`
+	// TagTransform transforms the tags of the images pushed to the destination registry,
+	// the tags of the charts aren't transformed as they're the versions of the charts
+	TagTransform *TagTransform `json:"tag_transform"`
 	// Filters
 	Filters []*Filter `json:"filters"`
 	// Trigger
@@ -59,6 +82,50 @@ type Policy struct {
 	Deletion bool `json:"deletion"`
 	// If override the image tag
 	Override bool `json:"override"`
+	// If replicate the artifacts referring to the images by digest, e.g. signatures and SBOMs
+	ReplicateReferrers bool `json:"replicate_referrers"`
+	// If pause the replication instead of failing it when the destination registry is read-only,
+	// the paused replication is resumed by the next scheduled execution
+	PauseOnReadOnly bool `json:"pause_on_read_only"`
+	// If order the repositories to replicate the ones sharing the most blobs first, the
+	// blobs pushed by the earlier repositories are mounted rather than transferred again
+	OrderBySharedBlobs bool `json:"order_by_shared_blobs"`
+	// Order the repositories by the total size of their blobs, "asc" replicates the smallest ones
+	// first and "desc" the largest ones first, the original order is kept if it's empty
+	OrderBySize string `json:"order_by_size"`
+	// If compress the uncompressed layers with gzip when pushing them to the destination registry,
+	// the digests of the layers and manifests on the destination registry differ from the source ones
+	CompressLayers bool `json:"compress_layers"`
+	// If mount the blobs from the source repository on the destination registry rather than transferring
+	// them, it's useful when the source and destination share the same registry backend. The blobs which
+	// cannot be mounted are transferred as usual
+	MountBlobs bool `json:"mount_blobs"`
+	// If log the structured log of every blob uploaded to the destination registry or skipped as it exists
+	// there already, the bytes uploaded and skipped are always summarized for every repository
+	BlobAccounting bool `json:"blob_accounting"`
+	// The max severity of the vulnerabilities of the images replicated, the tags whose scan result
+	// on the source registry is more severe are skipped. The gate is disabled if it's empty
+	MaxSeverity string `json:"max_severity"`
+	// If replicate the tags which have no scan result when the max severity is set, they're skipped by default
+	AllowUnscanned bool `json:"allow_unscanned"`
+	// If replicate only the tags signed on the source registry, the unsigned ones are skipped. Only the
+	// signatures attached as referrers, e.g. by cosign and notation, are counted as the artifacts referring
+	// to the images are replicated as well, so the signatures follow the images
+	SignedOnly bool `json:"signed_only"`
+	// The max count of the repositories replicated by one execution, it's unlimited if it's 0. The
+	// mode decides what happens when the repositories matched exceed it, "fail" fails the execution
+	// and "truncate" replicates only the first ones and reports the truncation. It's "fail" if empty
+	MaxRepos     int    `json:"max_repos"`
+	MaxReposMode string `json:"max_repos_mode"`
+	// If the execution is a dry run which checks the blobs on the destination registry and validates
+	// the manifests but pushes nothing, it's specified when starting the execution and isn't persisted
+	DryRun bool `json:"-"`
+	// The policy is disabled automatically when its executions fail consecutively for the times,
+	// the auto-disabling is turned off if it's 0
+	FailureThreshold int `json:"failure_threshold"`
+	// The count of the consecutive failed executions, it's reset when an execution succeeds or
+	// the policy is enabled again
+	ConsecutiveFailures int `json:"consecutive_failures"`
 	// Operations
 	Enabled      bool      `json:"enabled"`
 	CreationTime time.Time `json:"creation_time"`
@@ -105,6 +172,44 @@ func (p *Policy) Valid(v *validation.Validation) {
 		}
 	}
 
+	// valid the tag transform
+	if p.TagTransform != nil {
+		if err := p.TagTransform.Validate(); err != nil {
+			v.SetError("tag_transform", err.Error())
+		}
+	}
+
+	// valid the order
+	switch p.OrderBySize {
+	case "", OrderBySizeAsc, OrderBySizeDesc:
+	default:
+		v.SetError("order_by_size", fmt.Sprintf("invalid order: %s, the valid values are %s and %s", p.OrderBySize, OrderBySizeAsc, OrderBySizeDesc))
+	}
+	if p.OrderBySharedBlobs && len(p.OrderBySize) > 0 {
+		v.SetError("order_by_shared_blobs, order_by_size", "only one of them can be enabled")
+	}
+
+	// valid the scan result gate
+	if len(p.MaxSeverity) > 0 {
+		if _, err := ParseSeverity(p.MaxSeverity); err != nil {
+			v.SetError("max_severity", err.Error())
+		}
+	}
+
+	// valid the cap of the repositories
+	if p.MaxRepos < 0 {
+		v.SetError("max_repos", "cannot be negative")
+	}
+	switch p.MaxReposMode {
+	case "", MaxReposModeFail, MaxReposModeTruncate:
+	default:
+		v.SetError("max_repos_mode", fmt.Sprintf("invalid mode: %s, the valid values are %s and %s", p.MaxReposMode, MaxReposModeFail, MaxReposModeTruncate))
+	}
+
+	if p.FailureThreshold < 0 {
+		v.SetError("failure_threshold", "cannot be negative")
+	}
+
 	// valid trigger
 	if p.Trigger != nil {
 		switch p.Trigger.Type {
@@ -124,6 +229,23 @@ func (p *Policy) Valid(v *validation.Validation) {
 	}
 }
 
+// ParseSeverity parses the name of the severity of the vulnerabilities, e.g. "high". As the
+// scanner reports "critical" as "high", they're parsed as the same severity
+func ParseSeverity(name string) (models.Severity, error) {
+	switch strings.ToLower(name) {
+	case models.SeverityNone:
+		return models.SevNone, nil
+	case models.SeverityLow:
+		return models.SevLow, nil
+	case models.SeverityMedium:
+		return models.SevMedium, nil
+	case models.SeverityHigh, models.SeverityCritical:
+		return models.SevHigh, nil
+	}
+	return 0, fmt.Errorf("invalid severity: %s, the valid values are %s, %s, %s, %s and %s", name, models.SeverityNone,
+		models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical)
+}
+
 // FilterType represents the type info of the filter.
 type FilterType string
 
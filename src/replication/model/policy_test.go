@@ -19,7 +19,9 @@ import (
 	"testing"
 
 	"github.com/astaxie/beego/validation"
+	"github.com/goharbor/harbor/src/common/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidOfPolicy(t *testing.T) {
@@ -112,6 +114,126 @@ func TestValidOfPolicy(t *testing.T) {
 			},
 			pass: false,
 		},
+		// invalid order by size
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				OrderBySize: "smallest",
+			},
+			pass: false,
+		},
+		// order by size and shared blobs both enabled
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				OrderBySharedBlobs: true,
+				OrderBySize:        OrderBySizeAsc,
+			},
+			pass: false,
+		},
+		// invalid max severity
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				MaxSeverity: "severe",
+			},
+			pass: false,
+		},
+		// negative max repositories
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				MaxRepos: -1,
+			},
+			pass: false,
+		},
+		// invalid mode of the max repositories
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				MaxRepos:     100,
+				MaxReposMode: "drop",
+			},
+			pass: false,
+		},
+		// valid max repositories
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				MaxRepos:     100,
+				MaxReposMode: MaxReposModeTruncate,
+			},
+			pass: true,
+		},
+		// invalid tag transform
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				TagTransform: &TagTransform{
+					AddSuffix: "+prod",
+				},
+			},
+			pass: false,
+		},
+		// valid tag transform
+		{
+			policy: &Policy{
+				Name: "policy01",
+				SrcRegistry: &Registry{
+					ID: 0,
+				},
+				DestRegistry: &Registry{
+					ID: 1,
+				},
+				TagTransform: &TagTransform{
+					StripPrefix: "build-",
+					AddSuffix:   "-prod",
+				},
+			},
+			pass: true,
+		},
 		// invalid trigger
 		{
 			policy: &Policy{
@@ -223,3 +345,28 @@ func TestValidOfPolicy(t *testing.T) {
 		assert.Equal(t, c.pass, len(v.Errors) == 0)
 	}
 }
+
+func TestParseSeverity(t *testing.T) {
+	cases := []struct {
+		name     string
+		severity models.Severity
+		valid    bool
+	}{
+		{name: "negligible", severity: models.SevNone, valid: true},
+		{name: "Low", severity: models.SevLow, valid: true},
+		{name: "medium", severity: models.SevMedium, valid: true},
+		{name: "high", severity: models.SevHigh, valid: true},
+		{name: "critical", severity: models.SevHigh, valid: true},
+		{name: "unknown", valid: false},
+		{name: "", valid: false},
+	}
+	for _, c := range cases {
+		severity, err := ParseSeverity(c.name)
+		if !c.valid {
+			assert.NotNil(t, err)
+			continue
+		}
+		require.Nil(t, err)
+		assert.Equal(t, c.severity, severity)
+	}
+}
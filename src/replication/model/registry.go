@@ -15,9 +15,17 @@
 package model
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/astaxie/beego/validation"
 	"github.com/goharbor/harbor/src/common/models"
+	"github.com/goharbor/harbor/src/common/utils"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 )
 
 // const definition
@@ -58,6 +66,37 @@ type Credential struct {
 	AccessSecret string `json:"access_secret"`
 }
 
+// the modes of matching the labels when listing the registries
+const (
+	LabelMatchAll = "all"
+	LabelMatchAny = "any"
+)
+
+// MaxLabelLength is the max length of the label of registry
+const MaxLabelLength = 128
+
+// the manifest types which the registries prefer
+const (
+	ManifestTypeDocker = "docker"
+	ManifestTypeOCI    = "oci"
+)
+
+// the headers which cannot be customized as they're set by the credential, the
+// User-Agent of the registry or the registry client itself
+var reservedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Host":                true,
+	"User-Agent":          true,
+	"Accept":              true,
+	"Content-Type":        true,
+	"Content-Length":      true,
+	"Transfer-Encoding":   true,
+	"Connection":          true,
+}
+
+var headerNameRegexp = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
 // HealthStatus describes whether a target is healthy or not
 type HealthStatus string
 
@@ -70,8 +109,6 @@ const (
 	Unknown = "unknown"
 )
 
-// TODO add validation for Registry
-
 // Registry keeps the related info of registry
 // Data required for the secure access way is not contained here.
 // DAO layer is not considered here
@@ -86,15 +123,242 @@ type Registry struct {
 	TokenServiceURL string      `json:"token_service_url"`
 	Credential      *Credential `json:"credential"`
 	Insecure        bool        `json:"insecure"`
-	Status          string      `json:"status"`
-	CreationTime    time.Time   `json:"creation_time"`
-	UpdateTime      time.Time   `json:"update_time"`
+	UserAgent       string      `json:"user_agent"`
+	MaxConnections  int         `json:"max_connections"`
+	// JobRetentionDays is the days the finished replication jobs to the registry are kept,
+	// zero means the jobs are kept forever
+	JobRetentionDays int `json:"job_retention_days"`
+	// Draining registries aren't assigned new replication jobs, the running ones continue
+	Draining     bool      `json:"draining"`
+	Status       string    `json:"status"`
+	CreationTime time.Time `json:"creation_time"`
+	UpdateTime   time.Time `json:"update_time"`
+	// AllowedProjects are the names of the projects whose repositories can be replicated
+	// by the registry, empty means all the projects are allowed
+	AllowedProjects []string `json:"allowed_projects"`
+	// BlackoutWindows are the time ranges in which the replication jobs to the registry are deferred
+	BlackoutWindows []*BlackoutWindow `json:"blackout_windows"`
+	// PathTransform transforms the names of all the repositories replicated to the registry
+	PathTransform *PathTransform `json:"path_transform"`
+	// Labels are the structured tags of the registry, e.g. "region:eu", the registries can be listed by them
+	Labels []string `json:"labels"`
+	// PreferredManifestType is the manifest type, "docker" or "oci", which the images are converted
+	// to when replicated to the registry if it's safe, empty means the manifests are kept as they are
+	PreferredManifestType string `json:"preferred_manifest_type"`
+	// Headers are the custom headers added to every request sent to the registry, e.g. the key of an API gateway
+	Headers map[string]string `json:"headers"`
+	// FailoverURLs are the URLs of the equivalent endpoints of the registry, e.g. the one of the DR site,
+	// the first healthy one of the URL and the failover URLs is used in order
+	FailoverURLs []string `json:"failover_urls"`
+	// LayerMediaTypes limits the media types of the layers replicated to the registry
+	LayerMediaTypes *LayerMediaTypes `json:"layer_media_types"`
+	// WarmupConnections is the count of the connections to the registry established before the
+	// images are replicated to it, zero means the connections aren't warmed up
+	WarmupConnections int `json:"warmup_connections"`
+	// Timezone is the IANA time zone name of the registry, e.g. "Europe/Berlin", the blackout windows
+	// without their own time zone and the crons of the scheduled policies replicating from or to the
+	// registry are interpreted in it, UTC is used if it's empty
+	Timezone string `json:"timezone"`
+	// SSHTunnel is the SSH tunnel through the jump host which the connections to the registry are
+	// dialed through, e.g. for the registry in the isolated network, nil means they're dialed directly
+	SSHTunnel *registry_pkg.SSHTunnel `json:"ssh_tunnel"`
+	// Default marks the registry pre-selected by the UI when creating the policies, at most one registry is the default
+	Default bool `json:"default"`
+}
+
+// Valid the registry, the URL is normalized if it's valid. Both "http" and "https"
+// are accepted as the scheme and "http" is used if the scheme isn't specified
+func (r *Registry) Valid(v *validation.Validation) {
+	if len(r.Name) == 0 {
+		v.SetError("name", "cannot be empty")
+	}
+	if err := ValidateTimezone(r.Timezone); err != nil {
+		v.SetError("timezone", err.Error())
+	}
+	for _, window := range r.BlackoutWindows {
+		if err := window.Validate(); err != nil {
+			v.SetError("blackout_windows", err.Error())
+			return
+		}
+	}
+	if r.PathTransform != nil {
+		if err := r.PathTransform.Validate(); err != nil {
+			v.SetError("path_transform", err.Error())
+			return
+		}
+	}
+	if r.LayerMediaTypes != nil {
+		if err := r.LayerMediaTypes.Validate(); err != nil {
+			v.SetError("layer_media_types", err.Error())
+			return
+		}
+	}
+	if err := ValidateWarmupConnections(r.WarmupConnections); err != nil {
+		v.SetError("warmup_connections", err.Error())
+		return
+	}
+	if r.SSHTunnel != nil {
+		if err := r.SSHTunnel.Validate(); err != nil {
+			v.SetError("ssh_tunnel", err.Error())
+			return
+		}
+	}
+	if len(r.PreferredManifestType) > 0 && r.PreferredManifestType != ManifestTypeDocker &&
+		r.PreferredManifestType != ManifestTypeOCI {
+		v.SetError("preferred_manifest_type", fmt.Sprintf("invalid manifest type %s, valid values: %s, %s",
+			r.PreferredManifestType, ManifestTypeDocker, ManifestTypeOCI))
+		return
+	}
+	if err := ValidateHeaders(r.Headers); err != nil {
+		v.SetError("headers", err.Error())
+		return
+	}
+	labels, err := NormalizeLabels(r.Labels)
+	if err != nil {
+		v.SetError("labels", err.Error())
+		return
+	}
+	r.Labels = labels
+	// the canonical URL prevents SSRF security issue #3755 and the equivalent URLs
+	// are stored in the same form
+	url, err := utils.CanonicalizeEndpoint(r.URL)
+	if err != nil {
+		v.SetError("url", err.Error())
+		return
+	}
+	r.URL = url
+	urls, err := NormalizeFailoverURLs(r.URL, r.FailoverURLs)
+	if err != nil {
+		v.SetError("failover_urls", err.Error())
+		return
+	}
+	r.FailoverURLs = urls
+}
+
+// NormalizeFailoverURLs canonicalizes the failover URLs of the registry whose URL is
+// specified, the duplicated ones and the ones same with the URL are rejected
+func NormalizeFailoverURLs(url string, urls []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{url: true}
+	for _, u := range urls {
+		endpoint, err := utils.CanonicalizeEndpoint(u)
+		if err != nil {
+			return nil, err
+		}
+		if seen[endpoint] {
+			return nil, fmt.Errorf("duplicated URL %s", endpoint)
+		}
+		seen[endpoint] = true
+		normalized = append(normalized, endpoint)
+	}
+	return normalized, nil
+}
+
+// Endpoints returns the URLs of all the endpoints of the registry in the order of failover
+func (r *Registry) Endpoints() []string {
+	return append([]string{r.URL}, r.FailoverURLs...)
+}
+
+// ValidateWarmupConnections validates the count of the connections warmed up, it cannot
+// exceed the count of the idle connections kept for the registry
+func ValidateWarmupConnections(count int) error {
+	if count < 0 || count > registry_pkg.MaxIdleConnsPerHost {
+		return fmt.Errorf("invalid warmup connections %d, it should be between 0 and %d", count, registry_pkg.MaxIdleConnsPerHost)
+	}
+	return nil
+}
+
+// DefaultWarmupConnections is the count of the connections warmed up on demand for
+// the registry which doesn't set the count of the connections warmed up
+const DefaultWarmupConnections = 5
+
+// WarmupStatus is the status of the latest warmup of the connections to the registry
+type WarmupStatus struct {
+	RegistryID int64 `json:"registry_id"`
+	// Endpoint is the URL warmed up, it's one of the failover URLs if the registry fails over
+	Endpoint string `json:"endpoint"`
+	// Requested is the count of the connections requested, it's capped by the max connections of the registry
+	Requested int `json:"requested"`
+	// Established is the count of the connections established and kept alive
+	Established int       `json:"established"`
+	StartTime   time.Time `json:"start_time"`
+	// Duration is the time spent on the warmup in milliseconds
+	Duration int64  `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ValidateHeaders validates the custom headers of the registry, the reserved headers
+// like "Authorization" are rejected as they conflict with the ones set by Harbor
+func ValidateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !headerNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if reservedHeaders[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("the header %s is reserved and cannot be customized", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("the value of header %s cannot contain line breaks", name)
+		}
+	}
+	return nil
+}
+
+// NormalizeLabels validates the labels of the registry and removes the duplicated ones
+func NormalizeLabels(labels []string) ([]string, error) {
+	if labels == nil {
+		return nil, nil
+	}
+	normalized := []string{}
+	exist := map[string]struct{}{}
+	for _, label := range labels {
+		if len(label) == 0 {
+			return nil, errors.New("the label cannot be empty")
+		}
+		if len(label) > MaxLabelLength {
+			return nil, fmt.Errorf("the length of label %s exceeds %d", label, MaxLabelLength)
+		}
+		if _, ok := exist[label]; ok {
+			continue
+		}
+		exist[label] = struct{}{}
+		normalized = append(normalized, label)
+	}
+	return normalized, nil
+}
+
+// AllowsProject returns whether the repositories of the project can be replicated by the registry
+func (r *Registry) AllowsProject(project string) bool {
+	if len(r.AllowedProjects) == 0 {
+		return true
+	}
+	for _, p := range r.AllowedProjects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRepository returns whether the repository can be replicated by the registry according
+// to its project, which is the first part of the repository name, e.g. "library" of "library/hello-world"
+func (r *Registry) AllowsRepository(repository string) bool {
+	project := ""
+	if strs := strings.SplitN(repository, "/", 2); len(strs) == 2 {
+		project = strs[0]
+	}
+	return r.AllowsProject(project)
 }
 
 // RegistryQuery defines the query conditions for listing registries
 type RegistryQuery struct {
 	// Name is name of the registry to query
 	Name string
+	// Labels are the labels which the registries should have
+	Labels []string
+	// LabelMatch is "all" if the registries should have all the labels and "any" if
+	// they should have any of the labels, "all" is used if it's empty
+	LabelMatch string
 	// Pagination specifies the pagination
 	Pagination *models.Pagination
 }
@@ -0,0 +1,230 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/validation"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidOfRegistry(t *testing.T) {
+	cases := []struct {
+		registry *Registry
+		pass     bool
+		url      string
+	}{
+		// empty name
+		{
+			registry: &Registry{URL: "https://registry"},
+			pass:     false,
+		},
+		// empty URL
+		{
+			registry: &Registry{Name: "registry"},
+			pass:     false,
+		},
+		// unsupported scheme
+		{
+			registry: &Registry{Name: "registry", URL: "ftp://registry"},
+			pass:     false,
+		},
+		// invalid port
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry:99999"},
+			pass:     false,
+		},
+		// invalid preferred manifest type
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", PreferredManifestType: "schema1"},
+			pass:     false,
+		},
+		// preferred manifest type
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", PreferredManifestType: ManifestTypeOCI},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// invalid action of the layer media types
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", LayerMediaTypes: &LayerMediaTypes{Action: "ignore"}},
+			pass:     false,
+		},
+		// too many warmup connections
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", WarmupConnections: 21},
+			pass:     false,
+		},
+		// warmup connections
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", WarmupConnections: 5},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// invalid time zone
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", Timezone: "Mars/Olympus"},
+			pass:     false,
+		},
+		// time zone
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", Timezone: "Europe/Berlin"},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// invalid SSH tunnel
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", SSHTunnel: &registry_pkg.SSHTunnel{
+				Host: "jump.example.com", User: "harbor", PrivateKey: "invalid"}},
+			pass: false,
+		},
+		// reserved header
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", Headers: map[string]string{"authorization": "Bearer token"}},
+			pass:     false,
+		},
+		// custom headers
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", Headers: map[string]string{"X-Api-Key": "key"}},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// the failover URL is same with the URL
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", FailoverURLs: []string{"HTTPS://registry:443/"}},
+			pass:     false,
+		},
+		// invalid failover URL
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", FailoverURLs: []string{"ftp://registry-dr"}},
+			pass:     false,
+		},
+		// failover URLs
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry", FailoverURLs: []string{"https://registry-dr"}},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// https
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry/"},
+			pass:     true,
+			url:      "https://registry",
+		},
+		// the URL is canonicalized
+		{
+			registry: &Registry{Name: "registry", URL: "HTTPS://Reg.Example.COM:443/"},
+			pass:     true,
+			url:      "https://reg.example.com",
+		},
+		// plaintext http with custom port
+		{
+			registry: &Registry{Name: "registry", URL: "http://registry:5000"},
+			pass:     true,
+			url:      "http://registry:5000",
+		},
+		// https with custom port
+		{
+			registry: &Registry{Name: "registry", URL: "https://registry:8443"},
+			pass:     true,
+			url:      "https://registry:8443",
+		},
+		// no scheme
+		{
+			registry: &Registry{Name: "registry", URL: "registry:5000"},
+			pass:     true,
+			url:      "http://registry:5000",
+		},
+	}
+
+	for _, c := range cases {
+		v := &validation.Validation{}
+		c.registry.Valid(v)
+		assert.Equal(t, c.pass, len(v.Errors) == 0, c.registry.URL)
+		if c.pass {
+			assert.Equal(t, c.url, c.registry.URL)
+		}
+	}
+}
+
+func TestNormalizeFailoverURLs(t *testing.T) {
+	urls, err := NormalizeFailoverURLs("https://registry", nil)
+	require.Nil(t, err)
+	assert.Equal(t, []string{}, urls)
+
+	urls, err = NormalizeFailoverURLs("https://registry", []string{"HTTPS://Registry-DR:443/", "registry-dr2:5000"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"https://registry-dr", "http://registry-dr2:5000"}, urls)
+
+	_, err = NormalizeFailoverURLs("https://registry", []string{"https://registry-dr", "https://registry-dr/"})
+	assert.NotNil(t, err)
+
+	r := &Registry{URL: "https://registry", FailoverURLs: urls}
+	assert.Equal(t, []string{"https://registry", "https://registry-dr", "http://registry-dr2:5000"}, r.Endpoints())
+}
+
+func TestValidateHeaders(t *testing.T) {
+	assert.Nil(t, ValidateHeaders(nil))
+	assert.Nil(t, ValidateHeaders(map[string]string{"X-Api-Key": "key", "X-Tenant": ""}))
+
+	assert.NotNil(t, ValidateHeaders(map[string]string{"": "value"}))
+	assert.NotNil(t, ValidateHeaders(map[string]string{"X Api Key": "key"}))
+	assert.NotNil(t, ValidateHeaders(map[string]string{"X-Api-Key": "key\r\nAuthorization: Basic"}))
+	for _, name := range []string{"Authorization", "proxy-authorization", "Host", "User-Agent", "Content-Type"} {
+		assert.NotNil(t, ValidateHeaders(map[string]string{name: "value"}), name)
+	}
+}
+
+func TestNormalizeLabels(t *testing.T) {
+	labels, err := NormalizeLabels(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, labels)
+
+	labels, err = NormalizeLabels([]string{"region:eu", "team:payments", "region:eu"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"region:eu", "team:payments"}, labels)
+
+	_, err = NormalizeLabels([]string{"region:eu", ""})
+	assert.NotNil(t, err)
+	_, err = NormalizeLabels([]string{strings.Repeat("a", MaxLabelLength+1)})
+	assert.NotNil(t, err)
+}
+
+func TestAllowsProject(t *testing.T) {
+	// empty allowlist means all the projects are allowed
+	r := &Registry{}
+	assert.True(t, r.AllowsProject("library"))
+	assert.True(t, r.AllowsProject(""))
+
+	r.AllowedProjects = []string{"library", "team"}
+	assert.True(t, r.AllowsProject("library"))
+	assert.True(t, r.AllowsProject("team"))
+	assert.False(t, r.AllowsProject("secret"))
+	assert.False(t, r.AllowsProject(""))
+}
+
+func TestAllowsRepository(t *testing.T) {
+	r := &Registry{
+		AllowedProjects: []string{"library"},
+	}
+	assert.True(t, r.AllowsRepository("library/hello-world"))
+	assert.True(t, r.AllowsRepository("library/a/b"))
+	assert.False(t, r.AllowsRepository("secret/hello-world"))
+	assert.False(t, r.AllowsRepository("hello-world"))
+}
@@ -14,6 +14,10 @@
 
 package model
 
+import (
+	"github.com/goharbor/harbor/src/common/models"
+)
+
 // the resource type
 const (
 	ResourceTypeImage ResourceType = "image"
@@ -34,12 +38,20 @@ type ResourceMetadata struct {
 	Vtags      []string    `json:"v_tags"`
 	// TODO the labels should be put into tag and repository level?
 	Labels []string `json:"labels"`
+	// ImmutableTags are the tags marked immutable on the source registry, it's a hint
+	// for the destination registry to protect the replicated tags from being overwritten
+	ImmutableTags []string `json:"immutable_tags,omitempty"`
+	// ScanSeverities are the severities of the vulnerabilities of the tags scanned on the
+	// source registry, the key is the tag. The tags which have no scan result are absent
+	ScanSeverities map[string]models.Severity `json:"scan_severities,omitempty"`
+	// SignedTags are the tags which are signed on the source registry, e.g. by Notary
+	SignedTags []string `json:"signed_tags,omitempty"`
 }
 
 // GetResourceName returns the name of the resource
 // TODO remove
 func (r *ResourceMetadata) GetResourceName() string {
-	if r.Repository == nil {
+	if r == nil || r.Repository == nil {
 		return ""
 	}
 	return r.Repository.Name
@@ -61,4 +73,20 @@ type Resource struct {
 	Deleted bool `json:"deleted"`
 	// indicate whether the resource can be overridden
 	Override bool `json:"override"`
+	// indicate whether the artifacts referring to the resource should be replicated
+	ReplicateReferrers bool `json:"replicate_referrers"`
+	// indicate whether the replication is paused rather than failed when the registry is read-only
+	PauseOnReadOnly bool `json:"pause_on_read_only"`
+	// the repositories on the registry which the blobs of the resource are expected to
+	// exist in, the key is the digest and the value is the repository. They're replicated
+	// by the earlier tasks and can be mounted rather than transferred again
+	BlobSources map[string]string `json:"blob_sources,omitempty"`
+	// indicate whether the uncompressed layers are compressed when pushing them to the registry
+	CompressLayers bool `json:"compress_layers"`
+	// indicate whether the blobs are mounted from the source repository if the registry supports it
+	MountBlobs bool `json:"mount_blobs"`
+	// indicate whether the structured log of every blob uploaded or skipped is logged
+	BlobAccounting bool `json:"blob_accounting"`
+	// indicate whether only the blobs are checked and the manifests are validated without pushing anything
+	DryRun bool `json:"dry_run"`
 }
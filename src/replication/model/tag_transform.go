@@ -0,0 +1,95 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/goharbor/harbor/src/common/utils"
+)
+
+var (
+	// the prefix added to the tags must be a valid beginning of the tags
+	tagPrefixRegexp = regexp.MustCompile(`^[\w][\w.-]*$`)
+	tagSuffixRegexp = regexp.MustCompile(`^[\w.-]+$`)
+)
+
+// TagTransform transforms the tags of the images pushed to the destination registry, e.g. adds the
+// suffix of the environment or strips the prefix of the build, the tags on the source registry are
+// unchanged. The transforms are applied in the order: strip the prefix, replace by the regular
+// expression, add the prefix and add the suffix
+type TagTransform struct {
+	// StripPrefix is removed from the beginning of the tag if it presents
+	StripPrefix string `json:"strip_prefix,omitempty"`
+	// Pattern is the regular expression whose matches in the tag are replaced by the
+	// Replacement, which can refer to the submatches by "$1", "${name}", etc.
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// AddPrefix is added to the beginning of the tag
+	AddPrefix string `json:"add_prefix,omitempty"`
+	// AddSuffix is added to the end of the tag
+	AddSuffix string `json:"add_suffix,omitempty"`
+}
+
+// Validate the tag transform
+func (t *TagTransform) Validate() error {
+	if len(t.Pattern) > 0 {
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %s: %v", t.Pattern, err)
+		}
+	}
+	if len(t.AddPrefix) > 0 && !tagPrefixRegexp.MatchString(t.AddPrefix) {
+		return fmt.Errorf("invalid prefix to add %s", t.AddPrefix)
+	}
+	if len(t.AddSuffix) > 0 && !tagSuffixRegexp.MatchString(t.AddSuffix) {
+		return fmt.Errorf("invalid suffix to add %s", t.AddSuffix)
+	}
+	return nil
+}
+
+// Apply the transform to the tag, the error is returned if the transformed tag isn't a valid tag
+func (t *TagTransform) Apply(tag string) (string, error) {
+	apply, err := t.Compile()
+	if err != nil {
+		return "", err
+	}
+	return apply(tag)
+}
+
+// Compile compiles the pattern and returns the function applying the transform to the tags, so that
+// the pattern is compiled once for all the tags rather than for every tag
+func (t *TagTransform) Compile() (func(string) (string, error), error) {
+	var pattern *regexp.Regexp
+	if len(t.Pattern) > 0 {
+		p, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", t.Pattern, err)
+		}
+		pattern = p
+	}
+	return func(tag string) (string, error) {
+		name := strings.TrimPrefix(tag, t.StripPrefix)
+		if pattern != nil {
+			name = pattern.ReplaceAllString(name, t.Replacement)
+		}
+		name = t.AddPrefix + name + t.AddSuffix
+		if !utils.ValidateTag(name) {
+			return "", fmt.Errorf("the tag %s is transformed to an invalid tag %s", tag, name)
+		}
+		return name, nil
+	}, nil
+}
@@ -0,0 +1,84 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTagTransform(t *testing.T) {
+	cases := []struct {
+		transform *TagTransform
+		pass      bool
+	}{
+		{&TagTransform{}, true},
+		{&TagTransform{AddSuffix: "-prod"}, true},
+		{&TagTransform{AddSuffix: ".1"}, true},
+		{&TagTransform{AddPrefix: "prod-"}, true},
+		{&TagTransform{StripPrefix: "build-", AddPrefix: "prod_"}, true},
+		{&TagTransform{Pattern: `^v(\d+)$`, Replacement: "$1"}, true},
+		{&TagTransform{AddSuffix: "+prod"}, false},
+		{&TagTransform{AddSuffix: "/prod"}, false},
+		{&TagTransform{AddPrefix: "-prod"}, false},
+		{&TagTransform{AddPrefix: "prod:"}, false},
+		{&TagTransform{Pattern: "v(.*"}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.pass, c.transform.Validate() == nil, "%+v", c.transform)
+	}
+}
+
+func TestApplyTagTransform(t *testing.T) {
+	cases := []struct {
+		transform *TagTransform
+		tag       string
+		expected  string
+		pass      bool
+	}{
+		// no transform
+		{&TagTransform{}, "v1.0", "v1.0", true},
+		// add suffix
+		{&TagTransform{AddSuffix: "-prod"}, "v1.0", "v1.0-prod", true},
+		{&TagTransform{AddSuffix: "-prod"}, "latest", "latest-prod", true},
+		// add prefix
+		{&TagTransform{AddPrefix: "prod-"}, "v1.0", "prod-v1.0", true},
+		// strip prefix
+		{&TagTransform{StripPrefix: "build-"}, "build-v1.0", "v1.0", true},
+		{&TagTransform{StripPrefix: "build-"}, "v1.0", "v1.0", true},
+		{&TagTransform{StripPrefix: "build-"}, "build-", "", false},
+		{&TagTransform{StripPrefix: "build"}, "build-v1.0", "", false},
+		// regex replace
+		{&TagTransform{Pattern: `^build-\d+-(.*)$`, Replacement: "$1"}, "build-123-v1.0", "v1.0", true},
+		{&TagTransform{Pattern: `\+`, Replacement: "_"}, "v1.0+1", "v1.0_1", true},
+		{&TagTransform{Pattern: `\.`, Replacement: ":"}, "v1.0", "", false},
+		{&TagTransform{Pattern: "v(.*"}, "v1.0", "", false},
+		// the transformed tag is too long
+		{&TagTransform{AddSuffix: "-" + strings.Repeat("a", 128)}, "v1.0", "", false},
+		// all of them
+		{&TagTransform{StripPrefix: "build-", Pattern: `^\d+-`, Replacement: "", AddPrefix: "app-", AddSuffix: "-prod"}, "build-123-v1.0", "app-v1.0-prod", true},
+	}
+	for _, c := range cases {
+		tag, err := c.transform.Apply(c.tag)
+		if !c.pass {
+			assert.NotNil(t, err, "%+v %s", c.transform, c.tag)
+			continue
+		}
+		assert.Nil(t, err, "%+v %s", c.transform, c.tag)
+		assert.Equal(t, c.expected, tag, "%+v %s", c.transform, c.tag)
+	}
+}
@@ -15,7 +15,10 @@
 package operation
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/goharbor/harbor/src/common/job"
@@ -25,33 +28,82 @@ import (
 	"github.com/goharbor/harbor/src/replication/operation/execution"
 	"github.com/goharbor/harbor/src/replication/operation/flow"
 	"github.com/goharbor/harbor/src/replication/operation/scheduler"
+	"github.com/goharbor/harbor/src/replication/registry"
 )
 
 // Controller handles the replication-related operations: start,
 // stop, query, etc.
 type Controller interface {
-	// trigger is used to specify what this replication is triggered by
-	StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType) (int64, error)
+	// trigger is used to specify what this replication is triggered by, the annotations
+	// are attached to the execution created
+	StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType, annotations map[string]string) (int64, error)
 	StopReplication(int64) error
 	ListExecutions(...*models.ExecutionQuery) (int64, []*models.Execution, error)
 	GetExecution(int64) (*models.Execution, error)
+	// MarkExecutionRecorded marks the finished execution as recorded in the consecutive failures of its
+	// policy, true is returned only if the execution is marked by this call, so that the execution finished
+	// by the concurrent task updates is recorded exactly once
+	MarkExecutionRecorded(int64) (bool, error)
 	ListTasks(...*models.TaskQuery) (int64, []*models.Task, error)
 	GetTask(int64) (*models.Task, error)
-	UpdateTaskStatus(id int64, status string, statusCondition ...string) error
+	// UpdateTaskStatus updates the status of the task, "dead" means the job of the failed task
+	// won't be retried by the jobservice any more and the dead letter is added for the task then
+	UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error
+	// UpdateTaskStatusText records the status text of the task, e.g. the reason of the failure
+	UpdateTaskStatusText(id int64, text string) error
+	// UpdateTaskSpeed records the bytes transferred by the task and the average and peak speed in MB/s
+	UpdateTaskSpeed(id int64, bytes int64, average, peak float64) error
+	// UpdateTaskProgress records the bytes transferred and expected by the running task and the ETA in seconds
+	UpdateTaskProgress(id int64, bytes, total, eta int64) error
+	// UpdateTaskReferrers records the count of the referrers transferred by the task
+	UpdateTaskReferrers(id int64, count int) error
+	// UpdateTaskMediaTypes records the media types of the manifests pushed by the task separated by commas
+	UpdateTaskMediaTypes(id int64, mediaTypes string) error
+	// UpdateTaskEndpoints records the endpoints of the source and destination registries used by the task
+	UpdateTaskEndpoints(id int64, src, dst string) error
 	GetTaskLog(int64) ([]byte, error)
+	// RetryFailedTasks re-submits the failed tasks which end in the time range and belong to
+	// the policy if specified, returns the count of the tasks re-submitted
+	RetryFailedTasks(policyID int64, since, until *time.Time) (int, error)
+	// RetryFailedRepositories starts a child execution of the policy which only replicates the repositories
+	// failed in the execution specified by the ID, returns the ID of the child execution and the repositories
+	// retried. Nothing is started and 0 is returned if no repository failed
+	RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error)
+	// ListDeadLetters lists the dead letters of the tasks which fail permanently
+	ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error)
+	GetDeadLetter(int64) (*models.DeadLetter, error)
+	// RequeueDeadLetter re-submits the failed task of the dead letter and removes the dead letter,
+	// the task is requeued even if it has reached the retry cap as it's requested explicitly
+	RequeueDeadLetter(int64) error
+	// PreviewReplication returns the resources which the policy would replicate without transferring
+	// them, and the reasons why the repositories are skipped
+	PreviewReplication(policy *model.Policy) ([]*flow.PreviewItem, []string, error)
+	// ResumeDeferredTasks submits the tasks deferred as the registry specified by the ID
+	// was draining, returns the count of the tasks submitted
+	ResumeDeferredTasks(registryID int64) (int, error)
+	// DeferTask re-submits the job of the task whose destination registry is in blackout when the
+	// job runs, the new job is deferred to the end of the blackout. The tasks coalesced into the
+	// job are bound to the new job as well
+	DeferTask(id int64) error
 }
 
 const (
 	maxReplicators = 1024
+	// the max count of times that a failed task can be retried
+	maxTaskRetries = 3
+	// the page size used when listing all the executions or tasks
+	listPageSize = 100
 )
 
 // NewController returns a controller implementation
 func NewController(js job.Client) Controller {
+	executionMgr := execution.NewDefaultManager()
 	ctl := &controller{
 		replicators:  make(chan struct{}, maxReplicators),
-		executionMgr: execution.NewDefaultManager(),
-		scheduler:    scheduler.NewScheduler(js),
+		executionMgr: executionMgr,
+		scheduler:    scheduler.NewScheduler(js, executionMgr),
 		flowCtl:      flow.NewController(),
+		registryMgr:  registry.NewDefaultManager(),
 	}
 	for i := 0; i < maxReplicators; i++ {
 		ctl.replicators <- struct{}{}
@@ -64,19 +116,78 @@ type controller struct {
 	flowCtl      flow.Controller
 	executionMgr execution.Manager
 	scheduler    scheduler.Scheduler
+	// used to refresh the registries of the deferred tasks when they're resumed
+	registryMgr registry.Manager
 }
 
-func (c *controller) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType) (int64, error) {
+func (c *controller) StartReplication(policy *model.Policy, resource *model.Resource, trigger model.TriggerType, annotations map[string]string) (int64, error) {
 	if !policy.Enabled {
 		return 0, fmt.Errorf("the policy %d is disabled", policy.ID)
 	}
+	if err := checkLoop(policy); err != nil {
+		return 0, err
+	}
 	if len(trigger) == 0 {
 		trigger = model.TriggerTypeManual
 	}
-	id, err := createExecution(c.executionMgr, policy.ID, trigger)
+	id, err := createExecution(c.executionMgr, &models.Execution{
+		PolicyID:    policy.ID,
+		Trigger:     trigger,
+		DryRun:      policy.DryRun,
+		Annotations: annotations,
+	})
 	if err != nil {
 		return 0, err
 	}
+	c.startFlow(id, c.createFlow(id, policy, resource))
+	return id, nil
+}
+
+func (c *controller) RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error) {
+	if !policy.Enabled {
+		return 0, nil, fmt.Errorf("the policy %d is disabled", policy.ID)
+	}
+	if err := checkLoop(policy); err != nil {
+		return 0, nil, err
+	}
+	tasks, err := c.listFailedTasks(executionID, nil, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	// only the copy tasks are retried, the repositories deleted by the failed
+	// deletion tasks would be replicated back by the copy flow otherwise
+	repositories := []string{}
+	seen := map[string]struct{}{}
+	for _, task := range tasks {
+		if task.Operation != "copy" || len(task.Repository) == 0 {
+			continue
+		}
+		if _, exist := seen[task.Repository]; exist {
+			continue
+		}
+		seen[task.Repository] = struct{}{}
+		repositories = append(repositories, task.Repository)
+	}
+	if len(repositories) == 0 {
+		return 0, nil, nil
+	}
+	sort.Strings(repositories)
+
+	id, err := createExecution(c.executionMgr, &models.Execution{
+		PolicyID: policy.ID,
+		Trigger:  model.TriggerTypeManual,
+		ParentID: executionID,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	log.Infof("retry the repositories %v failed in the execution %d by the execution %d", repositories, executionID, id)
+	c.startFlow(id, flow.NewRetryFlow(c.executionMgr, c.scheduler, id, policy, repositories))
+	return id, repositories, nil
+}
+
+// start the flow of the execution in the background
+func (c *controller) startFlow(id int64, f flow.Flow) {
 	// control the count of concurrent replication requests
 	log.Debugf("waiting for the available replicator ...")
 	<-c.replicators
@@ -85,8 +196,7 @@ func (c *controller) StartReplication(policy *model.Policy, resource *model.Reso
 		defer func() {
 			c.replicators <- struct{}{}
 		}()
-		flow := c.createFlow(id, policy, resource)
-		if n, err := c.flowCtl.Start(flow); err != nil {
+		if n, err := c.flowCtl.Start(f); err != nil {
 			// only update the execution when got error.
 			// if got no error, it will be updated automatically
 			// when listing the execution records
@@ -102,7 +212,6 @@ func (c *controller) StartReplication(policy *model.Policy, resource *model.Reso
 			log.Errorf("the execution %d failed: %v", id, err)
 		}
 	}()
-	return id, nil
 }
 
 // create different replication flows according to the input parameters
@@ -153,6 +262,33 @@ func (c *controller) StopReplication(executionID int64) error {
 			log.Debugf("the task %d(job ID: %s) isn't running, its status is %s, skip", task.ID, task.JobID, task.Status)
 			continue
 		}
+		// the task isn't submitted yet, e.g. it's deferred as the registry is draining
+		if len(task.JobID) == 0 {
+			if err = c.executionMgr.UpdateTaskStatus(task.ID, models.TaskStatusStopped); err != nil {
+				return err
+			}
+			log.Debugf("the task %d has no job, its status is set to stopped", task.ID)
+			continue
+		}
+		shared, err := c.isJobShared(task)
+		if err != nil {
+			return err
+		}
+		if shared {
+			// the job is shared with the tasks of the other executions, detach the task
+			// from the job and stop it only rather than stopping the job
+			if err = c.executionMgr.UpdateTask(&models.Task{
+				ID:    task.ID,
+				JobID: "",
+			}, models.TaskPropsName.JobID); err != nil {
+				return err
+			}
+			if err = c.executionMgr.UpdateTaskStatus(task.ID, models.TaskStatusStopped); err != nil {
+				return err
+			}
+			log.Debugf("the task %d is detached from the shared job %s and stopped", task.ID, task.JobID)
+			continue
+		}
 		if err = c.scheduler.Stop(task.JobID); err != nil {
 			return err
 		}
@@ -161,6 +297,26 @@ func (c *controller) StopReplication(executionID int64) error {
 	return nil
 }
 
+// check whether the job of the task is shared with the running tasks of the other executions,
+// which happens when the identical tasks are coalesced into one job
+func (c *controller) isJobShared(task *models.Task) (bool, error) {
+	if len(task.JobID) == 0 {
+		return false, nil
+	}
+	_, tasks, err := c.ListTasks(&models.TaskQuery{
+		JobID: task.JobID,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tasks {
+		if t.ExecutionID != task.ExecutionID && isTaskRunning(t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func isTaskRunning(task *models.Task) bool {
 	if task == nil {
 		return false
@@ -168,7 +324,8 @@ func isTaskRunning(task *models.Task) bool {
 	switch task.Status {
 	case models.TaskStatusSucceed,
 		models.TaskStatusStopped,
-		models.TaskStatusFailed:
+		models.TaskStatusFailed,
+		models.TaskStatusPaused:
 		return false
 	}
 	return true
@@ -180,30 +337,461 @@ func (c *controller) ListExecutions(query ...*models.ExecutionQuery) (int64, []*
 func (c *controller) GetExecution(executionID int64) (*models.Execution, error) {
 	return c.executionMgr.Get(executionID)
 }
+func (c *controller) MarkExecutionRecorded(executionID int64) (bool, error) {
+	return c.executionMgr.MarkRecorded(executionID)
+}
 func (c *controller) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
 	return c.executionMgr.ListTasks(query...)
 }
 func (c *controller) GetTask(id int64) (*models.Task, error) {
 	return c.executionMgr.GetTask(id)
 }
-func (c *controller) UpdateTaskStatus(id int64, status string, statusCondition ...string) error {
-	return c.executionMgr.UpdateTaskStatus(id, status, statusCondition...)
+func (c *controller) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
+	// the error is returned if the status isn't updated, e.g. it doesn't match the condition,
+	// so the dead letters are only changed by the updates applied
+	if err := c.executionMgr.UpdateTaskStatus(id, status, statusCondition...); err != nil {
+		return err
+	}
+	switch status {
+	case models.TaskStatusFailed:
+		// the failed job is retried by the jobservice
+		if !dead {
+			break
+		}
+		if err := c.addDeadLetter(id); err != nil {
+			log.Errorf("failed to add the dead letter of the task %d: %v", id, err)
+		}
+	// the failed job is retried by the jobservice
+	case models.TaskStatusPending, models.TaskStatusInProgress:
+		if err := c.executionMgr.RemoveDeadLetterOfTask(id); err != nil {
+			log.Errorf("failed to remove the dead letter of the task %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// record the failed task with its last error as the dead letter
+func (c *controller) addDeadLetter(taskID int64) error {
+	task, err := c.executionMgr.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task %d not found", taskID)
+	}
+	execution, err := c.executionMgr.Get(task.ExecutionID)
+	if err != nil {
+		return err
+	}
+	if execution == nil {
+		return fmt.Errorf("execution %d not found", task.ExecutionID)
+	}
+	_, err = c.executionMgr.CreateDeadLetter(&models.DeadLetter{
+		TaskID:      task.ID,
+		ExecutionID: task.ExecutionID,
+		PolicyID:    execution.PolicyID,
+		Repository:  task.Repository,
+		SrcResource: task.SrcResource,
+		DstResource: task.DstResource,
+		JobID:       task.JobID,
+		Reason:      task.StatusText,
+		Retries:     task.Retries,
+	})
+	return err
+}
+func (c *controller) UpdateTaskStatusText(id int64, text string) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:         id,
+		StatusText: text,
+	}, models.TaskPropsName.StatusText)
+}
+func (c *controller) UpdateTaskSpeed(id int64, bytes int64, average, peak float64) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:               id,
+		BytesTransferred: bytes,
+		AverageSpeed:     average,
+		PeakSpeed:        peak,
+	}, models.TaskPropsName.BytesTransferred, models.TaskPropsName.AverageSpeed, models.TaskPropsName.PeakSpeed,
+		// the speed is checked in when the transfer completes, so the ETA is cleared
+		models.TaskPropsName.ETA)
+}
+func (c *controller) UpdateTaskProgress(id int64, bytes, total, eta int64) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:               id,
+		BytesTransferred: bytes,
+		TotalBytes:       total,
+		ETA:              eta,
+	}, models.TaskPropsName.BytesTransferred, models.TaskPropsName.TotalBytes, models.TaskPropsName.ETA)
+}
+func (c *controller) UpdateTaskReferrers(id int64, count int) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:        id,
+		Referrers: count,
+	}, models.TaskPropsName.Referrers)
+}
+func (c *controller) UpdateTaskEndpoints(id int64, src, dst string) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:          id,
+		SrcEndpoint: src,
+		DstEndpoint: dst,
+	}, models.TaskPropsName.SrcEndpoint, models.TaskPropsName.DstEndpoint)
+}
+
+func (c *controller) UpdateTaskMediaTypes(id int64, mediaTypes string) error {
+	return c.executionMgr.UpdateTask(&models.Task{
+		ID:         id,
+		MediaTypes: mediaTypes,
+	}, models.TaskPropsName.MediaTypes)
 }
 func (c *controller) GetTaskLog(taskID int64) ([]byte, error) {
 	return c.executionMgr.GetTaskLog(taskID)
 }
 
-// create the execution record in database
-func createExecution(mgr execution.Manager, policyID int64, trigger model.TriggerType) (int64, error) {
-	id, err := mgr.Create(&models.Execution{
-		PolicyID:  policyID,
-		Trigger:   trigger,
-		Status:    models.ExecutionStatusInProgress,
-		StartTime: time.Now(),
+func (c *controller) RetryFailedTasks(policyID int64, since, until *time.Time) (int, error) {
+	// list the failed tasks before re-submitting them as the re-submitted
+	// ones leave the failed status and change the pagination
+	tasks := []*models.Task{}
+	if policyID > 0 {
+		executions, err := c.listAllExecutions(policyID)
+		if err != nil {
+			return 0, err
+		}
+		for _, execution := range executions {
+			ts, err := c.listFailedTasks(execution.ID, since, until)
+			if err != nil {
+				return 0, err
+			}
+			tasks = append(tasks, ts...)
+		}
+	} else {
+		ts, err := c.listFailedTasks(0, since, until)
+		if err != nil {
+			return 0, err
+		}
+		tasks = ts
+	}
+
+	count := 0
+	executionIDs := map[int64]struct{}{}
+	for _, task := range tasks {
+		if task.Retries >= maxTaskRetries {
+			log.Debugf("the task %d has been retried %d times, skip", task.ID, task.Retries)
+			continue
+		}
+		// the task failed to be submitted has no job to retry
+		if len(task.JobID) == 0 {
+			log.Debugf("the task %d has no job ID, skip", task.ID)
+			continue
+		}
+		if err := c.retryTask(task); err != nil {
+			log.Errorf("failed to retry the task %d(job ID: %s): %v", task.ID, task.JobID, err)
+			continue
+		}
+		count++
+		executionIDs[task.ExecutionID] = struct{}{}
+	}
+
+	c.resetExecutions(executionIDs)
+	return count, nil
+}
+
+func (c *controller) ListDeadLetters(query ...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return c.executionMgr.ListDeadLetters(query...)
+}
+
+func (c *controller) GetDeadLetter(id int64) (*models.DeadLetter, error) {
+	return c.executionMgr.GetDeadLetter(id)
+}
+
+func (c *controller) RequeueDeadLetter(id int64) error {
+	letter, err := c.executionMgr.GetDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if letter == nil {
+		return fmt.Errorf("dead letter %d not found", id)
+	}
+	task, err := c.executionMgr.GetTask(letter.TaskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task %d not found", letter.TaskID)
+	}
+	if task.Status != models.TaskStatusFailed {
+		return fmt.Errorf("the status of the task %d is %s rather than %s", task.ID, task.Status, models.TaskStatusFailed)
+	}
+	if len(task.JobID) == 0 {
+		return fmt.Errorf("the task %d has no job to requeue", task.ID)
+	}
+	if err = c.retryTask(task); err != nil {
+		return err
+	}
+	c.resetExecutions(map[int64]struct{}{task.ExecutionID: {}})
+	return nil
+}
+
+// reset the executions to in progress, the status and statistics of the in progress
+// execution are refreshed by the tasks
+func (c *controller) resetExecutions(ids map[int64]struct{}) {
+	for id := range ids {
+		if err := c.executionMgr.Update(&models.Execution{
+			ID:     id,
+			Status: models.ExecutionStatusInProgress,
+		}, models.ExecutionPropsName.Status, models.ExecutionPropsName.StatusText,
+			models.ExecutionPropsName.InProgress, models.ExecutionPropsName.Succeed,
+			models.ExecutionPropsName.Failed, models.ExecutionPropsName.Stopped,
+			models.ExecutionPropsName.Paused, models.ExecutionPropsName.EndTime); err != nil {
+			log.Errorf("failed to update the execution %d: %v", id, err)
+		}
+	}
+}
+
+// re-submit the job of the failed task and reset the status of the task
+func (c *controller) retryTask(task *models.Task) error {
+	// the repository may be excluded after the task failed
+	reason, err := flow.CheckExclusion(getRepositoryName(task.SrcResource))
+	if err != nil {
+		return err
+	}
+	if len(reason) > 0 {
+		return errors.New(reason)
+	}
+	jobID, err := c.scheduler.Reschedule(task.ID, task.JobID)
+	if err != nil {
+		return err
+	}
+	// the status may have been updated by the new job
+	if err = c.executionMgr.UpdateTaskStatus(task.ID, models.TaskStatusPending, models.TaskStatusFailed); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err = c.executionMgr.UpdateTask(&models.Task{
+		ID:        task.ID,
+		JobID:     jobID,
+		StartTime: &now,
+		Retries:   task.Retries + 1,
+	}, models.TaskPropsName.JobID, models.TaskPropsName.StartTime,
+		models.TaskPropsName.EndTime, models.TaskPropsName.Retries); err != nil {
+		return err
+	}
+	// the task isn't failed permanently any more
+	if err = c.executionMgr.RemoveDeadLetterOfTask(task.ID); err != nil {
+		log.Errorf("failed to remove the dead letter of the task %d: %v", task.ID, err)
+	}
+	log.Debugf("the task %d is retried with the job %s", task.ID, jobID)
+	return nil
+}
+
+func (c *controller) DeferTask(id int64) error {
+	task, err := c.executionMgr.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task %d not found", id)
+	}
+	// the scheduler defers the new job by the blackout windows in the parameters of the job
+	jobID, err := c.scheduler.Reschedule(task.ID, task.JobID)
+	if err != nil {
+		return err
+	}
+	_, tasks, err := c.executionMgr.ListTasks(&models.TaskQuery{
+		JobID: task.JobID,
 	})
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		tasks = []*models.Task{task}
+	}
+	for _, t := range tasks {
+		if err = c.executionMgr.UpdateTask(&models.Task{
+			ID:     t.ID,
+			JobID:  jobID,
+			Status: models.TaskStatusPending,
+		}, models.TaskPropsName.JobID, models.TaskPropsName.Status); err != nil {
+			return err
+		}
+	}
+	log.Debugf("the task %d is deferred by the blackout of the destination registry with the job %s", id, jobID)
+	return nil
+}
+
+func (c *controller) PreviewReplication(policy *model.Policy) ([]*flow.PreviewItem, []string, error) {
+	return flow.Preview(policy)
+}
+
+func (c *controller) ResumeDeferredTasks(registryID int64) (int, error) {
+	// the deferred tasks which have been stopped are dropped by the scheduler
+	items, err := c.scheduler.TakeDeferred(registryID)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+	// the repositories may be excluded during the draining
+	items = c.stopExcludedTasks(items)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	// the registries recorded when the tasks were deferred may be changed during the
+	// draining, e.g. the credential is updated or the other registry stops draining
+	for _, item := range items {
+		for _, res := range []*model.Resource{item.SrcResource, item.DstResource} {
+			if res == nil || res.Registry == nil || res.Registry.ID == 0 {
+				continue
+			}
+			r, err := c.registryMgr.Get(res.Registry.ID)
+			if err != nil {
+				return 0, err
+			}
+			if r != nil {
+				res.Registry = r
+			}
+		}
+	}
+	results, err := c.scheduler.Schedule(items)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, result := range results {
+		if result.Error != nil {
+			log.Errorf("failed to schedule the deferred task %d: %v", result.TaskID, result.Error)
+			// the task isn't submitted, so it isn't retried by the jobservice
+			if err = c.UpdateTaskStatus(result.TaskID, models.TaskStatusFailed, true); err != nil {
+				log.Errorf("failed to update the status of task %d: %v", result.TaskID, err)
+			}
+			continue
+		}
+		// the other registry of the task is draining as well
+		if result.Deferred {
+			continue
+		}
+		if err = c.executionMgr.UpdateTaskStatus(result.TaskID, models.TaskStatusPending, models.TaskStatusInitialized); err != nil {
+			log.Errorf("failed to update the status of task %d: %v", result.TaskID, err)
+		}
+		now := time.Now()
+		if err = c.executionMgr.UpdateTask(&models.Task{
+			ID:        result.TaskID,
+			JobID:     result.JobID,
+			StartTime: &now,
+		}, models.TaskPropsName.JobID, models.TaskPropsName.StartTime, models.TaskPropsName.StatusText); err != nil {
+			log.Errorf("failed to update the task %d: %v", result.TaskID, err)
+		}
+		count++
+	}
+	log.Debugf("%d deferred tasks of registry %d resumed", count, registryID)
+	return count, nil
+}
+
+func (c *controller) listAllExecutions(policyID int64) ([]*models.Execution, error) {
+	executions := []*models.Execution{}
+	for page := int64(1); ; page++ {
+		_, es, err := c.executionMgr.List(&models.ExecutionQuery{
+			PolicyID: policyID,
+			Pagination: models.Pagination{
+				Page: page,
+				Size: listPageSize,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, es...)
+		if len(es) < listPageSize {
+			return executions, nil
+		}
+	}
+}
+
+func (c *controller) listFailedTasks(executionID int64, since, until *time.Time) ([]*models.Task, error) {
+	tasks := []*models.Task{}
+	for page := int64(1); ; page++ {
+		_, ts, err := c.executionMgr.ListTasks(&models.TaskQuery{
+			ExecutionID: executionID,
+			Statuses:    []string{models.TaskStatusFailed},
+			EndTimeFrom: since,
+			EndTimeTo:   until,
+			Pagination: models.Pagination{
+				Page: page,
+				Size: listPageSize,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, ts...)
+		if len(ts) < listPageSize {
+			return tasks, nil
+		}
+	}
+}
+
+// refuse to start the replication whose remote registry points to the local Harbor, which
+// makes Harbor replicate to itself and the event based replication triggers itself endlessly
+func checkLoop(policy *model.Policy) error {
+	for _, r := range []*model.Registry{policy.SrcRegistry, policy.DestRegistry} {
+		// the local Harbor has no ID
+		if r == nil || r.ID == 0 {
+			continue
+		}
+		if registry.IsLocal(r.URL) {
+			return fmt.Errorf("the registry %s of the policy %d points to the local Harbor, refuse to replicate to avoid the replication loop",
+				r.Name, policy.ID)
+		}
+	}
+	return nil
+}
+
+// create the execution record in database
+func createExecution(mgr execution.Manager, record *models.Execution) (int64, error) {
+	policyID := record.PolicyID
+	record.Status = models.ExecutionStatusInProgress
+	record.StartTime = time.Now()
+	id, err := mgr.Create(record)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create the execution record for replication based on policy %d: %v", policyID, err)
 	}
 	log.Debugf("an execution record for replication based on the policy %d created: %d", policyID, id)
 	return id, nil
 }
+
+// stop the tasks whose repositories match the global exclusions and return the rest. The tasks
+// are kept if the exclusions can't be got as they have been taken from the deferral and the
+// flow has checked the exclusions when creating them
+func (c *controller) stopExcludedTasks(items []*scheduler.ScheduleItem) []*scheduler.ScheduleItem {
+	res := []*scheduler.ScheduleItem{}
+	for _, item := range items {
+		if item.SrcResource == nil {
+			res = append(res, item)
+			continue
+		}
+		reason, err := flow.CheckExclusion(item.SrcResource.Metadata.GetResourceName())
+		if err != nil {
+			log.Errorf("failed to check the exclusions of the task %d: %v", item.TaskID, err)
+		}
+		if len(reason) == 0 {
+			res = append(res, item)
+			continue
+		}
+		if err = c.executionMgr.UpdateTaskStatus(item.TaskID, models.TaskStatusStopped, models.TaskStatusInitialized); err != nil {
+			log.Errorf("failed to update the status of task %d: %v", item.TaskID, err)
+		}
+		if err = c.UpdateTaskStatusText(item.TaskID, reason); err != nil {
+			log.Errorf("failed to update the status text of task %d: %v", item.TaskID, err)
+		}
+	}
+	return res
+}
+
+// get the repository name from the name of the resource recorded in the task,
+// e.g. "library/hello-world:[v1,v2]" -> "library/hello-world"
+func getRepositoryName(resource string) string {
+	if i := strings.Index(resource, ":"); i >= 0 {
+		return resource[:i]
+	}
+	return resource
+}
@@ -15,17 +15,22 @@
 package operation
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/exclusion"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/operation/flow"
 	"github.com/goharbor/harbor/src/replication/operation/scheduler"
+	"github.com/goharbor/harbor/src/replication/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -50,6 +55,9 @@ func (f *fakedExecutionManager) Get(int64) (*models.Execution, error) {
 func (f *fakedExecutionManager) Update(*models.Execution, ...string) error {
 	return nil
 }
+func (f *fakedExecutionManager) MarkRecorded(int64) (bool, error) {
+	return false, nil
+}
 func (f *fakedExecutionManager) Remove(int64) error {
 	return nil
 }
@@ -86,6 +94,18 @@ func (f *fakedExecutionManager) RemoveAllTasks(int64) error {
 func (f *fakedExecutionManager) GetTaskLog(int64) ([]byte, error) {
 	return []byte("message"), nil
 }
+func (f *fakedExecutionManager) CreateDeadLetter(*models.DeadLetter) (int64, error) {
+	return 1, nil
+}
+func (f *fakedExecutionManager) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 0, nil, nil
+}
+func (f *fakedExecutionManager) GetDeadLetter(int64) (*models.DeadLetter, error) {
+	return nil, nil
+}
+func (f *fakedExecutionManager) RemoveDeadLetterOfTask(int64) error {
+	return nil
+}
 
 type fakedScheduler struct{}
 
@@ -109,6 +129,12 @@ func (f *fakedScheduler) Schedule(items []*scheduler.ScheduleItem) ([]*scheduler
 	}
 	return results, nil
 }
+func (f *fakedScheduler) Reschedule(taskID int64, jobID string) (string, error) {
+	return "", nil
+}
+func (f *fakedScheduler) TakeDeferred(registryID int64) ([]*scheduler.ScheduleItem, error) {
+	return nil, nil
+}
 func (f *fakedScheduler) Stop(id string) error {
 	return nil
 }
@@ -234,7 +260,7 @@ func TestStartReplication(t *testing.T) {
 			Vtags: []string{"1.0", "2.0"},
 		},
 	}
-	_, err = ctl.StartReplication(policy, resource, model.TriggerTypeEventBased)
+	_, err = ctl.StartReplication(policy, resource, model.TriggerTypeEventBased, nil)
 	require.NotNil(t, err)
 
 	// replicate resource deletion
@@ -257,7 +283,7 @@ func TestStartReplication(t *testing.T) {
 		},
 		Deleted: true,
 	}
-	id, err := ctl.StartReplication(policy, resource, model.TriggerTypeEventBased)
+	id, err := ctl.StartReplication(policy, resource, model.TriggerTypeEventBased, nil)
 	require.Nil(t, err)
 	assert.Equal(t, int64(1), id)
 
@@ -281,7 +307,7 @@ func TestStartReplication(t *testing.T) {
 		},
 		Deleted: false,
 	}
-	id, err = ctl.StartReplication(policy, resource, model.TriggerTypeEventBased)
+	id, err = ctl.StartReplication(policy, resource, model.TriggerTypeEventBased, nil)
 	require.Nil(t, err)
 	assert.Equal(t, int64(1), id)
 
@@ -295,11 +321,40 @@ func TestStartReplication(t *testing.T) {
 		},
 		Enabled: true,
 	}
-	id, err = ctl.StartReplication(policy, nil, model.TriggerTypeEventBased)
+	id, err = ctl.StartReplication(policy, nil, model.TriggerTypeEventBased, nil)
 	require.Nil(t, err)
 	assert.Equal(t, int64(1), id)
 }
 
+func TestCheckLoop(t *testing.T) {
+	cfg := config.Config
+	defer func() {
+		config.Config = cfg
+	}()
+	config.Config = &config.Configuration{
+		ExtEndpoint: "https://harbor.example.com",
+		CoreURL:     "http://core:8080",
+	}
+
+	policy := &model.Policy{
+		ID:          1,
+		Enabled:     true,
+		SrcRegistry: &model.Registry{URL: "http://core:8080"},
+		DestRegistry: &model.Registry{
+			ID:   1,
+			Name: "remote",
+			URL:  "https://registry.example.com",
+		},
+	}
+	assert.Nil(t, checkLoop(policy))
+
+	// the remote registry points to the local Harbor
+	policy.DestRegistry.URL = "https://harbor.example.com/"
+	assert.NotNil(t, checkLoop(policy))
+	_, err := ctl.StartReplication(policy, nil, model.TriggerTypeManual, nil)
+	assert.NotNil(t, err)
+}
+
 func TestStopReplication(t *testing.T) {
 	err := ctl.StopReplication(1)
 	require.Nil(t, err)
@@ -332,7 +387,7 @@ func TestGetTask(t *testing.T) {
 }
 
 func TestUpdateTaskStatus(t *testing.T) {
-	err := ctl.UpdateTaskStatus(1, "running")
+	err := ctl.UpdateTaskStatus(1, "running", false)
 	require.Nil(t, err)
 }
 
@@ -381,3 +436,482 @@ func TestIsTaskRunning(t *testing.T) {
 		assert.Equal(t, c.isRunning, isTaskRunning(c.task))
 	}
 }
+
+// fakedRetryExecutionManager returns the tasks matching the statuses of the query
+// and records the updates of the tasks and executions
+type fakedRetryExecutionManager struct {
+	fakedExecutionManager
+	tasks      []*models.Task
+	updated    map[int64]*models.Task
+	executions []int64
+}
+
+func (f *fakedRetryExecutionManager) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
+	tasks := []*models.Task{}
+	for _, task := range f.tasks {
+		for _, status := range query[0].Statuses {
+			if task.Status == status {
+				tasks = append(tasks, task)
+				break
+			}
+		}
+	}
+	return int64(len(tasks)), tasks, nil
+}
+func (f *fakedRetryExecutionManager) UpdateTask(task *models.Task, props ...string) error {
+	f.updated[task.ID] = task
+	return nil
+}
+func (f *fakedRetryExecutionManager) Update(execution *models.Execution, props ...string) error {
+	f.executions = append(f.executions, execution.ID)
+	return nil
+}
+
+type fakedRetryScheduler struct {
+	fakedScheduler
+}
+
+func (f *fakedRetryScheduler) Reschedule(taskID int64, jobID string) (string, error) {
+	if jobID == "expired" {
+		return "", errors.New("the parameters of job expired not found")
+	}
+	return jobID + "-retry", nil
+}
+
+func TestRetryFailedTasks(t *testing.T) {
+	executionMgr := &fakedRetryExecutionManager{
+		tasks: []*models.Task{
+			{ID: 1, ExecutionID: 1, JobID: "job1", Status: models.TaskStatusFailed},
+			{ID: 2, ExecutionID: 1, JobID: "job2", Status: models.TaskStatusSucceed},
+			{ID: 3, ExecutionID: 2, JobID: "job3", Status: models.TaskStatusFailed, Retries: 1},
+			// reaches the retry cap
+			{ID: 4, ExecutionID: 2, JobID: "job4", Status: models.TaskStatusFailed, Retries: maxTaskRetries},
+			// never submitted
+			{ID: 5, ExecutionID: 2, Status: models.TaskStatusFailed},
+			// the parameters of the job are gone
+			{ID: 6, ExecutionID: 3, JobID: "expired", Status: models.TaskStatusFailed},
+			{ID: 7, ExecutionID: 3, JobID: "job7", Status: models.TaskStatusStopped},
+		},
+		updated: map[int64]*models.Task{},
+	}
+	c := &controller{
+		executionMgr: executionMgr,
+		scheduler:    &fakedRetryScheduler{},
+	}
+	since := time.Now().Add(-1 * time.Hour)
+	n, err := c.RetryFailedTasks(0, &since, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	require.Equal(t, 2, len(executionMgr.updated))
+	assert.Equal(t, "job1-retry", executionMgr.updated[1].JobID)
+	assert.Equal(t, 1, executionMgr.updated[1].Retries)
+	assert.Equal(t, "job3-retry", executionMgr.updated[3].JobID)
+	assert.Equal(t, 2, executionMgr.updated[3].Retries)
+	assert.ElementsMatch(t, []int64{1, 2}, executionMgr.executions)
+}
+
+// fakedExclusionManager returns the exclusions and records the repositories audited
+type fakedExclusionManager struct {
+	exclusion.Manager
+	exclusions []*models.Exclusion
+	audited    []string
+}
+
+func (f *fakedExclusionManager) List() ([]*models.Exclusion, error) {
+	return f.exclusions, nil
+}
+func (f *fakedExclusionManager) Audit(repository string) error {
+	f.audited = append(f.audited, repository)
+	return nil
+}
+
+func TestRetryExcludedTasks(t *testing.T) {
+	exclusionMgr := &fakedExclusionManager{
+		exclusions: []*models.Exclusion{{Pattern: "secrets/**"}},
+	}
+	flow.SetExclusionManager(exclusionMgr)
+	defer flow.SetExclusionManager(nil)
+
+	executionMgr := &fakedDeadLetterExecutionManager{
+		fakedRetryExecutionManager: fakedRetryExecutionManager{
+			tasks: []*models.Task{
+				{ID: 1, ExecutionID: 1, JobID: "job1", SrcResource: "secrets/app:[v1]", Status: models.TaskStatusFailed},
+				{ID: 2, ExecutionID: 1, JobID: "job2", SrcResource: "library/hello-world:[v1]", Status: models.TaskStatusFailed},
+			},
+			updated: map[int64]*models.Task{},
+		},
+		letters: map[int64]*models.DeadLetter{
+			1: {ID: 1, TaskID: 1},
+		},
+	}
+	c := &controller{
+		executionMgr: executionMgr,
+		scheduler:    &fakedRetryScheduler{},
+	}
+
+	// the task whose repository is excluded after it failed isn't retried
+	since := time.Now().Add(-1 * time.Hour)
+	n, err := c.RetryFailedTasks(0, &since, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	require.Equal(t, 1, len(executionMgr.updated))
+	assert.Equal(t, "job2-retry", executionMgr.updated[2].JobID)
+	assert.Equal(t, []string{"secrets/app"}, exclusionMgr.audited)
+
+	// nor requeued from the dead letter
+	err = c.RequeueDeadLetter(1)
+	require.NotNil(t, err)
+	assert.Equal(t, "the repository secrets/app is skipped as it matches the exclusion secrets/**", err.Error())
+	assert.Equal(t, 1, len(executionMgr.letters))
+	assert.Nil(t, executionMgr.updated[1])
+}
+
+// fakedRetryFlowController hands over the flows started
+type fakedRetryFlowController struct {
+	flows chan flow.Flow
+}
+
+func (f *fakedRetryFlowController) Start(fl flow.Flow) (int, error) {
+	f.flows <- fl
+	return 0, nil
+}
+
+// fakedRetryRepositoriesExecutionManager records the execution created
+type fakedRetryRepositoriesExecutionManager struct {
+	fakedRetryExecutionManager
+	created *models.Execution
+}
+
+func (f *fakedRetryRepositoriesExecutionManager) Create(execution *models.Execution) (int64, error) {
+	f.created = execution
+	return 2, nil
+}
+
+func TestRetryFailedRepositories(t *testing.T) {
+	executionMgr := &fakedRetryRepositoriesExecutionManager{
+		fakedRetryExecutionManager: fakedRetryExecutionManager{
+			tasks: []*models.Task{
+				{ID: 1, ExecutionID: 1, Operation: "copy", Repository: "library/hello-world", Status: models.TaskStatusFailed},
+				{ID: 2, ExecutionID: 1, Operation: "copy", Repository: "library/busybox", Status: models.TaskStatusFailed},
+				// the repository split into several tasks is retried once
+				{ID: 3, ExecutionID: 1, Operation: "copy", Repository: "library/busybox", Status: models.TaskStatusFailed},
+				{ID: 4, ExecutionID: 1, Operation: "copy", Repository: "library/alpine", Status: models.TaskStatusSucceed},
+				// the failed deletion isn't retried by copying the repository
+				{ID: 5, ExecutionID: 1, Operation: "deletion", Repository: "library/nginx", Status: models.TaskStatusFailed},
+			},
+		},
+	}
+	flowCtl := &fakedRetryFlowController{
+		flows: make(chan flow.Flow, 1),
+	}
+	c := &controller{
+		replicators:  make(chan struct{}, 1),
+		executionMgr: executionMgr,
+		scheduler:    &fakedScheduler{},
+		flowCtl:      flowCtl,
+	}
+	c.replicators <- struct{}{}
+	policy := &model.Policy{
+		ID:      1,
+		Enabled: true,
+	}
+
+	id, repositories, err := c.RetryFailedRepositories(policy, 1)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), id)
+	assert.Equal(t, []string{"library/busybox", "library/hello-world"}, repositories)
+	require.NotNil(t, executionMgr.created)
+	assert.Equal(t, int64(1), executionMgr.created.PolicyID)
+	assert.Equal(t, int64(1), executionMgr.created.ParentID)
+	assert.Equal(t, model.TriggerTypeManual, executionMgr.created.Trigger)
+	assert.Equal(t, models.ExecutionStatusInProgress, executionMgr.created.Status)
+	select {
+	case f := <-flowCtl.flows:
+		assert.NotNil(t, f)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the flow of the child execution isn't started")
+	}
+
+	// nothing is started if no repository failed
+	executionMgr.tasks = executionMgr.tasks[3:4]
+	executionMgr.created = nil
+	id, repositories, err = c.RetryFailedRepositories(policy, 1)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), id)
+	assert.Empty(t, repositories)
+	assert.Nil(t, executionMgr.created)
+
+	// the disabled policy
+	policy.Enabled = false
+	_, _, err = c.RetryFailedRepositories(policy, 1)
+	assert.NotNil(t, err)
+}
+
+// fakedDeadLetterExecutionManager keeps the dead letters in memory
+type fakedDeadLetterExecutionManager struct {
+	fakedRetryExecutionManager
+	letters map[int64]*models.DeadLetter
+	// the status update doesn't match the condition
+	statusConflict bool
+}
+
+func (f *fakedDeadLetterExecutionManager) UpdateTaskStatus(taskID int64, status string, statusCondition ...string) error {
+	if f.statusConflict {
+		return fmt.Errorf("Update task status failed %d: -> %s ", taskID, status)
+	}
+	return nil
+}
+
+func (f *fakedDeadLetterExecutionManager) Get(id int64) (*models.Execution, error) {
+	return &models.Execution{
+		ID:       id,
+		PolicyID: 1,
+	}, nil
+}
+func (f *fakedDeadLetterExecutionManager) GetTask(id int64) (*models.Task, error) {
+	for _, task := range f.tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakedDeadLetterExecutionManager) CreateDeadLetter(letter *models.DeadLetter) (int64, error) {
+	letter.ID = letter.TaskID
+	f.letters[letter.ID] = letter
+	return letter.ID, nil
+}
+func (f *fakedDeadLetterExecutionManager) GetDeadLetter(id int64) (*models.DeadLetter, error) {
+	return f.letters[id], nil
+}
+func (f *fakedDeadLetterExecutionManager) RemoveDeadLetterOfTask(taskID int64) error {
+	for id, letter := range f.letters {
+		if letter.TaskID == taskID {
+			delete(f.letters, id)
+		}
+	}
+	return nil
+}
+
+func TestDeadLetter(t *testing.T) {
+	executionMgr := &fakedDeadLetterExecutionManager{
+		fakedRetryExecutionManager: fakedRetryExecutionManager{
+			tasks: []*models.Task{
+				{
+					ID:          1,
+					ExecutionID: 2,
+					JobID:       "job1",
+					Repository:  "library/hello-world",
+					Status:      models.TaskStatusFailed,
+					StatusText:  "manifest unknown",
+					Retries:     maxTaskRetries,
+				},
+				{ID: 2, ExecutionID: 2, JobID: "job2", Status: models.TaskStatusSucceed},
+			},
+			updated: map[int64]*models.Task{},
+		},
+		letters: map[int64]*models.DeadLetter{},
+	}
+	c := &controller{
+		executionMgr: executionMgr,
+		scheduler:    &fakedRetryScheduler{},
+	}
+
+	// the task fails and is retried by the jobservice
+	require.Nil(t, c.UpdateTaskStatus(1, models.TaskStatusFailed, false))
+	assert.Equal(t, 0, len(executionMgr.letters))
+	require.Nil(t, c.UpdateTaskStatus(1, models.TaskStatusInProgress, false))
+	assert.Equal(t, 0, len(executionMgr.letters))
+
+	// the status isn't updated
+	executionMgr.statusConflict = true
+	assert.NotNil(t, c.UpdateTaskStatus(1, models.TaskStatusFailed, true))
+	assert.Equal(t, 0, len(executionMgr.letters))
+	executionMgr.statusConflict = false
+
+	// the task fails permanently
+	require.Nil(t, c.UpdateTaskStatus(1, models.TaskStatusFailed, true))
+	require.Equal(t, 1, len(executionMgr.letters))
+	letter := executionMgr.letters[1]
+	assert.Equal(t, int64(1), letter.TaskID)
+	assert.Equal(t, int64(2), letter.ExecutionID)
+	assert.Equal(t, int64(1), letter.PolicyID)
+	assert.Equal(t, "library/hello-world", letter.Repository)
+	assert.Equal(t, "job1", letter.JobID)
+	assert.Equal(t, "manifest unknown", letter.Reason)
+
+	// the dead letter doesn't exist
+	assert.NotNil(t, c.RequeueDeadLetter(3))
+
+	// requeue the task even if it has reached the retry cap
+	require.Nil(t, c.RequeueDeadLetter(1))
+	assert.Equal(t, 0, len(executionMgr.letters))
+	require.NotNil(t, executionMgr.updated[1])
+	assert.Equal(t, "job1-retry", executionMgr.updated[1].JobID)
+	assert.Equal(t, maxTaskRetries+1, executionMgr.updated[1].Retries)
+	assert.Equal(t, []int64{2}, executionMgr.executions)
+
+	// the task of the dead letter isn't failed
+	executionMgr.letters[2] = &models.DeadLetter{ID: 2, TaskID: 2}
+	assert.NotNil(t, c.RequeueDeadLetter(2))
+}
+
+// fakedDeferredScheduler returns the deferred items and submits the jobs named by the task IDs
+type fakedDeferredScheduler struct {
+	fakedScheduler
+	deferred []*scheduler.ScheduleItem
+}
+
+func (f *fakedDeferredScheduler) TakeDeferred(registryID int64) ([]*scheduler.ScheduleItem, error) {
+	items := f.deferred
+	f.deferred = nil
+	return items, nil
+}
+func (f *fakedDeferredScheduler) Schedule(items []*scheduler.ScheduleItem) ([]*scheduler.ScheduleResult, error) {
+	results := []*scheduler.ScheduleResult{}
+	for _, item := range items {
+		results = append(results, &scheduler.ScheduleResult{
+			TaskID: item.TaskID,
+			JobID:  fmt.Sprintf("job%d", item.TaskID),
+		})
+	}
+	return results, nil
+}
+
+// fakedRegistryManager returns the registries by their IDs
+type fakedRegistryManager struct {
+	registry.Manager
+	registries map[int64]*model.Registry
+}
+
+func (f *fakedRegistryManager) Get(id int64) (*model.Registry, error) {
+	return f.registries[id], nil
+}
+
+func TestResumeDeferredTasks(t *testing.T) {
+	executionMgr := &fakedDeadLetterExecutionManager{
+		fakedRetryExecutionManager: fakedRetryExecutionManager{
+			tasks: []*models.Task{
+				{ID: 1, ExecutionID: 1, Status: models.TaskStatusInitialized},
+				{ID: 2, ExecutionID: 1, Status: models.TaskStatusInitialized},
+			},
+			updated: map[int64]*models.Task{},
+		},
+		letters: map[int64]*models.DeadLetter{},
+	}
+	sched := &fakedDeferredScheduler{
+		deferred: []*scheduler.ScheduleItem{
+			{
+				TaskID:      1,
+				SrcResource: &model.Resource{Registry: &model.Registry{}},
+				DstResource: &model.Resource{Registry: &model.Registry{ID: 1, Draining: true, URL: "https://old.harbor.com"}},
+			},
+			{TaskID: 2},
+		},
+	}
+	c := &controller{
+		executionMgr: executionMgr,
+		scheduler:    sched,
+		registryMgr: &fakedRegistryManager{
+			registries: map[int64]*model.Registry{
+				1: {ID: 1, URL: "https://new.harbor.com"},
+			},
+		},
+	}
+	items := sched.deferred
+	n, err := c.ResumeDeferredTasks(1)
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+	require.Equal(t, 2, len(executionMgr.updated))
+	assert.Equal(t, "job1", executionMgr.updated[1].JobID)
+	assert.Equal(t, "job2", executionMgr.updated[2].JobID)
+	// the registries are refreshed except the local one
+	assert.Equal(t, "https://new.harbor.com", items[0].DstResource.Registry.URL)
+	assert.False(t, items[0].DstResource.Registry.Draining)
+	assert.Equal(t, int64(0), items[0].SrcResource.Registry.ID)
+
+	// the task whose repository is excluded during the draining is stopped
+	flow.SetExclusionManager(&fakedExclusionManager{
+		exclusions: []*models.Exclusion{{Pattern: "secrets/**"}},
+	})
+	defer flow.SetExclusionManager(nil)
+	executionMgr.updated = map[int64]*models.Task{}
+	sched.deferred = []*scheduler.ScheduleItem{
+		{
+			TaskID: 1,
+			SrcResource: &model.Resource{
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "secrets/app"},
+				},
+			},
+		},
+		{TaskID: 2},
+	}
+	n, err = c.ResumeDeferredTasks(1)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "job2", executionMgr.updated[2].JobID)
+	require.NotNil(t, executionMgr.updated[1])
+	assert.Equal(t, "the repository secrets/app is skipped as it matches the exclusion secrets/**", executionMgr.updated[1].StatusText)
+
+	// nothing is deferred
+	n, err = c.ResumeDeferredTasks(1)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+// fakedDeferExecutionManager returns the tasks matching the job ID of the query
+// and records the updates of the tasks
+type fakedDeferExecutionManager struct {
+	fakedExecutionManager
+	tasks   []*models.Task
+	updated map[int64]*models.Task
+}
+
+func (f *fakedDeferExecutionManager) GetTask(id int64) (*models.Task, error) {
+	for _, task := range f.tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakedDeferExecutionManager) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
+	tasks := []*models.Task{}
+	for _, task := range f.tasks {
+		if task.JobID == query[0].JobID {
+			tasks = append(tasks, task)
+		}
+	}
+	return int64(len(tasks)), tasks, nil
+}
+func (f *fakedDeferExecutionManager) UpdateTask(task *models.Task, props ...string) error {
+	f.updated[task.ID] = task
+	return nil
+}
+
+func TestDeferTask(t *testing.T) {
+	executionMgr := &fakedDeferExecutionManager{
+		tasks: []*models.Task{
+			{ID: 1, JobID: "job1", Status: models.TaskStatusInProgress},
+			// coalesced into the job of task 1
+			{ID: 2, JobID: "job1", Status: models.TaskStatusInProgress},
+			{ID: 3, JobID: "job3", Status: models.TaskStatusInProgress},
+		},
+		updated: map[int64]*models.Task{},
+	}
+	c := &controller{
+		executionMgr: executionMgr,
+		scheduler:    &fakedRetryScheduler{},
+	}
+	require.Nil(t, c.DeferTask(1))
+	require.Equal(t, 2, len(executionMgr.updated))
+	for _, id := range []int64{1, 2} {
+		assert.Equal(t, "job1-retry", executionMgr.updated[id].JobID)
+		assert.Equal(t, models.TaskStatusPending, executionMgr.updated[id].Status)
+	}
+
+	// the task not found
+	assert.NotNil(t, c.DeferTask(4))
+}
@@ -33,6 +33,9 @@ type Manager interface {
 	// Update the data of the specified execution, the "props" are the
 	// properties of execution that need to be updated
 	Update(execution *models.Execution, props ...string) error
+	// MarkRecorded marks the finished execution as recorded in its policy, true is
+	// returned only if the execution is marked by this call
+	MarkRecorded(int64) (bool, error)
 	// Remove the execution specified by the ID
 	Remove(int64) error
 	// Remove all executions of one policy specified by the policy ID
@@ -57,6 +60,14 @@ type Manager interface {
 	RemoveAllTasks(int64) error
 	// Get the log of one specific task
 	GetTaskLog(int64) ([]byte, error)
+	// Create the dead letter of the task which fails permanently
+	CreateDeadLetter(*models.DeadLetter) (int64, error)
+	// List the dead letters according to the query
+	ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error)
+	// Get one specified dead letter
+	GetDeadLetter(int64) (*models.DeadLetter, error)
+	// Remove the dead letter of the task specified by task ID
+	RemoveDeadLetterOfTask(int64) error
 }
 
 // DefaultManager ..
@@ -104,6 +115,11 @@ func (dm *DefaultManager) Update(execution *models.Execution, props ...string) e
 	return nil
 }
 
+// MarkRecorded marks the finished execution as recorded in its policy
+func (dm *DefaultManager) MarkRecorded(id int64) (bool, error) {
+	return dao.MarkExecutionRecorded(id)
+}
+
 // Remove the execution specified by the ID
 func (dm *DefaultManager) Remove(id int64) error {
 	return dao.DeleteExecution(id)
@@ -184,3 +200,32 @@ func (dm *DefaultManager) GetTaskLog(taskID int64) ([]byte, error) {
 
 	return utils.GetJobServiceClient().GetJobLog(task.JobID)
 }
+
+// CreateDeadLetter creates the dead letter of the task which fails permanently
+func (dm *DefaultManager) CreateDeadLetter(letter *models.DeadLetter) (int64, error) {
+	return dao.AddDeadLetter(letter)
+}
+
+// ListDeadLetters lists the dead letters according to the query
+func (dm *DefaultManager) ListDeadLetters(queries ...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	total, err := dao.GetTotalOfDeadLetters(queries...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	letters, err := dao.GetDeadLetters(queries...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, letters, nil
+}
+
+// GetDeadLetter gets one specified dead letter
+func (dm *DefaultManager) GetDeadLetter(id int64) (*models.DeadLetter, error) {
+	return dao.GetDeadLetter(id)
+}
+
+// RemoveDeadLetterOfTask removes the dead letter of the task specified by task ID
+func (dm *DefaultManager) RemoveDeadLetterOfTask(taskID int64) error {
+	return dao.DeleteDeadLetterOfTask(taskID)
+}
@@ -15,6 +15,7 @@
 package flow
 
 import (
+	"strings"
 	"time"
 
 	"github.com/goharbor/harbor/src/common/utils/log"
@@ -25,9 +26,11 @@ import (
 )
 
 type copyFlow struct {
-	executionID  int64
-	resources    []*model.Resource
-	policy       *model.Policy
+	executionID int64
+	resources   []*model.Resource
+	policy      *model.Policy
+	// only the resources of the repositories are replicated if it's specified
+	repositories []string
 	executionMgr execution.Manager
 	scheduler    scheduler.Scheduler
 }
@@ -46,6 +49,19 @@ func NewCopyFlow(executionMgr execution.Manager, scheduler scheduler.Scheduler,
 	}
 }
 
+// NewRetryFlow returns an instance of the copy flow which only replicates the resources of the
+// repositories, it's used to re-run the repositories failed in the previous execution
+func NewRetryFlow(executionMgr execution.Manager, scheduler scheduler.Scheduler,
+	executionID int64, policy *model.Policy, repositories []string) Flow {
+	return &copyFlow{
+		executionMgr: executionMgr,
+		scheduler:    scheduler,
+		executionID:  executionID,
+		policy:       policy,
+		repositories: repositories,
+	}
+}
+
 func (c *copyFlow) Run(interface{}) (int, error) {
 	srcAdapter, dstAdapter, err := initialize(c.policy)
 	if err != nil {
@@ -60,6 +76,23 @@ func (c *copyFlow) Run(interface{}) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if len(c.repositories) > 0 {
+		srcResources = filterByRepositories(srcResources, c.repositories)
+	}
+	srcResources, excluded, err := filterByExclusions(srcResources, true)
+	if err != nil {
+		return 0, err
+	}
+	srcResources, skipped := filterByAllowedProjects(srcResources, c.policy)
+	srcResources, vulnerable := filterByScanResult(srcResources, c.policy)
+	srcResources, unsigned, err := filterBySignature(srcAdapter, srcResources, c.policy)
+	if err != nil {
+		return 0, err
+	}
+	srcResources, truncation, err := limitRepositories(srcResources, c.policy)
+	if err != nil {
+		return 0, err
+	}
 
 	isStopped, err := isExecutionStopped(c.executionMgr, c.executionID)
 	if err != nil {
@@ -71,17 +104,49 @@ func (c *copyFlow) Run(interface{}) (int, error) {
 	}
 
 	if len(srcResources) == 0 {
-		markExecutionSuccess(c.executionMgr, c.executionID, "no resources need to be replicated")
+		markExecutionSuccess(c.executionMgr, c.executionID, noResourcesMessage(skipped, vulnerable, unsigned, excluded, nil))
 		log.Infof("no resources need to be replicated for the execution %d, skip", c.executionID)
 		return 0, nil
 	}
 
 	srcResources = assembleSourceResources(srcResources, c.policy)
-	dstResources := assembleDestinationResources(srcResources, c.policy)
-
-	if err = prepareForPush(dstAdapter, dstResources); err != nil {
+	srcResources, dstResources, untransformable, err := assembleDestinationResources(srcResources, c.policy)
+	if err != nil {
 		return 0, err
 	}
+	if len(srcResources) == 0 {
+		markExecutionSuccess(c.executionMgr, c.executionID, noResourcesMessage(skipped, vulnerable, unsigned, excluded, untransformable))
+		log.Infof("no resources need to be replicated for the execution %d, skip", c.executionID)
+		return 0, nil
+	}
+
+	// the repositories skipped as their tags cannot be transformed are reported along with the truncation
+	messages := untransformable
+	if len(truncation) > 0 {
+		messages = append([]string{truncation}, messages...)
+	}
+	if len(messages) > 0 {
+		if err = c.executionMgr.Update(&models.Execution{
+			ID:         c.executionID,
+			StatusText: strings.Join(messages, "; "),
+		}, "StatusText"); err != nil {
+			log.Errorf("failed to update the execution %d: %v", c.executionID, err)
+		}
+	}
+	if c.policy.OrderBySharedBlobs {
+		srcResources, dstResources = orderBySharedBlobs(srcAdapter, srcResources, dstResources)
+	}
+	if len(c.policy.OrderBySize) > 0 {
+		srcResources, dstResources = orderBySize(srcAdapter, srcResources, dstResources, c.policy.OrderBySize)
+	}
+
+	// the namespaces on the destination registry aren't created for the dry run
+	// as nothing is pushed
+	if !c.policy.DryRun {
+		if err = prepareForPush(dstAdapter, dstResources); err != nil {
+			return 0, err
+		}
+	}
 	items, err := preprocess(c.scheduler, srcResources, dstResources)
 	if err != nil {
 		return 0, err
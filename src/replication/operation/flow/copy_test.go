@@ -11,9 +11,12 @@
 package flow
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/scheduler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,3 +37,168 @@ func TestRunOfCopyFlow(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, 2, n)
 }
+
+type recordingScheduler struct {
+	fakedScheduler
+	repositories []string
+}
+
+func (r *recordingScheduler) Schedule(items []*scheduler.ScheduleItem) ([]*scheduler.ScheduleResult, error) {
+	for _, item := range items {
+		r.repositories = append(r.repositories, item.SrcResource.Metadata.Repository.Name)
+	}
+	return r.fakedScheduler.Schedule(items)
+}
+
+func TestRunOfCopyFlowWithExclusions(t *testing.T) {
+	defer SetExclusionManager(nil)
+	executionMgr := &fakedExecutionManager{}
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		// the policy matches all the repositories
+		Filters: []*model.Filter{
+			{
+				Type:  model.FilterTypeName,
+				Value: "**",
+			},
+		},
+	}
+
+	// the image is excluded and never transferred
+	mgr := &fakedExclusionManager{
+		exclusions: []*models.Exclusion{{Pattern: "library/hello-*"}},
+	}
+	SetExclusionManager(mgr)
+	sched := &recordingScheduler{}
+	n, err := NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"library/harbor"}, sched.repositories)
+	assert.Equal(t, []string{"library/hello-world"}, mgr.audited)
+
+	// the resources passed by the event are excluded as well
+	mgr.audited = nil
+	sched = &recordingScheduler{}
+	resource := &model.Resource{
+		Type: model.ResourceTypeImage,
+		Metadata: &model.ResourceMetadata{
+			Repository: &model.Repository{
+				Name: "library/hello-world",
+			},
+			Vtags: []string{"latest"},
+		},
+	}
+	n, err = NewCopyFlow(executionMgr, sched, 1, policy, resource).Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, len(sched.repositories))
+	assert.Equal(t, []string{"library/hello-world"}, mgr.audited)
+
+	// nothing is transferred if the exclusions can't be got
+	mgr.err = errors.New("error")
+	sched = &recordingScheduler{}
+	_, err = NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(sched.repositories))
+}
+
+// recordingExecutionManager records the executions updated
+type recordingExecutionManager struct {
+	fakedExecutionManager
+	updated []*models.Execution
+}
+
+func (r *recordingExecutionManager) Update(execution *models.Execution, props ...string) error {
+	r.updated = append(r.updated, execution)
+	return nil
+}
+
+func TestRunOfCopyFlowWithMaxRepos(t *testing.T) {
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		MaxRepos: 1,
+	}
+
+	// fail mode, nothing is transferred
+	executionMgr := &recordingExecutionManager{}
+	sched := &recordingScheduler{}
+	_, err := NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	require.NotNil(t, err)
+	assert.Equal(t, "the 2 repositories matched exceed the max repositories 1 of the policy", err.Error())
+	assert.Equal(t, 0, len(sched.repositories))
+
+	// truncate mode, only the first repository is transferred and the truncation is reported
+	policy.MaxReposMode = model.MaxReposModeTruncate
+	executionMgr = &recordingExecutionManager{}
+	sched = &recordingScheduler{}
+	n, err := NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"library/hello-world"}, sched.repositories)
+	require.Equal(t, 1, len(executionMgr.updated))
+	assert.Equal(t, int64(1), executionMgr.updated[0].ID)
+	assert.Equal(t, "only the first 1 of the 2 repositories matched are replicated as the max repositories of the policy is 1",
+		executionMgr.updated[0].StatusText)
+
+	// the repositories don't exceed the cap
+	policy.MaxRepos = 2
+	executionMgr = &recordingExecutionManager{}
+	sched = &recordingScheduler{}
+	n, err = NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, len(executionMgr.updated))
+}
+
+func TestRunOfRetryFlow(t *testing.T) {
+	scheduler := &fakedScheduler{}
+	executionMgr := &fakedExecutionManager{}
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+	}
+	// only the chart failed previously is replicated
+	flow := NewRetryFlow(executionMgr, scheduler, 1, policy, []string{"library/harbor"})
+	n, err := flow.Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRunOfCopyFlowWithTagTransform(t *testing.T) {
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		// the tag "latest" of the image is transformed to an empty tag
+		TagTransform: &model.TagTransform{
+			StripPrefix: "latest",
+		},
+	}
+
+	// only the image whose tags cannot be transformed is skipped and reported
+	executionMgr := &recordingExecutionManager{}
+	sched := &recordingScheduler{}
+	n, err := NewCopyFlow(executionMgr, sched, 1, policy).Run(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"library/harbor"}, sched.repositories)
+	require.Equal(t, 1, len(executionMgr.updated))
+	assert.Contains(t, executionMgr.updated[0].StatusText, "the repository library/hello-world is skipped")
+}
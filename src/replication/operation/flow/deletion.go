@@ -47,14 +47,23 @@ func (d *deletionFlow) Run(interface{}) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	srcResources, skipped := filterByAllowedProjects(srcResources, d.policy)
 	if len(srcResources) == 0 {
-		markExecutionSuccess(d.executionMgr, d.executionID, "no resources need to be replicated")
+		markExecutionSuccess(d.executionMgr, d.executionID, noResourcesMessage(skipped, nil, nil, nil, nil))
 		log.Infof("no resources need to be replicated for the execution %d, skip", d.executionID)
 		return 0, nil
 	}
 
 	srcResources = assembleSourceResources(srcResources, d.policy)
-	dstResources := assembleDestinationResources(srcResources, d.policy)
+	srcResources, dstResources, untransformable, err := assembleDestinationResources(srcResources, d.policy)
+	if err != nil {
+		return 0, err
+	}
+	if len(srcResources) == 0 {
+		markExecutionSuccess(d.executionMgr, d.executionID, noResourcesMessage(skipped, nil, nil, nil, untransformable))
+		log.Infof("no resources need to be replicated for the execution %d, skip", d.executionID)
+		return 0, nil
+	}
 
 	items, err := preprocess(d.scheduler, srcResources, dstResources)
 	if err != nil {
@@ -0,0 +1,172 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"sort"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/goharbor/harbor/src/common/utils/log"
+	adp "github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// the media types of the manifests which can be referenced by the manifest lists, they
+// aren't blobs and cannot be mounted
+var manifestMediaTypes = map[string]bool{
+	schema1.MediaTypeManifest:          true,
+	schema2.MediaTypeManifest:          true,
+	v1.MediaTypeImageManifest:          true,
+	manifestlist.MediaTypeManifestList: true,
+	v1.MediaTypeImageIndex:             true,
+}
+
+// orderBySharedBlobs orders the resources to replicate the ones sharing the most blob bytes
+// with the others first, and records the repositories on the destination registry which the
+// shared blobs are pushed into by the earlier resources, so that the later ones can mount them
+// rather than transferring them again. The source and destination resources are in pairs and
+// reordered together, the ties keep the original order
+func orderBySharedBlobs(srcAdapter adp.Adapter, srcResources, dstResources []*model.Resource) (
+	[]*model.Resource, []*model.Resource) {
+	registry, ok := srcAdapter.(adp.ImageRegistry)
+	if !ok {
+		log.Debug("the source adapter doesn't implement the \"ImageRegistry\" interface, keep the original order")
+		return srcResources, dstResources
+	}
+
+	// the blobs of every resource, the key is the digest and the value is the size
+	blobs := make([]map[string]int64, len(srcResources))
+	// the count of the resources which every blob is referenced by
+	refs := map[string]int{}
+	for i, res := range srcResources {
+		blobs[i] = resolveBlobs(registry, res)
+		for digest := range blobs[i] {
+			refs[digest]++
+		}
+	}
+
+	// the bytes which can be saved by the other resources if the resource is replicated first
+	shared := make([]int64, len(srcResources))
+	for i := range srcResources {
+		for digest, size := range blobs[i] {
+			shared[i] += size * int64(refs[digest]-1)
+		}
+	}
+	indexes := make([]int, len(srcResources))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return shared[indexes[i]] > shared[indexes[j]]
+	})
+
+	srcs := make([]*model.Resource, len(srcResources))
+	dsts := make([]*model.Resource, len(dstResources))
+	// the repository on the destination registry which the blob is pushed into first
+	pushed := map[string]string{}
+	for i, index := range indexes {
+		srcs[i] = srcResources[index]
+		dsts[i] = dstResources[index]
+		repository := dsts[i].Metadata.GetResourceName()
+		for digest := range blobs[index] {
+			if refs[digest] < 2 {
+				continue
+			}
+			repo, exist := pushed[digest]
+			if !exist {
+				pushed[digest] = repository
+				continue
+			}
+			if repo == repository {
+				continue
+			}
+			if dsts[i].BlobSources == nil {
+				dsts[i].BlobSources = map[string]string{}
+			}
+			dsts[i].BlobSources[digest] = repo
+		}
+	}
+	return srcs, dsts
+}
+
+// orderBySize orders the resources by the total size of their blobs, the smallest ones are
+// replicated first if the order is "asc" and the largest ones first if it's "desc", so that
+// many resources can complete early or the largest ones don't hold the tail of the execution.
+// The blobs shared by the tags of the same resource are counted once, the resources whose
+// size cannot be resolved, e.g. charts, are treated as zero size. The source and destination
+// resources are in pairs and reordered together, the ties keep the original order
+func orderBySize(srcAdapter adp.Adapter, srcResources, dstResources []*model.Resource, order string) (
+	[]*model.Resource, []*model.Resource) {
+	registry, ok := srcAdapter.(adp.ImageRegistry)
+	if !ok {
+		log.Debug("the source adapter doesn't implement the \"ImageRegistry\" interface, keep the original order")
+		return srcResources, dstResources
+	}
+
+	sizes := make([]int64, len(srcResources))
+	indexes := make([]int, len(srcResources))
+	for i, res := range srcResources {
+		for _, size := range resolveBlobs(registry, res) {
+			sizes[i] += size
+		}
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if order == model.OrderBySizeDesc {
+			return sizes[indexes[i]] > sizes[indexes[j]]
+		}
+		return sizes[indexes[i]] < sizes[indexes[j]]
+	})
+
+	srcs := make([]*model.Resource, len(srcResources))
+	dsts := make([]*model.Resource, len(dstResources))
+	for i, index := range indexes {
+		srcs[i] = srcResources[index]
+		dsts[i] = dstResources[index]
+	}
+	return srcs, dsts
+}
+
+// resolveBlobs pulls the manifests of the image resource and returns the blobs referenced by
+// them, the key is the digest and the value is the size. The manifests which cannot be pulled
+// are ignored as the ordering is only an optimization
+func resolveBlobs(registry adp.ImageRegistry, resource *model.Resource) map[string]int64 {
+	blobs := map[string]int64{}
+	if resource.Type != model.ResourceTypeImage || resource.Metadata == nil {
+		return blobs
+	}
+	repository := resource.Metadata.GetResourceName()
+	for _, tag := range resource.Metadata.Vtags {
+		manifest, _, err := registry.PullManifest(repository, tag, []string{
+			schema1.MediaTypeManifest,
+			schema2.MediaTypeManifest,
+			v1.MediaTypeImageManifest,
+		})
+		if err != nil {
+			log.Warningf("failed to pull the manifest of %s:%s to resolve the blobs: %v", repository, tag, err)
+			continue
+		}
+		for _, reference := range manifest.References() {
+			if manifestMediaTypes[reference.MediaType] {
+				continue
+			}
+			blobs[reference.Digest.String()] = reference.Size
+		}
+	}
+	return blobs
+}
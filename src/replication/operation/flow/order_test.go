@@ -0,0 +1,273 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	trans "github.com/goharbor/harbor/src/replication/transfer"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// register the image transfer
+	_ "github.com/goharbor/harbor/src/replication/transfer/image"
+)
+
+const (
+	registryTypeSharedBlobs model.RegistryType = "shared-blobs"
+	baseLayerSize                              = 50 << 20
+	ownLayerSize                               = 5 << 20
+)
+
+var baseLayer = digest.FromString("base")
+
+// sharedBlobsRegistry is an in-memory registry which serves as both the source and the
+// destination: every repository except "standalone" has an image built on the base layer
+type sharedBlobsRegistry struct {
+	fakedAdapter
+	// the sizes of the blobs on the source
+	sizes map[string]int64
+	// the blobs in the repositories on the destination, the key is the repository
+	blobs map[string]map[string]bool
+	// the bytes pushed to the destination
+	pushed int64
+}
+
+func newSharedBlobsRegistry() *sharedBlobsRegistry {
+	return &sharedBlobsRegistry{
+		sizes: map[string]int64{},
+		blobs: map[string]map[string]bool{},
+	}
+}
+
+func (s *sharedBlobsRegistry) PullManifest(repository, reference string, accepttedMediaTypes []string) (distribution.Manifest, string, error) {
+	layers := []distribution.Descriptor{
+		{
+			MediaType: schema2.MediaTypeLayer,
+			Digest:    digest.FromString(repository),
+			Size:      ownLayerSize,
+		},
+	}
+	if repository != "standalone" {
+		layers = append([]distribution.Descriptor{
+			{
+				MediaType: schema2.MediaTypeLayer,
+				Digest:    baseLayer,
+				Size:      baseLayerSize,
+			},
+		}, layers...)
+	}
+	manifest, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: schema2.MediaTypeImageConfig,
+			Digest:    digest.FromString("config of " + repository),
+			Size:      1024,
+		},
+		Layers: layers,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	for _, reference := range manifest.References() {
+		s.sizes[reference.Digest.String()] = reference.Size
+	}
+	return manifest, "", nil
+}
+
+func (s *sharedBlobsRegistry) BlobExist(repository, digest string) (bool, error) {
+	return s.blobs[repository][digest], nil
+}
+
+func (s *sharedBlobsRegistry) PullBlob(repository, digest string) (int64, io.ReadCloser, error) {
+	return s.sizes[digest], ioutil.NopCloser(bytes.NewReader(nil)), nil
+}
+
+func (s *sharedBlobsRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	s.add(repository, digest)
+	s.pushed += size
+	return nil
+}
+
+func (s *sharedBlobsRegistry) MountBlob(srcRepo, digest, dstRepo string) error {
+	if !s.blobs[srcRepo][digest] {
+		return fmt.Errorf("blob %s not found in %s", digest, srcRepo)
+	}
+	s.add(dstRepo, digest)
+	return nil
+}
+
+func (s *sharedBlobsRegistry) add(repository, digest string) {
+	if s.blobs[repository] == nil {
+		s.blobs[repository] = map[string]bool{}
+	}
+	s.blobs[repository][digest] = true
+}
+
+func newImageResources(registry *model.Registry, repositories ...string) []*model.Resource {
+	resources := []*model.Resource{}
+	for _, repository := range repositories {
+		resources = append(resources, &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: repository,
+				},
+				Vtags: []string{"latest"},
+			},
+			Registry: registry,
+		})
+	}
+	return resources
+}
+
+func TestOrderBySharedBlobs(t *testing.T) {
+	registry := newSharedBlobsRegistry()
+	src := newImageResources(nil, "standalone", "app1", "app2")
+	dst := newImageResources(nil, "standalone", "app1", "app2")
+	src, dst = orderBySharedBlobs(registry, src, dst)
+	require.Equal(t, 3, len(src))
+	require.Equal(t, 3, len(dst))
+
+	// the ones sharing the base layer are replicated first, the ties keep the original order
+	for i, repository := range []string{"app1", "app2", "standalone"} {
+		assert.Equal(t, repository, src[i].Metadata.GetResourceName())
+		assert.Equal(t, repository, dst[i].Metadata.GetResourceName())
+	}
+	assert.Nil(t, dst[0].BlobSources)
+	assert.Equal(t, map[string]string{baseLayer.String(): "app1"}, dst[1].BlobSources)
+	assert.Nil(t, dst[2].BlobSources)
+
+	// the adapter doesn't support pulling the manifests, keep the original order
+	src = newImageResources(nil, "standalone", "app1")
+	dst = newImageResources(nil, "standalone", "app1")
+	src, dst = orderBySharedBlobs(&fakedNonImageAdapter{}, src, dst)
+	assert.Equal(t, "standalone", src[0].Metadata.GetResourceName())
+	assert.Equal(t, "standalone", dst[0].Metadata.GetResourceName())
+}
+
+func TestOrderBySize(t *testing.T) {
+	registry := newSharedBlobsRegistry()
+	newResources := func() []*model.Resource {
+		resources := newImageResources(nil, "app1", "standalone", "app2")
+		return append(resources, &model.Resource{
+			Type: model.ResourceTypeChart,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: "chart",
+				},
+				Vtags: []string{"1.0.0"},
+			},
+		})
+	}
+	cases := []struct {
+		order        string
+		repositories []string
+	}{
+		// the chart is treated as zero size, the ties keep the original order
+		{
+			order:        model.OrderBySizeAsc,
+			repositories: []string{"chart", "standalone", "app1", "app2"},
+		},
+		{
+			order:        model.OrderBySizeDesc,
+			repositories: []string{"app1", "app2", "standalone", "chart"},
+		},
+	}
+	for _, c := range cases {
+		src, dst := orderBySize(registry, newResources(), newResources(), c.order)
+		require.Equal(t, len(c.repositories), len(src))
+		require.Equal(t, len(c.repositories), len(dst))
+		for i, repository := range c.repositories {
+			assert.Equal(t, repository, src[i].Metadata.GetResourceName())
+			assert.Equal(t, repository, dst[i].Metadata.GetResourceName())
+		}
+	}
+
+	// the adapter doesn't support pulling the manifests, keep the original order
+	src, dst := orderBySize(&fakedNonImageAdapter{}, newResources(), newResources(), model.OrderBySizeAsc)
+	assert.Equal(t, "app1", src[0].Metadata.GetResourceName())
+	assert.Equal(t, "app1", dst[0].Metadata.GetResourceName())
+}
+
+type fakedNonImageAdapter struct{}
+
+func (f *fakedNonImageAdapter) Info() (*model.RegistryInfo, error) {
+	return &model.RegistryInfo{}, nil
+}
+func (f *fakedNonImageAdapter) PrepareForPush([]*model.Resource) error {
+	return nil
+}
+func (f *fakedNonImageAdapter) HealthCheck() (model.HealthStatus, error) {
+	return model.Healthy, nil
+}
+
+// BenchmarkOrderBySharedBlobs measures the bytes pushed to the destination when replicating
+// the repositories sharing a base layer in the original order and in the order by the shared blobs
+func BenchmarkOrderBySharedBlobs(b *testing.B) {
+	var registry *sharedBlobsRegistry
+	if err := adapter.RegisterFactory(registryTypeSharedBlobs, func(*model.Registry) (adapter.Adapter, error) {
+		return registry, nil
+	}); err != nil {
+		b.Fatalf("failed to register the adapter factory: %v", err)
+	}
+	factory, err := trans.GetFactory(model.ResourceTypeImage)
+	if err != nil {
+		b.Fatalf("failed to get the transfer factory: %v", err)
+	}
+	reg := &model.Registry{
+		Type: registryTypeSharedBlobs,
+	}
+	logger := log.New(ioutil.Discard, log.NewTextFormatter(), log.WarningLevel)
+	repositories := []string{"standalone"}
+	for i := 0; i < 10; i++ {
+		repositories = append(repositories, fmt.Sprintf("app%d", i))
+	}
+
+	for _, ordered := range []bool{false, true} {
+		b.Run(fmt.Sprintf("ordered=%t", ordered), func(b *testing.B) {
+			var pushed int64
+			for i := 0; i < b.N; i++ {
+				registry = newSharedBlobsRegistry()
+				src := newImageResources(reg, repositories...)
+				dst := newImageResources(reg, repositories...)
+				if ordered {
+					src, dst = orderBySharedBlobs(registry, src, dst)
+				}
+				for j := range src {
+					tr, err := factory(logger, func() bool { return false })
+					if err != nil {
+						b.Fatalf("failed to create the transfer: %v", err)
+					}
+					if err = tr.Transfer(src[j], dst[j]); err != nil {
+						b.Fatalf("failed to transfer %s: %v", src[j].Metadata.GetResourceName(), err)
+					}
+				}
+				pushed += registry.pushed
+			}
+			b.ReportMetric(float64(pushed)/float64(b.N)/(1<<20), "MiB-pushed/op")
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	adp "github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// PreviewItem is the resource matched by the policy and the repository it would be replicated to
+type PreviewItem struct {
+	Type           model.ResourceType `json:"type"`
+	Repository     string             `json:"repository"`
+	Tags           []string           `json:"tags"`
+	DestRepository string             `json:"dest_repository"`
+	// the tags pushed to the destination repository in the same order with the source tags,
+	// they differ from the source tags if the policy has the tag transform
+	DestTags []string `json:"dest_tags"`
+	// the problems which break the replication of the resource, e.g. the other source repositories
+	// are replicated to the same destination repository after the namespace is remapped
+	Errors []string `json:"errors,omitempty"`
+	// the problems which don't break the replication, e.g. the tags existing on the destination
+	// repository with the different content
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// the max count of the tags whose content is compared with the destination registry in one preview
+const maxConflictChecks = 1000
+
+// Preview returns the resources which the policy would replicate if it ran now, the resources are
+// fetched and filtered in the same way as the copy flow but nothing is transferred. The reasons
+// why the repositories are skipped because of the global exclusions, the allowed projects, the scan results,
+// the signatures or the max repositories are returned as well
+func Preview(policy *model.Policy) ([]*PreviewItem, []string, error) {
+	factory, err := adp.GetFactory(policy.SrcRegistry.Type)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get adapter factory for registry type %s: %v", policy.SrcRegistry.Type, err)
+	}
+	srcAdapter, err := factory(policy.SrcRegistry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create adapter for source registry %s: %v", policy.SrcRegistry.URL, err)
+	}
+	srcResources, err := fetchResources(srcAdapter, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	// nothing is transferred by the preview, so no audit entries are recorded for the excluded repositories
+	srcResources, excluded, err := filterByExclusions(srcResources, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	srcResources, skipped := filterByAllowedProjects(srcResources, policy)
+	srcResources, vulnerable := filterByScanResult(srcResources, policy)
+	srcResources, unsigned, err := filterBySignature(srcAdapter, srcResources, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	skipped = append(excluded, skipped...)
+	skipped = append(skipped, vulnerable...)
+	skipped = append(skipped, unsigned...)
+	// the policy would fail rather than replicate anything if the repositories exceed the cap in the "fail" mode
+	limited, truncation, err := limitRepositories(srcResources, policy)
+	if err != nil {
+		limited = nil
+		truncation = err.Error()
+	}
+	srcResources = limited
+	if len(truncation) > 0 {
+		skipped = append(skipped, truncation)
+	}
+	srcResources = assembleSourceResources(srcResources, policy)
+	srcResources, dstResources, untransformable, err := assembleDestinationResources(srcResources, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	skipped = append(skipped, untransformable...)
+	items := []*PreviewItem{}
+	for i, src := range srcResources {
+		items = append(items, &PreviewItem{
+			Type:           src.Type,
+			Repository:     src.Metadata.GetResourceName(),
+			Tags:           src.Metadata.Vtags,
+			DestRepository: dstResources[i].Metadata.GetResourceName(),
+			DestTags:       dstResources[i].Metadata.Vtags,
+		})
+	}
+	flagCollisions(items)
+	factory, err = adp.GetFactory(policy.DestRegistry.Type)
+	if err == nil {
+		var dstAdapter adp.Adapter
+		if dstAdapter, err = factory(policy.DestRegistry); err == nil {
+			flagConflicts(srcAdapter, dstAdapter, items, policy.Override)
+		}
+	}
+	if err != nil {
+		log.Warningf("failed to create adapter for destination registry %s, the conflicts aren't checked: %v", policy.DestRegistry.URL, err)
+	}
+	return items, skipped, nil
+}
+
+// flag the items whose source repositories are replicated to the same destination repository by the
+// remapping of the namespace, e.g. the destination namespace of the policy or the path transform of the
+// registry, the images pushed by one of them would be overwritten by the others
+func flagCollisions(items []*PreviewItem) {
+	sources := map[string][]string{}
+	for _, item := range items {
+		key := string(item.Type) + ":" + item.DestRepository
+		if !containsString(sources[key], item.Repository) {
+			sources[key] = append(sources[key], item.Repository)
+		}
+	}
+	for _, item := range items {
+		repositories := sources[string(item.Type)+":"+item.DestRepository]
+		if len(repositories) < 2 {
+			continue
+		}
+		item.Errors = append(item.Errors, fmt.Sprintf("the source repositories %s collide into the same destination repository %s",
+			strings.Join(repositories, ", "), item.DestRepository))
+	}
+}
+
+// flag the tags of the images which exist on the destination repository with the different content, they're
+// overwritten if the policy overrides the tags, or aren't replicated otherwise. The problems of checking the
+// manifests are ignored as they don't mean the conflicts, and only the first tags are checked to bound the
+// requests sent by one preview
+func flagConflicts(srcAdapter, dstAdapter adp.Adapter, items []*PreviewItem, override bool) {
+	src, ok := srcAdapter.(adp.ImageRegistry)
+	if !ok {
+		return
+	}
+	dst, ok := dstAdapter.(adp.ImageRegistry)
+	if !ok {
+		return
+	}
+	checks := 0
+	for _, item := range items {
+		if item.Type != model.ResourceTypeImage {
+			continue
+		}
+		for i, tag := range item.Tags {
+			if checks >= maxConflictChecks {
+				item.Warnings = append(item.Warnings, fmt.Sprintf("the conflicts aren't checked as the tags checked exceed %d", maxConflictChecks))
+				return
+			}
+			checks++
+			dstTag := item.DestTags[i]
+			exist, dstDigest, err := dst.ManifestExist(item.DestRepository, dstTag)
+			if err != nil || !exist {
+				continue
+			}
+			exist, srcDigest, err := src.ManifestExist(item.Repository, tag)
+			if err != nil || !exist || srcDigest == dstDigest {
+				continue
+			}
+			if override {
+				item.Warnings = append(item.Warnings, fmt.Sprintf("the tag %s exists on the destination repository %s with the different content %s, it will be overwritten",
+					dstTag, item.DestRepository, dstDigest))
+				continue
+			}
+			item.Warnings = append(item.Warnings, fmt.Sprintf("the tag %s exists on the destination repository %s with the different content %s, it won't be replicated as the policy doesn't override the tags",
+				dstTag, item.DestRepository, dstDigest))
+		}
+	}
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
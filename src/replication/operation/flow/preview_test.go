@@ -0,0 +1,329 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const filteringRegistryType model.RegistryType = "faked-filtering"
+
+// filteringAdapter applies the filters to the images as the real adapters do
+type filteringAdapter struct {
+	fakedAdapter
+}
+
+func (f *filteringAdapter) FetchImages(filters []*model.Filter) ([]*model.Resource, error) {
+	resources := []*model.Resource{}
+	for name, tags := range map[string][]string{
+		"library/hello-world": {"latest", "v1.0", "v2.0"},
+		"library/busybox":     {"latest", "1.31"},
+		"private/app":         {"v1.0"},
+	} {
+		resources = append(resources, &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+				Vtags: tags,
+			},
+		})
+	}
+	return filterResources(resources, filters)
+}
+
+func TestPreview(t *testing.T) {
+	require.Nil(t, adapter.RegisterFactory(filteringRegistryType, func(*model.Registry) (adapter.Adapter, error) {
+		return &filteringAdapter{}, nil
+	}))
+
+	cases := []struct {
+		name    string
+		filters []*model.Filter
+		dest    *model.Registry
+		// the matched repositories and their tags
+		expected map[string][]string
+		skipped  int
+	}{
+		{
+			name: "no filters",
+			expected: map[string][]string{
+				"library/hello-world": {"latest", "v1.0", "v2.0"},
+				"library/busybox":     {"latest", "1.31"},
+				"private/app":         {"v1.0"},
+				"library/harbor":      {"0.2.0"},
+			},
+		},
+		{
+			name: "resource filter",
+			filters: []*model.Filter{
+				{Type: model.FilterTypeResource, Value: model.ResourceTypeChart},
+			},
+			expected: map[string][]string{
+				"library/harbor": {"0.2.0"},
+			},
+		},
+		{
+			name: "name filter",
+			filters: []*model.Filter{
+				{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+				{Type: model.FilterTypeName, Value: "library/**"},
+			},
+			expected: map[string][]string{
+				"library/hello-world": {"latest", "v1.0", "v2.0"},
+				"library/busybox":     {"latest", "1.31"},
+			},
+		},
+		{
+			name: "name and tag filters",
+			filters: []*model.Filter{
+				{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+				{Type: model.FilterTypeName, Value: "library/**"},
+				{Type: model.FilterTypeTag, Value: "v*"},
+			},
+			expected: map[string][]string{
+				"library/hello-world": {"v1.0", "v2.0"},
+			},
+		},
+		{
+			name: "no matches",
+			filters: []*model.Filter{
+				{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+				{Type: model.FilterTypeTag, Value: "nightly"},
+			},
+			expected: map[string][]string{},
+		},
+		{
+			name: "allowed projects of the destination",
+			filters: []*model.Filter{
+				{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+			},
+			dest: &model.Registry{
+				Name:            "restricted",
+				Type:            model.RegistryTypeHarbor,
+				AllowedProjects: []string{"library"},
+			},
+			expected: map[string][]string{
+				"library/hello-world": {"latest", "v1.0", "v2.0"},
+				"library/busybox":     {"latest", "1.31"},
+			},
+			skipped: 1,
+		},
+	}
+	for _, c := range cases {
+		dest := c.dest
+		if dest == nil {
+			dest = &model.Registry{
+				Type: model.RegistryTypeHarbor,
+			}
+		}
+		policy := &model.Policy{
+			SrcRegistry: &model.Registry{
+				Type: filteringRegistryType,
+			},
+			DestRegistry: dest,
+			Filters:      c.filters,
+		}
+		items, skipped, err := Preview(policy)
+		require.Nil(t, err, c.name)
+		assert.Equal(t, c.skipped, len(skipped), c.name)
+		matched := map[string][]string{}
+		for _, item := range items {
+			matched[item.Repository] = item.Tags
+			assert.Equal(t, item.Repository, item.DestRepository, c.name)
+		}
+		assert.Equal(t, c.expected, matched, c.name)
+	}
+}
+
+func TestPreviewDestRepository(t *testing.T) {
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+			PathTransform: &model.PathTransform{
+				AddPrefix: "mirror/",
+			},
+		},
+		DestNamespace: "dest",
+		Filters: []*model.Filter{
+			{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+		},
+	}
+	items, _, err := Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	assert.Equal(t, "library/hello-world", items[0].Repository)
+	assert.Equal(t, "mirror/dest/hello-world", items[0].DestRepository)
+}
+
+const (
+	collidingRegistryType   model.RegistryType = "faked-colliding"
+	conflictingRegistryType model.RegistryType = "faked-conflicting"
+)
+
+// collidingAdapter has the repositories with the same name in the different namespaces
+type collidingAdapter struct {
+	fakedAdapter
+}
+
+func (c *collidingAdapter) FetchImages(filters []*model.Filter) ([]*model.Resource, error) {
+	resources := []*model.Resource{}
+	for _, name := range []string{"library/app", "private/app", "library/busybox"} {
+		resources = append(resources, &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+				Vtags: []string{"v1", "v2"},
+			},
+		})
+	}
+	return filterResources(resources, filters)
+}
+
+func (c *collidingAdapter) ManifestExist(repository, reference string) (bool, string, error) {
+	return true, "sha256:" + repository + ":" + reference, nil
+}
+
+// conflictingAdapter has the tag "v1" of all the repositories with the different content and the
+// tag "v2" of "mirror/busybox" with the same content as "library/busybox:v2"
+type conflictingAdapter struct {
+	fakedAdapter
+}
+
+func (c *conflictingAdapter) ManifestExist(repository, reference string) (bool, string, error) {
+	switch {
+	case reference == "v1":
+		return true, "sha256:different", nil
+	case repository == "mirror/busybox" && reference == "v2":
+		return true, "sha256:library/busybox:v2", nil
+	}
+	return false, "", nil
+}
+
+func TestPreviewCollisions(t *testing.T) {
+	require.Nil(t, adapter.RegisterFactory(collidingRegistryType, func(*model.Registry) (adapter.Adapter, error) {
+		return &collidingAdapter{}, nil
+	}))
+
+	// the namespaces are kept, no collisions
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: collidingRegistryType,
+		},
+		DestRegistry: &model.Registry{
+			Type: model.RegistryTypeHarbor,
+		},
+		Filters: []*model.Filter{
+			{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+		},
+	}
+	items, _, err := Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(items))
+	for _, item := range items {
+		assert.Empty(t, item.Errors)
+	}
+
+	// "library/app" and "private/app" collide into "mirror/app" by the destination namespace
+	policy.DestNamespace = "mirror"
+	items, _, err = Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(items))
+	errs := map[string][]string{}
+	for _, item := range items {
+		errs[item.Repository] = item.Errors
+	}
+	require.Equal(t, 1, len(errs["library/app"]))
+	assert.Equal(t, "the source repositories library/app, private/app collide into the same destination repository mirror/app", errs["library/app"][0])
+	assert.Equal(t, errs["library/app"], errs["private/app"])
+	assert.Empty(t, errs["library/busybox"])
+
+	// the path transform of the registry which keeps the names distinct
+	policy.DestNamespace = ""
+	policy.DestRegistry.PathTransform = &model.PathTransform{
+		StripPrefix: "private/",
+		AddPrefix:   "library/",
+	}
+	items, _, err = Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(items))
+	for _, item := range items {
+		assert.Empty(t, item.Errors)
+	}
+	// the path transform of the registry which collides the repositories
+	policy.DestRegistry.PathTransform = &model.PathTransform{
+		Pattern:     "^[^/]+/",
+		Replacement: "mirror/",
+	}
+	items, _, err = Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(items))
+	collided := 0
+	for _, item := range items {
+		if len(item.Errors) > 0 {
+			collided++
+			assert.Equal(t, "mirror/app", item.DestRepository)
+		}
+	}
+	assert.Equal(t, 2, collided)
+}
+
+func TestPreviewConflicts(t *testing.T) {
+	require.Nil(t, adapter.RegisterFactory(conflictingRegistryType, func(*model.Registry) (adapter.Adapter, error) {
+		return &conflictingAdapter{}, nil
+	}))
+	policy := &model.Policy{
+		SrcRegistry: &model.Registry{
+			Type: collidingRegistryType,
+		},
+		DestRegistry: &model.Registry{
+			Type: conflictingRegistryType,
+		},
+		DestNamespace: "mirror",
+		Filters: []*model.Filter{
+			{Type: model.FilterTypeResource, Value: model.ResourceTypeImage},
+			{Type: model.FilterTypeName, Value: "library/busybox"},
+		},
+	}
+
+	// the tag "v1" exists with the different content and "v2" is identical
+	items, _, err := Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	assert.Empty(t, items[0].Errors)
+	require.Equal(t, 1, len(items[0].Warnings))
+	assert.Equal(t, "the tag v1 exists on the destination repository mirror/busybox with the different content sha256:different, it won't be replicated as the policy doesn't override the tags",
+		items[0].Warnings[0])
+
+	// the tag is overwritten
+	policy.Override = true
+	items, _, err = Preview(policy)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, 1, len(items[0].Warnings))
+	assert.Equal(t, "the tag v1 exists on the destination repository mirror/busybox with the different content sha256:different, it will be overwritten",
+		items[0].Warnings[0])
+}
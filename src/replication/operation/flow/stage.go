@@ -15,6 +15,7 @@
 package flow
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -23,12 +24,26 @@ import (
 	"github.com/goharbor/harbor/src/common/utils/log"
 	adp "github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/exclusion"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/operation/execution"
 	"github.com/goharbor/harbor/src/replication/operation/scheduler"
 	"github.com/goharbor/harbor/src/replication/util"
 )
 
+// the status text of the task deferred as the source or destination registry is draining
+const deferredStatusText = "deferred as the registry is draining, the task will be submitted when the draining ends"
+
+// the manager of the repositories excluded from replication globally, no repositories are
+// excluded if it isn't set
+var exclusionMgr exclusion.Manager
+
+// SetExclusionManager sets the manager of the repositories excluded from replication globally,
+// the repositories matching the exclusions are skipped by all the flows whatever the policy is
+func SetExclusionManager(mgr exclusion.Manager) {
+	exclusionMgr = mgr
+}
+
 // get/create the source registry, destination registry, source adapter and destination adapter
 func initialize(policy *model.Policy) (adp.Adapter, adp.Adapter, error) {
 	var srcAdapter, dstAdapter adp.Adapter
@@ -182,6 +197,327 @@ func filterResources(resources []*model.Resource, filters []*model.Filter) ([]*m
 	return res, nil
 }
 
+// filter out the resources whose repositories aren't in the specified ones
+func filterByRepositories(resources []*model.Resource, repositories []string) []*model.Resource {
+	names := map[string]struct{}{}
+	for _, repository := range repositories {
+		names[repository] = struct{}{}
+	}
+	res := []*model.Resource{}
+	for _, resource := range resources {
+		if _, exist := names[resource.Metadata.GetResourceName()]; exist {
+			res = append(res, resource)
+		}
+	}
+	return res
+}
+
+// filter out the resources whose projects aren't allowed by the source or destination registry,
+// the reasons why the resources are skipped are returned as well
+func filterByAllowedProjects(resources []*model.Resource, policy *model.Policy) ([]*model.Resource, []string) {
+	res := []*model.Resource{}
+	skipped := []string{}
+	for _, resource := range resources {
+		repository := resource.Metadata.Repository.Name
+		allowed := true
+		for _, registry := range []*model.Registry{policy.SrcRegistry, policy.DestRegistry} {
+			if registry != nil && !registry.AllowsRepository(repository) {
+				reason := fmt.Sprintf("the repository %s is skipped as its project isn't in the allowed projects %v of the registry %s",
+					repository, registry.AllowedProjects, registry.Name)
+				log.Warning(reason)
+				skipped = append(skipped, reason)
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			res = append(res, resource)
+		}
+	}
+	return res, skipped
+}
+
+// filter out the resources whose repositories match the global exclusions, they're never replicated
+// whatever the policy is. The audit entry of each repository excluded is recorded if "audit" is true and
+// the reasons why the repositories are skipped are returned. The error is returned if the exclusions
+// can't be got, so the excluded repositories aren't replicated by accident
+func filterByExclusions(resources []*model.Resource, audit bool) ([]*model.Resource, []string, error) {
+	if exclusionMgr == nil {
+		return resources, nil, nil
+	}
+	exclusions, err := exclusionMgr.List()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the exclusions of the repositories: %v", err)
+	}
+	if len(exclusions) == 0 {
+		return resources, nil, nil
+	}
+	res := []*model.Resource{}
+	skipped := []string{}
+	for _, resource := range resources {
+		repository := resource.Metadata.Repository.Name
+		e, err := exclusion.Match(exclusions, repository)
+		if err != nil {
+			return nil, nil, err
+		}
+		if e == nil {
+			res = append(res, resource)
+			continue
+		}
+		reason := fmt.Sprintf("the repository %s is skipped as it matches the exclusion %s", repository, e.Pattern)
+		log.Warning(reason)
+		skipped = append(skipped, reason)
+		if audit {
+			if err = exclusionMgr.Audit(repository); err != nil {
+				log.Errorf("failed to record the audit entry of the excluded repository %s: %v", repository, err)
+			}
+		}
+	}
+	return res, skipped, nil
+}
+
+// CheckExclusion returns the reason why the repository is skipped if it matches the global exclusions,
+// an empty string is returned if it isn't excluded. It's used to check the tasks re-submitted without
+// running the flow again, e.g. the retried or resumed ones, as the exclusions may be created after
+// the tasks were created. The audit entry of the excluded repository is recorded
+func CheckExclusion(repository string) (string, error) {
+	_, skipped, err := filterByExclusions([]*model.Resource{
+		{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{Name: repository},
+			},
+		},
+	}, true)
+	if err != nil {
+		return "", err
+	}
+	if len(skipped) == 0 {
+		return "", nil
+	}
+	return skipped[0], nil
+}
+
+// CheckResource returns the reason why the resource is skipped by the policy if its repository matches
+// the global exclusions or isn't allowed by the source or destination registry, an empty string is
+// returned if it's replicated. It's used to reject the resource specified directly, e.g. the one of the
+// single execution, rather than creating the execution which replicates nothing
+func CheckResource(policy *model.Policy, resource *model.Resource) (string, error) {
+	resources, skipped, err := filterByExclusions([]*model.Resource{resource}, false)
+	if err != nil {
+		return "", err
+	}
+	if len(skipped) > 0 {
+		return skipped[0], nil
+	}
+	if _, skipped = filterByAllowedProjects(resources, policy); len(skipped) > 0 {
+		return skipped[0], nil
+	}
+	return "", nil
+}
+
+// filter out the tags of the images whose vulnerabilities are more severe than the max severity of the
+// policy, the tags without the scan result are filtered out as well unless the policy allows them. The
+// images without any tag left are removed and the reasons why the tags are skipped are returned
+func filterByScanResult(resources []*model.Resource, policy *model.Policy) ([]*model.Resource, []string) {
+	if len(policy.MaxSeverity) == 0 {
+		return resources, nil
+	}
+	// the severity has been validated when creating the policy
+	max, err := model.ParseSeverity(policy.MaxSeverity)
+	if err != nil {
+		log.Errorf("invalid max severity of the policy %d: %v", policy.ID, err)
+		return resources, nil
+	}
+	res := []*model.Resource{}
+	skipped := []string{}
+	for _, resource := range resources {
+		if resource.Type != model.ResourceTypeImage {
+			res = append(res, resource)
+			continue
+		}
+		repository := resource.Metadata.Repository.Name
+		tags := []string{}
+		for _, tag := range resource.Metadata.Vtags {
+			severity, scanned := resource.Metadata.ScanSeverities[tag]
+			var reason string
+			switch {
+			case !scanned && !policy.AllowUnscanned:
+				reason = fmt.Sprintf("the image %s:%s is skipped as it has no scan result", repository, tag)
+			case scanned && severity > max:
+				reason = fmt.Sprintf("the image %s:%s is skipped as the severity %s of its vulnerabilities is higher than %s",
+					repository, tag, severity, max)
+			default:
+				tags = append(tags, tag)
+				continue
+			}
+			log.Warning(reason)
+			skipped = append(skipped, reason)
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		resource.Metadata.Vtags = tags
+		res = append(res, resource)
+	}
+	return res, skipped
+}
+
+// the artifact types of the signatures attached to the images as referrers, e.g. by cosign and notation
+var signatureArtifactTypes = map[string]bool{
+	"application/vnd.dev.cosign.artifact.sig.v1+json": true,
+	"application/vnd.cncf.notary.signature":           true,
+}
+
+// filter out the tags of the images which aren't signed on the source registry if the policy replicates
+// only the signed images. The images without any tag left are removed and the reasons why the tags are
+// skipped are returned. Only the signatures attached to the images as referrers are counted as they're
+// replicated with the images, the tags signed only by Notary are skipped as the trust data isn't
+// replicated. The error is returned if the signatures can't be detected, so the unsigned images
+// aren't replicated by accident
+func filterBySignature(srcAdapter adp.Adapter, resources []*model.Resource, policy *model.Policy) ([]*model.Resource, []string, error) {
+	if !policy.SignedOnly {
+		return resources, nil, nil
+	}
+	res := []*model.Resource{}
+	skipped := []string{}
+	for _, resource := range resources {
+		if resource.Type != model.ResourceTypeImage {
+			res = append(res, resource)
+			continue
+		}
+		repository := resource.Metadata.Repository.Name
+		notarySigned := map[string]bool{}
+		for _, tag := range resource.Metadata.SignedTags {
+			notarySigned[tag] = true
+		}
+		tags := []string{}
+		for _, tag := range resource.Metadata.Vtags {
+			signed, err := isSigned(srcAdapter, repository, tag)
+			if err != nil {
+				return nil, nil, err
+			}
+			if signed {
+				tags = append(tags, tag)
+				continue
+			}
+			reason := fmt.Sprintf("the image %s:%s is skipped as it isn't signed", repository, tag)
+			if notarySigned[tag] {
+				reason = fmt.Sprintf("the image %s:%s is skipped as it's only signed by Notary whose trust data isn't replicated", repository, tag)
+			}
+			log.Warning(reason)
+			skipped = append(skipped, reason)
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		resource.Metadata.Vtags = tags
+		res = append(res, resource)
+	}
+	return res, skipped, nil
+}
+
+// check whether the image has the signatures attached as referrers on the source registry
+func isSigned(srcAdapter adp.Adapter, repository, tag string) (bool, error) {
+	registry, ok := srcAdapter.(adp.ImageRegistry)
+	if !ok {
+		return false, errors.New("the source registry doesn't support the images")
+	}
+	referrerRegistry, ok := srcAdapter.(adp.ReferrerRegistry)
+	if !ok {
+		return false, errors.New("the source registry doesn't support the referrers, the signatures can't be detected")
+	}
+	exist, digest, err := registry.ManifestExist(repository, tag)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the existence of image %s:%s: %v", repository, tag, err)
+	}
+	if !exist {
+		return false, nil
+	}
+	referrers, err := referrerRegistry.ListReferrers(repository, digest)
+	if err != nil {
+		return false, fmt.Errorf("failed to list the referrers of image %s:%s: %v", repository, tag, err)
+	}
+	for _, referrer := range referrers {
+		_, payload, err := referrerRegistry.PullRawManifest(repository, referrer.Digest.String(), []string{referrer.MediaType})
+		if err != nil {
+			return false, fmt.Errorf("failed to pull the referrer %s of image %s:%s: %v", referrer.Digest, repository, tag, err)
+		}
+		// the artifact type falls back to the media type of the config for the manifests
+		// built before the image spec 1.1
+		manifest := &struct {
+			ArtifactType string `json:"artifactType"`
+			Config       struct {
+				MediaType string `json:"mediaType"`
+			} `json:"config"`
+		}{}
+		if err = json.Unmarshal(payload, manifest); err != nil {
+			return false, fmt.Errorf("failed to unmarshal the referrer %s of image %s:%s: %v", referrer.Digest, repository, tag, err)
+		}
+		if signatureArtifactTypes[manifest.ArtifactType] || signatureArtifactTypes[manifest.Config.MediaType] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cap the count of the repositories replicated by the execution with the max repositories of the policy,
+// the resources of the same repository are counted once. The error is returned if the repositories exceed
+// the cap in the "fail" mode, and only the resources of the first repositories are kept in the "truncate"
+// mode with the message reporting the truncation
+func limitRepositories(resources []*model.Resource, policy *model.Policy) ([]*model.Resource, string, error) {
+	if policy.MaxRepos <= 0 {
+		return resources, "", nil
+	}
+	repositories := map[string]struct{}{}
+	res := []*model.Resource{}
+	for _, resource := range resources {
+		repository := resource.Metadata.Repository.Name
+		repositories[repository] = struct{}{}
+		if len(repositories) <= policy.MaxRepos {
+			res = append(res, resource)
+		}
+	}
+	if len(repositories) <= policy.MaxRepos {
+		return resources, "", nil
+	}
+	if policy.MaxReposMode != model.MaxReposModeTruncate {
+		return nil, "", fmt.Errorf("the %d repositories matched exceed the max repositories %d of the policy",
+			len(repositories), policy.MaxRepos)
+	}
+	message := fmt.Sprintf("only the first %d of the %d repositories matched are replicated as the max repositories of the policy is %d",
+		policy.MaxRepos, len(repositories), policy.MaxRepos)
+	log.Warning(message)
+	return res, message, nil
+}
+
+// the message of the execution which has no resources need to be replicated, "skipped" are the
+// repositories whose projects aren't allowed, "vulnerable" are the images failing the scan result
+// gate, "unsigned" are the images skipped as they aren't signed, "excluded" are the repositories
+// matching the global exclusions and "untransformable" are the repositories whose tags cannot be
+// transformed
+func noResourcesMessage(skipped, vulnerable, unsigned, excluded, untransformable []string) string {
+	reasons := []string{}
+	if len(excluded) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d repositories are excluded", len(excluded)))
+	}
+	if len(skipped) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d repositories are skipped as their projects aren't allowed", len(skipped)))
+	}
+	if len(vulnerable) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d images are skipped by the scan result gate", len(vulnerable)))
+	}
+	if len(unsigned) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d images are skipped as they aren't signed", len(unsigned)))
+	}
+	if len(untransformable) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d repositories are skipped as their tags cannot be transformed", len(untransformable)))
+	}
+	if len(reasons) == 0 {
+		return "no resources need to be replicated"
+	}
+	return "no resources need to be replicated, " + strings.Join(reasons, ", ")
+}
+
 // assemble the source resources by filling the registry information
 func assembleSourceResources(resources []*model.Resource,
 	policy *model.Policy) []*model.Resource {
@@ -192,29 +528,89 @@ func assembleSourceResources(resources []*model.Resource,
 	return resources
 }
 
-// assemble the destination resources by filling the metadata, registry and override properties
+// assemble the destination resources by filling the metadata, registry and override properties,
+// the names of the repositories are transformed if the destination registry has the path transform
+// and the tags of the images are transformed if the policy has the tag transform. The repositories
+// whose tags cannot be transformed are skipped, the source resources left are returned along with
+// the destination ones and the reasons why the repositories are skipped
 func assembleDestinationResources(resources []*model.Resource,
-	policy *model.Policy) []*model.Resource {
-	var result []*model.Resource
+	policy *model.Policy) ([]*model.Resource, []*model.Resource, []string, error) {
+	var transform func(string) (string, error)
+	if policy.TagTransform != nil {
+		apply, err := policy.TagTransform.Compile()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to compile the tag transform: %v", err)
+		}
+		transform = apply
+	}
+	var srcResources, result []*model.Resource
+	skipped := []string{}
 	for _, resource := range resources {
+		name := replaceNamespace(resource.Metadata.Repository.Name, policy.DestNamespace)
+		if policy.DestRegistry != nil && policy.DestRegistry.PathTransform != nil {
+			transformed, err := policy.DestRegistry.PathTransform.Apply(name)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to transform the repository name: %v", err)
+			}
+			name = transformed
+		}
+		tags := resource.Metadata.Vtags
+		if transform != nil && resource.Type == model.ResourceTypeImage {
+			transformed, err := transformTags(tags, transform)
+			if err != nil {
+				reason := fmt.Sprintf("the repository %s is skipped as %v", resource.Metadata.Repository.Name, err)
+				log.Warning(reason)
+				skipped = append(skipped, reason)
+				continue
+			}
+			tags = transformed
+		}
 		res := &model.Resource{
-			Type:         resource.Type,
-			Registry:     policy.DestRegistry,
-			ExtendedInfo: resource.ExtendedInfo,
-			Deleted:      resource.Deleted,
-			Override:     policy.Override,
+			Type:               resource.Type,
+			Registry:           policy.DestRegistry,
+			ExtendedInfo:       resource.ExtendedInfo,
+			Deleted:            resource.Deleted,
+			Override:           policy.Override,
+			ReplicateReferrers: policy.ReplicateReferrers || policy.SignedOnly,
+			PauseOnReadOnly:    policy.PauseOnReadOnly,
+			CompressLayers:     policy.CompressLayers,
+			MountBlobs:         policy.MountBlobs,
+			BlobAccounting:     policy.BlobAccounting,
+			DryRun:             policy.DryRun,
 		}
 		res.Metadata = &model.ResourceMetadata{
 			Repository: &model.Repository{
-				Name:     replaceNamespace(resource.Metadata.Repository.Name, policy.DestNamespace),
+				Name:     name,
 				Metadata: resource.Metadata.Repository.Metadata,
 			},
-			Vtags: resource.Metadata.Vtags,
+			Vtags:         tags,
+			ImmutableTags: resource.Metadata.ImmutableTags,
 		}
+		srcResources = append(srcResources, resource)
 		result = append(result, res)
 	}
 	log.Debug("assemble the destination resources completed")
-	return result
+	return srcResources, result, skipped, nil
+}
+
+// transform the tags of the repository in order, the transformed tags are mapped to the source ones by the
+// index. The error is returned if more than one source tag is transformed to the same tag as they'd
+// overwrite each other on the destination registry
+func transformTags(tags []string, transform func(string) (string, error)) ([]string, error) {
+	transformed := make([]string, len(tags))
+	sources := map[string]string{}
+	for i, tag := range tags {
+		t, err := transform(tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform the tag: %v", err)
+		}
+		if source, exist := sources[t]; exist {
+			return nil, fmt.Errorf("the tags %s and %s are transformed to the same tag %s", source, tag, t)
+		}
+		sources[t] = tag
+		transformed[i] = t
+	}
+	return transformed, nil
 }
 
 // do the prepare work for pushing/uploading the resources: create the namespace or repository
@@ -251,6 +647,10 @@ func createTasks(mgr execution.Manager, executionID int64, items []*scheduler.Sc
 			SrcResource:  getResourceName(item.SrcResource),
 			DstResource:  getResourceName(item.DstResource),
 			Operation:    operation,
+			Repository:   item.SrcResource.Metadata.GetResourceName(),
+		}
+		if item.DstResource.Registry != nil {
+			task.DstRegistryID = item.DstResource.Registry.ID
 		}
 
 		id, err := mgr.CreateTask(task)
@@ -288,6 +688,17 @@ func schedule(scheduler scheduler.Scheduler, executionMgr execution.Manager, ite
 			continue
 		}
 		allFailed = false
+		// the deferred task is kept initialized until the draining registry is back
+		if result.Deferred {
+			if err = executionMgr.UpdateTask(&models.Task{
+				ID:         result.TaskID,
+				StatusText: deferredStatusText,
+			}, models.TaskPropsName.StatusText); err != nil {
+				log.Errorf("failed to update the task %d: %v", result.TaskID, err)
+			}
+			log.Debugf("the task %d deferred", result.TaskID)
+			continue
+		}
 		// if the task is submitted successfully, update the status, job ID and start time
 		if err = executionMgr.UpdateTaskStatus(result.TaskID, models.TaskStatusPending, models.TaskStatusInitialized); err != nil {
 			log.Errorf("failed to update the task status %d: %v", result.TaskID, err)
@@ -300,6 +711,10 @@ func schedule(scheduler scheduler.Scheduler, executionMgr execution.Manager, ite
 		}, "JobID", "StartTime"); err != nil {
 			log.Errorf("failed to update the task %d: %v", result.TaskID, err)
 		}
+		if result.Coalesced {
+			log.Debugf("the task %d coalesced into the job %s", result.TaskID, result.JobID)
+			continue
+		}
 		log.Debugf("the task %d scheduled", result.TaskID)
 	}
 	// if all the tasks are failed, return err
@@ -15,16 +15,19 @@
 package flow
 
 import (
+	"errors"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/docker/distribution"
+	common_models "github.com/goharbor/harbor/src/common/models"
 	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/goharbor/harbor/src/replication/operation/scheduler"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -136,6 +139,12 @@ func (f *fakedScheduler) Schedule(items []*scheduler.ScheduleItem) ([]*scheduler
 	}
 	return results, nil
 }
+func (f *fakedScheduler) Reschedule(taskID int64, jobID string) (string, error) {
+	return "", nil
+}
+func (f *fakedScheduler) TakeDeferred(registryID int64) ([]*scheduler.ScheduleItem, error) {
+	return nil, nil
+}
 func (f *fakedScheduler) Stop(id string) error {
 	return nil
 }
@@ -156,6 +165,9 @@ func (f *fakedExecutionManager) Get(int64) (*models.Execution, error) {
 func (f *fakedExecutionManager) Update(*models.Execution, ...string) error {
 	return nil
 }
+func (f *fakedExecutionManager) MarkRecorded(int64) (bool, error) {
+	return false, nil
+}
 func (f *fakedExecutionManager) Remove(int64) error {
 	return nil
 }
@@ -188,6 +200,41 @@ func (f *fakedExecutionManager) RemoveAllTasks(int64) error {
 func (f *fakedExecutionManager) GetTaskLog(int64) ([]byte, error) {
 	return nil, nil
 }
+func (f *fakedExecutionManager) CreateDeadLetter(*models.DeadLetter) (int64, error) {
+	return 1, nil
+}
+func (f *fakedExecutionManager) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 0, nil, nil
+}
+func (f *fakedExecutionManager) GetDeadLetter(int64) (*models.DeadLetter, error) {
+	return nil, nil
+}
+func (f *fakedExecutionManager) RemoveDeadLetterOfTask(int64) error {
+	return nil
+}
+
+type fakedExclusionManager struct {
+	exclusions []*models.Exclusion
+	err        error
+	audited    []string
+}
+
+func (f *fakedExclusionManager) Create(*models.Exclusion) (int64, error) {
+	return 1, nil
+}
+func (f *fakedExclusionManager) List() ([]*models.Exclusion, error) {
+	return f.exclusions, f.err
+}
+func (f *fakedExclusionManager) Get(int64) (*models.Exclusion, error) {
+	return nil, nil
+}
+func (f *fakedExclusionManager) Remove(int64) error {
+	return nil
+}
+func (f *fakedExclusionManager) Audit(repository string) error {
+	f.audited = append(f.audited, repository)
+	return nil
+}
 
 func TestMain(m *testing.M) {
 	url := "https://registry.harbor.local"
@@ -316,13 +363,123 @@ func TestAssembleDestinationResources(t *testing.T) {
 		DestRegistry:  &model.Registry{},
 		DestNamespace: "test",
 		Override:      true,
+		DryRun:        true,
 	}
-	res := assembleDestinationResources(resources, policy)
+	_, res, _, err := assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
 	assert.Equal(t, 1, len(res))
 	assert.Equal(t, model.ResourceTypeChart, res[0].Type)
+	assert.True(t, res[0].DryRun)
 	assert.Equal(t, "test/hello-world", res[0].Metadata.Repository.Name)
 	assert.Equal(t, 1, len(res[0].Metadata.Vtags))
 	assert.Equal(t, "latest", res[0].Metadata.Vtags[0])
+	assert.False(t, res[0].ReplicateReferrers)
+
+	// the signatures follow the signed images
+	policy.SignedOnly = true
+	_, res, _, err = assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	assert.True(t, res[0].ReplicateReferrers)
+
+	// the destination registry transforms the path
+	policy.DestRegistry = &model.Registry{
+		PathTransform: &model.PathTransform{
+			AddPrefix: "root/",
+		},
+	}
+	_, res, _, err = assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	assert.Equal(t, "root/test/hello-world", res[0].Metadata.Repository.Name)
+
+	// the transformed name is invalid
+	policy.DestRegistry = &model.Registry{
+		PathTransform: &model.PathTransform{
+			Pattern:     "hello",
+			Replacement: "_",
+		},
+	}
+	_, _, _, err = assembleDestinationResources(resources, policy)
+	assert.NotNil(t, err)
+}
+
+func TestAssembleDestinationResourcesWithTagTransform(t *testing.T) {
+	resources := []*model.Resource{
+		{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: "library/hello-world",
+				},
+				Vtags:         []string{"build-101-v1.0", "build-102-v1.1"},
+				ImmutableTags: []string{"build-101-v1.0"},
+			},
+		},
+		{
+			Type: model.ResourceTypeChart,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: "library/harbor",
+				},
+				Vtags: []string{"0.2.0"},
+			},
+		},
+	}
+
+	// add the suffix
+	policy := &model.Policy{
+		DestRegistry: &model.Registry{},
+		TagTransform: &model.TagTransform{
+			AddSuffix: "-prod",
+		},
+	}
+	_, res, _, err := assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, []string{"build-101-v1.0-prod", "build-102-v1.1-prod"}, res[0].Metadata.Vtags)
+	// the versions of the charts aren't transformed
+	assert.Equal(t, []string{"0.2.0"}, res[1].Metadata.Vtags)
+	// the source tags are unchanged
+	assert.Equal(t, []string{"build-101-v1.0", "build-102-v1.1"}, resources[0].Metadata.Vtags)
+	assert.Equal(t, []string{"build-101-v1.0"}, res[0].Metadata.ImmutableTags)
+
+	// strip the build prefix by the regular expression
+	policy.TagTransform = &model.TagTransform{
+		Pattern:     `^build-\d+-(.*)$`,
+		Replacement: "$1",
+	}
+	_, res, _, err = assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"v1.0", "v1.1"}, res[0].Metadata.Vtags)
+
+	// the tags are transformed to the same tag, only the repository is skipped
+	policy.TagTransform = &model.TagTransform{
+		Pattern:     `^build-\d+-v(\d+)\..*$`,
+		Replacement: "v$1",
+	}
+	src, res, skipped, err := assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(src))
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "library/harbor", src[0].Metadata.Repository.Name)
+	assert.Equal(t, "library/harbor", res[0].Metadata.Repository.Name)
+	require.Equal(t, 1, len(skipped))
+	assert.Equal(t, "the repository library/hello-world is skipped as the tags build-101-v1.0 and build-102-v1.1 are transformed to the same tag v1", skipped[0])
+
+	// the transformed tag is invalid
+	policy.TagTransform = &model.TagTransform{
+		StripPrefix: "build-101-v1.0",
+	}
+	src, _, skipped, err = assembleDestinationResources(resources, policy)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(src))
+	assert.Equal(t, 1, len(skipped))
+
+	// the invalid pattern fails the whole flow
+	policy.TagTransform = &model.TagTransform{
+		Pattern: "(",
+	}
+	_, _, _, err = assembleDestinationResources(resources, policy)
+	assert.NotNil(t, err)
 }
 
 func TestPreprocess(t *testing.T) {
@@ -384,6 +541,60 @@ func TestSchedule(t *testing.T) {
 	assert.Equal(t, 1, n)
 }
 
+// fakedDrainingScheduler defers all the items
+type fakedDrainingScheduler struct {
+	fakedScheduler
+}
+
+func (f *fakedDrainingScheduler) Schedule(items []*scheduler.ScheduleItem) ([]*scheduler.ScheduleResult, error) {
+	results := []*scheduler.ScheduleResult{}
+	for _, item := range items {
+		results = append(results, &scheduler.ScheduleResult{
+			TaskID:   item.TaskID,
+			Deferred: true,
+		})
+	}
+	return results, nil
+}
+
+// fakedTaskRecordingExecutionManager records the updates of the tasks
+type fakedTaskRecordingExecutionManager struct {
+	fakedExecutionManager
+	tasks    map[int64]*models.Task
+	statuses map[int64]string
+}
+
+func (f *fakedTaskRecordingExecutionManager) UpdateTask(task *models.Task, props ...string) error {
+	f.tasks[task.ID] = task
+	return nil
+}
+func (f *fakedTaskRecordingExecutionManager) UpdateTaskStatus(id int64, status string, statusCondition ...string) error {
+	f.statuses[id] = status
+	return nil
+}
+
+func TestScheduleDeferred(t *testing.T) {
+	mgr := &fakedTaskRecordingExecutionManager{
+		tasks:    map[int64]*models.Task{},
+		statuses: map[int64]string{},
+	}
+	items := []*scheduler.ScheduleItem{
+		{
+			SrcResource: &model.Resource{},
+			DstResource: &model.Resource{},
+			TaskID:      1,
+		},
+	}
+	// the deferred tasks aren't failed and are kept initialized
+	n, err := schedule(&fakedDrainingScheduler{}, mgr, items)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, mgr.statuses)
+	require.NotNil(t, mgr.tasks[1])
+	assert.Equal(t, deferredStatusText, mgr.tasks[1].StatusText)
+	assert.Empty(t, mgr.tasks[1].JobID)
+}
+
 func TestReplaceNamespace(t *testing.T) {
 	// empty namespace
 	repository := "c"
@@ -406,3 +617,361 @@ func TestReplaceNamespace(t *testing.T) {
 	result = replaceNamespace(repository, namespace)
 	assert.Equal(t, "n/c", result)
 }
+
+func TestFilterByRepositories(t *testing.T) {
+	resources := []*model.Resource{}
+	for _, name := range []string{"library/hello-world", "library/busybox", "library/alpine"} {
+		resources = append(resources, &model.Resource{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: name,
+				},
+			},
+		})
+	}
+	res := filterByRepositories(resources, []string{"library/busybox", "library/unknown"})
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "library/busybox", res[0].Metadata.Repository.Name)
+}
+
+func TestFilterByAllowedProjects(t *testing.T) {
+	resources := []*model.Resource{
+		{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: "library/hello-world",
+				},
+			},
+		},
+		{
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{
+					Name: "secret/hello-world",
+				},
+			},
+		},
+	}
+
+	// empty allowlist means all the projects are allowed
+	policy := &model.Policy{
+		SrcRegistry:  &model.Registry{},
+		DestRegistry: &model.Registry{},
+	}
+	res, skipped := filterByAllowedProjects(resources, policy)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, 0, len(skipped))
+
+	policy.DestRegistry = &model.Registry{
+		Name:            "target",
+		AllowedProjects: []string{"library"},
+	}
+	res, skipped = filterByAllowedProjects(resources, policy)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "library/hello-world", res[0].Metadata.Repository.Name)
+	require.Equal(t, 1, len(skipped))
+	assert.Equal(t, "the repository secret/hello-world is skipped as its project isn't in the allowed projects [library] of the registry target", skipped[0])
+	assert.Equal(t, "no resources need to be replicated, 1 repositories are skipped as their projects aren't allowed", noResourcesMessage(skipped, nil, nil, nil, nil))
+}
+
+func TestCheckResource(t *testing.T) {
+	defer SetExclusionManager(nil)
+	SetExclusionManager(&fakedExclusionManager{
+		exclusions: []*models.Exclusion{{Pattern: "secrets/**"}},
+	})
+	policy := &model.Policy{
+		DestRegistry: &model.Registry{
+			Name:            "target",
+			AllowedProjects: []string{"library", "secrets"},
+		},
+	}
+	resource := func(repository string) *model.Resource {
+		return &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{Name: repository},
+			},
+		}
+	}
+
+	reason, err := CheckResource(policy, resource("library/hello-world"))
+	require.Nil(t, err)
+	assert.Equal(t, "", reason)
+
+	reason, err = CheckResource(policy, resource("secrets/app"))
+	require.Nil(t, err)
+	assert.Equal(t, "the repository secrets/app is skipped as it matches the exclusion secrets/**", reason)
+
+	reason, err = CheckResource(policy, resource("other/hello-world"))
+	require.Nil(t, err)
+	assert.Equal(t, "the repository other/hello-world is skipped as its project isn't in the allowed projects [library secrets] of the registry target", reason)
+}
+
+func TestFilterByExclusions(t *testing.T) {
+	defer SetExclusionManager(nil)
+	newResources := func() []*model.Resource {
+		return []*model.Resource{
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/hello-world"},
+				},
+			},
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "secrets/app"},
+				},
+			},
+		}
+	}
+
+	// no exclusion manager
+	resources, skipped, err := filterByExclusions(newResources(), true)
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(resources))
+	assert.Equal(t, 0, len(skipped))
+
+	// the repository matches the exclusion
+	mgr := &fakedExclusionManager{
+		exclusions: []*models.Exclusion{{Pattern: "secrets/**"}},
+	}
+	SetExclusionManager(mgr)
+	resources, skipped, err = filterByExclusions(newResources(), true)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(resources))
+	assert.Equal(t, "library/hello-world", resources[0].Metadata.Repository.Name)
+	require.Equal(t, 1, len(skipped))
+	assert.Equal(t, "the repository secrets/app is skipped as it matches the exclusion secrets/**", skipped[0])
+	assert.Equal(t, []string{"secrets/app"}, mgr.audited)
+
+	// no audit entries
+	mgr.audited = nil
+	resources, skipped, err = filterByExclusions(newResources(), false)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(resources))
+	assert.Equal(t, 1, len(skipped))
+	assert.Equal(t, 0, len(mgr.audited))
+
+	// check the single repository
+	reason, err := CheckExclusion("secrets/app")
+	require.Nil(t, err)
+	assert.Equal(t, "the repository secrets/app is skipped as it matches the exclusion secrets/**", reason)
+	assert.Equal(t, []string{"secrets/app"}, mgr.audited)
+	reason, err = CheckExclusion("library/hello-world")
+	require.Nil(t, err)
+	assert.Equal(t, "", reason)
+
+	// failed to get the exclusions
+	mgr.err = errors.New("error")
+	_, _, err = filterByExclusions(newResources(), true)
+	assert.NotNil(t, err)
+	_, err = CheckExclusion("library/hello-world")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, "no resources need to be replicated, 2 repositories are excluded", noResourcesMessage(nil, nil, nil, []string{"a", "b"}, nil))
+}
+
+func TestLimitRepositories(t *testing.T) {
+	newResource := func(repository string, tag string) *model.Resource {
+		return &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{Name: repository},
+				Vtags:      []string{tag},
+			},
+		}
+	}
+	newResources := func() []*model.Resource {
+		return []*model.Resource{
+			newResource("library/hello-world", "latest"),
+			// the resources of the same repository are counted once
+			newResource("library/hello-world", "v1"),
+			newResource("library/busybox", "latest"),
+			newResource("library/alpine", "latest"),
+		}
+	}
+
+	// no cap
+	policy := &model.Policy{}
+	resources, truncation, err := limitRepositories(newResources(), policy)
+	require.Nil(t, err)
+	assert.Equal(t, 4, len(resources))
+	assert.Empty(t, truncation)
+
+	// the repositories don't exceed the cap
+	policy.MaxRepos = 3
+	resources, truncation, err = limitRepositories(newResources(), policy)
+	require.Nil(t, err)
+	assert.Equal(t, 4, len(resources))
+	assert.Empty(t, truncation)
+
+	// fail mode, it's the default one
+	policy.MaxRepos = 2
+	_, _, err = limitRepositories(newResources(), policy)
+	require.NotNil(t, err)
+	assert.Equal(t, "the 3 repositories matched exceed the max repositories 2 of the policy", err.Error())
+	policy.MaxReposMode = model.MaxReposModeFail
+	_, _, err = limitRepositories(newResources(), policy)
+	require.NotNil(t, err)
+
+	// truncate mode
+	policy.MaxReposMode = model.MaxReposModeTruncate
+	resources, truncation, err = limitRepositories(newResources(), policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(resources))
+	assert.Equal(t, "library/hello-world", resources[0].Metadata.Repository.Name)
+	assert.Equal(t, "library/hello-world", resources[1].Metadata.Repository.Name)
+	assert.Equal(t, "library/busybox", resources[2].Metadata.Repository.Name)
+	assert.Equal(t, "only the first 2 of the 3 repositories matched are replicated as the max repositories of the policy is 2", truncation)
+}
+
+func TestFilterByScanResult(t *testing.T) {
+	newResources := func() []*model.Resource {
+		return []*model.Resource{
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/hello-world"},
+					Vtags:      []string{"1.0", "2.0", "3.0"},
+					ScanSeverities: map[string]common_models.Severity{
+						"1.0": common_models.SevLow,
+						"2.0": common_models.SevHigh,
+					},
+				},
+			},
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/busybox"},
+					Vtags:      []string{"latest"},
+					ScanSeverities: map[string]common_models.Severity{
+						"latest": common_models.SevHigh,
+					},
+				},
+			},
+			{
+				Type: model.ResourceTypeChart,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/harbor"},
+					Vtags:      []string{"1.0"},
+				},
+			},
+		}
+	}
+
+	// the gate is disabled
+	policy := &model.Policy{}
+	res, skipped := filterByScanResult(newResources(), policy)
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, 0, len(skipped))
+
+	// the vulnerable and unscanned tags are skipped, the image without tags left is removed
+	policy.MaxSeverity = "medium"
+	res, skipped = filterByScanResult(newResources(), policy)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, []string{"1.0"}, res[0].Metadata.Vtags)
+	assert.Equal(t, model.ResourceTypeChart, res[1].Type)
+	require.Equal(t, 3, len(skipped))
+	assert.Equal(t, "the image library/hello-world:2.0 is skipped as the severity high of its vulnerabilities is higher than medium", skipped[0])
+	assert.Equal(t, "the image library/hello-world:3.0 is skipped as it has no scan result", skipped[1])
+
+	// the unscanned tags are allowed
+	policy.AllowUnscanned = true
+	res, skipped = filterByScanResult(newResources(), policy)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, []string{"1.0", "3.0"}, res[0].Metadata.Vtags)
+	assert.Equal(t, 2, len(skipped))
+	assert.Equal(t, "no resources need to be replicated, 2 images are skipped by the scan result gate", noResourcesMessage(nil, skipped, nil, nil, nil))
+
+	// all the scanned tags pass
+	policy.MaxSeverity = "critical"
+	res, skipped = filterByScanResult(newResources(), policy)
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, 0, len(skipped))
+}
+
+// signingAdapter returns the referrers of the images by their tags
+type signingAdapter struct {
+	fakedAdapter
+	// the referrers of the images keyed by "repository:tag"
+	referrers map[string][]v1.Descriptor
+	// the manifests of the referrers keyed by their digests
+	manifests map[string]string
+}
+
+func (s *signingAdapter) ManifestExist(repository, reference string) (bool, string, error) {
+	return true, repository + ":" + reference, nil
+}
+func (s *signingAdapter) ListReferrers(repository, digest string) ([]v1.Descriptor, error) {
+	return s.referrers[digest], nil
+}
+func (s *signingAdapter) PullRawManifest(repository, reference string, accepttedMediaTypes []string) (string, []byte, error) {
+	return v1.MediaTypeImageManifest, []byte(s.manifests[reference]), nil
+}
+
+func TestFilterBySignature(t *testing.T) {
+	newResources := func() []*model.Resource {
+		return []*model.Resource{
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/hello-world"},
+					Vtags:      []string{"1.0", "2.0", "3.0"},
+					SignedTags: []string{"3.0"},
+				},
+			},
+			{
+				Type: model.ResourceTypeImage,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/busybox"},
+					Vtags:      []string{"latest", "sbom"},
+				},
+			},
+			{
+				Type: model.ResourceTypeChart,
+				Metadata: &model.ResourceMetadata{
+					Repository: &model.Repository{Name: "library/harbor"},
+					Vtags:      []string{"1.0"},
+				},
+			},
+		}
+	}
+	srcAdapter := &signingAdapter{
+		referrers: map[string][]v1.Descriptor{
+			"library/hello-world:1.0": {{MediaType: v1.MediaTypeImageManifest, Digest: "sha256:cosign"}},
+			"library/busybox:latest":  {{MediaType: v1.MediaTypeImageManifest, Digest: "sha256:notation"}},
+			"library/busybox:sbom":    {{MediaType: v1.MediaTypeImageManifest, Digest: "sha256:sbom"}},
+		},
+		manifests: map[string]string{
+			// built before the image spec 1.1
+			"sha256:cosign":   `{"config":{"mediaType":"application/vnd.dev.cosign.artifact.sig.v1+json"}}`,
+			"sha256:notation": `{"artifactType":"application/vnd.cncf.notary.signature"}`,
+			"sha256:sbom":     `{"artifactType":"application/spdx+json"}`,
+		},
+	}
+
+	// all the images are replicated
+	policy := &model.Policy{}
+	res, skipped, err := filterBySignature(srcAdapter, newResources(), policy)
+	require.Nil(t, err)
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, 0, len(skipped))
+
+	// the tags without the signatures attached as referrers are skipped, the image without tags left is removed
+	policy.SignedOnly = true
+	res, skipped, err = filterBySignature(srcAdapter, newResources(), policy)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, []string{"1.0"}, res[0].Metadata.Vtags)
+	assert.Equal(t, []string{"latest"}, res[1].Metadata.Vtags)
+	assert.Equal(t, model.ResourceTypeChart, res[2].Type)
+	require.Equal(t, 3, len(skipped))
+	assert.Equal(t, "the image library/hello-world:2.0 is skipped as it isn't signed", skipped[0])
+	assert.Equal(t, "the image library/hello-world:3.0 is skipped as it's only signed by Notary whose trust data isn't replicated", skipped[1])
+	assert.Equal(t, "the image library/busybox:sbom is skipped as it isn't signed", skipped[2])
+	assert.Equal(t, "no resources need to be replicated, 3 images are skipped as they aren't signed", noResourcesMessage(nil, nil, skipped, nil, nil))
+
+	// the source registry doesn't support the referrers
+	_, _, err = filterBySignature(&fakedAdapter{}, newResources(), policy)
+	assert.NotNil(t, err)
+}
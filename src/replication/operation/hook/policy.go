@@ -0,0 +1,74 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook
+
+import (
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/core/notifier"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/policy"
+)
+
+// record the result of the finished execution in the consecutive failures of its policy. The failed
+// execution increases the count and the succeeded ones reset it, the stopped and paused executions
+// don't change it. The policy is disabled once the count reaches the failure threshold of the policy.
+// The count is updated atomically as the executions of the same policy may finish concurrently
+func recordExecution(policyCtl policy.Controller, execution *models.Execution) error {
+	// the execution of the single tag replication has no policy
+	if execution.PolicyID == 0 {
+		return nil
+	}
+	switch execution.Status {
+	case models.ExecutionStatusFailed:
+		failures, disabled, err := policyCtl.IncreaseFailures(execution.PolicyID)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			log.Warningf("the policy %d is disabled as its executions failed %d times consecutively, the last failed execution: %d",
+				execution.PolicyID, failures, execution.ID)
+			publishPolicyDisabled(policyCtl, execution, failures)
+		}
+		return nil
+	case models.ExecutionStatusSucceed, models.ExecutionStatusPartialSucceed:
+		return policyCtl.ResetFailures(execution.PolicyID)
+	default:
+		return nil
+	}
+}
+
+// publish the event of disabling the policy through the notifier, the failure of publishing
+// only logs as the policy has been disabled
+func publishPolicyDisabled(policyCtl policy.Controller, execution *models.Execution, failures int) {
+	event := &model.PolicyDisabledEvent{
+		PolicyID:    execution.PolicyID,
+		Failures:    failures,
+		ExecutionID: execution.ID,
+		OccurAt:     time.Now(),
+	}
+	p, err := policyCtl.Get(execution.PolicyID)
+	if err != nil {
+		log.Errorf("failed to get the policy %d: %v", execution.PolicyID, err)
+	}
+	if p != nil {
+		event.PolicyName = p.Name
+	}
+	if err = notifier.Publish(notifier.ReplicationPolicyDisabledTopic, event); err != nil {
+		log.Errorf("failed to publish the event of disabling the policy %d: %v", execution.PolicyID, err)
+	}
+}
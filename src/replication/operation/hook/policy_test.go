@@ -0,0 +1,223 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goharbor/harbor/src/core/notifier"
+	"github.com/goharbor/harbor/src/jobservice/job"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakedPolicyController struct {
+	policy *model.Policy
+}
+
+func (f *fakedPolicyController) Create(*model.Policy) (int64, error) {
+	return 0, nil
+}
+func (f *fakedPolicyController) List(...*model.PolicyQuery) (int64, []*model.Policy, error) {
+	return 0, nil, nil
+}
+func (f *fakedPolicyController) Get(id int64) (*model.Policy, error) {
+	if f.policy == nil || f.policy.ID != id {
+		return nil, nil
+	}
+	p := *f.policy
+	return &p, nil
+}
+func (f *fakedPolicyController) GetByName(string) (*model.Policy, error) {
+	return nil, nil
+}
+func (f *fakedPolicyController) Update(policy *model.Policy) error {
+	f.policy = policy
+	return nil
+}
+func (f *fakedPolicyController) Remove(int64) error {
+	return nil
+}
+func (f *fakedPolicyController) IncreaseFailures(id int64) (int, bool, error) {
+	if f.policy == nil || f.policy.ID != id {
+		return 0, false, nil
+	}
+	f.policy.ConsecutiveFailures++
+	disabled := f.policy.Enabled && f.policy.FailureThreshold > 0 && f.policy.ConsecutiveFailures >= f.policy.FailureThreshold
+	if disabled {
+		f.policy.Enabled = false
+	}
+	return f.policy.ConsecutiveFailures, disabled, nil
+}
+func (f *fakedPolicyController) ResetFailures(id int64) error {
+	if f.policy != nil && f.policy.ID == id {
+		f.policy.ConsecutiveFailures = 0
+	}
+	return nil
+}
+
+// executionOperationController generates the status of the execution from its only task
+type executionOperationController struct {
+	fakedOperationController
+	recorded map[int64]bool
+}
+
+func (e *executionOperationController) GetExecution(id int64) (*models.Execution, error) {
+	execution := &models.Execution{
+		ID:       id,
+		PolicyID: 1,
+	}
+	switch e.task.Status {
+	case models.TaskStatusFailed:
+		execution.Status = models.ExecutionStatusFailed
+	case models.TaskStatusSucceed:
+		execution.Status = models.ExecutionStatusSucceed
+	case models.TaskStatusStopped:
+		execution.Status = models.ExecutionStatusStopped
+	default:
+		execution.Status = models.ExecutionStatusInProgress
+	}
+	return execution, nil
+}
+func (e *executionOperationController) MarkExecutionRecorded(id int64) (bool, error) {
+	if e.recorded[id] {
+		return false, nil
+	}
+	e.recorded[id] = true
+	return true, nil
+}
+func (e *executionOperationController) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
+	e.task.Status = status
+	return nil
+}
+
+func TestUpdateTaskDisablePolicy(t *testing.T) {
+	policyCtl := &fakedPolicyController{
+		policy: &model.Policy{
+			ID:               1,
+			Enabled:          true,
+			FailureThreshold: 3,
+		},
+	}
+	ctl := &executionOperationController{recorded: map[int64]bool{}}
+	var executionID int64
+	run := func(status job.Status) {
+		executionID++
+		ctl.task = &models.Task{
+			ID:          1,
+			ExecutionID: executionID,
+			Status:      models.TaskStatusInProgress,
+		}
+		require.Nil(t, UpdateTask(ctl, policyCtl, 1, &JobStatus{Status: status.String()}))
+	}
+
+	// the succeeded execution resets the count
+	run(job.ErrorStatus)
+	run(job.ErrorStatus)
+	assert.Equal(t, 2, policyCtl.policy.ConsecutiveFailures)
+	run(job.SuccessStatus)
+	assert.Equal(t, 0, policyCtl.policy.ConsecutiveFailures)
+	assert.True(t, policyCtl.policy.Enabled)
+
+	// the stopped execution doesn't change the count
+	run(job.ErrorStatus)
+	run(job.StoppedStatus)
+	run(job.ErrorStatus)
+	assert.Equal(t, 2, policyCtl.policy.ConsecutiveFailures)
+	assert.True(t, policyCtl.policy.Enabled)
+
+	// the policy is disabled when the threshold is reached
+	run(job.ErrorStatus)
+	assert.Equal(t, 3, policyCtl.policy.ConsecutiveFailures)
+	assert.False(t, policyCtl.policy.Enabled)
+
+	// the repeated status update of the finished execution isn't counted, e.g. the hooks of
+	// the tasks of the same execution which see the execution finished concurrently
+	require.Nil(t, UpdateTask(ctl, policyCtl, 1, &JobStatus{Status: job.ErrorStatus.String()}))
+	require.Nil(t, UpdateTask(ctl, policyCtl, 1, &JobStatus{Status: job.ErrorStatus.String()}))
+	assert.Equal(t, 3, policyCtl.policy.ConsecutiveFailures)
+}
+
+func TestRecordExecution(t *testing.T) {
+	// the policy isn't disabled when the threshold isn't set
+	policyCtl := &fakedPolicyController{
+		policy: &model.Policy{
+			ID:                  1,
+			Enabled:             true,
+			ConsecutiveFailures: 10,
+		},
+	}
+	err := recordExecution(policyCtl, &models.Execution{PolicyID: 1, Status: models.ExecutionStatusFailed})
+	require.Nil(t, err)
+	assert.Equal(t, 11, policyCtl.policy.ConsecutiveFailures)
+	assert.True(t, policyCtl.policy.Enabled)
+
+	// the partially succeeded execution resets the count
+	err = recordExecution(policyCtl, &models.Execution{PolicyID: 1, Status: models.ExecutionStatusPartialSucceed})
+	require.Nil(t, err)
+	assert.Equal(t, 0, policyCtl.policy.ConsecutiveFailures)
+
+	// the execution without policy is ignored
+	err = recordExecution(policyCtl, &models.Execution{Status: models.ExecutionStatusFailed})
+	require.Nil(t, err)
+	assert.Equal(t, 0, policyCtl.policy.ConsecutiveFailures)
+}
+
+// policyDisabledHandler passes the events of disabling the policies to the channel
+type policyDisabledHandler struct {
+	events chan *model.PolicyDisabledEvent
+}
+
+func (p *policyDisabledHandler) Handle(value interface{}) error {
+	p.events <- value.(*model.PolicyDisabledEvent)
+	return nil
+}
+func (p *policyDisabledHandler) IsStateful() bool {
+	return false
+}
+
+func TestRecordExecutionPublishEvent(t *testing.T) {
+	handler := &policyDisabledHandler{
+		events: make(chan *model.PolicyDisabledEvent, 1),
+	}
+	require.Nil(t, notifier.Subscribe(notifier.ReplicationPolicyDisabledTopic, handler))
+	defer notifier.UnSubscribe(notifier.ReplicationPolicyDisabledTopic, "")
+
+	policyCtl := &fakedPolicyController{
+		policy: &model.Policy{
+			ID:                  1,
+			Name:                "policy01",
+			Enabled:             true,
+			FailureThreshold:    2,
+			ConsecutiveFailures: 1,
+		},
+	}
+	err := recordExecution(policyCtl, &models.Execution{ID: 10, PolicyID: 1, Status: models.ExecutionStatusFailed})
+	require.Nil(t, err)
+	require.False(t, policyCtl.policy.Enabled)
+
+	select {
+	case event := <-handler.events:
+		assert.Equal(t, int64(1), event.PolicyID)
+		assert.Equal(t, "policy01", event.PolicyName)
+		assert.Equal(t, 2, event.Failures)
+		assert.Equal(t, int64(10), event.ExecutionID)
+	case <-time.After(5 * time.Second):
+		t.Error("the event of disabling the policy isn't published")
+	}
+}
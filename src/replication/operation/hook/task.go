@@ -15,14 +15,221 @@
 package hook
 
 import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/operation"
+	"github.com/goharbor/harbor/src/replication/policy"
+	"github.com/goharbor/harbor/src/replication/transfer"
 )
 
-// UpdateTask update the status of the task
-func UpdateTask(ctl operation.Controller, id int64, status string) error {
-	jobStatus := job.Status(status)
+// JobStatus is the status change of the job which the task is bound to
+type JobStatus struct {
+	JobID   string
+	Status  string
+	CheckIn string
+	// the job fails and won't be retried by the jobservice any more
+	Dead bool
+}
+
+// UpdateTask updates the status of the task and the tasks coalesced into the same job according to the
+// status change of the job, the message checked in by the job is recorded rather than changing the status
+func UpdateTask(ctl operation.Controller, policyCtl policy.Controller, id int64, status *JobStatus) error {
+	task, err := ctl.GetTask(id)
+	if err != nil {
+		return err
+	}
+	// drop the final status of the job if the task has been bound to another job since, e.g. the deferred one
+	if task != nil && len(status.JobID) > 0 && len(task.JobID) > 0 && task.JobID != status.JobID && isJobFinished(status.Status) {
+		log.Debugf("drop the status %s of the job %s as the task %d is bound to the job %s", status.Status, status.JobID, id, task.JobID)
+		return nil
+	}
+	msg := parseCheckIn(status.CheckIn)
+	// only the task is deferred, the tasks coalesced into the job are resubmitted with it
+	if msg != nil && msg.prefix == transfer.CheckInBlackoutPrefix {
+		return msg.handle(ctl, id)
+	}
+	// the hook of the job is only bound to the task submitting it
+	var tasks []*models.Task
+	if task != nil && len(task.JobID) > 0 {
+		_, tasks, err = ctl.ListTasks(&models.TaskQuery{
+			JobID: task.JobID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if task != nil && len(tasks) == 0 {
+		tasks = []*models.Task{task}
+	}
+	if err = updateTask(ctl, id, task, status, msg); err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if t.ID == id {
+			continue
+		}
+		if err = updateTask(ctl, t.ID, t, status, msg); err != nil {
+			return err
+		}
+	}
+
+	recordExecutions(ctl, policyCtl, tasks)
+	return nil
+}
+
+// checkIn is the message checked in by the job, split into the prefix and the payload following it
+type checkIn struct {
+	prefix  string
+	payload string
+}
+
+func (c *checkIn) handle(ctl operation.Controller, id int64) error {
+	return checkInHandlers[c.prefix](ctl, id, c.payload)
+}
+
+// parse the message checked in by the job, nil is returned if the message isn't a known one
+func parseCheckIn(message string) *checkIn {
+	if len(message) == 0 {
+		return nil
+	}
+	// none of the prefixes is the prefix of another one
+	for prefix := range checkInHandlers {
+		if strings.HasPrefix(message, prefix) {
+			return &checkIn{
+				prefix:  prefix,
+				payload: strings.TrimPrefix(message, prefix),
+			}
+		}
+	}
+	return nil
+}
+
+// checkInHandler handles the payload of the message checked in by the job of the task. The malformed
+// payload is only logged, as it cannot be fixed by retrying the hook
+type checkInHandler func(ctl operation.Controller, id int64, payload string) error
+
+var checkInHandlers = map[string]checkInHandler{
+	transfer.CheckInReadOnly:         pauseTask,
+	transfer.CheckInBlackoutPrefix:   deferTask,
+	transfer.CheckInFailurePrefix:    recordFailure,
+	transfer.CheckInSpeedPrefix:      recordSpeed,
+	transfer.CheckInProgressPrefix:   recordProgress,
+	transfer.CheckInReferrersPrefix:  recordReferrers,
+	transfer.CheckInMediaTypesPrefix: recordMediaTypes,
+	transfer.CheckInEndpointsPrefix:  recordEndpoints,
+}
+
+// the paused task isn't changed by the following status updates of the job
+func pauseTask(ctl operation.Controller, id int64, payload string) error {
+	return ctl.UpdateTaskStatus(id, models.TaskStatusPaused, false)
+}
+
+func deferTask(ctl operation.Controller, id int64, payload string) error {
+	log.Debugf("the destination registry of the task %d is in blackout until %s", id, payload)
+	return ctl.DeferTask(id)
+}
+
+// only record the reason, the status is updated by the following status update of the failed job
+func recordFailure(ctl operation.Controller, id int64, payload string) error {
+	return ctl.UpdateTaskStatusText(id, payload)
+}
+
+func recordSpeed(ctl operation.Controller, id int64, payload string) error {
+	speed := &transfer.Speed{}
+	if err := json.Unmarshal([]byte(payload), speed); err != nil {
+		log.Errorf("failed to parse the speed checked in by the task %d: %v", id, err)
+		return nil
+	}
+	return ctl.UpdateTaskSpeed(id, speed.Bytes, speed.Average, speed.Peak)
+}
+
+func recordProgress(ctl operation.Controller, id int64, payload string) error {
+	progress := &transfer.Progress{}
+	if err := json.Unmarshal([]byte(payload), progress); err != nil {
+		log.Errorf("failed to parse the progress checked in by the task %d: %v", id, err)
+		return nil
+	}
+	var eta int64
+	if progress.ETA != nil {
+		eta = *progress.ETA
+	}
+	return ctl.UpdateTaskProgress(id, progress.Bytes, progress.Total, eta)
+}
+
+func recordReferrers(ctl operation.Controller, id int64, payload string) error {
+	count, err := strconv.Atoi(payload)
+	if err != nil {
+		log.Errorf("failed to parse the count of the referrers checked in by the task %d: %v", id, err)
+		return nil
+	}
+	return ctl.UpdateTaskReferrers(id, count)
+}
+
+func recordMediaTypes(ctl operation.Controller, id int64, payload string) error {
+	return ctl.UpdateTaskMediaTypes(id, payload)
+}
+
+func recordEndpoints(ctl operation.Controller, id int64, payload string) error {
+	endpoints := strings.Fields(payload)
+	if len(endpoints) != 2 {
+		log.Errorf("invalid endpoints checked in by the task %d: %s", id, payload)
+		return nil
+	}
+	return ctl.UpdateTaskEndpoints(id, endpoints[0], endpoints[1])
+}
+
+// record the executions of the tasks finished by the update in their policies, only the hook marking the
+// execution as recorded records it, as the hooks of the tasks of the same execution may run concurrently.
+// The failure of recording doesn't fail the hook, otherwise the status update is retried
+func recordExecutions(ctl operation.Controller, policyCtl policy.Controller, tasks []*models.Task) {
+	recorded := map[int64]struct{}{}
+	for _, t := range tasks {
+		if _, exist := recorded[t.ExecutionID]; exist {
+			continue
+		}
+		recorded[t.ExecutionID] = struct{}{}
+		// getting the execution stores its final status if all its tasks are finished
+		execution, err := ctl.GetExecution(t.ExecutionID)
+		if err != nil {
+			log.Errorf("failed to get the execution %d: %v", t.ExecutionID, err)
+			continue
+		}
+		if execution == nil || !models.ExecutionFinished(execution.Status) {
+			continue
+		}
+		marked, err := ctl.MarkExecutionRecorded(execution.ID)
+		if err != nil {
+			log.Errorf("failed to mark the execution %d as recorded: %v", execution.ID, err)
+			continue
+		}
+		if !marked {
+			continue
+		}
+		if err = recordExecution(policyCtl, execution); err != nil {
+			log.Errorf("failed to record the execution %d in its policy: %v", execution.ID, err)
+		}
+	}
+}
+
+func isJobFinished(status string) bool {
+	s := job.Status(status)
+	return s == job.StoppedStatus || s == job.ErrorStatus || s == job.SuccessStatus
+}
+
+func updateTask(ctl operation.Controller, id int64, task *models.Task, status *JobStatus, msg *checkIn) error {
+	if msg != nil {
+		return msg.handle(ctl, id)
+	}
+	if task != nil && task.Status == models.TaskStatusPaused {
+		return nil
+	}
+
+	jobStatus := job.Status(status.Status)
 	// convert the job status to task status
 	s := ""
 	switch jobStatus {
@@ -37,5 +244,5 @@ func UpdateTask(ctl operation.Controller, id int64, status string) error {
 	case job.SuccessStatus:
 		s = models.TaskStatusSucceed
 	}
-	return ctl.UpdateTaskStatus(id, s)
+	return ctl.UpdateTaskStatus(id, s, status.Dead)
 }
@@ -16,19 +16,31 @@ package hook
 
 import (
 	"testing"
+	"time"
 
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
+	"github.com/goharbor/harbor/src/replication/transfer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type fakedOperationController struct {
-	status string
+	status     string
+	dead       bool
+	statusText string
+	speed      *transfer.Speed
+	referrers  int
+	mediaTypes string
+	endpoints  []string
+	progress   *transfer.Progress
+	task       *models.Task
+	deferred   bool
 }
 
-func (f *fakedOperationController) StartReplication(*model.Policy, *model.Resource, model.TriggerType) (int64, error) {
+func (f *fakedOperationController) StartReplication(*model.Policy, *model.Resource, model.TriggerType, map[string]string) (int64, error) {
 	return 0, nil
 }
 func (f *fakedOperationController) StopReplication(int64) error {
@@ -40,19 +52,80 @@ func (f *fakedOperationController) ListExecutions(...*models.ExecutionQuery) (in
 func (f *fakedOperationController) GetExecution(int64) (*models.Execution, error) {
 	return nil, nil
 }
+func (f *fakedOperationController) MarkExecutionRecorded(int64) (bool, error) {
+	return false, nil
+}
 func (f *fakedOperationController) ListTasks(...*models.TaskQuery) (int64, []*models.Task, error) {
 	return 0, nil, nil
 }
 func (f *fakedOperationController) GetTask(int64) (*models.Task, error) {
-	return nil, nil
+	return f.task, nil
 }
-func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, statusCondition ...string) error {
+func (f *fakedOperationController) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
 	f.status = status
+	f.dead = dead
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskStatusText(id int64, text string) error {
+	f.statusText = text
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskSpeed(id int64, bytes int64, average, peak float64) error {
+	f.speed = &transfer.Speed{
+		Bytes:   bytes,
+		Average: average,
+		Peak:    peak,
+	}
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskProgress(id int64, bytes, total, eta int64) error {
+	f.progress = &transfer.Progress{
+		Bytes: bytes,
+		Total: total,
+		ETA:   &eta,
+	}
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskReferrers(id int64, count int) error {
+	f.referrers = count
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskEndpoints(id int64, src, dst string) error {
+	f.endpoints = []string{src, dst}
+	return nil
+}
+func (f *fakedOperationController) UpdateTaskMediaTypes(id int64, mediaTypes string) error {
+	f.mediaTypes = mediaTypes
 	return nil
 }
 func (f *fakedOperationController) GetTaskLog(int64) ([]byte, error) {
 	return nil, nil
 }
+func (f *fakedOperationController) RetryFailedTasks(policyID int64, since, until *time.Time) (int, error) {
+	return 0, nil
+}
+func (f *fakedOperationController) RetryFailedRepositories(policy *model.Policy, executionID int64) (int64, []string, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) ListDeadLetters(...*models.DeadLetterQuery) (int64, []*models.DeadLetter, error) {
+	return 0, nil, nil
+}
+func (f *fakedOperationController) GetDeadLetter(int64) (*models.DeadLetter, error) {
+	return nil, nil
+}
+func (f *fakedOperationController) RequeueDeadLetter(int64) error {
+	return nil
+}
+func (f *fakedOperationController) PreviewReplication(*model.Policy) ([]*flow.PreviewItem, []string, error) {
+	return nil, nil, nil
+}
+func (f *fakedOperationController) ResumeDeferredTasks(int64) (int, error) {
+	return 0, nil
+}
+func (f *fakedOperationController) DeferTask(int64) error {
+	f.deferred = true
+	return nil
+}
 
 func TestUpdateTask(t *testing.T) {
 	mgr := &fakedOperationController{}
@@ -87,8 +160,300 @@ func TestUpdateTask(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		err := UpdateTask(mgr, 1, c.inputStatus)
+		err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{Status: c.inputStatus})
 		require.Nil(t, err)
 		assert.Equal(t, c.expectedStatus, mgr.status)
 	}
 }
+
+func TestUpdateTaskPaused(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	// the job checks in the read-only message
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInReadOnly,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusPaused, mgr.status)
+
+	// the other check in messages don't pause the task
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: "other message",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	// the status of the paused task isn't changed when the job fails
+	mgr.task.Status = models.TaskStatusPaused
+	mgr.status = models.TaskStatusPaused
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{Status: job.ErrorStatus.String()})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusPaused, mgr.status)
+}
+
+func TestUpdateTaskFailureReason(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the reason is recorded when the job checks in the failure
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInFailurePrefix + "manifest unknown",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "manifest unknown", mgr.statusText)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{Status: job.ErrorStatus.String()})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusFailed, mgr.status)
+	assert.False(t, mgr.dead)
+	assert.Equal(t, "manifest unknown", mgr.statusText)
+
+	// the job won't be retried any more
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{Status: job.ErrorStatus.String(), Dead: true})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusFailed, mgr.status)
+	assert.True(t, mgr.dead)
+}
+
+func TestUpdateTaskSpeed(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the speed is recorded when the job checks in the speed
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInSpeedPrefix + `{"bytes":1048576,"average":1.5,"peak":2.25}`,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, &transfer.Speed{Bytes: 1048576, Average: 1.5, Peak: 2.25}, mgr.speed)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	// the malformed speed is ignored
+	mgr.speed = nil
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInSpeedPrefix + "invalid",
+	})
+	require.Nil(t, err)
+	assert.Nil(t, mgr.speed)
+}
+
+func TestUpdateTaskProgress(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the progress is recorded when the job checks it in
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInProgressPrefix + `{"bytes":10,"total":40,"eta":30}`,
+	})
+	require.Nil(t, err)
+	require.NotNil(t, mgr.progress)
+	assert.Equal(t, int64(10), mgr.progress.Bytes)
+	assert.Equal(t, int64(40), mgr.progress.Total)
+	assert.Equal(t, int64(30), *mgr.progress.ETA)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	// the ETA not estimated yet is recorded as 0
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInProgressPrefix + `{"bytes":10,"total":40}`,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), *mgr.progress.ETA)
+
+	// the malformed progress is ignored
+	mgr.progress = nil
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInProgressPrefix + "invalid",
+	})
+	require.Nil(t, err)
+	assert.Nil(t, mgr.progress)
+}
+
+func TestUpdateTaskReferrers(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the count of the referrers is recorded when the job checks it in
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInReferrersPrefix + "3",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 3, mgr.referrers)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	// the malformed count is ignored
+	mgr.referrers = 0
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInReferrersPrefix + "invalid",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 0, mgr.referrers)
+}
+
+func TestUpdateTaskMediaTypes(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the media types are recorded when the job checks them in
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInMediaTypesPrefix + "application/vnd.oci.image.manifest.v1+json",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "application/vnd.oci.image.manifest.v1+json", mgr.mediaTypes)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+}
+
+// coalescedOperationController holds the tasks coalesced into the same job
+type coalescedOperationController struct {
+	fakedOperationController
+	tasks    []*models.Task
+	statuses map[int64]string
+}
+
+func (c *coalescedOperationController) GetTask(id int64) (*models.Task, error) {
+	for _, task := range c.tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+func (c *coalescedOperationController) ListTasks(query ...*models.TaskQuery) (int64, []*models.Task, error) {
+	var tasks []*models.Task
+	for _, task := range c.tasks {
+		if len(query) > 0 && task.JobID == query[0].JobID {
+			tasks = append(tasks, task)
+		}
+	}
+	return int64(len(tasks)), tasks, nil
+}
+func (c *coalescedOperationController) UpdateTaskStatus(id int64, status string, dead bool, statusCondition ...string) error {
+	c.statuses[id] = status
+	return nil
+}
+
+func TestUpdateCoalescedTasks(t *testing.T) {
+	ctl := &coalescedOperationController{
+		tasks: []*models.Task{
+			{ID: 1, JobID: "job-1", Status: models.TaskStatusInProgress},
+			{ID: 2, JobID: "job-1", Status: models.TaskStatusPending},
+			{ID: 3, JobID: "job-1", Status: models.TaskStatusPaused},
+			{ID: 4, JobID: "job-2", Status: models.TaskStatusInProgress},
+		},
+		statuses: map[int64]string{},
+	}
+	err := UpdateTask(ctl, &fakedPolicyController{}, 1, &JobStatus{Status: job.SuccessStatus.String()})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusSucceed, ctl.statuses[1])
+	assert.Equal(t, models.TaskStatusSucceed, ctl.statuses[2])
+	// the paused task isn't changed
+	_, exist := ctl.statuses[3]
+	assert.False(t, exist)
+	// the task of the other job isn't changed
+	_, exist = ctl.statuses[4]
+	assert.False(t, exist)
+}
+
+func TestUpdateTaskEndpoints(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	mgr.status = models.TaskStatusInProgress
+	// only the endpoints are recorded when the job checks them in
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInEndpointsPrefix + "https://src.example.com https://secondary.example.com",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"https://src.example.com", "https://secondary.example.com"}, mgr.endpoints)
+	assert.Equal(t, models.TaskStatusInProgress, mgr.status)
+
+	// the invalid endpoints are ignored
+	mgr.endpoints = nil
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInEndpointsPrefix + "https://src.example.com",
+	})
+	require.Nil(t, err)
+	assert.Nil(t, mgr.endpoints)
+}
+
+func TestUpdateTaskInBlackout(t *testing.T) {
+	mgr := &fakedOperationController{
+		task: &models.Task{
+			JobID:  "job1",
+			Status: models.TaskStatusInProgress,
+		},
+	}
+	// the job checks in the blackout, the task is deferred
+	err := UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		JobID:   "job1",
+		Status:  job.RunningStatus.String(),
+		CheckIn: transfer.CheckInBlackoutPrefix + "2026-10-15T17:00:00Z",
+	})
+	require.Nil(t, err)
+	assert.True(t, mgr.deferred)
+	assert.Empty(t, mgr.status)
+
+	// the final status of the deferred job is dropped as the task is bound to the new job
+	mgr.task.JobID = "job2"
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		JobID:  "job1",
+		Status: job.SuccessStatus.String(),
+	})
+	require.Nil(t, err)
+	assert.Empty(t, mgr.status)
+
+	// the status of the new job is updated
+	err = UpdateTask(mgr, &fakedPolicyController{}, 1, &JobStatus{
+		JobID:  "job2",
+		Status: job.SuccessStatus.String(),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, models.TaskStatusSucceed, mgr.status)
+}
+
+func TestParseCheckIn(t *testing.T) {
+	assert.Nil(t, parseCheckIn(""))
+	assert.Nil(t, parseCheckIn("other message"))
+
+	msg := parseCheckIn(transfer.CheckInReadOnly)
+	require.NotNil(t, msg)
+	assert.Equal(t, transfer.CheckInReadOnly, msg.prefix)
+	assert.Equal(t, "", msg.payload)
+
+	msg = parseCheckIn(transfer.CheckInFailurePrefix + "manifest unknown: library/hello-world")
+	require.NotNil(t, msg)
+	assert.Equal(t, transfer.CheckInFailurePrefix, msg.prefix)
+	assert.Equal(t, "manifest unknown: library/hello-world", msg.payload)
+}
@@ -15,25 +15,47 @@
 package scheduler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	cjob "github.com/goharbor/harbor/src/common/job"
 	"github.com/goharbor/harbor/src/common/job/models"
+	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/replication/config"
+	rep_models "github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/goharbor/harbor/src/replication/registry"
 )
 
+// the pending jobs submitted earlier than it aren't coalesced into, it keeps the
+// tasks whose status is never updated by the job from being coalesced into forever
+const inflightJobTTL = time.Hour
+
+// TaskStore reads and updates the tasks of the items, it's implemented by the execution manager
+type TaskStore interface {
+	ListTasks(...*rep_models.TaskQuery) (int64, []*rep_models.Task, error)
+	UpdateTask(task *rep_models.Task, props ...string) error
+	UpdateTaskStatus(taskID int64, status string, statusCondition ...string) error
+}
+
 type defaultScheduler struct {
 	client cjob.Client
+	// the jobs submitted and the items deferred are recorded on the tasks, so they're
+	// shared by all the instances of core and kept across restarts
+	tasks TaskStore
 }
 
 // NewScheduler returns an instance of Scheduler
-func NewScheduler(js cjob.Client) Scheduler {
+func NewScheduler(js cjob.Client, tasks TaskStore) Scheduler {
 	return &defaultScheduler{
 		client: js,
+		tasks:  tasks,
 	}
 }
 
@@ -48,7 +70,14 @@ type ScheduleItem struct {
 type ScheduleResult struct {
 	TaskID int64
 	JobID  string
-	Error  error
+	// Coalesced indicates the item is coalesced into the identical job which
+	// hasn't started yet rather than submitted as a new job
+	Coalesced bool
+	// Deferred indicates the item isn't submitted as the source or destination
+	// registry is draining, it's recorded on the task and returned by "TakeDeferred"
+	// when the draining ends
+	Deferred bool
+	Error    error
 }
 
 // Scheduler schedules
@@ -57,8 +86,15 @@ type Scheduler interface {
 	Preprocess([]*model.Resource, []*model.Resource) ([]*ScheduleItem, error)
 	// Schedule the items. If got error when scheduling one of the items,
 	// the error should be put in the corresponding ScheduleResult and the
-	// returning error of this function should be nil
+	// returning error of this function should be nil. The item identical to
+	// a pending job is coalesced into it and gets the ID of the job
 	Schedule([]*ScheduleItem) ([]*ScheduleResult, error)
+	// Reschedule submits a new job for the task with the same parameters
+	// as the job specified by "jobID", and returns the ID of the new job
+	Reschedule(taskID int64, jobID string) (string, error)
+	// TakeDeferred removes and returns the items deferred as the registry specified
+	// by the ID is draining, the registry is marked as not draining in the items
+	TakeDeferred(registryID int64) ([]*ScheduleItem, error)
 	// Stop the job specified by ID
 	Stop(id string) error
 }
@@ -94,14 +130,6 @@ func (d *defaultScheduler) Schedule(items []*ScheduleItem) ([]*ScheduleResult, e
 			results = append(results, result)
 			continue
 		}
-		j := &models.JobData{
-			Metadata: &models.JobMetadata{
-				JobKind: job.KindGeneric,
-			},
-			StatusHook: fmt.Sprintf("%s/service/notifications/jobs/replication/task/%d", config.Config.CoreURL, item.TaskID),
-		}
-
-		j.Name = job.Replication
 		src, err := json.Marshal(item.SrcResource)
 		if err != nil {
 			result.Error = err
@@ -114,22 +142,281 @@ func (d *defaultScheduler) Schedule(items []*ScheduleItem) ([]*ScheduleResult, e
 			results = append(results, result)
 			continue
 		}
-		j.Parameters = map[string]interface{}{
+		if draining := drainingRegistry(item); draining != nil {
+			if err = d.deferItem(item, draining.ID); err != nil {
+				result.Error = err
+				results = append(results, result)
+				continue
+			}
+			log.Debugf("the registry %s of task %d is draining, the task is deferred", draining.Name, item.TaskID)
+			result.Deferred = true
+			results = append(results, result)
+			continue
+		}
+		key := inflightKey(item)
+		if id := d.pendingJob(key); len(id) > 0 {
+			log.Debugf("the task %d is coalesced into the identical job %s", item.TaskID, id)
+			result.JobID = id
+			result.Coalesced = true
+			results = append(results, result)
+			continue
+		}
+		j := newJobData(item.TaskID, map[string]interface{}{
 			"src_resource": string(src),
 			"dst_resource": string(dest),
-		}
+		}, item.DstResource)
 		id, joberr := d.client.SubmitJob(j)
 		if joberr != nil {
 			result.Error = joberr
 			results = append(results, result)
 			continue
 		}
+		d.addInflightJob(item.TaskID, key, id)
 		result.JobID = id
 		results = append(results, result)
 	}
 	return results, nil
 }
 
+// returns the source or destination registry of the item which is draining
+func drainingRegistry(item *ScheduleItem) *model.Registry {
+	for _, res := range []*model.Resource{item.SrcResource, item.DstResource} {
+		if res != nil && res.Registry != nil && res.Registry.Draining {
+			return res.Registry
+		}
+	}
+	return nil
+}
+
+// records the item on the task deferred as the registry specified by the ID is draining. The item
+// carries the credentials of the registries, so it's encrypted as the secrets of the registries
+func (d *defaultScheduler) deferItem(item *ScheduleItem, registryID int64) error {
+	if d.tasks == nil {
+		return errors.New("no task store to record the deferred task")
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	encrypted, err := registry.Encrypt(string(data))
+	if err != nil {
+		return err
+	}
+	return d.tasks.UpdateTask(&rep_models.Task{
+		ID:                 item.TaskID,
+		DeferredRegistryID: registryID,
+		DeferredItem:       encrypted,
+	}, rep_models.TaskPropsName.DeferredRegistryID, rep_models.TaskPropsName.DeferredItem)
+}
+
+// TakeDeferred removes and returns the items deferred as the registry specified by the ID is draining,
+// the tasks which aren't initialized any more, e.g. stopped during the draining, are dropped
+func (d *defaultScheduler) TakeDeferred(registryID int64) ([]*ScheduleItem, error) {
+	if d.tasks == nil {
+		return nil, nil
+	}
+	_, tasks, err := d.tasks.ListTasks(&rep_models.TaskQuery{
+		DeferredRegistryID: registryID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []*ScheduleItem{}
+	for _, task := range tasks {
+		data, err := registry.Decrypt(task.DeferredItem)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.tasks.UpdateTask(&rep_models.Task{
+			ID: task.ID,
+		}, rep_models.TaskPropsName.DeferredRegistryID, rep_models.TaskPropsName.DeferredItem); err != nil {
+			return nil, err
+		}
+		if task.Status != rep_models.TaskStatusInitialized {
+			log.Debugf("the deferred task %d isn't initialized any more, skip", task.ID)
+			continue
+		}
+		item := &ScheduleItem{}
+		if err = json.Unmarshal([]byte(data), item); err != nil {
+			return nil, err
+		}
+		item.TaskID = task.ID
+		for _, res := range []*model.Resource{item.SrcResource, item.DstResource} {
+			if res != nil && res.Registry != nil && res.Registry.ID == registryID {
+				res.Registry.Draining = false
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// inflightContent is the content replicated by the job of an item, the items with the
+// identical content are coalesced into the same job
+type inflightContent struct {
+	Type               model.ResourceType `json:"type"`
+	SrcRegistryID      int64              `json:"src_registry_id"`
+	SrcRegistry        string             `json:"src_registry"`
+	SrcRepository      string             `json:"src_repository"`
+	SrcTags            []string           `json:"src_tags"`
+	DstRegistryID      int64              `json:"dst_registry_id"`
+	DstRegistry        string             `json:"dst_registry"`
+	DstRepository      string             `json:"dst_repository"`
+	DstTags            []string           `json:"dst_tags"`
+	ImmutableTags      []string           `json:"immutable_tags"`
+	Override           bool               `json:"override"`
+	ReplicateReferrers bool               `json:"replicate_referrers"`
+	PauseOnReadOnly    bool               `json:"pause_on_read_only"`
+	BlobSources        map[string]string  `json:"blob_sources"`
+	CompressLayers     bool               `json:"compress_layers"`
+	MountBlobs         bool               `json:"mount_blobs"`
+	BlobAccounting     bool               `json:"blob_accounting"`
+	DryRun             bool               `json:"dry_run"`
+}
+
+// build the key identifying the items which replicate the same content with the same options,
+// it's the hash of all the fields of the resources affecting the transfer. The empty key is
+// returned for the items which cannot be coalesced. As the digests of the tags are resolved
+// when the job runs, the job is only coalesced into before it starts, so the latest content
+// of the tags is always replicated
+func inflightKey(item *ScheduleItem) string {
+	src, dst := item.SrcResource, item.DstResource
+	if src == nil || dst == nil || dst.Deleted ||
+		src.Registry == nil || dst.Registry == nil ||
+		src.Metadata == nil || dst.Metadata == nil || len(dst.Metadata.Vtags) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(&inflightContent{
+		Type:               src.Type,
+		SrcRegistryID:      src.Registry.ID,
+		SrcRegistry:        src.Registry.URL,
+		SrcRepository:      src.Metadata.GetResourceName(),
+		SrcTags:            src.Metadata.Vtags,
+		DstRegistryID:      dst.Registry.ID,
+		DstRegistry:        dst.Registry.URL,
+		DstRepository:      dst.Metadata.GetResourceName(),
+		DstTags:            dst.Metadata.Vtags,
+		ImmutableTags:      dst.Metadata.ImmutableTags,
+		Override:           dst.Override,
+		ReplicateReferrers: dst.ReplicateReferrers,
+		PauseOnReadOnly:    dst.PauseOnReadOnly,
+		BlobSources:        dst.BlobSources,
+		CompressLayers:     dst.CompressLayers,
+		MountBlobs:         dst.MountBlobs,
+		BlobAccounting:     dst.BlobAccounting,
+		// the dry run pushes nothing, so it never stands in for the real replication
+		DryRun: dst.DryRun,
+	})
+	if err != nil {
+		log.Warningf("failed to build the key of the task %d: %v", item.TaskID, err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// returns the ID of the job submitted for the key if it hasn't started yet. The status of the
+// tasks is updated by the status hook of the jobs, so the job which has just started may still
+// be coalesced into before its hook arrives
+func (d *defaultScheduler) pendingJob(key string) string {
+	if len(key) == 0 || d.tasks == nil {
+		return ""
+	}
+	from := time.Now().Add(-inflightJobTTL)
+	_, tasks, err := d.tasks.ListTasks(&rep_models.TaskQuery{
+		InflightKey:   key,
+		Statuses:      []string{rep_models.TaskStatusPending},
+		StartTimeFrom: &from,
+		Pagination: rep_models.Pagination{
+			Page: 1,
+			Size: 1,
+		},
+	})
+	if err != nil {
+		log.Warningf("failed to get the pending job of the key %s: %v", key, err)
+		return ""
+	}
+	if len(tasks) == 0 {
+		return ""
+	}
+	return tasks[0].JobID
+}
+
+// records the job submitted for the task with the key, the task is marked as pending
+// so that the identical items scheduled right after it are coalesced into the job
+func (d *defaultScheduler) addInflightJob(taskID int64, key, id string) {
+	if len(key) == 0 || d.tasks == nil {
+		return
+	}
+	now := time.Now()
+	if err := d.tasks.UpdateTask(&rep_models.Task{
+		ID:          taskID,
+		JobID:       id,
+		StartTime:   &now,
+		InflightKey: key,
+	}, rep_models.TaskPropsName.JobID, rep_models.TaskPropsName.StartTime,
+		rep_models.TaskPropsName.InflightKey); err != nil {
+		log.Warningf("failed to record the job %s of the task %d: %v", id, taskID, err)
+		return
+	}
+	if err := d.tasks.UpdateTaskStatus(taskID, rep_models.TaskStatusPending, rep_models.TaskStatusInitialized); err != nil {
+		log.Warningf("failed to update the status of the task %d: %v", taskID, err)
+	}
+}
+
+// Reschedule submits a new job for the task with the parameters of the job specified by "jobID",
+// the parameters are read from the job stats kept by jobservice
+func (d *defaultScheduler) Reschedule(taskID int64, jobID string) (string, error) {
+	if taskID == 0 {
+		return "", errors.New("the task doesn't have a ID")
+	}
+	stats, err := d.client.GetJob(jobID)
+	if err != nil {
+		return "", err
+	}
+	if stats == nil || stats.Info == nil || len(stats.Info.Parameters) == 0 {
+		return "", fmt.Errorf("the parameters of job %s not found", jobID)
+	}
+	dst := &model.Resource{}
+	if data, ok := stats.Info.Parameters["dst_resource"].(string); ok {
+		if err = json.Unmarshal([]byte(data), dst); err != nil {
+			return "", err
+		}
+	}
+	return d.client.SubmitJob(newJobData(taskID, stats.Info.Parameters, dst))
+}
+
+// build the replication job whose status is reported to the task specified by "taskID". The
+// job is deferred to the end of the blackout if the destination registry is in blackout now
+func newJobData(taskID int64, parameters map[string]interface{}, dst *model.Resource) *models.JobData {
+	j := &models.JobData{
+		Name: job.Replication,
+		Metadata: &models.JobMetadata{
+			JobKind: job.KindGeneric,
+		},
+		Parameters: parameters,
+		StatusHook: fmt.Sprintf("%s/service/notifications/jobs/replication/task/%d", config.Config.CoreURL, taskID),
+	}
+	if dst == nil || dst.Registry == nil {
+		return j
+	}
+	now := time.Now()
+	end, inBlackout := dst.Registry.BlackoutEnd(now)
+	if !inBlackout {
+		return j
+	}
+	// round up to make sure the job runs after the blackout ends
+	delay := uint64(math.Ceil(end.Sub(now).Seconds()))
+	if delay == 0 {
+		return j
+	}
+	j.Metadata.JobKind = job.KindScheduled
+	j.Metadata.ScheduleDelay = delay
+	log.Debugf("the destination registry %s of task %d is in blackout, the job is deferred to %s",
+		dst.Registry.Name, taskID, end)
+	return j
+}
+
 // Stop the transfer job
 func (d *defaultScheduler) Stop(id string) error {
 	err := d.client.PostAction(id, string(job.StopCommand))
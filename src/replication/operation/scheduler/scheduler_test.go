@@ -2,11 +2,18 @@ package scheduler
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/goharbor/harbor/src/common/job/models"
+	"github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/job"
+	rep_config "github.com/goharbor/harbor/src/replication/config"
+	rep_models "github.com/goharbor/harbor/src/replication/dao/models"
 	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var scheduler = &defaultScheduler{
@@ -25,9 +32,41 @@ func (client TestClient) GetJobLog(uuid string) ([]byte, error) {
 func (client TestClient) PostAction(uuid, action string) error {
 	return nil
 }
+func (client TestClient) GetJob(uuid string) (*job.Stats, error) {
+	if uuid != "failed-uuid" {
+		return nil, fmt.Errorf("job %s not found", uuid)
+	}
+	return &job.Stats{
+		Info: &job.StatsInfo{
+			JobID: uuid,
+			Parameters: job.Parameters{
+				"src_resource": "{}",
+				"dst_resource": "{}",
+			},
+		},
+	}, nil
+}
 func (client TestClient) GetExecutions(uuid string) ([]job.Stats, error) {
 	return nil, nil
 }
+func (client TestClient) GetConfig() (*config.Settings, error) {
+	return nil, nil
+}
+func (client TestClient) ReloadConfig() (*config.Settings, error) {
+	return nil, nil
+}
+func (client TestClient) SetMaintenance(enabled bool) (*job.Maintenance, error) {
+	return nil, nil
+}
+func (client TestClient) GetMaintenance() (*job.Maintenance, error) {
+	return nil, nil
+}
+func (client TestClient) WarmUp(registry *model.Registry) (*model.WarmupStatus, error) {
+	return nil, nil
+}
+func (client TestClient) GetWarmups() ([]*model.WarmupStatus, error) {
+	return nil, nil
+}
 
 func TestPreprocess(t *testing.T) {
 	items, err := generateData()
@@ -44,6 +83,102 @@ func TestPreprocess(t *testing.T) {
 
 }
 
+func TestReschedule(t *testing.T) {
+	rep_config.Config = &rep_config.Configuration{}
+	jobID, err := scheduler.Reschedule(1, "failed-uuid")
+	if err != nil {
+		t.Error(err)
+	}
+	if jobID != "submited-uuid" {
+		t.Errorf("unexpected job ID: %s", jobID)
+	}
+
+	// the job doesn't exist
+	if _, err = scheduler.Reschedule(1, "unknown-uuid"); err == nil {
+		t.Error("expected error when the job doesn't exist")
+	}
+
+	// no task ID
+	if _, err = scheduler.Reschedule(0, "failed-uuid"); err == nil {
+		t.Error("expected error when the task ID is empty")
+	}
+}
+
+// recordingClient records the submitted jobs
+type recordingClient struct {
+	TestClient
+	jobs []*models.JobData
+}
+
+func (r *recordingClient) SubmitJob(j *models.JobData) (string, error) {
+	r.jobs = append(r.jobs, j)
+	return "submited-uuid", nil
+}
+
+func TestScheduleInBlackout(t *testing.T) {
+	rep_config.Config = &rep_config.Configuration{}
+	client := &recordingClient{}
+	s := &defaultScheduler{
+		client: client,
+	}
+	now := time.Now().UTC()
+	items := []*ScheduleItem{
+		// the destination registry is in blackout
+		{
+			TaskID: 1,
+			DstResource: &model.Resource{
+				Registry: &model.Registry{
+					BlackoutWindows: []*model.BlackoutWindow{
+						{
+							Start: now.Add(-1 * time.Hour).Format("15:04"),
+							End:   now.Add(1 * time.Hour).Format("15:04"),
+						},
+					},
+				},
+			},
+		},
+		// the blackout of the destination registry hasn't begun
+		{
+			TaskID: 2,
+			DstResource: &model.Resource{
+				Registry: &model.Registry{
+					BlackoutWindows: []*model.BlackoutWindow{
+						{
+							Start: now.Add(1 * time.Hour).Format("15:04"),
+							End:   now.Add(2 * time.Hour).Format("15:04"),
+						},
+					},
+				},
+			},
+		},
+	}
+	results, err := s.Schedule(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+	}
+	if len(client.jobs) != 2 {
+		t.Fatalf("unexpected count of jobs: %d", len(client.jobs))
+	}
+
+	// the job is deferred to the end of the blackout
+	deferred := client.jobs[0].Metadata
+	if deferred.JobKind != job.KindScheduled {
+		t.Errorf("the job should be deferred, but the kind is %s", deferred.JobKind)
+	}
+	if deferred.ScheduleDelay <= 0 || deferred.ScheduleDelay > 3600 {
+		t.Errorf("unexpected schedule delay: %d", deferred.ScheduleDelay)
+	}
+	// the job runs immediately
+	if client.jobs[1].Metadata.JobKind != job.KindGeneric {
+		t.Errorf("the job shouldn't be deferred, but the kind is %s", client.jobs[1].Metadata.JobKind)
+	}
+}
+
 func TestStop(t *testing.T) {
 	err := scheduler.Stop("id")
 	if err != nil {
@@ -79,3 +214,267 @@ func generateData() ([]*ScheduleItem, error) {
 	items, err := scheduler.Preprocess([]*model.Resource{srcResource}, []*model.Resource{destResource})
 	return items, err
 }
+
+// inflightClient submits the jobs with unique IDs
+type inflightClient struct {
+	TestClient
+	submitted int
+}
+
+func (i *inflightClient) SubmitJob(*models.JobData) (string, error) {
+	i.submitted++
+	return fmt.Sprintf("job-%d", i.submitted), nil
+}
+
+// fakedTaskStore keeps the tasks in memory
+type fakedTaskStore struct {
+	tasks map[int64]*rep_models.Task
+}
+
+func (f *fakedTaskStore) task(id int64) *rep_models.Task {
+	t, exist := f.tasks[id]
+	if !exist {
+		t = &rep_models.Task{
+			ID:     id,
+			Status: rep_models.TaskStatusInitialized,
+		}
+		f.tasks[id] = t
+	}
+	return t
+}
+
+func (f *fakedTaskStore) ListTasks(query ...*rep_models.TaskQuery) (int64, []*rep_models.Task, error) {
+	tasks := []*rep_models.Task{}
+	q := query[0]
+	for _, t := range f.tasks {
+		if q.DeferredRegistryID != 0 {
+			if t.DeferredRegistryID == q.DeferredRegistryID {
+				tasks = append(tasks, t)
+			}
+			continue
+		}
+		if t.InflightKey != q.InflightKey || t.Status != q.Statuses[0] || t.StartTime.Before(*q.StartTimeFrom) {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	return int64(len(tasks)), tasks, nil
+}
+
+func (f *fakedTaskStore) UpdateTask(task *rep_models.Task, props ...string) error {
+	t := f.task(task.ID)
+	for _, prop := range props {
+		switch prop {
+		case rep_models.TaskPropsName.JobID:
+			t.JobID = task.JobID
+		case rep_models.TaskPropsName.StartTime:
+			t.StartTime = task.StartTime
+		case rep_models.TaskPropsName.InflightKey:
+			t.InflightKey = task.InflightKey
+		case rep_models.TaskPropsName.DeferredRegistryID:
+			t.DeferredRegistryID = task.DeferredRegistryID
+		case rep_models.TaskPropsName.DeferredItem:
+			t.DeferredItem = task.DeferredItem
+		}
+	}
+	return nil
+}
+
+func (f *fakedTaskStore) UpdateTaskStatus(taskID int64, status string, statusCondition ...string) error {
+	t := f.task(taskID)
+	if len(statusCondition) > 0 && t.Status != statusCondition[0] {
+		return nil
+	}
+	t.Status = status
+	return nil
+}
+
+func newSingleImageItem(taskID int64, tag string) *ScheduleItem {
+	return &ScheduleItem{
+		TaskID: taskID,
+		SrcResource: &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{Name: "library/hello-world"},
+				Vtags:      []string{tag},
+			},
+			Registry: &model.Registry{URL: "https://source.harbor.com"},
+		},
+		DstResource: &model.Resource{
+			Type: model.ResourceTypeImage,
+			Metadata: &model.ResourceMetadata{
+				Repository: &model.Repository{Name: "library/hello-world"},
+				Vtags:      []string{tag},
+			},
+			Registry: &model.Registry{URL: "https://target.harbor.com"},
+		},
+	}
+}
+
+func TestScheduleDuplicateJobs(t *testing.T) {
+	rep_config.Config = &rep_config.Configuration{}
+	client := &inflightClient{}
+	store := &fakedTaskStore{
+		tasks: map[int64]*rep_models.Task{},
+	}
+	s := NewScheduler(client, store)
+
+	// the identical items submitted rapidly are coalesced into the first job
+	var results []*ScheduleResult
+	for i := int64(1); i <= 3; i++ {
+		rs, err := s.Schedule([]*ScheduleItem{newSingleImageItem(i, "latest")})
+		require.Nil(t, err)
+		require.Equal(t, 1, len(rs))
+		require.Nil(t, rs[0].Error)
+		results = append(results, rs[0])
+	}
+	assert.Equal(t, 1, client.submitted)
+	assert.False(t, results[0].Coalesced)
+	for _, r := range results {
+		assert.Equal(t, "job-1", r.JobID)
+	}
+	assert.True(t, results[1].Coalesced)
+	assert.True(t, results[2].Coalesced)
+
+	// the identical items in the same batch are coalesced as well
+	rs, err := s.Schedule([]*ScheduleItem{
+		newSingleImageItem(4, "latest"),
+		newSingleImageItem(5, "v1"),
+		newSingleImageItem(6, "v1"),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "job-1", rs[0].JobID)
+	assert.Equal(t, "job-2", rs[1].JobID)
+	assert.Equal(t, "job-2", rs[2].JobID)
+	assert.True(t, rs[2].Coalesced)
+	assert.Equal(t, 2, client.submitted)
+
+	// the job which has started isn't coalesced into
+	store.task(1).Status = rep_models.TaskStatusInProgress
+	rs, err = s.Schedule([]*ScheduleItem{newSingleImageItem(7, "latest")})
+	require.Nil(t, err)
+	assert.Equal(t, "job-3", rs[0].JobID)
+	assert.False(t, rs[0].Coalesced)
+
+	// the deletion isn't coalesced
+	deletion := newSingleImageItem(8, "v1")
+	deletion.DstResource.Deleted = true
+	rs, err = s.Schedule([]*ScheduleItem{deletion})
+	require.Nil(t, err)
+	assert.Equal(t, "job-4", rs[0].JobID)
+	assert.False(t, rs[0].Coalesced)
+
+	// the dry run isn't coalesced into the real replication
+	dryRun := newSingleImageItem(9, "v1")
+	dryRun.DstResource.DryRun = true
+	rs, err = s.Schedule([]*ScheduleItem{dryRun})
+	require.Nil(t, err)
+	assert.Equal(t, "job-5", rs[0].JobID)
+	assert.False(t, rs[0].Coalesced)
+
+	// the items with the different options aren't coalesced
+	override := newSingleImageItem(10, "v1")
+	override.DstResource.Override = true
+	retagged := newSingleImageItem(11, "v1")
+	retagged.SrcResource.Metadata.Vtags = []string{"v1.0"}
+	rs, err = s.Schedule([]*ScheduleItem{override, retagged})
+	require.Nil(t, err)
+	assert.Equal(t, "job-6", rs[0].JobID)
+	assert.Equal(t, "job-7", rs[1].JobID)
+	assert.Equal(t, 7, client.submitted)
+
+	// the job submitted long ago isn't coalesced into even if its task is still pending
+	expired := time.Now().Add(-2 * inflightJobTTL)
+	store.task(10).StartTime = &expired
+	rs, err = s.Schedule([]*ScheduleItem{newSingleImageItem(12, "v1")})
+	require.Nil(t, err)
+	assert.Equal(t, "job-2", rs[0].JobID)
+	override = newSingleImageItem(13, "v1")
+	override.DstResource.Override = true
+	rs, err = s.Schedule([]*ScheduleItem{override})
+	require.Nil(t, err)
+	assert.Equal(t, "job-8", rs[0].JobID)
+	assert.False(t, rs[0].Coalesced)
+}
+
+func TestScheduleDraining(t *testing.T) {
+	rep_config.Config = &rep_config.Configuration{
+		SecretKey: "0123456789abcdef",
+	}
+	client := &recordingClient{}
+	store := &fakedTaskStore{
+		tasks: map[int64]*rep_models.Task{},
+	}
+	s := NewScheduler(client, store)
+
+	// the destination registry is draining
+	draining := newSingleImageItem(1, "latest")
+	draining.DstResource.Registry.ID = 2
+	draining.DstResource.Registry.Draining = true
+	draining.DstResource.Registry.Credential = &model.Credential{
+		Type:         model.CredentialTypeBasic,
+		AccessKey:    "admin",
+		AccessSecret: "Harbor12345",
+	}
+	// the source and destination registries are both draining
+	both := newSingleImageItem(2, "v1")
+	both.SrcResource.Registry.ID = 1
+	both.SrcResource.Registry.Draining = true
+	both.DstResource.Registry.ID = 2
+	both.DstResource.Registry.Draining = true
+	results, err := s.Schedule([]*ScheduleItem{draining, both, newSingleImageItem(3, "v2")})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(results))
+	assert.True(t, results[0].Deferred)
+	assert.Empty(t, results[0].JobID)
+	assert.True(t, results[1].Deferred)
+	assert.False(t, results[2].Deferred)
+	assert.NotEmpty(t, results[2].JobID)
+	// only the job of the registries which aren't draining is submitted
+	assert.Equal(t, 1, len(client.jobs))
+	// the deferral is recorded on the tasks with the credentials encrypted
+	assert.Equal(t, int64(2), store.task(1).DeferredRegistryID)
+	assert.NotContains(t, store.task(1).DeferredItem, "Harbor12345")
+	assert.Equal(t, int64(1), store.task(2).DeferredRegistryID)
+
+	// no task is deferred for the registry
+	items, err := s.TakeDeferred(3)
+	require.Nil(t, err)
+	assert.Empty(t, items)
+
+	// the draining of the destination registry ends
+	items, err = s.TakeDeferred(2)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	assert.Equal(t, int64(1), items[0].TaskID)
+	assert.False(t, items[0].DstResource.Registry.Draining)
+	assert.Equal(t, "Harbor12345", items[0].DstResource.Registry.Credential.AccessSecret)
+	assert.Equal(t, int64(0), store.task(1).DeferredRegistryID)
+	assert.Empty(t, store.task(1).DeferredItem)
+	results, err = s.Schedule(items)
+	require.Nil(t, err)
+	assert.False(t, results[0].Deferred)
+	assert.Equal(t, 2, len(client.jobs))
+	items, err = s.TakeDeferred(2)
+	require.Nil(t, err)
+	assert.Empty(t, items)
+
+	// the draining of the source registry ends, the destination registry
+	// recorded when it was deferred is still draining
+	items, err = s.TakeDeferred(1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	assert.Equal(t, int64(2), items[0].TaskID)
+	assert.False(t, items[0].SrcResource.Registry.Draining)
+	results, err = s.Schedule(items)
+	require.Nil(t, err)
+	assert.True(t, results[0].Deferred)
+	assert.Equal(t, int64(2), store.task(2).DeferredRegistryID)
+
+	// the task stopped during the draining is dropped
+	store.task(2).Status = rep_models.TaskStatusStopped
+	items, err = s.TakeDeferred(2)
+	require.Nil(t, err)
+	assert.Empty(t, items)
+	assert.Equal(t, int64(0), store.task(2).DeferredRegistryID)
+}
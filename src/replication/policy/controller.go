@@ -32,4 +32,17 @@ type Controller interface {
 	Update(policy *model.Policy) error
 	// Remove the specified policy
 	Remove(int64) error
+	// IncreaseFailures increases the consecutive failures of the specified policy atomically and
+	// disables the policy once the count reaches its failure threshold. Returns the count and whether
+	// the policy is disabled by this increase
+	IncreaseFailures(int64) (int, bool, error)
+	// ResetFailures resets the consecutive failures of the specified policy
+	ResetFailures(int64) error
+}
+
+// Rescheduler is implemented by the controllers which schedule the policies
+type Rescheduler interface {
+	// Reschedule reschedules the scheduled policies whose remote registry is the specified one,
+	// e.g. after the time zone of the registry is changed
+	Reschedule(registryID int64) error
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/goharbor/harbor/src/replication/policy"
 	"github.com/goharbor/harbor/src/replication/policy/manager"
 	"github.com/goharbor/harbor/src/replication/policy/scheduler"
+	"github.com/goharbor/harbor/src/replication/registry"
 )
 
 // NewController returns a policy controller which can CURD and schedule policies
@@ -30,7 +31,8 @@ func NewController(js job.Client) policy.Controller {
 	mgr := manager.NewDefaultManager()
 	scheduler := scheduler.NewScheduler(js)
 	ctl := &controller{
-		scheduler: scheduler,
+		scheduler:   scheduler,
+		getRegistry: registry.NewDefaultManager().Get,
 	}
 	ctl.Controller = mgr
 	return ctl
@@ -39,6 +41,8 @@ func NewController(js job.Client) policy.Controller {
 type controller struct {
 	policy.Controller
 	scheduler scheduler.Scheduler
+	// gets the remote registry of the policy whose time zone the cron is interpreted in
+	getRegistry scheduler.RegistryGetter
 }
 
 func (c *controller) Create(policy *model.Policy) (int64, error) {
@@ -50,7 +54,7 @@ func (c *controller) Create(policy *model.Policy) (int64, error) {
 		// TODO: need a way to show the schedule status to users
 		// maybe we can add a property "schedule status" for
 		// listing policy API
-		if err = c.scheduler.Schedule(id, policy.Trigger.Settings.Cron); err != nil {
+		if err = c.schedule(id, policy); err != nil {
 			log.Errorf("failed to schedule the policy %d: %v", id, err)
 		}
 	}
@@ -66,7 +70,7 @@ func (c *controller) Update(policy *model.Policy) error {
 		return fmt.Errorf("policy %d not found", policy.ID)
 	}
 	// if no need to reschedule the policy, just update it
-	if !isScheduleTriggerChanged(origin, policy) {
+	if !isScheduleTriggerChanged(origin, policy) && !c.isTimezoneChanged(origin, policy) {
 		return c.Controller.Update(policy)
 	}
 	// need to reschedule the policy
@@ -82,13 +86,65 @@ func (c *controller) Update(policy *model.Policy) error {
 	}
 	// schedule again if needed
 	if isScheduledTrigger(policy) {
-		if err = c.scheduler.Schedule(policy.ID, policy.Trigger.Settings.Cron); err != nil {
+		if err = c.schedule(policy.ID, policy); err != nil {
 			return fmt.Errorf("failed to schedule the policy %d: %v", policy.ID, err)
 		}
 	}
 	return nil
 }
 
+// Reschedule reschedules the scheduled policies whose remote registry is the specified one, so
+// that their crons are interpreted in the time zone of the registry after it's changed
+func (c *controller) Reschedule(registryID int64) error {
+	_, srcPolicies, err := c.Controller.List(&model.PolicyQuery{SrcRegistry: registryID})
+	if err != nil {
+		return err
+	}
+	_, dstPolicies, err := c.Controller.List(&model.PolicyQuery{DestRegistry: registryID})
+	if err != nil {
+		return err
+	}
+	for _, policy := range append(srcPolicies, dstPolicies...) {
+		if !isScheduledTrigger(policy) {
+			continue
+		}
+		if err = c.scheduler.Unschedule(policy.ID); err != nil {
+			return fmt.Errorf("failed to unschedule the policy %d: %v", policy.ID, err)
+		}
+		if err = c.schedule(policy.ID, policy); err != nil {
+			return fmt.Errorf("failed to schedule the policy %d: %v", policy.ID, err)
+		}
+	}
+	return nil
+}
+
+// schedule the policy with the cron interpreted in the time zone of its remote registry
+func (c *controller) schedule(id int64, policy *model.Policy) error {
+	cron, err := scheduler.Cron(policy, c.getRegistry)
+	if err != nil {
+		return err
+	}
+	return c.scheduler.Schedule(id, cron)
+}
+
+// the time zone changes if the remote registry of the scheduled policy is changed
+func (c *controller) isTimezoneChanged(origin, current *model.Policy) bool {
+	if !isScheduledTrigger(origin) || !isScheduledTrigger(current) {
+		return false
+	}
+	o, err := scheduler.Timezone(origin, c.getRegistry)
+	if err != nil {
+		log.Errorf("failed to get the time zone of the policy %d: %v", origin.ID, err)
+		return false
+	}
+	n, err := scheduler.Timezone(current, c.getRegistry)
+	if err != nil {
+		log.Errorf("failed to get the time zone of the policy %d: %v", current.ID, err)
+		return false
+	}
+	return o != n
+}
+
 func (c *controller) Remove(policyID int64) error {
 	policy, err := c.Controller.Get(policyID)
 	if err != nil {
@@ -105,6 +161,25 @@ func (c *controller) Remove(policyID int64) error {
 	return c.Controller.Remove(policyID)
 }
 
+// the policy disabled by the failures is unscheduled as well
+func (c *controller) IncreaseFailures(policyID int64) (int, bool, error) {
+	failures, disabled, err := c.Controller.IncreaseFailures(policyID)
+	if err != nil || !disabled {
+		return failures, disabled, err
+	}
+	policy, err := c.Controller.Get(policyID)
+	if err != nil {
+		return failures, disabled, err
+	}
+	// the policy has been disabled, so check the trigger only
+	if policy != nil && policy.Trigger != nil && policy.Trigger.Type == model.TriggerTypeScheduled {
+		if err = c.scheduler.Unschedule(policyID); err != nil {
+			return failures, disabled, fmt.Errorf("failed to unschedule the policy %d: %v", policyID, err)
+		}
+	}
+	return failures, disabled, nil
+}
+
 func isScheduledTrigger(policy *model.Policy) bool {
 	if policy == nil {
 		return false
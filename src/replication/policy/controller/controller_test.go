@@ -24,13 +24,27 @@ import (
 
 type fakedPolicyController struct {
 	policy *model.Policy
+	// the policies listed by the registries
+	policies []*model.Policy
+	// whether the policy is disabled by the failure increased
+	disabled bool
 }
 
 func (f *fakedPolicyController) Create(*model.Policy) (int64, error) {
 	return 0, nil
 }
-func (f *fakedPolicyController) List(...*model.PolicyQuery) (int64, []*model.Policy, error) {
-	return 0, nil, nil
+func (f *fakedPolicyController) List(queries ...*model.PolicyQuery) (int64, []*model.Policy, error) {
+	policies := []*model.Policy{}
+	for _, policy := range f.policies {
+		if len(queries) > 0 && queries[0].SrcRegistry > 0 && policy.SrcRegistry.ID != queries[0].SrcRegistry {
+			continue
+		}
+		if len(queries) > 0 && queries[0].DestRegistry > 0 && policy.DestRegistry.ID != queries[0].DestRegistry {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return int64(len(policies)), policies, nil
 }
 func (f *fakedPolicyController) Get(id int64) (*model.Policy, error) {
 	return f.policy, nil
@@ -44,14 +58,25 @@ func (f *fakedPolicyController) Update(*model.Policy) error {
 func (f *fakedPolicyController) Remove(int64) error {
 	return nil
 }
+func (f *fakedPolicyController) IncreaseFailures(int64) (int, bool, error) {
+	return 1, f.disabled, nil
+}
+func (f *fakedPolicyController) ResetFailures(int64) error {
+	return nil
+}
 
 type fakedScheduler struct {
 	scheduled   bool
 	unscheduled bool
+	// the crons scheduled keyed by the policy ID
+	crons map[int64]string
 }
 
 func (f *fakedScheduler) Schedule(policyID int64, cron string) error {
 	f.scheduled = true
+	if f.crons != nil {
+		f.crons[policyID] = cron
+	}
 	return nil
 }
 func (f *fakedScheduler) Unschedule(policyID int64) error {
@@ -346,3 +371,92 @@ func TestRemove(t *testing.T) {
 	require.Nil(t, err)
 	assert.True(t, scheduler.unscheduled)
 }
+
+func TestIncreaseFailures(t *testing.T) {
+	scheduler := &fakedScheduler{}
+	c := &fakedPolicyController{
+		policy: &model.Policy{
+			ID: 1,
+			Trigger: &model.Trigger{
+				Type: model.TriggerTypeScheduled,
+				Settings: &model.TriggerSettings{
+					Cron: "03 05 * * *",
+				},
+			},
+		},
+	}
+	ctl := &controller{
+		scheduler: scheduler,
+	}
+	ctl.Controller = c
+
+	// the policy isn't disabled
+	_, disabled, err := ctl.IncreaseFailures(1)
+	require.Nil(t, err)
+	assert.False(t, disabled)
+	assert.False(t, scheduler.unscheduled)
+
+	// the policy disabled is unscheduled
+	c.disabled = true
+	_, disabled, err = ctl.IncreaseFailures(1)
+	require.Nil(t, err)
+	assert.True(t, disabled)
+	assert.True(t, scheduler.unscheduled)
+}
+
+func TestScheduleInTimezone(t *testing.T) {
+	registries := map[int64]*model.Registry{
+		1: {ID: 1, Timezone: "Europe/Berlin"},
+		2: {ID: 2, Timezone: "Asia/Shanghai"},
+	}
+	scheduler := &fakedScheduler{crons: map[int64]string{}}
+	c := &fakedPolicyController{}
+	ctl := &controller{
+		scheduler: scheduler,
+		getRegistry: func(id int64) (*model.Registry, error) {
+			return registries[id], nil
+		},
+	}
+	ctl.Controller = c
+
+	scheduled := func(src, dst int64) *model.Policy {
+		return &model.Policy{
+			ID:           1,
+			Enabled:      true,
+			SrcRegistry:  &model.Registry{ID: src},
+			DestRegistry: &model.Registry{ID: dst},
+			Trigger: &model.Trigger{
+				Type: model.TriggerTypeScheduled,
+				Settings: &model.TriggerSettings{
+					Cron: "0 0 1 * * *",
+				},
+			},
+		}
+	}
+
+	// the cron is interpreted in the time zone of the remote registry
+	_, err := ctl.Create(scheduled(0, 1))
+	require.Nil(t, err)
+	assert.Equal(t, "CRON_TZ=Europe/Berlin 0 0 1 * * *", scheduler.crons[0])
+
+	// the remote registry is changed, the policy is rescheduled even if the cron isn't changed
+	c.policy = scheduled(0, 1)
+	scheduler.unscheduled = false
+	require.Nil(t, ctl.Update(scheduled(2, 0)))
+	assert.True(t, scheduler.unscheduled)
+	assert.Equal(t, "CRON_TZ=Asia/Shanghai 0 0 1 * * *", scheduler.crons[1])
+
+	// the policies are rescheduled after the time zone of the registry is changed
+	c.policies = []*model.Policy{scheduled(2, 0)}
+	registries[2].Timezone = "America/New_York"
+	require.Nil(t, ctl.Reschedule(1))
+	assert.Equal(t, "CRON_TZ=Asia/Shanghai 0 0 1 * * *", scheduler.crons[1])
+	require.Nil(t, ctl.Reschedule(2))
+	assert.Equal(t, "CRON_TZ=America/New_York 0 0 1 * * *", scheduler.crons[1])
+
+	// the disabled policy isn't rescheduled
+	registries[2].Timezone = ""
+	c.policies[0].Enabled = false
+	require.Nil(t, ctl.Reschedule(2))
+	assert.Equal(t, "CRON_TZ=America/New_York 0 0 1 * * *", scheduler.crons[1])
+}
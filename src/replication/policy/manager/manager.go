@@ -36,16 +36,30 @@ func convertFromPersistModel(policy *persist_models.RepPolicy) (*model.Policy, e
 	}
 
 	ply := model.Policy{
-		ID:            policy.ID,
-		Name:          policy.Name,
-		Description:   policy.Description,
-		Creator:       policy.Creator,
-		DestNamespace: policy.DestNamespace,
-		Deletion:      policy.ReplicateDeletion,
-		Override:      policy.Override,
-		Enabled:       policy.Enabled,
-		CreationTime:  policy.CreationTime,
-		UpdateTime:    policy.UpdateTime,
+		ID:                  policy.ID,
+		Name:                policy.Name,
+		Description:         policy.Description,
+		Creator:             policy.Creator,
+		DestNamespace:       policy.DestNamespace,
+		Deletion:            policy.ReplicateDeletion,
+		Override:            policy.Override,
+		Enabled:             policy.Enabled,
+		ReplicateReferrers:  policy.ReplicateReferrers,
+		PauseOnReadOnly:     policy.PauseOnReadOnly,
+		OrderBySharedBlobs:  policy.OrderBySharedBlobs,
+		CompressLayers:      policy.CompressLayers,
+		MountBlobs:          policy.MountBlobs,
+		BlobAccounting:      policy.BlobAccounting,
+		OrderBySize:         policy.OrderBySize,
+		MaxSeverity:         policy.MaxSeverity,
+		AllowUnscanned:      policy.AllowUnscanned,
+		SignedOnly:          policy.SignedOnly,
+		MaxRepos:            policy.MaxRepos,
+		MaxReposMode:        policy.MaxReposMode,
+		FailureThreshold:    policy.FailureThreshold,
+		ConsecutiveFailures: policy.ConsecutiveFailures,
+		CreationTime:        policy.CreationTime,
+		UpdateTime:          policy.UpdateTime,
 	}
 	if policy.SrcRegistryID > 0 {
 		ply.SrcRegistry = &model.Registry{
@@ -72,6 +86,13 @@ func convertFromPersistModel(policy *persist_models.RepPolicy) (*model.Policy, e
 	}
 	ply.Trigger = trigger
 
+	if len(policy.TagTransform) > 0 {
+		ply.TagTransform = &model.TagTransform{}
+		if err := json.Unmarshal([]byte(policy.TagTransform), ply.TagTransform); err != nil {
+			return nil, err
+		}
+	}
+
 	return &ply, nil
 }
 
@@ -81,16 +102,30 @@ func convertToPersistModel(policy *model.Policy) (*persist_models.RepPolicy, err
 	}
 
 	ply := &persist_models.RepPolicy{
-		ID:                policy.ID,
-		Name:              policy.Name,
-		Description:       policy.Description,
-		Creator:           policy.Creator,
-		DestNamespace:     policy.DestNamespace,
-		Override:          policy.Override,
-		Enabled:           policy.Enabled,
-		ReplicateDeletion: policy.Deletion,
-		CreationTime:      policy.CreationTime,
-		UpdateTime:        time.Now(),
+		ID:                  policy.ID,
+		Name:                policy.Name,
+		Description:         policy.Description,
+		Creator:             policy.Creator,
+		DestNamespace:       policy.DestNamespace,
+		Override:            policy.Override,
+		Enabled:             policy.Enabled,
+		ReplicateDeletion:   policy.Deletion,
+		ReplicateReferrers:  policy.ReplicateReferrers,
+		PauseOnReadOnly:     policy.PauseOnReadOnly,
+		OrderBySharedBlobs:  policy.OrderBySharedBlobs,
+		CompressLayers:      policy.CompressLayers,
+		MountBlobs:          policy.MountBlobs,
+		BlobAccounting:      policy.BlobAccounting,
+		OrderBySize:         policy.OrderBySize,
+		MaxSeverity:         policy.MaxSeverity,
+		AllowUnscanned:      policy.AllowUnscanned,
+		SignedOnly:          policy.SignedOnly,
+		MaxRepos:            policy.MaxRepos,
+		MaxReposMode:        policy.MaxReposMode,
+		FailureThreshold:    policy.FailureThreshold,
+		ConsecutiveFailures: policy.ConsecutiveFailures,
+		CreationTime:        policy.CreationTime,
+		UpdateTime:          time.Now(),
 	}
 	if policy.SrcRegistry != nil {
 		ply.SrcRegistryID = policy.SrcRegistry.ID
@@ -115,6 +150,14 @@ func convertToPersistModel(policy *model.Policy) (*persist_models.RepPolicy, err
 		ply.Filters = string(filters)
 	}
 
+	if policy.TagTransform != nil {
+		transform, err := json.Marshal(policy.TagTransform)
+		if err != nil {
+			return nil, err
+		}
+		ply.TagTransform = string(transform)
+	}
+
 	return ply, nil
 }
 
@@ -198,6 +241,16 @@ func (m *DefaultManager) Remove(policyID int64) error {
 	return dao.DeleteRepPolicy(policyID)
 }
 
+// IncreaseFailures increases the consecutive failures of the specified policy
+func (m *DefaultManager) IncreaseFailures(policyID int64) (int, bool, error) {
+	return dao.IncreaseRepPolicyFailures(policyID)
+}
+
+// ResetFailures resets the consecutive failures of the specified policy
+func (m *DefaultManager) ResetFailures(policyID int64) error {
+	return dao.ResetRepPolicyFailures(policyID)
+}
+
 type filter struct {
 	Type    model.FilterType `json:"type"`
 	Value   interface{}      `json:"value"`
@@ -47,6 +47,11 @@ func Test_convertFromPersistModel(t *testing.T) {
 			from: &persist_models.RepPolicy{Trigger: "abc"},
 			want: nil, wantErr: true,
 		},
+		{
+			name: "parse TagTransform Error",
+			from: &persist_models.RepPolicy{TagTransform: "abc"},
+			want: nil, wantErr: true,
+		},
 		{
 			name: "Persist Model", from: &persist_models.RepPolicy{
 				ID:                999,
@@ -61,6 +66,7 @@ func Test_convertFromPersistModel(t *testing.T) {
 				Enabled:           true,
 				Trigger:           "",
 				Filters:           "[]",
+				TagTransform:      "{\"add_suffix\":\"-prod\"}",
 			}, want: &model.Policy{
 				ID:          999,
 				Name:        "Policy Test",
@@ -78,6 +84,7 @@ func Test_convertFromPersistModel(t *testing.T) {
 				Enabled:       true,
 				Trigger:       nil,
 				Filters:       []*model.Filter{},
+				TagTransform:  &model.TagTransform{AddSuffix: "-prod"},
 			},
 		},
 	}
@@ -108,6 +115,7 @@ func Test_convertFromPersistModel(t *testing.T) {
 			assert.Equal(t, tt.want.Enabled, got.Enabled)
 			assert.Equal(t, tt.want.Trigger, got.Trigger)
 			assert.Equal(t, tt.want.Filters, got.Filters)
+			assert.Equal(t, tt.want.TagTransform, got.TagTransform)
 
 		})
 	}
@@ -139,6 +147,7 @@ func Test_convertToPersistModel(t *testing.T) {
 				Enabled:       true,
 				Trigger:       &model.Trigger{},
 				Filters:       []*model.Filter{{Type: "registry", Value: "abc"}},
+				TagTransform:  &model.TagTransform{AddSuffix: "-prod"},
 			}, want: &persist_models.RepPolicy{
 				ID:                999,
 				Name:              "Policy Test",
@@ -152,6 +161,7 @@ func Test_convertToPersistModel(t *testing.T) {
 				Enabled:           true,
 				Trigger:           "{\"type\":\"\",\"trigger_settings\":null}",
 				Filters:           "[{\"type\":\"registry\",\"value\":\"abc\"}]",
+				TagTransform:      "{\"add_suffix\":\"-prod\"}",
 			},
 		},
 	}
@@ -177,6 +187,7 @@ func Test_convertToPersistModel(t *testing.T) {
 			assert.Equal(t, tt.want.Enabled, got.Enabled)
 			assert.Equal(t, tt.want.Trigger, got.Trigger)
 			assert.Equal(t, tt.want.Filters, got.Filters)
+			assert.Equal(t, tt.want.TagTransform, got.TagTransform)
 
 		})
 	}
@@ -0,0 +1,135 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/jobservice/period"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// ScheduledRun is the next run of a scheduled policy
+type ScheduledRun struct {
+	PolicyID       int64     `json:"policy_id"`
+	PolicyName     string    `json:"policy_name"`
+	SrcRegistryID  int64     `json:"src_registry_id"`
+	DestRegistryID int64     `json:"dest_registry_id"`
+	Cron           string    `json:"cron"`
+	Timezone       string    `json:"timezone,omitempty"`
+	NextRunTime    time.Time `json:"next_run_time"`
+}
+
+// RegistryGetter gets the registry by its ID
+type RegistryGetter func(int64) (*model.Registry, error)
+
+// Timezone returns the time zone of the remote registry of the policy, the cron of the policy is
+// interpreted in it. The local Harbor has no time zone, so it's the one of the source registry for
+// the pull-based policies and the one of the destination registry for the push-based ones
+func Timezone(policy *model.Policy, getRegistry RegistryGetter) (string, error) {
+	var id int64
+	if policy.SrcRegistry != nil && policy.SrcRegistry.ID > 0 {
+		id = policy.SrcRegistry.ID
+	} else if policy.DestRegistry != nil {
+		id = policy.DestRegistry.ID
+	}
+	if id == 0 {
+		return "", nil
+	}
+	registry, err := getRegistry(id)
+	if err != nil {
+		return "", err
+	}
+	if registry == nil {
+		return "", fmt.Errorf("registry %d not found", id)
+	}
+	return registry.Timezone, nil
+}
+
+// Cron returns the cron of the scheduled policy prefixed with the time zone of its remote registry
+func Cron(policy *model.Policy, getRegistry RegistryGetter) (string, error) {
+	timezone, err := Timezone(policy, getRegistry)
+	if err != nil {
+		return "", err
+	}
+	return period.WithTimezone(policy.Trigger.Settings.Cron, timezone), nil
+}
+
+// NextRun returns the first time after "from" the cron fires at. The cron is parsed in
+// the same way with the jobservice, so the time returned is the one the policy is triggered at
+func NextRun(cronSpec string, from time.Time) (time.Time, error) {
+	schedule, location, err := period.ParseCron(cronSpec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// the jobservice computes the next time from the current time truncated to seconds
+	from = from.Truncate(time.Second)
+	if location != nil {
+		from = from.In(location)
+	}
+	next := schedule.Next(from)
+	// the zero time is returned if the cron never fires, e.g. "0 0 0 30 2 *"
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("the cron %s never fires", cronSpec)
+	}
+	return next, nil
+}
+
+// UpcomingRuns returns the next runs after "from" of the enabled policies with the scheduled
+// trigger, sorted soonest first. The crons are interpreted in the time zones of the remote
+// registries of the policies. The policies whose cron cannot be parsed are skipped
+func UpcomingRuns(policies []*model.Policy, from time.Time, getRegistry RegistryGetter) []*ScheduledRun {
+	runs := []*ScheduledRun{}
+	for _, policy := range policies {
+		if policy == nil || !policy.Enabled || policy.Trigger == nil ||
+			policy.Trigger.Type != model.TriggerTypeScheduled || policy.Trigger.Settings == nil {
+			continue
+		}
+		timezone, err := Timezone(policy, getRegistry)
+		if err != nil {
+			log.Warningf("failed to get the time zone of the policy %d: %v", policy.ID, err)
+			continue
+		}
+		next, err := NextRun(period.WithTimezone(policy.Trigger.Settings.Cron, timezone), from)
+		if err != nil {
+			log.Warningf("failed to compute the next run of the policy %d: %v", policy.ID, err)
+			continue
+		}
+		run := &ScheduledRun{
+			PolicyID:    policy.ID,
+			PolicyName:  policy.Name,
+			Cron:        policy.Trigger.Settings.Cron,
+			Timezone:    timezone,
+			NextRunTime: next,
+		}
+		if policy.SrcRegistry != nil {
+			run.SrcRegistryID = policy.SrcRegistry.ID
+		}
+		if policy.DestRegistry != nil {
+			run.DestRegistryID = policy.DestRegistry.ID
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].NextRunTime.Equal(runs[j].NextRunTime) {
+			return runs[i].PolicyID < runs[j].PolicyID
+		}
+		return runs[i].NextRunTime.Before(runs[j].NextRunTime)
+	})
+	return runs
+}
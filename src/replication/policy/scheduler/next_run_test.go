@@ -0,0 +1,165 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextRun(t *testing.T) {
+	// Wednesday
+	from := time.Date(2019, 4, 10, 10, 20, 30, 500, time.UTC)
+	cases := []struct {
+		cron     string
+		expected time.Time
+		err      bool
+	}{
+		// hourly
+		{"0 0 * * * *", time.Date(2019, 4, 10, 11, 0, 0, 0, time.UTC), false},
+		// every 15 minutes
+		{"0 */15 * * * *", time.Date(2019, 4, 10, 10, 30, 0, 0, time.UTC), false},
+		// every 30 seconds, the nanoseconds are truncated
+		{"*/30 * * * * *", time.Date(2019, 4, 10, 10, 21, 0, 0, time.UTC), false},
+		// at 02:30 on every Monday
+		{"0 30 2 * * 1", time.Date(2019, 4, 15, 2, 30, 0, 0, time.UTC), false},
+		// at midnight on the first day of every month
+		{"0 0 0 1 * *", time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC), false},
+		// predefined schedules
+		{"@daily", time.Date(2019, 4, 11, 0, 0, 0, 0, time.UTC), false},
+		{"@every 1h", time.Date(2019, 4, 10, 11, 20, 30, 0, time.UTC), false},
+		// at 02:30 in Berlin, i.e. 00:30 UTC in summer
+		{"CRON_TZ=Europe/Berlin 0 30 2 * * *", time.Date(2019, 4, 11, 0, 30, 0, 0, time.UTC), false},
+		// never fires
+		{"0 0 0 30 2 *", time.Time{}, true},
+		// invalid
+		{"invalid", time.Time{}, true},
+	}
+	for _, c := range cases {
+		next, err := NextRun(c.cron, from)
+		if c.err {
+			assert.NotNil(t, err, c.cron)
+			continue
+		}
+		require.Nil(t, err, c.cron)
+		assert.True(t, c.expected.Equal(next), "%s: expected %v, got %v", c.cron, c.expected, next)
+	}
+}
+
+func TestUpcomingRuns(t *testing.T) {
+	from := time.Date(2019, 4, 10, 10, 20, 30, 0, time.UTC)
+	scheduled := func(id int64, cron string, enabled bool) *model.Policy {
+		return &model.Policy{
+			ID:           id,
+			Name:         "policy",
+			Enabled:      enabled,
+			SrcRegistry:  &model.Registry{ID: 1},
+			DestRegistry: &model.Registry{ID: id * 10},
+			Trigger: &model.Trigger{
+				Type:     model.TriggerTypeScheduled,
+				Settings: &model.TriggerSettings{Cron: cron},
+			},
+		}
+	}
+	policies := []*model.Policy{
+		scheduled(1, "@daily", true),
+		scheduled(2, "0 */15 * * * *", true),
+		// disabled
+		scheduled(3, "0 */5 * * * *", false),
+		// fires at the same time with policy 2
+		scheduled(4, "0 30 * * * *", true),
+		// invalid cron
+		scheduled(5, "invalid", true),
+		{
+			ID:      6,
+			Enabled: true,
+			Trigger: &model.Trigger{Type: model.TriggerTypeManual},
+		},
+		nil,
+	}
+	getRegistry := func(id int64) (*model.Registry, error) {
+		return &model.Registry{ID: id}, nil
+	}
+	runs := UpcomingRuns(policies, from, getRegistry)
+	require.Equal(t, 3, len(runs))
+	assert.Equal(t, int64(2), runs[0].PolicyID)
+	assert.Equal(t, int64(4), runs[1].PolicyID)
+	assert.Equal(t, int64(1), runs[2].PolicyID)
+	assert.Equal(t, int64(1), runs[0].SrcRegistryID)
+	assert.Equal(t, int64(20), runs[0].DestRegistryID)
+	assert.Equal(t, "0 */15 * * * *", runs[0].Cron)
+	assert.True(t, time.Date(2019, 4, 11, 0, 0, 0, 0, time.UTC).Equal(runs[2].NextRunTime))
+
+	assert.Equal(t, 0, len(UpcomingRuns(nil, from, getRegistry)))
+
+	// the cron is interpreted in the time zone of the remote registry
+	getRegistry = func(id int64) (*model.Registry, error) {
+		return &model.Registry{ID: id, Timezone: "Asia/Shanghai"}, nil
+	}
+	runs = UpcomingRuns([]*model.Policy{scheduled(1, "@daily", true)}, from, getRegistry)
+	require.Equal(t, 1, len(runs))
+	assert.Equal(t, "Asia/Shanghai", runs[0].Timezone)
+	assert.True(t, time.Date(2019, 4, 10, 16, 0, 0, 0, time.UTC).Equal(runs[0].NextRunTime))
+
+	// the policy whose registry cannot be got is skipped
+	runs = UpcomingRuns([]*model.Policy{scheduled(1, "@daily", true)}, from, func(int64) (*model.Registry, error) {
+		return nil, nil
+	})
+	assert.Equal(t, 0, len(runs))
+}
+
+func TestTimezone(t *testing.T) {
+	registries := map[int64]*model.Registry{
+		1: {ID: 1, Timezone: "Europe/Berlin"},
+		2: {ID: 2, Timezone: "Asia/Shanghai"},
+	}
+	getRegistry := func(id int64) (*model.Registry, error) {
+		return registries[id], nil
+	}
+	policy := &model.Policy{
+		SrcRegistry:  &model.Registry{ID: 1},
+		DestRegistry: &model.Registry{ID: 0},
+		Trigger: &model.Trigger{
+			Type:     model.TriggerTypeScheduled,
+			Settings: &model.TriggerSettings{Cron: "0 0 1 * * *"},
+		},
+	}
+	// pull-based policy
+	cron, err := Cron(policy, getRegistry)
+	require.Nil(t, err)
+	assert.Equal(t, "CRON_TZ=Europe/Berlin 0 0 1 * * *", cron)
+
+	// push-based policy
+	policy.SrcRegistry = &model.Registry{ID: 0}
+	policy.DestRegistry = &model.Registry{ID: 2}
+	cron, err = Cron(policy, getRegistry)
+	require.Nil(t, err)
+	assert.Equal(t, "CRON_TZ=Asia/Shanghai 0 0 1 * * *", cron)
+
+	// the registry without the time zone
+	registries[2].Timezone = ""
+	cron, err = Cron(policy, getRegistry)
+	require.Nil(t, err)
+	assert.Equal(t, "0 0 1 * * *", cron)
+
+	// the registry isn't found
+	policy.DestRegistry = &model.Registry{ID: 3}
+	_, err = Cron(policy, getRegistry)
+	assert.NotNil(t, err)
+}
@@ -19,10 +19,12 @@ import (
 	"testing"
 
 	"github.com/goharbor/harbor/src/common/job/models"
+	js_config "github.com/goharbor/harbor/src/jobservice/config"
 	"github.com/goharbor/harbor/src/jobservice/job"
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao"
 	rep_models "github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -52,10 +54,31 @@ func (f *fakedJobserviceClient) PostAction(uuid, action string) error {
 	f.stopped = true
 	return nil
 }
+func (f *fakedJobserviceClient) GetJob(uuid string) (*job.Stats, error) {
+	return nil, nil
+}
 func (f *fakedJobserviceClient) GetExecutions(uuid string) ([]job.Stats, error) {
 	f.stopped = true
 	return nil, nil
 }
+func (f *fakedJobserviceClient) GetConfig() (*js_config.Settings, error) {
+	return nil, nil
+}
+func (f *fakedJobserviceClient) ReloadConfig() (*js_config.Settings, error) {
+	return nil, nil
+}
+func (f *fakedJobserviceClient) SetMaintenance(enabled bool) (*job.Maintenance, error) {
+	return nil, nil
+}
+func (f *fakedJobserviceClient) GetMaintenance() (*job.Maintenance, error) {
+	return nil, nil
+}
+func (f *fakedJobserviceClient) WarmUp(registry *model.Registry) (*model.WarmupStatus, error) {
+	return nil, nil
+}
+func (f *fakedJobserviceClient) GetWarmups() ([]*model.WarmupStatus, error) {
+	return nil, nil
+}
 
 type fakedScheduleJobDAO struct {
 	idCounter int64
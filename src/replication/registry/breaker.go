@@ -0,0 +1,173 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/replication/dao"
+)
+
+// const definitions
+const (
+	// DefaultBreakerThreshold is the count of consecutive failures that opens the breaker
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is the time that an open breaker waits before allowing retries
+	DefaultBreakerCooldown = 5 * time.Minute
+)
+
+// Breaker is the circuit breaker used for the health check of registries, its state is stored in
+// the database so it's shared by all the core instances in HA mode
+var Breaker = NewCircuitBreaker(&dbBreakerStore{}, DefaultBreakerThreshold, DefaultBreakerCooldown)
+
+// BreakerStore stores the states of the circuit breakers of the registries
+type BreakerStore interface {
+	// Get returns the count of consecutive failures of the registry and the time the breaker
+	// was opened at, the time is zero if the breaker is closed
+	Get(id int64) (int, time.Time, error)
+	// Fail increases the failures of the registry and opens the breaker at the specified
+	// time once the failures reach the threshold
+	Fail(id int64, threshold int, now time.Time) error
+	// Reset clears the failures of the registry and closes the breaker
+	Reset(id int64) error
+}
+
+// CircuitBreaker tracks the consecutive failures of every registry. Once the failures
+// reach the threshold, the breaker of the registry is opened and no more requests are
+// allowed until the cooldown elapses or the breaker is reset. The errors of the store are
+// logged and the breaker is considered closed, so the health checks aren't skipped by them
+type CircuitBreaker struct {
+	store     BreakerStore
+	threshold int
+	cooldown  time.Duration
+}
+
+// NewCircuitBreaker returns an instance of CircuitBreaker which keeps the states in the store
+func NewCircuitBreaker(store BreakerStore, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		store:     store,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns whether the requests to the registry are allowed
+func (c *CircuitBreaker) Allow(id int64) bool {
+	_, openedAt := c.get(id)
+	if openedAt.IsZero() {
+		return true
+	}
+	return time.Since(openedAt) >= c.cooldown
+}
+
+// IsOpen returns whether the breaker of the registry is open
+func (c *CircuitBreaker) IsOpen(id int64) bool {
+	_, openedAt := c.get(id)
+	return !openedAt.IsZero()
+}
+
+// Failures returns the count of consecutive failures of the registry
+func (c *CircuitBreaker) Failures(id int64) int {
+	failures, _ := c.get(id)
+	return failures
+}
+
+// Succeed records a success of the registry and closes the breaker
+func (c *CircuitBreaker) Succeed(id int64) {
+	c.Reset(id)
+}
+
+// Fail records a failure of the registry and opens the breaker when
+// the failures reach the threshold
+func (c *CircuitBreaker) Fail(id int64) {
+	if err := c.store.Fail(id, c.threshold, time.Now()); err != nil {
+		log.Errorf("failed to record the failure of registry %d in the circuit breaker: %v", id, err)
+	}
+}
+
+// Reset closes the breaker of the registry and clears the failure counter
+func (c *CircuitBreaker) Reset(id int64) {
+	if err := c.store.Reset(id); err != nil {
+		log.Errorf("failed to reset the circuit breaker of registry %d: %v", id, err)
+	}
+}
+
+func (c *CircuitBreaker) get(id int64) (int, time.Time) {
+	failures, openedAt, err := c.store.Get(id)
+	if err != nil {
+		log.Errorf("failed to get the circuit breaker of registry %d: %v", id, err)
+		return 0, time.Time{}
+	}
+	return failures, openedAt
+}
+
+// dbBreakerStore stores the states of the circuit breakers in the database
+type dbBreakerStore struct{}
+
+func (d *dbBreakerStore) Get(id int64) (int, time.Time, error) {
+	breaker, err := dao.GetRegistryCircuitBreaker(id)
+	if err != nil || breaker == nil {
+		return 0, time.Time{}, err
+	}
+	return breaker.Failures, breaker.OpenedAt, nil
+}
+
+func (d *dbBreakerStore) Fail(id int64, threshold int, now time.Time) error {
+	return dao.FailRegistryCircuitBreaker(id, threshold, now)
+}
+
+func (d *dbBreakerStore) Reset(id int64) error {
+	return dao.ResetRegistryCircuitBreaker(id)
+}
+
+// memoryBreakerStore stores the states of the circuit breakers in memory
+type memoryBreakerStore struct {
+	sync.Mutex
+	failures map[int64]int
+	openedAt map[int64]time.Time
+}
+
+func newMemoryBreakerStore() *memoryBreakerStore {
+	return &memoryBreakerStore{
+		failures: map[int64]int{},
+		openedAt: map[int64]time.Time{},
+	}
+}
+
+func (m *memoryBreakerStore) Get(id int64) (int, time.Time, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.failures[id], m.openedAt[id], nil
+}
+
+func (m *memoryBreakerStore) Fail(id int64, threshold int, now time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.failures[id]++
+	if m.failures[id] >= threshold {
+		m.openedAt[id] = now
+	}
+	return nil
+}
+
+func (m *memoryBreakerStore) Reset(id int64) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.failures, id)
+	delete(m.openedAt, id)
+	return nil
+}
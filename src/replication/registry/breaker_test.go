@@ -0,0 +1,66 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(newMemoryBreakerStore(), 2, time.Hour)
+
+	// closed
+	breaker.Fail(1)
+	assert.False(t, breaker.IsOpen(1))
+	assert.True(t, breaker.Allow(1))
+	assert.Equal(t, 1, breaker.Failures(1))
+
+	// opened
+	breaker.Fail(1)
+	assert.True(t, breaker.IsOpen(1))
+	assert.False(t, breaker.Allow(1))
+	assert.Equal(t, 2, breaker.Failures(1))
+
+	// other registries are not affected
+	assert.True(t, breaker.Allow(2))
+
+	// succeed closes the breaker
+	breaker.Succeed(1)
+	assert.False(t, breaker.IsOpen(1))
+	assert.Equal(t, 0, breaker.Failures(1))
+}
+
+func TestCircuitBreakerCooldown(t *testing.T) {
+	breaker := NewCircuitBreaker(newMemoryBreakerStore(), 1, 0)
+	breaker.Fail(1)
+	assert.True(t, breaker.IsOpen(1))
+	// retries are allowed after the cooldown elapses
+	assert.True(t, breaker.Allow(1))
+}
+
+func TestResetCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(newMemoryBreakerStore(), 1, time.Hour)
+	breaker.Fail(1)
+	assert.True(t, breaker.IsOpen(1))
+	assert.False(t, breaker.Allow(1))
+
+	breaker.Reset(1)
+	assert.False(t, breaker.IsOpen(1))
+	assert.True(t, breaker.Allow(1))
+	assert.Equal(t, 0, breaker.Failures(1))
+}
@@ -0,0 +1,171 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+const (
+	// DefaultCacheTTL is the time the registries are cached for
+	DefaultCacheTTL = 5 * time.Second
+	// MaxCacheTTL is the upper bound of the TTL. The registries may be updated by the other
+	// instances in HA mode and the health status is updated by the health checker directly,
+	// these changes aren't visible to the cache until the cached registries expire
+	MaxCacheTTL = 10 * time.Second
+)
+
+type cacheEntry struct {
+	registry   *model.Registry
+	expiration time.Time
+}
+
+// CachedManager caches the registries got by ID and name in memory for a short TTL to avoid
+// reading the database repeatedly on the hot paths. The whole cache is invalidated when any
+// registry is added, updated or removed through the manager, so the changes made through the
+// same instance are visible as soon as they're made. The registries loaded from the database
+// concurrently with the invalidation aren't cached. The changes made by the other instances
+// in HA mode are visible after the TTL at most
+type CachedManager struct {
+	Manager
+	sync.RWMutex
+	ttl    time.Duration
+	byID   map[int64]*cacheEntry
+	byName map[string]*cacheEntry
+	// increased by every invalidation
+	generation uint64
+	now        func() time.Time
+}
+
+// NewCachedManager returns an instance of CachedManager which caches the registries got from the
+// manager for the TTL, the default TTL is used if it's less than or equal to 0 and the TTL is
+// limited to MaxCacheTTL
+func NewCachedManager(manager Manager, ttl time.Duration) *CachedManager {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if ttl > MaxCacheTTL {
+		ttl = MaxCacheTTL
+	}
+	return &CachedManager{
+		Manager: manager,
+		ttl:     ttl,
+		byID:    map[int64]*cacheEntry{},
+		byName:  map[string]*cacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// Ensure *CachedManager has implemented Manager interface.
+var _ Manager = (*CachedManager)(nil)
+
+// Get gets a registry by id from the cache or loads it from the manager
+func (c *CachedManager) Get(id int64) (*model.Registry, error) {
+	c.RLock()
+	entry, generation := c.byID[id], c.generation
+	c.RUnlock()
+	if registry := c.hit(entry); registry != nil {
+		return registry, nil
+	}
+	registry, err := c.Manager.Get(id)
+	if err != nil || registry == nil {
+		return registry, err
+	}
+	c.store(registry, generation)
+	return CopyRegistry(registry), nil
+}
+
+// GetByName gets a registry by its name from the cache or loads it from the manager
+func (c *CachedManager) GetByName(name string) (*model.Registry, error) {
+	c.RLock()
+	entry, generation := c.byName[name], c.generation
+	c.RUnlock()
+	if registry := c.hit(entry); registry != nil {
+		return registry, nil
+	}
+	registry, err := c.Manager.GetByName(name)
+	if err != nil || registry == nil {
+		return registry, err
+	}
+	c.store(registry, generation)
+	return CopyRegistry(registry), nil
+}
+
+// Add adds a new registry and invalidates the cache
+func (c *CachedManager) Add(registry *model.Registry) (int64, error) {
+	defer c.invalidate()
+	return c.Manager.Add(registry)
+}
+
+// Update updates a registry and invalidates the cache, the cache is invalidated
+// even if the update fails as the registry may be updated partially
+func (c *CachedManager) Update(registry *model.Registry, props ...string) error {
+	defer c.invalidate()
+	return c.Manager.Update(registry, props...)
+}
+
+// Import creates or overwrites the registries and invalidates the cache
+func (c *CachedManager) Import(registries []*model.Registry) error {
+	defer c.invalidate()
+	return c.Manager.Import(registries)
+}
+
+// Remove deletes a registry and invalidates the cache
+func (c *CachedManager) Remove(id int64) error {
+	defer c.invalidate()
+	return c.Manager.Remove(id)
+}
+
+// HealthCheck checks the health status of the registries and invalidates the cache
+func (c *CachedManager) HealthCheck() error {
+	defer c.invalidate()
+	return c.Manager.HealthCheck()
+}
+
+// returns the copy of the cached registry as the callers may modify it, nil is returned
+// if the registry isn't cached or it's expired
+func (c *CachedManager) hit(entry *cacheEntry) *model.Registry {
+	if entry == nil || !c.now().Before(entry.expiration) {
+		return nil
+	}
+	return CopyRegistry(entry.registry)
+}
+
+// caches the registry loaded from the manager, it's discarded if the cache has been
+// invalidated since the loading started as the registry may be stale
+func (c *CachedManager) store(registry *model.Registry, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.generation != generation {
+		return
+	}
+	entry := &cacheEntry{
+		registry:   CopyRegistry(registry),
+		expiration: c.now().Add(c.ttl),
+	}
+	c.byID[registry.ID] = entry
+	c.byName[registry.Name] = entry
+}
+
+func (c *CachedManager) invalidate() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.byID = map[int64]*cacheEntry{}
+	c.byName = map[string]*cacheEntry{}
+}
@@ -0,0 +1,310 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistryStore is the in-memory manager which counts the reads, the reads are
+// blocked by the "blocking" channel if it's set
+type fakeRegistryStore struct {
+	sync.Mutex
+	registries map[int64]*model.Registry
+	reads      int32
+	blocking   chan struct{}
+}
+
+func newFakeRegistryStore(registries ...*model.Registry) *fakeRegistryStore {
+	store := &fakeRegistryStore{registries: map[int64]*model.Registry{}}
+	for _, r := range registries {
+		store.registries[r.ID] = r
+	}
+	return store
+}
+
+func (f *fakeRegistryStore) Add(registry *model.Registry) (int64, error) {
+	f.Lock()
+	defer f.Unlock()
+	registry.ID = int64(len(f.registries) + 1)
+	f.registries[registry.ID] = CopyRegistry(registry)
+	return registry.ID, nil
+}
+
+func (f *fakeRegistryStore) List(...*model.RegistryQuery) (int64, []*model.Registry, error) {
+	return 0, nil, nil
+}
+
+func (f *fakeRegistryStore) Get(id int64) (*model.Registry, error) {
+	atomic.AddInt32(&f.reads, 1)
+	f.Lock()
+	var registry *model.Registry
+	if r, exist := f.registries[id]; exist {
+		registry = CopyRegistry(r)
+	}
+	blocking := f.blocking
+	f.Unlock()
+	if blocking != nil {
+		<-blocking
+	}
+	return registry, nil
+}
+
+func (f *fakeRegistryStore) GetByName(name string) (*model.Registry, error) {
+	atomic.AddInt32(&f.reads, 1)
+	f.Lock()
+	defer f.Unlock()
+	for _, r := range f.registries {
+		if r.Name == name {
+			return CopyRegistry(r), nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRegistryStore) GetDefault() (*model.Registry, error) {
+	atomic.AddInt32(&f.reads, 1)
+	f.Lock()
+	defer f.Unlock()
+	for _, r := range f.registries {
+		if r.Default {
+			return CopyRegistry(r), nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRegistryStore) Update(registry *model.Registry, props ...string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.registries[registry.ID] = CopyRegistry(registry)
+	return nil
+}
+
+func (f *fakeRegistryStore) Import(registries []*model.Registry) error {
+	return nil
+}
+func (f *fakeRegistryStore) Remove(id int64) error {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.registries, id)
+	return nil
+}
+
+func (f *fakeRegistryStore) HealthCheck() error {
+	return nil
+}
+
+func TestCachedManager(t *testing.T) {
+	store := newFakeRegistryStore(&model.Registry{
+		ID:         1,
+		Name:       "registry",
+		URL:        "https://registry",
+		Credential: &model.Credential{AccessKey: "admin", AccessSecret: "secret"},
+		Labels:     []string{"region:eu"},
+		SSHTunnel:  &registry_pkg.SSHTunnel{Host: "jump", User: "harbor", PrivateKey: "key"},
+	})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+
+	// the registry is read only once
+	registry, err := mgr.Get(1)
+	require.Nil(t, err)
+	require.NotNil(t, registry)
+	registry, err = mgr.GetByName("registry")
+	require.Nil(t, err)
+	require.NotNil(t, registry)
+	assert.Equal(t, int32(1), store.reads)
+
+	// the cached registry isn't affected by the modification of the returned one
+	registry.Credential.AccessSecret = ""
+	registry.Labels[0] = "region:us"
+	registry.SSHTunnel.PrivateKey = ""
+	registry, err = mgr.Get(1)
+	require.Nil(t, err)
+	assert.Equal(t, "secret", registry.Credential.AccessSecret)
+	assert.Equal(t, []string{"region:eu"}, registry.Labels)
+	assert.Equal(t, "key", registry.SSHTunnel.PrivateKey)
+
+	// the nonexistent registries aren't cached
+	registry, err = mgr.Get(2)
+	require.Nil(t, err)
+	assert.Nil(t, registry)
+	registry, err = mgr.GetByName("unknown")
+	require.Nil(t, err)
+	assert.Nil(t, registry)
+	assert.Equal(t, int32(3), store.reads)
+
+	// the updated registry is read after the update
+	registry, err = mgr.Get(1)
+	require.Nil(t, err)
+	registry.Name = "renamed"
+	require.Nil(t, mgr.Update(registry))
+	registry, err = mgr.Get(1)
+	require.Nil(t, err)
+	assert.Equal(t, "renamed", registry.Name)
+	registry, err = mgr.GetByName("registry")
+	require.Nil(t, err)
+	assert.Nil(t, registry)
+
+	// the added registry is read after it's added
+	id, err := mgr.Add(&model.Registry{Name: "new"})
+	require.Nil(t, err)
+	registry, err = mgr.Get(id)
+	require.Nil(t, err)
+	require.NotNil(t, registry)
+
+	// the removed registry isn't read after it's removed
+	require.Nil(t, mgr.Remove(1))
+	registry, err = mgr.Get(1)
+	require.Nil(t, err)
+	assert.Nil(t, registry)
+}
+
+func TestCachedManagerExpiration(t *testing.T) {
+	store := newFakeRegistryStore(&model.Registry{ID: 1, Name: "registry"})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+	now := time.Now()
+	mgr.now = func() time.Time { return now }
+
+	_, err := mgr.Get(1)
+	require.Nil(t, err)
+	// the registry is updated by others, e.g. the other instance in HA mode
+	require.Nil(t, store.Update(&model.Registry{ID: 1, Name: "renamed"}))
+	registry, err := mgr.Get(1)
+	require.Nil(t, err)
+	assert.Equal(t, "registry", registry.Name)
+
+	// the change is visible after the TTL at most
+	now = now.Add(MaxCacheTTL)
+	registry, err = mgr.Get(1)
+	require.Nil(t, err)
+	assert.Equal(t, "renamed", registry.Name)
+	assert.Equal(t, int32(2), store.reads)
+}
+
+func TestNewCachedManagerTTL(t *testing.T) {
+	store := newFakeRegistryStore()
+	assert.Equal(t, DefaultCacheTTL, NewCachedManager(store, 0).ttl)
+	assert.Equal(t, time.Second, NewCachedManager(store, time.Second).ttl)
+	assert.Equal(t, MaxCacheTTL, NewCachedManager(store, time.Hour).ttl)
+}
+
+func TestCachedManagerConcurrentUpdate(t *testing.T) {
+	store := newFakeRegistryStore(&model.Registry{ID: 1, Name: "registry"})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+
+	// the registry is loaded before the update but returned after it
+	blocking := make(chan struct{})
+	store.blocking = blocking
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		registry, err := mgr.Get(1)
+		if assert.Nil(t, err) {
+			assert.Equal(t, "registry", registry.Name)
+		}
+	}()
+	for atomic.LoadInt32(&store.reads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	store.Lock()
+	store.blocking = nil
+	store.Unlock()
+	require.Nil(t, mgr.Update(&model.Registry{ID: 1, Name: "renamed"}))
+	close(blocking)
+	<-loaded
+
+	// the stale registry loaded concurrently isn't cached
+	registry, err := mgr.Get(1)
+	require.Nil(t, err)
+	assert.Equal(t, "renamed", registry.Name)
+}
+
+func TestCachedManagerNoStaleRead(t *testing.T) {
+	store := newFakeRegistryStore(&model.Registry{ID: 1, Name: "registry-0"})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					mgr.Get(1)
+					mgr.GetByName("registry-0")
+				}
+			}
+		}()
+	}
+	// every update is visible as soon as it returns
+	for i := 1; i <= 200; i++ {
+		name := fmt.Sprintf("registry-%d", i)
+		require.Nil(t, mgr.Update(&model.Registry{ID: 1, Name: name}))
+		registry, err := mgr.Get(1)
+		require.Nil(t, err)
+		require.Equal(t, name, registry.Name)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkCachedManagerGet(b *testing.B) {
+	store := newFakeRegistryStore(&model.Registry{ID: 1, Name: "registry"})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := mgr.Get(1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCachedManagerGetWithUpdates(b *testing.B) {
+	store := newFakeRegistryStore(&model.Registry{ID: 1, Name: "registry"})
+	mgr := NewCachedManager(store, MaxCacheTTL)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			// one update per 100 reads
+			if i%100 == 0 {
+				if err := mgr.Update(&model.Registry{ID: 1, Name: "registry"}); err != nil {
+					b.Fatal(err)
+				}
+				continue
+			}
+			if _, err := mgr.Get(1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
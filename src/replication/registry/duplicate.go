@@ -0,0 +1,89 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+
+	"github.com/goharbor/harbor/src/common/utils"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// DuplicateError is returned when the registry duplicates an existing one
+type DuplicateError struct {
+	// the name of the registry duplicated
+	Name string
+	// the endpoint shared by the registries
+	URL string
+}
+
+func (d *DuplicateError) Error() string {
+	return fmt.Sprintf("registry '%s' with the same URL %s and access key already exists", d.Name, d.URL)
+}
+
+// CheckDuplicate returns the "DuplicateError" if another registry in the list shares any endpoint, i.e. the
+// canonical URL or one of the failover URLs, and the access key with the registry. The registries with the
+// same URL but different credentials aren't duplicated, e.g. the different accounts of Docker Hub. The
+// registry itself in the list, which has the same ID or is the same instance, is skipped
+func CheckDuplicate(r *model.Registry, registries []*model.Registry) error {
+	endpoints := map[string]bool{}
+	for _, endpoint := range r.Endpoints() {
+		if url, err := utils.CanonicalizeEndpoint(endpoint); err == nil {
+			endpoints[url] = true
+		}
+	}
+	for _, reg := range registries {
+		if reg == r || (reg.ID > 0 && reg.ID == r.ID) || accessKey(reg) != accessKey(r) {
+			continue
+		}
+		for _, endpoint := range reg.Endpoints() {
+			// the URLs stored before the canonicalization may be in the different forms
+			url, err := utils.CanonicalizeEndpoint(endpoint)
+			if err != nil || !endpoints[url] {
+				continue
+			}
+			return &DuplicateError{
+				Name: reg.Name,
+				URL:  url,
+			}
+		}
+	}
+	return nil
+}
+
+// endpointsChanged returns whether the endpoints or the access key of the registry are changed,
+// only which make the registry duplicate another one
+func endpointsChanged(original, updated *model.Registry) bool {
+	if accessKey(original) != accessKey(updated) {
+		return true
+	}
+	originalEndpoints, updatedEndpoints := original.Endpoints(), updated.Endpoints()
+	if len(originalEndpoints) != len(updatedEndpoints) {
+		return true
+	}
+	for i := range originalEndpoints {
+		if originalEndpoints[i] != updatedEndpoints[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func accessKey(r *model.Registry) string {
+	if r.Credential == nil {
+		return ""
+	}
+	return r.Credential.AccessKey
+}
@@ -0,0 +1,91 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDuplicate(t *testing.T) {
+	existing := &model.Registry{
+		ID:           1,
+		Name:         "existing",
+		URL:          "HTTPS://Harbor.Example.com/",
+		FailoverURLs: []string{"https://dr.example.com"},
+		Credential: &model.Credential{
+			AccessKey: "admin",
+		},
+	}
+	registries := []*model.Registry{existing}
+
+	// the same URL in the different form and the same access key
+	r := &model.Registry{
+		URL: "https://harbor.example.com",
+		Credential: &model.Credential{
+			AccessKey: "admin",
+		},
+	}
+	err := CheckDuplicate(r, registries)
+	require.NotNil(t, err)
+	e, ok := err.(*DuplicateError)
+	require.True(t, ok)
+	assert.Equal(t, "existing", e.Name)
+	assert.Equal(t, "https://harbor.example.com", e.URL)
+
+	// the URL same with the failover URL
+	r.URL = "https://dr.example.com"
+	assert.NotNil(t, CheckDuplicate(r, registries))
+
+	// the different access key
+	r.Credential.AccessKey = "user"
+	assert.Nil(t, CheckDuplicate(r, registries))
+
+	// the different URL
+	r.Credential.AccessKey = "admin"
+	r.URL = "https://other.example.com"
+	assert.Nil(t, CheckDuplicate(r, registries))
+
+	// the registry itself is skipped
+	assert.Nil(t, CheckDuplicate(existing, registries))
+	r = &model.Registry{
+		ID:         1,
+		URL:        "https://harbor.example.com",
+		Credential: existing.Credential,
+	}
+	assert.Nil(t, CheckDuplicate(r, registries))
+}
+
+func TestEndpointsChanged(t *testing.T) {
+	original := &model.Registry{
+		URL:          "https://harbor.example.com",
+		FailoverURLs: []string{"https://dr.example.com"},
+	}
+	updated := *original
+	updated.Description = "updated"
+	assert.False(t, endpointsChanged(original, &updated))
+
+	updated.FailoverURLs = nil
+	assert.True(t, endpointsChanged(original, &updated))
+
+	updated = *original
+	updated.Credential = &model.Credential{
+		AccessKey: "admin",
+	}
+	assert.True(t, endpointsChanged(original, &updated))
+}
@@ -0,0 +1,388 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goharbor/harbor/src/common/utils"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// const definitions
+const (
+	// ExportVersion is the version of the format of the export document
+	ExportVersion = "1.0"
+	// the plain text encrypted with the passphrase to verify the passphrase when importing
+	passphraseVerification = "harbor-registries"
+)
+
+var (
+	// ErrPassphraseRequired is returned when importing the encrypted credentials without passphrase
+	ErrPassphraseRequired = errors.New("the passphrase is required to import the credentials")
+	// ErrInvalidPassphrase is returned when the passphrase doesn't match the one used to export
+	ErrInvalidPassphrase = errors.New("invalid passphrase")
+)
+
+// ExportedRegistry is the portable representation of a registry
+type ExportedRegistry struct {
+	Name                  string                  `json:"name"`
+	Description           string                  `json:"description"`
+	Type                  model.RegistryType      `json:"type"`
+	URL                   string                  `json:"url"`
+	Insecure              bool                    `json:"insecure"`
+	UserAgent             string                  `json:"user_agent,omitempty"`
+	MaxConnections        int                     `json:"max_connections,omitempty"`
+	JobRetentionDays      int                     `json:"job_retention_days,omitempty"`
+	AllowedProjects       []string                `json:"allowed_projects,omitempty"`
+	BlackoutWindows       []*model.BlackoutWindow `json:"blackout_windows,omitempty"`
+	PathTransform         *model.PathTransform    `json:"path_transform,omitempty"`
+	Labels                []string                `json:"labels,omitempty"`
+	PreferredManifestType string                  `json:"preferred_manifest_type,omitempty"`
+	FailoverURLs          []string                `json:"failover_urls,omitempty"`
+	LayerMediaTypes       *model.LayerMediaTypes  `json:"layer_media_types,omitempty"`
+	WarmupConnections     int                     `json:"warmup_connections,omitempty"`
+	Timezone              string                  `json:"timezone,omitempty"`
+	// the access secret of the credential is encrypted with the passphrase
+	Credential *model.Credential `json:"credential,omitempty"`
+	// the private key of the SSH tunnel is encrypted with the passphrase
+	SSHTunnel *registry_pkg.SSHTunnel `json:"ssh_tunnel,omitempty"`
+	// the values of the custom headers are encrypted with the passphrase as they may carry the secrets
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ExportDocument contains the exported registries. The credentials, SSH tunnels and custom headers are omitted unless
+// a passphrase is specified when exporting, in which case the salt and the verification
+// are used to derive the key from the passphrase and verify it when importing
+type ExportDocument struct {
+	Version      string              `json:"version"`
+	Salt         string              `json:"salt,omitempty"`
+	Verification string              `json:"verification,omitempty"`
+	Registries   []*ExportedRegistry `json:"registries"`
+}
+
+// ImportResult records the names of the registries handled when importing
+type ImportResult struct {
+	Created     []string `json:"created"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+}
+
+// Valid validates the document, the URLs of registries are normalized as well
+func (d *ExportDocument) Valid() error {
+	if d.Version != ExportVersion {
+		return fmt.Errorf("unsupported version %s", d.Version)
+	}
+	for _, r := range d.Registries {
+		if len(r.Name) == 0 {
+			return errors.New("the name of registry cannot be empty")
+		}
+		if r.MaxConnections < 0 {
+			return fmt.Errorf("invalid max connections of registry %s: %d", r.Name, r.MaxConnections)
+		}
+		if r.JobRetentionDays < 0 {
+			return fmt.Errorf("invalid job retention days of registry %s: %d", r.Name, r.JobRetentionDays)
+		}
+		labels, err := model.NormalizeLabels(r.Labels)
+		if err != nil {
+			return fmt.Errorf("invalid labels of registry %s: %v", r.Name, err)
+		}
+		r.Labels = labels
+		if err = model.ValidateHeaders(r.Headers); err != nil {
+			return fmt.Errorf("invalid headers of registry %s: %v", r.Name, err)
+		}
+		if r.LayerMediaTypes != nil {
+			if err = r.LayerMediaTypes.Validate(); err != nil {
+				return fmt.Errorf("invalid layer media types of registry %s: %v", r.Name, err)
+			}
+		}
+		if err = model.ValidateWarmupConnections(r.WarmupConnections); err != nil {
+			return fmt.Errorf("invalid warmup connections of registry %s: %v", r.Name, err)
+		}
+		if err = model.ValidateTimezone(r.Timezone); err != nil {
+			return fmt.Errorf("invalid time zone of registry %s: %v", r.Name, err)
+		}
+		// the private key is encrypted, so it's validated after being decrypted when importing
+		if r.SSHTunnel != nil && (len(r.SSHTunnel.Host) == 0 || len(r.SSHTunnel.User) == 0) {
+			return fmt.Errorf("invalid SSH tunnel of registry %s: the host and user cannot be empty", r.Name)
+		}
+		url, err := utils.CanonicalizeEndpoint(r.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url of registry %s: %v", r.Name, err)
+		}
+		// Prevent SSRF security issue #3755
+		r.URL = url
+		urls, err := model.NormalizeFailoverURLs(r.URL, r.FailoverURLs)
+		if err != nil {
+			return fmt.Errorf("invalid failover urls of registry %s: %v", r.Name, err)
+		}
+		r.FailoverURLs = urls
+	}
+	return nil
+}
+
+// Export exports all the registries managed by the manager. The credentials, SSH tunnels
+// and custom headers are included and encrypted only when the passphrase isn't empty
+func Export(mgr Manager, passphrase string) (*ExportDocument, error) {
+	_, registries, err := mgr.List()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &ExportDocument{
+		Version:    ExportVersion,
+		Registries: []*ExportedRegistry{},
+	}
+	key := ""
+	if len(passphrase) > 0 {
+		doc.Salt = utils.GenerateRandomString()
+		key = utils.Encrypt(passphrase, doc.Salt)
+		if doc.Verification, err = utils.ReversibleEncrypt(passphraseVerification, key); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range registries {
+		exported := &ExportedRegistry{
+			Name:                  r.Name,
+			Description:           r.Description,
+			Type:                  r.Type,
+			URL:                   r.URL,
+			Insecure:              r.Insecure,
+			UserAgent:             r.UserAgent,
+			MaxConnections:        r.MaxConnections,
+			JobRetentionDays:      r.JobRetentionDays,
+			AllowedProjects:       r.AllowedProjects,
+			BlackoutWindows:       r.BlackoutWindows,
+			PathTransform:         r.PathTransform,
+			Labels:                r.Labels,
+			PreferredManifestType: r.PreferredManifestType,
+			FailoverURLs:          r.FailoverURLs,
+			LayerMediaTypes:       r.LayerMediaTypes,
+			WarmupConnections:     r.WarmupConnections,
+			Timezone:              r.Timezone,
+		}
+		if len(key) > 0 && len(r.Headers) > 0 {
+			exported.Headers = map[string]string{}
+			for name, value := range r.Headers {
+				if exported.Headers[name], err = utils.ReversibleEncrypt(value, key); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(key) > 0 && r.Credential != nil && len(r.Credential.AccessKey) > 0 {
+			secret, err := utils.ReversibleEncrypt(r.Credential.AccessSecret, key)
+			if err != nil {
+				return nil, err
+			}
+			exported.Credential = &model.Credential{
+				Type:         r.Credential.Type,
+				AccessKey:    r.Credential.AccessKey,
+				AccessSecret: secret,
+			}
+		}
+		if len(key) > 0 && r.SSHTunnel != nil {
+			privateKey, err := utils.ReversibleEncrypt(r.SSHTunnel.PrivateKey, key)
+			if err != nil {
+				return nil, err
+			}
+			tunnel := *r.SSHTunnel
+			tunnel.PrivateKey = privateKey
+			exported.SSHTunnel = &tunnel
+		}
+		doc.Registries = append(doc.Registries, exported)
+	}
+	return doc, nil
+}
+
+// Import creates the registries in the document. The registry with the same name is
+// overwritten if "overwrite" is true, otherwise it is skipped. The registries are saved
+// in one transaction, so nothing is imported if any of them fails. The "DuplicateError"
+// is returned if any registry created or overwritten duplicates another one
+func Import(mgr Manager, doc *ExportDocument, passphrase string, overwrite bool) (*ImportResult, error) {
+	if doc == nil {
+		return nil, errors.New("empty document")
+	}
+	if err := doc.Valid(); err != nil {
+		return nil, err
+	}
+
+	key := ""
+	if len(doc.Verification) > 0 {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		key = utils.Encrypt(passphrase, doc.Salt)
+		verification, err := utils.ReversibleDecrypt(doc.Verification, key)
+		if err != nil || verification != passphraseVerification {
+			return nil, ErrInvalidPassphrase
+		}
+	}
+
+	result := &ImportResult{
+		Created:     []string{},
+		Overwritten: []string{},
+		Skipped:     []string{},
+	}
+	registries := []*model.Registry{}
+	// the registries whose endpoints or access keys are set or changed by the import
+	changed := []*model.Registry{}
+	for _, r := range doc.Registries {
+		reg := &model.Registry{
+			Name:                  r.Name,
+			Description:           r.Description,
+			Type:                  r.Type,
+			URL:                   r.URL,
+			Insecure:              r.Insecure,
+			UserAgent:             r.UserAgent,
+			MaxConnections:        r.MaxConnections,
+			JobRetentionDays:      r.JobRetentionDays,
+			AllowedProjects:       r.AllowedProjects,
+			BlackoutWindows:       r.BlackoutWindows,
+			PathTransform:         r.PathTransform,
+			Labels:                r.Labels,
+			PreferredManifestType: r.PreferredManifestType,
+			FailoverURLs:          r.FailoverURLs,
+			LayerMediaTypes:       r.LayerMediaTypes,
+			WarmupConnections:     r.WarmupConnections,
+			Timezone:              r.Timezone,
+			Status:                model.Unknown,
+		}
+		if r.Credential != nil {
+			if len(key) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			secret, err := utils.ReversibleDecrypt(r.Credential.AccessSecret, key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt the credential of registry %s: %v", r.Name, err)
+			}
+			reg.Credential = &model.Credential{
+				Type:         r.Credential.Type,
+				AccessKey:    r.Credential.AccessKey,
+				AccessSecret: secret,
+			}
+		}
+		if len(r.Headers) > 0 {
+			if len(key) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			reg.Headers = map[string]string{}
+			for name, value := range r.Headers {
+				decrypted, err := utils.ReversibleDecrypt(value, key)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decrypt the header %s of registry %s: %v", name, r.Name, err)
+				}
+				reg.Headers[name] = decrypted
+			}
+			if err := model.ValidateHeaders(reg.Headers); err != nil {
+				return nil, fmt.Errorf("invalid headers of registry %s: %v", r.Name, err)
+			}
+		}
+		if r.SSHTunnel != nil {
+			if len(key) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			privateKey, err := utils.ReversibleDecrypt(r.SSHTunnel.PrivateKey, key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt the private key of the SSH tunnel of registry %s: %v", r.Name, err)
+			}
+			tunnel := *r.SSHTunnel
+			tunnel.PrivateKey = privateKey
+			if err = tunnel.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid SSH tunnel of registry %s: %v", r.Name, err)
+			}
+			reg.SSHTunnel = &tunnel
+		}
+
+		existing, err := mgr.GetByName(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			registries = append(registries, reg)
+			changed = append(changed, reg)
+			result.Created = append(result.Created, r.Name)
+			continue
+		}
+		if !overwrite {
+			result.Skipped = append(result.Skipped, r.Name)
+			continue
+		}
+		merge(reg, existing, len(key) > 0)
+		registries = append(registries, reg)
+		if endpointsChanged(existing, reg) {
+			changed = append(changed, reg)
+		}
+		result.Overwritten = append(result.Overwritten, r.Name)
+	}
+	if err := checkDuplicates(mgr, registries, changed); err != nil {
+		return nil, err
+	}
+	// all the registries are created or overwritten in one transaction
+	if len(registries) > 0 {
+		if err := mgr.Import(registries); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// check whether the changed registries duplicate the others once the registries are imported
+func checkDuplicates(mgr Manager, imported, changed []*model.Registry) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	_, existing, err := mgr.List()
+	if err != nil {
+		return err
+	}
+	// the registries after importing, the overwritten ones are replaced by the imported ones
+	registries := append([]*model.Registry{}, imported...)
+	overwritten := map[int64]bool{}
+	for _, r := range imported {
+		if r.ID > 0 {
+			overwritten[r.ID] = true
+		}
+	}
+	for _, r := range existing {
+		if !overwritten[r.ID] {
+			registries = append(registries, r)
+		}
+	}
+	for _, r := range changed {
+		if err = CheckDuplicate(r, registries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge the registry imported into the existing one, the properties which aren't exported are kept.
+// So are the credential, SSH tunnel and custom headers if the document is exported without the
+// passphrase, as they're omitted rather than removed
+func merge(imported, existing *model.Registry, withSecrets bool) {
+	imported.ID = existing.ID
+	imported.CreationTime = existing.CreationTime
+	imported.Draining = existing.Draining
+	imported.Default = existing.Default
+	if withSecrets {
+		return
+	}
+	imported.Credential = existing.Credential
+	imported.SSHTunnel = existing.SSHTunnel
+	imported.Headers = existing.Headers
+}
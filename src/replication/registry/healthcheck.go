@@ -16,13 +16,24 @@ package registry
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/goharbor/harbor/src/common/utils/log"
+	"github.com/goharbor/harbor/src/replication/model"
 )
 
-// MinInterval defines the minimum interval to check registries' health status.
-const MinInterval = time.Minute * 5
+// const definitions
+const (
+	// MinInterval defines the minimum interval to check registries' health status.
+	MinInterval = time.Minute * 5
+	// DefaultHealthCheckInterval is the interval used when it isn't specified
+	DefaultHealthCheckInterval = time.Minute * 5
+	// DefaultHealthCheckConcurrency is the max count of registries checked concurrently when it isn't specified
+	DefaultHealthCheckConcurrency = 5
+	// HealthCheckRetention is the duration that the health check records are kept
+	HealthCheckRetention = time.Hour * 24 * 7
+)
 
 // HealthChecker is used to regularly check all registries' health status and update
 // check result to database
@@ -34,11 +45,15 @@ type HealthChecker struct {
 
 // NewHealthChecker creates a new health checker
 // - interval specifies the time interval to perform health check for registries
+// - concurrency specifies the max count of registries checked concurrently
 // - closing is a channel to stop the health checker
-func NewHealthChecker(interval time.Duration, closing chan struct{}) *HealthChecker {
+func NewHealthChecker(interval time.Duration, concurrency int, closing chan struct{}) *HealthChecker {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
 	return &HealthChecker{
 		interval: interval,
-		manager:  NewDefaultManager(),
+		manager:  &DefaultManager{healthCheckConcurrency: concurrency},
 		closing:  closing,
 	}
 }
@@ -70,3 +85,22 @@ func (c *HealthChecker) Run() {
 		}
 	}
 }
+
+// checkConcurrently calls the check function for every registry, no more than
+// "concurrency" registries are checked at the same time
+func checkConcurrently(registries []*model.Registry, concurrency int, check func(*model.Registry)) {
+	sem := make(chan struct{}, concurrency)
+	wg := &sync.WaitGroup{}
+	for _, r := range registries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *model.Registry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			check(r)
+		}(r)
+	}
+	wg.Wait()
+}
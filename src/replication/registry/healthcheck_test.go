@@ -0,0 +1,61 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHealthChecker(t *testing.T) {
+	checker := NewHealthChecker(0, 0, nil)
+	assert.Equal(t, DefaultHealthCheckInterval, checker.interval)
+
+	checker = NewHealthChecker(10*time.Minute, 2, nil)
+	assert.Equal(t, 10*time.Minute, checker.interval)
+	assert.Equal(t, 2, checker.manager.(*DefaultManager).healthCheckConcurrency)
+}
+
+func TestCheckConcurrently(t *testing.T) {
+	registries := []*model.Registry{}
+	for i := 0; i < 10; i++ {
+		registries = append(registries, &model.Registry{ID: int64(i)})
+	}
+
+	lock := &sync.Mutex{}
+	current, peak := 0, 0
+	checked := map[int64]bool{}
+	checkConcurrently(registries, 3, func(r *model.Registry) {
+		lock.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		checked[r.ID] = true
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		current--
+		lock.Unlock()
+	})
+	assert.Equal(t, 10, len(checked))
+	assert.Equal(t, 3, peak)
+}
@@ -0,0 +1,145 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+)
+
+// the remediation hints for the common failures when accessing the registry
+const (
+	HintAuth                = "check the username/password or the access key/secret of the registry"
+	HintCertificate         = "enable the insecure option or add the CA certificate of the registry"
+	HintConnectionRefused   = "check the URL/port of the registry and the firewall"
+	HintUnknownHost         = "check the hostname in the URL and the DNS settings"
+	HintTimeout             = "check the network connectivity between Harbor and the registry, or the proxy settings"
+	HintDialTimeout         = "check the network connectivity between Harbor and the registry, or increase the dial timeout if the registry has high latency"
+	HintTLSHandshakeTimeout = "check the proxy settings, or increase the TLS handshake timeout if the registry has high latency"
+	HintNotFound            = "check the URL of the registry, it should point to the endpoint of the registry API"
+	HintScheme              = "check the scheme of the URL, the registry may not support HTTPS"
+	HintUnavailable         = "the registry is temporarily unavailable, try again later"
+	HintClockSkew           = "synchronize the clocks of Harbor and the registry, e.g. with NTP"
+	HintSSHTunnel           = "check the host, user and keys of the SSH tunnel, and that the registry is reachable from the jump host"
+)
+
+// the phases of the request to the registry in which the timeout happens
+const (
+	TimeoutPhaseDial         = "dial"
+	TimeoutPhaseTLSHandshake = "tls_handshake"
+	TimeoutPhaseResponse     = "response"
+)
+
+// Hint returns the remediation hint for the error returned when accessing the registry,
+// empty string is returned if the error isn't recognized
+func Hint(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch TimeoutPhase(err) {
+	case TimeoutPhaseDial:
+		return HintDialTimeout
+	case TimeoutPhaseTLSHandshake:
+		return HintTLSHandshakeTimeout
+	case TimeoutPhaseResponse:
+		return HintTimeout
+	}
+	err = cause(err)
+
+	switch e := err.(type) {
+	case *common_http.Error:
+		switch {
+		case e.IsAuthError():
+			return HintAuth
+		case e.IsRetryable():
+			return HintUnavailable
+		case e.Code == http.StatusNotFound:
+			return HintNotFound
+		}
+		return ""
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return HintCertificate
+	case *net.DNSError:
+		return HintUnknownHost
+	case syscall.Errno:
+		if e == syscall.ECONNREFUSED {
+			return HintConnectionRefused
+		}
+	}
+	// some errors are returned only as messages
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "x509:"):
+		return HintCertificate
+	case strings.Contains(msg, "server gave HTTP response to HTTPS client"):
+		return HintScheme
+	case strings.Contains(msg, "connection refused"):
+		return HintConnectionRefused
+	}
+	return ""
+}
+
+// TimeoutPhase returns the phase of the request to the registry in which the timeout
+// happens, empty string is returned if the error isn't caused by timeout
+func TimeoutPhase(err error) string {
+	e, ok := err.(net.Error)
+	if !ok || !e.Timeout() {
+		return ""
+	}
+	for {
+		urlErr, ok := err.(*url.Error)
+		if !ok {
+			break
+		}
+		err = urlErr.Err
+	}
+	if opErr, ok := err.(*net.OpError); ok && opErr.Op == "dial" {
+		return TimeoutPhaseDial
+	}
+	// the error of TLS handshake timeout isn't exported by net/http
+	if strings.Contains(err.Error(), "TLS handshake timeout") {
+		return TimeoutPhaseTLSHandshake
+	}
+	return TimeoutPhaseResponse
+}
+
+// cause returns the underlying error wrapped by the URL, network and syscall errors
+func cause(err error) error {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			if e.Timeout() {
+				return e
+			}
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return e
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (t *timeoutError) Error() string   { return "i/o timeout" }
+func (t *timeoutError) Timeout() bool   { return true }
+func (t *timeoutError) Temporary() bool { return true }
+
+func TestHint(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{
+			Op:  "Get",
+			URL: "https://registry.example.com/v2/",
+			Err: err,
+		}
+	}
+	cases := []struct {
+		err  error
+		hint string
+	}{
+		{nil, ""},
+		{errors.New("unknown error"), ""},
+		{&common_http.Error{Code: http.StatusUnauthorized}, HintAuth},
+		{wrap(&common_http.Error{Code: http.StatusForbidden}), HintAuth},
+		{&common_http.Error{Code: http.StatusNotFound}, HintNotFound},
+		{&common_http.Error{Code: http.StatusServiceUnavailable}, HintUnavailable},
+		{&common_http.Error{Code: http.StatusBadRequest}, ""},
+		{wrap(x509.UnknownAuthorityError{}), HintCertificate},
+		{wrap(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "registry.example.com"}), HintCertificate},
+		{wrap(errors.New("tls: failed to verify certificate: x509: certificate signed by unknown authority")), HintCertificate},
+		{wrap(&net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+		}), HintConnectionRefused},
+		{wrap(&net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &net.DNSError{Err: "no such host", Name: "registry.example.com"},
+		}), HintUnknownHost},
+		{wrap(&net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &timeoutError{},
+		}), HintDialTimeout},
+		{wrap(&net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: &timeoutError{},
+		}), HintTimeout},
+		{wrap(errors.New("http: server gave HTTP response to HTTPS client")), HintScheme},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.hint, Hint(c.err), "%v", c.err)
+	}
+}
+
+func TestHintWithRealErrors(t *testing.T) {
+	// connection refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	_, err = http.Get("http://" + addr)
+	assert.Equal(t, HintConnectionRefused, Hint(err))
+
+	// certificate signed by unknown authority
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, err = http.Get(server.URL)
+	assert.Equal(t, HintCertificate, Hint(err))
+}
+
+func TestTimeoutPhase(t *testing.T) {
+	assert.Equal(t, "", TimeoutPhase(nil))
+	assert.Equal(t, "", TimeoutPhase(errors.New("error")))
+
+	// stalls at connecting
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				time.Sleep(10 * time.Millisecond)
+				return nil, &net.OpError{Op: "dial", Net: network, Err: &timeoutError{}}
+			},
+		},
+	}
+	_, err := client.Get("http://registry.example.com:5000/v2/")
+	assert.Equal(t, TimeoutPhaseDial, TimeoutPhase(err))
+	assert.Equal(t, HintDialTimeout, Hint(err))
+
+	// stalls at TLS handshake, the connection is accepted but nothing is sent back
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				<-done
+				conn.Close()
+			}()
+		}
+	}()
+	client = &http.Client{
+		Transport: &http.Transport{
+			TLSHandshakeTimeout: 100 * time.Millisecond,
+		},
+	}
+	_, err = client.Get("https://" + listener.Addr().String() + "/v2/")
+	assert.Equal(t, TimeoutPhaseTLSHandshake, TimeoutPhase(err))
+	assert.Equal(t, HintTLSHandshakeTimeout, Hint(err))
+
+	// stalls at waiting for the response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	client = &http.Client{
+		Timeout: 100 * time.Millisecond,
+	}
+	_, err = client.Get(server.URL + "/v2/")
+	assert.Equal(t, TimeoutPhaseResponse, TimeoutPhase(err))
+	assert.Equal(t, HintTimeout, Hint(err))
+}
@@ -0,0 +1,61 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"strings"
+
+	"github.com/goharbor/harbor/src/common/utils"
+	"github.com/goharbor/harbor/src/replication/config"
+)
+
+// IsLocal returns whether the URL points to the local Harbor by comparing its normalized
+// host and port with the ones of the external and internal endpoints of Harbor. Replicating
+// with such a registry makes Harbor replicate to itself, which causes the replication loop
+func IsLocal(url string) bool {
+	if config.Config == nil {
+		return false
+	}
+	address := normalizeAddress(url)
+	if len(address) == 0 {
+		return false
+	}
+	for _, endpoint := range []string{config.Config.ExtEndpoint, config.Config.CoreURL} {
+		if normalizeAddress(endpoint) == address {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the lower-cased "host:port" of the URL, the default port of the scheme is used if the port
+// isn't specified. Empty string is returned if the URL is invalid
+func normalizeAddress(url string) string {
+	if len(url) == 0 {
+		return ""
+	}
+	u, err := utils.ParseEndpoint(url)
+	if err != nil {
+		return ""
+	}
+	port := u.Port()
+	if len(port) == 0 {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return strings.ToLower(u.Hostname()) + ":" + port
+}
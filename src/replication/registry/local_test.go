@@ -0,0 +1,56 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/replication/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLocal(t *testing.T) {
+	cfg := config.Config
+	defer func() {
+		config.Config = cfg
+	}()
+
+	config.Config = nil
+	assert.False(t, IsLocal("https://harbor.example.com"))
+
+	config.Config = &config.Configuration{
+		ExtEndpoint: "https://harbor.example.com",
+		CoreURL:     "http://core:8080",
+	}
+	cases := []struct {
+		url   string
+		local bool
+	}{
+		{url: "https://harbor.example.com", local: true},
+		{url: "https://Harbor.Example.com/", local: true},
+		{url: "https://harbor.example.com:443", local: true},
+		{url: "http://core:8080", local: true},
+		{url: "core:8080", local: true},
+		{url: "http://harbor.example.com", local: false},
+		{url: "https://harbor.example.com:8443", local: false},
+		{url: "https://registry.example.com", local: false},
+		{url: "http://core", local: false},
+		{url: "", local: false},
+		{url: "ftp://harbor.example.com", local: false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.local, IsLocal(c.url), c.url)
+	}
+}
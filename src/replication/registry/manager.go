@@ -15,10 +15,16 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/goharbor/harbor/src/common/utils"
 	"github.com/goharbor/harbor/src/common/utils/log"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/dao"
@@ -36,17 +42,29 @@ type Manager interface {
 	Get(int64) (*model.Registry, error)
 	// GetByName gets registry by name
 	GetByName(name string) (*model.Registry, error)
+	// GetDefault gets the default registry, nil is returned if no registry is the default
+	GetDefault() (*model.Registry, error)
 	// Update the registry, the "props" are the properties of registry
-	// that need to be updated
+	// that need to be updated, named as the JSON fields of the registry,
+	// e.g. "status". All the properties are updated if none is specified
 	Update(registry *model.Registry, props ...string) error
+	// Import creates the registries whose ID is 0 and overwrites the others in one transaction,
+	// none of them is saved if any of them fails
+	Import(registries []*model.Registry) error
 	// Remove the registry with the specified ID
 	Remove(int64) error
 	// HealthCheck checks health status of all registries and update result in database
 	HealthCheck() error
 }
 
+// deletes the expired executions of the registry, it's replaced in the tests
+var deleteExecutions = dao.DeleteExpiredExecutions
+
 // DefaultManager implement the Manager interface
-type DefaultManager struct{}
+type DefaultManager struct {
+	// the max count of registries checked concurrently in the health check
+	healthCheckConcurrency int
+}
 
 // NewDefaultManager returns an instance of DefaultManger
 func NewDefaultManager() *DefaultManager {
@@ -67,7 +85,14 @@ func (m *DefaultManager) Get(id int64) (*model.Registry, error) {
 		return nil, nil
 	}
 
-	return fromDaoModel(registry)
+	r, err := fromDaoModel(registry)
+	if err != nil {
+		return nil, err
+	}
+	if err = fillLabels(r); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // GetByName gets a registry by its name
@@ -81,7 +106,35 @@ func (m *DefaultManager) GetByName(name string) (*model.Registry, error) {
 		return nil, nil
 	}
 
-	return fromDaoModel(registry)
+	r, err := fromDaoModel(registry)
+	if err != nil {
+		return nil, err
+	}
+	if err = fillLabels(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetDefault gets the default registry
+func (m *DefaultManager) GetDefault() (*model.Registry, error) {
+	registry, err := dao.GetDefaultRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	if registry == nil {
+		return nil, nil
+	}
+
+	r, err := fromDaoModel(registry)
+	if err != nil {
+		return nil, err
+	}
+	if err = fillLabels(r); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // List lists registries according to query provided.
@@ -90,8 +143,10 @@ func (m *DefaultManager) List(query ...*model.RegistryQuery) (int64, []*model.Re
 	if len(query) > 0 {
 		// limit being -1 indicates no pagination specified, result in all registries matching name returned.
 		listQuery := &dao.ListRegistryQuery{
-			Query: query[0].Name,
-			Limit: -1,
+			Query:         query[0].Name,
+			Limit:         -1,
+			Labels:        query[0].Labels,
+			MatchAnyLabel: query[0].LabelMatch == model.LabelMatchAny,
 		}
 		if query[0].Pagination != nil {
 			listQuery.Offset = query[0].Pagination.Page * query[0].Pagination.Size
@@ -113,6 +168,9 @@ func (m *DefaultManager) List(query ...*model.RegistryQuery) (int64, []*model.Re
 		}
 		results = append(results, registry)
 	}
+	if err = fillLabels(results...); err != nil {
+		return -1, nil, err
+	}
 
 	return total, results, nil
 }
@@ -130,53 +188,217 @@ func (m *DefaultManager) Add(registry *model.Registry) (int64, error) {
 		log.Errorf("Add registry error: %v", err)
 		return -1, err
 	}
+	if err = dao.SetRegistryLabels(id, registry.Labels); err != nil {
+		log.Errorf("Set labels of registry %d error: %v", id, err)
+		return -1, err
+	}
 
 	return id, nil
 }
 
-// Update updates a registry
+// the columns of the registry updated for the properties passed to "Update"
+var registryColumns = map[string][]string{
+	"name":                    {"Name"},
+	"description":             {"Description"},
+	"type":                    {"Type"},
+	"url":                     {"URL"},
+	"credential":              {"CredentialType", "AccessKey", "AccessSecret"},
+	"insecure":                {"Insecure"},
+	"user_agent":              {"UserAgent"},
+	"max_connections":         {"MaxConnections"},
+	"job_retention_days":      {"JobRetentionDays"},
+	"draining":                {"Draining"},
+	"status":                  {"Health"},
+	"allowed_projects":        {"AllowedProjects"},
+	"blackout_windows":        {"BlackoutWindows"},
+	"path_transform":          {"PathTransform"},
+	"labels":                  {},
+	"preferred_manifest_type": {"PreferredManifestType"},
+	"headers":                 {"Headers"},
+	"failover_urls":           {"FailoverURLs"},
+	"layer_media_types":       {"LayerMediaTypes"},
+	"warmup_connections":      {"WarmupConnections"},
+	"timezone":                {"Timezone"},
+	"ssh_tunnel":              {"SSHTunnel"},
+	"default":                 {"Default"},
+}
+
+// returns the columns of the registry updated for the properties, nil is returned
+// if no property is specified, which means all the columns are updated
+func toDaoColumns(props []string) ([]string, error) {
+	if len(props) == 0 {
+		return nil, nil
+	}
+	columns := []string{}
+	for _, prop := range props {
+		cols, exist := registryColumns[prop]
+		if !exist {
+			return nil, fmt.Errorf("unknown property of registry: %s", prop)
+		}
+		columns = append(columns, cols...)
+	}
+	return columns, nil
+}
+
+// returns whether the property is updated by the update of the properties
+func updatesProp(props []string, prop string) bool {
+	if len(props) == 0 {
+		return true
+	}
+	for _, p := range props {
+		if p == prop {
+			return true
+		}
+	}
+	return false
+}
+
+// Update updates a registry, only the columns of the properties specified are written,
+// so the partial updates, e.g. the status updated by the health check, don't overwrite
+// the other properties changed concurrently
 func (m *DefaultManager) Update(registry *model.Registry, props ...string) error {
+	columns, err := toDaoColumns(props)
+	if err != nil {
+		return err
+	}
 	r, err := toDaoModel(registry)
 	if err != nil {
 		log.Errorf("Convert registry model to dao layer model error: %v", err)
 		return err
 	}
 
-	return dao.UpdateRegistry(r)
+	updatesTunnel := updatesProp(props, "ssh_tunnel")
+	var previous *registry_pkg.SSHTunnel
+	if updatesTunnel {
+		if previous, err = getTunnel(registry.ID); err != nil {
+			return err
+		}
+	}
+	if len(props) == 0 || len(columns) > 0 {
+		if err = dao.UpdateRegistry(r, columns...); err != nil {
+			return err
+		}
+	}
+	if updatesTunnel {
+		registry_pkg.ReleaseTunnel(previous, registry.SSHTunnel)
+	}
+	if updatesProp(props, "labels") {
+		return dao.SetRegistryLabels(registry.ID, registry.Labels)
+	}
+	return nil
+}
+
+// fillLabels populates the labels of the registries
+func fillLabels(registries ...*model.Registry) error {
+	ids := []int64{}
+	for _, r := range registries {
+		ids = append(ids, r.ID)
+	}
+	labels, err := dao.GetRegistryLabels(ids...)
+	if err != nil {
+		return err
+	}
+	for _, r := range registries {
+		r.Labels = labels[r.ID]
+		if r.Labels == nil {
+			r.Labels = []string{}
+		}
+	}
+	return nil
+}
+
+// Import creates or overwrites the registries in one transaction
+func (m *DefaultManager) Import(registries []*model.Registry) error {
+	imported := []*dao.ImportedRegistry{}
+	// the SSH tunnels replaced are released after the transaction is committed
+	previous := map[int64]*registry_pkg.SSHTunnel{}
+	for _, registry := range registries {
+		r, err := toDaoModel(registry)
+		if err != nil {
+			log.Errorf("Convert registry model to dao layer model error: %v", err)
+			return err
+		}
+		if registry.ID > 0 {
+			if previous[registry.ID], err = getTunnel(registry.ID); err != nil {
+				return err
+			}
+		}
+		imported = append(imported, &dao.ImportedRegistry{
+			Registry: r,
+			Labels:   registry.Labels,
+		})
+	}
+	if err := dao.ImportRegistries(imported); err != nil {
+		return err
+	}
+	for i, registry := range registries {
+		if registry.ID > 0 {
+			registry_pkg.ReleaseTunnel(previous[registry.ID], registry.SSHTunnel)
+		}
+		registry.ID = imported[i].Registry.ID
+	}
+	return nil
 }
 
 // Remove deletes a registry
 func (m *DefaultManager) Remove(id int64) error {
+	previous, err := getTunnel(id)
+	if err != nil {
+		return err
+	}
 	if err := dao.DeleteRegistry(id); err != nil {
 		log.Errorf("Delete registry %d error: %v", id, err)
 		return err
 	}
+	registry_pkg.ReleaseTunnel(previous, nil)
 
 	return nil
 }
 
+// getTunnel returns the SSH tunnel currently stored for the registry, the connections
+// opened through it are released once the registry is updated or removed
+func getTunnel(id int64) (*registry_pkg.SSHTunnel, error) {
+	registry, err := dao.GetRegistry(id)
+	if err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		return nil, nil
+	}
+	r, err := fromDaoModel(registry)
+	if err != nil {
+		return nil, err
+	}
+	return r.SSHTunnel, nil
+}
+
 // HealthCheck checks health status of every registries and update their status. It will check whether a registry
-// is reachable and the credential is valid
+// is reachable and the credential is valid. The registries are checked concurrently and the result of every
+// check is recorded with the latency
 func (m *DefaultManager) HealthCheck() error {
 	_, registries, err := m.List()
 	if err != nil {
 		return err
 	}
 
-	errCount := 0
-	for _, r := range registries {
-		status, err := CheckHealthStatus(r)
-		if err != nil {
-			log.Warningf("Check health status for %s error: %v", r.URL, err)
-		}
-		r.Status = string(status)
-		err = m.Update(r, "status")
-		if err != nil {
+	concurrency := m.healthCheckConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultHealthCheckConcurrency
+	}
+	var errCount int32
+	checkConcurrently(registries, concurrency, func(r *model.Registry) {
+		if err := m.healthCheck(r); err != nil {
 			log.Warningf("Update health status for '%s' error: %v", r.URL, err)
-			errCount++
-			continue
+			atomic.AddInt32(&errCount, 1)
 		}
+	})
+
+	// clean up the expired health check records
+	if _, err := dao.DeleteRegistryHealthChecks(time.Now().Add(-HealthCheckRetention)); err != nil {
+		log.Warningf("Delete expired health check records error: %v", err)
 	}
+	// clean up the expired replication jobs of the registries
+	deleteExpiredJobs(registries, time.Now())
 
 	if errCount > 0 {
 		return fmt.Errorf("%d out of %d registries failed to update health status", errCount, len(registries))
@@ -184,8 +406,65 @@ func (m *DefaultManager) HealthCheck() error {
 	return nil
 }
 
+// deleteExpiredJobs deletes the finished replication jobs from or to the registries which ended
+// more than the retention days of the registry before "now", the registries without retention
+// days keep the jobs forever
+func deleteExpiredJobs(registries []*model.Registry, now time.Time) {
+	for _, r := range registries {
+		if r.JobRetentionDays <= 0 {
+			continue
+		}
+		n, err := deleteExecutions(r.ID, now.AddDate(0, 0, -r.JobRetentionDays))
+		if err != nil {
+			log.Warningf("Delete expired replication jobs of registry %s error: %v", r.Name, err)
+			continue
+		}
+		if n > 0 {
+			log.Debugf("%d expired replication jobs of registry %s deleted", n, r.Name)
+		}
+	}
+}
+
+// healthCheck checks the health status of the registry, updates the status and records the result
+func (m *DefaultManager) healthCheck(r *model.Registry) error {
+	if !Breaker.Allow(r.ID) {
+		log.Debugf("The circuit breaker of registry %s is open, skip the health check", r.URL)
+		r.Status = model.Unhealthy
+		return m.Update(r, "status")
+	}
+
+	start := time.Now()
+	status, err := CheckHealthStatus(r)
+	latency := time.Since(start)
+	if err != nil {
+		log.Warningf("Check health status for %s error: %v", r.URL, err)
+	}
+	if status == model.Healthy {
+		Breaker.Succeed(r.ID)
+	} else {
+		Breaker.Fail(r.ID)
+	}
+
+	r.Status = string(status)
+	if err = m.Update(r, "status"); err != nil {
+		return err
+	}
+	_, err = dao.AddRegistryHealthCheck(&models.RegistryHealthCheck{
+		RegistryID: r.ID,
+		Status:     r.Status,
+		Latency:    int64(latency / time.Millisecond),
+	})
+	return err
+}
+
 // CheckHealthStatus checks status of a given registry
 func CheckHealthStatus(r *model.Registry) (model.HealthStatus, error) {
+	return CheckHealthStatusWithContext(context.Background(), r)
+}
+
+// CheckHealthStatusWithContext checks status of a given registry, the check is aborted when the
+// context is canceled if the adapter supports it
+func CheckHealthStatusWithContext(ctx context.Context, r *model.Registry) (model.HealthStatus, error) {
 	if !adapter.HasFactory(r.Type) {
 		return model.Unknown, fmt.Errorf("no adapter factory for type '%s' registered", r.Type)
 	}
@@ -200,16 +479,24 @@ func CheckHealthStatus(r *model.Registry) (model.HealthStatus, error) {
 		return model.Unknown, fmt.Errorf("generate '%s' type adapter form factory error: %v", r.Type, err)
 	}
 
+	if checker, ok := rAdapter.(adapter.ContextHealthChecker); ok {
+		return checker.HealthCheckWithContext(ctx)
+	}
 	return rAdapter.HealthCheck()
 }
 
-// decrypt checks whether access secret is set in the registry, if so, decrypt it.
-func decrypt(secret string) (string, error) {
+// Decrypt decrypts the secret with the key of the version recorded in it, the empty
+// secret is returned as it is.
+func Decrypt(secret string) (string, error) {
 	if len(secret) == 0 {
 		return "", nil
 	}
 
-	decrypted, err := utils.ReversibleDecrypt(secret, config.Config.SecretKey)
+	key, err := secretKey(utils.KeyVersion(secret))
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := utils.ReversibleDecrypt(secret, key)
 	if err != nil {
 		return "", err
 	}
@@ -217,13 +504,23 @@ func decrypt(secret string) (string, error) {
 	return decrypted, nil
 }
 
-// encrypt checks whether access secret is set in the registry, if so, encrypt it.
-func encrypt(secret string) (string, error) {
+// Encrypt encrypts the secret with the key of the current version, the empty secret is
+// returned as it is. It's used for the secrets of the registries and the ones stored along
+// with them, e.g. the registries carried by the deferred replication tasks.
+func Encrypt(secret string) (string, error) {
 	if len(secret) == 0 {
 		return secret, nil
 	}
 
-	encrypted, err := utils.ReversibleEncrypt(secret, config.Config.SecretKey)
+	version := config.Config.SecretKeyVersion
+	if len(version) == 0 {
+		return utils.ReversibleEncrypt(secret, config.Config.SecretKey)
+	}
+	key, err := secretKey(version)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := utils.ReversibleEncryptWithKeyVersion(secret, key, version)
 	if err != nil {
 		return "", err
 	}
@@ -231,20 +528,115 @@ func encrypt(secret string) (string, error) {
 	return encrypted, nil
 }
 
+// secretKey returns the key of the version in the keyring, the secret key is returned if the version is empty
+func secretKey(version string) (string, error) {
+	if len(version) == 0 {
+		return config.Config.SecretKey, nil
+	}
+	key, exist := config.Config.SecretKeys[version]
+	if !exist {
+		return "", fmt.Errorf("the key of version %s not found in the keyring", version)
+	}
+	return key, nil
+}
+
+// ValidateSecretKeys validates the keyring used to encrypt the secrets of the registries, all the keys
+// must be valid AES keys and the key of the current version must be in the keyring
+func ValidateSecretKeys(keys map[string]string, version string) error {
+	for v, key := range keys {
+		if _, err := utils.ReversibleEncryptWithKeyVersion("", key, v); err != nil {
+			return fmt.Errorf("invalid key of version %s in the keyring: %v", v, err)
+		}
+	}
+	if len(version) > 0 {
+		if _, exist := keys[version]; !exist {
+			return fmt.Errorf("the key of the current version %s not found in the keyring", version)
+		}
+	}
+	return nil
+}
+
 // fromDaoModel converts DAO layer registry model to replication model.
 // Also, if access secret is provided, decrypt it.
 func fromDaoModel(registry *models.Registry) (*model.Registry, error) {
 	r := &model.Registry{
-		ID:           registry.ID,
-		Name:         registry.Name,
-		Description:  registry.Description,
-		Type:         model.RegistryType(registry.Type),
-		Credential:   &model.Credential{},
-		URL:          registry.URL,
-		Insecure:     registry.Insecure,
-		Status:       registry.Health,
-		CreationTime: registry.CreationTime,
-		UpdateTime:   registry.UpdateTime,
+		ID:                    registry.ID,
+		Name:                  registry.Name,
+		Description:           registry.Description,
+		Type:                  model.RegistryType(registry.Type),
+		Credential:            &model.Credential{},
+		URL:                   registry.URL,
+		Insecure:              registry.Insecure,
+		UserAgent:             registry.UserAgent,
+		MaxConnections:        registry.MaxConnections,
+		JobRetentionDays:      registry.JobRetentionDays,
+		Draining:              registry.Draining,
+		Default:               registry.Default,
+		Status:                registry.Health,
+		PreferredManifestType: registry.PreferredManifestType,
+		WarmupConnections:     registry.WarmupConnections,
+		Timezone:              registry.Timezone,
+		CreationTime:          registry.CreationTime,
+		UpdateTime:            registry.UpdateTime,
+	}
+
+	if len(registry.AllowedProjects) > 0 {
+		if err := json.Unmarshal([]byte(registry.AllowedProjects), &r.AllowedProjects); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.BlackoutWindows) > 0 {
+		if err := json.Unmarshal([]byte(registry.BlackoutWindows), &r.BlackoutWindows); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.PathTransform) > 0 {
+		r.PathTransform = &model.PathTransform{}
+		if err := json.Unmarshal([]byte(registry.PathTransform), r.PathTransform); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.Headers) > 0 {
+		// the headers may carry the secrets, e.g. the API keys, so they're encrypted
+		// except the ones stored before the encryption was introduced
+		headers := registry.Headers
+		if !strings.HasPrefix(headers, "{") {
+			decrypted, err := Decrypt(headers)
+			if err != nil {
+				return nil, err
+			}
+			headers = decrypted
+		}
+		if err := json.Unmarshal([]byte(headers), &r.Headers); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.FailoverURLs) > 0 {
+		if err := json.Unmarshal([]byte(registry.FailoverURLs), &r.FailoverURLs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.LayerMediaTypes) > 0 {
+		r.LayerMediaTypes = &model.LayerMediaTypes{}
+		if err := json.Unmarshal([]byte(registry.LayerMediaTypes), r.LayerMediaTypes); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.SSHTunnel) > 0 {
+		decrypted, err := Decrypt(registry.SSHTunnel)
+		if err != nil {
+			return nil, err
+		}
+		r.SSHTunnel = &registry_pkg.SSHTunnel{}
+		if err := json.Unmarshal([]byte(decrypted), r.SSHTunnel); err != nil {
+			return nil, err
+		}
 	}
 
 	if len(registry.AccessKey) != 0 {
@@ -252,7 +644,7 @@ func fromDaoModel(registry *models.Registry) (*model.Registry, error) {
 		if len(credentialType) == 0 {
 			credentialType = model.CredentialTypeBasic
 		}
-		decrypted, err := decrypt(registry.AccessSecret)
+		decrypted, err := Decrypt(registry.AccessSecret)
 		if err != nil {
 			return nil, err
 		}
@@ -270,15 +662,83 @@ func fromDaoModel(registry *models.Registry) (*model.Registry, error) {
 // Also, if access secret is provided, encrypt it.
 func toDaoModel(registry *model.Registry) (*models.Registry, error) {
 	m := &models.Registry{
-		ID:           registry.ID,
-		URL:          registry.URL,
-		Name:         registry.Name,
-		Type:         string(registry.Type),
-		Insecure:     registry.Insecure,
-		Description:  registry.Description,
-		Health:       registry.Status,
-		CreationTime: registry.CreationTime,
-		UpdateTime:   registry.UpdateTime,
+		ID:                    registry.ID,
+		URL:                   registry.URL,
+		Name:                  registry.Name,
+		Type:                  string(registry.Type),
+		Insecure:              registry.Insecure,
+		Description:           registry.Description,
+		UserAgent:             registry.UserAgent,
+		MaxConnections:        registry.MaxConnections,
+		JobRetentionDays:      registry.JobRetentionDays,
+		Draining:              registry.Draining,
+		Default:               registry.Default,
+		Health:                registry.Status,
+		PreferredManifestType: registry.PreferredManifestType,
+		WarmupConnections:     registry.WarmupConnections,
+		Timezone:              registry.Timezone,
+		CreationTime:          registry.CreationTime,
+		UpdateTime:            registry.UpdateTime,
+	}
+
+	if len(registry.AllowedProjects) > 0 {
+		data, err := json.Marshal(registry.AllowedProjects)
+		if err != nil {
+			return nil, err
+		}
+		m.AllowedProjects = string(data)
+	}
+
+	if len(registry.BlackoutWindows) > 0 {
+		data, err := json.Marshal(registry.BlackoutWindows)
+		if err != nil {
+			return nil, err
+		}
+		m.BlackoutWindows = string(data)
+	}
+
+	if registry.PathTransform != nil {
+		data, err := json.Marshal(registry.PathTransform)
+		if err != nil {
+			return nil, err
+		}
+		m.PathTransform = string(data)
+	}
+
+	if len(registry.Headers) > 0 {
+		data, err := json.Marshal(registry.Headers)
+		if err != nil {
+			return nil, err
+		}
+		if m.Headers, err = Encrypt(string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(registry.FailoverURLs) > 0 {
+		data, err := json.Marshal(registry.FailoverURLs)
+		if err != nil {
+			return nil, err
+		}
+		m.FailoverURLs = string(data)
+	}
+
+	if registry.LayerMediaTypes != nil {
+		data, err := json.Marshal(registry.LayerMediaTypes)
+		if err != nil {
+			return nil, err
+		}
+		m.LayerMediaTypes = string(data)
+	}
+
+	if registry.SSHTunnel != nil {
+		data, err := json.Marshal(registry.SSHTunnel)
+		if err != nil {
+			return nil, err
+		}
+		if m.SSHTunnel, err = Encrypt(string(data)); err != nil {
+			return nil, err
+		}
 	}
 
 	if registry.Credential != nil && len(registry.Credential.AccessKey) != 0 {
@@ -286,7 +746,7 @@ func toDaoModel(registry *model.Registry) (*models.Registry, error) {
 		if len(credentialType) == 0 {
 			credentialType = model.CredentialTypeBasic
 		}
-		encrypted, err := encrypt(registry.Credential.AccessSecret)
+		encrypted, err := Encrypt(registry.Credential.AccessSecret)
 		if err != nil {
 			return nil, err
 		}
@@ -298,3 +758,56 @@ func toDaoModel(registry *model.Registry) (*models.Registry, error) {
 
 	return m, nil
 }
+
+// CopyRegistry returns the deep copy of the registry
+func CopyRegistry(registry *model.Registry) *model.Registry {
+	r := *registry
+	if registry.Credential != nil {
+		credential := *registry.Credential
+		r.Credential = &credential
+	}
+	if registry.AllowedProjects != nil {
+		r.AllowedProjects = append([]string{}, registry.AllowedProjects...)
+	}
+	if registry.BlackoutWindows != nil {
+		r.BlackoutWindows = []*model.BlackoutWindow{}
+		for _, window := range registry.BlackoutWindows {
+			if window == nil {
+				r.BlackoutWindows = append(r.BlackoutWindows, nil)
+				continue
+			}
+			w := *window
+			if window.Weekdays != nil {
+				w.Weekdays = append([]time.Weekday{}, window.Weekdays...)
+			}
+			r.BlackoutWindows = append(r.BlackoutWindows, &w)
+		}
+	}
+	if registry.PathTransform != nil {
+		transform := *registry.PathTransform
+		r.PathTransform = &transform
+	}
+	if registry.Labels != nil {
+		r.Labels = append([]string{}, registry.Labels...)
+	}
+	if registry.FailoverURLs != nil {
+		r.FailoverURLs = append([]string{}, registry.FailoverURLs...)
+	}
+	if registry.LayerMediaTypes != nil {
+		mediaTypes := *registry.LayerMediaTypes
+		mediaTypes.Allowed = append([]string(nil), mediaTypes.Allowed...)
+		mediaTypes.Denied = append([]string(nil), mediaTypes.Denied...)
+		r.LayerMediaTypes = &mediaTypes
+	}
+	if registry.Headers != nil {
+		r.Headers = map[string]string{}
+		for name, value := range registry.Headers {
+			r.Headers[name] = value
+		}
+	}
+	if registry.SSHTunnel != nil {
+		tunnel := *registry.SSHTunnel
+		r.SSHTunnel = &tunnel
+	}
+	return &r
+}
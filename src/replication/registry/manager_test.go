@@ -15,12 +15,242 @@
 package registry
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/config"
+	"github.com/goharbor/harbor/src/replication/dao/models"
+	"github.com/goharbor/harbor/src/replication/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDefaultManager(t *testing.T) {
 	mgr := NewDefaultManager()
 	assert.NotNil(t, mgr)
 }
+
+func TestDeleteExpiredJobs(t *testing.T) {
+	deleted := map[int64]time.Time{}
+	original := deleteExecutions
+	defer func() { deleteExecutions = original }()
+	deleteExecutions = func(registryID int64, before time.Time) (int64, error) {
+		deleted[registryID] = before
+		return 1, nil
+	}
+
+	now := time.Now()
+	deleteExpiredJobs([]*model.Registry{
+		{ID: 1, Name: "forever"},
+		{ID: 2, Name: "week", JobRetentionDays: 7},
+		{ID: 3, Name: "day", JobRetentionDays: 1},
+	}, now)
+	assert.Equal(t, map[int64]time.Time{
+		2: now.AddDate(0, 0, -7),
+		3: now.AddDate(0, 0, -1),
+	}, deleted)
+}
+
+func TestEncryptWithKeyVersions(t *testing.T) {
+	original := config.Config
+	defer func() { config.Config = original }()
+	config.Config = &config.Configuration{
+		SecretKey: "1234567890123456",
+	}
+
+	// the secret written before the keyring is configured
+	legacy, err := Encrypt("password")
+	require.Nil(t, err)
+
+	// the secret written under the key version 1
+	config.Config.SecretKeys = map[string]string{
+		"1": "abcdefghijklmnop",
+	}
+	config.Config.SecretKeyVersion = "1"
+	v1, err := Encrypt("password1")
+	require.Nil(t, err)
+
+	// rotate the key to version 2
+	config.Config.SecretKeys["2"] = "ponmlkjihgfedcba"
+	config.Config.SecretKeyVersion = "2"
+	v2, err := Encrypt("password2")
+	require.Nil(t, err)
+
+	cases := []struct {
+		encrypted string
+		decrypted string
+	}{
+		{encrypted: legacy, decrypted: "password"},
+		{encrypted: v1, decrypted: "password1"},
+		{encrypted: v2, decrypted: "password2"},
+	}
+	for _, c := range cases {
+		decrypted, err := Decrypt(c.encrypted)
+		require.Nil(t, err)
+		assert.Equal(t, c.decrypted, decrypted)
+	}
+
+	// the key of the version is removed from the keyring
+	delete(config.Config.SecretKeys, "1")
+	_, err = Decrypt(v1)
+	assert.NotNil(t, err)
+
+	// the key of the current version isn't in the keyring
+	config.Config.SecretKeyVersion = "3"
+	_, err = Encrypt("password3")
+	assert.NotNil(t, err)
+}
+
+func TestValidateSecretKeys(t *testing.T) {
+	// no keyring
+	assert.Nil(t, ValidateSecretKeys(map[string]string{}, ""))
+
+	keys := map[string]string{
+		"1": "abcdefghijklmnop",
+		"2": "ponmlkjihgfedcba",
+	}
+	assert.Nil(t, ValidateSecretKeys(keys, "2"))
+	// the key of the current version isn't in the keyring
+	assert.NotNil(t, ValidateSecretKeys(keys, "3"))
+	// the key isn't a valid AES key
+	keys["3"] = "short"
+	assert.NotNil(t, ValidateSecretKeys(keys, "2"))
+	// the version is invalid
+	delete(keys, "3")
+	keys["v>1"] = "abcdefghijklmnop"
+	assert.NotNil(t, ValidateSecretKeys(keys, "2"))
+}
+
+func TestSSHTunnelEncrypted(t *testing.T) {
+	original := config.Config
+	defer func() { config.Config = original }()
+	config.Config = &config.Configuration{
+		SecretKey: "1234567890123456",
+	}
+
+	tunnel := &registry_pkg.SSHTunnel{
+		Host:       "jump.example.com:2222",
+		User:       "harbor",
+		PrivateKey: testPrivateKey,
+		HostKey:    testHostKey,
+	}
+	m, err := toDaoModel(&model.Registry{
+		Name:      "registry",
+		SSHTunnel: tunnel,
+	})
+	require.Nil(t, err)
+	// the private key isn't stored in plain text
+	assert.NotContains(t, m.SSHTunnel, "PRIVATE KEY")
+
+	r, err := fromDaoModel(m)
+	require.Nil(t, err)
+	require.NotNil(t, r.SSHTunnel)
+	assert.Equal(t, *tunnel, *r.SSHTunnel)
+
+	// no tunnel
+	m, err = toDaoModel(&model.Registry{Name: "registry"})
+	require.Nil(t, err)
+	assert.Empty(t, m.SSHTunnel)
+	r, err = fromDaoModel(m)
+	require.Nil(t, err)
+	assert.Nil(t, r.SSHTunnel)
+}
+
+func TestHeadersEncrypted(t *testing.T) {
+	original := config.Config
+	defer func() { config.Config = original }()
+	config.Config = &config.Configuration{
+		SecretKey: "1234567890123456",
+	}
+
+	headers := map[string]string{"X-Api-Key": "secret-key"}
+	m, err := toDaoModel(&model.Registry{
+		Name:    "registry",
+		Headers: headers,
+	})
+	require.Nil(t, err)
+	// the headers aren't stored in plain text
+	assert.NotContains(t, m.Headers, "secret-key")
+
+	r, err := fromDaoModel(m)
+	require.Nil(t, err)
+	assert.Equal(t, headers, r.Headers)
+
+	// the headers stored in plain text before the encryption was introduced
+	m.Headers = `{"X-Api-Key":"secret-key"}`
+	r, err = fromDaoModel(m)
+	require.Nil(t, err)
+	assert.Equal(t, headers, r.Headers)
+}
+
+func TestToDaoColumns(t *testing.T) {
+	// all the columns are updated
+	columns, err := toDaoColumns(nil)
+	require.Nil(t, err)
+	assert.Nil(t, columns)
+
+	columns, err = toDaoColumns([]string{"status"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"Health"}, columns)
+
+	columns, err = toDaoColumns([]string{"credential", "default"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"CredentialType", "AccessKey", "AccessSecret", "Default"}, columns)
+
+	// the labels aren't stored in the registry table
+	columns, err = toDaoColumns([]string{"labels"})
+	require.Nil(t, err)
+	assert.Empty(t, columns)
+
+	_, err = toDaoColumns([]string{"unknown"})
+	assert.NotNil(t, err)
+
+	// every column maps to a field of the dao model
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(models.Registry{})
+	for i := 0; i < typ.NumField(); i++ {
+		fields[typ.Field(i).Name] = true
+	}
+	for prop, cols := range registryColumns {
+		for _, col := range cols {
+			assert.True(t, fields[col], "the column %s of the property %s", col, prop)
+		}
+	}
+}
+
+func TestCopyRegistry(t *testing.T) {
+	r := &model.Registry{
+		ID:              1,
+		Name:            "registry",
+		Credential:      &model.Credential{AccessKey: "admin"},
+		AllowedProjects: []string{"library"},
+		BlackoutWindows: []*model.BlackoutWindow{
+			{
+				Start:    "09:00",
+				End:      "17:00",
+				Weekdays: []time.Weekday{time.Monday},
+			},
+		},
+		FailoverURLs: []string{"https://dr.example.com"},
+		Headers:      map[string]string{"X-Api-Key": "key"},
+		SSHTunnel:    &registry_pkg.SSHTunnel{Host: "jump.example.com"},
+	}
+	copied := CopyRegistry(r)
+	assert.True(t, reflect.DeepEqual(r, copied))
+
+	// modifying the copy doesn't change the original one
+	copied.Credential.AccessKey = "user"
+	copied.AllowedProjects[0] = "public"
+	copied.BlackoutWindows[0].Weekdays[0] = time.Sunday
+	copied.FailoverURLs[0] = "https://other.example.com"
+	copied.Headers["X-Api-Key"] = "other"
+	copied.SSHTunnel.Host = "other.example.com"
+	assert.Equal(t, "admin", r.Credential.AccessKey)
+	assert.Equal(t, "library", r.AllowedProjects[0])
+	assert.Equal(t, time.Monday, r.BlackoutWindows[0].Weekdays[0])
+	assert.Equal(t, "https://dr.example.com", r.FailoverURLs[0])
+	assert.Equal(t, "key", r.Headers["X-Api-Key"])
+	assert.Equal(t, "jump.example.com", r.SSHTunnel.Host)
+}
@@ -0,0 +1,249 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+)
+
+// const definitions
+const (
+	// BatchPingConcurrency is the max count of registries pinged concurrently in one batch
+	BatchPingConcurrency = 10
+	// BatchPingTimeout is the timeout shared by all the registries pinged in one batch
+	BatchPingTimeout = 30 * time.Second
+	// MaxClockSkew is the max clock skew between the registry and Harbor, the token issued by the
+	// registry may be considered as expired or not valid yet when the skew exceeds it
+	MaxClockSkew = 1 * time.Minute
+)
+
+// PingResult is the result of pinging one registry, the latency is in milliseconds
+type PingResult struct {
+	ID      int64  `json:"id,omitempty"`
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+	Latency int64  `json:"latency"`
+	Error   string `json:"error,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+	// the phase in which the ping timed out, e.g. "dial" or "tls_handshake"
+	TimeoutPhase string `json:"timeout_phase,omitempty"`
+	// the endpoint which is pinged successfully, it differs from the URL when failing over
+	Endpoint string `json:"endpoint,omitempty"`
+	// the product of the registry, it's only probed when pinging a single registry successfully
+	Product *registry_pkg.Product `json:"product,omitempty"`
+	// the clock skew between the registry and Harbor in seconds, it's only measured when pinging
+	// a single registry successfully
+	ClockSkew *int64 `json:"clock_skew,omitempty"`
+	// the warning about the registry which doesn't fail the ping, e.g. the large clock skew
+	Warning string `json:"warning,omitempty"`
+	// whether the result is the cached one of the recent ping rather than a new ping
+	Cached bool `json:"cached,omitempty"`
+}
+
+// ProbeProductWithContext probes the product of the registry, the probe is aborted when the context is canceled
+func ProbeProductWithContext(ctx context.Context, r *model.Registry) (*registry_pkg.Product, error) {
+	rAdapter, err := newAdapter(r)
+	if err != nil {
+		return nil, err
+	}
+	prober, ok := rAdapter.(adapter.ProductProber)
+	if !ok {
+		return nil, fmt.Errorf("probing the product isn't supported by the registry type %s", r.Type)
+	}
+	return prober.ProductWithContext(ctx)
+}
+
+// MeasureClockSkewWithContext measures the clock skew between the registry and Harbor, the measurement
+// is aborted when the context is canceled
+func MeasureClockSkewWithContext(ctx context.Context, r *model.Registry) (time.Duration, error) {
+	rAdapter, err := newAdapter(r)
+	if err != nil {
+		return 0, err
+	}
+	measurer, ok := rAdapter.(adapter.ClockSkewMeasurer)
+	if !ok {
+		return 0, fmt.Errorf("measuring the clock skew isn't supported by the registry type %s", r.Type)
+	}
+	return measurer.ClockSkewWithContext(ctx)
+}
+
+// ClockSkewExceeded returns whether the clock skew exceeds the max one
+func ClockSkewExceeded(skew time.Duration) bool {
+	return skew > MaxClockSkew || skew < -MaxClockSkew
+}
+
+// CheckPushPermissionWithContext checks whether the credential of the registry has the permission to push
+// to the repository, the check is aborted when the context is canceled
+func CheckPushPermissionWithContext(ctx context.Context, r *model.Registry, repository string) (bool, error) {
+	rAdapter, err := newAdapter(r)
+	if err != nil {
+		return false, err
+	}
+	checker, ok := rAdapter.(adapter.PushPermissionChecker)
+	if !ok {
+		return false, fmt.Errorf("checking the push permission isn't supported by the registry type %s", r.Type)
+	}
+	return checker.CanPushWithContext(ctx, repository)
+}
+
+// CheckTunnelWithContext establishes the SSH tunnel of the registry and connects to the registry
+// through it, so the failure of the tunnel is reported separately from the one of the registry.
+// Nothing is checked if the registry has no tunnel
+func CheckTunnelWithContext(ctx context.Context, r *model.Registry) error {
+	if r.SSHTunnel == nil {
+		return nil
+	}
+	address, err := tunnelTarget(r.URL)
+	if err != nil {
+		return err
+	}
+	return registry_pkg.CheckTunnelWithContext(ctx, r.SSHTunnel, address)
+}
+
+// returns the address with the port of the registry which is connected to through the tunnel
+func tunnelTarget(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Hostname()) == 0 {
+		return "", fmt.Errorf("invalid URL %s", endpoint)
+	}
+	port := u.Port()
+	if len(port) == 0 {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+func newAdapter(r *model.Registry) (adapter.Adapter, error) {
+	factory, err := adapter.GetFactory(r.Type)
+	if err != nil {
+		return nil, fmt.Errorf("get adaper for type '%s' error: %v", r.Type, err)
+	}
+	rAdapter, err := factory(r)
+	if err != nil {
+		return nil, fmt.Errorf("generate '%s' type adapter form factory error: %v", r.Type, err)
+	}
+	return rAdapter, nil
+}
+
+// CredentialPrecedence describes which credential is used to access the registry, it's
+// included in the error messages of the authentication failures. The credential of the
+// registry takes precedence over the default one
+func CredentialPrecedence(r *model.Registry) string {
+	if adapter.UseDefaultCredential(r) {
+		return "the default credential is used as the registry has no credential configured"
+	}
+	if r.Credential == nil || (len(r.Credential.AccessKey) == 0 && len(r.Credential.AccessSecret) == 0) {
+		return "the registry is accessed anonymously as neither the registry credential nor the default credential is configured"
+	}
+	return "the credential of the registry is used, it takes precedence over the default credential"
+}
+
+// PingAll checks the health status of the registries concurrently, no more than "concurrency"
+// registries are pinged at the same time. The results are in the same order with the registries
+// and the status of the registries which aren't finished when the timeout expires is "unknown".
+// The pings still in progress are canceled when the timeout expires
+func PingAll(registries []*model.Registry, concurrency int, timeout time.Duration) []*PingResult {
+	return pingAll(registries, concurrency, timeout, CheckHealthStatusWithContext)
+}
+
+func pingAll(registries []*model.Registry, concurrency int, timeout time.Duration,
+	check func(context.Context, *model.Registry) (model.HealthStatus, error)) []*PingResult {
+	if concurrency <= 0 {
+		concurrency = BatchPingConcurrency
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results := make([]*PingResult, len(registries))
+	indexes := map[*model.Registry]int{}
+	for i, r := range registries {
+		indexes[r] = i
+	}
+
+	// the results are written by the pings and read when the timeout expires, guard them with the lock
+	lock := &sync.Mutex{}
+	done := make(chan struct{})
+	go func() {
+		checkConcurrently(registries, concurrency, func(r *model.Registry) {
+			// the registries waiting for the concurrency slot aren't pinged after the timeout
+			if ctx.Err() != nil {
+				return
+			}
+			start := time.Now()
+			status, err := check(ctx, r)
+			// the ping aborted by the timeout is reported as timed out
+			if ctx.Err() != nil {
+				return
+			}
+			result := &PingResult{
+				ID:      r.ID,
+				URL:     r.URL,
+				Status:  string(status),
+				Latency: int64(time.Since(start) / time.Millisecond),
+			}
+			if err != nil {
+				result.Error = err.Error()
+				if e, ok := err.(*common_http.Error); ok && e.IsAuthError() {
+					result.Error = fmt.Sprintf("%s, %s", result.Error, CredentialPrecedence(r))
+				}
+				result.Hint = Hint(err)
+				result.TimeoutPhase = TimeoutPhase(err)
+			}
+			lock.Lock()
+			results[indexes[r]] = result
+			lock.Unlock()
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	finished := make([]*PingResult, len(registries))
+	for i, r := range registries {
+		if results[i] != nil {
+			finished[i] = results[i]
+			continue
+		}
+		finished[i] = &PingResult{
+			ID:      r.ID,
+			URL:     r.URL,
+			Status:  model.Unknown,
+			Latency: int64(timeout / time.Millisecond),
+			Error:   "ping timed out",
+			Hint:    HintTimeout,
+		}
+	}
+	return finished
+}
@@ -0,0 +1,118 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"sync"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+)
+
+// DefaultPingCacheTTL is the time the outcomes of pinging the registries are cached for
+const DefaultPingCacheTTL = 10 * time.Second
+
+// Pings caches the outcomes of pinging the registries in the process
+var Pings = NewPingCache(DefaultPingCacheTTL)
+
+// PingOutcome is the outcome of pinging a registry, either the result or the error is set
+type PingOutcome struct {
+	Result *PingResult
+	Error  *common_http.Error
+}
+
+type pingCacheEntry struct {
+	outcome    *PingOutcome
+	expiration time.Time
+}
+
+// PingCache caches the outcomes of pinging the registries by ID for a short TTL, so the rapid
+// repeated pings, e.g. the ones sent by the UI polling the health status, are answered without
+// hammering the registries. The outcomes of the pings started before the invalidation aren't
+// cached, so the outcome of the registry before the change is never returned after it's made
+type PingCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[int64]*pingCacheEntry
+	// increased by every invalidation
+	generation uint64
+	now        func() time.Time
+}
+
+// NewPingCache returns an instance of PingCache which caches the outcomes for the TTL, the
+// default TTL is used if it's less than or equal to 0
+func NewPingCache(ttl time.Duration) *PingCache {
+	if ttl <= 0 {
+		ttl = DefaultPingCacheTTL
+	}
+	return &PingCache{
+		ttl:     ttl,
+		entries: map[int64]*pingCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the copy of the cached outcome of the registry, nil is returned if it isn't cached or
+// it's expired. The generation returned should be passed to "Put" when caching the outcome of the new ping
+func (p *PingCache) Get(id int64) (*PingOutcome, uint64) {
+	p.Lock()
+	defer p.Unlock()
+	entry := p.entries[id]
+	if entry == nil || !p.now().Before(entry.expiration) {
+		return nil, p.generation
+	}
+	outcome := &PingOutcome{}
+	if entry.outcome.Result != nil {
+		result := *entry.outcome.Result
+		result.Cached = true
+		outcome.Result = &result
+	}
+	if entry.outcome.Error != nil {
+		e := *entry.outcome.Error
+		outcome.Error = &e
+	}
+	return outcome, p.generation
+}
+
+// Put caches the outcome of the registry, it's discarded if the cache has been invalidated
+// since the generation was got as the outcome may be stale
+func (p *PingCache) Put(id int64, outcome *PingOutcome, generation uint64) {
+	p.Lock()
+	defer p.Unlock()
+	if p.generation != generation {
+		return
+	}
+	p.entries[id] = &pingCacheEntry{
+		outcome:    outcome,
+		expiration: p.now().Add(p.ttl),
+	}
+}
+
+// Invalidate removes the cached outcome of the registry, it should be called when the registry is
+// updated or removed
+func (p *PingCache) Invalidate(id int64) {
+	p.Lock()
+	defer p.Unlock()
+	p.generation++
+	delete(p.entries, id)
+}
+
+// Clear removes all the cached outcomes
+func (p *PingCache) Clear() {
+	p.Lock()
+	defer p.Unlock()
+	p.generation++
+	p.entries = map[int64]*pingCacheEntry{}
+}
@@ -0,0 +1,85 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingCache(t *testing.T) {
+	now := time.Now()
+	cache := NewPingCache(10 * time.Second)
+	cache.now = func() time.Time { return now }
+
+	outcome, generation := cache.Get(1)
+	assert.Nil(t, outcome)
+	cache.Put(1, &PingOutcome{
+		Result: &PingResult{ID: 1, Status: model.Healthy},
+	}, generation)
+
+	// the second immediate ping gets the cached result
+	outcome, _ = cache.Get(1)
+	require.NotNil(t, outcome)
+	require.NotNil(t, outcome.Result)
+	assert.Equal(t, int64(1), outcome.Result.ID)
+	assert.True(t, outcome.Result.Cached)
+	// the cached result isn't modified by the callers
+	outcome.Result.Status = model.Unhealthy
+	outcome, _ = cache.Get(1)
+	assert.Equal(t, model.Healthy, outcome.Result.Status)
+
+	// expired
+	now = now.Add(10 * time.Second)
+	outcome, _ = cache.Get(1)
+	assert.Nil(t, outcome)
+
+	// the errors are cached as well
+	outcome, generation = cache.Get(2)
+	assert.Nil(t, outcome)
+	cache.Put(2, &PingOutcome{
+		Error: &common_http.Error{Code: http.StatusBadRequest, Message: "unhealthy"},
+	}, generation)
+	outcome, _ = cache.Get(2)
+	require.NotNil(t, outcome)
+	require.NotNil(t, outcome.Error)
+	assert.Equal(t, http.StatusBadRequest, outcome.Error.Code)
+	assert.Nil(t, outcome.Result)
+
+	// invalidated
+	cache.Invalidate(2)
+	outcome, _ = cache.Get(2)
+	assert.Nil(t, outcome)
+
+	// the outcome of the ping started before the invalidation isn't cached
+	_, generation = cache.Get(3)
+	cache.Invalidate(4)
+	cache.Put(3, &PingOutcome{Result: &PingResult{ID: 3}}, generation)
+	outcome, _ = cache.Get(3)
+	assert.Nil(t, outcome)
+
+	// cleared
+	_, generation = cache.Get(3)
+	cache.Put(3, &PingOutcome{Result: &PingResult{ID: 3}}, generation)
+	cache.Clear()
+	outcome, _ = cache.Get(3)
+	assert.Nil(t, outcome)
+}
@@ -0,0 +1,186 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	common_http "github.com/goharbor/harbor/src/common/http"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/adapter"
+	"github.com/goharbor/harbor/src/replication/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingAll(t *testing.T) {
+	registries := []*model.Registry{
+		{ID: 1, URL: "https://reachable.example.com"},
+		{URL: "https://unreachable.example.com"},
+		{ID: 3, URL: "https://slow.example.com"},
+		{URL: "https://unhealthy.example.com"},
+	}
+	canceled := make(chan struct{})
+	check := func(ctx context.Context, r *model.Registry) (model.HealthStatus, error) {
+		switch r.URL {
+		case "https://reachable.example.com":
+			return model.Healthy, nil
+		case "https://unreachable.example.com":
+			return model.Unhealthy, syscall.ECONNREFUSED
+		case "https://slow.example.com":
+			<-ctx.Done()
+			close(canceled)
+			return model.Unknown, ctx.Err()
+		}
+		return model.Unhealthy, nil
+	}
+
+	results := pingAll(registries, 2, 100*time.Millisecond, check)
+	require.Equal(t, 4, len(results))
+
+	assert.Equal(t, int64(1), results[0].ID)
+	assert.Equal(t, "https://reachable.example.com", results[0].URL)
+	assert.Equal(t, model.Healthy, results[0].Status)
+	assert.Empty(t, results[0].Error)
+
+	assert.Equal(t, "https://unreachable.example.com", results[1].URL)
+	assert.Equal(t, model.Unhealthy, results[1].Status)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Equal(t, HintConnectionRefused, results[1].Hint)
+
+	// the slow one isn't finished before the timeout
+	assert.Equal(t, int64(3), results[2].ID)
+	assert.Equal(t, model.Unknown, results[2].Status)
+	assert.Equal(t, HintTimeout, results[2].Hint)
+	// and it's canceled when the timeout expires
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("the slow ping isn't canceled")
+	}
+
+	assert.Equal(t, model.Unhealthy, results[3].Status)
+	assert.Empty(t, results[3].Error)
+}
+
+func TestPingAllConcurrency(t *testing.T) {
+	registries := []*model.Registry{}
+	for i := 0; i < 10; i++ {
+		registries = append(registries, &model.Registry{ID: int64(i + 1)})
+	}
+	var current, peak int32
+	check := func(ctx context.Context, r *model.Registry) (model.HealthStatus, error) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		if r.ID%2 == 0 {
+			return model.Unhealthy, errors.New("error")
+		}
+		return model.Healthy, nil
+	}
+
+	results := pingAll(registries, 3, time.Minute, check)
+	assert.Equal(t, int32(3), peak)
+	for i, result := range results {
+		assert.Equal(t, registries[i].ID, result.ID)
+		if result.ID%2 == 0 {
+			assert.Equal(t, model.Unhealthy, result.Status)
+		} else {
+			assert.Equal(t, model.Healthy, result.Status)
+		}
+	}
+}
+
+func TestClockSkewExceeded(t *testing.T) {
+	assert.False(t, ClockSkewExceeded(0))
+	assert.False(t, ClockSkewExceeded(MaxClockSkew))
+	assert.False(t, ClockSkewExceeded(-MaxClockSkew))
+	assert.True(t, ClockSkewExceeded(MaxClockSkew+time.Second))
+	assert.True(t, ClockSkewExceeded(-MaxClockSkew-time.Second))
+}
+
+func TestCredentialPrecedence(t *testing.T) {
+	anonymous := &model.Registry{}
+	overridden := &model.Registry{
+		Credential: &model.Credential{
+			AccessKey:    "admin",
+			AccessSecret: "Harbor12345",
+		},
+	}
+
+	adapter.SetDefaultCredential("", "")
+	assert.Contains(t, CredentialPrecedence(anonymous), "anonymously")
+	assert.Contains(t, CredentialPrecedence(overridden), "credential of the registry")
+
+	adapter.SetDefaultCredential("robot", "password")
+	defer adapter.SetDefaultCredential("", "")
+	assert.Contains(t, CredentialPrecedence(anonymous), "default credential is used")
+	assert.Contains(t, CredentialPrecedence(overridden), "credential of the registry")
+
+	// the precedence is included in the error of the authentication failure
+	check := func(ctx context.Context, r *model.Registry) (model.HealthStatus, error) {
+		return model.Unhealthy, &common_http.Error{Code: http.StatusUnauthorized}
+	}
+	results := pingAll([]*model.Registry{anonymous}, 1, time.Second, check)
+	require.Equal(t, 1, len(results))
+	assert.Contains(t, results[0].Error, "default credential is used")
+	assert.Equal(t, HintAuth, results[0].Hint)
+}
+
+func TestCheckTunnel(t *testing.T) {
+	// nothing is checked if the registry has no tunnel
+	assert.Nil(t, CheckTunnelWithContext(context.Background(), &model.Registry{URL: "https://registry.isolated"}))
+
+	// the jump host isn't reachable
+	err := CheckTunnelWithContext(context.Background(), &model.Registry{
+		URL: "https://registry.isolated",
+		SSHTunnel: &registry_pkg.SSHTunnel{
+			Host:       "127.0.0.1:1",
+			User:       "harbor",
+			PrivateKey: testPrivateKey,
+			HostKey:    testHostKey,
+		},
+	})
+	assert.NotNil(t, err)
+
+	cases := []struct {
+		url     string
+		address string
+	}{
+		{"https://registry.isolated", "registry.isolated:443"},
+		{"http://registry.isolated", "registry.isolated:80"},
+		{"https://registry.isolated:5000/", "registry.isolated:5000"},
+		{"https://[fd00::1]", "[fd00::1]:443"},
+	}
+	for _, c := range cases {
+		address, err := tunnelTarget(c.url)
+		require.Nil(t, err)
+		assert.Equal(t, c.address, address)
+	}
+	_, err = tunnelTarget("registry.isolated")
+	assert.NotNil(t, err)
+}
@@ -15,17 +15,19 @@
 package replication
 
 import (
-	"time"
-
 	"github.com/goharbor/harbor/src/common/job"
 	"github.com/goharbor/harbor/src/common/utils/log"
 	cfg "github.com/goharbor/harbor/src/core/config"
+	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/config"
 	"github.com/goharbor/harbor/src/replication/event"
+	"github.com/goharbor/harbor/src/replication/exclusion"
 	"github.com/goharbor/harbor/src/replication/operation"
+	"github.com/goharbor/harbor/src/replication/operation/flow"
 	"github.com/goharbor/harbor/src/replication/policy"
 	"github.com/goharbor/harbor/src/replication/policy/controller"
 	"github.com/goharbor/harbor/src/replication/registry"
+	"github.com/goharbor/harbor/src/replication/util"
 
 	// register the Harbor adapter
 	_ "github.com/goharbor/harbor/src/replication/adapter/harbor"
@@ -46,6 +48,8 @@ var (
 	OperationCtl operation.Controller
 	// EventHandler handles images/chart pull/push events
 	EventHandler event.Handler
+	// ExclusionMgr is a global manager of the repositories excluded from replication
+	ExclusionMgr exclusion.Manager
 )
 
 // Init the global variables and configurations
@@ -55,20 +59,50 @@ func Init(closing chan struct{}) error {
 	if err != nil {
 		return err
 	}
+	extEndpoint, err := cfg.ExtEndpoint()
+	if err != nil {
+		return err
+	}
+	secretKeys, err := cfg.GetReplicationSecretKeys()
+	if err != nil {
+		return err
+	}
+	// fail fast rather than failing to encrypt or decrypt the secrets of the registries later
+	secretKeyVersion := cfg.GetReplicationSecretKeyVersion()
+	if err = registry.ValidateSecretKeys(secretKeys, secretKeyVersion); err != nil {
+		return err
+	}
 	config.Config = &config.Configuration{
+		ExtEndpoint:      extEndpoint,
 		CoreURL:          cfg.InternalCoreURL(),
 		TokenServiceURL:  cfg.InternalTokenServiceEndpoint(),
 		JobserviceURL:    cfg.InternalJobServiceURL(),
 		SecretKey:        secretKey,
+		SecretKeys:       secretKeys,
+		SecretKeyVersion: secretKeyVersion,
 		CoreSecret:       cfg.CoreSecret(),
 		JobserviceSecret: cfg.JobserviceSecret(),
 	}
+	// set the timeouts of the transports used to access the registries
+	util.SetTransportTimeouts(cfg.GetRegistryDialTimeout(), cfg.GetRegistryTLSHandshakeTimeout())
+	// set the resolver of the transports, so the registries are pinged in the same way as the jobs access them
+	if err := util.SetResolver(cfg.GetRegistryNameserver(), cfg.GetRegistryHosts()); err != nil {
+		log.Errorf("failed to set the resolver of the registries, the system resolver is used: %v", err)
+	}
+	// set the max size of the manifests pulled from the registries
+	util.SetMaxManifestSize(cfg.GetRegistryMaxManifestSize())
+	// set the credential used to access the registries which have no credential configured
+	adapter.SetDefaultCredential(cfg.GetRegistryDefaultCredential())
 	// TODO use a global http transport
 	js := job.NewDefaultClient(config.Config.JobserviceURL, config.Config.CoreSecret)
-	// init registry manager
-	RegistryMgr = registry.NewDefaultManager()
+	// init registry manager, the registries got by ID and name are cached for a short TTL as they
+	// may be updated by the other instances in HA mode
+	RegistryMgr = registry.NewCachedManager(registry.NewDefaultManager(), registry.DefaultCacheTTL)
 	// init policy controller
 	PolicyCtl = controller.NewController(js)
+	// init exclusion manager, the repositories matching the exclusions are skipped by all the policies
+	ExclusionMgr = exclusion.NewDefaultManager()
+	flow.SetExclusionManager(ExclusionMgr)
 	// init operation controller
 	OperationCtl = operation.NewController(js)
 	// init event handler
@@ -76,6 +110,6 @@ func Init(closing chan struct{}) error {
 	log.Debug("the replication initialization completed")
 
 	// Start health checker for registries
-	go registry.NewHealthChecker(time.Minute*5, closing).Run()
+	go registry.NewHealthChecker(cfg.GetRegistryHealthCheckInterval(), cfg.GetRegistryHealthCheckConcurrency(), closing).Run()
 	return nil
 }
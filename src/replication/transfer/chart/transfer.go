@@ -16,6 +16,7 @@ package chart
 
 import (
 	"errors"
+	"time"
 
 	"github.com/goharbor/harbor/src/common/utils/log"
 	"github.com/goharbor/harbor/src/replication/adapter"
@@ -46,6 +47,13 @@ type transfer struct {
 	isStopped trans.StopFunc
 	src       adapter.ChartRegistry
 	dst       adapter.ChartRegistry
+	// the endpoints of the source and destination registries selected from their URLs and failover URLs
+	srcEndpoint string
+	dstEndpoint string
+}
+
+func (t *transfer) Endpoints() (string, string) {
+	return t.srcEndpoint, t.dstEndpoint
 }
 
 func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
@@ -56,10 +64,14 @@ func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
 
 	// delete the chart on destination registry
 	if dst.Deleted {
-		return t.delete(&chart{
+		chart := &chart{
 			name:    dst.Metadata.GetResourceName(),
 			version: dst.Metadata.Vtags[0],
-		})
+		}
+		start := time.Now()
+		err := t.delete(chart)
+		trans.LogStep(t.logger, trans.StepPhaseDelete, chart.name, chart.version, start, err)
+		return skipped(err)
 	}
 
 	srcChart := &chart{
@@ -71,32 +83,47 @@ func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
 		version: dst.Metadata.Vtags[0],
 	}
 	// copy the chart from source registry to the destination
-	return t.copy(srcChart, dstChart, dst.Override)
+	start := time.Now()
+	err := t.copy(srcChart, dstChart, dst.Override)
+	trans.LogStep(t.logger, trans.StepPhaseCopy, srcChart.name, srcChart.version, start, err)
+	return skipped(err)
+}
+
+// the skipped step is recorded in the structured log and doesn't fail the transfer
+func skipped(err error) error {
+	if _, ok := err.(*trans.SkippedError); ok {
+		return nil
+	}
+	return err
 }
 
 func (t *transfer) initialize(src, dst *model.Resource) error {
 	if t.shouldStop() {
 		return nil
 	}
-	// create client for source registry
-	srcReg, err := createRegistry(src.Registry)
+	// create client for source registry, the first healthy endpoint is used if the registry has failover URLs
+	srcRegistry := adapter.SelectEndpoint(src.Registry)
+	srcReg, err := createRegistry(srcRegistry)
 	if err != nil {
 		t.logger.Errorf("failed to create client for source registry: %v", err)
 		return err
 	}
 	t.src = srcReg
+	t.srcEndpoint = srcRegistry.URL
 	t.logger.Infof("client for source registry [type: %s, URL: %s, insecure: %v] created",
-		src.Registry.Type, src.Registry.URL, src.Registry.Insecure)
+		srcRegistry.Type, srcRegistry.URL, srcRegistry.Insecure)
 
 	// create client for destination registry
-	dstReg, err := createRegistry(dst.Registry)
+	dstRegistry := adapter.SelectEndpoint(dst.Registry)
+	dstReg, err := createRegistry(dstRegistry)
 	if err != nil {
 		t.logger.Errorf("failed to create client for destination registry: %v", err)
 		return err
 	}
 	t.dst = dstReg
+	t.dstEndpoint = dstRegistry.URL
 	t.logger.Infof("client for destination registry [type: %s, URL: %s, insecure: %v] created",
-		dst.Registry.Type, dst.Registry.URL, dst.Registry.Insecure)
+		dstRegistry.Type, dstRegistry.URL, dstRegistry.Insecure)
 
 	return nil
 }
@@ -143,7 +170,7 @@ func (t *transfer) copy(src, dst *chart, override bool) error {
 		if !override {
 			t.logger.Warningf("the same name chart %s:%s exists on the destination registry, but the \"override\" is set to false, skip",
 				dst.name, dst.version)
-			return nil
+			return &trans.SkippedError{Reason: "the same name chart exists on the destination registry and the override is disabled"}
 		}
 		// the same name chart exists, but allowed to override
 		t.logger.Warningf("the same name chart %s:%s exists on the destination registry and the \"override\" is set to true, continue...",
@@ -178,7 +205,7 @@ func (t *transfer) delete(chart *chart) error {
 	if !exist {
 		t.logger.Infof("the chart %s:%s doesn't exist on the destination registry, skip",
 			chart.name, chart.version)
-		return nil
+		return &trans.SkippedError{Reason: "the chart doesn't exist on the destination registry"}
 	}
 
 	t.logger.Infof("deleting the chart %s:%s on the destination registry...", chart.name, chart.version)
@@ -98,6 +98,12 @@ func TestCopy(t *testing.T) {
 	}
 	err := transfer.copy(src, dst, true)
 	assert.Nil(t, err)
+
+	// the chart exists and the override is disabled
+	err = transfer.copy(src, dst, false)
+	require.NotNil(t, err)
+	_, skipped := err.(*trans.SkippedError)
+	assert.True(t, skipped)
 }
 
 func TestDelete(t *testing.T) {
@@ -0,0 +1,193 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// the max count of the blobs whose existence is checked on the destination registry at the same time
+const blobCheckConcurrency = 5
+
+// isBlob returns whether the content of the manifest is a layer or an image config which
+// is pushed to the destination registry, the manifests and the foreign layers aren't
+func isBlob(mediaType string) bool {
+	switch mediaType {
+	case schema2.MediaTypeLayer, schema2.MediaTypeUncompressedLayer, schema2.MediaTypeImageConfig,
+		v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageConfig:
+		return true
+	}
+	return false
+}
+
+// checkBlobs checks the existence of the blobs on the destination repository before any of them is
+// uploaded, the checks are sent concurrently but no more than blobCheckConcurrency at the same time.
+// The results are cached for the rest of the transfer, the blobs which fail to be checked aren't
+// cached and are checked again when they're copied
+func (t *transfer) checkBlobs(repository string, blobs []distribution.Descriptor) {
+	if t.shouldStop() {
+		return
+	}
+	digests := []string{}
+	seen := map[string]bool{}
+	for _, blob := range blobs {
+		digest := blob.Digest.String()
+		if !isBlob(blob.MediaType) || seen[digest] {
+			continue
+		}
+		seen[digest] = true
+		if _, exist := t.existingBlobs[blobKey(repository, digest)]; !exist {
+			digests = append(digests, digest)
+		}
+	}
+	if len(digests) == 0 {
+		return
+	}
+
+	exists := make([]bool, len(digests))
+	errs := make([]error, len(digests))
+	sem := make(chan struct{}, blobCheckConcurrency)
+	wg := &sync.WaitGroup{}
+	for i, digest := range digests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, digest string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			exists[i], errs[i] = t.dst.BlobExist(repository, digest)
+		}(i, digest)
+	}
+	wg.Wait()
+
+	for i, digest := range digests {
+		if errs[i] != nil {
+			t.logger.Warningf("failed to check the existence of blob %s on the destination registry: %v", digest, errs[i])
+			continue
+		}
+		t.cacheBlobExistence(repository, digest, exists[i])
+	}
+}
+
+// blobExist returns whether the blob exists on the destination repository, the cached result is
+// returned if the blob has been checked, otherwise the destination registry is requested
+func (t *transfer) blobExist(repository, digest string) (bool, error) {
+	if exist, ok := t.existingBlobs[blobKey(repository, digest)]; ok {
+		return exist, nil
+	}
+	exist, err := t.dst.BlobExist(repository, digest)
+	if err != nil {
+		return false, err
+	}
+	t.cacheBlobExistence(repository, digest, exist)
+	return exist, nil
+}
+
+func (t *transfer) cacheBlobExistence(repository, digest string, exist bool) {
+	if t.existingBlobs == nil {
+		t.existingBlobs = map[string]bool{}
+	}
+	t.existingBlobs[blobKey(repository, digest)] = exist
+}
+
+// expectBlobs records the size of the blobs missing on the destination repository in the meter, so the
+// ETA of the transfer can be estimated. The blobs whose existence is unknown aren't expected
+func (t *transfer) expectBlobs(repository string, blobs []distribution.Descriptor) {
+	for _, blob := range blobs {
+		key := blobKey(repository, blob.Digest.String())
+		if !isBlob(blob.MediaType) || t.expectedBlobs[key] {
+			continue
+		}
+		if exist, ok := t.existingBlobs[key]; !ok || exist {
+			continue
+		}
+		if t.expectedBlobs == nil {
+			t.expectedBlobs = map[string]bool{}
+		}
+		t.expectedBlobs[key] = true
+		t.meter.Expect(blob.Size)
+	}
+}
+
+// withdrawBlob withdraws the size of the expected blob which is mounted rather than pushed
+func (t *transfer) withdrawBlob(repository, digest string, size int64) {
+	key := blobKey(repository, digest)
+	if !t.expectedBlobs[key] {
+		return
+	}
+	delete(t.expectedBlobs, key)
+	t.meter.Expect(-size)
+}
+
+func blobKey(repository, digest string) string {
+	return repository + "@" + digest
+}
+
+// digestVerifyingReader calculates the digest of the blob while it's streamed to the destination registry
+// and compares it with the expected one. Once the content read doesn't match the expected digest or size,
+// the last bytes are withheld and the error is returned instead, so the upload is aborted before the
+// destination registry receives the complete blob and the corrupted content is never pushed
+type digestVerifyingReader struct {
+	reader   io.Reader
+	digest   godigest.Digest
+	digester godigest.Digester
+	// the expected size, it's unknown if it's less than or equal to 0
+	size int64
+	read int64
+}
+
+// newDigestVerifyingReader returns a reader verifying the content read from the reader against the digest
+// and size, the error is returned if the digest is invalid or its algorithm isn't supported
+func newDigestVerifyingReader(reader io.Reader, digest string, size int64) (io.Reader, error) {
+	d, err := godigest.Parse(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %s: %v", digest, err)
+	}
+	return &digestVerifyingReader{
+		reader:   reader,
+		digest:   d,
+		digester: d.Algorithm().Digester(),
+		size:     size,
+	}, nil
+}
+
+func (d *digestVerifyingReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	d.read += int64(n)
+	if d.size > 0 && d.read > d.size {
+		return 0, fmt.Errorf("the blob %s is larger than its size %d, the upload is aborted", d.digest, d.size)
+	}
+	d.digester.Hash().Write(p[:n])
+	// the content is complete once the expected size is read, as the HTTP client stops reading
+	// the request body when the length is reached rather than reading until the EOF
+	if err == io.EOF || (d.size > 0 && d.read == d.size) {
+		if err == io.EOF && d.size > 0 && d.read < d.size {
+			return 0, fmt.Errorf("the blob %s is smaller than its size %d, the upload is aborted", d.digest, d.size)
+		}
+		if digest := d.digester.Digest(); digest != d.digest {
+			return 0, fmt.Errorf("the digest %s of the blob streamed doesn't match the expected digest %s, the upload is aborted",
+				digest, d.digest)
+		}
+	}
+	return n, err
+}
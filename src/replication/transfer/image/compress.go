@@ -0,0 +1,247 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// the mapping between the media types of the uncompressed layers and the gzip compressed ones
+var compressedMediaTypes = map[string]string{
+	schema2.MediaTypeUncompressedLayer: schema2.MediaTypeLayer,
+	v1.MediaTypeImageLayer:             v1.MediaTypeImageLayerGzip,
+}
+
+// copy the contents of the manifest with the uncompressed layers compressed by gzip. As the
+// digests of the compressed layers differ from the original ones, the manifest referring to
+// them is returned and the returned bool indicates whether the manifest is changed
+func (t *transfer) copyCompressedContents(manifest distribution.Manifest, srcRepo, dstRepo string) (
+	distribution.Manifest, bool, error) {
+	config, layers, ok := configAndLayers(manifest)
+	if !ok {
+		// the layers of docker schema1 manifest are always compressed
+		for _, content := range manifest.References() {
+			if err := t.copyContent(content, srcRepo, dstRepo); err != nil {
+				return nil, false, err
+			}
+		}
+		return manifest, false, nil
+	}
+
+	if err := t.copyContent(config, srcRepo, dstRepo); err != nil {
+		return nil, false, err
+	}
+	compressed := false
+	newLayers := make([]distribution.Descriptor, len(layers))
+	for i, layer := range layers {
+		if _, exist := compressedMediaTypes[layer.MediaType]; !exist {
+			if err := t.copyContent(layer, srcRepo, dstRepo); err != nil {
+				return nil, false, err
+			}
+			newLayers[i] = layer
+			continue
+		}
+		newLayer, err := t.compressBlob(srcRepo, dstRepo, layer)
+		if err != nil {
+			return nil, false, err
+		}
+		newLayers[i] = newLayer
+		compressed = true
+	}
+	if !compressed {
+		return manifest, false, nil
+	}
+
+	newManifest, err := replaceLayers(manifest, newLayers)
+	if err != nil {
+		t.logger.Errorf("failed to build the manifest referring to the compressed layers: %v", err)
+		return nil, false, err
+	}
+	return newManifest, true, nil
+}
+
+// compress the uncompressed layer pulled from the source registry by gzip and push it
+// to the destination registry, the descriptor of the compressed layer is returned
+func (t *transfer) compressBlob(srcRepo, dstRepo string, layer distribution.Descriptor) (distribution.Descriptor, error) {
+	digest := layer.Digest.String()
+	if t.shouldStop() {
+		return layer, nil
+	}
+	t.logger.Infof("compressing the layer %s...", digest)
+	_, data, err := t.src.PullBlob(srcRepo, digest)
+	if err != nil {
+		t.logger.Errorf("failed to pulling the blob %s: %v", digest, err)
+		return layer, err
+	}
+	defer data.Close()
+
+	// the compressed content is buffered in a temporary file as its
+	// digest and size must be known before pushing it
+	file, err := ioutil.TempFile("", "layer")
+	if err != nil {
+		t.logger.Errorf("failed to create the temporary file for compressing the layer %s: %v", digest, err)
+		return layer, err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	verifier := layer.Digest.Verifier()
+	digester := godigest.Canonical.Digester()
+	writer := gzip.NewWriter(io.MultiWriter(file, digester.Hash()))
+	if _, err = io.Copy(writer, io.TeeReader(data, verifier)); err != nil {
+		t.logger.Errorf("failed to compress the layer %s: %v", digest, err)
+		return layer, err
+	}
+	if err = writer.Close(); err != nil {
+		t.logger.Errorf("failed to compress the layer %s: %v", digest, err)
+		return layer, err
+	}
+	// make sure the layer isn't corrupted before replacing its digest
+	if !verifier.Verified() {
+		err = fmt.Errorf("the content of the layer %s doesn't match its digest", digest)
+		t.logger.Error(err.Error())
+		return layer, err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.logger.Errorf("failed to get the size of the compressed layer %s: %v", digest, err)
+		return layer, err
+	}
+	compressed := distribution.Descriptor{
+		MediaType:   compressedMediaTypes[layer.MediaType],
+		Size:        size,
+		Digest:      digester.Digest(),
+		URLs:        layer.URLs,
+		Annotations: layer.Annotations,
+	}
+	newDigest := compressed.Digest.String()
+
+	exist, err := t.blobExist(dstRepo, newDigest)
+	if err != nil {
+		t.logger.Errorf("failed to check the existence of blob %s on the destination registry: %v", newDigest, err)
+		return layer, err
+	}
+	if exist {
+		t.logger.Infof("the layer %s compressed to %s already exists on the destination registry, skip", digest, newDigest)
+		t.account(srcRepo, newDigest, size, true)
+		return compressed, nil
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		t.logger.Errorf("failed to read the compressed layer %s: %v", digest, err)
+		return layer, err
+	}
+	if err = t.dst.PushBlob(dstRepo, newDigest, size, t.meter.Reader(file)); err != nil {
+		t.logger.Errorf("failed to pushing the blob %s: %v", newDigest, err)
+		return layer, err
+	}
+	t.cacheBlobExistence(dstRepo, newDigest, true)
+	t.account(srcRepo, newDigest, size, false)
+	t.logger.Infof("the layer %s is compressed to %s(%d bytes -> %d bytes)", digest, newDigest, layer.Size, size)
+	return compressed, nil
+}
+
+// returns the descriptors of the config and layers of the docker schema2 or OCI image manifest,
+// the returned bool is false for the other kinds of manifests
+func configAndLayers(manifest distribution.Manifest) (distribution.Descriptor, []distribution.Descriptor, bool) {
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+		return m.Config, m.Layers, true
+	case *registry_pkg.OCIManifest:
+		references := m.References()
+		return references[0], references[1:], true
+	}
+	return distribution.Descriptor{}, nil, false
+}
+
+// build the manifest with the layers replaced, the other fields are kept as they are
+func replaceLayers(manifest distribution.Manifest, layers []distribution.Descriptor) (distribution.Manifest, error) {
+	switch m := manifest.(type) {
+	case *schema2.DeserializedManifest:
+		mfst := m.Manifest
+		mfst.Layers = layers
+		return schema2.FromStruct(mfst)
+	case *registry_pkg.OCIManifest:
+		mfst := m.Manifest
+		mfst.Layers = make([]v1.Descriptor, len(layers))
+		for i, layer := range layers {
+			l := m.Layers[i]
+			l.MediaType = layer.MediaType
+			l.Digest = layer.Digest
+			l.Size = layer.Size
+			mfst.Layers[i] = l
+		}
+		data, err := json.Marshal(struct {
+			v1.Manifest
+			MediaType string `json:"mediaType"`
+		}{
+			Manifest:  mfst,
+			MediaType: v1.MediaTypeImageManifest,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ociManifest := &registry_pkg.OCIManifest{}
+		if err = ociManifest.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		return ociManifest, nil
+	}
+	return nil, fmt.Errorf("unsupported manifest type %T", manifest)
+}
+
+// returns whether the image on the destination registry is the one copied from the source
+// manifest with the uncompressed layers compressed: the config is the same and every layer
+// is either the same or the compressed one of the source layer
+func (t *transfer) isCompressedCopy(manifest distribution.Manifest, dstRepo, dstRef string) bool {
+	srcConfig, srcLayers, ok := configAndLayers(manifest)
+	if !ok {
+		return false
+	}
+	dstManifest, _, err := t.dst.PullManifest(dstRepo, dstRef, []string{
+		schema2.MediaTypeManifest,
+		v1.MediaTypeImageManifest,
+	})
+	if err != nil {
+		t.logger.Warningf("failed to pull the manifest of image %s:%s from the destination registry: %v", dstRepo, dstRef, err)
+		return false
+	}
+	dstConfig, dstLayers, ok := configAndLayers(dstManifest)
+	if !ok || srcConfig.Digest != dstConfig.Digest || len(srcLayers) != len(dstLayers) {
+		return false
+	}
+	for i := range srcLayers {
+		if srcLayers[i].Digest == dstLayers[i].Digest {
+			continue
+		}
+		mediaType, exist := compressedMediaTypes[srcLayers[i].MediaType]
+		if !exist || mediaType != dstLayers[i].MediaType {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	trans "github.com/goharbor/harbor/src/replication/transfer"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// isLayer returns whether the content of the manifest is a layer, the image configs
+// and the manifests contained by the manifest list aren't
+func isLayer(mediaType string) bool {
+	switch mediaType {
+	case "", schema2.MediaTypeImageConfig, v1.MediaTypeImageConfig,
+		schema2.MediaTypeManifest, v1.MediaTypeImageManifest:
+		return false
+	}
+	return true
+}
+
+// check the media types of the layers against the ones allowed by the destination registry, the
+// "SkippedError" is returned if the image contains the disallowed layers unless the action is "fail"
+func (t *transfer) checkLayerMediaTypes(manifest distribution.Manifest, repository, reference string) error {
+	if t.layerMediaTypes == nil {
+		return nil
+	}
+	mediaTypes := []string{}
+	for _, content := range manifest.References() {
+		if isLayer(content.MediaType) {
+			mediaTypes = append(mediaTypes, content.MediaType)
+		}
+	}
+	disallowed := t.layerMediaTypes.Disallowed(mediaTypes...)
+	if len(disallowed) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("the image %s:%s contains the layers of the media types [%s] which aren't allowed by the destination registry",
+		repository, reference, strings.Join(disallowed, ","))
+	if t.layerMediaTypes.Fail() {
+		t.logger.Error(msg)
+		return errors.New(msg)
+	}
+	return &trans.SkippedError{Reason: msg + ", skip"}
+}
@@ -15,19 +15,30 @@
 package image
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution/manifest/manifestlist"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
+	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils/log"
+	registry_pkg "github.com/goharbor/harbor/src/common/utils/registry"
 	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/model"
 	trans "github.com/goharbor/harbor/src/replication/transfer"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func init() {
@@ -43,16 +54,94 @@ type repository struct {
 
 func factory(logger trans.Logger, stopFunc trans.StopFunc) (trans.Transfer, error) {
 	return &transfer{
-		logger:    logger,
-		isStopped: stopFunc,
+		logger:      logger,
+		isStopped:   stopFunc,
+		meter:       trans.NewMeter(),
+		verifyBlobs: true,
 	}, nil
 }
 
 type transfer struct {
-	logger    trans.Logger
-	isStopped trans.StopFunc
-	src       adapter.ImageRegistry
-	dst       adapter.ImageRegistry
+	logger             trans.Logger
+	isStopped          trans.StopFunc
+	src                adapter.ImageRegistry
+	dst                adapter.ImageRegistry
+	replicateReferrers bool
+	// the count of referrers transferred
+	referrers int
+	// the distinct media types of the manifests of the images on the destination registry
+	mediaTypes []string
+	// the endpoints of the source and destination registries selected from their URLs and failover URLs
+	srcEndpoint string
+	dstEndpoint string
+	// the repositories on the destination registry which the blobs can be mounted from
+	blobSources map[string]string
+	// compress the uncompressed layers by gzip when pushing them to the destination registry
+	compressLayers bool
+	// mount the blobs from the source repository on the destination registry
+	mountBlobs bool
+	// the capabilities of the destination registry keyed by the namespace, they're probed when they're
+	// needed at the first time
+	dstCapabilities map[string]map[string]string
+	// only check the blobs and validate the manifests without pushing anything to the destination registry
+	dryRun bool
+	// the blobs which would be transferred in the dry run
+	pendingBlobs []string
+	// measure the speed of the blobs pushed to the destination registry
+	meter *trans.Meter
+	// the blobs whose size is expected to be pushed, keyed by the repository and digest
+	expectedBlobs map[string]bool
+	// the manifest type which the destination registry prefers, "docker" or "oci"
+	preferredManifestType string
+	// the storage available on the destination registry, it's queried when it's needed
+	// at the first time and -1 means the info isn't available
+	availableStorage *int64
+	// whether the blobs exist on the destination registry, keyed by the repository and digest
+	existingBlobs map[string]bool
+	// the media types of the layers which the destination registry allows
+	layerMediaTypes *model.LayerMediaTypes
+	// the blobs of the repository uploaded to the destination registry and skipped
+	bytes trans.ByteAccounting
+	// log the structured log of every blob uploaded or skipped
+	blobAccounting bool
+	// verify the digests of the blobs while streaming them to the destination registry, it's always
+	// enabled by the factory
+	verifyBlobs bool
+}
+
+// Speed returns the speed of the blobs pushed to the destination registry
+func (t *transfer) Speed() *trans.Speed {
+	return t.meter.Speed()
+}
+
+// Progress returns the progress of the blobs pushed to the destination registry
+func (t *transfer) Progress() *trans.Progress {
+	return t.meter.Progress()
+}
+
+// Referrers returns the count of the referrers transferred
+func (t *transfer) Referrers() int {
+	return t.referrers
+}
+
+// Endpoints returns the URLs of the source and destination registries
+func (t *transfer) Endpoints() (string, string) {
+	return t.srcEndpoint, t.dstEndpoint
+}
+
+// MediaTypes returns the media types of the manifests of the images on the destination registry
+func (t *transfer) MediaTypes() []string {
+	return t.mediaTypes
+}
+
+// record the media type of the manifest of the image on the destination registry
+func (t *transfer) recordMediaType(mediaType string) {
+	for _, m := range t.mediaTypes {
+		if m == mediaType {
+			return
+		}
+	}
+	t.mediaTypes = append(t.mediaTypes, mediaType)
 }
 
 func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
@@ -61,6 +150,7 @@ func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
 		return err
 	}
 
+	t.dryRun = dst.DryRun
 	// delete the repository on destination registry
 	if dst.Deleted {
 		return t.delete(&repository{
@@ -77,37 +167,190 @@ func (t *transfer) Transfer(src *model.Resource, dst *model.Resource) error {
 		repository: dst.Metadata.GetResourceName(),
 		tags:       dst.Metadata.Vtags,
 	}
+	t.replicateReferrers = dst.ReplicateReferrers
+	t.blobSources = dst.BlobSources
+	t.compressLayers = dst.CompressLayers
+	t.mountBlobs = dst.MountBlobs
+	t.blobAccounting = dst.BlobAccounting
+	if dst.Registry != nil {
+		t.preferredManifestType = dst.Registry.PreferredManifestType
+		t.layerMediaTypes = dst.Registry.LayerMediaTypes
+	}
 	// copy the repository from source registry to the destination
-	return t.copy(srcRepo, dstRepo, dst.Override)
+	if err := t.copy(srcRepo, dstRepo, dst.Override); err != nil {
+		return err
+	}
+	t.makeTagsImmutable(srcRepo, dstRepo, src.Metadata.ImmutableTags)
+	return nil
 }
 
 func (t *transfer) initialize(src *model.Resource, dst *model.Resource) error {
 	if t.shouldStop() {
 		return nil
 	}
-	// create client for source registry
-	srcReg, err := createRegistry(src.Registry)
+	// create client for source registry, the first healthy endpoint is used if the registry has failover URLs
+	srcRegistry := adapter.SelectEndpoint(src.Registry)
+	srcReg, err := createRegistry(srcRegistry)
 	if err != nil {
 		t.logger.Errorf("failed to create client for source registry: %v", err)
 		return err
 	}
 	t.src = srcReg
+	t.srcEndpoint = srcRegistry.URL
 	t.logger.Infof("client for source registry [type: %s, URL: %s, insecure: %v] created",
-		src.Registry.Type, src.Registry.URL, src.Registry.Insecure)
+		srcRegistry.Type, srcRegistry.URL, srcRegistry.Insecure)
 
 	// create client for destination registry
-	dstReg, err := createRegistry(dst.Registry)
+	dstRegistry := adapter.SelectEndpoint(dst.Registry)
+	dstReg, err := createRegistry(dstRegistry)
 	if err != nil {
 		t.logger.Errorf("failed to create client for destination registry: %v", err)
 		return err
 	}
 	t.dst = dstReg
+	t.dstEndpoint = dstRegistry.URL
 	t.logger.Infof("client for destination registry [type: %s, URL: %s, insecure: %v] created",
-		dst.Registry.Type, dst.Registry.URL, dst.Registry.Insecure)
+		dstRegistry.Type, dstRegistry.URL, dstRegistry.Insecure)
 
+	if dstRegistry.WarmupConnections > 0 {
+		t.warmUp(dstRegistry)
+	}
 	return nil
 }
 
+const (
+	// the timeout of warming up the connections to the destination registry, the warmup only saves the
+	// latency of the first requests, so it shouldn't delay the transfer much
+	warmupTimeout = 5 * time.Second
+	// the connections warmed up are kept alive in the idle pool of the transport shared by the jobs
+	// running in the same jobservice process, so the endpoint is only warmed up again after it
+	warmupInterval = 5 * time.Minute
+)
+
+// ErrWarmupUnsupported is returned when the adapter of the registry doesn't support the warmup
+var ErrWarmupUnsupported = errors.New("the adapter of the registry doesn't support the warmup")
+
+var (
+	warmupLock sync.Mutex
+	// the last time the connections to the endpoints were warmed up, keyed by "warmupKey"
+	warmedUpAt = map[string]time.Time{}
+	// the statuses of the latest warmups, keyed by the registry ID
+	warmupStatuses = map[int64]*model.WarmupStatus{}
+)
+
+// the endpoints reached through the different tunnels, with the different TLS settings or resolved
+// differently use the different connections, so they're warmed up separately
+func warmupKey(reg *model.Registry) string {
+	key := fmt.Sprintf("%s|%v|%s", reg.URL, reg.Insecure, registry_pkg.ResolutionKey(hostname(reg.URL)))
+	if reg.SSHTunnel != nil {
+		key = fmt.Sprintf("%s|%s@%s|%s", key, reg.SSHTunnel.User, reg.SSHTunnel.Host,
+			registry_pkg.ResolutionKey(hostname("ssh://"+reg.SSHTunnel.Host)))
+	}
+	return key
+}
+
+// returns the hostname of the URL, the URL itself is returned if it cannot be parsed
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// warm up the connections to the endpoint of the destination registry selected for the transfer
+// through the transport of the adapter. The endpoint warmed up recently by the other transfers or
+// on demand is skipped. The failure of the warmup doesn't fail the transfer
+func (t *transfer) warmUp(reg *model.Registry) {
+	warmer, ok := t.dst.(adapter.Warmer)
+	if !ok {
+		return
+	}
+	if !reserveWarmup(reg, false) {
+		return
+	}
+	status := warmUp(warmer, reg)
+	if len(status.Error) > 0 {
+		t.logger.Warningf("failed to warm up the connections to the destination registry %s: %s", reg.URL, status.Error)
+		return
+	}
+	t.logger.Infof("%d/%d connections to the destination registry %s warmed up in %dms",
+		status.Established, status.Requested, reg.URL, status.Duration)
+}
+
+// WarmUp warms up the connections to the registry on demand, e.g. before the scheduled replications. The
+// endpoint is selected in the same way as the transfers and the count of the connections is set by the
+// "WarmupConnections" of the registry. The connections are kept alive in the idle pool of the transport
+// shared by the transfers running in the same process, so it's called in jobservice
+func WarmUp(reg *model.Registry) (*model.WarmupStatus, error) {
+	endpoint := adapter.SelectEndpoint(reg)
+	dst, err := createRegistry(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	warmer, ok := dst.(adapter.Warmer)
+	if !ok {
+		return nil, ErrWarmupUnsupported
+	}
+	reserveWarmup(endpoint, true)
+	return warmUp(warmer, endpoint), nil
+}
+
+// WarmupStatuses returns the statuses of the latest warmups of the registries in
+// the current process, sorted by the registry ID
+func WarmupStatuses() []*model.WarmupStatus {
+	warmupLock.Lock()
+	defer warmupLock.Unlock()
+	statuses := []*model.WarmupStatus{}
+	for _, status := range warmupStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RegistryID < statuses[j].RegistryID
+	})
+	return statuses
+}
+
+// reserve the warmup of the endpoint, false is returned if the endpoint has been
+// warmed up in the interval and the warmup isn't forced
+func reserveWarmup(reg *model.Registry, force bool) bool {
+	key := warmupKey(reg)
+	warmupLock.Lock()
+	defer warmupLock.Unlock()
+	if last, exist := warmedUpAt[key]; !force && exist && time.Since(last) < warmupInterval {
+		return false
+	}
+	warmedUpAt[key] = time.Now()
+	return true
+}
+
+// warm up the connections to the endpoint through the warmer and record the status of the registry, the
+// count is capped by the max connections of the registry as the connections above it won't be used concurrently
+func warmUp(warmer adapter.Warmer, reg *model.Registry) *model.WarmupStatus {
+	count := reg.WarmupConnections
+	if max := trans.MaxConnections(reg.MaxConnections); max > 0 && max < count {
+		count = max
+	}
+	status := &model.WarmupStatus{
+		RegistryID: reg.ID,
+		Endpoint:   reg.URL,
+		Requested:  count,
+		StartTime:  time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+	established, err := warmer.WarmUp(ctx, count)
+	status.Established = established
+	status.Duration = int64(time.Since(status.StartTime) / time.Millisecond)
+	if err != nil {
+		status.Error = err.Error()
+	}
+	warmupLock.Lock()
+	warmupStatuses[reg.ID] = status
+	warmupLock.Unlock()
+	return status
+}
+
 func createRegistry(reg *model.Registry) (adapter.ImageRegistry, error) {
 	factory, err := adapter.GetFactory(reg.Type)
 	if err != nil {
@@ -137,22 +380,145 @@ func (t *transfer) copy(src *repository, dst *repository, override bool) error {
 	dstRepo := dst.repository
 	t.logger.Infof("copying %s:[%s](source registry) to %s:[%s](destination registry)...",
 		srcRepo, strings.Join(src.tags, ","), dstRepo, strings.Join(dst.tags, ","))
-	var err error
-	for i := range src.tags {
-		if e := t.copyImage(srcRepo, src.tags[i], dstRepo, dst.tags[i], override); e != nil {
-			t.logger.Errorf(e.Error())
-			err = e
-		}
+	start := time.Now()
+	if t.upToDate(src, dst) {
+		t.logger.Infof("all the tags of %s are identical on the destination registry, %s is up to date, skip",
+			srcRepo, dstRepo)
+		trans.LogUpToDateStep(t.logger, srcRepo, start)
+		return nil
 	}
+	t.bytes = trans.ByteAccounting{}
+	err := t.copyTags(src, dst, override)
+	t.logger.Infof("%d blobs(%d bytes) uploaded and %d blobs(%d bytes) skipped for %s", t.bytes.UploadedBlobs,
+		t.bytes.UploadedBytes, t.bytes.SkippedBlobs, t.bytes.SkippedBytes, srcRepo)
+	trans.LogRepositoryStep(t.logger, srcRepo, start, t.bytes, err)
 	if err != nil {
 		return err
 	}
 
+	if t.dryRun {
+		t.logger.Infof("dry run: %d blobs would be transferred, nothing is pushed to the destination registry",
+			len(t.pendingBlobs))
+		return nil
+	}
+	if t.replicateReferrers {
+		t.logger.Infof("%d referrers transferred", t.referrers)
+	}
 	t.logger.Infof("copy %s:[%s](source registry) to %s:[%s](destination registry) completed",
 		srcRepo, strings.Join(src.tags, ","), dstRepo, strings.Join(dst.tags, ","))
 	return nil
 }
 
+// check whether all the tags of the repository exist on the destination registry with the same digests,
+// so the whole repository is skipped without pulling the manifests and checking the blobs tag by tag.
+// The referrers aren't covered by the digests of the tags, so the repository is always copied tag by
+// tag when they're replicated. Any failure of the check falls back to the copy as well
+func (t *transfer) upToDate(src *repository, dst *repository) bool {
+	if t.replicateReferrers || len(src.tags) == 0 {
+		return false
+	}
+	for i := range src.tags {
+		exist, srcDigest, err := t.src.ManifestExist(src.repository, src.tags[i])
+		if err != nil {
+			t.logger.Debugf("failed to check the existence of the manifest of image %s:%s on the source registry: %v",
+				src.repository, src.tags[i], err)
+			return false
+		}
+		// some registries don't return the digest
+		if !exist || len(srcDigest) == 0 {
+			return false
+		}
+		exist, dstDigest, err := t.dst.ManifestExist(dst.repository, dst.tags[i])
+		if err != nil {
+			t.logger.Debugf("failed to check the existence of the manifest of image %s:%s on the destination registry: %v",
+				dst.repository, dst.tags[i], err)
+			return false
+		}
+		if !exist || dstDigest != srcDigest {
+			return false
+		}
+	}
+	return true
+}
+
+// copy the tags of the repository one by one, the skipped tags don't fail the copy
+func (t *transfer) copyTags(src *repository, dst *repository, override bool) error {
+	var err error
+	for i := range src.tags {
+		start := time.Now()
+		e := t.copyImage(src.repository, src.tags[i], dst.repository, dst.tags[i], override)
+		// the reason why there is nothing to copy is logged by "copyImage" already
+		if s, ok := e.(*skipError); ok {
+			trans.LogStep(t.logger, trans.StepPhaseCopy, src.repository, src.tags[i], start, &trans.SkippedError{Reason: s.reason})
+			continue
+		}
+		trans.LogStep(t.logger, trans.StepPhaseCopy, src.repository, src.tags[i], start, e)
+		if _, skipped := e.(*trans.SkippedError); skipped {
+			t.logger.Warning(e.Error())
+			continue
+		}
+		if e != nil {
+			t.logger.Errorf(e.Error())
+			err = e
+		}
+	}
+	return err
+}
+
+// account the blob uploaded to the destination registry or skipped, the blobs
+// which would be transferred in the dry run aren't accounted
+func (t *transfer) account(repository, digest string, size int64, skipped bool) {
+	t.bytes.Add(size, skipped)
+	if t.blobAccounting {
+		trans.LogBlobStep(t.logger, repository, digest, size, skipped)
+	}
+}
+
+// make the tags replicated from the immutable source tags immutable on the destination registry as
+// well, only the warning is logged when it fails as the images are already copied
+func (t *transfer) makeTagsImmutable(src *repository, dst *repository, immutableTags []string) {
+	if len(immutableTags) == 0 || t.dryRun || t.shouldStop() {
+		return
+	}
+	immutable := map[string]struct{}{}
+	for _, tag := range immutableTags {
+		immutable[tag] = struct{}{}
+	}
+	tags := []string{}
+	for i, tag := range src.tags {
+		if _, exist := immutable[tag]; exist {
+			tags = append(tags, dst.tags[i])
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	registry, ok := t.dst.(adapter.TagImmutabilityRegistry)
+	if !ok {
+		t.logger.Warningf("the tags %s:[%s] are immutable on the source registry, but the destination registry doesn't support the tag immutability",
+			dst.repository, strings.Join(tags, ","))
+		return
+	}
+	supported, err := registry.SupportTagImmutability()
+	if err != nil {
+		t.logger.Warningf("failed to check whether the destination registry supports the tag immutability: %v", err)
+		return
+	}
+	if !supported {
+		t.logger.Warningf("the tags %s:[%s] are immutable on the source registry, but the version of the destination registry doesn't support the tag immutability",
+			dst.repository, strings.Join(tags, ","))
+		return
+	}
+	if err = registry.MakeTagsImmutable(dst.repository, tags); err != nil {
+		t.logger.Warningf("failed to make the tags %s:[%s] immutable on the destination registry: %v",
+			dst.repository, strings.Join(tags, ","), err)
+		return
+	}
+	t.logger.Infof("the tags %s:[%s] are made immutable on the destination registry",
+		dst.repository, strings.Join(tags, ","))
+}
+
 func (t *transfer) copyImage(srcRepo, srcRef, dstRepo, dstRef string, override bool) error {
 	t.logger.Infof("copying %s:%s(source registry) to %s:%s(destination registry)...",
 		srcRepo, srcRef, dstRepo, dstRef)
@@ -172,24 +538,88 @@ func (t *transfer) copyImage(srcRepo, srcRef, dstRepo, dstRef string, override b
 		if digest == digest2 {
 			t.logger.Infof("the image %s:%s already exists on the destination registry, skip",
 				dstRepo, dstRef)
-			return nil
+			if mediaType, _, err := manifest.Payload(); err == nil {
+				t.recordMediaType(mediaType)
+			}
+			if err = t.copyReferrers(srcRepo, dstRepo, digest); err != nil {
+				return err
+			}
+			return &skipError{reason: "the image already exists on the destination registry"}
+		}
+		// the image copied with the layers compressed already exists
+		if t.compressLayers && t.isCompressedCopy(manifest, dstRepo, dstRef) {
+			t.logger.Infof("the image %s:%s with the layers compressed already exists on the destination registry, skip",
+				dstRepo, dstRef)
+			return &skipError{reason: "the image with the layers compressed already exists on the destination registry"}
+		}
+		// the image copied with the manifest converted already exists
+		if mediaType, converted := t.isConvertedCopy(manifest, dstRepo, dstRef); converted {
+			t.logger.Infof("the image %s:%s with the manifest converted to %s already exists on the destination registry, skip",
+				dstRepo, dstRef, mediaType)
+			t.recordMediaType(mediaType)
+			return &skipError{reason: "the image with the manifest converted already exists on the destination registry"}
 		}
 		// the same name image exists, but not allowed to override
 		if !override {
 			t.logger.Warningf("the same name image %s:%s exists on the destination registry, but the \"override\" is set to false, skip",
 				dstRepo, dstRef)
-			return nil
+			return &skipError{reason: "the same name image exists on the destination registry and the override is disabled"}
 		}
 		// the same name image exists, but allowed to override
 		t.logger.Warningf("the same name image %s:%s exists on the destination registry and the \"override\" is set to true, continue...",
 			dstRepo, dstRef)
 	}
 
+	// make sure the destination registry accepts the media type of the manifest before uploading the blobs
+	manifest, converted, accepted := t.acceptableManifest(manifest, dstRepo, dstRef)
+	if !accepted {
+		return &skipError{reason: "the media type of the manifest isn't accepted by the destination registry"}
+	}
+
+	// make sure the destination registry allows the media types of the layers. They're checked after the
+	// conversion which changes the media types, e.g. from the OCI layers to the docker ones, and the layers
+	// compressed are checked after the compression for the same reason
+	compress := t.compressLayers && !t.dryRun
+	if !compress {
+		if err = t.checkLayerMediaTypes(manifest, srcRepo, srcRef); err != nil {
+			return err
+		}
+	}
+
+	// check all the blobs of the image at once, so the skip-existing decisions are made before uploading
+	t.checkBlobs(dstRepo, manifest.References())
+
+	// fail fast if the image cannot fit in the storage available on the destination registry
+	if err = t.checkStorage(manifest, dstRepo); err != nil {
+		return err
+	}
+	if !t.dryRun {
+		t.expectBlobs(dstRepo, manifest.References())
+	}
+
 	// copy contents between the source and destination registries
-	for _, content := range manifest.References() {
-		if err = t.copyContent(content, srcRepo, dstRepo); err != nil {
+	changed := converted
+	if compress {
+		compressed := false
+		if manifest, compressed, err = t.copyCompressedContents(manifest, srcRepo, dstRepo); err != nil {
 			return err
 		}
+		if err = t.checkLayerMediaTypes(manifest, srcRepo, srcRef); err != nil {
+			return err
+		}
+		changed = changed || compressed
+	} else {
+		for _, content := range manifest.References() {
+			if err = t.copyContent(content, srcRepo, dstRepo); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the blobs which would be transferred are missing on the destination registry in the
+	// dry run, so the manifest is only validated as it would be rejected by the registry
+	if t.dryRun {
+		return t.validateManifest(manifest, dstRepo, dstRef)
 	}
 
 	// push the manifest to the destination registry
@@ -197,25 +627,114 @@ func (t *transfer) copyImage(srcRepo, srcRef, dstRepo, dstRef string, override b
 		return err
 	}
 
+	// copy the artifacts referring to the image, they refer to the digest of the
+	// original manifest and cannot be attached to the converted or compressed one
+	if changed {
+		if t.replicateReferrers {
+			t.logger.Warningf("the digest of image %s:%s is changed as the manifest is converted or the layers are compressed, skip the referrers",
+				dstRepo, dstRef)
+		}
+	} else if err := t.copyReferrers(srcRepo, dstRepo, digest); err != nil {
+		return err
+	}
+
 	t.logger.Infof("copy %s:%s(source registry) to %s:%s(destination registry) completed",
 		srcRepo, srcRef, dstRepo, dstRef)
 	return nil
 }
 
+// skipError is returned by "copyImage" when there is nothing to copy, e.g. the image exists on
+// the destination registry already. The step of the tag is logged as skipped, but unlike the
+// "SkippedError" of the disallowed layers, it doesn't skip the index referring to the image
+type skipError struct {
+	reason string
+}
+
+func (s *skipError) Error() string {
+	return s.reason
+}
+
+// copy the artifacts which refer to the manifest specified by the digest, e.g. signatures and SBOMs
+func (t *transfer) copyReferrers(srcRepo, dstRepo, digest string) error {
+	if !t.replicateReferrers || t.dryRun || t.shouldStop() {
+		return nil
+	}
+	src, ok := t.src.(adapter.ReferrerRegistry)
+	if !ok {
+		t.logger.Warning("the source registry doesn't support the referrers, skip")
+		return nil
+	}
+	referrers, err := src.ListReferrers(srcRepo, digest)
+	if err != nil {
+		t.logger.Errorf("failed to list the referrers of %s@%s: %v", srcRepo, digest, err)
+		return err
+	}
+	for _, referrer := range referrers {
+		if err = t.copyReferrer(src, srcRepo, dstRepo, referrer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy the referrer manifest and the blobs it contains, the referrers
+// of the referrer are copied as well
+func (t *transfer) copyReferrer(src adapter.ReferrerRegistry, srcRepo, dstRepo string, referrer v1.Descriptor) error {
+	digest := referrer.Digest.String()
+	if referrer.MediaType != v1.MediaTypeImageManifest && referrer.MediaType != schema2.MediaTypeManifest {
+		t.logger.Warningf("the media type %s of referrer %s isn't supported, skip", referrer.MediaType, digest)
+		return nil
+	}
+	t.logger.Infof("copying the referrer %s...", digest)
+	mediaType, payload, err := src.PullRawManifest(srcRepo, digest, []string{referrer.MediaType})
+	if err != nil {
+		t.logger.Errorf("failed to pull the manifest of referrer %s: %v", digest, err)
+		return err
+	}
+	manifest := &v1.Manifest{}
+	if err = json.Unmarshal(payload, manifest); err != nil {
+		t.logger.Errorf("failed to unmarshal the manifest of referrer %s: %v", digest, err)
+		return err
+	}
+	for _, blob := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+		if len(blob.Digest) == 0 {
+			continue
+		}
+		if err = t.copyBlob(srcRepo, dstRepo, blob.Digest.String(), blob.Size); err != nil {
+			return err
+		}
+	}
+	if err = t.dst.PushManifest(dstRepo, digest, mediaType, payload); err != nil {
+		t.logger.Errorf("failed to push the manifest of referrer %s: %v", digest, err)
+		return err
+	}
+	t.referrers++
+	t.logger.Infof("copy the referrer %s completed", digest)
+
+	return t.copyReferrers(srcRepo, dstRepo, digest)
+}
+
 // copy the content from source registry to destination according to its media type
 func (t *transfer) copyContent(content distribution.Descriptor, srcRepo, dstRepo string) error {
 	digest := content.Digest.String()
 	switch content.MediaType {
 	// when the media type of pulled manifest is manifest list,
 	// the contents it contains are a few manifests
-	case schema2.MediaTypeManifest:
-		// as using digest as the reference, so set the override to true directly
-		return t.copyImage(srcRepo, digest, dstRepo, digest, true)
+	case schema2.MediaTypeManifest, v1.MediaTypeImageManifest:
+		// as using digest as the reference, so set the override to true directly. The manifest
+		// which is skipped as there is nothing to copy doesn't skip the index referring to it
+		if err := t.copyImage(srcRepo, digest, dstRepo, digest, true); err != nil {
+			if _, ok := err.(*skipError); !ok {
+				return err
+			}
+		}
+		return nil
 	// copy layer or image config
-	case schema2.MediaTypeLayer, schema2.MediaTypeImageConfig:
-		return t.copyBlob(srcRepo, dstRepo, digest)
+	case schema2.MediaTypeLayer, schema2.MediaTypeUncompressedLayer, schema2.MediaTypeImageConfig,
+		v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageConfig:
+		return t.copyBlob(srcRepo, dstRepo, digest, content.Size)
 	// handle foreign layer
-	case schema2.MediaTypeForeignLayer:
+	case schema2.MediaTypeForeignLayer, v1.MediaTypeImageLayerNonDistributable, v1.MediaTypeImageLayerNonDistributableGzip:
 		t.logger.Infof("the layer %s is a foreign layer, skip", digest)
 		return nil
 	// others
@@ -226,19 +745,32 @@ func (t *transfer) copyContent(content distribution.Descriptor, srcRepo, dstRepo
 	}
 }
 
-// copy the layer or image config from the source registry to destination
-func (t *transfer) copyBlob(srcRepo, dstRepo, digest string) error {
+// copy the layer or image config from the source registry to destination, the size is the one
+// declared by the manifest and used to account the blob skipped
+func (t *transfer) copyBlob(srcRepo, dstRepo, digest string, size int64) error {
 	if t.shouldStop() {
 		return nil
 	}
 	t.logger.Infof("copying the blob %s...", digest)
-	exist, err := t.dst.BlobExist(dstRepo, digest)
+	exist, err := t.blobExist(dstRepo, digest)
 	if err != nil {
 		t.logger.Errorf("failed to check the existence of blob %s on the destination registry: %v", digest, err)
 		return err
 	}
 	if exist {
 		t.logger.Infof("the blob %s already exists on the destination registry, skip", digest)
+		t.account(srcRepo, digest, size, true)
+		return nil
+	}
+	if t.dryRun {
+		t.pendingBlobs = append(t.pendingBlobs, digest)
+		t.logger.Infof("dry run: the blob %s would be transferred", digest)
+		return nil
+	}
+	if t.mountBlob(srcRepo, dstRepo, digest) {
+		t.cacheBlobExistence(dstRepo, digest, true)
+		t.withdrawBlob(dstRepo, digest, size)
+		t.account(srcRepo, digest, size, true)
 		return nil
 	}
 
@@ -248,14 +780,54 @@ func (t *transfer) copyBlob(srcRepo, dstRepo, digest string) error {
 		return err
 	}
 	defer data.Close()
-	if err = t.dst.PushBlob(dstRepo, digest, size, data); err != nil {
+	var reader io.Reader = data
+	// the source corruption or the transport errors are caught before the bad data is pushed
+	if t.verifyBlobs {
+		if reader, err = newDigestVerifyingReader(data, digest, size); err != nil {
+			t.logger.Errorf("failed to verify the blob %s: %v", digest, err)
+			return err
+		}
+	}
+	if err = t.dst.PushBlob(dstRepo, digest, size, t.meter.Reader(reader)); err != nil {
 		t.logger.Errorf("failed to pushing the blob %s: %v", digest, err)
 		return err
 	}
+	t.cacheBlobExistence(dstRepo, digest, true)
+	t.account(srcRepo, digest, size, false)
 	t.logger.Infof("copy the blob %s completed", digest)
 	return nil
 }
 
+// mount the blob from the repository on the destination registry which it's expected to exist in,
+// or from the source repository if mounting the blobs is enabled, returns whether the blob is mounted
+func (t *transfer) mountBlob(srcRepo, dstRepo, digest string) bool {
+	mounter, ok := t.dst.(adapter.BlobMounter)
+	if !ok {
+		return false
+	}
+	repos := []string{}
+	if repo, exist := t.blobSources[digest]; exist {
+		repos = append(repos, repo)
+	}
+	if t.mountBlobs {
+		repos = append(repos, srcRepo)
+	}
+	for _, repo := range repos {
+		if repo == dstRepo {
+			continue
+		}
+		if err := mounter.MountBlob(repo, digest, dstRepo); err != nil {
+			// the blob may not be replicated yet as the tasks run concurrently or the source
+			// repository isn't on the same registry backend, transfer it instead
+			t.logger.Infof("failed to mount the blob %s from %s: %v", digest, repo, err)
+			continue
+		}
+		t.logger.Infof("the blob %s is mounted from %s on the destination registry", digest, repo)
+		return true
+	}
+	return false
+}
+
 func (t *transfer) pullManifest(repository, reference string) (
 	distribution.Manifest, string, error) {
 	if t.shouldStop() {
@@ -265,6 +837,7 @@ func (t *transfer) pullManifest(repository, reference string) (
 	manifest, digest, err := t.src.PullManifest(repository, reference, []string{
 		schema1.MediaTypeManifest,
 		schema2.MediaTypeManifest,
+		v1.MediaTypeImageManifest,
 		manifestlist.MediaTypeManifestList,
 	})
 	if err != nil {
@@ -288,7 +861,8 @@ func (t *transfer) handleManifest(manifest distribution.Manifest, repository, di
 	}
 	// manifest
 	if mediaType == schema1.MediaTypeManifest ||
-		mediaType == schema2.MediaTypeManifest {
+		mediaType == schema2.MediaTypeManifest ||
+		mediaType == v1.MediaTypeImageManifest {
 		return manifest, digest, nil
 	}
 	// manifest list
@@ -315,6 +889,178 @@ func (t *transfer) handleManifest(manifest distribution.Manifest, repository, di
 	return t.pullManifest(repository, digest)
 }
 
+// acceptableManifest checks whether the destination registry accepts the media type of the manifest
+// by its capabilities. The OCI image manifest is converted to the docker schema2 one if the registry
+// doesn't support OCI and the returned bool "converted" is true. The returned bool "accepted" is false
+// if the manifest cannot be converted, the image should be skipped in that case. The manifest is kept
+// as it is if the capability cannot be determined and it's converted when it's rejected by the push.
+// The manifest is also converted to the type which the registry prefers if it's safe, otherwise it's
+// kept as it is
+func (t *transfer) acceptableManifest(manifest distribution.Manifest, repository, tag string) (
+	distribution.Manifest, bool, bool) {
+	switch m := manifest.(type) {
+	case *registry_pkg.OCIManifest:
+		unsupported := t.dstCapability(repository, adapter.CapabilityOCIManifest) == adapter.CapabilityUnsupported
+		if !unsupported && t.preferredManifestType != model.ManifestTypeDocker {
+			return manifest, false, true
+		}
+		converted, err := registry_pkg.ConvertToSchema2(m)
+		if err != nil {
+			if !unsupported {
+				t.logger.Warningf("the manifest of image %s:%s cannot be converted to the preferred type %s: %v, keep the media type %s",
+					repository, tag, schema2.MediaTypeManifest, err, v1.MediaTypeImageManifest)
+				return manifest, false, true
+			}
+			t.logger.Warningf("the destination registry doesn't accept the manifest of image %s:%s with media type %s and it cannot be converted to %s: %v, skip",
+				repository, tag, v1.MediaTypeImageManifest, schema2.MediaTypeManifest, err)
+			return nil, false, false
+		}
+		if unsupported {
+			t.logger.Infof("the destination registry doesn't accept the manifest of image %s:%s with media type %s, it's converted to %s",
+				repository, tag, v1.MediaTypeImageManifest, schema2.MediaTypeManifest)
+		} else {
+			t.logger.Infof("the manifest of image %s:%s is converted from %s to the preferred type %s",
+				repository, tag, v1.MediaTypeImageManifest, schema2.MediaTypeManifest)
+		}
+		return converted, true, true
+	case *schema2.DeserializedManifest:
+		if t.preferredManifestType != model.ManifestTypeOCI {
+			return manifest, false, true
+		}
+		// fall back to docker schema2 if the registry doesn't support OCI. When the capability cannot
+		// be determined, the converted manifest is converted back if it's rejected by the push
+		if t.dstCapability(repository, adapter.CapabilityOCIManifest) == adapter.CapabilityUnsupported {
+			t.logger.Warningf("the destination registry doesn't support the preferred type %s, keep the media type %s for the manifest of image %s:%s",
+				v1.MediaTypeImageManifest, schema2.MediaTypeManifest, repository, tag)
+			return manifest, false, true
+		}
+		converted, err := registry_pkg.ConvertToOCI(m)
+		if err != nil {
+			t.logger.Warningf("the manifest of image %s:%s cannot be converted to the preferred type %s: %v, keep the media type %s",
+				repository, tag, v1.MediaTypeImageManifest, err, schema2.MediaTypeManifest)
+			return manifest, false, true
+		}
+		t.logger.Infof("the manifest of image %s:%s is converted from %s to the preferred type %s",
+			repository, tag, schema2.MediaTypeManifest, v1.MediaTypeImageManifest)
+		return converted, true, true
+	}
+	return manifest, false, true
+}
+
+// isConvertedCopy checks whether the image on the destination registry is the copy of the manifest
+// converted to another media type, e.g. to the type the registry prefers or supports. The conversion
+// keeps the config and layers, so the copy is identified by them. The media type of the copy is returned
+func (t *transfer) isConvertedCopy(manifest distribution.Manifest, dstRepo, dstRef string) (string, bool) {
+	srcMediaType, _, err := manifest.Payload()
+	if err != nil {
+		return "", false
+	}
+	srcConfig, srcLayers, ok := configAndLayers(manifest)
+	if !ok {
+		return "", false
+	}
+	dstManifest, _, err := t.dst.PullManifest(dstRepo, dstRef, []string{
+		schema2.MediaTypeManifest,
+		v1.MediaTypeImageManifest,
+	})
+	if err != nil {
+		t.logger.Warningf("failed to pull the manifest of image %s:%s from the destination registry: %v", dstRepo, dstRef, err)
+		return "", false
+	}
+	dstMediaType, _, err := dstManifest.Payload()
+	if err != nil || dstMediaType == srcMediaType {
+		return "", false
+	}
+	dstConfig, dstLayers, ok := configAndLayers(dstManifest)
+	if !ok || srcConfig.Digest != dstConfig.Digest || len(srcLayers) != len(dstLayers) {
+		return "", false
+	}
+	for i := range srcLayers {
+		if srcLayers[i].Digest != dstLayers[i].Digest {
+			return "", false
+		}
+	}
+	return dstMediaType, true
+}
+
+// checkStorage estimates the size of the blobs of the manifest which are missing on the destination
+// registry and checks it against the storage available there. The check is skipped if the registry
+// doesn't expose the storage info or the info cannot be got. The size of the blobs checked is deducted
+// from the available storage, so the following images of the transfer are checked against the rest
+func (t *transfer) checkStorage(manifest distribution.Manifest, repository string) error {
+	reporter, ok := t.dst.(adapter.StorageReporter)
+	if !ok {
+		return nil
+	}
+	if t.availableStorage == nil {
+		available, err := reporter.AvailableStorage(repository)
+		if err != nil {
+			t.logger.Warningf("failed to get the storage available on the destination registry, skip the storage check: %v", err)
+			available = -1
+		}
+		t.availableStorage = &available
+	}
+	if *t.availableStorage < 0 {
+		return nil
+	}
+
+	var required int64
+	for _, blob := range manifest.References() {
+		// the manifests of the list are checked when they're copied and the foreign layers aren't pushed
+		if !isBlob(blob.MediaType) {
+			continue
+		}
+		exist, err := t.blobExist(repository, blob.Digest.String())
+		if err != nil {
+			t.logger.Warningf("failed to check the existence of the blob %s on the destination registry, skip the storage check: %v",
+				blob.Digest.String(), err)
+			return nil
+		}
+		if !exist {
+			required += blob.Size
+		}
+	}
+	if required > *t.availableStorage {
+		return &trans.InsufficientStorageError{
+			Repository: repository,
+			Required:   required,
+			Available:  *t.availableStorage,
+		}
+	}
+	*t.availableStorage -= required
+	return nil
+}
+
+// dstCapability returns the status of the capability of the destination registry inside the namespace
+// of the repository, the capabilities are probed only once per namespace for the transfer
+func (t *transfer) dstCapability(repository, name string) string {
+	namespace := ""
+	if i := strings.Index(repository, "/"); i > 0 {
+		namespace = repository[:i]
+	}
+	if t.dstCapabilities == nil {
+		t.dstCapabilities = map[string]map[string]string{}
+	}
+	capabilities, exist := t.dstCapabilities[namespace]
+	if !exist {
+		capabilities = map[string]string{}
+		if prober, ok := t.dst.(adapter.CapabilityProber); ok {
+			probed, err := prober.Capabilities(namespace)
+			if err != nil {
+				t.logger.Warningf("failed to probe the capabilities of the destination registry: %v", err)
+			} else {
+				capabilities = probed
+			}
+		}
+		t.dstCapabilities[namespace] = capabilities
+	}
+	status, exist := capabilities[name]
+	if !exist {
+		return adapter.CapabilityUnknown
+	}
+	return status
+}
+
 func (t *transfer) exist(repository, tag string) (bool, string, error) {
 	exist, digest, err := t.dst.ManifestExist(repository, tag)
 	if err != nil {
@@ -325,6 +1071,18 @@ func (t *transfer) exist(repository, tag string) (bool, string, error) {
 	return exist, digest, nil
 }
 
+// validateManifest checks whether the manifest can be serialized in the dry run, the manifest isn't pushed
+func (t *transfer) validateManifest(manifest distribution.Manifest, repository, tag string) error {
+	mediaType, _, err := manifest.Payload()
+	if err != nil {
+		t.logger.Errorf("failed to validate the manifest of image %s:%s: %v", repository, tag, err)
+		return err
+	}
+	t.logger.Infof("dry run: the manifest of image %s:%s would be pushed with media type %s",
+		repository, tag, mediaType)
+	return nil
+}
+
 func (t *transfer) pushManifest(manifest distribution.Manifest, repository, tag string) error {
 	if t.shouldStop() {
 		return nil
@@ -336,16 +1094,51 @@ func (t *transfer) pushManifest(manifest distribution.Manifest, repository, tag
 			repository, tag, err)
 		return err
 	}
-	if err := t.dst.PushManifest(repository, tag, mediaType, payload); err != nil {
+	err = t.dst.PushManifest(repository, tag, mediaType, payload)
+	// fall back to the docker schema2 manifest if the destination registry doesn't support OCI
+	if ociManifest, ok := manifest.(*registry_pkg.OCIManifest); ok && isManifestRejected(err) {
+		t.logger.Warningf("the manifest of image %s:%s with media type %s is rejected by the destination registry: %v, converting it to %s...",
+			repository, tag, mediaType, err, schema2.MediaTypeManifest)
+		converted, e := registry_pkg.ConvertToSchema2(ociManifest)
+		if e != nil {
+			t.logger.Errorf("failed to convert the manifest of image %s:%s: %v", repository, tag, e)
+			return e
+		}
+		// the media types of the layers are changed by the conversion
+		if e = t.checkLayerMediaTypes(converted, repository, tag); e != nil {
+			return e
+		}
+		if mediaType, payload, err = converted.Payload(); err != nil {
+			t.logger.Errorf("failed to push manifest of image %s:%s: %v",
+				repository, tag, err)
+			return err
+		}
+		err = t.dst.PushManifest(repository, tag, mediaType, payload)
+	}
+	if err != nil {
 		t.logger.Errorf("failed to push manifest of image %s:%s: %v",
 			repository, tag, err)
 		return err
 	}
-	t.logger.Infof("the manifest of image %s:%s pushed",
-		repository, tag)
+	t.logger.Infof("the manifest of image %s:%s pushed with media type %s",
+		repository, tag, mediaType)
+	t.recordMediaType(mediaType)
 	return nil
 }
 
+// isManifestRejected returns whether the manifest is rejected by the registry because of its media type
+func isManifestRejected(err error) bool {
+	e, ok := err.(*common_http.Error)
+	if !ok {
+		return false
+	}
+	if e.Code == http.StatusUnsupportedMediaType {
+		return true
+	}
+	return e.Code == http.StatusBadRequest &&
+		(e.ErrorCode == common_http.ErrorCodeManifestInvalid || e.ErrorCode == common_http.ErrorCodeUnsupported)
+}
+
 func (t *transfer) delete(repo *repository) error {
 	if t.shouldStop() {
 		return nil
@@ -353,23 +1146,71 @@ func (t *transfer) delete(repo *repository) error {
 
 	repository := repo.repository
 	for _, tag := range repo.tags {
-		exist, _, err := t.dst.ManifestExist(repository, tag)
-		if err != nil {
-			t.logger.Errorf("failed to check the existence of the manifest of image %s:%s on the destination registry: %v",
-				repository, tag, err)
-			return err
-		}
-		if !exist {
-			t.logger.Infof("the image %s:%s doesn't exist on the destination registry, skip",
-				repository, tag)
+		start := time.Now()
+		verification, err := t.deleteImage(repository, tag)
+		trans.LogDeleteStep(t.logger, repository, tag, start, verification, err)
+		if _, skipped := err.(*trans.SkippedError); skipped {
 			continue
 		}
-		if err := t.dst.DeleteManifest(repository, tag); err != nil {
-			t.logger.Errorf("failed to delete the manifest of image %s:%s on the destination registry: %v",
-				repository, tag, err)
+		if err != nil {
 			return err
 		}
-		t.logger.Infof("the manifest of image %s:%s is deleted", repository, tag)
 	}
 	return nil
 }
+
+// delete the image and verify the deletion, the verification of the deletion is returned
+func (t *transfer) deleteImage(repository, tag string) (string, error) {
+	exist, _, err := t.dst.ManifestExist(repository, tag)
+	if err != nil {
+		t.logger.Errorf("failed to check the existence of the manifest of image %s:%s on the destination registry: %v",
+			repository, tag, err)
+		return "", err
+	}
+	if !exist {
+		t.logger.Infof("the image %s:%s doesn't exist on the destination registry, skip",
+			repository, tag)
+		return trans.StepVerificationVerified, &trans.SkippedError{Reason: "the image doesn't exist on the destination registry"}
+	}
+	if t.dryRun {
+		t.logger.Infof("dry run: the manifest of image %s:%s would be deleted", repository, tag)
+		return "", nil
+	}
+	if err := t.dst.DeleteManifest(repository, tag); err != nil {
+		t.logger.Errorf("failed to delete the manifest of image %s:%s on the destination registry: %v",
+			repository, tag, err)
+		return "", err
+	}
+	t.logger.Infof("the manifest of image %s:%s is deleted", repository, tag)
+	return t.verifyDeletion(repository, tag)
+}
+
+// the times and interval of checking whether the manifest is gone after the deletion, they're variables for testing
+var (
+	deletionChecks        = 3
+	deletionCheckInterval = 2 * time.Second
+)
+
+// check whether the manifest is gone after the destination registry reports it deleted, the registries
+// which delete lazily are given several chances. The error is returned only if the manifest persists,
+// the deletion is treated as unverified if the existence can't be checked
+func (t *transfer) verifyDeletion(repository, tag string) (string, error) {
+	for i := 0; i < deletionChecks; i++ {
+		if i > 0 {
+			time.Sleep(deletionCheckInterval)
+		}
+		exist, _, err := t.dst.ManifestExist(repository, tag)
+		if err != nil {
+			t.logger.Warningf("failed to verify the deletion of the manifest of image %s:%s: %v", repository, tag, err)
+			return trans.StepVerificationUnverified, nil
+		}
+		if !exist {
+			t.logger.Infof("the deletion of the manifest of image %s:%s is verified", repository, tag)
+			return trans.StepVerificationVerified, nil
+		}
+	}
+	err := fmt.Errorf("the destination registry reported the manifest of image %s:%s deleted, but it still exists after %d checks",
+		repository, tag, deletionChecks)
+	t.logger.Error(err)
+	return trans.StepVerificationPersisted, err
+}
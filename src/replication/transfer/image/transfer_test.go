@@ -16,16 +16,30 @@ package image
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema2"
+	common_http "github.com/goharbor/harbor/src/common/http"
 	"github.com/goharbor/harbor/src/common/utils/log"
 	pkg_registry "github.com/goharbor/harbor/src/common/utils/registry"
+	"github.com/goharbor/harbor/src/replication/adapter"
 	"github.com/goharbor/harbor/src/replication/model"
 	trans "github.com/goharbor/harbor/src/replication/transfer"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -91,6 +105,121 @@ func (f *fakeRegistry) PullBlob(repository, digest string) (size int64, blob io.
 	return 1, r, nil
 }
 func (f *fakeRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	_, err := ioutil.ReadAll(blob)
+	return err
+}
+
+// fakeReferrerRegistry returns the mock referrers: the image has a signature
+// which has an attestation, and an index referrer which isn't supported
+type fakeReferrerRegistry struct {
+	fakeRegistry
+	pushed []string
+}
+
+func (f *fakeReferrerRegistry) ListReferrers(repository, dgt string) ([]v1.Descriptor, error) {
+	switch dgt {
+	case "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7":
+		return []v1.Descriptor{
+			{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111"),
+			},
+			{
+				MediaType: v1.MediaTypeImageIndex,
+				Digest:    digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333"),
+			},
+		}, nil
+	case "sha256:1111111111111111111111111111111111111111111111111111111111111111":
+		return []v1.Descriptor{
+			{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222"),
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeReferrerRegistry) PullRawManifest(repository, reference string, accepttedMediaTypes []string) (string, []byte, error) {
+	manifest := `{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"artifactType": "application/vnd.dev.cosign.artifact.sig.v1+json",
+		"config": {
+			"mediaType": "application/vnd.oci.empty.v1+json",
+			"size": 2,
+			"digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+		},
+		"layers": [
+			{
+				"mediaType": "application/vnd.dev.cosign.simplesigning.v1+json",
+				"size": 241,
+				"digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+			}
+		],
+		"subject": {
+			"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+			"size": 7023,
+			"digest": "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"
+		}
+	}`
+	return v1.MediaTypeImageManifest, []byte(manifest), nil
+}
+
+func (f *fakeReferrerRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	f.pushed = append(f.pushed, reference)
+	return nil
+}
+
+// fakeOCIRegistry returns the OCI image manifest when pulling and records the media
+// types of the pushed manifests. The OCI manifest is rejected if "supportOCI" is false.
+// The media type of the layer is "layerMediaType" or the gzipped OCI layer if it's empty
+type fakeOCIRegistry struct {
+	fakeRegistry
+	supportOCI     bool
+	layerMediaType string
+	pushed         []string
+}
+
+func (f *fakeOCIRegistry) PullManifest(repository, reference string, accepttedMediaTypes []string) (distribution.Manifest, string, error) {
+	layerMediaType := f.layerMediaType
+	if len(layerMediaType) == 0 {
+		layerMediaType = v1.MediaTypeImageLayerGzip
+	}
+	manifest := fmt.Sprintf(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config": {
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"size": 7023,
+			"digest": "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"
+		},
+		"layers": [
+			{
+				"mediaType": "%s",
+				"size": 32654,
+				"digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+			}
+		],
+		"annotations": {
+			"org.opencontainers.image.created": "2019-01-01T00:00:00Z"
+		}
+	}`, layerMediaType)
+	mani, _, err := pkg_registry.UnMarshal(v1.MediaTypeImageManifest, []byte(manifest))
+	if err != nil {
+		return nil, "", err
+	}
+	return mani, "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", nil
+}
+
+func (f *fakeOCIRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	if mediaType == v1.MediaTypeImageManifest && !f.supportOCI {
+		return &common_http.Error{
+			Code:      http.StatusBadRequest,
+			ErrorCode: common_http.ErrorCodeManifestInvalid,
+		}
+	}
+	f.pushed = append(f.pushed, mediaType)
 	return nil
 }
 
@@ -125,6 +254,7 @@ func TestCopy(t *testing.T) {
 		isStopped: stopFunc,
 		src:       &fakeRegistry{},
 		dst:       &fakeRegistry{},
+		meter:     trans.NewMeter(),
 	}
 
 	src := &repository{
@@ -138,6 +268,99 @@ func TestCopy(t *testing.T) {
 	override := true
 	err := tr.copy(src, dst, override)
 	require.Nil(t, err)
+	// the blobs pushed are measured
+	speed := tr.Speed()
+	require.NotNil(t, speed)
+	assert.True(t, speed.Bytes > 0)
+}
+
+// fakeExistingRegistry has all the images of the fakeRegistry already
+type fakeExistingRegistry struct {
+	fakeRegistry
+}
+
+func (f *fakeExistingRegistry) ManifestExist(repository, reference string) (bool, string, error) {
+	return true, "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", nil
+}
+
+func TestCopySkippedTags(t *testing.T) {
+	logger := &fakeStepLogger{Logger: log.DefaultLogger()}
+	tr := &transfer{
+		logger:    logger,
+		isStopped: func() bool { return false },
+		src:       &fakeRegistry{},
+		dst:       &fakeRegistry{},
+		meter:     trans.NewMeter(),
+	}
+
+	// the image b1 exists on the destination registry already, b2 doesn't
+	require.Nil(t, tr.copyTags(&repository{
+		repository: "source",
+		tags:       []string{"a1", "a2"},
+	}, &repository{
+		repository: "destination",
+		tags:       []string{"b1", "b2"},
+	}, true))
+	steps := logger.steps(t)
+	require.Len(t, steps, 2)
+	assert.Equal(t, "a1", steps[0].Tag)
+	assert.Equal(t, trans.StepResultSkipped, steps[0].Result)
+	assert.Contains(t, steps[0].Error, "already exists")
+	assert.Equal(t, "a2", steps[1].Tag)
+	assert.Equal(t, trans.StepResultSucceeded, steps[1].Result)
+
+	// the manifest of the index which exists on the destination registry already doesn't skip the index
+	tr.dst = &fakeExistingRegistry{}
+	assert.Nil(t, tr.copyContent(distribution.Descriptor{
+		MediaType: schema2.MediaTypeManifest,
+		Digest:    "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+	}, "source", "destination"))
+}
+
+// fakeDeletionRegistry has the manifests listed in "existing", the manifest deleted is still found by
+// the next "lazy" checks and the ones listed in "persisted" are never gone though the deletion succeeds
+type fakeDeletionRegistry struct {
+	fakeRegistry
+	existing  map[string]bool
+	persisted map[string]bool
+	lazy      int
+	pending   map[string]int
+	checks    map[string]int
+	err       error
+}
+
+func (f *fakeDeletionRegistry) ManifestExist(repository, reference string) (bool, string, error) {
+	if f.checks == nil {
+		f.checks = map[string]int{}
+	}
+	f.checks[reference]++
+	if f.err != nil && f.checks[reference] > 1 {
+		return false, "", f.err
+	}
+	if n, ok := f.pending[reference]; ok {
+		if n > 0 {
+			f.pending[reference]--
+			return true, "", nil
+		}
+		delete(f.pending, reference)
+		delete(f.existing, reference)
+	}
+	return f.existing[reference], "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", nil
+}
+
+func (f *fakeDeletionRegistry) DeleteManifest(repository, reference string) error {
+	if f.persisted[reference] {
+		return nil
+	}
+	if f.lazy > 0 {
+		if f.pending == nil {
+			f.pending = map[string]int{}
+		}
+		f.pending[reference] = f.lazy
+		return nil
+	}
+	delete(f.existing, reference)
+	return nil
 }
 
 func TestDelete(t *testing.T) {
@@ -145,7 +368,9 @@ func TestDelete(t *testing.T) {
 	tr := &transfer{
 		logger:    log.DefaultLogger(),
 		isStopped: stopFunc,
-		dst:       &fakeRegistry{},
+		dst: &fakeDeletionRegistry{
+			existing: map[string]bool{"b1": true},
+		},
 	}
 
 	repo := &repository{
@@ -155,3 +380,1454 @@ func TestDelete(t *testing.T) {
 	err := tr.delete(repo)
 	require.Nil(t, err)
 }
+
+func TestVerifyDeletion(t *testing.T) {
+	checks, interval := deletionChecks, deletionCheckInterval
+	defer func() {
+		deletionChecks, deletionCheckInterval = checks, interval
+	}()
+	deletionChecks, deletionCheckInterval = 3, time.Millisecond
+
+	// the deletion is verified
+	logger := &fakeStepLogger{Logger: log.DefaultLogger()}
+	dst := &fakeDeletionRegistry{
+		existing: map[string]bool{"b1": true},
+	}
+	tr := &transfer{
+		logger:    logger,
+		isStopped: func() bool { return false },
+		dst:       dst,
+	}
+	require.Nil(t, tr.delete(&repository{
+		repository: "destination",
+		tags:       []string{"b1", "b2"},
+	}))
+	assert.False(t, dst.existing["b1"])
+	steps := logger.steps(t)
+	require.Equal(t, 2, len(steps))
+	assert.Equal(t, trans.StepResultSucceeded, steps[0].Result)
+	assert.Equal(t, trans.StepVerificationVerified, steps[0].Verification)
+	// the tag doesn't exist at all
+	assert.Equal(t, trans.StepResultSkipped, steps[1].Result)
+	assert.Equal(t, trans.StepVerificationVerified, steps[1].Verification)
+
+	// the registry deletes the manifest lazily, it's gone in the last check
+	logger = &fakeStepLogger{Logger: log.DefaultLogger()}
+	dst = &fakeDeletionRegistry{
+		existing: map[string]bool{"b1": true},
+		lazy:     2,
+	}
+	tr.logger, tr.dst = logger, dst
+	require.Nil(t, tr.delete(&repository{
+		repository: "destination",
+		tags:       []string{"b1"},
+	}))
+	assert.Equal(t, 4, dst.checks["b1"])
+	steps = logger.steps(t)
+	require.Equal(t, 1, len(steps))
+	assert.Equal(t, trans.StepVerificationVerified, steps[0].Verification)
+
+	// the registry reports the deletion succeeded but keeps the manifest
+	logger = &fakeStepLogger{Logger: log.DefaultLogger()}
+	dst = &fakeDeletionRegistry{
+		existing:  map[string]bool{"b1": true},
+		persisted: map[string]bool{"b1": true},
+	}
+	tr.logger, tr.dst = logger, dst
+	err := tr.delete(&repository{
+		repository: "destination",
+		tags:       []string{"b1"},
+	})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "still exists")
+	// the manifest is checked before the deletion and for 3 times after it
+	assert.Equal(t, 4, dst.checks["b1"])
+	steps = logger.steps(t)
+	require.Equal(t, 1, len(steps))
+	assert.Equal(t, trans.StepPhaseDelete, steps[0].Phase)
+	assert.Equal(t, trans.StepResultFailed, steps[0].Result)
+	assert.Equal(t, trans.StepVerificationPersisted, steps[0].Verification)
+	assert.Contains(t, steps[0].Error, "still exists")
+
+	// the existence can't be checked after the deletion
+	logger = &fakeStepLogger{Logger: log.DefaultLogger()}
+	dst = &fakeDeletionRegistry{
+		existing: map[string]bool{"b1": true},
+		err:      errors.New("service unavailable"),
+	}
+	tr.logger, tr.dst = logger, dst
+	require.Nil(t, tr.delete(&repository{
+		repository: "destination",
+		tags:       []string{"b1"},
+	}))
+	steps = logger.steps(t)
+	require.Equal(t, 1, len(steps))
+	assert.Equal(t, trans.StepResultSucceeded, steps[0].Result)
+	assert.Equal(t, trans.StepVerificationUnverified, steps[0].Verification)
+}
+
+func TestCopyReferrers(t *testing.T) {
+	stopFunc := func() bool { return false }
+	dstRegistry := &fakeReferrerRegistry{}
+	tr := &transfer{
+		logger:             log.DefaultLogger(),
+		isStopped:          stopFunc,
+		src:                &fakeReferrerRegistry{},
+		dst:                dstRegistry,
+		replicateReferrers: true,
+	}
+
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	err := tr.copy(src, dst, true)
+	require.Nil(t, err)
+	assert.Equal(t, 2, tr.Referrers())
+	assert.Equal(t, []string{
+		"b2",
+		"sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"sha256:2222222222222222222222222222222222222222222222222222222222222222",
+	}, dstRegistry.pushed)
+
+	// the referrers are not replicated when the option is disabled
+	dstRegistry = &fakeReferrerRegistry{}
+	tr = &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: stopFunc,
+		src:       &fakeReferrerRegistry{},
+		dst:       dstRegistry,
+	}
+	err = tr.copy(src, dst, true)
+	require.Nil(t, err)
+	assert.Equal(t, 0, tr.Referrers())
+	assert.Equal(t, []string{"b2"}, dstRegistry.pushed)
+}
+
+func TestCopyOCIImage(t *testing.T) {
+	stopFunc := func() bool { return false }
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+
+	// the destination registry supports OCI
+	dstRegistry := &fakeOCIRegistry{supportOCI: true}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: stopFunc,
+		src:       &fakeOCIRegistry{},
+		dst:       dstRegistry,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{v1.MediaTypeImageManifest}, dstRegistry.pushed)
+
+	// the destination registry supports docker schema2 only
+	dstRegistry = &fakeOCIRegistry{supportOCI: false}
+	tr = &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: stopFunc,
+		src:       &fakeOCIRegistry{},
+		dst:       dstRegistry,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, dstRegistry.pushed)
+}
+
+// fakeCapabilityRegistry declares that it doesn't support OCI by the capabilities
+// and records the blobs and the media types of the manifests pushed in order
+type fakeCapabilityRegistry struct {
+	fakeOCIRegistry
+	operations []string
+	// the namespaces which the capabilities are probed in
+	namespaces []string
+}
+
+func (f *fakeCapabilityRegistry) Capabilities(namespace string) (map[string]string, error) {
+	f.namespaces = append(f.namespaces, namespace)
+	return map[string]string{
+		adapter.CapabilityOCIManifest: adapter.CapabilityUnsupported,
+	}, nil
+}
+
+func (f *fakeCapabilityRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	f.operations = append(f.operations, digest)
+	return nil
+}
+
+func (f *fakeCapabilityRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	f.operations = append(f.operations, mediaType)
+	return f.fakeOCIRegistry.PushManifest(repository, reference, mediaType, payload)
+}
+
+func TestCopyOCIImageByCapabilities(t *testing.T) {
+	stopFunc := func() bool { return false }
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "target/destination",
+		tags:       []string{"b2"},
+	}
+
+	// the OCI manifest is converted before uploading the blobs instead of being rejected after that
+	dstRegistry := &fakeCapabilityRegistry{}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: stopFunc,
+		src:       &fakeOCIRegistry{},
+		dst:       dstRegistry,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{
+		"sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+		"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		schema2.MediaTypeManifest,
+	}, dstRegistry.operations)
+	// the capabilities are probed inside the target namespace once
+	assert.Equal(t, []string{"target"}, dstRegistry.namespaces)
+
+	// the OCI manifest which cannot be converted is skipped without uploading any blob
+	dstRegistry = &fakeCapabilityRegistry{}
+	tr = &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: stopFunc,
+		src:       &fakeOCIRegistry{layerMediaType: "application/vnd.oci.image.layer.v1.tar+zstd"},
+		dst:       dstRegistry,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Empty(t, dstRegistry.operations)
+}
+
+func TestCopyImageWithPreferredManifestType(t *testing.T) {
+	stopFunc := func() bool { return false }
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+
+	// the OCI manifest is converted to docker schema2 which the registry prefers
+	dstRegistry := &fakeOCIRegistry{supportOCI: true}
+	tr := &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             stopFunc,
+		src:                   &fakeOCIRegistry{},
+		dst:                   dstRegistry,
+		preferredManifestType: model.ManifestTypeDocker,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, dstRegistry.pushed)
+
+	// the OCI manifest which cannot be converted is kept as it is
+	dstRegistry = &fakeOCIRegistry{supportOCI: true}
+	tr = &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             stopFunc,
+		src:                   &fakeOCIRegistry{layerMediaType: v1.MediaTypeImageLayerNonDistributable},
+		dst:                   dstRegistry,
+		preferredManifestType: model.ManifestTypeDocker,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{v1.MediaTypeImageManifest}, dstRegistry.pushed)
+
+	// the docker schema2 manifest is converted to OCI which the registry prefers
+	dstRegistry = &fakeOCIRegistry{supportOCI: true}
+	tr = &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             stopFunc,
+		src:                   &fakeRegistry{},
+		dst:                   dstRegistry,
+		preferredManifestType: model.ManifestTypeOCI,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{v1.MediaTypeImageManifest}, dstRegistry.pushed)
+
+	// the converted manifest falls back to docker schema2 when it's rejected by the registry
+	dstRegistry = &fakeOCIRegistry{}
+	tr = &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             stopFunc,
+		src:                   &fakeRegistry{},
+		dst:                   dstRegistry,
+		preferredManifestType: model.ManifestTypeOCI,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, dstRegistry.pushed)
+
+	// the docker schema2 manifest isn't converted if the registry doesn't support OCI
+	capabilityRegistry := &fakeCapabilityRegistry{}
+	tr = &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             stopFunc,
+		src:                   &fakeRegistry{},
+		dst:                   capabilityRegistry,
+		preferredManifestType: model.ManifestTypeOCI,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, capabilityRegistry.fakeOCIRegistry.pushed)
+}
+
+// fakeConvertedRegistry keeps the manifest pushed and returns it when it's pulled
+type fakeConvertedRegistry struct {
+	fakeRegistry
+	mediaType string
+	payload   []byte
+	pushed    int
+}
+
+func (f *fakeConvertedRegistry) ManifestExist(repository, reference string) (bool, string, error) {
+	if f.payload == nil {
+		return false, "", nil
+	}
+	return true, digest.FromBytes(f.payload).String(), nil
+}
+func (f *fakeConvertedRegistry) PullManifest(repository, reference string, accepttedMediaTypes []string) (distribution.Manifest, string, error) {
+	mani, _, err := pkg_registry.UnMarshal(f.mediaType, f.payload)
+	if err != nil {
+		return nil, "", err
+	}
+	return mani, digest.FromBytes(f.payload).String(), nil
+}
+func (f *fakeConvertedRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	f.mediaType = mediaType
+	f.payload = payload
+	f.pushed++
+	return nil
+}
+
+func TestCopyConvertedImage(t *testing.T) {
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	dstRegistry := &fakeConvertedRegistry{}
+	newTransfer := func() *transfer {
+		return &transfer{
+			logger:                log.DefaultLogger(),
+			isStopped:             func() bool { return false },
+			src:                   &fakeOCIRegistry{},
+			dst:                   dstRegistry,
+			preferredManifestType: model.ManifestTypeDocker,
+		}
+	}
+	tr := newTransfer()
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, 1, dstRegistry.pushed)
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, tr.MediaTypes())
+
+	// the converted copy isn't pushed again by the following runs
+	tr = newTransfer()
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, 1, dstRegistry.pushed)
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, tr.MediaTypes())
+
+	// the layers are identified by the digests as their media types are converted as well
+	manifest, _, err := (&fakeOCIRegistry{layerMediaType: v1.MediaTypeImageLayer}).PullManifest("source", "a1", nil)
+	require.Nil(t, err)
+	_, converted := tr.isConvertedCopy(manifest, "destination", "b2")
+	assert.True(t, converted)
+
+	// the image with different layers isn't the converted copy
+	manifest, _, err = (&fakeRegistry{}).PullManifest("source", "a1", nil)
+	require.Nil(t, err)
+	_, converted = tr.isConvertedCopy(manifest, "destination", "b2")
+	assert.False(t, converted)
+}
+
+func TestIsManifestRejected(t *testing.T) {
+	assert.False(t, isManifestRejected(nil))
+	assert.False(t, isManifestRejected(errors.New("error")))
+	assert.False(t, isManifestRejected(&common_http.Error{Code: http.StatusUnauthorized}))
+	assert.False(t, isManifestRejected(&common_http.Error{Code: http.StatusBadRequest}))
+	assert.True(t, isManifestRejected(&common_http.Error{Code: http.StatusUnsupportedMediaType}))
+	assert.True(t, isManifestRejected(&common_http.Error{
+		Code:      http.StatusBadRequest,
+		ErrorCode: common_http.ErrorCodeUnsupported,
+	}))
+}
+
+type fakeMountRegistry struct {
+	fakeRegistry
+	mounted []string
+	pushed  []string
+}
+
+func (f *fakeMountRegistry) MountBlob(srcRepo, digest, dstRepo string) error {
+	if srcRepo != "base" {
+		return fmt.Errorf("blob %s not found in %s", digest, srcRepo)
+	}
+	f.mounted = append(f.mounted, digest)
+	return nil
+}
+
+func (f *fakeMountRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	f.pushed = append(f.pushed, digest)
+	return nil
+}
+
+func TestMountBlob(t *testing.T) {
+	dst := &fakeMountRegistry{}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		src:       &fakeRegistry{},
+		dst:       dst,
+		blobSources: map[string]string{
+			"sha256:mounted": "base",
+			"sha256:missing": "other",
+		},
+	}
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:mounted", 0))
+	// the blob isn't in the source repository yet, transfer it
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:missing", 0))
+	// no source repository for the blob
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:unknown", 0))
+	assert.Equal(t, []string{"sha256:mounted"}, dst.mounted)
+	assert.Equal(t, []string{"sha256:missing", "sha256:unknown"}, dst.pushed)
+}
+
+// captures the info logs which the step logs are parsed from
+type fakeStepLogger struct {
+	trans.Logger
+	lines []string
+}
+
+func (f *fakeStepLogger) Info(v ...interface{}) {
+	f.lines = append(f.lines, fmt.Sprint(v...))
+}
+
+func (f *fakeStepLogger) steps(t *testing.T) []*trans.StepLog {
+	steps, err := trans.ParseStepLogs([]byte(strings.Join(f.lines, "\n")))
+	require.Nil(t, err)
+	return steps
+}
+
+func TestBlobAccounting(t *testing.T) {
+	logger := &fakeStepLogger{Logger: log.DefaultLogger()}
+	tr := &transfer{
+		logger:    logger,
+		isStopped: func() bool { return false },
+		src:       &fakeRegistry{},
+		dst:       &fakeMountRegistry{},
+		meter:     trans.NewMeter(),
+		blobSources: map[string]string{
+			"sha256:mounted": "base",
+		},
+		existingBlobs: map[string]bool{
+			blobKey("destination", "sha256:existing"): true,
+		},
+		blobAccounting: true,
+	}
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:existing", 10))
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:mounted", 20))
+	// the size of the blob pulled from the source registry is accounted
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:missing", 0))
+	assert.Equal(t, trans.ByteAccounting{
+		UploadedBlobs: 1,
+		UploadedBytes: 1,
+		SkippedBlobs:  2,
+		SkippedBytes:  30,
+	}, tr.bytes)
+
+	steps := logger.steps(t)
+	require.Len(t, steps, 3)
+	assert.Equal(t, trans.StepPhaseBlob, steps[0].Phase)
+	assert.Equal(t, "source", steps[0].Repository)
+	assert.Equal(t, "sha256:existing", steps[0].Digest)
+	assert.Equal(t, int64(10), steps[0].Size)
+	assert.Equal(t, trans.StepResultSkipped, steps[0].Result)
+	assert.Equal(t, "sha256:mounted", steps[1].Digest)
+	assert.Equal(t, trans.StepResultSkipped, steps[1].Result)
+	assert.Equal(t, "sha256:missing", steps[2].Digest)
+	assert.Equal(t, int64(1), steps[2].Size)
+	assert.Equal(t, trans.StepResultSucceeded, steps[2].Result)
+
+	// only the summary is accounted if the per-blob accounting isn't enabled
+	logger.lines = nil
+	tr.blobAccounting = false
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:existing", 10))
+	assert.Equal(t, 3, tr.bytes.SkippedBlobs)
+	assert.Equal(t, int64(40), tr.bytes.SkippedBytes)
+	assert.Empty(t, logger.steps(t))
+}
+
+func TestExpectBlobs(t *testing.T) {
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		src:       &fakeRegistry{},
+		dst:       &fakeMountRegistry{},
+		meter:     trans.NewMeter(),
+		blobSources: map[string]string{
+			"sha256:mounted": "base",
+		},
+		existingBlobs: map[string]bool{
+			blobKey("destination", "sha256:missing"):  false,
+			blobKey("destination", "sha256:mounted"):  false,
+			blobKey("destination", "sha256:existing"): true,
+		},
+	}
+	blob := func(dgt string, size int64) distribution.Descriptor {
+		return distribution.Descriptor{
+			MediaType: schema2.MediaTypeLayer,
+			Digest:    digest.Digest(dgt),
+			Size:      size,
+		}
+	}
+	// the existing, unknown and duplicated blobs aren't expected
+	tr.expectBlobs("destination", []distribution.Descriptor{
+		blob("sha256:missing", 10),
+		blob("sha256:mounted", 20),
+		blob("sha256:existing", 30),
+		blob("sha256:unknown", 40),
+		blob("sha256:missing", 10),
+	})
+	progress := tr.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(30), progress.Total)
+
+	// the blob mounted rather than pushed is withdrawn
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:mounted", 20))
+	progress = tr.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(10), progress.Total)
+
+	// the blobs expected already aren't expected again
+	tr.expectBlobs("destination", []distribution.Descriptor{blob("sha256:missing", 10)})
+	assert.Equal(t, int64(10), tr.Progress().Total)
+}
+
+func TestMountBlobFromSource(t *testing.T) {
+	dst := &fakeMountRegistry{}
+	tr := &transfer{
+		logger:     log.DefaultLogger(),
+		isStopped:  func() bool { return false },
+		src:        &fakeRegistry{},
+		dst:        dst,
+		mountBlobs: true,
+		blobSources: map[string]string{
+			"sha256:shared": "other",
+		},
+	}
+	// the source repository is on the same registry backend
+	require.Nil(t, tr.copyBlob("base", "destination", "sha256:mounted", 0))
+	// the blob cannot be mounted from the blob source, the source repository is tried then
+	require.Nil(t, tr.copyBlob("base", "destination", "sha256:shared", 0))
+	// the blob cannot be mounted from the source repository, fall back to the normal upload
+	require.Nil(t, tr.copyBlob("source", "destination", "sha256:missing", 0))
+	assert.Equal(t, []string{"sha256:mounted", "sha256:shared"}, dst.mounted)
+	assert.Equal(t, []string{"sha256:missing"}, dst.pushed)
+
+	// mounting the blobs isn't enabled
+	dst = &fakeMountRegistry{}
+	tr.dst = dst
+	tr.existingBlobs = nil
+	tr.mountBlobs = false
+	require.Nil(t, tr.copyBlob("base", "destination", "sha256:mounted", 0))
+	assert.Empty(t, dst.mounted)
+	assert.Equal(t, []string{"sha256:mounted"}, dst.pushed)
+}
+
+var uncompressedLayer = []byte("the content of the uncompressed layer")
+
+// fakeCompressRegistry returns the docker schema2 manifest with an uncompressed layer
+// and a compressed one when pulling, and records the pushed blobs and manifest
+type fakeCompressRegistry struct {
+	fakeRegistry
+	// the content of the uncompressed layer returned when pulling
+	content  []byte
+	blobs    map[string][]byte
+	manifest distribution.Manifest
+}
+
+func (f *fakeCompressRegistry) PullManifest(repository, reference string, accepttedMediaTypes []string) (distribution.Manifest, string, error) {
+	if f.manifest != nil {
+		return f.manifest, "", nil
+	}
+	manifest := fmt.Sprintf(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		"config": {
+			"mediaType": "application/vnd.docker.container.image.v1+json",
+			"size": 7023,
+			"digest": "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"
+		},
+		"layers": [
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar",
+				"size": %d,
+				"digest": "%s"
+			},
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"size": 32654,
+				"digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+			}
+		]
+	}`, len(uncompressedLayer), digest.FromBytes(uncompressedLayer))
+	mani, _, err := pkg_registry.UnMarshal(schema2.MediaTypeManifest, []byte(manifest))
+	if err != nil {
+		return nil, "", err
+	}
+	return mani, "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", nil
+}
+
+func (f *fakeCompressRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	manifest, _, err := pkg_registry.UnMarshal(mediaType, payload)
+	if err != nil {
+		return err
+	}
+	f.manifest = manifest
+	return nil
+}
+
+func (f *fakeCompressRegistry) PullBlob(repository, dgt string) (int64, io.ReadCloser, error) {
+	if dgt == digest.FromBytes(uncompressedLayer).String() {
+		return int64(len(f.content)), ioutil.NopCloser(bytes.NewReader(f.content)), nil
+	}
+	return f.fakeRegistry.PullBlob(repository, dgt)
+}
+
+func (f *fakeCompressRegistry) PushBlob(repository, dgt string, size int64, blob io.Reader) error {
+	data, err := ioutil.ReadAll(blob)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("the size of blob %s mismatches: %d != %d", dgt, len(data), size)
+	}
+	if f.blobs == nil {
+		f.blobs = map[string][]byte{}
+	}
+	f.blobs[dgt] = data
+	return nil
+}
+
+func TestCopyCompressedImage(t *testing.T) {
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	dstRegistry := &fakeCompressRegistry{}
+	tr := &transfer{
+		logger:         log.DefaultLogger(),
+		isStopped:      func() bool { return false },
+		src:            &fakeCompressRegistry{content: uncompressedLayer},
+		dst:            dstRegistry,
+		compressLayers: true,
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+
+	// the uncompressed layer is replaced by the compressed one
+	_, layers, ok := configAndLayers(dstRegistry.manifest)
+	require.True(t, ok)
+	require.Equal(t, 2, len(layers))
+	assert.Equal(t, schema2.MediaTypeLayer, layers[0].MediaType)
+	assert.NotEqual(t, digest.FromBytes(uncompressedLayer), layers[0].Digest)
+	// the compressed layer is untouched
+	assert.Equal(t, schema2.MediaTypeLayer, layers[1].MediaType)
+	assert.Equal(t, "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f", layers[1].Digest.String())
+
+	// the pushed blob matches the digest in the manifest and can be decompressed to the original content
+	blob, exist := dstRegistry.blobs[layers[0].Digest.String()]
+	require.True(t, exist)
+	assert.Equal(t, layers[0].Digest, digest.FromBytes(blob))
+	assert.Equal(t, int64(len(blob)), layers[0].Size)
+	reader, err := gzip.NewReader(bytes.NewReader(blob))
+	require.Nil(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal(t, uncompressedLayer, content)
+
+	// the image on the destination registry is recognized as the compressed copy
+	manifest, _, err := tr.pullManifest("source", "a1")
+	require.Nil(t, err)
+	assert.True(t, tr.isCompressedCopy(manifest, "destination", "b2"))
+}
+
+func TestCompressCorruptedLayer(t *testing.T) {
+	tr := &transfer{
+		logger:         log.DefaultLogger(),
+		isStopped:      func() bool { return false },
+		src:            &fakeCompressRegistry{content: []byte("corrupted")},
+		dst:            &fakeCompressRegistry{},
+		compressLayers: true,
+	}
+	err := tr.copy(&repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}, &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}, true)
+	assert.NotNil(t, err)
+}
+
+// fakeStorageRegistry reports the available storage and records the blobs and manifests pushed
+type fakeStorageRegistry struct {
+	fakeRegistry
+	available int64
+	err       error
+	existing  map[string]bool
+	pushed    []string
+}
+
+func (f *fakeStorageRegistry) AvailableStorage(repository string) (int64, error) {
+	return f.available, f.err
+}
+
+func (f *fakeStorageRegistry) BlobExist(repository, digest string) (bool, error) {
+	return f.existing[digest], nil
+}
+
+func (f *fakeStorageRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	f.pushed = append(f.pushed, digest)
+	return nil
+}
+
+func (f *fakeStorageRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	f.pushed = append(f.pushed, mediaType)
+	return nil
+}
+
+func TestCheckStorage(t *testing.T) {
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	// the total size of the config and layers of the image is 129510 bytes
+	newTransfer := func(dst adapter.ImageRegistry) *transfer {
+		return &transfer{
+			logger:    log.DefaultLogger(),
+			isStopped: func() bool { return false },
+			src:       &fakeRegistry{},
+			dst:       dst,
+		}
+	}
+
+	// fail fast without pushing anything
+	registry := &fakeStorageRegistry{available: 100000}
+	err := newTransfer(registry).copy(src, dst, true)
+	require.NotNil(t, err)
+	e, ok := err.(*trans.InsufficientStorageError)
+	require.True(t, ok)
+	assert.Equal(t, "destination", e.Repository)
+	assert.Equal(t, int64(129510), e.Required)
+	assert.Equal(t, int64(100000), e.Available)
+	assert.Empty(t, registry.pushed)
+
+	// the storage is sufficient and the size of the image is deducted
+	registry = &fakeStorageRegistry{available: 200000}
+	tr := newTransfer(registry)
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, 5, len(registry.pushed))
+	require.NotNil(t, tr.availableStorage)
+	assert.Equal(t, int64(70490), *tr.availableStorage)
+
+	// the blobs which exist on the destination registry aren't counted
+	registry = &fakeStorageRegistry{
+		available: 60000,
+		existing: map[string]bool{
+			"sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736": true,
+		},
+	}
+	require.Nil(t, newTransfer(registry).copy(src, dst, true))
+	assert.Equal(t, 4, len(registry.pushed))
+
+	// the storage isn't limited
+	registry = &fakeStorageRegistry{available: -1}
+	require.Nil(t, newTransfer(registry).copy(src, dst, true))
+	assert.Equal(t, 5, len(registry.pushed))
+
+	// the check is skipped if the storage info cannot be got
+	registry = &fakeStorageRegistry{err: errors.New("error")}
+	require.Nil(t, newTransfer(registry).copy(src, dst, true))
+	assert.Equal(t, 5, len(registry.pushed))
+}
+
+type fakeImmutableRegistry struct {
+	fakeRegistry
+	supported  bool
+	repository string
+	tags       []string
+}
+
+func (f *fakeImmutableRegistry) SupportTagImmutability() (bool, error) {
+	return f.supported, nil
+}
+
+func (f *fakeImmutableRegistry) MakeTagsImmutable(repository string, tags []string) error {
+	f.repository = repository
+	f.tags = tags
+	return nil
+}
+
+func TestMakeTagsImmutable(t *testing.T) {
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1", "a2", "a3"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b1", "b2", "b3"},
+	}
+
+	// the destination registry supports the tag immutability
+	registry := &fakeImmutableRegistry{supported: true}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		dst:       registry,
+	}
+	tr.makeTagsImmutable(src, dst, []string{"a1", "a3", "a4"})
+	assert.Equal(t, "destination", registry.repository)
+	assert.Equal(t, []string{"b1", "b3"}, registry.tags)
+
+	// the version of the destination registry doesn't support the tag immutability
+	registry = &fakeImmutableRegistry{}
+	tr.dst = registry
+	tr.makeTagsImmutable(src, dst, []string{"a1"})
+	assert.Nil(t, registry.tags)
+
+	// no immutable tags replicated
+	registry = &fakeImmutableRegistry{supported: true}
+	tr.dst = registry
+	tr.makeTagsImmutable(src, dst, []string{"a4"})
+	assert.Nil(t, registry.tags)
+
+	// the destination registry doesn't implement the tag immutability, only warns
+	tr.dst = &fakeRegistry{}
+	tr.makeTagsImmutable(src, dst, []string{"a1"})
+}
+
+type fakeWarmerRegistry struct {
+	fakeRegistry
+	counts []int
+}
+
+func (f *fakeWarmerRegistry) WarmUp(ctx context.Context, count int) (int, error) {
+	f.counts = append(f.counts, count)
+	return count, nil
+}
+
+func TestWarmUp(t *testing.T) {
+	defer func() {
+		warmedUpAt = map[string]time.Time{}
+		warmupStatuses = map[int64]*model.WarmupStatus{}
+	}()
+	registry := &fakeWarmerRegistry{}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		dst:       registry,
+	}
+	reg := &model.Registry{
+		ID:                1,
+		URL:               "https://registry.harbor.com",
+		WarmupConnections: 10,
+		MaxConnections:    3,
+	}
+	// capped by the max connections
+	tr.warmUp(reg)
+	assert.Equal(t, []int{3}, registry.counts)
+	statuses := WarmupStatuses()
+	require.Equal(t, 1, len(statuses))
+	assert.Equal(t, int64(1), statuses[0].RegistryID)
+	assert.Equal(t, reg.URL, statuses[0].Endpoint)
+	assert.Equal(t, 3, statuses[0].Requested)
+	assert.Equal(t, 3, statuses[0].Established)
+	assert.Empty(t, statuses[0].Error)
+
+	// the endpoint warmed up recently isn't warmed up again by the following transfers
+	tr.warmUp(reg)
+	assert.Equal(t, 1, len(registry.counts))
+
+	// the endpoint reached through the tunnel is warmed up separately
+	tunneled := *reg
+	tunneled.SSHTunnel = &pkg_registry.SSHTunnel{Host: "jump.example.com", User: "harbor"}
+	tr.warmUp(&tunneled)
+	assert.Equal(t, 2, len(registry.counts))
+
+	// warmed up again after the interval
+	warmedUpAt[warmupKey(reg)] = time.Now().Add(-2 * warmupInterval)
+	tr.warmUp(reg)
+	assert.Equal(t, 3, len(registry.counts))
+
+	// warmed up again when the resolution of the host changes
+	defer pkg_registry.SetResolver("", nil)
+	require.Nil(t, pkg_registry.SetResolver("", map[string]string{"registry.harbor.com": "127.0.0.1"}))
+	tr.warmUp(reg)
+	assert.Equal(t, 4, len(registry.counts))
+
+	// the adapter doesn't support the warmup
+	tr.dst = &fakeRegistry{}
+	tr.warmUp(&model.Registry{URL: "https://another.harbor.com", WarmupConnections: 1})
+}
+
+// fakeWarmerAdapter is the adapter whose image registry supports the warmup
+type fakeWarmerAdapter struct {
+	fakeWarmerRegistry
+}
+
+func (f *fakeWarmerAdapter) Info() (*model.RegistryInfo, error) {
+	return &model.RegistryInfo{}, nil
+}
+
+func (f *fakeWarmerAdapter) PrepareForPush([]*model.Resource) error {
+	return nil
+}
+
+func (f *fakeWarmerAdapter) HealthCheck() (model.HealthStatus, error) {
+	return model.Healthy, nil
+}
+
+// fakeNonWarmerAdapter is the adapter whose image registry doesn't support the warmup
+type fakeNonWarmerAdapter struct {
+	fakeRegistry
+}
+
+func (f *fakeNonWarmerAdapter) Info() (*model.RegistryInfo, error) {
+	return &model.RegistryInfo{}, nil
+}
+
+func (f *fakeNonWarmerAdapter) PrepareForPush([]*model.Resource) error {
+	return nil
+}
+
+func (f *fakeNonWarmerAdapter) HealthCheck() (model.HealthStatus, error) {
+	return model.Healthy, nil
+}
+
+func TestWarmUpOnDemand(t *testing.T) {
+	defer func() {
+		warmedUpAt = map[string]time.Time{}
+		warmupStatuses = map[int64]*model.WarmupStatus{}
+	}()
+	warmer := &fakeWarmerAdapter{}
+	require.Nil(t, adapter.RegisterFactory("fake-warmer", func(*model.Registry) (adapter.Adapter, error) {
+		return warmer, nil
+	}))
+	require.Nil(t, adapter.RegisterFactory("fake-non-warmer", func(*model.Registry) (adapter.Adapter, error) {
+		return &fakeNonWarmerAdapter{}, nil
+	}))
+
+	reg := &model.Registry{
+		ID:                2,
+		Type:              "fake-warmer",
+		URL:               "https://registry.harbor.com",
+		WarmupConnections: 2,
+	}
+	status, err := WarmUp(reg)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), status.RegistryID)
+	assert.Equal(t, 2, status.Established)
+	assert.Equal(t, []*model.WarmupStatus{status}, WarmupStatuses())
+
+	// the warmup on demand isn't skipped even if the endpoint was warmed up recently
+	_, err = WarmUp(reg)
+	require.Nil(t, err)
+	assert.Equal(t, []int{2, 2}, warmer.counts)
+
+	// the adapter doesn't support the warmup
+	_, err = WarmUp(&model.Registry{ID: 3, Type: "fake-non-warmer", URL: "https://another.harbor.com"})
+	assert.Equal(t, ErrWarmupUnsupported, err)
+}
+
+// fakeDryRunRegistry has the image config only and records the blobs checked and everything pushed or mounted
+type fakeDryRunRegistry struct {
+	fakeMountRegistry
+	lock      sync.Mutex
+	checked   []string
+	manifests []string
+	deleted   []string
+}
+
+func (f *fakeDryRunRegistry) BlobExist(repository, digest string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.checked = append(f.checked, digest)
+	return digest == "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", nil
+}
+
+func (f *fakeDryRunRegistry) PushManifest(repository, reference, mediaType string, payload []byte) error {
+	f.manifests = append(f.manifests, reference)
+	return nil
+}
+
+func (f *fakeDryRunRegistry) DeleteManifest(repository, reference string) error {
+	f.deleted = append(f.deleted, reference)
+	return nil
+}
+
+func TestCopyDryRun(t *testing.T) {
+	dstRegistry := &fakeDryRunRegistry{}
+	tr := &transfer{
+		logger:         log.DefaultLogger(),
+		isStopped:      func() bool { return false },
+		src:            &fakeRegistry{},
+		dst:            dstRegistry,
+		mountBlobs:     true,
+		compressLayers: true,
+		dryRun:         true,
+	}
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Len(t, dstRegistry.checked, 4)
+	// the existing config isn't reported
+	assert.Equal(t, []string{
+		"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		"sha256:3c3a4604a545cdc127456d94e421cd355bca5b528f4a9c1905b15da2eb4a4c6b",
+		"sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736",
+	}, tr.pendingBlobs)
+	// nothing is pushed or mounted
+	assert.Empty(t, dstRegistry.pushed)
+	assert.Empty(t, dstRegistry.mounted)
+	assert.Empty(t, dstRegistry.manifests)
+
+	// the existing image isn't deleted
+	require.Nil(t, tr.delete(&repository{
+		repository: "destination",
+		tags:       []string{"b1"},
+	}))
+	assert.Empty(t, dstRegistry.deleted)
+}
+
+// fakeSlowRegistry takes a while to answer the existence checks of the blobs as a remote registry does,
+// the blobs listed in "existing" exist and the checks of the blobs listed in "failing" fail
+type fakeSlowRegistry struct {
+	fakeRegistry
+	latency  time.Duration
+	existing map[string]bool
+	failing  map[string]bool
+	checked  int32
+	running  int32
+	peak     int32
+}
+
+func (f *fakeSlowRegistry) BlobExist(repository, digest string) (bool, error) {
+	atomic.AddInt32(&f.checked, 1)
+	running := atomic.AddInt32(&f.running, 1)
+	defer atomic.AddInt32(&f.running, -1)
+	for {
+		peak := atomic.LoadInt32(&f.peak)
+		if running <= peak || atomic.CompareAndSwapInt32(&f.peak, peak, running) {
+			break
+		}
+	}
+	time.Sleep(f.latency)
+	if f.failing[digest] {
+		return false, errors.New("error")
+	}
+	return f.existing[digest], nil
+}
+
+// build the image manifest which has the specified count of layers
+func manifestWithLayers(count int) distribution.Manifest {
+	m := &schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: schema2.MediaTypeImageConfig,
+			Digest:    digest.FromString("config"),
+		},
+	}
+	for i := 0; i < count; i++ {
+		m.Layers = append(m.Layers, distribution.Descriptor{
+			MediaType: schema2.MediaTypeLayer,
+			Digest:    digest.FromString(fmt.Sprintf("layer%d", i)),
+		})
+	}
+	manifest, _ := schema2.FromStruct(*m)
+	return manifest
+}
+
+func TestCheckBlobs(t *testing.T) {
+	manifest := manifestWithLayers(12)
+	blobs := manifest.References()
+	// the duplicated layer and the foreign layer aren't checked
+	blobs = append(blobs, blobs[1], distribution.Descriptor{
+		MediaType: schema2.MediaTypeForeignLayer,
+		Digest:    digest.FromString("foreign"),
+	})
+	dst := &fakeSlowRegistry{
+		latency:  10 * time.Millisecond,
+		existing: map[string]bool{blobs[0].Digest.String(): true},
+		failing:  map[string]bool{blobs[2].Digest.String(): true},
+	}
+	tr := &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		src:       &fakeRegistry{},
+		dst:       dst,
+	}
+	tr.checkBlobs("destination", blobs)
+	assert.Equal(t, int32(13), atomic.LoadInt32(&dst.checked))
+	assert.True(t, dst.peak > 1)
+	assert.True(t, dst.peak <= blobCheckConcurrency)
+	// the failed check isn't cached
+	assert.Len(t, tr.existingBlobs, 12)
+
+	// the cached results are used
+	exist, err := tr.blobExist("destination", blobs[0].Digest.String())
+	require.Nil(t, err)
+	assert.True(t, exist)
+	exist, err = tr.blobExist("destination", blobs[1].Digest.String())
+	require.Nil(t, err)
+	assert.False(t, exist)
+	tr.checkBlobs("destination", blobs)
+	assert.Equal(t, int32(14), atomic.LoadInt32(&dst.checked))
+	// the blob failed to be checked is checked again
+	_, err = tr.blobExist("destination", blobs[2].Digest.String())
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(15), atomic.LoadInt32(&dst.checked))
+
+	// the blobs of the other repository aren't cached
+	tr.checkBlobs("other", blobs[:1])
+	assert.Equal(t, int32(16), atomic.LoadInt32(&dst.checked))
+
+	// the pushed blob is cached as existing
+	require.Nil(t, tr.copyBlob("source", "destination", blobs[1].Digest.String(), blobs[1].Size))
+	exist, err = tr.blobExist("destination", blobs[1].Digest.String())
+	require.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, int32(16), atomic.LoadInt32(&dst.checked))
+}
+
+func benchmarkBlobExistence(b *testing.B, check func(tr *transfer, blobs []distribution.Descriptor)) {
+	blobs := manifestWithLayers(10).References()
+	for i := 0; i < b.N; i++ {
+		tr := &transfer{
+			logger:    log.DefaultLogger(),
+			isStopped: func() bool { return false },
+			dst:       &fakeSlowRegistry{latency: time.Millisecond},
+		}
+		check(tr, blobs)
+	}
+}
+
+func BenchmarkBlobExistenceSequential(b *testing.B) {
+	benchmarkBlobExistence(b, func(tr *transfer, blobs []distribution.Descriptor) {
+		for _, blob := range blobs {
+			tr.blobExist("destination", blob.Digest.String())
+		}
+	})
+}
+
+func BenchmarkBlobExistenceParallel(b *testing.B) {
+	benchmarkBlobExistence(b, func(tr *transfer, blobs []distribution.Descriptor) {
+		tr.checkBlobs("destination", blobs)
+	})
+}
+
+func TestCopyImageWithDisallowedLayers(t *testing.T) {
+	foreign := v1.MediaTypeImageLayerNonDistributableGzip
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a2"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	newTransfer := func(mediaTypes *model.LayerMediaTypes) (*transfer, *fakeOCIRegistry) {
+		dstRegistry := &fakeOCIRegistry{supportOCI: true}
+		return &transfer{
+			logger:          log.DefaultLogger(),
+			isStopped:       func() bool { return false },
+			src:             &fakeOCIRegistry{layerMediaType: foreign},
+			dst:             dstRegistry,
+			meter:           trans.NewMeter(),
+			layerMediaTypes: mediaTypes,
+		}, dstRegistry
+	}
+
+	// the image containing the denied layers is skipped
+	tr, dstRegistry := newTransfer(&model.LayerMediaTypes{Denied: []string{foreign}})
+	err := tr.copyImage("source", "a2", "destination", "b2", true)
+	require.NotNil(t, err)
+	_, skipped := err.(*trans.SkippedError)
+	assert.True(t, skipped)
+	assert.Contains(t, err.Error(), foreign)
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Empty(t, dstRegistry.pushed)
+
+	// the image containing the layers which aren't allowed fails
+	tr, dstRegistry = newTransfer(&model.LayerMediaTypes{
+		Allowed: []string{v1.MediaTypeImageLayerGzip},
+		Action:  model.MediaTypeActionFail,
+	})
+	err = tr.copy(src, dst, true)
+	require.NotNil(t, err)
+	_, skipped = err.(*trans.SkippedError)
+	assert.False(t, skipped)
+	assert.Contains(t, err.Error(), foreign)
+	assert.Empty(t, dstRegistry.pushed)
+
+	// the foreign layers are allowed
+	tr, dstRegistry = newTransfer(&model.LayerMediaTypes{
+		Allowed: []string{v1.MediaTypeImageLayerGzip, foreign},
+		Action:  model.MediaTypeActionFail,
+	})
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{v1.MediaTypeImageManifest}, dstRegistry.pushed)
+
+	// no limitation
+	tr, dstRegistry = newTransfer(nil)
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{v1.MediaTypeImageManifest}, dstRegistry.pushed)
+}
+
+func TestCopyImageWithConvertedLayers(t *testing.T) {
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a2"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b2"},
+	}
+	// the OCI layers are converted to the docker ones which the registry allows
+	dstRegistry := &fakeOCIRegistry{supportOCI: true}
+	tr := &transfer{
+		logger:                log.DefaultLogger(),
+		isStopped:             func() bool { return false },
+		src:                   &fakeOCIRegistry{},
+		dst:                   dstRegistry,
+		meter:                 trans.NewMeter(),
+		preferredManifestType: model.ManifestTypeDocker,
+		layerMediaTypes: &model.LayerMediaTypes{
+			Allowed: []string{schema2.MediaTypeLayer},
+			Action:  model.MediaTypeActionFail,
+		},
+	}
+	require.Nil(t, tr.copy(src, dst, true))
+	assert.Equal(t, []string{schema2.MediaTypeManifest}, dstRegistry.pushed)
+
+	// the docker layers converted from the OCI ones when the push is rejected are denied
+	dstRegistry = &fakeOCIRegistry{supportOCI: false}
+	tr = &transfer{
+		logger:    log.DefaultLogger(),
+		isStopped: func() bool { return false },
+		src:       &fakeOCIRegistry{},
+		dst:       dstRegistry,
+		meter:     trans.NewMeter(),
+		layerMediaTypes: &model.LayerMediaTypes{
+			Denied: []string{schema2.MediaTypeLayer},
+		},
+	}
+	err := tr.copyImage("source", "a2", "destination", "b2", true)
+	require.NotNil(t, err)
+	_, skipped := err.(*trans.SkippedError)
+	assert.True(t, skipped)
+	assert.Empty(t, dstRegistry.pushed)
+}
+
+// fakeDigestRegistry returns the digests of the tags from the map and records the manifests pulled
+type fakeDigestRegistry struct {
+	fakeRegistry
+	digests map[string]string
+	pulled  []string
+}
+
+func (f *fakeDigestRegistry) ManifestExist(repository, reference string) (bool, string, error) {
+	digest, exist := f.digests[repository+":"+reference]
+	return exist, digest, nil
+}
+
+func (f *fakeDigestRegistry) PullManifest(repository, reference string, accepttedMediaTypes []string) (distribution.Manifest, string, error) {
+	f.pulled = append(f.pulled, repository+":"+reference)
+	return f.fakeRegistry.PullManifest(repository, reference, accepttedMediaTypes)
+}
+
+func TestCopyUpToDateRepository(t *testing.T) {
+	digests := map[string]string{
+		"source:a1":      "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+		"source:a2":      "sha256:d6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+		"destination:b1": "sha256:c6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+		"destination:b2": "sha256:d6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+	}
+	src := &repository{
+		repository: "source",
+		tags:       []string{"a1", "a2"},
+	}
+	dst := &repository{
+		repository: "destination",
+		tags:       []string{"b1", "b2"},
+	}
+	newTransfer := func(logger trans.Logger, srcReg adapter.ImageRegistry) *transfer {
+		return &transfer{
+			logger:    logger,
+			isStopped: func() bool { return false },
+			src:       srcReg,
+			dst:       &fakeDigestRegistry{digests: digests},
+			meter:     trans.NewMeter(),
+		}
+	}
+
+	// all the tags are identical, the repository is skipped without pulling any manifest
+	logger := &fakeStepLogger{Logger: log.DefaultLogger()}
+	srcReg := &fakeDigestRegistry{digests: digests}
+	require.Nil(t, newTransfer(logger, srcReg).copy(src, dst, true))
+	assert.Empty(t, srcReg.pulled)
+	steps := logger.steps(t)
+	require.Len(t, steps, 1)
+	assert.Equal(t, trans.StepPhaseRepository, steps[0].Phase)
+	assert.Equal(t, trans.StepResultUpToDate, steps[0].Result)
+
+	// one tag differs, the repository is copied tag by tag
+	differing := map[string]string{}
+	for k, v := range digests {
+		differing[k] = v
+	}
+	differing["source:a2"] = "sha256:e6b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"
+	logger = &fakeStepLogger{Logger: log.DefaultLogger()}
+	srcReg = &fakeDigestRegistry{digests: differing}
+	require.Nil(t, newTransfer(logger, srcReg).copy(src, dst, true))
+	assert.Equal(t, []string{"source:a1", "source:a2"}, srcReg.pulled)
+	for _, step := range logger.steps(t) {
+		assert.NotEqual(t, trans.StepResultUpToDate, step.Result)
+	}
+
+	// the referrers aren't covered by the digests of the tags
+	srcReg = &fakeDigestRegistry{digests: digests}
+	tr := newTransfer(log.DefaultLogger(), srcReg)
+	tr.replicateReferrers = true
+	assert.False(t, tr.upToDate(src, dst))
+	assert.Empty(t, srcReg.pulled)
+}
+
+// fakeStreamRegistry serves the blob content regardless of the digest requested and stores
+// the blob pushed only if the declared size is read completely, as the registry does
+type fakeStreamRegistry struct {
+	fakeRegistry
+	content []byte
+	pushed  map[string][]byte
+}
+
+func (f *fakeStreamRegistry) PullBlob(repository, digest string) (int64, io.ReadCloser, error) {
+	return int64(len(f.content)), ioutil.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+func (f *fakeStreamRegistry) PushBlob(repository, digest string, size int64, blob io.Reader) error {
+	// the HTTP client stops reading the body once the content length is sent
+	data := make([]byte, size)
+	if _, err := io.ReadFull(blob, data); err != nil {
+		return err
+	}
+	if f.pushed == nil {
+		f.pushed = map[string][]byte{}
+	}
+	f.pushed[digest] = data
+	return nil
+}
+
+func TestDigestVerifyingReader(t *testing.T) {
+	content := []byte("the content of the blob")
+	dgt := digest.FromBytes(content).String()
+
+	// the digest and size match
+	reader, err := newDigestVerifyingReader(bytes.NewReader(content), dgt, int64(len(content)))
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal(t, content, data)
+
+	// the size is unknown
+	reader, err = newDigestVerifyingReader(bytes.NewReader(content), dgt, 0)
+	require.Nil(t, err)
+	data, err = ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal(t, content, data)
+
+	// the corrupted content, the last bytes are withheld
+	corrupted := append([]byte{}, content...)
+	corrupted[len(corrupted)-1] = '!'
+	reader, err = newDigestVerifyingReader(iotest.OneByteReader(bytes.NewReader(corrupted)), dgt, int64(len(corrupted)))
+	require.Nil(t, err)
+	data, err = ioutil.ReadAll(reader)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "doesn't match the expected digest "+dgt)
+	assert.Equal(t, corrupted[:len(corrupted)-1], data)
+
+	// the corrupted content with the unknown size
+	reader, err = newDigestVerifyingReader(bytes.NewReader(corrupted), dgt, 0)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "doesn't match the expected digest")
+
+	// the content is larger than the size
+	reader, err = newDigestVerifyingReader(bytes.NewReader(content), dgt, int64(len(content)-1))
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "larger than its size")
+
+	// the content is truncated
+	reader, err = newDigestVerifyingReader(bytes.NewReader(content[:5]), dgt, int64(len(content)))
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "smaller than its size")
+
+	// invalid digest
+	_, err = newDigestVerifyingReader(bytes.NewReader(content), "sha256:invalid", int64(len(content)))
+	assert.NotNil(t, err)
+}
+
+func TestCopyCorruptedBlob(t *testing.T) {
+	content := []byte("the content of the blob")
+	dgt := digest.FromBytes(content).String()
+	src := &fakeStreamRegistry{content: content}
+	dst := &fakeStreamRegistry{}
+	tr, err := factory(log.DefaultLogger(), func() bool { return false })
+	require.Nil(t, err)
+	transfer := tr.(*transfer)
+	transfer.src = src
+	transfer.dst = dst
+
+	// the intact blob is pushed
+	require.Nil(t, transfer.copyBlob("source", "destination", dgt, int64(len(content))))
+	assert.Equal(t, content, dst.pushed[dgt])
+
+	// the corrupted stream aborts the upload, nothing is stored on the destination registry
+	corrupted := append([]byte{}, content...)
+	corrupted[0] = '!'
+	src.content = corrupted
+	dst.pushed = nil
+	err = transfer.copyBlob("source", "destination-corrupted", dgt, int64(len(corrupted)))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("doesn't match the expected digest %s, the upload is aborted", dgt))
+	assert.Empty(t, dst.pushed)
+}
@@ -0,0 +1,257 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the interval to check whether the transfer is stopped when waiting for a connection slot
+var stopCheckInterval = 1 * time.Second
+
+// Limiter is the connection limiter shared by all the transfers running in the process
+var Limiter = NewConnectionLimiter()
+
+// the max count of concurrent operations against the registries which have no limitation configured
+var defaultMaxConnections int32
+
+// SetDefaultMaxConnections sets the max count of concurrent operations against the registries
+// which have no limitation configured, it can be changed at runtime and takes effect on the
+// transfers started afterwards
+func SetDefaultMaxConnections(max int) {
+	atomic.StoreInt32(&defaultMaxConnections, int32(max))
+}
+
+// MaxConnections returns the max count of concurrent operations against the registry according
+// to the limitation configured on it, the default one is returned if it has no limitation configured
+func MaxConnections(max int) int {
+	if max > 0 {
+		return max
+	}
+	return int(atomic.LoadInt32(&defaultMaxConnections))
+}
+
+// the parameters of the adaptive limitation
+const (
+	// the max count of concurrent operations the adaptive limitation starts with
+	initialAdaptiveConnections = 2
+	// the max count of concurrent operations the adaptive limitation ramps up to against
+	// the registries which have no limitation configured
+	maxAdaptiveConnections = 32
+	// the operation slower than the average latency multiplied by the factor backs off the limitation
+	latencyRiseFactor = 2
+	// the weight of the latest latency in the moving average
+	latencyWeight = 0.2
+)
+
+// whether the max count of concurrent operations against the registries is tuned adaptively
+var adaptiveConnections int32
+
+// SetAdaptiveConnections enables or disables tuning the max count of concurrent operations against the
+// registries adaptively. When it's enabled, the limitation of the registry is increased by one for every
+// "limitation" operations which succeed with the stable latency and halved when the operation fails or its
+// latency rises (AIMD), the limitation configured on the registry or the default one is the ceiling
+func SetAdaptiveConnections(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&adaptiveConnections, v)
+}
+
+func isAdaptive() bool {
+	return atomic.LoadInt32(&adaptiveConnections) == 1
+}
+
+// ConnectionLimiter limits the count of concurrent operations against every
+// registry, the registries are identified by the keys(e.g. the URLs)
+type ConnectionLimiter struct {
+	sync.Mutex
+	active map[string]int
+	// the channel is closed when a slot of the key is released to wake up the waiters
+	released map[string]chan struct{}
+	// the max counts of the keys passed when acquiring the slots
+	maxes map[string]int
+	// the states of the adaptive limitation of the keys
+	adaptive map[string]*adaptiveLimit
+}
+
+// the state of the adaptive limitation of a key
+type adaptiveLimit struct {
+	limit float64
+	// the moving average of the latencies of the operations
+	latency time.Duration
+}
+
+// ConnectionStatus is the status of the concurrent operations against a registry
+type ConnectionStatus struct {
+	Key    string `json:"key"`
+	Active int    `json:"active"`
+	// the max count of concurrent operations in effect, 0 means no limitation
+	Limit int `json:"limit"`
+}
+
+// NewConnectionLimiter returns an instance of ConnectionLimiter
+func NewConnectionLimiter() *ConnectionLimiter {
+	return &ConnectionLimiter{
+		active:   map[string]int{},
+		released: map[string]chan struct{}{},
+		maxes:    map[string]int{},
+		adaptive: map[string]*adaptiveLimit{},
+	}
+}
+
+// Acquire blocks until the count of active operations of the key is less than the max
+// and then occupies a slot. The max less than or equal to 0 means no limitation.
+// It returns false without occupying a slot if the transfer is stopped when waiting
+func (c *ConnectionLimiter) Acquire(key string, max int, stopFunc StopFunc) bool {
+	for {
+		c.Lock()
+		c.maxes[key] = max
+		limit := c.limit(key)
+		if limit <= 0 || c.active[key] < limit {
+			c.active[key]++
+			c.Unlock()
+			return true
+		}
+		ch, exist := c.released[key]
+		if !exist {
+			ch = make(chan struct{})
+			c.released[key] = ch
+		}
+		c.Unlock()
+
+		select {
+		case <-ch:
+		case <-time.After(stopCheckInterval):
+			if stopFunc != nil && stopFunc() {
+				return false
+			}
+		}
+	}
+}
+
+// Release releases the slot occupied by "Acquire"
+func (c *ConnectionLimiter) Release(key string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.active[key] <= 1 {
+		delete(c.active, key)
+	} else {
+		c.active[key]--
+	}
+	c.wakeUp(key)
+}
+
+// wake up the waiters of the key, the caller must hold the lock
+func (c *ConnectionLimiter) wakeUp(key string) {
+	if ch, exist := c.released[key]; exist {
+		close(ch)
+		delete(c.released, key)
+	}
+}
+
+// the max count of concurrent operations of the key in effect, the caller must hold the lock
+func (c *ConnectionLimiter) limit(key string) int {
+	max := c.maxes[key]
+	if !isAdaptive() {
+		return max
+	}
+	ceiling := max
+	if ceiling <= 0 {
+		ceiling = maxAdaptiveConnections
+	}
+	limit := initialAdaptiveConnections
+	if a, exist := c.adaptive[key]; exist {
+		limit = int(a.limit)
+	}
+	if limit > ceiling {
+		limit = ceiling
+	}
+	return limit
+}
+
+// Report reports the latency and the error of the operation against the key, the latency is only
+// counted when the operation succeeds. It takes effect only when the adaptive limitation is enabled,
+// the errors which aren't caused by the load of the registry(e.g. not found) shouldn't be reported
+func (c *ConnectionLimiter) Report(key string, latency time.Duration, err error) {
+	if !isAdaptive() {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	a, exist := c.adaptive[key]
+	if !exist {
+		a = &adaptiveLimit{limit: initialAdaptiveConnections}
+		c.adaptive[key] = a
+	}
+	if err != nil || (a.latency > 0 && latency > a.latency*latencyRiseFactor) {
+		a.limit = math.Max(1, a.limit/2)
+	} else {
+		a.limit += 1 / a.limit
+		// the limitation doesn't grow beyond the ceiling, so it backs off from the ceiling rather than a larger value
+		ceiling := float64(c.maxes[key])
+		if ceiling <= 0 {
+			ceiling = maxAdaptiveConnections
+		}
+		a.limit = math.Min(a.limit, ceiling)
+		// the waiters may acquire the slots added
+		c.wakeUp(key)
+	}
+	if err == nil {
+		if a.latency == 0 {
+			a.latency = latency
+		} else {
+			a.latency = time.Duration(float64(a.latency)*(1-latencyWeight) + float64(latency)*latencyWeight)
+		}
+	}
+}
+
+// Limit returns the max count of concurrent operations of the key in effect, the adaptive one is
+// returned if the adaptive limitation is enabled
+func (c *ConnectionLimiter) Limit(key string) int {
+	c.Lock()
+	defer c.Unlock()
+	return c.limit(key)
+}
+
+// Connections returns the status of the concurrent operations against the keys which have been acquired
+func (c *ConnectionLimiter) Connections() []*ConnectionStatus {
+	c.Lock()
+	defer c.Unlock()
+	statuses := []*ConnectionStatus{}
+	for key := range c.maxes {
+		statuses = append(statuses, &ConnectionStatus{
+			Key:    key,
+			Active: c.active[key],
+			Limit:  c.limit(key),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Key < statuses[j].Key
+	})
+	return statuses
+}
+
+// Active returns the count of active operations of the key
+func (c *ConnectionLimiter) Active(key string) int {
+	c.Lock()
+	defer c.Unlock()
+	return c.active[key]
+}
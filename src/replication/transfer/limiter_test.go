@@ -0,0 +1,147 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionLimiterCap(t *testing.T) {
+	limiter := NewConnectionLimiter()
+	var current, peak int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, limiter.Acquire("https://small.example.com", 2, nil))
+			defer limiter.Release("https://small.example.com")
+			n := atomic.AddInt32(&current, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak)
+	assert.Equal(t, 0, limiter.Active("https://small.example.com"))
+}
+
+func TestConnectionLimiterPerKey(t *testing.T) {
+	limiter := NewConnectionLimiter()
+	assert.True(t, limiter.Acquire("a", 1, nil))
+	// the cap of one key doesn't affect the others
+	assert.True(t, limiter.Acquire("b", 1, nil))
+	assert.Equal(t, 1, limiter.Active("a"))
+	assert.Equal(t, 1, limiter.Active("b"))
+
+	// no limitation
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.Acquire("c", 0, nil))
+	}
+	assert.Equal(t, 5, limiter.Active("c"))
+}
+
+func TestConnectionLimiterStop(t *testing.T) {
+	interval := stopCheckInterval
+	stopCheckInterval = 10 * time.Millisecond
+	defer func() { stopCheckInterval = interval }()
+
+	limiter := NewConnectionLimiter()
+	assert.True(t, limiter.Acquire("a", 1, nil))
+	stopped := func() bool { return true }
+	assert.False(t, limiter.Acquire("a", 1, stopped))
+	assert.Equal(t, 1, limiter.Active("a"))
+
+	// the waiter acquires the slot once it's released
+	done := make(chan bool)
+	go func() {
+		done <- limiter.Acquire("a", 1, nil)
+	}()
+	limiter.Release("a")
+	assert.True(t, <-done)
+	assert.Equal(t, 1, limiter.Active("a"))
+}
+
+func TestMaxConnections(t *testing.T) {
+	defer SetDefaultMaxConnections(0)
+
+	assert.Equal(t, 0, MaxConnections(0))
+	assert.Equal(t, 3, MaxConnections(3))
+
+	// the changed default takes effect on the next call
+	SetDefaultMaxConnections(5)
+	assert.Equal(t, 5, MaxConnections(0))
+	assert.Equal(t, 3, MaxConnections(3))
+}
+
+func TestAdaptiveConnections(t *testing.T) {
+	limiter := NewConnectionLimiter()
+	assert.True(t, limiter.Acquire("a", 4, nil))
+	limiter.Release("a")
+
+	// the static limitation is used by default and the reports are ignored
+	limiter.Report("a", time.Second, nil)
+	assert.Equal(t, 4, limiter.Limit("a"))
+
+	SetAdaptiveConnections(true)
+	defer SetAdaptiveConnections(false)
+	assert.Equal(t, initialAdaptiveConnections, limiter.Limit("a"))
+
+	// ramps up while the latency is stable
+	for i := 0; i < 3; i++ {
+		limiter.Report("a", time.Second, nil)
+	}
+	assert.Equal(t, 3, limiter.Limit("a"))
+	// doesn't grow beyond the ceiling
+	for i := 0; i < 10; i++ {
+		limiter.Report("a", time.Second, nil)
+	}
+	assert.Equal(t, 4, limiter.Limit("a"))
+
+	// backs off when the latency rises
+	limiter.Report("a", 3*time.Second, nil)
+	assert.Equal(t, 2, limiter.Limit("a"))
+	// backs off when the operation fails, but not below 1
+	limiter.Report("a", time.Second, errors.New("error"))
+	assert.Equal(t, 1, limiter.Limit("a"))
+	limiter.Report("a", time.Second, errors.New("error"))
+	assert.Equal(t, 1, limiter.Limit("a"))
+
+	// the waiter acquires the slot once the limitation grows
+	assert.True(t, limiter.Acquire("a", 4, nil))
+	done := make(chan bool)
+	go func() {
+		done <- limiter.Acquire("a", 4, nil)
+	}()
+	for limiter.Limit("a") < 2 {
+		limiter.Report("a", time.Second, nil)
+	}
+	assert.True(t, <-done)
+	assert.Equal(t, []*ConnectionStatus{
+		{Key: "a", Active: 2, Limit: 2},
+	}, limiter.Connections())
+}
@@ -0,0 +1,111 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"math"
+	"time"
+)
+
+// CheckInProgressPrefix is the prefix of the message checked in by the replication job
+// periodically during the transfer, the rest of the message is the progress in JSON
+const CheckInProgressPrefix = "progress: "
+
+// the weight of the speed of the latest window in the rolling speed which the ETA is estimated by
+const etaSmoothing = 0.3
+
+// the speed at the beginning of the transfer is unstable, e.g. TCP slow start and the small
+// configs pushed before the layers, so the ETA isn't estimated until the transfer lasts long
+// enough and enough windows are sampled
+const (
+	etaMinElapsed = 5 * time.Second
+	etaMinWindows = 3
+)
+
+// Progress is the progress of the data transferred by a transfer
+type Progress struct {
+	// the count of bytes transferred and expected to be transferred
+	Bytes int64 `json:"bytes"`
+	Total int64 `json:"total"`
+	// the estimated seconds to transfer the rest of the bytes, it's omitted when
+	// the data sampled isn't enough to estimate it
+	ETA *int64 `json:"eta,omitempty"`
+}
+
+// ProgressReporter is implemented by the transfers reporting the progress during the transfer
+type ProgressReporter interface {
+	// Progress returns the progress of the transfer, nil is returned if nothing is expected
+	Progress() *Progress
+}
+
+// Expect records the bytes expected to be transferred, the negative value withdraws the
+// bytes expected but not transferred, e.g. the blob mounted rather than pushed
+func (m *Meter) Expect(n int64) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.total += n
+	if m.total < 0 {
+		m.total = 0
+	}
+}
+
+// Progress returns the bytes transferred and expected with the ETA estimated by the rolling speed,
+// nil is returned if nothing is expected or transferred
+func (m *Meter) Progress() *Progress {
+	if m == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.total == 0 && m.bytes == 0 {
+		return nil
+	}
+	progress := &Progress{
+		Bytes: m.bytes,
+		Total: m.total,
+	}
+	if m.total == 0 || m.start.IsZero() {
+		return progress
+	}
+
+	now := m.now()
+	rate, windows := m.rate, m.windows
+	// the current window is sampled if it's over although no data closes it, so the ETA
+	// grows rather than keeping the one estimated before when the transfer stalls
+	if elapsed := now.Sub(m.windowStart); elapsed >= speedWindow {
+		rate, windows = m.smooth(float64(m.windowBytes)/elapsed.Seconds()), windows+1
+	}
+	if windows < etaMinWindows || now.Sub(m.start) < etaMinElapsed || rate <= 0 {
+		return progress
+	}
+	remaining := m.total - m.bytes
+	if remaining < 0 {
+		remaining = 0
+	}
+	eta := int64(math.Ceil(float64(remaining) / rate))
+	progress.ETA = &eta
+	return progress
+}
+
+// smooth returns the rolling speed with the speed of the latest window, the caller must hold the lock
+func (m *Meter) smooth(speed float64) float64 {
+	if m.windows == 0 {
+		return speed
+	}
+	return etaSmoothing*speed + (1-etaSmoothing)*m.rate
+}
@@ -0,0 +1,90 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeterProgress(t *testing.T) {
+	now := time.Now()
+	meter := NewMeter()
+	meter.now = func() time.Time { return now }
+
+	// nothing expected or transferred
+	assert.Nil(t, meter.Progress())
+
+	// nothing transferred yet
+	meter.Expect(20 * bytesPerMB)
+	progress := meter.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(0), progress.Bytes)
+	assert.Equal(t, int64(20*bytesPerMB), progress.Total)
+	assert.Nil(t, progress.ETA)
+
+	// 1MB is transferred every second, the first window gets 2MB as the bytes
+	// recorded at the start are counted in it
+	meter.Add(bytesPerMB)
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Second)
+		meter.Add(bytesPerMB)
+	}
+	// the ETA isn't estimated in the first seconds
+	progress = meter.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(5*bytesPerMB), progress.Bytes)
+	assert.Nil(t, progress.ETA)
+
+	// the rolling speed of the windows is 2, 1.7, 1.49, 1.343 and 1.2401 MB/s,
+	// so the rest 14MB are estimated to be transferred in 12 seconds
+	now = now.Add(time.Second)
+	meter.Add(bytesPerMB)
+	progress = meter.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(6*bytesPerMB), progress.Bytes)
+	require.NotNil(t, progress.ETA)
+	assert.Equal(t, int64(12), *progress.ETA)
+
+	// the ETA grows when the transfer stalls, the rolling speed drops to 0.86807 MB/s
+	now = now.Add(10 * time.Second)
+	progress = meter.Progress()
+	require.NotNil(t, progress)
+	require.NotNil(t, progress.ETA)
+	assert.Equal(t, int64(17), *progress.ETA)
+
+	// the ETA is 0 when more bytes than expected are transferred
+	meter.Expect(-15 * bytesPerMB)
+	progress = meter.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(5*bytesPerMB), progress.Total)
+	require.NotNil(t, progress.ETA)
+	assert.Equal(t, int64(0), *progress.ETA)
+
+	// the total expected isn't negative
+	meter.Expect(-10 * bytesPerMB)
+	progress = meter.Progress()
+	require.NotNil(t, progress)
+	assert.Equal(t, int64(0), progress.Total)
+	assert.Nil(t, progress.ETA)
+
+	// the nil meter doesn't report the progress
+	var m *Meter
+	m.Expect(bytesPerMB)
+	assert.Nil(t, m.Progress())
+}
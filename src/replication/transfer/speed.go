@@ -0,0 +1,146 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// CheckInSpeedPrefix is the prefix of the message checked in by the replication job
+// when the transfer completes, the rest of the message is the speed in JSON
+const CheckInSpeedPrefix = "speed: "
+
+// the length of the window in which the speed is sampled to get the peak speed
+const speedWindow = time.Second
+
+const bytesPerMB = 1024 * 1024
+
+// Speed is the speed of the data transferred by a transfer
+type Speed struct {
+	// the count of bytes transferred
+	Bytes int64 `json:"bytes"`
+	// the average and peak speed in MB/s
+	Average float64 `json:"average"`
+	Peak    float64 `json:"peak"`
+}
+
+// SpeedReporter is implemented by the transfers measuring the speed of the data transferred
+type SpeedReporter interface {
+	// Speed returns the speed of the data transferred, nil is returned if nothing is transferred
+	Speed() *Speed
+}
+
+// Meter measures the speed of the data transferred. The average speed is the bytes divided
+// by the time from the first data to the last one, the peak speed is the highest one sampled
+// in the windows of one second, it's the average speed if the transfer lasts less than a window
+type Meter struct {
+	lock  sync.Mutex
+	bytes int64
+	start time.Time
+	last  time.Time
+	// the bytes transferred in the current window
+	windowStart time.Time
+	windowBytes int64
+	// the peak speed in bytes/s
+	peak float64
+	// the bytes expected to be transferred, the rolling speed in bytes/s smoothed over
+	// the windows and the count of the windows sampled, they're used to estimate the ETA
+	total   int64
+	rate    float64
+	windows int
+	now     func() time.Time
+}
+
+// NewMeter returns an instance of Meter
+func NewMeter() *Meter {
+	return &Meter{
+		now: time.Now,
+	}
+}
+
+// Add records the bytes transferred
+func (m *Meter) Add(n int64) {
+	if n <= 0 {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.now()
+	if m.start.IsZero() {
+		m.start = now
+		m.windowStart = now
+	}
+	m.bytes += n
+	m.last = now
+	// the bytes are counted in the window they're recorded in
+	m.windowBytes += n
+	if elapsed := now.Sub(m.windowStart); elapsed >= speedWindow {
+		speed := float64(m.windowBytes) / elapsed.Seconds()
+		if speed > m.peak {
+			m.peak = speed
+		}
+		m.rate, m.windows = m.smooth(speed), m.windows+1
+		m.windowStart = now
+		m.windowBytes = 0
+	}
+}
+
+// Reader returns a reader which records the bytes read from the reader in the meter,
+// the reader is returned as is if the meter is nil
+func (m *Meter) Reader(reader io.Reader) io.Reader {
+	if m == nil {
+		return reader
+	}
+	return &meterReader{
+		reader: reader,
+		meter:  m,
+	}
+}
+
+// Speed returns the speed of the data transferred, nil is returned if nothing is transferred
+func (m *Meter) Speed() *Speed {
+	if m == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.bytes == 0 {
+		return nil
+	}
+	speed := &Speed{
+		Bytes: m.bytes,
+	}
+	if elapsed := m.last.Sub(m.start); elapsed > 0 {
+		speed.Average = float64(m.bytes) / elapsed.Seconds() / bytesPerMB
+	}
+	speed.Peak = m.peak / bytesPerMB
+	if speed.Peak < speed.Average {
+		speed.Peak = speed.Average
+	}
+	return speed
+}
+
+type meterReader struct {
+	reader io.Reader
+	meter  *Meter
+}
+
+func (m *meterReader) Read(p []byte) (int, error) {
+	n, err := m.reader.Read(p)
+	m.meter.Add(int64(n))
+	return n, err
+}
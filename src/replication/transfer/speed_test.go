@@ -0,0 +1,85 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	now := time.Now()
+	meter := NewMeter()
+	meter.now = func() time.Time { return now }
+
+	// nothing transferred
+	assert.Nil(t, meter.Speed())
+
+	// the bytes recorded at the end of a window are counted in it, so the windows
+	// ending at the 1st, 2nd, 3rd and 4th second get 2MB, 3MB, 1MB and 1MB
+	meter.Add(bytesPerMB)
+	now = now.Add(time.Second)
+	meter.Add(bytesPerMB)
+	now = now.Add(time.Second)
+	meter.Add(3 * bytesPerMB)
+	now = now.Add(time.Second)
+	meter.Add(bytesPerMB)
+	now = now.Add(time.Second)
+	meter.Add(bytesPerMB)
+
+	speed := meter.Speed()
+	require.NotNil(t, speed)
+	assert.Equal(t, int64(7*bytesPerMB), speed.Bytes)
+	// 7MB in 4 seconds
+	assert.Equal(t, 1.75, speed.Average)
+	assert.Equal(t, 3.0, speed.Peak)
+}
+
+func TestMeterWithinWindow(t *testing.T) {
+	now := time.Now()
+	meter := NewMeter()
+	meter.now = func() time.Time { return now }
+
+	meter.Add(bytesPerMB)
+	now = now.Add(500 * time.Millisecond)
+	meter.Add(bytesPerMB)
+
+	// the peak is the average speed if the transfer lasts less than a window
+	speed := meter.Speed()
+	require.NotNil(t, speed)
+	assert.Equal(t, 4.0, speed.Average)
+	assert.Equal(t, 4.0, speed.Peak)
+}
+
+func TestMeterReader(t *testing.T) {
+	meter := NewMeter()
+	data, err := ioutil.ReadAll(meter.Reader(bytes.NewReader([]byte("blob"))))
+	require.Nil(t, err)
+	assert.Equal(t, "blob", string(data))
+	speed := meter.Speed()
+	require.NotNil(t, speed)
+	assert.Equal(t, int64(4), speed.Bytes)
+
+	// the nil meter doesn't measure the reader
+	var m *Meter
+	reader := bytes.NewReader([]byte("blob"))
+	assert.Equal(t, reader, m.Reader(reader))
+	assert.Nil(t, m.Speed())
+}
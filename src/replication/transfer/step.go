@@ -0,0 +1,229 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// StepLogPrefix is the prefix of the log lines which contain the structured logs of the steps,
+// the rest of the line is the JSON of the step log. The step logs are persisted in the plain
+// text log of the task so that they are retrieved together with it
+const StepLogPrefix = "[step] "
+
+// the phases of the steps
+const (
+	StepPhaseCopy   = "copy"
+	StepPhaseDelete = "delete"
+	// the blob uploaded to the destination registry or skipped as it exists there already
+	StepPhaseBlob = "blob"
+	// the summary of the bytes transferred for the repository
+	StepPhaseRepository = "repository"
+)
+
+// the results of the steps
+const (
+	StepResultSucceeded = "succeeded"
+	StepResultFailed    = "failed"
+	StepResultSkipped   = "skipped"
+	// the repository is skipped as a whole as all its tags are identical on the destination registry
+	StepResultUpToDate = "up_to_date"
+)
+
+// the verifications of the steps of the delete phase, the manifest is checked again after the
+// destination registry reports it deleted as some registries delete lazily
+const (
+	// the manifest is gone from the destination registry
+	StepVerificationVerified = "verified"
+	// the destination registry reported the manifest deleted but it still exists
+	StepVerificationPersisted = "persisted"
+	// the existence of the manifest couldn't be checked after the deletion
+	StepVerificationUnverified = "unverified"
+)
+
+// SkippedError is returned when the step is skipped for the reason which doesn't fail the transfer,
+// e.g. the image contains the layers which aren't allowed by the destination registry
+type SkippedError struct {
+	Reason string
+}
+
+func (s *SkippedError) Error() string {
+	return s.Reason
+}
+
+// StepLog is the structured log of one step of the transfer, e.g. copying one tag of the
+// repository, the duration is in milliseconds
+type StepLog struct {
+	Phase      string `json:"phase"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Result     string `json:"result"`
+	Duration   int64  `json:"duration"`
+	Error      string `json:"error,omitempty"`
+	// the digest and size of the blob, only set for the steps of the blob phase
+	Digest string `json:"digest,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// the accounting of the blobs, only set for the steps of the repository phase
+	Bytes *ByteAccounting `json:"bytes,omitempty"`
+	// whether the manifest is gone after the deletion, only set for the steps of the delete phase
+	Verification string `json:"verification,omitempty"`
+}
+
+// ByteAccounting counts the blobs and their bytes uploaded to the destination registry and
+// the ones skipped as they exist there already or are mounted from the other repositories
+type ByteAccounting struct {
+	UploadedBlobs int   `json:"uploaded_blobs"`
+	UploadedBytes int64 `json:"uploaded_bytes"`
+	SkippedBlobs  int   `json:"skipped_blobs"`
+	SkippedBytes  int64 `json:"skipped_bytes"`
+}
+
+// Add counts the blob with the size as uploaded, or skipped if "skipped" is true
+func (b *ByteAccounting) Add(size int64, skipped bool) {
+	if skipped {
+		b.SkippedBlobs++
+		b.SkippedBytes += size
+		return
+	}
+	b.UploadedBlobs++
+	b.UploadedBytes += size
+}
+
+// LogStep logs the structured log of the step which started at the specified time, the step
+// succeeded if the error is nil and is skipped if the error is a "SkippedError"
+func LogStep(logger Logger, phase, repository, tag string, start time.Time, err error) {
+	step := &StepLog{
+		Phase:      phase,
+		Repository: repository,
+		Tag:        tag,
+		Result:     stepResult(err),
+		Duration:   int64(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	logStep(logger, step)
+}
+
+// LogDeleteStep logs the structured log of deleting the tag which started at the specified time with
+// the verification of the deletion, the verification is empty if the deletion isn't verified, e.g. dry run
+func LogDeleteStep(logger Logger, repository, tag string, start time.Time, verification string, err error) {
+	step := &StepLog{
+		Phase:        StepPhaseDelete,
+		Repository:   repository,
+		Tag:          tag,
+		Result:       stepResult(err),
+		Duration:     int64(time.Since(start) / time.Millisecond),
+		Verification: verification,
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	logStep(logger, step)
+}
+
+// the step succeeded if the error is nil and is skipped if the error is a "SkippedError"
+func stepResult(err error) string {
+	if err == nil {
+		return StepResultSucceeded
+	}
+	if _, ok := err.(*SkippedError); ok {
+		return StepResultSkipped
+	}
+	return StepResultFailed
+}
+
+// LogBlobStep logs the structured log of the blob of the repository which is uploaded to the
+// destination registry, or skipped if "skipped" is true
+func LogBlobStep(logger Logger, repository, digest string, size int64, skipped bool) {
+	step := &StepLog{
+		Phase:      StepPhaseBlob,
+		Repository: repository,
+		Result:     StepResultSucceeded,
+		Digest:     digest,
+		Size:       size,
+	}
+	if skipped {
+		step.Result = StepResultSkipped
+	}
+	logStep(logger, step)
+}
+
+// LogRepositoryStep logs the structured log summarizing the blobs of the repository whose transfer
+// started at the specified time, the blobs transferred before the failure are counted as well
+func LogRepositoryStep(logger Logger, repository string, start time.Time, bytes ByteAccounting, err error) {
+	step := &StepLog{
+		Phase:      StepPhaseRepository,
+		Repository: repository,
+		Result:     StepResultSucceeded,
+		Duration:   int64(time.Since(start) / time.Millisecond),
+		Bytes:      &bytes,
+	}
+	if err != nil {
+		step.Result = StepResultFailed
+		step.Error = err.Error()
+	}
+	logStep(logger, step)
+}
+
+// LogUpToDateStep logs the structured log of the repository which is skipped as a whole as it's up to
+// date on the destination registry, the check started at the specified time
+func LogUpToDateStep(logger Logger, repository string, start time.Time) {
+	logStep(logger, &StepLog{
+		Phase:      StepPhaseRepository,
+		Repository: repository,
+		Result:     StepResultUpToDate,
+		Duration:   int64(time.Since(start) / time.Millisecond),
+		Bytes:      &ByteAccounting{},
+	})
+}
+
+func logStep(logger Logger, step *StepLog) {
+	data, err := json.Marshal(step)
+	if err != nil {
+		logger.Warningf("failed to marshal the step log: %v", err)
+		return
+	}
+	logger.Info(StepLogPrefix + string(data))
+}
+
+// ParseStepLogs parses the structured logs of the steps from the plain text log of the task,
+// the lines which aren't the step logs are ignored. The error is returned if the log cannot be
+// read to the end, e.g. it contains a line longer than 1MB
+func ParseStepLogs(log []byte) ([]*StepLog, error) {
+	steps := []*StepLog{}
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		index := strings.Index(line, StepLogPrefix)
+		if index < 0 {
+			continue
+		}
+		step := &StepLog{}
+		if err := json.Unmarshal([]byte(line[index+len(StepLogPrefix):]), step); err != nil {
+			continue
+		}
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
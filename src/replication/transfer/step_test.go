@@ -0,0 +1,164 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the logger which formats the lines in the same way as the logger of jobservice
+type fakedLogger struct {
+	lines []string
+}
+
+func (f *fakedLogger) log(level, msg string) {
+	f.lines = append(f.lines, fmt.Sprintf("2019-07-01T08:00:00Z [%s] [/replication/transfer/image/transfer.go:200]: %s", level, msg))
+}
+func (f *fakedLogger) Debug(v ...interface{}) { f.log("DEBUG", fmt.Sprint(v...)) }
+func (f *fakedLogger) Debugf(format string, v ...interface{}) {
+	f.log("DEBUG", fmt.Sprintf(format, v...))
+}
+func (f *fakedLogger) Info(v ...interface{}) { f.log("INFO", fmt.Sprint(v...)) }
+func (f *fakedLogger) Infof(format string, v ...interface{}) {
+	f.log("INFO", fmt.Sprintf(format, v...))
+}
+func (f *fakedLogger) Warning(v ...interface{}) { f.log("WARNING", fmt.Sprint(v...)) }
+func (f *fakedLogger) Warningf(format string, v ...interface{}) {
+	f.log("WARNING", fmt.Sprintf(format, v...))
+}
+func (f *fakedLogger) Error(v ...interface{}) { f.log("ERROR", fmt.Sprint(v...)) }
+func (f *fakedLogger) Errorf(format string, v ...interface{}) {
+	f.log("ERROR", fmt.Sprintf(format, v...))
+}
+
+func TestStepLogs(t *testing.T) {
+	logger := &fakedLogger{}
+	logger.Infof("copying library/hello-world:[latest,v1](source registry)...")
+	LogStep(logger, StepPhaseCopy, "library/hello-world", "latest", time.Now().Add(-2*time.Second), nil)
+	LogStep(logger, StepPhaseCopy, "library/hello-world", "v1", time.Now(), errors.New("manifest unknown"))
+	LogStep(logger, StepPhaseDelete, "library/busybox", "", time.Now(), nil)
+	LogStep(logger, StepPhaseCopy, "library/windows", "ltsc2019", time.Now(), &SkippedError{Reason: "foreign layers"})
+	logger.Info(StepLogPrefix + "{invalid")
+
+	steps, err := ParseStepLogs([]byte(strings.Join(logger.lines, "\n")))
+	require.Nil(t, err)
+	require.Equal(t, 4, len(steps))
+
+	assert.Equal(t, StepPhaseCopy, steps[0].Phase)
+	assert.Equal(t, "library/hello-world", steps[0].Repository)
+	assert.Equal(t, "latest", steps[0].Tag)
+	assert.Equal(t, StepResultSucceeded, steps[0].Result)
+	assert.True(t, steps[0].Duration >= 2000)
+	assert.Empty(t, steps[0].Error)
+
+	assert.Equal(t, "v1", steps[1].Tag)
+	assert.Equal(t, StepResultFailed, steps[1].Result)
+	assert.Equal(t, "manifest unknown", steps[1].Error)
+
+	assert.Equal(t, StepPhaseDelete, steps[2].Phase)
+	assert.Equal(t, "library/busybox", steps[2].Repository)
+	assert.Empty(t, steps[2].Tag)
+
+	assert.Equal(t, StepResultSkipped, steps[3].Result)
+	assert.Equal(t, "foreign layers", steps[3].Error)
+
+	// no step logs
+	steps, err = ParseStepLogs([]byte("the job is stopped"))
+	require.Nil(t, err)
+	assert.Equal(t, []*StepLog{}, steps)
+
+	// the line is too long to be read
+	_, err = ParseStepLogs([]byte(strings.Repeat("a", 2*1024*1024)))
+	assert.NotNil(t, err)
+}
+
+func TestBlobStepLogs(t *testing.T) {
+	logger := &fakedLogger{}
+	bytes := ByteAccounting{}
+	bytes.Add(100, false)
+	LogBlobStep(logger, "library/hello-world", "sha256:uploaded", 100, false)
+	bytes.Add(50, true)
+	LogBlobStep(logger, "library/hello-world", "sha256:existing", 50, true)
+	bytes.Add(30, true)
+	LogBlobStep(logger, "library/hello-world", "sha256:mounted", 30, true)
+	LogRepositoryStep(logger, "library/hello-world", time.Now(), bytes, nil)
+	LogRepositoryStep(logger, "library/busybox", time.Now(), ByteAccounting{}, errors.New("blob unknown"))
+
+	steps, err := ParseStepLogs([]byte(strings.Join(logger.lines, "\n")))
+	require.Nil(t, err)
+	require.Equal(t, 5, len(steps))
+
+	assert.Equal(t, StepPhaseBlob, steps[0].Phase)
+	assert.Equal(t, "sha256:uploaded", steps[0].Digest)
+	assert.Equal(t, int64(100), steps[0].Size)
+	assert.Equal(t, StepResultSucceeded, steps[0].Result)
+	assert.Nil(t, steps[0].Bytes)
+	assert.Equal(t, StepResultSkipped, steps[1].Result)
+	assert.Equal(t, StepResultSkipped, steps[2].Result)
+
+	// the skipped blobs are counted separately from the uploaded ones
+	assert.Equal(t, StepPhaseRepository, steps[3].Phase)
+	assert.Equal(t, StepResultSucceeded, steps[3].Result)
+	assert.Empty(t, steps[3].Digest)
+	require.NotNil(t, steps[3].Bytes)
+	assert.Equal(t, ByteAccounting{
+		UploadedBlobs: 1,
+		UploadedBytes: 100,
+		SkippedBlobs:  2,
+		SkippedBytes:  80,
+	}, *steps[3].Bytes)
+
+	assert.Equal(t, "library/busybox", steps[4].Repository)
+	assert.Equal(t, StepResultFailed, steps[4].Result)
+	assert.Equal(t, "blob unknown", steps[4].Error)
+	require.NotNil(t, steps[4].Bytes)
+	assert.Equal(t, ByteAccounting{}, *steps[4].Bytes)
+}
+
+func TestDeleteStepLogs(t *testing.T) {
+	logger := &fakedLogger{}
+	LogDeleteStep(logger, "library/hello-world", "latest", time.Now(), StepVerificationVerified, nil)
+	LogDeleteStep(logger, "library/hello-world", "v1", time.Now(), StepVerificationPersisted, errors.New("the manifest still exists"))
+	LogDeleteStep(logger, "library/hello-world", "v2", time.Now(), "", nil)
+	LogDeleteStep(logger, "library/hello-world", "v3", time.Now(), StepVerificationVerified, &SkippedError{Reason: "the image doesn't exist"})
+
+	steps, err := ParseStepLogs([]byte(strings.Join(logger.lines, "\n")))
+	require.Nil(t, err)
+	require.Equal(t, 4, len(steps))
+
+	assert.Equal(t, StepPhaseDelete, steps[0].Phase)
+	assert.Equal(t, "latest", steps[0].Tag)
+	assert.Equal(t, StepResultSucceeded, steps[0].Result)
+	assert.Equal(t, StepVerificationVerified, steps[0].Verification)
+
+	assert.Equal(t, StepResultFailed, steps[1].Result)
+	assert.Equal(t, StepVerificationPersisted, steps[1].Verification)
+	assert.Equal(t, "the manifest still exists", steps[1].Error)
+
+	// the deletion isn't verified
+	assert.Equal(t, StepResultSucceeded, steps[2].Result)
+	assert.Empty(t, steps[2].Verification)
+	assert.NotContains(t, logger.lines[2], "verification")
+
+	assert.Equal(t, StepResultSkipped, steps[3].Result)
+	assert.Equal(t, "the image doesn't exist", steps[3].Error)
+}
@@ -25,6 +25,67 @@ var (
 	registry = map[model.ResourceType]Factory{}
 )
 
+// CheckInReadOnly is the message checked in by the replication job when the
+// transfer is paused as the destination registry is read-only
+const CheckInReadOnly = "target read-only"
+
+// CheckInBlackoutPrefix is the prefix of the message checked in by the replication job when
+// the destination registry is in blackout as the job runs, the rest of the message is the end
+// of the blackout in RFC3339 format. Nothing is transferred and the task is deferred by core
+const CheckInBlackoutPrefix = "blackout: "
+
+// CheckInFailurePrefix is the prefix of the message checked in by the replication
+// job when the transfer fails, the rest of the message is the reason of the failure
+const CheckInFailurePrefix = "failure: "
+
+// CheckInReferrersPrefix is the prefix of the message checked in by the replication job
+// after the transfer, the rest of the message is the count of the referrers transferred
+const CheckInReferrersPrefix = "referrers: "
+
+// ReferrerReporter is implemented by the transfers which replicate the referrers of the
+// images, e.g. signatures, SBOMs and attestations
+type ReferrerReporter interface {
+	// Referrers returns the count of the referrers transferred
+	Referrers() int
+}
+
+// CheckInMediaTypesPrefix is the prefix of the message checked in by the replication job after the
+// transfer, the rest of the message is the media types of the manifests on the destination registry
+// separated by commas
+const CheckInMediaTypesPrefix = "media types: "
+
+// CheckInEndpointsPrefix is the prefix of the message checked in by the replication job after the
+// transfer, the rest of the message is the endpoints of the source and destination registries used
+// by the transfer separated by a space
+const CheckInEndpointsPrefix = "endpoints: "
+
+// EndpointReporter is implemented by the transfers which report the endpoints of the registries
+// they use, the endpoint is one of the failover URLs if the primary one is unhealthy
+type EndpointReporter interface {
+	// Endpoints returns the endpoints of the source and destination registries
+	Endpoints() (src string, dst string)
+}
+
+// MediaTypeReporter is implemented by the transfers which report the media types of the manifests
+// on the destination registry, they may differ from the source ones as the manifests are converted
+type MediaTypeReporter interface {
+	// MediaTypes returns the distinct media types of the manifests
+	MediaTypes() []string
+}
+
+// InsufficientStorageError is returned when the storage available on the destination
+// registry isn't enough for the estimated size of the data to be transferred
+type InsufficientStorageError struct {
+	Repository string
+	Required   int64
+	Available  int64
+}
+
+func (i *InsufficientStorageError) Error() string {
+	return fmt.Sprintf("insufficient storage on the destination registry for repository %s: %d bytes required, %d bytes available",
+		i.Repository, i.Required, i.Available)
+}
+
 // Factory creates a specific Transfer. The "Logger" is used
 // to log the processing messages and the "StopFunc"
 // can be used to check whether the task has been stopped
@@ -17,6 +17,7 @@ package util
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/goharbor/harbor/src/common/utils/registry"
 )
@@ -26,6 +27,30 @@ func GetHTTPTransport(insecure bool) *http.Transport {
 	return registry.GetHTTPTransport(insecure)
 }
 
+// GetHTTPTransportWithTunnel returns the transport dialing through the SSH tunnel if it's specified,
+// otherwise the shared HTTP transport is returned
+func GetHTTPTransportWithTunnel(tunnel *registry.SSHTunnel, insecure bool) (*http.Transport, error) {
+	if tunnel == nil {
+		return registry.GetHTTPTransport(insecure), nil
+	}
+	return registry.GetTunnelTransport(tunnel, insecure)
+}
+
+// SetTransportTimeouts sets the timeouts of connecting and TLS handshake for the shared HTTP transports
+func SetTransportTimeouts(dialTimeout, tlsHandshakeTimeout time.Duration) {
+	registry.SetTransportTimeouts(dialTimeout, tlsHandshakeTimeout)
+}
+
+// SetResolver sets the DNS server and the static host mappings used to resolve the hostnames of the registries
+func SetResolver(nameserver string, hosts map[string]string) error {
+	return registry.SetResolver(nameserver, hosts)
+}
+
+// SetMaxManifestSize sets the max size in bytes of the manifests pulled from the registries
+func SetMaxManifestSize(size int64) {
+	registry.SetMaxManifestSize(size)
+}
+
 // ParseRepository parses the "repository" provided into two parts: namespace and the rest
 // the string before the last "/" is the namespace part
 // c -> [,c]